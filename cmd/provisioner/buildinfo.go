@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/minio"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/release"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// buildInfoTimeout bounds looking up the versions of qemu-img and LVM, and reading
+// the minimum version manifest
+const buildInfoTimeout = 10 * time.Second
+
+// buildInfo is always 1, labelled with the versions of the provisioner and the tools it
+// runs, so that fleet dashboards can spot hosts still running an old binary
+var buildInfo = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "libvirt_volume_provisioner_build_info",
+		Help: "Versions of the provisioner, the Go runtime it was built with, qemu-img and LVM; always 1",
+	},
+	[]string{"version", "go_version", "qemu_img_version", "lvm_version"},
+)
+
+// versionOutdated is 1 while the running version is older than the minimum version manifest
+var versionOutdated = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "libvirt_volume_provisioner_version_outdated",
+		Help: "1 if the running version is older than the minimum version in VERSION_MANIFEST_URL",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(buildInfo, versionOutdated)
+}
+
+// recordBuildInfo sets the build info metric. The qemu-img and LVM versions are looked
+// up with lvmManager, and left empty without one, as in coordinator mode, or if they
+// cannot be determined.
+func recordBuildInfo(lvmManager *lvm.Manager) {
+	var qemuImgVersion, lvmVersion string
+	if lvmManager != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), buildInfoTimeout)
+		defer cancel()
+		var err error
+		if qemuImgVersion, err = lvmManager.QemuImgVersion(ctx); err != nil {
+			logrus.WithError(err).Warn("Failed to determine qemu-img version for build info")
+		}
+		if lvmVersion, err = lvmManager.LVMVersion(ctx); err != nil {
+			logrus.WithError(err).Warn("Failed to determine LVM version for build info")
+		}
+	}
+	buildInfo.WithLabelValues(version, runtime.Version(), qemuImgVersion, lvmVersion).Set(1)
+}
+
+// newVersionInfo describes the running binary. If VERSION_MANIFEST_URL names a minimum
+// version manifest in MinIO, the version is checked against it, and an outdated binary
+// is logged as an error and reported by the version_outdated metric.
+func newVersionInfo() types.VersionResponse {
+	info := types.VersionResponse{
+		Version:   version,
+		BuildTime: buildTime,
+		GitCommit: gitCommit,
+		GoVersion: runtime.Version(),
+	}
+	manifestURL := os.Getenv("VERSION_MANIFEST_URL")
+	if manifestURL == "" {
+		return info
+	}
+	fields := logrus.Fields{"version": version, "manifest_url": manifestURL}
+
+	minioClient, err := minio.NewClient()
+	if err != nil {
+		logrus.WithError(err).WithFields(fields).Warn("Failed to check minimum version")
+		return info
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), buildInfoTimeout)
+	defer cancel()
+	data, err := minioClient.GetURLContent(ctx, manifestURL)
+	if err != nil {
+		logrus.WithError(err).WithFields(fields).Warn("Failed to read minimum version manifest")
+		return info
+	}
+	manifest, err := release.ParseManifest(data)
+	if err != nil {
+		logrus.WithError(err).WithFields(fields).Warn("Failed to check minimum version")
+		return info
+	}
+	info.MinimumVersion = manifest.MinimumVersion
+	info.Message = manifest.Message
+	fields["minimum_version"] = manifest.MinimumVersion
+
+	outdated, err := manifest.Outdated(version)
+	switch {
+	case err != nil:
+		logrus.WithError(err).WithFields(fields).Warn("Failed to check minimum version")
+	case outdated:
+		info.Outdated = true
+		versionOutdated.Set(1)
+		logrus.WithFields(fields).WithField("message", manifest.Message).
+			Error("Running version is older than the minimum version; upgrade this host")
+	default:
+		logrus.WithFields(fields).Info("Running version meets the minimum version")
+	}
+	return info
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/jobs"
+	"github.com/sirupsen/logrus"
+)
+
+// imageCache is an image cache backend together with the directories it writes to
+type imageCache interface {
+	jobs.ImageCache
+	PoolPaths() []string
+	SetMinFreeBytes(bytes uint64)
+}
+
+// newImageCache selects the image cache backend.
+// mode "true" requires libvirt, "false" uses plain directories, and "auto"
+// uses libvirt when it is reachable and falls back to plain directories otherwise.
+func newImageCache(mode, poolSpec, cacheDir string) (imageCache, error) {
+	switch mode {
+	case "true":
+		return newLibvirtCache(poolSpec, cacheDir)
+	case "false":
+		logrus.Info("Libvirt disabled, using filesystem image cache")
+		return newDirectoryCache(poolSpec, cacheDir)
+	case "auto":
+		libvirtCache, err := newLibvirtCache(poolSpec, cacheDir)
+		if err == nil {
+			return libvirtCache, nil
+		}
+		logrus.WithError(err).Warn("Libvirt unavailable, falling back to filesystem image cache")
+		return newDirectoryCache(poolSpec, cacheDir)
+	default:
+		return nil, fmt.Errorf("invalid LIBVIRT_ENABLED value '%s': must be true, false or auto", mode)
+	}
+}
+
+// newDirectoryCache creates a filesystem-only image cache
+func newDirectoryCache(poolSpec, cacheDir string) (imageCache, error) {
+	directoryCache, err := cache.NewDirectoryCache(poolSpec, cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize filesystem image cache: %w", err)
+	}
+	return directoryCache, nil
+}
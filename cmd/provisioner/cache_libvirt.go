@@ -0,0 +1,21 @@
+//go:build !nolibvirt
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/libvirt"
+)
+
+// newLibvirtCache creates an image cache backed by libvirt storage pools
+func newLibvirtCache(poolSpec, cacheDir string) (imageCache, error) {
+	libvirtPool, err := libvirt.NewPoolManager(poolSpec, cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize libvirt pool manager: %w", err)
+	}
+	libvirtPool.StartHealthCheck(context.Background(), 30*time.Second)
+	return libvirtPool, nil
+}
@@ -0,0 +1,10 @@
+//go:build nolibvirt
+
+package main
+
+import "fmt"
+
+// newLibvirtCache is unavailable in binaries built with the nolibvirt tag
+func newLibvirtCache(_, _ string) (imageCache, error) {
+	return nil, fmt.Errorf("libvirt support not compiled in (built with nolibvirt tag)")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/minio"
+	"github.com/sirupsen/logrus"
+)
+
+// devDefaults are the settings of --dev mode, applied unless set in the environment.
+// Everything is kept below dir, the API is served over plain HTTP on localhost with
+// the development token, and volumes are kept as files without libvirt.
+func devDefaults(dir string) map[string]string {
+	return map[string]string{
+		"HOST":              "127.0.0.1",
+		"CLIENT_CA_CERT":    filepath.Join(dir, "client-ca.crt"),
+		"API_TOKENS_FILE":   filepath.Join(dir, "tokens"),
+		"DATABASE_PATH":     filepath.Join(dir, "provisioner.db"),
+		"LIBVIRT_ENABLED":   "false",
+		"LIBVIRT_CACHE_DIR": filepath.Join(dir, "cache"),
+		"LVM_BACKEND":       "file",
+		"LVM_FILE_DIR":      filepath.Join(dir, "volumes"),
+		"CACHE_MIN_FREE_MB": "0",
+	}
+}
+
+// setUpDevMode applies the --dev defaults and, unless MINIO_ENDPOINT is set, serves
+// the buckets in <dir>/minio as a stand-in for MinIO. The server is returned to be
+// closed on shutdown, or nil if MinIO is used.
+func setUpDevMode(dir string) (*minio.DirectoryServer, error) {
+	bucketDir := filepath.Join(dir, "minio", "images")
+	for _, path := range []string{bucketDir, filepath.Join(dir, "cache", "images")} {
+		if err := os.MkdirAll(path, 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create development directory: %w", err)
+		}
+	}
+
+	defaults := devDefaults(dir)
+	var server *minio.DirectoryServer
+	if os.Getenv("MINIO_ENDPOINT") == "" {
+		var err error
+		server, err = minio.NewDirectoryServer(filepath.Dir(bucketDir))
+		if err != nil {
+			return nil, err
+		}
+		defaults["MINIO_ENDPOINT"] = server.URL()
+		defaults["MINIO_ACCESS_KEY"] = "dev"
+		defaults["MINIO_SECRET_KEY"] = "dev"
+	}
+	for key, value := range defaults {
+		if os.Getenv(key) == "" {
+			if err := os.Setenv(key, value); err != nil {
+				return nil, fmt.Errorf("failed to set %s: %w", key, err)
+			}
+		}
+	}
+
+	fields := logrus.Fields{"dir": dir}
+	if server != nil {
+		fields["minio_endpoint"] = server.URL()
+		fields["image_dir"] = bucketDir
+	}
+	logrus.WithFields(fields).Warn("Running in development mode with simulated LVM, libvirt and MinIO")
+	return server, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/auth"
+)
+
+// hashTokenUsage describes the hash-token command
+const hashTokenUsage = `usage: libvirt-volume-provisioner hash-token [-]
+
+Generates a new API token and prints it with its hash. With "-", the token to hash
+is read from standard input instead. Give the token to the client and add the hash
+to the tokens file (API_TOKENS_FILE) in place of the plaintext token.`
+
+// hashTokenCommand implements the hash-token command
+func hashTokenCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	var token string
+	switch {
+	case len(args) == 0:
+		generated, err := auth.GenerateToken()
+		if err != nil {
+			return err
+		}
+		token = generated
+	case len(args) == 1 && args[0] == "-":
+		// Read the token from standard input, so it stays out of the shell history
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read token: %w", err)
+		}
+		token = strings.TrimSpace(line)
+		if token == "" {
+			return fmt.Errorf("no token on standard input")
+		}
+	default:
+		return errors.New(hashTokenUsage)
+	}
+
+	hash, err := auth.HashToken(token)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		if _, err := fmt.Fprintf(stdout, "token: %s\n", token); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(stdout, "hash:  %s\n", hash)
+	return err
+}
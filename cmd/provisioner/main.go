@@ -5,21 +5,39 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rossigee/libvirt-volume-provisioner/csi"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/alerts"
 	"github.com/rossigee/libvirt-volume-provisioner/internal/api"
 	"github.com/rossigee/libvirt-volume-provisioner/internal/auth"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/fleet"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/intake"
 	"github.com/rossigee/libvirt-volume-provisioner/internal/jobs"
-	"github.com/rossigee/libvirt-volume-provisioner/internal/libvirt"
 	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
 	"github.com/rossigee/libvirt-volume-provisioner/internal/minio"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/netbox"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/overlay"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/profiles"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/refresh"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/retry"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/schedule"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/selftest"
 	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/systemd"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/ui"
 	"github.com/sirupsen/logrus"
 )
 
@@ -27,9 +45,26 @@ import (
 var (
 	version   = "dev"
 	buildTime = "unknown"
+	gitCommit = "unknown"
 )
 
 func main() {
+	// Subcommands run instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "hash-token" {
+		if err := hashTokenCommand(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		if err := reconcileCommand(os.Args[2:], os.Getenv("PROVISIONER_TOKEN"), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Configure logrus for structured JSON logging
 	logrus.SetFormatter(&logrus.JSONFormatter{
 		TimestampFormat: time.RFC3339,
@@ -44,8 +79,20 @@ func main() {
 	logrus.WithFields(logrus.Fields{
 		"version":   version,
 		"buildTime": buildTime,
+		"gitCommit": gitCommit,
 	}).Info("Starting libvirt-volume-provisioner")
 
+	// Development mode simulates the host's LVM, libvirt and MinIO
+	devMode := len(os.Args) > 1 && os.Args[1] == "--dev"
+	var devServer *minio.DirectoryServer
+	if devMode {
+		var err error
+		devServer, err = setUpDevMode(getEnvDefault("DEV_DIR", "./dev"))
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to set up development mode")
+		}
+	}
+
 	// Load configuration from environment
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -57,26 +104,6 @@ func main() {
 		host = "0.0.0.0"
 	}
 
-	dbPath := os.Getenv("DATABASE_PATH")
-	if dbPath == "" {
-		dbPath = "./provisioner.db"
-	}
-
-	// Initialize components
-	logrus.Info("Initializing MinIO client...")
-	minioClient, err := minio.NewClient()
-	if err != nil {
-		logrus.WithError(err).Fatal("Failed to initialize MinIO client")
-	}
-	logrus.Info("MinIO client initialized successfully")
-
-	logrus.Info("Initializing LVM manager...")
-	lvmManager, err := lvm.NewManager("data")
-	if err != nil {
-		logrus.WithError(err).Fatal("Failed to initialize LVM manager")
-	}
-	logrus.Info("LVM manager initialized successfully")
-
 	logrus.Info("Initializing authentication validator...")
 	authValidator, err := auth.NewValidator()
 	if err != nil {
@@ -84,21 +111,47 @@ func main() {
 	}
 	logrus.Info("Authentication validator initialized successfully")
 
-	logrus.Info("Initializing storage...")
-	store, err := storage.NewStore(dbPath)
+	// Confine clients to the volumes of their tenant on shared hypervisors, including
+	// the NATS intake and the CSI driver
+	tenants, err := auth.ParseTenants(os.Getenv("TENANT_PREFIXES"), os.Getenv("TENANT_FROM_CERTIFICATE") == "true")
 	if err != nil {
-		logrus.WithError(err).Fatal("Failed to initialize storage")
+		logrus.WithError(err).Fatal("Invalid TENANT_PREFIXES")
 	}
-	logrus.Info("Storage initialized successfully")
 
-	logrus.Info("Initializing libvirt pool manager...")
-	libvirtPool, err := libvirt.NewPoolManager("images")
-	if err != nil {
-		logrus.WithError(err).Fatal("Failed to initialize libvirt pool manager")
+	eventEmitter := newEventEmitter()
+
+	var jobManager api.JobManager
+	var csiDriver *csi.Driver
+	var refreshScheduler *refresh.Scheduler
+	if os.Getenv("FLEET_MODE") == "coordinator" {
+		jobManager = newFleetCoordinator()
+		recordBuildInfo(nil)
+	} else {
+		localManager, driver := newLocalJobManager(eventEmitter, tenants, devMode)
+		jobManager, csiDriver = localManager, driver
+		refreshScheduler = newRefreshScheduler(localManager)
 	}
-	logrus.Info("Libvirt pool manager initialized successfully")
 
-	jobManager := jobs.NewManager(minioClient, lvmManager, libvirtPool, store)
+	// Optionally accept provisioning requests from NATS
+	var natsConsumer *intake.Consumer
+	if natsURL := os.Getenv("NATS_URL"); natsURL != "" {
+		logrus.Info("Initializing NATS consumer...")
+		config := intake.Config{
+			URL:           natsURL,
+			Subject:       getEnvDefault("NATS_SUBJECT", "provisioner.requests"),
+			QueueGroup:    os.Getenv("NATS_QUEUE_GROUP"),
+			StatusSubject: getEnvDefault("NATS_STATUS_SUBJECT", "provisioner.status"),
+			CredsFile:     os.Getenv("NATS_CREDS"),
+		}
+		if tenants.Enabled() {
+			config.Tenants = tenants
+		}
+		natsConsumer, err = intake.NewConsumer(config, jobManager)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to initialize NATS consumer")
+		}
+		logrus.Info("NATS consumer initialized successfully")
+	}
 
 	// Initialize Gin router
 	router := gin.New()
@@ -108,26 +161,41 @@ func main() {
 
 	// Initialize API handlers
 	apiHandler := api.NewHandler(jobManager, version)
+	apiHandler.SetVersionInfo(newVersionInfo())
+	if sunset := os.Getenv("API_V1_SUNSET"); sunset != "" {
+		sunsetDate, err := time.Parse(time.DateOnly, sunset)
+		if err != nil {
+			logrus.WithError(err).Fatal("Invalid API_V1_SUNSET, expected YYYY-MM-DD")
+		}
+		apiHandler.SetV1Sunset(sunsetDate)
+	}
+	if tenants.Enabled() {
+		apiHandler.SetTenants(tenants)
+		logrus.Info("Volume names are confined to tenant prefixes")
+	}
 
 	// Setup routes (includes auth middleware for API routes only)
 	api.SetupRoutes(router, apiHandler, authValidator.Middleware())
 
+	// Serve the admin UI; its API calls are authenticated like any other client's
+	if os.Getenv("ADMIN_UI_ENABLED") != "false" {
+		ui.Register(router)
+	}
+
 	// Add authentication middleware to all remaining routes
 	router.Use(authValidator.Middleware())
 
-	// Create HTTP server
-	var srv *http.Server
-	if !authValidator.IsClientCALoaded() {
-		// Run HTTP server for development when no client CA is configured
-		srv = &http.Server{
-			Addr:              fmt.Sprintf("%s:%s", host, port),
-			Handler:           router,
-			ReadTimeout:       15 * time.Second,
-			ReadHeaderTimeout: 15 * time.Second,
-			WriteTimeout:      15 * time.Second,
-			IdleTimeout:       60 * time.Second,
-		}
-	} else {
+	// Create HTTP server. A timeout of 0 disables it, e.g. the write timeout for
+	// deployments streaming large responses.
+	srv := &http.Server{
+		Addr:              fmt.Sprintf("%s:%s", host, port),
+		Handler:           router,
+		ReadTimeout:       envSeconds("HTTP_READ_TIMEOUT_SECONDS", 15),
+		ReadHeaderTimeout: envSeconds("HTTP_READ_HEADER_TIMEOUT_SECONDS", 15),
+		WriteTimeout:      envSeconds("HTTP_WRITE_TIMEOUT_SECONDS", 15),
+		IdleTimeout:       envSeconds("HTTP_IDLE_TIMEOUT_SECONDS", 60),
+	}
+	if authValidator.IsClientCALoaded() {
 		// Load server certificate and key
 		serverCertPath := os.Getenv("SERVER_CERT")
 		if serverCertPath == "" {
@@ -144,54 +212,98 @@ func main() {
 		}
 
 		// Run HTTPS server when client CA is configured
-		srv = &http.Server{
-			Addr:              fmt.Sprintf("%s:%s", host, port),
-			Handler:           router,
-			ReadTimeout:       15 * time.Second,
-			ReadHeaderTimeout: 15 * time.Second,
-			WriteTimeout:      15 * time.Second,
-			IdleTimeout:       60 * time.Second,
-			TLSConfig: &tls.Config{
-				Certificates: []tls.Certificate{cert},
-				ClientAuth:   tls.VerifyClientCertIfGiven, // Optional client certs
-				ClientCAs:    authValidator.GetClientCAs(),
-				MinVersion:   tls.VersionTLS12,
-			},
-		}
-	}
-
-	// Start server in a goroutine
-	go func() {
-		if !authValidator.IsClientCALoaded() {
-			logrus.WithFields(logrus.Fields{
-				"host": host,
-				"port": port,
-				"mode": "development (HTTP - no client CA)",
-			}).Info("Starting libvirt-volume-provisioner server")
-			// Run HTTP server for development
-			err := srv.ListenAndServe()
-			if err != nil && err != http.ErrServerClosed {
-				logrus.WithError(err).Fatal("Failed to start HTTP server")
+		srv.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientAuth:   tls.VerifyClientCertIfGiven, // Optional client certs
+			ClientCAs:    authValidator.GetClientCAs(),
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	// The API may be served on a local Unix socket in addition to or instead of TCP
+	tcpEnabled := os.Getenv("TCP_ENABLED") != "false"
+	unixSocket := os.Getenv("UNIX_SOCKET")
+	if !tcpEnabled && unixSocket == "" {
+		logrus.Fatal("TCP_ENABLED=false requires UNIX_SOCKET")
+	}
+
+	if tcpEnabled {
+		// Listen on the socket passed by systemd socket activation, if any
+		listener, err := listen(srv.Addr)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to listen")
+		}
+
+		// Start server in a goroutine
+		go func() {
+			if !authValidator.IsClientCALoaded() {
+				logrus.WithFields(logrus.Fields{
+					"address": listener.Addr().String(),
+					"mode":    "development (HTTP - no client CA)",
+				}).Info("Starting libvirt-volume-provisioner server")
+				// Run HTTP server for development
+				err := srv.Serve(listener)
+				if err != nil && err != http.ErrServerClosed {
+					logrus.WithError(err).Fatal("Failed to start HTTP server")
+				}
+			} else {
+				logrus.WithFields(logrus.Fields{
+					"address": listener.Addr().String(),
+					"mode":    "production (HTTPS - client CA configured)",
+				}).Info("Starting libvirt-volume-provisioner server")
+				// Run HTTPS server
+				err := srv.ServeTLS(listener, "", "")
+				if err != nil && err != http.ErrServerClosed {
+					logrus.WithError(err).Fatal("Failed to start HTTPS server")
+				}
 			}
-		} else {
+		}()
+	}
+
+	// Serve host-local tooling on a Unix socket, authenticated by its file permissions
+	var unixSrv *http.Server
+	if unixSocket != "" {
+		mode, err := strconv.ParseUint(getEnvDefault("UNIX_SOCKET_MODE", "0660"), 8, 32)
+		if err != nil || mode > 0o777 {
+			logrus.WithField("value", os.Getenv("UNIX_SOCKET_MODE")).Fatal("Invalid UNIX_SOCKET_MODE")
+		}
+		unixListener, err := listenUnix(unixSocket, os.FileMode(mode), os.Getenv("UNIX_SOCKET_GROUP"))
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to listen on Unix socket")
+		}
+		unixSrv = &http.Server{
+			Handler:           router,
+			ConnContext:       auth.LocalConnContext,
+			ReadTimeout:       srv.ReadTimeout,
+			ReadHeaderTimeout: srv.ReadHeaderTimeout,
+			WriteTimeout:      srv.WriteTimeout,
+			IdleTimeout:       srv.IdleTimeout,
+		}
+		go func() {
 			logrus.WithFields(logrus.Fields{
-				"host": host,
-				"port": port,
-				"mode": "production (HTTPS - client CA configured)",
-			}).Info("Starting libvirt-volume-provisioner server")
-			// Run HTTPS server
-			err := srv.ListenAndServeTLS("", "")
+				"socket": unixSocket,
+				"mode":   fmt.Sprintf("%#o", mode),
+			}).Info("Starting libvirt-volume-provisioner server on Unix socket")
+			err := unixSrv.Serve(unixListener)
 			if err != nil && err != http.ErrServerClosed {
-				logrus.WithError(err).Fatal("Failed to start HTTPS server")
+				logrus.WithError(err).Fatal("Failed to start Unix socket server")
 			}
-		}
-	}()
+		}()
+	}
+
+	// Tell systemd the provisioner is ready once it is listening
+	stopNotify := make(chan struct{})
+	notifySystemd(jobManager, stopNotify)
 
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logrus.Info("Shutting down server...")
+	close(stopNotify)
+	if _, err := systemd.Notify("STOPPING=1\nSTATUS=Shutting down"); err != nil {
+		logrus.WithError(err).Warn("Failed to notify systemd")
+	}
 
 	// Give outstanding requests 30 seconds to complete
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -200,6 +312,556 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		logrus.WithError(err).Fatal("Server forced to shutdown")
 	}
+	if unixSrv != nil {
+		if err := unixSrv.Shutdown(ctx); err != nil {
+			logrus.WithError(err).Fatal("Unix socket server forced to shutdown")
+		}
+	}
+
+	if csiDriver != nil {
+		csiDriver.Stop()
+	}
+
+	if natsConsumer != nil {
+		natsConsumer.Close()
+	}
+
+	if refreshScheduler != nil {
+		refreshScheduler.Stop()
+	}
+
+	if eventEmitter != nil {
+		eventEmitter.Close()
+	}
+
+	if devServer != nil {
+		_ = devServer.Close()
+	}
 
 	logrus.Info("Server exited gracefully")
 }
+
+// getEnvDefault returns the value of an environment variable, or def if it is unset
+func getEnvDefault(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// envSeconds returns an environment variable holding a number of seconds as a
+// duration, or def seconds if it is unset
+func envSeconds(key string, def int) time.Duration {
+	seconds, err := strconv.Atoi(getEnvDefault(key, strconv.Itoa(def)))
+	if err != nil || seconds < 0 {
+		logrus.WithField("value", os.Getenv(key)).Fatalf("Invalid %s", key)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// newEventEmitter creates an emitter for the lifecycle event sinks in EVENT_SINKS and
+// the repeated failure alerts, or returns nil if neither is configured
+func newEventEmitter() *events.Emitter {
+	sinkNames, err := events.ParseSinks(os.Getenv("EVENT_SINKS"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to parse event sinks")
+	}
+
+	var sinks []events.Sink
+	if notifier := newAlertNotifier(); notifier != nil {
+		sinks = append(sinks, notifier)
+	}
+	if len(sinkNames) == 0 {
+		if len(sinks) == 0 {
+			return nil
+		}
+		return events.NewEmitter(sinks...)
+	}
+
+	logrus.Info("Initializing event sinks...")
+	for _, name := range sinkNames {
+		var sink events.Sink
+		switch name {
+		case "nats":
+			sink, err = events.NewNATSSink(
+				getEnvDefault("EVENT_NATS_URL", os.Getenv("NATS_URL")),
+				getEnvDefault("EVENT_NATS_SUBJECT", "provisioner.events"),
+				os.Getenv("NATS_CREDS"),
+			)
+		case "webhook":
+			sink, err = events.NewWebhookSink(splitList(os.Getenv("EVENT_WEBHOOK_URLS")))
+		case "journald":
+			sink, err = events.NewJournaldSink()
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("sink", name).Fatal("Failed to initialize event sink")
+		}
+		sinks = append(sinks, sink)
+	}
+	logrus.WithField("sinks", sinkNames).Info("Event sinks initialized successfully")
+
+	return events.NewEmitter(sinks...)
+}
+
+// newAlertNotifier creates the repeated failure notifier if ALERT_FAILURE_THRESHOLD is set
+func newAlertNotifier() *alerts.Notifier {
+	thresholdStr := os.Getenv("ALERT_FAILURE_THRESHOLD")
+	if thresholdStr == "" {
+		return nil
+	}
+
+	threshold, err := strconv.Atoi(thresholdStr)
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid ALERT_FAILURE_THRESHOLD")
+	}
+	windowMinutes, err := strconv.Atoi(getEnvDefault("ALERT_FAILURE_WINDOW_MINUTES", "15"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid ALERT_FAILURE_WINDOW_MINUTES")
+	}
+
+	notifier, err := alerts.NewNotifier(alerts.Config{
+		Threshold:       threshold,
+		Window:          time.Duration(windowMinutes) * time.Minute,
+		WebhookURLs:     splitList(os.Getenv("ALERT_WEBHOOK_URLS")),
+		AlertmanagerURL: os.Getenv("ALERT_ALERTMANAGER_URL"),
+	})
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize failure alerts")
+	}
+	logrus.WithFields(logrus.Fields{
+		"threshold":      threshold,
+		"window_minutes": windowMinutes,
+	}).Info("Repeated failure alerts enabled")
+	return notifier
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newLocalJobManager initializes the components that provision volumes on this host,
+// and the CSI driver if CSI_ENDPOINT is set
+func newLocalJobManager(eventEmitter *events.Emitter, tenants *auth.Tenants,
+	devMode bool) (*jobs.Manager, *csi.Driver) {
+	dbPath := os.Getenv("DATABASE_PATH")
+	if dbPath == "" {
+		dbPath = "./provisioner.db"
+	}
+
+	cachePools := os.Getenv("LIBVIRT_CACHE_POOLS")
+	if cachePools == "" {
+		cachePools = "images"
+	}
+
+	cacheDir := os.Getenv("LIBVIRT_CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = cache.DefaultCacheDir
+	}
+
+	// "true" requires libvirt, "false" disables it, "auto" falls back to a filesystem cache
+	libvirtMode := os.Getenv("LIBVIRT_ENABLED")
+	if libvirtMode == "" {
+		libvirtMode = "auto"
+	}
+
+	logrus.Info("Initializing MinIO client...")
+	minioClient, err := minio.NewClient()
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize MinIO client")
+	}
+	logrus.Info("MinIO client initialized successfully")
+
+	logrus.Info("Initializing LVM manager...")
+	lvmManager := newLVMManager()
+	blockSizeKB, err := strconv.Atoi(getEnvDefault("RAW_COPY_BLOCK_SIZE_KB", "4096"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid RAW_COPY_BLOCK_SIZE_KB")
+	}
+	if err := lvmManager.SetCopyOptions(lvm.CopyOptions{
+		BlockSize: blockSizeKB * 1024,
+		Direct:    os.Getenv("RAW_COPY_DIRECT") != "false",
+		Sparse:    os.Getenv("RAW_COPY_SPARSE") != "false",
+	}); err != nil {
+		logrus.WithError(err).Fatal("Invalid RAW_COPY_BLOCK_SIZE_KB")
+	}
+	if err := lvmManager.SetVolumeFormat(getEnvDefault("VOLUME_FORMAT", lvm.FormatRaw)); err != nil {
+		logrus.WithError(err).Fatal("Invalid VOLUME_FORMAT")
+	}
+	softQuota, err := strconv.ParseFloat(getEnvDefault("LVM_QUOTA_SOFT_PERCENT", "0"), 64)
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid LVM_QUOTA_SOFT_PERCENT")
+	}
+	hardQuota, err := strconv.ParseFloat(getEnvDefault("LVM_QUOTA_HARD_PERCENT", "0"), 64)
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid LVM_QUOTA_HARD_PERCENT")
+	}
+	if err := lvmManager.SetQuota(lvm.Quota{SoftPercent: softQuota, HardPercent: hardQuota}); err != nil {
+		logrus.WithError(err).Fatal("Invalid volume group quota")
+	}
+	// On SAN storage, refuse to write through multipath devices that have lost paths
+	minPaths, err := strconv.Atoi(getEnvDefault("MULTIPATH_MIN_PATHS", "0"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid MULTIPATH_MIN_PATHS")
+	}
+	if err := lvmManager.SetMultipathCheck(lvm.MultipathCheck{
+		MinPaths:            minPaths,
+		RefuseQueueIfNoPath: os.Getenv("MULTIPATH_REFUSE_QUEUE_IF_NO_PATH") == "true",
+	}); err != nil {
+		logrus.WithError(err).Fatal("Invalid multipath check")
+	}
+	prometheus.MustRegister(lvm.NewCollector(lvmManager))
+	recordBuildInfo(lvmManager)
+	logrus.Info("LVM manager initialized successfully")
+
+	logrus.Info("Initializing storage...")
+	store, err := storage.NewStore(dbPath)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize storage")
+	}
+	logrus.Info("Storage initialized successfully")
+
+	logrus.Info("Initializing image cache...")
+	imageCache, err := newImageCache(libvirtMode, cachePools, cacheDir)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize image cache")
+	}
+	minFreeMB, err := strconv.ParseUint(getEnvDefault("CACHE_MIN_FREE_MB", "1024"), 10, 64)
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid CACHE_MIN_FREE_MB")
+	}
+	imageCache.SetMinFreeBytes(minFreeMB * 1024 * 1024)
+	minioClient.SetAllowedDirs(imageCache.PoolPaths()...)
+
+	// Stage downloads on the default cache pool's filesystem rather than the small root filesystem
+	stagingDir := getEnvDefault("DOWNLOAD_STAGING_DIR", imageCache.Pools()[0].Path)
+	if err := minioClient.SetStagingDir(stagingDir, minFreeMB*1024*1024); err != nil {
+		logrus.WithError(err).Fatal("Invalid DOWNLOAD_STAGING_DIR")
+	}
+	logrus.Info("Image cache initialized successfully")
+
+	jobManager := jobs.NewManager(minioClient, lvmManager, imageCache, store)
+	jobManager.SetVersion(version)
+	// Refuse jobs up front on a host missing a tool, volume group or writable cache
+	selfTestTimeout := envSeconds("SELFTEST_TIMEOUT_SECONDS", int(selftest.DefaultTimeout/time.Second))
+	jobManager.SetSelfTestReport(runSelfTest(lvmManager, minioClient, imageCache, selfTestTimeout, devMode))
+	// With libvirt, volumes used by domains are not overwritten or deleted
+	if domains, ok := imageCache.(jobs.DomainLister); ok {
+		jobManager.SetDomainLister(domains)
+	}
+	if overlayDir := os.Getenv("OVERLAY_DIR"); overlayDir != "" {
+		overlays, err := overlay.NewManager(overlayDir)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to initialize overlay directory")
+		}
+		jobManager.SetOverlayManager(overlays)
+	}
+	// Leave a document identifying the source of each volume, should the database be lost
+	if err := jobManager.SetResultTarget(os.Getenv("RESULT_DOCUMENT")); err != nil {
+		logrus.WithError(err).Fatal("Invalid RESULT_DOCUMENT")
+	}
+	// Write a manifest of each completed job to MinIO for pull-based reporting
+	if manifestURL := os.Getenv("JOB_MANIFEST_URL"); manifestURL != "" {
+		host := os.Getenv("JOB_MANIFEST_HOST")
+		if host == "" {
+			if host, err = os.Hostname(); err != nil {
+				logrus.WithError(err).Fatal("Failed to determine JOB_MANIFEST_HOST")
+			}
+		}
+		if err := jobManager.SetJobManifests(minioClient, manifestURL, host); err != nil {
+			logrus.WithError(err).Fatal("Invalid JOB_MANIFEST_URL or JOB_MANIFEST_HOST")
+		}
+	}
+	// Refuse images built for another CPU architecture than the host's, unless requests name one
+	if os.Getenv("ENFORCE_HOST_ARCHITECTURE") == "true" {
+		jobManager.SetDefaultArchitecture(jobs.HostArchitecture())
+	}
+	// Evict images past their expiry date from the cache, and refuse or warn about jobs for them
+	var imageExpiries map[string]time.Time
+	if expiryPath := os.Getenv("IMAGE_EXPIRY_CONFIG"); expiryPath != "" {
+		expiries, err := jobs.LoadImageExpiries(expiryPath)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to load image expiries")
+		}
+		imageExpiries = expiries
+	}
+	expiredPolicy := getEnvDefault("EXPIRED_IMAGE_POLICY", jobs.ExpiredImageWarn)
+	if err := jobManager.SetImageExpiry(imageExpiries, expiredPolicy); err != nil {
+		logrus.WithField("value", expiredPolicy).Fatal("Invalid EXPIRED_IMAGE_POLICY")
+	}
+	go jobManager.MonitorImageExpiry(context.Background())
+	failureTTL, err := strconv.Atoi(getEnvDefault("IMAGE_FAILURE_TTL_SECONDS", "300"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid IMAGE_FAILURE_TTL_SECONDS")
+	}
+	jobManager.SetFailureTTL(time.Duration(failureTTL) * time.Second)
+
+	downloadConcurrency, err := strconv.Atoi(getEnvDefault("DOWNLOAD_CONCURRENCY", "2"))
+	if err != nil || downloadConcurrency < 1 {
+		logrus.WithField("value", os.Getenv("DOWNLOAD_CONCURRENCY")).Fatal("Invalid DOWNLOAD_CONCURRENCY")
+	}
+	diskConcurrency, err := strconv.Atoi(getEnvDefault("DISK_CONCURRENCY", "2"))
+	if err != nil || diskConcurrency < 1 {
+		logrus.WithField("value", os.Getenv("DISK_CONCURRENCY")).Fatal("Invalid DISK_CONCURRENCY")
+	}
+	jobManager.SetConcurrency(downloadConcurrency, diskConcurrency)
+	// Refuse jobs with 429 while too many wait to start, so clients can submit elsewhere
+	maxQueueDepth, err := strconv.Atoi(getEnvDefault("MAX_QUEUE_DEPTH", "0"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid MAX_QUEUE_DEPTH")
+	}
+	if err := jobManager.SetMaxQueueDepth(maxQueueDepth); err != nil {
+		logrus.WithError(err).Fatal("Invalid MAX_QUEUE_DEPTH")
+	}
+	// Settings changed through the admin API take precedence until reset
+	if err := jobManager.RestoreSettings(); err != nil {
+		logrus.WithError(err).Fatal("Failed to restore runtime settings")
+	}
+	compressionBudget, err := strconv.Atoi(getEnvDefault("COMPRESSION_CPU_BUDGET", "2"))
+	if err != nil || compressionBudget < 1 {
+		logrus.WithField("value", os.Getenv("COMPRESSION_CPU_BUDGET")).Fatal("Invalid COMPRESSION_CPU_BUDGET")
+	}
+	jobManager.SetCompressionBudget(compressionBudget)
+
+	// Report, or fail, running jobs that stop making progress
+	stuckMinutes, err := strconv.Atoi(getEnvDefault("STUCK_JOB_MINUTES", "0"))
+	if err != nil || stuckMinutes < 0 {
+		logrus.WithField("value", os.Getenv("STUCK_JOB_MINUTES")).Fatal("Invalid STUCK_JOB_MINUTES")
+	}
+	stuckAction := getEnvDefault("STUCK_JOB_ACTION", "report")
+	if stuckAction != "report" && stuckAction != "fail" {
+		logrus.WithField("value", stuckAction).Fatal("Invalid STUCK_JOB_ACTION")
+	}
+	jobManager.SetStuckJobDetection(time.Duration(stuckMinutes)*time.Minute, stuckAction == "fail")
+	go jobManager.MonitorStuckJobs(context.Background())
+
+	// Degrade health, then fail readiness, as the cache and database disks fill up
+	diskDegraded, err := strconv.Atoi(getEnvDefault("DISK_DEGRADED_PERCENT", "90"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid DISK_DEGRADED_PERCENT")
+	}
+	diskNotReady, err := strconv.Atoi(getEnvDefault("DISK_NOT_READY_PERCENT", "95"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid DISK_NOT_READY_PERCENT")
+	}
+	if err := jobManager.SetDiskThresholds(diskDegraded, diskNotReady); err != nil {
+		logrus.WithError(err).Fatal("Invalid disk usage thresholds")
+	}
+
+	// Delete the volumes of failed jobs whose rollback failed again in the background
+	jobManager.SetCleanupRetryInterval(envSeconds("CLEANUP_RETRY_SECONDS", 30))
+	go jobManager.RunCleanups(context.Background())
+
+	// Measure completed jobs against provisioning duration targets by image size
+	if sloPath := os.Getenv("SLO_CONFIG"); sloPath != "" {
+		sloConfig, err := jobs.LoadSLOConfig(sloPath)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to load SLO configuration")
+		}
+		if err := jobManager.SetSLO(sloConfig); err != nil {
+			logrus.WithError(err).Fatal("Invalid SLO configuration")
+		}
+		prometheus.MustRegister(jobs.NewSLOCollector(jobManager))
+		logrus.WithField("targets", len(sloConfig.Targets)).Info("Provisioning SLO targets loaded")
+	}
+
+	// Count finished jobs by the values of some of their labels
+	if err := jobManager.SetMetricLabels(splitList(os.Getenv("JOB_METRIC_LABELS"))); err != nil {
+		logrus.WithError(err).Fatal("Invalid JOB_METRIC_LABELS")
+	}
+
+	// Keep provisioning out of business hours if windows are configured
+	if spec := os.Getenv("PROVISIONING_WINDOWS"); spec != "" {
+		windows, err := schedule.Parse(spec)
+		if err != nil {
+			logrus.WithError(err).Fatal("Invalid PROVISIONING_WINDOWS")
+		}
+		jobManager.SetWindows(windows)
+		logrus.WithField("windows", windows.String()).Info("Provisioning restricted to time windows")
+	}
+
+	// Evict cached images when they are replaced or deleted in MinIO
+	for _, bucket := range splitList(os.Getenv("MINIO_WATCH_BUCKETS")) {
+		go minioClient.WatchObjectChanges(context.Background(), bucket, func(change minio.ObjectChange) {
+			evicted, err := jobManager.InvalidateObject(change.Bucket, change.Object)
+			fields := logrus.Fields{"bucket": change.Bucket, "object": change.Object, "event": change.Event}
+			if err != nil {
+				logrus.WithError(err).WithFields(fields).Warn("Failed to invalidate cached image")
+			} else if evicted > 0 {
+				logrus.WithFields(fields).WithField("evicted", evicted).Info("Invalidated cached image")
+			}
+		})
+		logrus.WithField("bucket", bucket).Info("Watching MinIO bucket for image changes")
+	}
+	if eventEmitter != nil {
+		jobManager.SetEventEmitter(eventEmitter)
+	}
+
+	if policiesPath := os.Getenv("RETRY_POLICIES"); policiesPath != "" {
+		policies, err := retry.LoadPolicies(policiesPath)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to load retry policies")
+		}
+		for stage, policy := range policies {
+			if stage == retry.StageDownload {
+				minioClient.SetRetryPolicy(policy)
+			} else if err := lvmManager.SetRetryPolicy(stage, policy); err != nil {
+				logrus.WithError(err).Fatal("Failed to apply retry policies")
+			}
+		}
+		logrus.WithField("stages", len(policies)).Info("Retry policies loaded")
+	}
+
+	if profilesPath := os.Getenv("PROVISIONING_PROFILES"); profilesPath != "" {
+		provisioningProfiles, err := profiles.Load(profilesPath)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to load provisioning profiles")
+		}
+		jobManager.SetProfiles(provisioningProfiles)
+		logrus.WithField("profiles", provisioningProfiles.Names()).Info("Provisioning profiles loaded")
+	}
+
+	if netboxURL := os.Getenv("NETBOX_URL"); netboxURL != "" {
+		logrus.Info("Initializing NetBox client...")
+		netboxClient, err := netbox.NewClient(netboxURL, os.Getenv("NETBOX_TOKEN"))
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to initialize NetBox client")
+		}
+		jobManager.SetNetBoxClient(netboxClient, os.Getenv("NETBOX_WRITEBACK") == "true")
+		logrus.Info("NetBox client initialized successfully")
+	}
+
+	// Fail jobs interrupted by a restart and clean up after them before any new job starts
+	jobManager.SetKeepIncompleteVolumes(os.Getenv("KEEP_INCOMPLETE_VOLUMES") == "true")
+	if err := jobManager.RecoverJobs(); err != nil {
+		logrus.WithError(err).Fatal("Failed to recover jobs")
+	}
+
+	// Optionally serve the CSI controller and node plugin alongside the REST API
+	var csiDriver *csi.Driver
+	if csiEndpoint := os.Getenv("CSI_ENDPOINT"); csiEndpoint != "" {
+		nodeID := os.Getenv("CSI_NODE_ID")
+		if nodeID == "" {
+			nodeID, err = os.Hostname()
+			if err != nil {
+				logrus.WithError(err).Fatal("Failed to determine CSI node ID")
+			}
+		}
+
+		csiDriver, err = csi.NewDriver(os.Getenv("CSI_DRIVER_NAME"), version, nodeID, jobManager, lvmManager)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to initialize CSI driver")
+		}
+		if eventEmitter != nil {
+			csiDriver.SetEventEmitter(eventEmitter)
+		}
+		if tenants.Enabled() {
+			csiDriver.SetTenants(tenants)
+		}
+
+		go func() {
+			if err := csiDriver.Run(csiEndpoint); err != nil {
+				logrus.WithError(err).Fatal("Failed to start CSI driver")
+			}
+		}()
+	}
+
+	return jobManager, csiDriver
+}
+
+// newLVMManager initializes the LVM manager with the backend in LVM_BACKEND
+func newLVMManager() *lvm.Manager {
+	backend := getEnvDefault("LVM_BACKEND", "exec")
+	if backend == "file" {
+		sizeGB, err := strconv.Atoi(getEnvDefault("LVM_FILE_SIZE_GB", "100"))
+		if err != nil || sizeGB < 1 {
+			logrus.WithField("value", os.Getenv("LVM_FILE_SIZE_GB")).Fatal("Invalid LVM_FILE_SIZE_GB")
+		}
+		lvmManager, err := lvm.NewFileManager("data", getEnvDefault("LVM_FILE_DIR", "./volumes"), int64(sizeGB)<<30)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to initialize file-backed volumes")
+		}
+		logrus.Warn("Keeping volumes as files instead of in an LVM volume group, for development only")
+		return lvmManager
+	}
+
+	lvmManager, err := lvm.NewManager("data")
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize LVM manager")
+	}
+	if wrapper := os.Getenv("PRIVILEGE_WRAPPER"); wrapper != "" {
+		logrus.WithField("wrapper", wrapper).Info("Running privileged commands through a wrapper")
+	}
+	switch backend {
+	case "exec":
+	case "dbus":
+		if err := lvmManager.EnableDBus(); err != nil {
+			logrus.WithError(err).Fatal("Failed to connect to the LVM D-Bus API")
+		}
+		logrus.Info("Managing volumes through the LVM D-Bus API")
+	default:
+		logrus.WithField("value", backend).Fatal("Invalid LVM_BACKEND")
+	}
+	return lvmManager
+}
+
+// newRefreshScheduler starts the image refresh schedules in IMAGE_REFRESH_CONFIG,
+// or returns nil if none are configured
+func newRefreshScheduler(jobManager *jobs.Manager) *refresh.Scheduler {
+	configPath := os.Getenv("IMAGE_REFRESH_CONFIG")
+	if configPath == "" {
+		return nil
+	}
+
+	logrus.Info("Initializing image refresh scheduler...")
+	schedules, err := refresh.LoadSchedules(configPath)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load image refresh schedules")
+	}
+
+	scheduler, err := refresh.NewScheduler(schedules, jobManager)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize image refresh scheduler")
+	}
+	scheduler.Start()
+	logrus.WithField("schedules", len(schedules)).Info("Image refresh scheduler initialized successfully")
+
+	return scheduler
+}
+
+// newFleetCoordinator initializes a coordinator that forwards jobs to the peers in FLEET_PEERS
+func newFleetCoordinator() *fleet.Coordinator {
+	logrus.Info("Initializing fleet coordinator...")
+	peers, err := fleet.ParsePeers(os.Getenv("FLEET_PEERS"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to parse fleet peers")
+	}
+
+	var tlsConfig *tls.Config
+	if caCertPath := os.Getenv("FLEET_PEER_CA_CERT"); caCertPath != "" {
+		//nolint:gosec // File path is controlled by admin via environment variable
+		caCert, err := os.ReadFile(caCertPath)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to read fleet peer CA certificate")
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caCert) {
+			logrus.Fatal("Failed to parse fleet peer CA certificate")
+		}
+		tlsConfig = &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+	}
+
+	coordinator, err := fleet.NewCoordinator(peers, os.Getenv("FLEET_PEER_TOKEN"), tlsConfig)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize fleet coordinator")
+	}
+	logrus.WithField("peers", len(peers)).Info("Fleet coordinator initialized successfully")
+
+	return coordinator
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// reconcileUsage describes the reconcile command
+const reconcileUsage = `usage: libvirt-volume-provisioner reconcile [--json] <url>
+
+Reports the discrepancies between NetBox, libvirt domains and LVM found by the
+provisioner, or fleet coordinator, at <url>, such as http://localhost:8080: volumes
+whose size differs from NetBox, volumes no domain uses, and missing volumes. The API
+token is read from PROVISIONER_TOKEN. With --json, the full report is printed.
+Exits with status 1 if there are findings.`
+
+// reconcileTimeout bounds the reconciliation, which looks up each NetBox virtual machine
+const reconcileTimeout = 5 * time.Minute
+
+// reconcileCommand implements the reconcile command
+func reconcileCommand(args []string, token string, stdout io.Writer) error {
+	printJSON := len(args) == 2 && args[0] == "--json"
+	if printJSON {
+		args = args[1:]
+	}
+	if len(args) != 1 || !strings.HasPrefix(args[0], "http") {
+		return errors.New(reconcileUsage)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
+	report, err := fetchReconciliation(ctx, strings.TrimSuffix(args[0], "/"), token)
+	if err != nil {
+		return err
+	}
+
+	if printJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else if len(report.Findings) > 0 {
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "HOST\tKIND\tVOLUME\tDOMAIN\tMESSAGE")
+		for _, f := range report.Findings {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.Host, f.Kind, f.VolumeName, f.Domain, f.Message)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(report.Findings) > 0 {
+		return fmt.Errorf("%d findings in %d volumes", len(report.Findings), len(report.Volumes))
+	}
+	if !printJSON {
+		_, err = fmt.Fprintf(stdout, "No findings in %d volumes\n", len(report.Volumes))
+	}
+	return err
+}
+
+// fetchReconciliation requests a reconciliation report from the provisioner at baseURL
+func fetchReconciliation(ctx context.Context, baseURL, token string) (*types.ReconciliationReport, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/v2/reconciliation", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reconciliation request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp types.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && errResp.Message != "" {
+			return nil, fmt.Errorf("reconciliation failed: %s: %s", errResp.Error, errResp.Message)
+		}
+		return nil, fmt.Errorf("reconciliation failed with status %d", resp.StatusCode)
+	}
+
+	var report types.ReconciliationReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode reconciliation report: %w", err)
+	}
+	return &report, nil
+}
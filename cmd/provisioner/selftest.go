@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/minio"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/selftest"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// connectionChecker is implemented by image caches backed by a libvirt connection
+type connectionChecker interface {
+	CheckConnection(ctx context.Context) (string, error)
+}
+
+// runSelfTest probes the tools and services jobs depend on and logs the result of each check.
+// In development mode, jobs for raw images and blank volumes run without qemu-img.
+func runSelfTest(lvmManager *lvm.Manager, minioClient *minio.Client, imageCache imageCache,
+	timeout time.Duration, devMode bool) *types.SelfTestReport {
+	checks := []selftest.Check{
+		{Name: "privileges", Critical: true, Run: lvmManager.CheckPrivileges},
+		{Name: "qemu-img", Critical: !devMode, Run: lvmManager.CheckQemuImg},
+		{Name: "lvm", Critical: true, Run: lvmManager.CheckLVM},
+		{Name: "volume_group", Critical: true, Run: lvmManager.CheckVolumeGroup},
+	}
+	// Multipath paths are restored on their own, so they do not block readiness either
+	if lvmManager.MultipathChecked() {
+		checks = append(checks, selftest.Check{Name: "multipath", Run: lvmManager.CheckMultipathDevices})
+	}
+	for _, pool := range imageCache.Pools() {
+		checks = append(checks, selftest.Check{
+			Name:     "cache:" + pool.Name,
+			Critical: true,
+			Run:      func(context.Context) (string, error) { return cache.CheckWritable(pool.Path) },
+		})
+	}
+	// MinIO and libvirt are reconnected to when they come back, so they do not block readiness
+	checks = append(checks, selftest.Check{Name: "minio", Run: minioClient.Ping})
+	if libvirtCache, ok := imageCache.(connectionChecker); ok {
+		checks = append(checks, selftest.Check{Name: "libvirt", Run: libvirtCache.CheckConnection})
+	}
+
+	report := selftest.Run(context.Background(), checks, timeout)
+	for _, check := range report.Checks {
+		entry := logrus.WithFields(logrus.Fields{
+			"check":       check.Name,
+			"critical":    check.Critical,
+			"detail":      check.Detail,
+			"duration_ms": check.DurationMS,
+		})
+		switch {
+		case check.Passed:
+			entry.Info("Self-test check passed")
+		case check.Critical:
+			entry.WithField("error", check.Error).Error("Critical self-test check failed")
+		default:
+			entry.WithField("error", check.Error).Warn("Self-test check failed")
+		}
+	}
+	if !report.Ready {
+		logrus.Error("Self-test failed, the provisioner will not accept jobs until restarted with a working environment")
+	}
+	return report
+}
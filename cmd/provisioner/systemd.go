@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/api"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/systemd"
+	"github.com/sirupsen/logrus"
+)
+
+// systemdStatusInterval is how often the status shown by systemctl status is updated
+const systemdStatusInterval = 10 * time.Second
+
+// listen returns the socket passed by systemd socket activation, or listens on addr
+// if the provisioner was not socket-activated
+func listen(addr string) (net.Listener, error) {
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) == 0 {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		return listener, nil
+	}
+
+	// The API is served on a single socket
+	for _, extra := range listeners[1:] {
+		logrus.WithField("address", extra.Addr().String()).Warn("Ignoring extra socket passed by systemd")
+		_ = extra.Close()
+	}
+	logrus.WithField("address", listeners[0].Addr().String()).Info("Using socket passed by systemd")
+	return listeners[0], nil
+}
+
+// systemdStatus describes the state of the provisioner for systemctl status
+func systemdStatus(jobManager api.JobManager) string {
+	if tester, ok := jobManager.(api.SelfTester); ok {
+		if report := tester.SelfTestReport(); report != nil && !report.Ready {
+			return "Self-test failed, not accepting jobs"
+		}
+	}
+	if maintenance, err := jobManager.GetMaintenance(); err == nil && maintenance.Maintenance {
+		return fmt.Sprintf("Maintenance mode, %d active jobs draining", maintenance.ActiveJobs)
+	}
+	return fmt.Sprintf("Serving, %d active jobs", jobManager.GetActiveJobs())
+}
+
+// notifySystemd tells systemd the provisioner is ready, then keeps its status up to
+// date and, if the watchdog is enabled, pings it until stop is closed. A ping
+// reads the job manager's state, so a deadlocked manager stops the pings and
+// systemd restarts the provisioner.
+func notifySystemd(jobManager api.JobManager, stop <-chan struct{}) {
+	sent, err := systemd.Notify("READY=1\nSTATUS=" + systemdStatus(jobManager))
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to notify systemd")
+		return
+	}
+	if !sent {
+		return // Not started by systemd, or not as Type=notify
+	}
+
+	interval := systemdStatusInterval
+	watchdog, watchdogEnabled := systemd.WatchdogInterval()
+	if watchdogEnabled {
+		interval = min(interval, watchdog/2)
+		logrus.WithField("timeout", watchdog).Info("Systemd watchdog enabled")
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				state := "STATUS=" + systemdStatus(jobManager)
+				if watchdogEnabled {
+					state += "\nWATCHDOG=1"
+				}
+				if _, err := systemd.Notify(state); err != nil {
+					logrus.WithError(err).Warn("Failed to notify systemd")
+				}
+			}
+		}
+	}()
+}
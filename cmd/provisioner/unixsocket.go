@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// listenUnix listens on a Unix socket readable and writable as mode allows, owned
+// by group if it is set. A socket left behind by a previous run is replaced.
+func listenUnix(path string, mode os.FileMode, group string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	// Create the socket with its final permissions, so nobody else can connect
+	// before they are applied
+	oldMask := syscall.Umask(int(^mode.Perm() & fs.ModePerm))
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(oldMask)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+
+	if group != "" {
+		gid, err := lookupGroup(group)
+		if err == nil {
+			err = os.Chown(path, -1, gid)
+		}
+		if err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("failed to set group of %s: %w", path, err)
+		}
+	}
+	// The umask cannot grant permissions, only restrict them
+	if err := os.Chmod(path, mode.Perm()); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to set permissions of %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// lookupGroup returns the ID of a group given by name or number
+func lookupGroup(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, fmt.Errorf("unknown group %s: %w", group, err)
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return 0, fmt.Errorf("group %s has non-numeric ID %s: %w", group, g.Gid, err)
+	}
+	return gid, nil
+}
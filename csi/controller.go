@@ -0,0 +1,220 @@
+package csi
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// StorageClass parameters
+	paramImageURL  = "imageURL"
+	paramImageType = "imageType"
+	paramCachePool = "cachePool"
+
+	bytesPerGB = 1024 * 1024 * 1024
+)
+
+// volumeNamePattern matches names that are valid LVM logical volume names
+var volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.+][a-zA-Z0-9_.+-]{0,127}$`)
+
+// CreateVolume provisions an LVM volume from the image named in the StorageClass parameters.
+// Provisioning runs as a regular job; while it is in progress the call returns Aborted
+// so that the external-provisioner retries until the job has finished.
+func (d *Driver) CreateVolume(_ context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	name := req.GetName()
+	if !volumeNamePattern.MatchString(name) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid volume name '%s'", name)
+	}
+	if err := d.checkTenant(name); err != nil {
+		return nil, err
+	}
+	if err := validateCapabilities(req.GetVolumeCapabilities()); err != nil {
+		return nil, err
+	}
+
+	params := req.GetParameters()
+	imageURL := params[paramImageURL]
+	if imageURL == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "missing StorageClass parameter '%s'", paramImageURL)
+	}
+
+	sizeGB, err := volumeSizeGB(req.GetCapacityRange())
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if jobID, ok := d.pending[name]; ok {
+		jobStatus, err := d.jobManager.GetJobStatus(jobID)
+		if err != nil {
+			delete(d.pending, name)
+			return nil, status.Errorf(codes.Internal, "failed to get provisioning job status: %v", err)
+		}
+
+		switch jobStatus.Status {
+		case types.StatusCompleted:
+			delete(d.pending, name)
+		case types.StatusFailed:
+			delete(d.pending, name)
+			return nil, status.Errorf(codes.Internal, "provisioning job %s failed: %s", jobID, jobStatus.Error)
+		default:
+			return nil, status.Errorf(codes.Aborted, "volume %s is being provisioned by job %s", name, jobID)
+		}
+	} else if !d.volumeManager.VolumeExists(name) {
+		jobID, err := d.jobManager.StartJob(types.ProvisionRequest{
+			ImageURL:     imageURL,
+			VolumeName:   name,
+			VolumeSizeGB: sizeGB,
+			ImageType:    params[paramImageType],
+			CachePool:    params[paramCachePool],
+			Identity:     Identity,
+		})
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to start provisioning job: %v", err)
+		}
+		d.pending[name] = jobID
+
+		logrus.WithFields(logrus.Fields{
+			"volume": name,
+			"job_id": jobID,
+		}).Info("Started CSI volume provisioning job")
+		return nil, status.Errorf(codes.Aborted, "volume %s is being provisioned by job %s", name, jobID)
+	}
+
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:           name,
+			CapacityBytes:      int64(sizeGB) * bytesPerGB,
+			VolumeContext:      map[string]string{paramImageURL: imageURL},
+			AccessibleTopology: d.topology(),
+		},
+	}, nil
+}
+
+// DeleteVolume removes an LVM volume; deleting a volume that does not exist succeeds
+func (d *Driver) DeleteVolume(_ context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+	name := req.GetVolumeId()
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume ID")
+	}
+	if err := d.checkTenant(name); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if jobID, ok := d.pending[name]; ok {
+		return nil, status.Errorf(codes.Aborted, "volume %s is being provisioned by job %s", name, jobID)
+	}
+
+	if !d.volumeManager.VolumeExists(name) {
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
+	if err := d.volumeManager.DeleteVolume(name); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete volume: %v", err)
+	}
+
+	logrus.WithField("volume", name).Info("Deleted CSI volume")
+	if d.events != nil {
+		d.events.Emit(events.Event{Type: events.VolumeDeleted, VolumeName: name})
+	}
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+// ValidateVolumeCapabilities confirms the capabilities supported for an existing volume
+func (d *Driver) ValidateVolumeCapabilities(
+	_ context.Context, req *csi.ValidateVolumeCapabilitiesRequest,
+) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+	name := req.GetVolumeId()
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume ID")
+	}
+	if !d.volumeManager.VolumeExists(name) {
+		return nil, status.Errorf(codes.NotFound, "volume %s does not exist", name)
+	}
+
+	if err := validateCapabilities(req.GetVolumeCapabilities()); err != nil {
+		//nolint:nilerr // Unsupported capabilities are reported as unconfirmed, not as an error
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
+	}
+
+	return &csi.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeCapabilities: req.GetVolumeCapabilities(),
+		},
+	}, nil
+}
+
+// ControllerGetCapabilities advertises volume creation and deletion
+func (d *Driver) ControllerGetCapabilities(
+	_ context.Context, _ *csi.ControllerGetCapabilitiesRequest,
+) (*csi.ControllerGetCapabilitiesResponse, error) {
+	return &csi.ControllerGetCapabilitiesResponse{
+		Capabilities: []*csi.ControllerServiceCapability{
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// validateCapabilities accepts single-node raw block access only
+func validateCapabilities(capabilities []*csi.VolumeCapability) error {
+	if len(capabilities) == 0 {
+		return status.Error(codes.InvalidArgument, "missing volume capabilities")
+	}
+
+	for _, capability := range capabilities {
+		if capability.GetBlock() == nil {
+			return status.Error(codes.InvalidArgument, "only block volume access is supported")
+		}
+
+		switch capability.GetAccessMode().GetMode() {
+		case csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER:
+		default:
+			return status.Errorf(codes.InvalidArgument, "unsupported access mode %s",
+				capability.GetAccessMode().GetMode())
+		}
+	}
+
+	return nil
+}
+
+// volumeSizeGB converts a CSI capacity range to a whole number of gigabytes
+func volumeSizeGB(capacityRange *csi.CapacityRange) (int, error) {
+	required := capacityRange.GetRequiredBytes()
+	limit := capacityRange.GetLimitBytes()
+	if required < 0 || limit < 0 {
+		return 0, status.Error(codes.InvalidArgument, "capacity must not be negative")
+	}
+
+	sizeGB := (required + bytesPerGB - 1) / bytesPerGB
+	if sizeGB < 1 {
+		sizeGB = 1
+	}
+
+	if limit > 0 && sizeGB*bytesPerGB > limit {
+		return 0, status.Errorf(codes.OutOfRange,
+			"capacity limit %d bytes is below the smallest volume size %d bytes", limit, sizeGB*bytesPerGB)
+	}
+
+	return int(sizeGB), nil
+}
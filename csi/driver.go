@@ -0,0 +1,187 @@
+// Package csi exposes the provisioner as a Kubernetes CSI controller and node plugin,
+// so that KubeVirt clusters running on the hypervisors can consume LVM volumes natively.
+package csi
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultDriverName is the CSI driver name registered with Kubernetes
+	DefaultDriverName = "lvp.csi.rossigee.github.io"
+
+	// topologyKey pins volumes to the hypervisor whose volume group holds them
+	topologyKey = "topology.lvp.csi.rossigee.github.io/node"
+
+	// Identity is the client identity of jobs submitted by the CSI driver, e.g. in TENANT_PREFIXES
+	Identity = "csi"
+)
+
+// JobManager is the subset of job operations used by the CSI controller
+type JobManager interface {
+	StartJob(req types.ProvisionRequest) (string, error)
+	GetJobStatus(jobID string) (*types.StatusResponse, error)
+}
+
+// VolumeManager is the subset of LVM operations used by the CSI plugin
+type VolumeManager interface {
+	VolumeExists(volumeName string) bool
+	DeleteVolume(volumeName string) error
+	DevicePath(volumeName string) string
+}
+
+// TenantChecker confines clients to the volumes of their tenant. It is implemented
+// by *auth.Tenants.
+type TenantChecker interface {
+	Check(identity, volumeName string) error
+}
+
+// EventEmitter receives volume lifecycle events. It is implemented by events.Emitter.
+type EventEmitter interface {
+	Emit(event events.Event)
+}
+
+// Driver implements the CSI identity, controller and node services
+type Driver struct {
+	csi.UnimplementedIdentityServer
+	csi.UnimplementedControllerServer
+	csi.UnimplementedNodeServer
+
+	name          string
+	version       string
+	nodeID        string
+	jobManager    JobManager
+	volumeManager VolumeManager
+	events        EventEmitter
+	tenants       TenantChecker
+
+	mu      sync.Mutex
+	pending map[string]string // volume name -> provisioning job ID
+	server  *grpc.Server
+}
+
+// NewDriver creates a new CSI driver backed by the job and volume managers
+func NewDriver(name, version, nodeID string, jobManager JobManager, volumeManager VolumeManager) (*Driver, error) {
+	if name == "" {
+		name = DefaultDriverName
+	}
+	if nodeID == "" {
+		return nil, fmt.Errorf("CSI node ID must not be empty")
+	}
+
+	return &Driver{
+		name:          name,
+		version:       version,
+		nodeID:        nodeID,
+		jobManager:    jobManager,
+		volumeManager: volumeManager,
+		pending:       make(map[string]string),
+	}, nil
+}
+
+// SetEventEmitter enables publishing of volume deletion events
+func (d *Driver) SetEventEmitter(emitter EventEmitter) {
+	d.events = emitter
+}
+
+// SetTenants confines the volumes the driver creates and deletes to the tenant of Identity
+func (d *Driver) SetTenants(tenants TenantChecker) {
+	d.tenants = tenants
+}
+
+// Run serves the CSI gRPC services on endpoint (e.g. unix:///csi/csi.sock) until Stop is called
+func (d *Driver) Run(endpoint string) error {
+	socketPath, err := parseEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+
+	// Remove a stale socket left behind by a previous run
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale CSI socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on CSI endpoint: %w", err)
+	}
+
+	d.mu.Lock()
+	d.server = grpc.NewServer()
+	server := d.server
+	d.mu.Unlock()
+
+	csi.RegisterIdentityServer(server, d)
+	csi.RegisterControllerServer(server, d)
+	csi.RegisterNodeServer(server, d)
+
+	logrus.WithFields(logrus.Fields{
+		"driver":   d.name,
+		"node_id":  d.nodeID,
+		"endpoint": endpoint,
+	}).Info("Starting CSI driver")
+
+	if err := server.Serve(listener); err != nil {
+		return fmt.Errorf("CSI server failed: %w", err)
+	}
+	return nil
+}
+
+// Stop gracefully stops the CSI gRPC server
+func (d *Driver) Stop() {
+	d.mu.Lock()
+	server := d.server
+	d.mu.Unlock()
+
+	if server != nil {
+		server.GracefulStop()
+	}
+}
+
+// checkTenant returns PermissionDenied if the driver may not use a volume
+func (d *Driver) checkTenant(name string) error {
+	if d.tenants == nil {
+		return nil
+	}
+	if err := d.tenants.Check(Identity, name); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+// parseEndpoint extracts the socket path from a unix:// CSI endpoint
+func parseEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid CSI endpoint '%s': %w", endpoint, err)
+	}
+	if u.Scheme != "unix" {
+		return "", fmt.Errorf("invalid CSI endpoint '%s': only unix sockets are supported", endpoint)
+	}
+
+	socketPath := u.Path
+	if u.Host != "" {
+		socketPath = u.Host + socketPath
+	}
+	if socketPath == "" {
+		return "", fmt.Errorf("invalid CSI endpoint '%s': missing socket path", endpoint)
+	}
+	return socketPath, nil
+}
+
+// topology returns the accessibility constraints for volumes on this node
+func (d *Driver) topology() []*csi.Topology {
+	return []*csi.Topology{{Segments: map[string]string{topologyKey: d.nodeID}}}
+}
@@ -0,0 +1,250 @@
+package csi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/auth"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeJobManager struct {
+	started []types.ProvisionRequest
+	status  types.JobStatus
+	err     string
+}
+
+func (f *fakeJobManager) StartJob(req types.ProvisionRequest) (string, error) {
+	f.started = append(f.started, req)
+	return fmt.Sprintf("job-%d", len(f.started)), nil
+}
+
+func (f *fakeJobManager) GetJobStatus(jobID string) (*types.StatusResponse, error) {
+	return &types.StatusResponse{JobID: jobID, Status: f.status, Error: f.err}, nil
+}
+
+type fakeVolumeManager struct {
+	volumes map[string]bool
+}
+
+func (f *fakeVolumeManager) VolumeExists(volumeName string) bool {
+	return f.volumes[volumeName]
+}
+
+func (f *fakeVolumeManager) DeleteVolume(volumeName string) error {
+	delete(f.volumes, volumeName)
+	return nil
+}
+
+func (f *fakeVolumeManager) DevicePath(volumeName string) string {
+	return "/dev/data/" + volumeName
+}
+
+func newTestDriver(t *testing.T) (*Driver, *fakeJobManager, *fakeVolumeManager) {
+	t.Helper()
+	jobManager := &fakeJobManager{status: types.StatusRunning}
+	volumeManager := &fakeVolumeManager{volumes: make(map[string]bool)}
+	driver, err := NewDriver("", "test", "hv1", jobManager, volumeManager)
+	require.NoError(t, err)
+	return driver, jobManager, volumeManager
+}
+
+func blockCapability() *csi.VolumeCapability {
+	return &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+}
+
+func createRequest(name string) *csi.CreateVolumeRequest {
+	return &csi.CreateVolumeRequest{
+		Name:               name,
+		CapacityRange:      &csi.CapacityRange{RequiredBytes: 10*bytesPerGB - 1},
+		VolumeCapabilities: []*csi.VolumeCapability{blockCapability()},
+		Parameters:         map[string]string{paramImageURL: "https://minio/images/ubuntu.qcow2", paramCachePool: "images"},
+	}
+}
+
+func TestNewDriver(t *testing.T) {
+	_, err := NewDriver("", "test", "", &fakeJobManager{}, &fakeVolumeManager{})
+	assert.Error(t, err)
+
+	driver, _, _ := newTestDriver(t)
+	assert.Equal(t, DefaultDriverName, driver.name)
+}
+
+func TestParseEndpoint(t *testing.T) {
+	path, err := parseEndpoint("unix:///csi/csi.sock")
+	require.NoError(t, err)
+	assert.Equal(t, "/csi/csi.sock", path)
+
+	_, err = parseEndpoint("tcp://127.0.0.1:10000")
+	assert.Error(t, err)
+
+	_, err = parseEndpoint("unix://")
+	assert.Error(t, err)
+}
+
+func TestCreateVolume(t *testing.T) {
+	driver, jobManager, volumeManager := newTestDriver(t)
+	ctx := context.Background()
+
+	// First call starts a job and asks the caller to retry
+	_, err := driver.CreateVolume(ctx, createRequest("pvc-1"))
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	require.Len(t, jobManager.started, 1)
+	assert.Equal(t, "pvc-1", jobManager.started[0].VolumeName)
+	assert.Equal(t, 10, jobManager.started[0].VolumeSizeGB)
+	assert.Equal(t, "images", jobManager.started[0].CachePool)
+
+	// Retries while the job is running do not start another job
+	_, err = driver.CreateVolume(ctx, createRequest("pvc-1"))
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Len(t, jobManager.started, 1)
+
+	// Once the job has completed the volume is returned
+	jobManager.status = types.StatusCompleted
+	volumeManager.volumes["pvc-1"] = true
+	resp, err := driver.CreateVolume(ctx, createRequest("pvc-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "pvc-1", resp.GetVolume().GetVolumeId())
+	assert.Equal(t, int64(10*bytesPerGB), resp.GetVolume().GetCapacityBytes())
+	assert.Equal(t, "hv1", resp.GetVolume().GetAccessibleTopology()[0].GetSegments()[topologyKey])
+
+	// Subsequent calls are idempotent
+	_, err = driver.CreateVolume(ctx, createRequest("pvc-1"))
+	require.NoError(t, err)
+	assert.Len(t, jobManager.started, 1)
+}
+
+func TestCreateVolume_JobFailed(t *testing.T) {
+	driver, jobManager, _ := newTestDriver(t)
+	ctx := context.Background()
+
+	_, err := driver.CreateVolume(ctx, createRequest("pvc-1"))
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	jobManager.status = types.StatusFailed
+	jobManager.err = "download failed"
+	_, err = driver.CreateVolume(ctx, createRequest("pvc-1"))
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, err.Error(), "download failed")
+
+	// A retry after failure starts a new job
+	_, err = driver.CreateVolume(ctx, createRequest("pvc-1"))
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Len(t, jobManager.started, 2)
+}
+
+func TestCreateVolume_InvalidArguments(t *testing.T) {
+	driver, _, _ := newTestDriver(t)
+	ctx := context.Background()
+
+	req := createRequest("../pvc")
+	_, err := driver.CreateVolume(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	req = createRequest("pvc-1")
+	delete(req.Parameters, paramImageURL)
+	_, err = driver.CreateVolume(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	req = createRequest("pvc-1")
+	req.VolumeCapabilities[0].AccessType = &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}
+	_, err = driver.CreateVolume(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	req = createRequest("pvc-1")
+	req.VolumeCapabilities[0].AccessMode.Mode = csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+	_, err = driver.CreateVolume(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	req = createRequest("pvc-1")
+	req.CapacityRange = &csi.CapacityRange{RequiredBytes: 100, LimitBytes: 200}
+	_, err = driver.CreateVolume(ctx, req)
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+}
+
+func TestDeleteVolume(t *testing.T) {
+	driver, _, volumeManager := newTestDriver(t)
+	ctx := context.Background()
+
+	volumeManager.volumes["pvc-1"] = true
+	_, err := driver.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "pvc-1"})
+	require.NoError(t, err)
+	assert.False(t, volumeManager.volumes["pvc-1"])
+
+	// Deleting a missing volume succeeds
+	_, err = driver.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "pvc-1"})
+	assert.NoError(t, err)
+
+	// Volumes still being provisioned cannot be deleted
+	_, err = driver.CreateVolume(ctx, createRequest("pvc-2"))
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	_, err = driver.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "pvc-2"})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+}
+
+func TestVolumesOutsideTenant(t *testing.T) {
+	driver, jobManager, volumeManager := newTestDriver(t)
+	tenants, err := auth.ParseTenants("csi=pvc-", false)
+	require.NoError(t, err)
+	driver.SetTenants(tenants)
+	ctx := context.Background()
+
+	_, err = driver.CreateVolume(ctx, createRequest("team-a-vm01-root"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Empty(t, jobManager.started)
+
+	volumeManager.volumes["team-a-vm01-root"] = true
+	_, err = driver.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "team-a-vm01-root"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.True(t, volumeManager.volumes["team-a-vm01-root"])
+
+	// Volumes of the driver's tenant are provisioned as usual
+	_, err = driver.CreateVolume(ctx, createRequest("pvc-1"))
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	require.Len(t, jobManager.started, 1)
+	assert.Equal(t, Identity, jobManager.started[0].Identity)
+}
+
+func TestValidateVolumeCapabilities(t *testing.T) {
+	driver, _, volumeManager := newTestDriver(t)
+	ctx := context.Background()
+
+	req := &csi.ValidateVolumeCapabilitiesRequest{
+		VolumeId:           "pvc-1",
+		VolumeCapabilities: []*csi.VolumeCapability{blockCapability()},
+	}
+	_, err := driver.ValidateVolumeCapabilities(ctx, req)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	volumeManager.volumes["pvc-1"] = true
+	resp, err := driver.ValidateVolumeCapabilities(ctx, req)
+	require.NoError(t, err)
+	assert.NotNil(t, resp.GetConfirmed())
+}
+
+func TestNodeGetInfo(t *testing.T) {
+	driver, _, _ := newTestDriver(t)
+
+	resp, err := driver.NodeGetInfo(context.Background(), &csi.NodeGetInfoRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "hv1", resp.GetNodeId())
+	assert.Equal(t, "hv1", resp.GetAccessibleTopology().GetSegments()[topologyKey])
+}
+
+func TestGetPluginInfo(t *testing.T) {
+	driver, _, _ := newTestDriver(t)
+
+	resp, err := driver.GetPluginInfo(context.Background(), &csi.GetPluginInfoRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultDriverName, resp.GetName())
+	assert.Equal(t, "test", resp.GetVendorVersion())
+}
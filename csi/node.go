@@ -0,0 +1,170 @@
+package csi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NodeStageVolume verifies that the volume's block device is present on this node.
+// Block volumes need no staging; they are bind mounted directly when published.
+func (d *Driver) NodeStageVolume(_ context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume ID")
+	}
+	if req.GetStagingTargetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing staging target path")
+	}
+	if req.GetVolumeCapability() == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing volume capability")
+	}
+	if err := validateCapabilities([]*csi.VolumeCapability{req.GetVolumeCapability()}); err != nil {
+		return nil, err
+	}
+
+	devicePath := d.volumeManager.DevicePath(req.GetVolumeId())
+	if _, err := os.Stat(devicePath); err != nil {
+		return nil, status.Errorf(codes.NotFound, "volume device %s not found: %v", devicePath, err)
+	}
+
+	return &csi.NodeStageVolumeResponse{}, nil
+}
+
+// NodeUnstageVolume is a no-op for block volumes
+func (d *Driver) NodeUnstageVolume(
+	_ context.Context, req *csi.NodeUnstageVolumeRequest,
+) (*csi.NodeUnstageVolumeResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume ID")
+	}
+	if req.GetStagingTargetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing staging target path")
+	}
+
+	return &csi.NodeUnstageVolumeResponse{}, nil
+}
+
+// NodePublishVolume bind mounts the volume's block device onto the target path
+func (d *Driver) NodePublishVolume(
+	_ context.Context, req *csi.NodePublishVolumeRequest,
+) (*csi.NodePublishVolumeResponse, error) {
+	targetPath := req.GetTargetPath()
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume ID")
+	}
+	if targetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing target path")
+	}
+	if req.GetVolumeCapability() == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing volume capability")
+	}
+	if err := validateCapabilities([]*csi.VolumeCapability{req.GetVolumeCapability()}); err != nil {
+		return nil, err
+	}
+
+	devicePath := d.volumeManager.DevicePath(req.GetVolumeId())
+	var deviceStat syscall.Stat_t
+	if err := syscall.Stat(devicePath, &deviceStat); err != nil {
+		return nil, status.Errorf(codes.NotFound, "volume device %s not found: %v", devicePath, err)
+	}
+
+	// Already published if the target is the same device
+	var targetStat syscall.Stat_t
+	if err := syscall.Stat(targetPath, &targetStat); err == nil && targetStat.Rdev == deviceStat.Rdev {
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	if err := createMountTarget(targetPath); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create target path: %v", err)
+	}
+
+	if err := syscall.Mount(devicePath, targetPath, "", syscall.MS_BIND, ""); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to bind mount %s: %v", devicePath, err)
+	}
+
+	if req.GetReadonly() {
+		flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+		if err := syscall.Mount("", targetPath, "", flags, ""); err != nil {
+			_ = syscall.Unmount(targetPath, 0) // Ignore error, the mount is being abandoned
+			return nil, status.Errorf(codes.Internal, "failed to remount %s read-only: %v", targetPath, err)
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"volume": req.GetVolumeId(),
+		"target": targetPath,
+	}).Info("Published CSI volume")
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// NodeUnpublishVolume unmounts and removes the target path
+func (d *Driver) NodeUnpublishVolume(
+	_ context.Context, req *csi.NodeUnpublishVolumeRequest,
+) (*csi.NodeUnpublishVolumeResponse, error) {
+	targetPath := req.GetTargetPath()
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume ID")
+	}
+	if targetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing target path")
+	}
+
+	// EINVAL means the target is not a mount point, i.e. already unpublished
+	if err := syscall.Unmount(targetPath, 0); err != nil &&
+		!errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOENT) {
+		return nil, status.Errorf(codes.Internal, "failed to unmount %s: %v", targetPath, err)
+	}
+
+	if err := os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+		return nil, status.Errorf(codes.Internal, "failed to remove target path: %v", err)
+	}
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+// NodeGetCapabilities advertises volume staging
+func (d *Driver) NodeGetCapabilities(
+	_ context.Context, _ *csi.NodeGetCapabilitiesRequest,
+) (*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{
+		Capabilities: []*csi.NodeServiceCapability{
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// NodeGetInfo returns the node ID and the topology segment volumes are pinned to
+func (d *Driver) NodeGetInfo(_ context.Context, _ *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	return &csi.NodeGetInfoResponse{
+		NodeId:             d.nodeID,
+		AccessibleTopology: d.topology()[0],
+	}, nil
+}
+
+// createMountTarget creates an empty file to bind mount a block device onto
+func createMountTarget(targetPath string) error {
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0o750); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	//nolint:gosec // Target path is supplied by the kubelet
+	file, err := os.OpenFile(targetPath, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create target file: %w", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,221 @@
+// Package alerts notifies operators when jobs repeatedly fail for the same image and stage,
+// so a broken image upload is noticed before every deployment using it fails.
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
+)
+
+// alertName is the Alertmanager alertname label
+const alertName = "VolumeProvisionerRepeatedFailures"
+
+// Config configures when and where repeated failure alerts are sent
+type Config struct {
+	// Threshold is the number of failures within Window that triggers an alert
+	Threshold int
+	Window    time.Duration
+	// WebhookURLs receive each alert as a JSON Alert
+	WebhookURLs []string
+	// AlertmanagerURL, if set, receives alerts through its v2 API
+	AlertmanagerURL string
+}
+
+// Alert aggregates the failures that crossed the threshold
+type Alert struct {
+	ImageURL     string    `json:"image_url"`
+	Stage        string    `json:"stage"`
+	Failures     int       `json:"failures"`
+	WindowSec    int64     `json:"window_seconds"`
+	FirstFailure time.Time `json:"first_failure"`
+	LastFailure  time.Time `json:"last_failure"`
+	JobIDs       []string  `json:"job_ids"`
+	VolumeNames  []string  `json:"volume_names"`
+	ErrorCodes   []string  `json:"error_codes,omitempty"`
+	LastError    string    `json:"last_error"`
+}
+
+// failureKey groups failures of the same image in the same stage
+type failureKey struct {
+	imageURL string
+	stage    string
+}
+
+// Notifier counts job failures and sends an alert when a key crosses the threshold.
+// It implements events.Sink, so it receives failures from the event emitter.
+type Notifier struct {
+	config     Config
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu       sync.Mutex
+	failures map[failureKey][]events.Event
+}
+
+// NewNotifier creates a notifier, validating that it has a threshold and a destination
+func NewNotifier(config Config) (*Notifier, error) {
+	if config.Threshold <= 0 {
+		return nil, fmt.Errorf("alert threshold must be positive")
+	}
+	if config.Window <= 0 {
+		return nil, fmt.Errorf("alert window must be positive")
+	}
+	if len(config.WebhookURLs) == 0 && config.AlertmanagerURL == "" {
+		return nil, fmt.Errorf("no alert webhook or Alertmanager URL configured")
+	}
+
+	return &Notifier{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		now:        time.Now,
+		failures:   make(map[failureKey][]events.Event),
+	}, nil
+}
+
+// Name returns the sink name
+func (n *Notifier) Name() string { return "alerts" }
+
+// Publish records job failures and sends an alert once the threshold is reached.
+// The failures that triggered an alert are forgotten, so a persistent problem
+// alerts again after another Threshold failures rather than on every failure.
+func (n *Notifier) Publish(event events.Event) error {
+	if event.Type != events.JobFailed {
+		return nil
+	}
+
+	alert := n.record(event)
+	if alert == nil {
+		return nil
+	}
+	return n.send(alert)
+}
+
+// record adds a failure and returns the alert to send, if the threshold was reached
+func (n *Notifier) record(event events.Event) *Alert {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	key := failureKey{imageURL: event.ImageURL, stage: event.Stage}
+	cutoff := n.now().Add(-n.config.Window)
+
+	// Drop failures that have left the window
+	var recent []events.Event
+	for _, failure := range n.failures[key] {
+		if failure.Timestamp.After(cutoff) {
+			recent = append(recent, failure)
+		}
+	}
+	recent = append(recent, event)
+
+	if len(recent) < n.config.Threshold {
+		n.failures[key] = recent
+		return nil
+	}
+
+	delete(n.failures, key)
+	return aggregate(key, recent, n.config.Window)
+}
+
+// aggregate summarizes failures as an alert
+func aggregate(key failureKey, failures []events.Event, window time.Duration) *Alert {
+	alert := &Alert{
+		ImageURL:     key.imageURL,
+		Stage:        key.stage,
+		Failures:     len(failures),
+		WindowSec:    int64(window.Seconds()),
+		FirstFailure: failures[0].Timestamp,
+		LastFailure:  failures[len(failures)-1].Timestamp,
+		LastError:    failures[len(failures)-1].Error,
+	}
+
+	seenCodes := make(map[string]bool)
+	for _, failure := range failures {
+		alert.JobIDs = append(alert.JobIDs, failure.JobID)
+		alert.VolumeNames = append(alert.VolumeNames, failure.VolumeName)
+		if failure.ErrorCode != "" && !seenCodes[failure.ErrorCode] {
+			seenCodes[failure.ErrorCode] = true
+			alert.ErrorCodes = append(alert.ErrorCodes, failure.ErrorCode)
+		}
+	}
+	return alert
+}
+
+// send delivers an alert to every destination, returning the first failure
+func (n *Notifier) send(alert *Alert) error {
+	var firstErr error
+
+	if len(n.config.WebhookURLs) > 0 {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return fmt.Errorf("failed to encode alert: %w", err)
+		}
+		for _, url := range n.config.WebhookURLs {
+			if err := n.post(url, data); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if n.config.AlertmanagerURL != "" {
+		data, err := json.Marshal(alertmanagerAlerts(alert, n.config.Window))
+		if err != nil {
+			return fmt.Errorf("failed to encode alert: %w", err)
+		}
+		url := strings.TrimRight(n.config.AlertmanagerURL, "/") + "/api/v2/alerts"
+		if err := n.post(url, data); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// post sends an alert body to a single URL
+func (n *Notifier) post(url string, data []byte) error {
+	//nolint:noctx // Alerts are delivered in the background with a client timeout
+	resp, err := n.httpClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("alert to %s failed: %w", url, err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alert to %s returned status %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// alertmanagerAlert is an alert in the Alertmanager v2 API format
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+// alertmanagerAlerts converts an alert for Alertmanager. It resolves itself
+// one window after the last failure unless further failures re-fire it.
+func alertmanagerAlerts(alert *Alert, window time.Duration) []alertmanagerAlert {
+	return []alertmanagerAlert{{
+		Labels: map[string]string{
+			"alertname": alertName,
+			"severity":  "critical",
+			"image_url": alert.ImageURL,
+			"stage":     alert.Stage,
+		},
+		Annotations: map[string]string{
+			"summary": fmt.Sprintf("%d provisioning jobs failed for %s", alert.Failures, alert.ImageURL),
+			"description": fmt.Sprintf("%d jobs failed in stage %q within %s; last error: %s (jobs: %s)",
+				alert.Failures, alert.Stage, window, alert.LastError, strings.Join(alert.JobIDs, ", ")),
+		},
+		StartsAt: alert.FirstFailure,
+		EndsAt:   alert.LastFailure.Add(window),
+	}}
+}
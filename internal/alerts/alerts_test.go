@@ -0,0 +1,101 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewNotifier_Validation(t *testing.T) {
+	_, err := NewNotifier(Config{Threshold: 0, Window: time.Minute, WebhookURLs: []string{"http://x"}})
+	assert.Error(t, err)
+
+	_, err = NewNotifier(Config{Threshold: 3, Window: 0, WebhookURLs: []string{"http://x"}})
+	assert.Error(t, err)
+
+	_, err = NewNotifier(Config{Threshold: 3, Window: time.Minute})
+	assert.Error(t, err)
+}
+
+func TestNotifier_Threshold(t *testing.T) {
+	var mu sync.Mutex
+	var webhookAlerts []Alert
+	var alertmanagerBodies [][]alertmanagerAlert
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/api/v2/alerts" {
+			var body []alertmanagerAlert
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			alertmanagerBodies = append(alertmanagerBodies, body)
+		} else {
+			var alert Alert
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+			webhookAlerts = append(webhookAlerts, alert)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier, err := NewNotifier(Config{
+		Threshold:       3,
+		Window:          10 * time.Minute,
+		WebhookURLs:     []string{server.URL + "/hook"},
+		AlertmanagerURL: server.URL + "/",
+	})
+	require.NoError(t, err)
+
+	now := time.Date(2026, 1, 14, 10, 0, 0, 0, time.UTC)
+	notifier.now = func() time.Time { return now }
+
+	failure := func(jobID, stage string, at time.Time) events.Event {
+		return events.Event{
+			Type:       events.JobFailed,
+			Timestamp:  at,
+			JobID:      jobID,
+			VolumeName: "vol-" + jobID,
+			Stage:      stage,
+			ImageURL:   "https://minio/images/golden.qcow2",
+			Error:      "checksum mismatch",
+			ErrorCode:  "CHECKSUM_MISMATCH",
+		}
+	}
+
+	// An old failure falls outside the window and does not count
+	require.NoError(t, notifier.Publish(failure("old", "verifying", now.Add(-time.Hour))))
+	require.NoError(t, notifier.Publish(failure("job-1", "verifying", now.Add(-2*time.Minute))))
+	// A different stage is tracked separately
+	require.NoError(t, notifier.Publish(failure("job-x", "converting", now.Add(-time.Minute))))
+	// Other event types are ignored
+	require.NoError(t, notifier.Publish(events.Event{Type: events.JobCompleted, JobID: "job-ok"}))
+	require.NoError(t, notifier.Publish(failure("job-2", "verifying", now.Add(-time.Minute))))
+	assert.Empty(t, webhookAlerts)
+
+	require.NoError(t, notifier.Publish(failure("job-3", "verifying", now)))
+
+	require.Len(t, webhookAlerts, 1)
+	alert := webhookAlerts[0]
+	assert.Equal(t, "verifying", alert.Stage)
+	assert.Equal(t, 3, alert.Failures)
+	assert.Equal(t, []string{"job-1", "job-2", "job-3"}, alert.JobIDs)
+	assert.Equal(t, []string{"CHECKSUM_MISMATCH"}, alert.ErrorCodes)
+	assert.Equal(t, int64(600), alert.WindowSec)
+
+	require.Len(t, alertmanagerBodies, 1)
+	require.Len(t, alertmanagerBodies[0], 1)
+	assert.Equal(t, alertName, alertmanagerBodies[0][0].Labels["alertname"])
+	assert.Equal(t, "verifying", alertmanagerBodies[0][0].Labels["stage"])
+	assert.Equal(t, now.Add(10*time.Minute), alertmanagerBodies[0][0].EndsAt.UTC())
+
+	// The count restarts after an alert
+	require.NoError(t, notifier.Publish(failure("job-4", "verifying", now)))
+	assert.Len(t, webhookAlerts, 1)
+}
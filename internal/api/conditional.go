@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// minCompressSize is the smallest response body worth compressing
+const minCompressSize = 1024
+
+// bufferedWriter holds back a response so that it can be compared with the client's
+// cached copy and compressed before it is sent
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return false
+}
+
+// conditionalMiddleware serves large listings efficiently to clients polling them: a
+// successful response gets an ETag, and is answered with 304 Not Modified if it matches
+// the client's If-None-Match. Last-Modified is not set: timestamps have a resolution of
+// a second and miss jobs removed from a listing, so only the body tells whether it changed.
+// Other responses are compressed with gzip or deflate if the client accepts it.
+func conditionalMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		original := c.Writer
+		buffered := &bufferedWriter{ResponseWriter: original, status: http.StatusOK}
+		c.Writer = buffered
+		c.Next()
+		c.Writer = original
+
+		body := buffered.body.Bytes()
+		if buffered.status != http.StatusOK {
+			c.Status(buffered.status)
+			writeBody(c, body)
+			return
+		}
+
+		// The ETag is weak, as it is shared by the compressed and uncompressed responses
+		sum := sha256.Sum256(body)
+		etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+		header := c.Writer.Header()
+		header.Set("ETag", etag)
+		header.Add("Vary", "Accept-Encoding")
+		if notModified(c.Request, etag) {
+			header.Del("Content-Type")
+			c.Status(http.StatusNotModified)
+			c.Writer.WriteHeaderNow()
+			return
+		}
+
+		encoding := acceptedEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || len(body) < minCompressSize {
+			header.Set("Content-Length", strconv.Itoa(len(body)))
+			c.Status(http.StatusOK)
+			writeBody(c, body)
+			return
+		}
+		compressed, err := compress(encoding, body)
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to compress response")
+			c.Status(http.StatusOK)
+			writeBody(c, body)
+			return
+		}
+		header.Set("Content-Encoding", encoding)
+		header.Set("Content-Length", strconv.Itoa(len(compressed)))
+		c.Status(http.StatusOK)
+		writeBody(c, compressed)
+	}
+}
+
+// writeBody sends a response body, logging failures as the client has gone away
+func writeBody(c *gin.Context, body []byte) {
+	if _, err := c.Writer.Write(body); err != nil {
+		logrus.WithError(err).Debug("Failed to write response")
+	}
+}
+
+// notModified reports whether the client's cached copy of a response, named by its
+// If-None-Match, is current
+func notModified(req *http.Request, etag string) bool {
+	match := req.Header.Get("If-None-Match")
+	if match == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(match, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptedEncoding returns gzip or deflate if the client accepts it, preferring gzip,
+// or "" to send the response uncompressed
+func acceptedEncoding(acceptEncoding string) string {
+	accepted := make(map[string]bool)
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[strings.ToLower(coding)] = q > 0
+	}
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if accepted[encoding] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compress compresses a response body; HTTP's deflate coding is the zlib format
+func compress(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == "gzip" {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w = zlib.NewWriter(&buf)
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
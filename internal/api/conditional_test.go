@@ -0,0 +1,115 @@
+package api
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newConditionalRouter(body string) *gin.Engine {
+	router := gin.New()
+	router.GET("/list", conditionalMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"items": body})
+	})
+	router.GET("/missing", conditionalMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	})
+	return router
+}
+
+func get(router *gin.Engine, path string, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, path, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestConditionalRequests(t *testing.T) {
+	router := newConditionalRouter("small")
+
+	w := get(router, "/list", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`), etag)
+	assert.Empty(t, w.Header().Get("Last-Modified"))
+	assert.JSONEq(t, `{"items":"small"}`, w.Body.String())
+
+	tests := []struct {
+		headers map[string]string
+		code    int
+	}{
+		{map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{map[string]string{"If-None-Match": `"other", ` + strings.TrimPrefix(etag, "W/")}, http.StatusNotModified},
+		{map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		// Timestamps cannot tell whether a listing changed, so If-Modified-Since is ignored
+		{map[string]string{"If-Modified-Since": "Thu, 01 Oct 2026 12:00:00 GMT"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := get(router, "/list", tt.headers)
+		assert.Equal(t, tt.code, w.Code, tt.headers)
+		if tt.code == http.StatusNotModified {
+			assert.Empty(t, w.Body.String(), tt.headers)
+			assert.Equal(t, etag, w.Header().Get("ETag"), tt.headers)
+		}
+	}
+
+	// Errors are passed through
+	w = get(router, "/missing", map[string]string{"If-None-Match": "*", "Accept-Encoding": "gzip"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+	assert.JSONEq(t, `{"error":"not found"}`, w.Body.String())
+}
+
+func TestResponseCompression(t *testing.T) {
+	items := strings.Repeat("vm01-root ", 500)
+	router := newConditionalRouter(items)
+	plain := get(router, "/list", nil)
+	assert.Empty(t, plain.Header().Get("Content-Encoding"))
+
+	w := get(router, "/list", map[string]string{"Accept-Encoding": "br, gzip;q=0.8, deflate"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, plain.Header().Get("ETag"), w.Header().Get("ETag"))
+	assert.Less(t, w.Body.Len(), plain.Body.Len())
+	reader, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, plain.Body.String(), string(body))
+
+	w = get(router, "/list", map[string]string{"Accept-Encoding": "gzip;q=0, deflate"})
+	assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+	zreader, err := zlib.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err = io.ReadAll(zreader)
+	require.NoError(t, err)
+	assert.Equal(t, plain.Body.String(), string(body))
+
+	// Small responses are not worth compressing
+	w = get(newConditionalRouter("small"), "/list", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.JSONEq(t, `{"items":"small"}`, w.Body.String())
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	assert.Equal(t, "gzip", acceptedEncoding("gzip, deflate, br"))
+	assert.Equal(t, "deflate", acceptedEncoding("deflate;q=0.5"))
+	assert.Equal(t, "gzip", acceptedEncoding("GZIP; q=1.0"))
+	assert.Empty(t, acceptedEncoding(""))
+	assert.Empty(t, acceptedEncoding("identity, br"))
+	assert.Empty(t, acceptedEncoding("gzip;q=0"))
+}
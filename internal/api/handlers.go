@@ -3,13 +3,20 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/auth"
 	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
 )
 
@@ -18,14 +25,56 @@ type JobManager interface {
 	StartJob(req types.ProvisionRequest) (string, error)
 	GetJobStatus(jobID string) (*types.StatusResponse, error)
 	CancelJob(jobID string) error
+	CancelJobs(req types.BulkCancelRequest) (*types.BulkCancelResponse, error)
+	PauseJob(jobID string) error
+	ResumeJob(jobID string) error
 	GetActiveJobs() int
 	GetJobCacheInfo(jobID string) (cacheHit bool, imagePath string, err error)
+	GetCapacity() ([]types.PoolCapacity, error)
+	ValidateImage(ctx context.Context, req types.ValidateImageRequest) (*types.ValidateImageResponse, error)
+	ListJobs(req types.JobListRequest) (*types.JobListResponse, error)
+	ListCachedImages() ([]types.CachedImage, error)
+	ListVolumes() ([]types.Volume, error)
+	ListCleanups() ([]types.PendingCleanup, error)
+	ListImageVolumes(checksum string, includeDeleted bool) ([]types.ProvisionedVolume, error)
+	PreviewVolumeDeletion(volumeName string) (*types.VolumeDeletionPreview, error)
+	DeleteVolume(volumeName string, req types.VolumeDeletionRequest) error
+	AdoptVolume(volumeName string, req types.VolumeAdoptionRequest) (*types.ProvisionedVolume, error)
+	VerifyVolume(volumeName, identity string) (*types.VerifyVolumeResponse, error)
+	ReconcileVolumes(ctx context.Context) (*types.ReconciliationReport, error)
+	GetMaintenance() (*types.MaintenanceStatus, error)
+	SetMaintenance(enabled bool) error
+	GetSettings() (*types.RuntimeSettings, error)
+	UpdateSettings(update types.SettingsUpdate) (*types.RuntimeSettings, error)
+}
+
+// HealthChecker may be implemented by a JobManager to report the state of the
+// services it depends on. A non-nil error marks the dependency as failing.
+type HealthChecker interface {
+	HealthChecks() map[string]error
+}
+
+// SelfTester may be implemented by a JobManager that checks its environment at
+// startup. It returns nil if no self-test has run.
+type SelfTester interface {
+	SelfTestReport() *types.SelfTestReport
+}
+
+// ReadinessChecker may be implemented by a JobManager to report conditions, such as
+// a nearly full disk, under which it should not be sent work. A non-nil error fails readiness.
+type ReadinessChecker interface {
+	ReadinessChecks() map[string]error
 }
 
 // Handler handles HTTP API requests
 type Handler struct {
 	jobManager JobManager
 	version    string
+	v1Sunset   time.Time
+	// tenants confines clients to the volumes of their tenant, if configured
+	tenants *auth.Tenants
+	// versionInfo describes the running binary, as reported by GET /api/v1/version
+	versionInfo types.VersionResponse
 }
 
 // Metrics
@@ -33,9 +82,9 @@ var (
 	requestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "libvirt_volume_provisioner_requests_total",
-			Help: "Total number of requests by endpoint and method",
+			Help: "Total number of requests by endpoint, method and client identity",
 		},
-		[]string{"method", "endpoint", "status"},
+		[]string{"method", "endpoint", "status", "identity"},
 	)
 
 	activeJobsGauge = prometheus.NewGauge(
@@ -48,12 +97,34 @@ var (
 	jobsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "libvirt_volume_provisioner_jobs_total",
-			Help: "Total number of jobs by status",
+			Help: "Total number of jobs by status and client identity",
 		},
-		[]string{"status"},
+		[]string{"status", "identity"},
 	)
 )
 
+// maxIdentityLabels bounds the number of client identities metrics are labelled
+// with; further identities are counted together as "other"
+const maxIdentityLabels = 100
+
+var (
+	identityLabelsMu sync.Mutex
+	identityLabels   = make(map[string]bool)
+)
+
+// identityLabel returns the metric label of a client identity
+func identityLabel(identity string) string {
+	identityLabelsMu.Lock()
+	defer identityLabelsMu.Unlock()
+	if !identityLabels[identity] {
+		if len(identityLabels) >= maxIdentityLabels {
+			return "other"
+		}
+		identityLabels[identity] = true
+	}
+	return identity
+}
+
 func init() {
 	// Register metrics
 	prometheus.MustRegister(requestsTotal)
@@ -64,11 +135,17 @@ func init() {
 // NewHandler creates a new API handler
 func NewHandler(jobManager JobManager, version string) *Handler {
 	return &Handler{
-		jobManager: jobManager,
-		version:    version,
+		jobManager:  jobManager,
+		version:     version,
+		versionInfo: types.VersionResponse{Version: version},
 	}
 }
 
+// SetVersionInfo sets the description of the running binary reported by GET /api/v1/version
+func (h *Handler) SetVersionInfo(info types.VersionResponse) {
+	h.versionInfo = info
+}
+
 // metricsMiddleware tracks request metrics
 func metricsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -76,7 +153,8 @@ func metricsMiddleware() gin.HandlerFunc {
 
 		// Track request metrics
 		status := c.Writer.Status()
-		requestsTotal.WithLabelValues(c.Request.Method, c.FullPath(), fmt.Sprintf("%d", status)).Inc()
+		requestsTotal.WithLabelValues(c.Request.Method, c.FullPath(), fmt.Sprintf("%d", status),
+			identityLabel(auth.Identity(c))).Inc()
 	}
 }
 
@@ -90,53 +168,123 @@ func SetupRoutes(router *gin.Engine, handler *Handler, authMiddleware gin.Handle
 	router.GET("/health", handler.HealthCheck)
 	router.GET("/healthz", handler.HealthCheck)
 	router.GET("/livez", handler.HealthCheck)
+	router.GET("/readyz", handler.Readiness)
 
-	// API routes (with auth)
+	// API routes (with auth). v1 is deprecated in favour of v2.
 	api := router.Group("/api/v1")
-	api.Use(authMiddleware)
+	api.Use(deprecationMiddleware(v1DeprecatedAt, handler.v1Sunset, "/api/v2"), authMiddleware)
 	{
 		api.POST("/provision", handler.ProvisionVolume)
 		api.GET("/status/:job_id", handler.GetJobStatus)
 		api.DELETE("/cancel/:job_id", handler.CancelJob)
+		api.POST("/jobs/cancel", handler.CancelJobs)
+		api.POST("/jobs/:job_id/pause", handler.PauseJob)
+		api.POST("/jobs/:job_id/resume", handler.ResumeJob)
+		api.GET("/capacity", handler.GetCapacity)
+		api.POST("/validate-image", handler.ValidateImage)
+		api.GET("/images/:checksum/volumes", conditionalMiddleware(), handler.ListImageVolumes)
+		api.POST("/volumes/:name/adopt", handler.AdoptVolume)
+		api.POST("/volumes/:name/verify", handler.VerifyVolume)
+		api.GET("/selftest", handler.GetSelfTest)
+		api.GET("/version", handler.GetVersion)
+		api.GET("/admin/settings", handler.GetSettings)
+		api.PATCH("/admin/settings", handler.UpdateSettings)
+	}
+
+	// Listings, which can be large, are compressed and may be requested conditionally
+	v2 := router.Group("/api/v2")
+	v2.Use(authMiddleware)
+	{
+		v2.POST("/provision", handler.ProvisionVolumeV2)
+		v2.GET("/jobs", conditionalMiddleware(), handler.ListJobs)
+		v2.GET("/status/:job_id", handler.GetJobStatusV2)
+		v2.DELETE("/cancel/:job_id", handler.CancelJobV2)
+		v2.POST("/jobs/cancel", handler.CancelJobs)
+		v2.POST("/jobs/:job_id/pause", handler.PauseJob)
+		v2.POST("/jobs/:job_id/resume", handler.ResumeJob)
+		v2.GET("/capacity", handler.GetCapacity)
+		v2.GET("/cache", conditionalMiddleware(), handler.ListCachedImages)
+		v2.GET("/volumes", conditionalMiddleware(), handler.ListVolumes)
+		v2.POST("/volumes/:name/deletion-preview", handler.PreviewVolumeDeletion)
+		v2.DELETE("/volumes/:name", handler.DeleteVolume)
+		v2.POST("/volumes/:name/adopt", handler.AdoptVolume)
+		v2.POST("/volumes/:name/verify", handler.VerifyVolume)
+		v2.GET("/cleanups", handler.ListCleanups)
+		v2.GET("/reconciliation", handler.GetReconciliation)
+		v2.POST("/validate-image", handler.ValidateImage)
+		v2.GET("/images/:checksum/volumes", conditionalMiddleware(), handler.ListImageVolumes)
+		v2.GET("/admin/maintenance", handler.GetMaintenance)
+		v2.PUT("/admin/maintenance", handler.SetMaintenance)
+		v2.GET("/admin/settings", handler.GetSettings)
+		v2.PATCH("/admin/settings", handler.UpdateSettings)
+		v2.GET("/selftest", handler.GetSelfTest)
+		v2.GET("/version", handler.GetVersion)
+	}
+}
+
+// bindingErrorResponse builds the response for a request body that failed to
+// decode or validate, listing the failed validation rule by JSON or query field name
+func bindingErrorResponse(err error, req interface{}) types.ErrorResponse {
+	response := types.NewErrorResponse(400, "invalid request", err, types.ErrCodeInvalidRequest)
+
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		reqType := reflect.TypeOf(req).Elem()
+		response.Details = make(map[string]string, len(validationErrors))
+		for _, fieldErr := range validationErrors {
+			name := fieldErr.Field()
+			if field, ok := reqType.FieldByName(fieldErr.StructField()); ok {
+				if jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ","); jsonName != "" {
+					name = jsonName
+				} else if formName := field.Tag.Get("form"); formName != "" {
+					name = formName
+				}
+			}
+			response.Details[name] = fieldErr.Tag()
+		}
 	}
+	return response
 }
 
 // ProvisionVolume handles volume provisioning requests
 func (h *Handler) ProvisionVolume(c *gin.Context) {
 	var req types.ProvisionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, types.ErrorResponse{
-			Error:   "invalid request",
-			Message: err.Error(),
-			Code:    400,
-		})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err, &req))
 		return
 	}
 
-	// Validate image URL format
-	if req.ImageURL == "" || req.VolumeName == "" {
+	// Image URL and size may instead come from a profile; blank volumes have no image
+	if req.VolumeName == "" || (req.Profile == "" && ((req.NeedsImage() && req.ImageURL == "") || !req.HasSize())) {
 		c.JSON(http.StatusBadRequest, types.ErrorResponse{
-			Error:   "invalid request",
-			Message: "image_url and volume_name are required",
-			Code:    400,
+			Error:     "invalid request",
+			Message:   "volume_name is required, and image_url and a volume size are required unless a profile is given, and image_url unless type is blank",
+			Code:      400,
+			ErrorCode: types.ErrCodeInvalidRequest,
 		})
 		return
 	}
 
 	// Start provisioning job
+	req.Identity = auth.Identity(c)
+	if err := h.tenants.Check(req.Identity, req.VolumeName); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
 	jobID, err := h.jobManager.StartJob(req)
 	if err != nil {
-		jobsTotal.WithLabelValues("failed").Inc()
-		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
-			Error:   "failed to start provisioning",
-			Message: err.Error(),
-			Code:    500,
-		})
+		jobsTotal.WithLabelValues("failed", identityLabel(req.Identity)).Inc()
+		// A full queue is reported as in v2, so that clients back off or submit elsewhere
+		if code, _ := types.ErrorCodeOf(err, ""); code == types.ErrCodeQueueFull {
+			abortWithError(c, "failed to start provisioning", err, types.ErrCodeInternal)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(500, "failed to start provisioning", err, types.ErrCodeInternal))
 		return
 	}
 
 	// Update metrics
-	jobsTotal.WithLabelValues("started").Inc()
+	jobsTotal.WithLabelValues("started", identityLabel(req.Identity)).Inc()
 
 	response := types.ProvisionResponse{
 		JobID: jobID,
@@ -145,28 +293,38 @@ func (h *Handler) ProvisionVolume(c *gin.Context) {
 	c.JSON(http.StatusAccepted, response)
 }
 
-// GetJobStatus returns the status of a provisioning job
+// GetJobStatus returns the status of a provisioning job. With ?wait=30s it waits for
+// the job's state or stage to change first.
 func (h *Handler) GetJobStatus(c *gin.Context) {
 	jobID := c.Param("job_id")
 	if jobID == "" {
 		c.JSON(http.StatusBadRequest, types.ErrorResponse{
-			Error:   "invalid request",
-			Message: "job_id parameter is required",
-			Code:    400,
+			Error:     "invalid request",
+			Message:   "job_id parameter is required",
+			Code:      400,
+			ErrorCode: types.ErrCodeInvalidRequest,
 		})
 		return
 	}
 
-	status, err := h.jobManager.GetJobStatus(jobID)
+	wait, err := parseStatusWait(c.Query("wait"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, types.ErrorResponse{
-			Error:   "job not found",
-			Message: err.Error(),
-			Code:    404,
-		})
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(400, "invalid request", err, types.ErrCodeInvalidRequest))
+		return
+	}
+	if err := h.checkJobTenant(c, jobID); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+
+	status, err := h.waitForJobStatus(c, jobID, wait)
+	if err != nil {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(404, "job not found", err, types.ErrCodeJobNotFound))
 		return
 	}
 
+	// Stage timings were introduced with v2
+	status.StageTimings = nil
 	c.JSON(http.StatusOK, status)
 }
 
@@ -175,20 +333,21 @@ func (h *Handler) CancelJob(c *gin.Context) {
 	jobID := c.Param("job_id")
 	if jobID == "" {
 		c.JSON(http.StatusBadRequest, types.ErrorResponse{
-			Error:   "invalid request",
-			Message: "job_id parameter is required",
-			Code:    400,
+			Error:     "invalid request",
+			Message:   "job_id parameter is required",
+			Code:      400,
+			ErrorCode: types.ErrCodeInvalidRequest,
 		})
 		return
 	}
 
+	if err := h.checkJobTenant(c, jobID); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
 	err := h.jobManager.CancelJob(jobID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, types.ErrorResponse{
-			Error:   "failed to cancel job",
-			Message: err.Error(),
-			Code:    400,
-		})
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(400, "failed to cancel job", err, types.ErrCodeJobNotCancellable))
 		return
 	}
 
@@ -198,6 +357,148 @@ func (h *Handler) CancelJob(c *gin.Context) {
 	})
 }
 
+// CancelJobs cancels every unfinished job matching the request's filters, for stopping
+// many jobs at once. As with pausing, failures are reported with a status matching their error code.
+func (h *Handler) CancelJobs(c *gin.Context) {
+	var req types.BulkCancelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err, &req))
+		return
+	}
+	// Checked before the filters are confined to the client's tenant, which alone
+	// must not select every job of the tenant
+	if _, err := req.Validate(); err != nil {
+		abortWithError(c, "invalid request", err, types.ErrCodeInvalidRequest)
+		return
+	}
+	prefix, err := h.tenants.Confine(auth.Identity(c), req.VolumeNamePrefix)
+	if err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+	req.VolumeNamePrefix = prefix
+
+	response, err := h.jobManager.CancelJobs(req)
+	if err != nil {
+		abortWithError(c, "failed to cancel jobs", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// PauseJob pauses a job before its next stage, freeing the host's I/O for other work.
+// Unlike the original v1 endpoints, failures are reported with a status matching their error code.
+func (h *Handler) PauseJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+	if err := h.checkJobTenant(c, jobID); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+	if err := h.jobManager.PauseJob(jobID); err != nil {
+		abortWithError(c, "failed to pause job", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": types.StatusPaused,
+		"job_id": jobID,
+	})
+}
+
+// ResumeJob lets a paused job continue
+func (h *Handler) ResumeJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+	if err := h.checkJobTenant(c, jobID); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+	if err := h.jobManager.ResumeJob(jobID); err != nil {
+		abortWithError(c, "failed to resume job", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "resumed",
+		"job_id": jobID,
+	})
+}
+
+// GetCapacity returns usage and limits for each image cache pool
+func (h *Handler) GetCapacity(c *gin.Context) {
+	pools, err := h.jobManager.GetCapacity()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(500, "failed to get capacity", err, types.ErrCodeInternal))
+		return
+	}
+
+	c.JSON(http.StatusOK, types.CapacityResponse{
+		Pools: pools,
+	})
+}
+
+// ValidateImage checks an image URL without starting a job, so that clients
+// can report bad URLs before provisioning
+func (h *Handler) ValidateImage(c *gin.Context) {
+	var req types.ValidateImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err, &req))
+		return
+	}
+
+	resp, err := h.jobManager.ValidateImage(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(500, "failed to validate image", err, types.ErrCodeInternal))
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListImageVolumes lists the volumes built from the image with a SHA256 checksum,
+// e.g. to find the VMs to rebuild when a vulnerability is found in a base image
+func (h *Handler) ListImageVolumes(c *gin.Context) {
+	checksum := strings.ToLower(c.Param("checksum"))
+	if !isSHA256(checksum) {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:     "invalid request",
+			Message:   "checksum must be a hex-encoded SHA256",
+			Code:      400,
+			ErrorCode: types.ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	var req types.ImageVolumesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err, &req))
+		return
+	}
+
+	volumes, err := h.jobManager.ListImageVolumes(checksum, req.IncludeDeleted)
+	if err != nil {
+		abortWithError(c, "failed to list image volumes", err, types.ErrCodeInternal)
+		return
+	}
+	volumes = tenantVolumes(h.tenants, auth.Identity(c), volumes,
+		func(v types.ProvisionedVolume) string { return v.Name })
+
+	c.JSON(http.StatusOK, types.ImageVolumesResponse{Checksum: checksum, Volumes: volumes})
+}
+
+// isSHA256 reports whether s is a hex-encoded SHA256 checksum
+func isSHA256(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
 // HealthCheck provides service health information
 func (h *Handler) HealthCheck(c *gin.Context) {
 	activeJobsCount := h.jobManager.GetActiveJobs()
@@ -212,6 +513,20 @@ func (h *Handler) HealthCheck(c *gin.Context) {
 		Uptime:    "unknown", // Could be implemented with start time tracking
 	}
 
+	// Return degraded status if a dependency is failing
+	if checker, ok := h.jobManager.(HealthChecker); ok {
+		for name, err := range checker.HealthChecks() {
+			if err == nil {
+				continue
+			}
+			if response.Checks == nil {
+				response.Checks = make(map[string]string)
+			}
+			response.Checks[name] = err.Error()
+			response.Status = "degraded"
+		}
+	}
+
 	// Return degraded status if too many active jobs
 	if activeJobsCount > 2 {
 		response.Status = "degraded"
@@ -221,3 +536,53 @@ func (h *Handler) HealthCheck(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response)
 }
+
+// selfTestReport returns the job manager's self-test report, or nil if it has none
+func (h *Handler) selfTestReport() *types.SelfTestReport {
+	if tester, ok := h.jobManager.(SelfTester); ok {
+		return tester.SelfTestReport()
+	}
+	return nil
+}
+
+// Readiness reports whether the provisioner accepts jobs. It fails while critical
+// startup self-test checks have failed or a readiness check fails, such as a nearly
+// full cache or database disk, so the instance is kept out of rotation rather than
+// failing jobs. Managers without these checks, like the fleet coordinator, are ready.
+func (h *Handler) Readiness(c *gin.Context) {
+	if report := h.selfTestReport(); report != nil && !report.Ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not ready"})
+		return
+	}
+	if checker, ok := h.jobManager.(ReadinessChecker); ok {
+		checks := make(map[string]string)
+		for name, err := range checker.ReadinessChecks() {
+			if err != nil {
+				checks[name] = err.Error()
+			}
+		}
+		if len(checks) > 0 {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not ready", "checks": checks})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
+
+// GetVersion describes the running binary, so that hosts still running an old
+// binary can be found
+func (h *Handler) GetVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, h.versionInfo)
+}
+
+// GetSelfTest returns the environment report of the startup self-test
+func (h *Handler) GetSelfTest(c *gin.Context) {
+	report := h.selfTestReport()
+	if report == nil {
+		c.JSON(http.StatusNotImplemented, types.NewErrorResponse(http.StatusNotImplemented,
+			"no self-test report", errors.New("this provisioner does not run a self-test"),
+			types.ErrCodeNotSupported))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
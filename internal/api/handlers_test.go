@@ -3,6 +3,9 @@ package api
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -17,6 +20,14 @@ import (
 type MockJobManager struct {
 	startJobCalled bool
 	lastRequest    types.ProvisionRequest
+	maintenance    bool
+	deletedVolumes []string
+	lastAdoption   types.VolumeAdoptionRequest
+	lastBulkCancel types.BulkCancelRequest
+	lastListJobs   types.JobListRequest
+	settings       types.RuntimeSettings
+	// jobVolume is the volume of the jobs GetJobStatus reports, if set
+	jobVolume string
 }
 
 func (m *MockJobManager) StartJob(req types.ProvisionRequest) (string, error) {
@@ -26,18 +37,30 @@ func (m *MockJobManager) StartJob(req types.ProvisionRequest) (string, error) {
 }
 
 func (m *MockJobManager) GetJobStatus(jobID string) (*types.StatusResponse, error) {
-	return &types.StatusResponse{
+	status := &types.StatusResponse{
 		JobID:     jobID,
 		Status:    types.StatusCompleted,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-	}, nil
+	}
+	if m.jobVolume != "" {
+		status.Request = &types.ProvisionRequest{VolumeName: m.jobVolume}
+	}
+	return status, nil
 }
 
 func (m *MockJobManager) CancelJob(_ string) error {
 	return nil
 }
 
+func (m *MockJobManager) CancelJobs(req types.BulkCancelRequest) (*types.BulkCancelResponse, error) {
+	if _, err := req.Validate(); err != nil {
+		return nil, types.NewError(types.ErrCodeInvalidRequest, err, nil)
+	}
+	m.lastBulkCancel = req
+	return &types.BulkCancelResponse{Cancelled: []string{"job-1", "job-2"}}, nil
+}
+
 func (m *MockJobManager) GetActiveJobs() int {
 	return 0
 }
@@ -46,6 +69,137 @@ func (m *MockJobManager) GetJobCacheInfo(_ string) (bool, string, error) {
 	return false, "", nil
 }
 
+func (m *MockJobManager) GetCapacity() ([]types.PoolCapacity, error) {
+	return []types.PoolCapacity{
+		{Name: "images", Path: "/var/lib/libvirt/images", Default: true, UsedBytes: 1024, AvailableBytes: 4096},
+	}, nil
+}
+
+func (m *MockJobManager) ValidateImage(_ context.Context, req types.ValidateImageRequest) (*types.ValidateImageResponse, error) {
+	if req.ImageType == "raw" {
+		return &types.ValidateImageResponse{ImageURL: req.ImageURL, Format: "qcow2", Error: "image format is qcow2, not raw"}, nil
+	}
+	return &types.ValidateImageResponse{ImageURL: req.ImageURL, Valid: true, Format: "qcow2"}, nil
+}
+
+func (m *MockJobManager) ListJobs(req types.JobListRequest) (*types.JobListResponse, error) {
+	m.lastListJobs = req
+	return &types.JobListResponse{
+		Jobs:       []types.StatusResponse{{JobID: "test-job-id", Status: types.StatusCompleted}},
+		NextCursor: "next-" + req.SortBy,
+	}, nil
+}
+
+func (m *MockJobManager) ListCachedImages() ([]types.CachedImage, error) {
+	return []types.CachedImage{
+		{Pool: "images", Path: "/var/lib/libvirt/images/ubuntu_22_04", SizeBytes: 1024, Checksum: "abc123"},
+	}, nil
+}
+
+func (m *MockJobManager) ListVolumes() ([]types.Volume, error) {
+	return []types.Volume{
+		{Name: "vm01-root", DevicePath: "/dev/data/vm01-root", SizeBytes: 10 << 30, Attributes: "-wi-a-----"},
+	}, nil
+}
+
+func (m *MockJobManager) ListCleanups() ([]types.PendingCleanup, error) {
+	return []types.PendingCleanup{
+		{VolumeName: "vm01-root", JobID: "test-job-id", Attempts: 2, LastError: "lvremove failed: exit status 5"},
+	}, nil
+}
+
+func (m *MockJobManager) ReconcileVolumes(_ context.Context) (*types.ReconciliationReport, error) {
+	return &types.ReconciliationReport{
+		Volumes: []types.ReconciledVolume{
+			{Name: "vm01-root", SizeBytes: 50 << 30, Domains: []string{"vm01"}, Recorded: true, NetBoxSizeMB: 100000},
+			{Name: "vm02-root", SizeBytes: 10 << 30},
+		},
+		Findings: []types.ReconciliationFinding{
+			{Kind: types.FindingSizeMismatch, VolumeName: "vm01-root",
+				Message: "volume vm01-root is 53688 MB but NetBox records 100000 MB for vm01"},
+			{Kind: types.FindingOrphanVolume, VolumeName: "vm02-root",
+				Message: "volume vm02-root is not a disk of any libvirt domain"},
+		},
+	}, nil
+}
+
+func (m *MockJobManager) ListImageVolumes(checksum string, _ bool) ([]types.ProvisionedVolume, error) {
+	return []types.ProvisionedVolume{
+		{Name: "vm01-root", VolumeGroup: "data", SizeGB: 10, ImageChecksum: checksum, JobID: "test-job-id"},
+	}, nil
+}
+
+func (m *MockJobManager) PreviewVolumeDeletion(volumeName string) (*types.VolumeDeletionPreview, error) {
+	if volumeName != "vm01-root" {
+		return nil, types.NewError(types.ErrCodeVolumeNotFound, errors.New("volume does not exist"), nil)
+	}
+	return &types.VolumeDeletionPreview{Name: volumeName, SizeBytes: 10 << 30, Token: "token"}, nil
+}
+
+func (m *MockJobManager) AdoptVolume(volumeName string,
+	req types.VolumeAdoptionRequest) (*types.ProvisionedVolume, error) {
+	switch volumeName {
+	case "vm01-root":
+		m.lastAdoption = req
+		return &types.ProvisionedVolume{Name: volumeName, VolumeGroup: "data", SizeGB: 20, ImageURL: req.ImageURL,
+			ImageChecksum: req.ImageChecksum, Adopted: true, CreatedAt: time.Now()}, nil
+	case "vm02-root":
+		return nil, types.NewError(types.ErrCodeVolumeAlreadyManaged, errors.New("volume vm02-root is already recorded"), nil)
+	}
+	return nil, types.NewError(types.ErrCodeVolumeNotFound, errors.New("volume does not exist"), nil)
+}
+
+func (m *MockJobManager) VerifyVolume(volumeName, _ string) (*types.VerifyVolumeResponse, error) {
+	switch volumeName {
+	case "vm01-root":
+		return &types.VerifyVolumeResponse{JobID: "verify-job", VolumeName: volumeName,
+			Method: types.VerifyMethodChecksum}, nil
+	case "vm02-root":
+		return nil, types.NewError(types.ErrCodeVolumeNotVerifiable,
+			errors.New("volume vm02-root has no recorded checksum"), nil)
+	}
+	return nil, types.NewError(types.ErrCodeVolumeNotFound, errors.New("volume does not exist"), nil)
+}
+
+func (m *MockJobManager) DeleteVolume(volumeName string, req types.VolumeDeletionRequest) error {
+	if !req.Force && req.Token != "token" {
+		return types.NewError(types.ErrCodeConfirmationRequired, errors.New("deletion token is invalid"), nil)
+	}
+	m.deletedVolumes = append(m.deletedVolumes, volumeName)
+	return nil
+}
+
+func (m *MockJobManager) PauseJob(_ string) error {
+	return nil
+}
+
+func (m *MockJobManager) ResumeJob(_ string) error {
+	return nil
+}
+
+func (m *MockJobManager) GetMaintenance() (*types.MaintenanceStatus, error) {
+	return &types.MaintenanceStatus{Maintenance: m.maintenance, ActiveJobs: 1, WindowOpen: true}, nil
+}
+
+func (m *MockJobManager) SetMaintenance(enabled bool) error {
+	m.maintenance = enabled
+	return nil
+}
+
+func (m *MockJobManager) GetSettings() (*types.RuntimeSettings, error) {
+	return &m.settings, nil
+}
+
+func (m *MockJobManager) UpdateSettings(update types.SettingsUpdate) (*types.RuntimeSettings, error) {
+	if update.DownloadConcurrency != nil {
+		m.settings.DownloadConcurrency = *update.DownloadConcurrency
+	}
+	if update.QueuePaused != nil {
+		m.settings.QueuePaused = *update.QueuePaused
+	}
+	return &m.settings, nil
+}
+
 func TestNewHandler(t *testing.T) {
 	mockManager := &MockJobManager{}
 	handler := NewHandler(mockManager, "test-version")
@@ -80,9 +234,13 @@ func TestSetupRoutes(t *testing.T) {
 	assert.True(t, routePaths["POST /api/v1/provision"])
 	assert.True(t, routePaths["GET /api/v1/status/:job_id"])
 	assert.True(t, routePaths["DELETE /api/v1/cancel/:job_id"])
+	assert.True(t, routePaths["GET /api/v1/capacity"])
+	assert.True(t, routePaths["POST /api/v1/validate-image"])
 	assert.True(t, routePaths["GET /health"])
 	assert.True(t, routePaths["GET /healthz"])
 	assert.True(t, routePaths["GET /livez"])
+	assert.True(t, routePaths["GET /readyz"])
+	assert.True(t, routePaths["GET /api/v1/selftest"])
 	assert.True(t, routePaths["GET /metrics"])
 }
 
@@ -107,6 +265,138 @@ func TestHealthCheck(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "test-version")
 }
 
+// unhealthyJobManager reports a failing dependency
+type unhealthyJobManager struct {
+	*MockJobManager
+}
+
+func (m unhealthyJobManager) HealthChecks() map[string]error {
+	return map[string]error{"minio": errors.New("source storage unavailable"), "libvirt": nil}
+}
+
+func TestHealthCheck_Degraded(t *testing.T) {
+	router := gin.New()
+	handler := NewHandler(unhealthyJobManager{&MockJobManager{}}, "test-version")
+	SetupRoutes(router, handler, func(c *gin.Context) { c.Next() })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/health", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp types.HealthResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "degraded", resp.Status)
+	assert.Equal(t, map[string]string{"minio": "source storage unavailable"}, resp.Checks)
+}
+
+// selfTestedJobManager reports a startup self-test
+type selfTestedJobManager struct {
+	*MockJobManager
+	report *types.SelfTestReport
+}
+
+func (m selfTestedJobManager) SelfTestReport() *types.SelfTestReport {
+	return m.report
+}
+
+func TestSelfTest(t *testing.T) {
+	report := &types.SelfTestReport{
+		Ready: false,
+		Checks: []types.SelfTestCheck{
+			{Name: "qemu-img", Critical: true, Passed: false, Error: "qemu-img command not found"},
+		},
+	}
+	tests := []struct {
+		name        string
+		manager     JobManager
+		path        string
+		wantStatus  int
+		wantContent string
+	}{
+		{"report v1", selfTestedJobManager{&MockJobManager{}, report}, "/api/v1/selftest",
+			http.StatusOK, "qemu-img command not found"},
+		{"report v2", selfTestedJobManager{&MockJobManager{}, report}, "/api/v2/selftest",
+			http.StatusOK, `"ready":false`},
+		{"no self-test", &MockJobManager{}, "/api/v2/selftest",
+			http.StatusNotImplemented, "NOT_SUPPORTED"},
+		{"not ready", selfTestedJobManager{&MockJobManager{}, report}, "/readyz",
+			http.StatusServiceUnavailable, "not ready"},
+		{"ready", selfTestedJobManager{&MockJobManager{}, &types.SelfTestReport{Ready: true}}, "/readyz",
+			http.StatusOK, "ready"},
+		{"ready without self-test", &MockJobManager{}, "/readyz",
+			http.StatusOK, "ready"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			SetupRoutes(router, NewHandler(tt.manager, "test-version"), func(c *gin.Context) { c.Next() })
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantContent)
+		})
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	router := gin.New()
+	handler := NewHandler(&MockJobManager{}, "0.2.7")
+	SetupRoutes(router, handler, func(c *gin.Context) { c.Next() })
+
+	for _, path := range []string{"/api/v1/version", "/api/v2/version"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.JSONEq(t, `{"version": "0.2.7", "build_time": "", "git_commit": "", "go_version": "", "outdated": false}`,
+			w.Body.String(), path)
+	}
+
+	handler.SetVersionInfo(types.VersionResponse{
+		Version: "0.2.7", BuildTime: "2026-01-24T10:00:00Z", GitCommit: "abc1234", GoVersion: "go1.26.0",
+		MinimumVersion: "0.3.0", Outdated: true, Message: "0.2.x misvalidates volume sizes",
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/v2/version", nil)
+	router.ServeHTTP(w, req)
+	var resp types.VersionResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Outdated)
+	assert.Equal(t, "abc1234", resp.GitCommit)
+	assert.Equal(t, "0.3.0", resp.MinimumVersion)
+}
+
+// diskFullJobManager reports a nearly full cache disk
+type diskFullJobManager struct {
+	*MockJobManager
+}
+
+func (m diskFullJobManager) ReadinessChecks() map[string]error {
+	return map[string]error{
+		"cache_disk:images": errors.New("filesystem of /var/lib/libvirt/images is 97.0% full"),
+		"database_disk":     nil,
+	}
+}
+
+func TestReadiness_DiskFull(t *testing.T) {
+	router := gin.New()
+	SetupRoutes(router, NewHandler(diskFullJobManager{&MockJobManager{}}, "test-version"),
+		func(c *gin.Context) { c.Next() })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/readyz", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status": "not ready", "checks": {
+		"cache_disk:images": "filesystem of /var/lib/libvirt/images is 97.0% full"}}`, w.Body.String())
+}
+
 func TestProvisionVolume_InvalidJSON(t *testing.T) {
 	router := gin.New()
 	mockManager := &MockJobManager{}
@@ -154,6 +444,30 @@ func TestProvisionVolume_MissingFields(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "required")
 }
 
+func TestProvisionVolume_ErrorCode(t *testing.T) {
+	router := gin.New()
+	mockManager := &MockJobManager{}
+	handler := NewHandler(mockManager, "test-version")
+
+	authMiddleware := func(c *gin.Context) {
+		c.Next()
+	}
+
+	SetupRoutes(router, handler, authMiddleware)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost,
+		"/api/v1/provision", bytes.NewBufferString(`{"volume_size_gb": 0}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	var resp types.ErrorResponse
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, types.ErrCodeInvalidRequest, resp.ErrorCode)
+	assert.Equal(t, map[string]string{"volume_name": "required"}, resp.Details)
+}
+
 func TestProvisionVolume_ValidRequest(t *testing.T) {
 	router := gin.New()
 	mockManager := &MockJobManager{}
@@ -186,3 +500,107 @@ func TestProvisionVolume_ValidRequest(t *testing.T) {
 	assert.Equal(t, "test-volume", mockManager.lastRequest.VolumeName)
 	assert.Equal(t, 10, mockManager.lastRequest.VolumeSizeGB)
 }
+
+func TestProvisionVolume_Profile(t *testing.T) {
+	router := gin.New()
+	mockManager := &MockJobManager{}
+	handler := NewHandler(mockManager, "test-version")
+
+	authMiddleware := func(c *gin.Context) {
+		c.Next()
+	}
+
+	SetupRoutes(router, handler, authMiddleware)
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"volume_name": "data-1", "volume_size_gb": 10, "type": "blank"}`, http.StatusAccepted},
+		{`{"volume_name": "data-1", "volume_size_gb": 10, "type": "empty"}`, http.StatusBadRequest},
+		{`{"volume_name": "worker-1", "volume_size_gb": 10}`, http.StatusBadRequest},
+		{`{"volume_name": "worker-1", "profile": "k8s-worker"}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost,
+			"/api/v1/provision", bytes.NewBufferString(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.body)
+	}
+	assert.Equal(t, "k8s-worker", mockManager.lastRequest.Profile)
+}
+
+func TestGetCapacity(t *testing.T) {
+	router := gin.New()
+	mockManager := &MockJobManager{}
+	handler := NewHandler(mockManager, "test-version")
+
+	// Mock auth middleware
+	authMiddleware := func(c *gin.Context) {
+		c.Next()
+	}
+
+	SetupRoutes(router, handler, authMiddleware)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/v1/capacity", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"images"`)
+	assert.Contains(t, w.Body.String(), `"used_bytes":1024`)
+}
+
+func TestValidateImage(t *testing.T) {
+	router := gin.New()
+	mockManager := &MockJobManager{}
+	handler := NewHandler(mockManager, "test-version")
+
+	authMiddleware := func(c *gin.Context) {
+		c.Next()
+	}
+
+	SetupRoutes(router, handler, authMiddleware)
+
+	tests := []struct {
+		body     string
+		code     int
+		contains string
+	}{
+		{`{"image_url": "https://minio.example.com/images/ubuntu.qcow2"}`, http.StatusOK, `"valid":true`},
+		{`{"image_url": "https://minio.example.com/images/ubuntu.qcow2", "image_type": "raw"}`, http.StatusOK, "not raw"},
+		{`{}`, http.StatusBadRequest, "required"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost,
+			"/api/v1/validate-image", bytes.NewBufferString(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.body)
+		assert.Contains(t, w.Body.String(), tt.contains)
+	}
+}
+
+func TestIdentityLabel(t *testing.T) {
+	identityLabelsMu.Lock()
+	saved := identityLabels
+	identityLabels = make(map[string]bool)
+	identityLabelsMu.Unlock()
+	defer func() {
+		identityLabelsMu.Lock()
+		identityLabels = saved
+		identityLabelsMu.Unlock()
+	}()
+
+	for i := 0; i < maxIdentityLabels; i++ {
+		assert.Equal(t, fmt.Sprintf("token:%d", i), identityLabel(fmt.Sprintf("token:%d", i)))
+	}
+	// Identities already seen keep their label, new ones share one
+	assert.Equal(t, "token:0", identityLabel("token:0"))
+	assert.Equal(t, "other", identityLabel("cert:newcomer"))
+}
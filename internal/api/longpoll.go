@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// maxStatusWait bounds how long a status request may wait for its job to change
+const maxStatusWait = time.Minute
+
+// statusPollInterval is how often a waiting status request checks its job
+var statusPollInterval = 250 * time.Millisecond
+
+// parseStatusWait parses the wait parameter of a status request, a duration such as
+// "30s" or a number of seconds, capped at maxStatusWait
+func parseStatusWait(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(s)
+	if err != nil {
+		seconds, serr := strconv.Atoi(s)
+		if serr != nil {
+			return 0, types.NewError(types.ErrCodeInvalidRequest,
+				fmt.Errorf("invalid wait %q, expected a duration such as 30s", s), nil)
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	if wait < 0 {
+		return 0, types.NewError(types.ErrCodeInvalidRequest, errors.New("wait must not be negative"), nil)
+	}
+	return min(wait, maxStatusWait), nil
+}
+
+// waitForJobStatus returns the status of a job once its state or stage changes, or
+// when the wait runs out, so that simple clients can follow a job without polling.
+// The status of a finished job is returned straight away.
+func (h *Handler) waitForJobStatus(c *gin.Context, jobID string, wait time.Duration) (*types.StatusResponse, error) {
+	status, err := h.jobManager.GetJobStatus(jobID)
+	if err != nil || wait == 0 || finished(status.Status) {
+		return status, err
+	}
+
+	// The server's write timeout would otherwise cut the wait short
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(wait + 10*time.Second)); err != nil {
+		logrus.WithError(err).Debug("Failed to extend write deadline of status request")
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return status, nil
+		case <-timer.C:
+			return status, nil
+		case <-ticker.C:
+			current, err := h.jobManager.GetJobStatus(jobID)
+			if err != nil {
+				return nil, err
+			}
+			if current.Status != status.Status || stage(current) != stage(status) {
+				return current, nil
+			}
+			status = current
+		}
+	}
+}
+
+func finished(status types.JobStatus) bool {
+	return status == types.StatusCompleted || status == types.StatusFailed
+}
+
+func stage(status *types.StatusResponse) string {
+	if status.Progress == nil {
+		return ""
+	}
+	return status.Progress.Stage
+}
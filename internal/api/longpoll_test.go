@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// progressingJobManager reports a job downloading until it has been asked for its status
+// changeAfter times, and then writing
+type progressingJobManager struct {
+	MockJobManager
+	calls       atomic.Int32
+	changeAfter int32
+}
+
+func (m *progressingJobManager) GetJobStatus(jobID string) (*types.StatusResponse, error) {
+	stage := "downloading"
+	if m.calls.Add(1) > m.changeAfter {
+		stage = "writing"
+	}
+	return &types.StatusResponse{
+		JobID:    jobID,
+		Status:   types.StatusRunning,
+		Progress: &types.ProgressInfo{Stage: stage},
+	}, nil
+}
+
+func TestParseStatusWait(t *testing.T) {
+	tests := map[string]time.Duration{"": 0, "30s": 30 * time.Second, "5": 5 * time.Second, "1h": time.Minute}
+	for s, want := range tests {
+		wait, err := parseStatusWait(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, wait, s)
+	}
+	for _, invalid := range []string{"soon", "-5s"} {
+		_, err := parseStatusWait(invalid)
+		code, _ := types.ErrorCodeOf(err, "")
+		assert.Equal(t, types.ErrCodeInvalidRequest, code, invalid)
+	}
+}
+
+func TestGetJobStatus_Wait(t *testing.T) {
+	statusPollInterval = 10 * time.Millisecond
+	defer func() { statusPollInterval = 250 * time.Millisecond }()
+
+	getStatus := func(router http.Handler, path string) (*httptest.ResponseRecorder, types.StatusResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, path, nil)
+		router.ServeHTTP(w, req)
+		var status types.StatusResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &status)
+		return w, status
+	}
+
+	for _, version := range []string{"v1", "v2"} {
+		// The stage changes while waiting
+		router := newTestRouter(&progressingJobManager{changeAfter: 3}, time.Time{})
+		started := time.Now()
+		w, status := getStatus(router, "/api/"+version+"/status/job-1?wait=30s")
+		assert.Equal(t, http.StatusOK, w.Code, version)
+		assert.Equal(t, "writing", status.Progress.Stage, version)
+		assert.Less(t, time.Since(started), 5*time.Second, version)
+
+		// Nothing changes before the wait runs out
+		router = newTestRouter(&progressingJobManager{changeAfter: 1000}, time.Time{})
+		w, status = getStatus(router, "/api/"+version+"/status/job-1?wait=50ms")
+		assert.Equal(t, http.StatusOK, w.Code, version)
+		assert.Equal(t, "downloading", status.Progress.Stage, version)
+
+		// Finished jobs are returned straight away
+		router = newTestRouter(&MockJobManager{}, time.Time{})
+		started = time.Now()
+		w, status = getStatus(router, "/api/"+version+"/status/job-1?wait=30s")
+		assert.Equal(t, http.StatusOK, w.Code, version)
+		assert.Equal(t, types.StatusCompleted, status.Status, version)
+		assert.Less(t, time.Since(started), 5*time.Second, version)
+
+		w, _ = getStatus(router, "/api/"+version+"/status/job-1?wait=soon")
+		assert.Equal(t, http.StatusBadRequest, w.Code, version)
+	}
+}
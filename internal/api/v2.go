@@ -0,0 +1,422 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/auth"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// correlationIDHeader carries a request's correlation ID in v2 requests and responses
+const correlationIDHeader = "X-Correlation-ID"
+
+// v1DeprecatedAt is when /api/v2 superseded /api/v1
+var v1DeprecatedAt = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// SetV1Sunset sets the date /api/v1 will be removed, advertised in the Sunset header
+func (h *Handler) SetV1Sunset(sunset time.Time) {
+	h.v1Sunset = sunset
+}
+
+// SetTenants confines clients to the volumes whose names start with their tenant's
+// prefix when provisioning, listing and deleting volumes
+func (h *Handler) SetTenants(tenants *auth.Tenants) {
+	h.tenants = tenants
+}
+
+// tenantVolumes returns the volumes of the client's tenant
+func tenantVolumes[V any](tenants *auth.Tenants, identity string, volumes []V, name func(V) string) []V {
+	if prefix, ok := tenants.Prefix(identity); ok && prefix == "" {
+		return volumes
+	}
+	return slices.DeleteFunc(volumes, func(v V) bool { return !tenants.Allows(identity, name(v)) })
+}
+
+// checkJobTenant returns a VOLUME_OUTSIDE_TENANT error if the client may not use the
+// volume of a job. Unknown jobs are left for the job manager to report.
+func (h *Handler) checkJobTenant(c *gin.Context, jobID string) error {
+	if !h.tenants.Enabled() {
+		return nil
+	}
+	status, err := h.jobManager.GetJobStatus(jobID)
+	if err != nil {
+		return nil //nolint:nilerr // Reported by the handler's own call
+	}
+	volumeName := ""
+	if status.Request != nil {
+		volumeName = status.Request.VolumeName
+	}
+	return h.tenants.Check(auth.Identity(c), volumeName)
+}
+
+// deprecationMiddleware marks responses of a deprecated API version with
+// Deprecation (RFC 9745) and, once a removal date is set, Sunset (RFC 8594) headers
+func deprecationMiddleware(deprecatedAt, sunset time.Time, successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", fmt.Sprintf("@%d", deprecatedAt.Unix()))
+		if !sunset.IsZero() {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		c.Next()
+	}
+}
+
+// statusForCode returns the HTTP status v2 uses for an error code
+func statusForCode(code types.ErrorCode) int {
+	switch code {
+	case types.ErrCodeInvalidRequest, types.ErrCodeUnknownProfile, types.ErrCodeUnknownCachePool:
+		return http.StatusBadRequest
+	case types.ErrCodeNetBoxValidationFailed, types.ErrCodeVolumeNotVerifiable:
+		return http.StatusUnprocessableEntity
+	case types.ErrCodeJobNotFound, types.ErrCodeVolumeNotFound:
+		return http.StatusNotFound
+	case types.ErrCodeJobNotCancellable, types.ErrCodeJobNotPausable, types.ErrCodeJobNotPaused,
+		types.ErrCodeVolumeInUse, types.ErrCodeVolumeAttached, types.ErrCodeDependencyFailed,
+		types.ErrCodeVolumeAlreadyManaged:
+		return http.StatusConflict
+	case types.ErrCodeVolumeOutsideTenant:
+		return http.StatusForbidden
+	case types.ErrCodeConfirmationRequired:
+		return http.StatusPreconditionRequired
+	case types.ErrCodePeerUnavailable, types.ErrCodeMaintenance, types.ErrCodeNotReady,
+		types.ErrCodeSourceUnavailable:
+		return http.StatusServiceUnavailable
+	case types.ErrCodeQuotaExceeded:
+		return http.StatusInsufficientStorage
+	case types.ErrCodeQueueFull:
+		return http.StatusTooManyRequests
+	case types.ErrCodeNotSupported:
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// abortWithError responds with an error whose HTTP status follows its error code
+func abortWithError(c *gin.Context, errorMsg string, err error, fallback types.ErrorCode) {
+	code, details := types.ErrorCodeOf(err, fallback)
+	status := statusForCode(code)
+	if retryAfter := details["retry_after"]; code == types.ErrCodeQueueFull && retryAfter != "" {
+		c.Header("Retry-After", retryAfter)
+	}
+	c.JSON(status, types.NewErrorResponse(status, errorMsg, err, fallback))
+}
+
+// ProvisionVolumeV2 handles v2 provisioning requests. Unlike v1, the correlation ID
+// may be passed in the X-Correlation-ID header, is returned with the job ID, and
+// failures to start a job are reported with a status matching their error code.
+func (h *Handler) ProvisionVolumeV2(c *gin.Context) {
+	var req types.ProvisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err, &req))
+		return
+	}
+
+	if req.CorrelationID == "" {
+		req.CorrelationID = c.GetHeader(correlationIDHeader)
+	}
+
+	// Image URL and size may instead come from a profile; blank volumes have no image
+	if req.Profile == "" && ((req.NeedsImage() && req.ImageURL == "") || !req.HasSize()) {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:     "invalid request",
+			Message:   "image_url and a volume size are required unless a profile is given, and image_url unless type is blank",
+			Code:      400,
+			ErrorCode: types.ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	req.Identity = auth.Identity(c)
+	if err := h.tenants.Check(req.Identity, req.VolumeName); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+	jobID, err := h.jobManager.StartJob(req)
+	if err != nil {
+		jobsTotal.WithLabelValues("failed", identityLabel(req.Identity)).Inc()
+		abortWithError(c, "failed to start provisioning", err, types.ErrCodeInternal)
+		return
+	}
+
+	jobsTotal.WithLabelValues("started", identityLabel(req.Identity)).Inc()
+
+	correlationID := req.CorrelationID
+	if correlationID == "" {
+		correlationID = jobID
+	}
+	c.Header(correlationIDHeader, correlationID)
+	c.JSON(http.StatusAccepted, types.ProvisionResponse{
+		JobID:         jobID,
+		CorrelationID: correlationID,
+	})
+}
+
+// GetJobStatusV2 returns the status of a provisioning job, including stage timings.
+// As in v1, ?wait=30s waits for the job's state or stage to change first.
+func (h *Handler) GetJobStatusV2(c *gin.Context) {
+	wait, err := parseStatusWait(c.Query("wait"))
+	if err != nil {
+		abortWithError(c, "invalid request", err, types.ErrCodeInvalidRequest)
+		return
+	}
+
+	if err := h.checkJobTenant(c, c.Param("job_id")); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+	status, err := h.waitForJobStatus(c, c.Param("job_id"), wait)
+	if err != nil {
+		abortWithError(c, "job not found", err, types.ErrCodeJobNotFound)
+		return
+	}
+
+	if status.CorrelationID != "" {
+		c.Header(correlationIDHeader, status.CorrelationID)
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// CancelJobV2 cancels a running provisioning job, responding with 409 Conflict
+// if the job has already finished
+func (h *Handler) CancelJobV2(c *gin.Context) {
+	jobID := c.Param("job_id")
+	if err := h.checkJobTenant(c, jobID); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+	if err := h.jobManager.CancelJob(jobID); err != nil {
+		abortWithError(c, "failed to cancel job", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "cancelled",
+		"job_id": jobID,
+	})
+}
+
+// ListJobs returns a page of the job history. It is only served under /api/v2.
+func (h *Handler) ListJobs(c *gin.Context) {
+	var req types.JobListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err, &req))
+		return
+	}
+	prefix, err := h.tenants.Confine(auth.Identity(c), req.VolumeNamePrefix)
+	if err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+	req.VolumeNamePrefix = prefix
+
+	jobs, err := h.jobManager.ListJobs(req)
+	if err != nil {
+		abortWithError(c, "failed to list jobs", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// ListCachedImages returns the images held in the image cache pools. It is only served under /api/v2.
+func (h *Handler) ListCachedImages(c *gin.Context) {
+	images, err := h.jobManager.ListCachedImages()
+	if err != nil {
+		abortWithError(c, "failed to list cached images", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.CacheListResponse{Images: images})
+}
+
+// ListVolumes returns the LVM volumes in the volume group. It is only served under /api/v2.
+func (h *Handler) ListVolumes(c *gin.Context) {
+	volumes, err := h.jobManager.ListVolumes()
+	if err != nil {
+		abortWithError(c, "failed to list volumes", err, types.ErrCodeInternal)
+		return
+	}
+	volumes = tenantVolumes(h.tenants, auth.Identity(c), volumes, func(v types.Volume) string { return v.Name })
+
+	c.JSON(http.StatusOK, types.VolumeListResponse{Volumes: volumes})
+}
+
+// ListCleanups returns the volumes of failed jobs whose rollback failed, waiting
+// to be deleted in the background. It is only served under /api/v2.
+func (h *Handler) ListCleanups(c *gin.Context) {
+	cleanups, err := h.jobManager.ListCleanups()
+	if err != nil {
+		abortWithError(c, "failed to list pending cleanups", err, types.ErrCodeInternal)
+		return
+	}
+	cleanups = tenantVolumes(h.tenants, auth.Identity(c), cleanups,
+		func(cleanup types.PendingCleanup) string { return cleanup.VolumeName })
+
+	c.JSON(http.StatusOK, types.CleanupListResponse{Cleanups: cleanups})
+}
+
+// GetReconciliation cross-references the volumes with libvirt domains, the volume
+// records and NetBox, reporting discrepancies. It is only served under /api/v2.
+func (h *Handler) GetReconciliation(c *gin.Context) {
+	report, err := h.jobManager.ReconcileVolumes(c.Request.Context())
+	if err != nil {
+		abortWithError(c, "failed to reconcile volumes", err, types.ErrCodeInternal)
+		return
+	}
+	identity := auth.Identity(c)
+	report.Volumes = tenantVolumes(h.tenants, identity, report.Volumes,
+		func(volume types.ReconciledVolume) string { return volume.Name })
+	report.Findings = tenantVolumes(h.tenants, identity, report.Findings,
+		func(finding types.ReconciliationFinding) string { return finding.VolumeName })
+
+	c.JSON(http.StatusOK, report)
+}
+
+// PreviewVolumeDeletion shows what deleting a volume would remove, with a token
+// confirming the deletion. It is only served under /api/v2.
+func (h *Handler) PreviewVolumeDeletion(c *gin.Context) {
+	if err := h.tenants.Check(auth.Identity(c), c.Param("name")); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+	preview, err := h.jobManager.PreviewVolumeDeletion(c.Param("name"))
+	if err != nil {
+		abortWithError(c, "failed to preview volume deletion", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// DeleteVolume deletes a volume, given the token of a deletion preview or force.
+// It is only served under /api/v2.
+func (h *Handler) DeleteVolume(c *gin.Context) {
+	var req types.VolumeDeletionRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err, &req))
+		return
+	}
+
+	volumeName := c.Param("name")
+	if err := h.tenants.Check(auth.Identity(c), volumeName); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+	if err := h.jobManager.DeleteVolume(volumeName, req); err != nil {
+		abortWithError(c, "failed to delete volume", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "deleted",
+		"volume": volumeName,
+	})
+}
+
+// AdoptVolume records a volume created outside the provisioner, so that it can be
+// managed like the volumes the provisioner created
+func (h *Handler) AdoptVolume(c *gin.Context) {
+	var req types.VolumeAdoptionRequest
+	// The image the volume was built from is optional, and so is the body
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, bindingErrorResponse(err, &req))
+			return
+		}
+	}
+
+	volumeName := c.Param("name")
+	if err := h.tenants.Check(auth.Identity(c), volumeName); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+	volume, err := h.jobManager.AdoptVolume(volumeName, req)
+	if err != nil {
+		abortWithError(c, "failed to adopt volume", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusCreated, volume)
+}
+
+// VerifyVolume starts a job checking the integrity of a volume, whose progress and
+// outcome are reported in its job status
+func (h *Handler) VerifyVolume(c *gin.Context) {
+	volumeName := c.Param("name")
+	identity := auth.Identity(c)
+	if err := h.tenants.Check(identity, volumeName); err != nil {
+		abortWithError(c, "volume outside tenant", err, types.ErrCodeInternal)
+		return
+	}
+	resp, err := h.jobManager.VerifyVolume(volumeName, identity)
+	if err != nil {
+		abortWithError(c, "failed to start volume verification", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// GetMaintenance reports maintenance mode and provisioning windows. It is only served under /api/v2.
+func (h *Handler) GetMaintenance(c *gin.Context) {
+	status, err := h.jobManager.GetMaintenance()
+	if err != nil {
+		abortWithError(c, "failed to get maintenance status", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// SetMaintenance enters or leaves maintenance mode. While draining, new jobs are
+// rejected with 503 and running jobs finish. It is only served under /api/v2.
+func (h *Handler) SetMaintenance(c *gin.Context) {
+	var req types.MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err, &req))
+		return
+	}
+
+	if err := h.jobManager.SetMaintenance(*req.Enabled); err != nil {
+		abortWithError(c, "failed to set maintenance mode", err, types.ErrCodeInternal)
+		return
+	}
+
+	h.GetMaintenance(c)
+}
+
+// GetSettings returns the runtime settings in effect
+func (h *Handler) GetSettings(c *gin.Context) {
+	settings, err := h.jobManager.GetSettings()
+	if err != nil {
+		abortWithError(c, "failed to get settings", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings changes concurrency, download bandwidth or whether the job queue is
+// paused without a restart, for incident response. Settings omitted from the request
+// are left as they are.
+func (h *Handler) UpdateSettings(c *gin.Context) {
+	var req types.SettingsUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err, &req))
+		return
+	}
+
+	settings, err := h.jobManager.UpdateSettings(req)
+	if err != nil {
+		abortWithError(c, "failed to update settings", err, types.ErrCodeInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
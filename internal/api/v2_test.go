@@ -0,0 +1,510 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/auth"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingJobManager reports unknown jobs and finished jobs that cannot be cancelled
+type failingJobManager struct {
+	MockJobManager
+}
+
+func (m *failingJobManager) GetJobStatus(jobID string) (*types.StatusResponse, error) {
+	return nil, types.NewError(types.ErrCodeJobNotFound, fmt.Errorf("job not found: %s", jobID), nil)
+}
+
+func (m *failingJobManager) CancelJob(_ string) error {
+	return types.NewError(types.ErrCodeJobNotCancellable, fmt.Errorf("job cannot be cancelled: completed"), nil)
+}
+
+func (m *failingJobManager) ResumeJob(_ string) error {
+	return types.NewError(types.ErrCodeJobNotPaused, fmt.Errorf("job is not paused: running"), nil)
+}
+
+func (m *failingJobManager) StartJob(_ types.ProvisionRequest) (string, error) {
+	return "", types.NewError(types.ErrCodeQueueFull, fmt.Errorf("job queue is full with 20 jobs waiting to start"),
+		map[string]string{"queue_depth": "20", "retry_after": "45"})
+}
+
+func newTestRouter(jobManager JobManager, sunset time.Time) *gin.Engine {
+	router := gin.New()
+	handler := NewHandler(jobManager, "test-version")
+	handler.SetV1Sunset(sunset)
+	SetupRoutes(router, handler, func(c *gin.Context) { c.Next() })
+	return router
+}
+
+func TestV1DeprecationHeaders(t *testing.T) {
+	router := newTestRouter(&MockJobManager{}, time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/v1/capacity", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "@1792108800", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Thu, 01 Apr 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, `</api/v2>; rel="successor-version"`, w.Header().Get("Link"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/v2/capacity", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+}
+
+func TestProvisionVolumeV2_CorrelationID(t *testing.T) {
+	mockManager := &MockJobManager{}
+	router := newTestRouter(mockManager, time.Time{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/api/v2/provision",
+		bytes.NewBufferString(`{"image_url": "https://minio/images/a.qcow2", "volume_name": "vm", "volume_size_gb": 10,
+			"identity": "cert:someone-else"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Correlation-ID", "order-42")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "order-42", mockManager.lastRequest.CorrelationID)
+	// The identity comes from the credentials, not the request body
+	assert.Equal(t, auth.IdentityAnonymous, mockManager.lastRequest.Identity)
+	assert.Equal(t, "order-42", w.Header().Get("X-Correlation-ID"))
+	assert.Contains(t, w.Body.String(), `"correlation_id":"order-42"`)
+}
+
+func TestV2ErrorStatusCodes(t *testing.T) {
+	router := newTestRouter(&failingJobManager{}, time.Time{})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{http.MethodGet, "/api/v2/status/missing", http.StatusNotFound},
+		{http.MethodDelete, "/api/v2/cancel/done", http.StatusConflict},
+		{http.MethodPost, "/api/v2/jobs/running/resume", http.StatusConflict},
+		{http.MethodPost, "/api/v1/jobs/running/resume", http.StatusConflict},
+		{http.MethodPost, "/api/v2/jobs/running/pause", http.StatusOK},
+		// v1 keeps its original status codes
+		{http.MethodDelete, "/api/v1/cancel/done", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), tt.method, tt.path, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.path)
+	}
+}
+
+func TestProvisionQueueFull(t *testing.T) {
+	router := newTestRouter(&failingJobManager{}, time.Time{})
+
+	// Both versions report a full queue with 429, for clients to back off or submit elsewhere
+	for _, path := range []string{"/api/v1/provision", "/api/v2/provision"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, path,
+			bytes.NewBufferString(`{"image_url": "https://minio/images/a.qcow2", "volume_name": "vm", "volume_size_gb": 10}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, path)
+		assert.Equal(t, "45", w.Header().Get("Retry-After"), path)
+		assert.Contains(t, w.Body.String(), `"error_code":"QUEUE_FULL"`, path)
+	}
+}
+
+func TestListJobs(t *testing.T) {
+	jobManager := &MockJobManager{}
+	router := newTestRouter(jobManager, time.Time{})
+
+	tests := []struct {
+		query    string
+		code     int
+		contains string
+	}{
+		{"?sort=created_at&order=asc&since=2026-10-01T00:00:00Z&limit=10", http.StatusOK, `"next_cursor":"next-created_at"`},
+		{"?sort=size", http.StatusBadRequest, `"sort":"oneof"`},
+		{"?limit=5000", http.StatusBadRequest, `"limit":"max"`},
+		{"?since=yesterday", http.StatusBadRequest, "INVALID_REQUEST"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/v2/jobs"+tt.query, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.query)
+		assert.Contains(t, w.Body.String(), tt.contains, tt.query)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet,
+		"/api/v2/jobs?label=env%3Dprod&label=tenant%3Dacme", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"env=prod", "tenant=acme"}, jobManager.lastListJobs.Labels)
+
+	// Job listing is not available under the deprecated v1 API
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/v1/jobs", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCancelJobs(t *testing.T) {
+	jobManager := &MockJobManager{}
+	router := newTestRouter(jobManager, time.Time{})
+
+	tests := []struct {
+		path     string
+		body     string
+		code     int
+		contains string
+	}{
+		{"/api/v1/jobs/cancel", `{"correlation_id_prefix":"rollout-42","older_than":"15m"}`, http.StatusOK,
+			`"cancelled":["job-1","job-2"]`},
+		{"/api/v2/jobs/cancel", `{"status":"paused"}`, http.StatusOK, `"cancelled"`},
+		{"/api/v2/jobs/cancel", `{"status":"completed"}`, http.StatusBadRequest, `"status":"oneof"`},
+		{"/api/v2/jobs/cancel", `{}`, http.StatusBadRequest, "requires a filter, or all"},
+		{"/api/v2/jobs/cancel", `{"older_than":"-5m"}`, http.StatusBadRequest, "INVALID_REQUEST"},
+		{"/api/v2/jobs/cancel", `{"all":true}`, http.StatusOK, `"cancelled"`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.body)
+		assert.Contains(t, w.Body.String(), tt.contains, tt.body)
+	}
+	assert.True(t, jobManager.lastBulkCancel.All)
+}
+
+func TestListCachedImagesAndVolumes(t *testing.T) {
+	router := newTestRouter(&MockJobManager{}, time.Time{})
+
+	tests := []struct {
+		path     string
+		contains string
+	}{
+		{"/api/v2/cache", `"checksum":"abc123"`},
+		{"/api/v2/volumes", `"device_path":"/dev/data/vm01-root"`},
+		{"/api/v2/cleanups", `"last_error":"lvremove failed: exit status 5"`},
+		{"/api/v2/reconciliation", `"kind":"size_mismatch"`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tt.path, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, tt.path)
+		assert.Contains(t, w.Body.String(), tt.contains, tt.path)
+	}
+}
+
+func TestListImageVolumes(t *testing.T) {
+	router := newTestRouter(&MockJobManager{}, time.Time{})
+	checksum := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/api/v1/images/" + checksum + "/volumes", http.StatusOK},
+		{"/api/v2/images/" + strings.ToUpper(checksum) + "/volumes?include_deleted=true", http.StatusOK},
+		{"/api/v2/images/abc123/volumes", http.StatusBadRequest},
+		{"/api/v2/images/" + checksum + "/volumes?include_deleted=maybe", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tt.path, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.path)
+		if tt.code == http.StatusOK {
+			var resp types.ImageVolumesResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, checksum, resp.Checksum)
+			assert.Len(t, resp.Volumes, 1)
+		}
+	}
+}
+
+func TestDeleteVolume(t *testing.T) {
+	mockManager := &MockJobManager{}
+	router := newTestRouter(mockManager, time.Time{})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{http.MethodPost, "/api/v2/volumes/vm01-root/deletion-preview", http.StatusOK},
+		{http.MethodPost, "/api/v2/volumes/vm10-root/deletion-preview", http.StatusNotFound},
+		{http.MethodDelete, "/api/v2/volumes/vm01-root", http.StatusPreconditionRequired},
+		{http.MethodDelete, "/api/v2/volumes/vm01-root?token=typo", http.StatusPreconditionRequired},
+		{http.MethodDelete, "/api/v2/volumes/vm01-root?token=token", http.StatusOK},
+		{http.MethodDelete, "/api/v2/volumes/vm02-root?force=true", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), tt.method, tt.path, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.path)
+	}
+	assert.Equal(t, []string{"vm01-root", "vm02-root"}, mockManager.deletedVolumes)
+}
+
+func TestAdoptVolume(t *testing.T) {
+	mockManager := &MockJobManager{}
+	router := newTestRouter(mockManager, time.Time{})
+	checksum := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/api/v1/volumes/vm01-root/adopt", "", http.StatusCreated},
+		{"/api/v2/volumes/vm01-root/adopt", `{"image_url": "https://minio/a.qcow2", "image_checksum": "` + checksum + `"}`,
+			http.StatusCreated},
+		{"/api/v2/volumes/vm01-root/adopt", `{"image_checksum": "abc123"}`, http.StatusBadRequest},
+		{"/api/v2/volumes/vm02-root/adopt", "{}", http.StatusConflict},
+		{"/api/v2/volumes/vm10-root/adopt", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.path+" "+tt.body)
+	}
+	assert.Equal(t, checksum, mockManager.lastAdoption.ImageChecksum)
+}
+
+func TestVerifyVolume(t *testing.T) {
+	router := newTestRouter(&MockJobManager{}, time.Time{})
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/api/v1/volumes/vm01-root/verify", http.StatusAccepted},
+		{"/api/v2/volumes/vm01-root/verify", http.StatusAccepted},
+		{"/api/v2/volumes/vm02-root/verify", http.StatusUnprocessableEntity},
+		{"/api/v2/volumes/vm10-root/verify", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, tt.path, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.path)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/api/v1/volumes/vm01-root/verify", nil)
+	router.ServeHTTP(w, req)
+	var resp types.VerifyVolumeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "verify-job", resp.JobID)
+	assert.Equal(t, types.VerifyMethodChecksum, resp.Method)
+}
+
+func TestTenants(t *testing.T) {
+	mockManager := &MockJobManager{}
+	tenants, err := auth.ParseTenants(auth.IdentityAnonymous+"=vm01-", false)
+	require.NoError(t, err)
+	router := gin.New()
+	handler := NewHandler(mockManager, "test-version")
+	handler.SetTenants(tenants)
+	SetupRoutes(router, handler, func(c *gin.Context) { c.Next() })
+
+	provision := func(volumeName string) string {
+		return fmt.Sprintf(`{"image_url": "https://minio/a.qcow2", "volume_name": %q, "volume_size_gb": 10}`, volumeName)
+	}
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{http.MethodPost, "/api/v1/provision", provision("vm02-root"), http.StatusForbidden},
+		{http.MethodPost, "/api/v2/provision", provision("vm02-root"), http.StatusForbidden},
+		{http.MethodPost, "/api/v2/provision", provision("vm01-root"), http.StatusAccepted},
+		{http.MethodPost, "/api/v2/volumes/vm02-root/deletion-preview", "", http.StatusForbidden},
+		{http.MethodDelete, "/api/v2/volumes/vm02-root?force=true", "", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/volumes/vm02-root/adopt", "", http.StatusForbidden},
+		{http.MethodPost, "/api/v2/volumes/vm02-root/verify", "", http.StatusForbidden},
+		{http.MethodDelete, "/api/v2/volumes/vm01-root?force=true", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.path)
+		if tt.code == http.StatusForbidden {
+			assert.Contains(t, w.Body.String(), `"error_code":"VOLUME_OUTSIDE_TENANT"`, tt.path)
+		}
+	}
+	assert.Equal(t, "vm01-root", mockManager.lastRequest.VolumeName)
+	assert.Equal(t, []string{"vm01-root"}, mockManager.deletedVolumes)
+
+	// Other tenants' volumes are not listed
+	tenants, err = auth.ParseTenants(auth.IdentityAnonymous+"=vm02-", false)
+	require.NoError(t, err)
+	handler.SetTenants(tenants)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/v2/volumes", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"volumes":[]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/v2/cleanups", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"cleanups":[]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/v2/reconciliation", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"volume_name":"vm02-root"`)
+	assert.NotContains(t, w.Body.String(), "vm01-root")
+}
+
+func TestTenantJobs(t *testing.T) {
+	mockManager := &MockJobManager{jobVolume: "vm02-root"}
+	tenants, err := auth.ParseTenants(auth.IdentityAnonymous+"=vm01-", false)
+	require.NoError(t, err)
+	router := gin.New()
+	handler := NewHandler(mockManager, "test-version")
+	handler.SetTenants(tenants)
+	SetupRoutes(router, handler, func(c *gin.Context) { c.Next() })
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Other tenants' jobs can be neither seen nor controlled
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/status/job-1"},
+		{http.MethodGet, "/api/v2/status/job-1"},
+		{http.MethodDelete, "/api/v1/cancel/job-1"},
+		{http.MethodDelete, "/api/v2/cancel/job-1"},
+		{http.MethodPost, "/api/v2/jobs/job-1/pause"},
+		{http.MethodPost, "/api/v2/jobs/job-1/resume"},
+	} {
+		w := serve(tt.method, tt.path, "")
+		assert.Equal(t, http.StatusForbidden, w.Code, tt.path)
+		assert.Contains(t, w.Body.String(), `"error_code":"VOLUME_OUTSIDE_TENANT"`, tt.path)
+	}
+	mockManager.jobVolume = "vm01-root"
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "/api/v2/cancel/job-1", "").Code)
+
+	// Bulk cancellations and listings only reach the tenant's jobs
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/v2/jobs/cancel", `{}`).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/v2/jobs/cancel", `{"all": true}`).Code)
+	assert.Equal(t, "vm01-", mockManager.lastBulkCancel.VolumeNamePrefix)
+	assert.Equal(t, http.StatusForbidden,
+		serve(http.MethodPost, "/api/v2/jobs/cancel", `{"volume_name_prefix": "vm02-"}`).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v2/jobs", "").Code)
+	assert.Equal(t, "vm01-", mockManager.lastListJobs.VolumeNamePrefix)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v2/jobs?volume_name_prefix=vm01-web", "").Code)
+	assert.Equal(t, "vm01-web", mockManager.lastListJobs.VolumeNamePrefix)
+
+	// Clients without a tenant may use no volume
+	tenants, err = auth.ParseTenants("cert:team-a=vm01-", false)
+	require.NoError(t, err)
+	handler.SetTenants(tenants)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v2/jobs", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodDelete, "/api/v2/cancel/job-1", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/api/v2/provision",
+		`{"image_url": "https://minio/a.qcow2", "volume_name": "vm01-root", "volume_size_gb": 10}`).Code)
+}
+
+func TestMaintenance(t *testing.T) {
+	mockManager := &MockJobManager{}
+	router := newTestRouter(mockManager, time.Time{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPut, "/api/v2/admin/maintenance",
+		bytes.NewBufferString(`{"enabled":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, mockManager.maintenance)
+	assert.Contains(t, w.Body.String(), `"maintenance":true`)
+
+	// enabled is required, so an empty body cannot accidentally leave maintenance mode
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(context.Background(), http.MethodPut, "/api/v2/admin/maintenance",
+		bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, mockManager.maintenance)
+
+	assert.Equal(t, http.StatusServiceUnavailable, statusForCode(types.ErrCodeMaintenance))
+}
+
+func TestSettings(t *testing.T) {
+	mockManager := &MockJobManager{settings: types.RuntimeSettings{DownloadConcurrency: 2, DiskConcurrency: 2}}
+	router := newTestRouter(mockManager, time.Time{})
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		code     int
+		contains string
+	}{
+		{http.MethodGet, "/api/v1/admin/settings", "", http.StatusOK, `"download_concurrency":2`},
+		{http.MethodPatch, "/api/v1/admin/settings", `{"queue_paused":true}`, http.StatusOK, `"queue_paused":true`},
+		{http.MethodPatch, "/api/v2/admin/settings", `{"download_concurrency":1}`, http.StatusOK,
+			`"download_concurrency":1`},
+		{http.MethodPatch, "/api/v2/admin/settings", `{"disk_concurrency":0}`, http.StatusBadRequest,
+			`"disk_concurrency":"min"`},
+		{http.MethodPatch, "/api/v2/admin/settings", `{"download_bytes_per_sec":-1}`, http.StatusBadRequest,
+			`"download_bytes_per_sec":"min"`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.body)
+		assert.Contains(t, w.Body.String(), tt.contains, tt.body)
+	}
+	assert.True(t, mockManager.settings.QueuePaused)
+	assert.Equal(t, 2, mockManager.settings.DiskConcurrency)
+}
@@ -3,14 +3,23 @@
 package auth
 
 import (
-	"crypto/tls"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/x509"
 	"fmt"
+	"math"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
 )
 
 // Validator handles authentication validation
@@ -18,6 +27,29 @@ type Validator struct {
 	clientCAs      *x509.CertPool
 	clientCALoaded bool            // Whether client CA certificates were loaded
 	apiTokens      map[string]bool // Simple token validation
+	tokenHashes    []string        // argon2id or bcrypt hashes of further tokens
+	policies       []RoutePolicy   // Most specific prefix first
+	lockout        *lockout        // Nil if sources are never locked out
+	failureDelay   time.Duration   // Delay before rejecting an invalid token
+
+	verifiedMu sync.Mutex
+	verified   map[[sha256.Size]byte]bool // Digests of tokens that matched a hash
+}
+
+// localConnectionKey marks the context of connections to the local Unix socket
+type localConnectionKey struct{}
+
+// LocalConnContext marks a connection as local, for use as the ConnContext of the
+// server listening on the Unix socket. Requests on local connections need no
+// token or certificate: the socket's file permissions decide who may connect.
+func LocalConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, localConnectionKey{}, true)
+}
+
+// isLocal reports whether a request was received on the local Unix socket
+func isLocal(c *gin.Context) bool {
+	local, _ := c.Request.Context().Value(localConnectionKey{}).(bool)
+	return local
 }
 
 // NewValidator creates a new authentication validator
@@ -38,6 +70,16 @@ func NewValidator() (*Validator, error) {
 		return nil, fmt.Errorf("failed to load API tokens: %w", err)
 	}
 
+	// Load brute-force protection settings
+	if err = validator.loadLockout(); err != nil {
+		return nil, fmt.Errorf("failed to configure authentication lockout: %w", err)
+	}
+
+	// Load route policies
+	if err = validator.loadPolicies(); err != nil {
+		return nil, fmt.Errorf("failed to load route policies: %w", err)
+	}
+
 	return validator, nil
 }
 
@@ -88,62 +130,185 @@ func (v *Validator) loadAPITokens() error {
 		return fmt.Errorf("failed to read API tokens: %w", err)
 	}
 
-	// Simple token list (one per line)
+	// Simple token list (one per line); lines may instead hold argon2id or bcrypt hashes
 	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
+	plaintext := 0
+	for i, line := range lines {
 		token := strings.TrimSpace(line)
-		if token != "" {
+		switch {
+		case token == "":
+		case isTokenHash(token):
+			if err := checkTokenHash(token); err != nil {
+				return fmt.Errorf("invalid token hash on line %d of %s: %w", i+1, tokenFile, err)
+			}
+			v.tokenHashes = append(v.tokenHashes, token)
+		default:
 			v.apiTokens[token] = true
+			plaintext++
 		}
 	}
+	if plaintext > 0 {
+		logrus.WithFields(logrus.Fields{
+			"file":   tokenFile,
+			"tokens": plaintext,
+		}).Warn("API tokens file contains plaintext tokens, replace them with hashes from the hash-token command")
+	}
 
 	return nil
 }
 
-// Middleware returns Gin middleware for authentication
+// Middleware returns Gin middleware for authentication. Each route requires an
+// API token or client certificate unless a route policy says otherwise.
 func (v *Validator) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Check for API token in header
-		if v.validateAPIToken(c) {
+		// Access to the Unix socket is controlled by its file permissions
+		if isLocal(c) {
 			c.Next()
 			return
 		}
 
-		// Check for client certificate
-		if tlsConn, ok := c.Request.Context().Value("tls-conn").(*tls.Conn); ok {
-			if len(tlsConn.ConnectionState().PeerCertificates) > 0 {
-				// Certificate validation is handled by TLS config
-				c.Next()
+		policy := v.policyFor(c.Request.URL.Path)
+		if hasClientCertificate(c) {
+			c.Set(identityKey, certificateIdentity(c.Request.TLS.VerifiedChains[0][0]))
+			c.Next()
+			return
+		}
+
+		// A source that guessed too many tokens is refused, even if its next guess is right.
+		// The peer address is used rather than forwarding headers, which clients control.
+		token := requestToken(c)
+		source := c.RemoteIP()
+		if token != "" && policy != PolicyOpen {
+			if wait := v.lockout.lockedFor(source); wait > 0 {
+				authFailuresTotal.WithLabelValues(reasonLockedOut).Inc()
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, types.ErrorResponse{
+					Error:   "too many failed authentication attempts",
+					Message: "authentication from this address is temporarily blocked, retry later",
+					Code:    http.StatusTooManyRequests,
+				})
 				return
 			}
 		}
 
-		// No valid authentication found
-		c.AbortWithStatusJSON(401, types.ErrorResponse{
-			Error:   "authentication required",
-			Message: "provide valid API token or client certificate",
-			Code:    401,
-		})
+		switch {
+		case v.validateAPIToken(c):
+			v.lockout.succeed(source)
+			if policy == PolicyCertificate {
+				authFailuresTotal.WithLabelValues(reasonCertificateRequired).Inc()
+				c.AbortWithStatusJSON(http.StatusForbidden, types.ErrorResponse{
+					Error:   "client certificate required",
+					Message: "this endpoint does not accept API tokens, provide a client certificate",
+					Code:    http.StatusForbidden,
+				})
+				return
+			}
+			c.Set(identityKey, tokenIdentity(token))
+		case policy == PolicyOpen:
+		case token != "":
+			v.rejectToken(c, source)
+			return
+		default:
+			// No valid authentication found
+			authFailuresTotal.WithLabelValues(reasonMissingCredentials).Inc()
+			c.AbortWithStatusJSON(http.StatusUnauthorized, types.ErrorResponse{
+				Error:   "authentication required",
+				Message: "provide valid API token or client certificate",
+				Code:    http.StatusUnauthorized,
+			})
+			return
+		}
+		c.Next()
 	}
 }
 
-// validateAPIToken validates API token from Authorization or X-API-Token headers
+// rejectToken rejects a request with an invalid API token after the failure
+// delay, which slows down guessing, and locks the source out if it has failed
+// too often
+func (v *Validator) rejectToken(c *gin.Context, source string) {
+	authFailuresTotal.WithLabelValues(reasonInvalidToken).Inc()
+	if v.lockout.fail(source) {
+		logrus.WithFields(logrus.Fields{
+			"source":   source,
+			"duration": v.lockout.duration,
+		}).Warn("Locking out source after repeated failed authentication attempts")
+	}
+
+	if v.failureDelay > 0 {
+		select {
+		case <-time.After(v.failureDelay):
+		case <-c.Request.Context().Done():
+		}
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, types.ErrorResponse{
+		Error:   "authentication required",
+		Message: "provide valid API token or client certificate",
+		Code:    http.StatusUnauthorized,
+	})
+}
+
+// hasClientCertificate reports whether the client presented a certificate that
+// was verified against the client CAs during the TLS handshake
+func hasClientCertificate(c *gin.Context) bool {
+	return c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0
+}
+
+// validateAPIToken validates API token from Authorization or X-API-Token headers.
+// Every configured token is compared in constant time, by digest so that not even
+// the token's length leaks through timing.
 func (v *Validator) validateAPIToken(c *gin.Context) bool {
+	token := requestToken(c)
+	if token == "" {
+		return false
+	}
+	digest := sha256.Sum256([]byte(token))
+	valid := 0
+	for candidate := range v.apiTokens {
+		candidateDigest := sha256.Sum256([]byte(candidate))
+		valid |= subtle.ConstantTimeCompare(digest[:], candidateDigest[:])
+	}
+	return valid == 1 || v.validateHashedToken(token, digest)
+}
+
+// validateHashedToken checks a token against the hashed tokens. Hashing is slow by
+// design, so tokens that matched are remembered by their digest.
+func (v *Validator) validateHashedToken(token string, digest [sha256.Size]byte) bool {
+	if len(v.tokenHashes) == 0 {
+		return false
+	}
+	v.verifiedMu.Lock()
+	known := v.verified[digest]
+	v.verifiedMu.Unlock()
+	if known {
+		return true
+	}
+
+	for _, hash := range v.tokenHashes {
+		if verifyTokenHash(hash, token) {
+			v.verifiedMu.Lock()
+			if v.verified == nil {
+				v.verified = make(map[[sha256.Size]byte]bool)
+			}
+			v.verified[digest] = true
+			v.verifiedMu.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+// requestToken returns the API token sent in the Authorization header, or else in
+// the X-API-Token header
+func requestToken(c *gin.Context) string {
 	authHeader := c.GetHeader("Authorization")
 
 	// Check for Bearer token in Authorization header
 	if authHeader != "" && len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		token := authHeader[7:]
-		return v.apiTokens[token]
+		return authHeader[7:]
 	}
 
 	// Check for X-API-Token header
-	token := c.GetHeader("X-API-Token")
-	if token != "" {
-		return v.apiTokens[token]
-	}
-
-	return false
+	return c.GetHeader("X-API-Token")
 }
 
 // GetClientCAs returns the client CA certificate pool
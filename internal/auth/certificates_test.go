@@ -1,7 +1,10 @@
 package auth
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -125,3 +128,72 @@ func TestValidateAPIToken(t *testing.T) {
 		})
 	}
 }
+
+func TestMiddleware_LocalConnection(t *testing.T) {
+	validator := &Validator{apiTokens: map[string]bool{"valid-token": true}}
+	router := gin.New()
+	router.Use(validator.Middleware())
+	router.GET("/api/v2/jobs", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// Requests on the Unix socket need no token
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/jobs", nil)
+	req = req.WithContext(LocalConnContext(req.Context(), nil))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Other requests still do
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/jobs", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestMiddleware_Policies(t *testing.T) {
+	validator := &Validator{
+		apiTokens: map[string]bool{"valid-token": true},
+		policies: []RoutePolicy{
+			{Prefix: "/api/v2/admin/", Policy: PolicyCertificate},
+			{Prefix: "/api/v2/capacity", Policy: PolicyOpen},
+		},
+	}
+	router := gin.New()
+	router.Use(validator.Middleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/v2/jobs", ok)
+	router.GET("/api/v2/capacity", ok)
+	router.GET("/api/v2/admin/maintenance", ok)
+
+	verified := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{}},
+		VerifiedChains:   [][]*x509.Certificate{{{}}},
+	}
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		tlsState   *tls.ConnectionState
+		wantStatus int
+	}{
+		{"no credentials", "/api/v2/jobs", "", nil, http.StatusUnauthorized},
+		{"token", "/api/v2/jobs", "valid-token", nil, http.StatusOK},
+		{"invalid token", "/api/v2/jobs", "invalid-token", nil, http.StatusUnauthorized},
+		{"certificate", "/api/v2/jobs", "", verified, http.StatusOK},
+		{"unverified certificate", "/api/v2/jobs", "", &tls.ConnectionState{}, http.StatusUnauthorized},
+		{"open route", "/api/v2/capacity", "", nil, http.StatusOK},
+		{"certificate-only route with certificate", "/api/v2/admin/maintenance", "", verified, http.StatusOK},
+		{"certificate-only route with token", "/api/v2/admin/maintenance", "valid-token", nil, http.StatusForbidden},
+		{"certificate-only route without credentials", "/api/v2/admin/maintenance", "", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			req.TLS = tt.tlsState
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
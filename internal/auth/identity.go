@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// identityKey is the gin context key of the authenticated client's identity
+const identityKey = "auth.identity"
+
+// Identities of clients that present no credentials of their own
+const (
+	// IdentityLocal identifies clients on the local Unix socket
+	IdentityLocal = "local"
+	// IdentityAnonymous identifies unauthenticated clients of open routes
+	IdentityAnonymous = "anonymous"
+)
+
+// tokenIDLength is the number of hex digits of a token's hash that identify it
+const tokenIDLength = 12
+
+// Identity returns the client that made a request: "cert:" and the common name
+// of its client certificate, "token:" and a hash prefix of its API token, or
+// IdentityLocal or IdentityAnonymous. Tokens themselves are never revealed.
+func Identity(c *gin.Context) string {
+	if isLocal(c) {
+		return IdentityLocal
+	}
+	if identity := c.GetString(identityKey); identity != "" {
+		return identity
+	}
+	return IdentityAnonymous
+}
+
+// certificateIdentity identifies a client by its certificate's common name, or
+// by its fingerprint if it has none
+func certificateIdentity(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return "cert:" + cert.Subject.CommonName
+	}
+	sum := sha256.Sum256(cert.Raw)
+	return "cert:sha256:" + hex.EncodeToString(sum[:])[:tokenIDLength]
+}
+
+// tokenIdentity identifies a client by a prefix of its API token's hash, which
+// is enough to tell the tokens in the tokens file apart
+func tokenIdentity(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:])[:tokenIDLength]
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentity(t *testing.T) {
+	validator := &Validator{
+		apiTokens: map[string]bool{"valid-token": true},
+		policies:  []RoutePolicy{{Prefix: "/api/v2/capacity", Policy: PolicyOpen}},
+	}
+	var identity string
+	router := gin.New()
+	router.Use(validator.Middleware())
+	handler := func(c *gin.Context) {
+		identity = Identity(c)
+		c.Status(http.StatusOK)
+	}
+	router.GET("/api/v2/jobs", handler)
+	router.GET("/api/v2/capacity", handler)
+
+	certificate := func(cn string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}, Raw: []byte("der")}
+		return &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		tlsState *tls.ConnectionState
+		local    bool
+		want     string
+	}{
+		{"certificate", "/api/v2/jobs", "", certificate("team-a"), false, "cert:team-a"},
+		{"certificate without common name", "/api/v2/jobs", "", certificate(""), false, "cert:sha256:5050d80d22ec"},
+		{"token", "/api/v2/jobs", "valid-token", nil, false, tokenIdentity("valid-token")},
+		{"local", "/api/v2/jobs", "", nil, true, IdentityLocal},
+		{"open route", "/api/v2/capacity", "", nil, false, IdentityAnonymous},
+		{"open route with token", "/api/v2/capacity", "valid-token", nil, false, tokenIdentity("valid-token")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity = ""
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("X-API-Token", tt.token)
+			}
+			if tt.local {
+				req = req.WithContext(LocalConnContext(req.Context(), nil))
+			}
+			req.TLS = tt.tlsState
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.want, identity)
+		})
+	}
+}
+
+func TestTokenIdentity(t *testing.T) {
+	identity := tokenIdentity("valid-token")
+	assert.Regexp(t, `^token:[0-9a-f]{12}$`, identity)
+	assert.NotContains(t, identity, "valid-token")
+	assert.NotEqual(t, identity, tokenIdentity("another-token"))
+}
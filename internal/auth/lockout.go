@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Defaults of the brute-force protection
+const (
+	defaultMaxFailures     = 10
+	defaultLockoutDuration = 5 * time.Minute
+	defaultFailureDelay    = 500 * time.Millisecond
+)
+
+// maxTrackedSources bounds the number of source IPs failed attempts are kept for;
+// expired entries are pruned once it is reached
+const maxTrackedSources = 10000
+
+// authFailuresTotal counts rejected requests, so credential guessing is visible
+var authFailuresTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "libvirt_volume_provisioner_auth_failures_total",
+		Help: "Total number of requests rejected by authentication, by reason",
+	},
+	[]string{"reason"},
+)
+
+func init() {
+	prometheus.MustRegister(authFailuresTotal)
+}
+
+// Reasons requests are rejected, as counted by authFailuresTotal
+const (
+	reasonMissingCredentials  = "missing_credentials"
+	reasonInvalidToken        = "invalid_token"
+	reasonCertificateRequired = "certificate_required"
+	reasonLockedOut           = "locked_out"
+)
+
+// lockout tracks failed authentication attempts per source IP and locks out
+// sources that fail too often. Failures older than the lockout duration are
+// forgotten.
+type lockout struct {
+	maxFailures int
+	duration    time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	sources map[string]*failures
+}
+
+// failures records the failed attempts of one source
+type failures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// newLockout returns a lockout after maxFailures failures, or nil if maxFailures is 0
+func newLockout(maxFailures int, duration time.Duration) *lockout {
+	if maxFailures == 0 {
+		return nil
+	}
+	return &lockout{
+		maxFailures: maxFailures,
+		duration:    duration,
+		now:         time.Now,
+		sources:     make(map[string]*failures),
+	}
+}
+
+// lockedFor returns how long a source remains locked out, or 0 if it is not
+func (l *lockout) lockedFor(source string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.sources[source]
+	if !ok {
+		return 0
+	}
+	return max(f.lockedUntil.Sub(l.now()), 0)
+}
+
+// fail records a failed attempt and reports whether the source is now locked out
+func (l *lockout) fail(source string) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	f, ok := l.sources[source]
+	if !ok || now.Sub(f.last) > l.duration {
+		if len(l.sources) >= maxTrackedSources {
+			l.prune(now)
+		}
+		f = &failures{}
+		l.sources[source] = f
+	}
+	f.count++
+	f.last = now
+	if f.count < l.maxFailures {
+		return false
+	}
+	f.count = 0
+	f.lockedUntil = now.Add(l.duration)
+	return true
+}
+
+// succeed forgets the failed attempts of a source
+func (l *lockout) succeed(source string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f, ok := l.sources[source]; ok && !f.lockedUntil.After(l.now()) {
+		delete(l.sources, source)
+	}
+}
+
+// prune removes sources that are neither locked out nor failed recently
+func (l *lockout) prune(now time.Time) {
+	for source, f := range l.sources {
+		if now.Sub(f.last) > l.duration && !f.lockedUntil.After(now) {
+			delete(l.sources, source)
+		}
+	}
+}
+
+// loadLockout configures the brute-force protection from AUTH_MAX_FAILURES,
+// AUTH_LOCKOUT_SECONDS and AUTH_FAILURE_DELAY_MS
+func (v *Validator) loadLockout() error {
+	maxFailures, err := envInt("AUTH_MAX_FAILURES", defaultMaxFailures)
+	if err != nil {
+		return err
+	}
+	lockoutSeconds, err := envInt("AUTH_LOCKOUT_SECONDS", int(defaultLockoutDuration.Seconds()))
+	if err != nil {
+		return err
+	}
+	delayMS, err := envInt("AUTH_FAILURE_DELAY_MS", int(defaultFailureDelay.Milliseconds()))
+	if err != nil {
+		return err
+	}
+	v.lockout = newLockout(maxFailures, time.Duration(lockoutSeconds)*time.Second)
+	v.failureDelay = time.Duration(delayMS) * time.Millisecond
+	return nil
+}
+
+// envInt returns the non-negative integer in an environment variable, or def if it is unset
+func envInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a non-negative integer", name, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockout(t *testing.T) {
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	l := newLockout(3, time.Minute)
+	l.now = func() time.Time { return now }
+
+	assert.False(t, l.fail("192.0.2.1"))
+	assert.False(t, l.fail("192.0.2.1"))
+	assert.Zero(t, l.lockedFor("192.0.2.1"))
+	assert.True(t, l.fail("192.0.2.1"))
+	assert.Equal(t, time.Minute, l.lockedFor("192.0.2.1"))
+	assert.Zero(t, l.lockedFor("192.0.2.2"), "other sources are not locked out")
+
+	// A success while locked out does not lift the lockout
+	l.succeed("192.0.2.1")
+	assert.Equal(t, time.Minute, l.lockedFor("192.0.2.1"))
+
+	now = now.Add(time.Minute)
+	assert.Zero(t, l.lockedFor("192.0.2.1"))
+
+	// Failures are forgotten after a success, or once they are old
+	assert.False(t, l.fail("192.0.2.2"))
+	assert.False(t, l.fail("192.0.2.2"))
+	l.succeed("192.0.2.2")
+	assert.False(t, l.fail("192.0.2.2"))
+	assert.False(t, l.fail("192.0.2.2"))
+	now = now.Add(2 * time.Minute)
+	assert.False(t, l.fail("192.0.2.2"))
+}
+
+func TestLockout_Disabled(t *testing.T) {
+	l := newLockout(0, time.Minute)
+	assert.Nil(t, l)
+	assert.False(t, l.fail("192.0.2.1"))
+	assert.Zero(t, l.lockedFor("192.0.2.1"))
+	l.succeed("192.0.2.1")
+}
+
+func TestLoadLockout(t *testing.T) {
+	t.Setenv("AUTH_MAX_FAILURES", "")
+	t.Setenv("AUTH_LOCKOUT_SECONDS", "")
+	t.Setenv("AUTH_FAILURE_DELAY_MS", "")
+	v := &Validator{}
+	require.NoError(t, v.loadLockout())
+	assert.Equal(t, defaultMaxFailures, v.lockout.maxFailures)
+	assert.Equal(t, defaultLockoutDuration, v.lockout.duration)
+	assert.Equal(t, defaultFailureDelay, v.failureDelay)
+
+	t.Setenv("AUTH_MAX_FAILURES", "0")
+	t.Setenv("AUTH_FAILURE_DELAY_MS", "0")
+	require.NoError(t, v.loadLockout())
+	assert.Nil(t, v.lockout)
+	assert.Zero(t, v.failureDelay)
+
+	t.Setenv("AUTH_LOCKOUT_SECONDS", "-1")
+	assert.Error(t, v.loadLockout())
+}
+
+func TestMiddleware_Lockout(t *testing.T) {
+	validator := &Validator{
+		apiTokens: map[string]bool{"valid-token": true},
+		lockout:   newLockout(2, time.Minute),
+	}
+	router := gin.New()
+	router.Use(validator.Middleware())
+	router.GET("/api/v2/jobs", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(token, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/jobs", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-API-Token", token)
+		// Forwarding headers do not let a client pose as another source
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request("guess-1", "192.0.2.1:40000").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("guess-2", "192.0.2.1:40001").Code)
+
+	// Even a valid token is refused while the source is locked out
+	w := request("valid-token", "192.0.2.1:40002")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, request("valid-token", "192.0.2.2:40000").Code)
+}
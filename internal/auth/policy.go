@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Policy is the authentication a route requires
+type Policy string
+
+const (
+	// PolicyOpen lets any client use a route
+	PolicyOpen Policy = "open"
+	// PolicyAny requires an API token or a client certificate
+	PolicyAny Policy = "any"
+	// PolicyCertificate requires a client certificate; tokens are not accepted
+	PolicyCertificate Policy = "certificate"
+)
+
+// RoutePolicy applies a policy to the routes whose path starts with Prefix
+type RoutePolicy struct {
+	Prefix string
+	Policy Policy
+}
+
+// ParsePolicies parses route policies of the form
+// "/api/v2/admin/=certificate,/api/v2/capacity=open"
+func ParsePolicies(s string) ([]RoutePolicy, error) {
+	var policies []RoutePolicy
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, policy, ok := strings.Cut(entry, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("invalid route policy %q, expected /path=policy", entry)
+		}
+		switch p := Policy(strings.TrimSpace(policy)); p {
+		case PolicyOpen, PolicyAny, PolicyCertificate:
+			policies = append(policies, RoutePolicy{Prefix: prefix, Policy: p})
+		default:
+			return nil, fmt.Errorf("unknown policy %q for %s, expected open, any or certificate", policy, prefix)
+		}
+	}
+
+	// The most specific prefix wins
+	sort.SliceStable(policies, func(i, j int) bool {
+		return len(policies[i].Prefix) > len(policies[j].Prefix)
+	})
+	return policies, nil
+}
+
+// loadPolicies loads the route policies from AUTH_POLICIES
+func (v *Validator) loadPolicies() error {
+	policies, err := ParsePolicies(os.Getenv("AUTH_POLICIES"))
+	if err != nil {
+		return err
+	}
+	v.policies = policies
+	return nil
+}
+
+// policyFor returns the policy of the route at path; routes without one require
+// a token or certificate
+func (v *Validator) policyFor(path string) Policy {
+	for _, p := range v.policies {
+		if strings.HasPrefix(path, p.Prefix) {
+			return p.Policy
+		}
+	}
+	return PolicyAny
+}
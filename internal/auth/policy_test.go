@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies("")
+	require.NoError(t, err)
+	assert.Empty(t, policies)
+
+	policies, err = ParsePolicies(" /api/ = any , /api/v2/admin/=certificate,/api/v2/capacity=open")
+	require.NoError(t, err)
+	assert.Equal(t, []RoutePolicy{
+		{Prefix: "/api/v2/capacity", Policy: PolicyOpen},
+		{Prefix: "/api/v2/admin/", Policy: PolicyCertificate},
+		{Prefix: "/api/", Policy: PolicyAny},
+	}, policies)
+
+	for _, invalid := range []string{"/api/v2/admin/", "api/v2=open", "/api/v2=token"} {
+		_, err := ParsePolicies(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPolicyFor(t *testing.T) {
+	policies, err := ParsePolicies("/api/=open,/api/v2/admin/=certificate")
+	require.NoError(t, err)
+	validator := &Validator{policies: policies}
+
+	assert.Equal(t, PolicyCertificate, validator.policyFor("/api/v2/admin/maintenance"))
+	assert.Equal(t, PolicyOpen, validator.policyFor("/api/v2/jobs"))
+	assert.Equal(t, PolicyAny, validator.policyFor("/ui/"))
+}
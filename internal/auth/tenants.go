@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// tenantPrefixPattern allows the characters LVM allows in volume names
+var tenantPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9+_.-]+$`)
+
+// certificateDelimiter ends the prefixes derived from certificate common names. The
+// derivation never produces it otherwise, so no derived prefix starts with another.
+const certificateDelimiter = "+"
+
+// Tenants confines clients to the volumes whose names start with their tenant's
+// prefix, so that one team's automation cannot overwrite or delete another's volumes.
+// Clients on the local Unix socket and clients mapped to "*" may use any volume;
+// other clients without a tenant may use none.
+type Tenants struct {
+	prefixes map[string]string
+	// fromCertificate derives the prefix of certificate clients without one from
+	// their certificate's common name
+	fromCertificate bool
+}
+
+// ParseTenants parses tenant prefixes of the form
+// "cert:team-a=team-a-,token:0123456789ab=team-b-,cert:admin=*", keyed by client
+// identity, where "*" lets a client use any volume. Clients may share a prefix, but
+// no prefix may start with another, as its tenant could use the other's volumes. If
+// fromCertificate is set, other certificate clients get their common name and "+".
+func ParseTenants(s string, fromCertificate bool) (*Tenants, error) {
+	tenants := &Tenants{prefixes: make(map[string]string), fromCertificate: fromCertificate}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// Identities may contain "=" only in certificate common names, so split at the last
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid tenant %q, expected identity=prefix", entry)
+		}
+		identity, prefix := strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		if identity == "" || (prefix != "*" && !tenantPrefixPattern.MatchString(prefix)) {
+			return nil, fmt.Errorf("invalid tenant %q, expected identity=prefix with a prefix of letters, "+
+				"digits, '+', '_', '.' or '-'", entry)
+		}
+		if _, ok := tenants.prefixes[identity]; ok {
+			return nil, fmt.Errorf("duplicate tenant for %s", identity)
+		}
+		if prefix == "*" {
+			prefix = "" // Any volume
+		}
+		tenants.prefixes[identity] = prefix
+	}
+
+	prefixes := make([]string, 0, len(tenants.prefixes))
+	for _, prefix := range tenants.prefixes {
+		if prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	slices.Sort(prefixes)
+	for _, prefix := range prefixes {
+		if other := tenants.overlapping(prefix); other != "" {
+			return nil, fmt.Errorf("tenant prefix %s overlaps %s: no prefix may start with another", prefix, other)
+		}
+	}
+	return tenants, nil
+}
+
+// overlapping returns a configured prefix other than prefix that starts with it, or
+// that it starts with, or "" if there is none
+func (t *Tenants) overlapping(prefix string) string {
+	for _, other := range t.prefixes {
+		if other != "" && other != prefix && (strings.HasPrefix(other, prefix) || strings.HasPrefix(prefix, other)) {
+			return other
+		}
+	}
+	return ""
+}
+
+// Enabled reports whether any client is confined to a tenant
+func (t *Tenants) Enabled() bool {
+	return t != nil && (len(t.prefixes) > 0 || t.fromCertificate)
+}
+
+// Prefix returns the prefix the volume names of a client must start with, or ""
+// if the client may use any volume. ok is false for clients without a tenant, which
+// may use no volume while tenants are configured. That includes certificate clients
+// whose derived prefix overlaps a configured one.
+func (t *Tenants) Prefix(identity string) (prefix string, ok bool) {
+	if !t.Enabled() {
+		return "", true
+	}
+	if prefix, ok := t.prefixes[identity]; ok {
+		return prefix, true
+	}
+	if name, ok := strings.CutPrefix(identity, "cert:"); ok && t.fromCertificate {
+		// Characters LVM does not allow in volume names are replaced, e.g. in "sha256:<fingerprint>",
+		// as is the delimiter
+		prefix := strings.Map(func(r rune) rune {
+			if string(r) != certificateDelimiter && tenantPrefixPattern.MatchString(string(r)) {
+				return r
+			}
+			return '-'
+		}, name) + certificateDelimiter
+		return prefix, t.overlapping(prefix) == ""
+	}
+	return "", identity == IdentityLocal
+}
+
+// Allows reports whether a client may use a volume
+func (t *Tenants) Allows(identity, volumeName string) bool {
+	prefix, ok := t.Prefix(identity)
+	return ok && strings.HasPrefix(volumeName, prefix)
+}
+
+// Confine narrows a volume name prefix filter, such as a listing's, to the volumes
+// of a client's tenant. It returns a VOLUME_OUTSIDE_TENANT error if the filter
+// selects no volume of the tenant, or the client has no tenant.
+func (t *Tenants) Confine(identity, filter string) (string, error) {
+	prefix, ok := t.Prefix(identity)
+	switch {
+	case !ok:
+		return "", types.NewError(types.ErrCodeVolumeOutsideTenant, fmt.Errorf("%s has no tenant", identity), nil)
+	case strings.HasPrefix(filter, prefix):
+		return filter, nil
+	case strings.HasPrefix(prefix, filter):
+		return prefix, nil
+	default:
+		return "", types.NewError(types.ErrCodeVolumeOutsideTenant,
+			fmt.Errorf("volumes starting with %s are outside the tenant of %s: volume names must start with %s",
+				filter, identity, prefix),
+			map[string]string{"prefix": prefix})
+	}
+}
+
+// Check returns a VOLUME_OUTSIDE_TENANT error if a client may not use a volume
+func (t *Tenants) Check(identity, volumeName string) error {
+	prefix, ok := t.Prefix(identity)
+	if !ok {
+		return types.NewError(types.ErrCodeVolumeOutsideTenant,
+			fmt.Errorf("volume %s is outside the tenant of %s: %s has no tenant", volumeName, identity, identity), nil)
+	}
+	if strings.HasPrefix(volumeName, prefix) {
+		return nil
+	}
+	return types.NewError(types.ErrCodeVolumeOutsideTenant,
+		fmt.Errorf("volume %s is outside the tenant of %s: volume names must start with %s", volumeName, identity, prefix),
+		map[string]string{"prefix": prefix})
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTenants(t *testing.T) {
+	tenants, err := ParseTenants("", false)
+	require.NoError(t, err)
+	assert.False(t, tenants.Enabled())
+	assert.False(t, (*Tenants)(nil).Enabled())
+
+	tenants, err = ParseTenants(" cert:team-a = team-a- ,token:0123456789ab=team-b-,cert:admin=*", false)
+	require.NoError(t, err)
+	assert.True(t, tenants.Enabled())
+	assertPrefix(t, tenants, "cert:team-a", "team-a-")
+	assertPrefix(t, tenants, "token:0123456789ab", "team-b-")
+	assertPrefix(t, tenants, "cert:admin", "")
+	assertPrefix(t, tenants, IdentityLocal, "")
+	_, ok := tenants.Prefix("cert:team-c")
+	assert.False(t, ok, "clients without a tenant")
+	_, ok = tenants.Prefix(IdentityAnonymous)
+	assert.False(t, ok)
+
+	// Clients may share a tenant
+	tenants, err = ParseTenants("cert:team-a=team-a-,token:0123456789ab=team-a-", false)
+	require.NoError(t, err)
+	assertPrefix(t, tenants, "token:0123456789ab", "team-a-")
+
+	for _, invalid := range []string{"cert:team-a", "=team-a-", "cert:team-a=team/a", "cert:a=a-,cert:a=b-",
+		"cert:team-a=team-a-,cert:team=team-", "cert:team=team-,cert:team-a=team-a-,cert:admin=*"} {
+		_, err := ParseTenants(invalid, false)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// assertPrefix asserts that a client's volume names must start with prefix
+func assertPrefix(t *testing.T, tenants *Tenants, identity, prefix string) {
+	t.Helper()
+	actual, ok := tenants.Prefix(identity)
+	assert.True(t, ok, identity)
+	assert.Equal(t, prefix, actual, identity)
+}
+
+func TestTenantsFromCertificate(t *testing.T) {
+	tenants, err := ParseTenants("cert:admin=*,cert:ops=infra-,cert:web=team+web-", true)
+	require.NoError(t, err)
+	assertPrefix(t, tenants, "cert:team-c", "team-c+")
+	assertPrefix(t, tenants, "cert:sha256:0123456789ab", "sha256-0123456789ab+")
+	assertPrefix(t, tenants, "cert:a+b", "a-b+")
+	assertPrefix(t, tenants, "cert:ops", "infra-")
+	assertPrefix(t, tenants, "cert:admin", "")
+	_, ok := tenants.Prefix("token:0123456789ab")
+	assert.False(t, ok)
+
+	// Derived prefixes never start with one another, e.g. "db+" and "db-a+"
+	assert.True(t, tenants.Allows("cert:db", "db+vm01-root"))
+	assert.False(t, tenants.Allows("cert:db", "db-a+vm01-root"))
+	// A derived prefix overlapping a configured one, either way, gives no tenant
+	for _, identity := range []string{"cert:team", "cert:infra-a"} {
+		_, ok := tenants.Prefix(identity)
+		assert.False(t, ok, identity)
+	}
+}
+
+func TestTenantsCheck(t *testing.T) {
+	tenants, err := ParseTenants("cert:team-a=team-a-", false)
+	require.NoError(t, err)
+
+	assert.NoError(t, tenants.Check("cert:team-a", "team-a-vm01-root"))
+	assert.NoError(t, tenants.Check(IdentityLocal, "team-b-vm01-root"))
+	assert.NoError(t, (*Tenants)(nil).Check("cert:team-a", "team-b-vm01-root"))
+
+	err = tenants.Check("cert:team-a", "team-b-vm01-root")
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeVolumeOutsideTenant, code)
+	assert.Equal(t, map[string]string{"prefix": "team-a-"}, details)
+
+	// Clients without a tenant may use no volume
+	for _, identity := range []string{"token:0123456789ab", IdentityAnonymous} {
+		code, _ := types.ErrorCodeOf(tenants.Check(identity, "team-a-vm01-root"), "")
+		assert.Equal(t, types.ErrCodeVolumeOutsideTenant, code, identity)
+		assert.False(t, tenants.Allows(identity, "team-a-vm01-root"))
+	}
+	assert.True(t, tenants.Allows("cert:team-a", "team-a-vm01-root"))
+
+	prefix, err := tenants.Confine("cert:team-a", "")
+	require.NoError(t, err)
+	assert.Equal(t, "team-a-", prefix)
+	prefix, err = tenants.Confine("cert:team-a", "team-a-web")
+	require.NoError(t, err)
+	assert.Equal(t, "team-a-web", prefix)
+	_, err = tenants.Confine("cert:team-a", "team-b-")
+	assert.Error(t, err)
+	_, err = tenants.Confine(IdentityAnonymous, "")
+	assert.Error(t, err)
+	prefix, err = tenants.Confine(IdentityLocal, "team-b-")
+	require.NoError(t, err)
+	assert.Equal(t, "team-b-", prefix)
+
+	unconfined, err := ParseTenants("", false)
+	require.NoError(t, err)
+	assert.NoError(t, unconfined.Check(IdentityAnonymous, "team-b-vm01-root"))
+}
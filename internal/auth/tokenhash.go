@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Argon2id parameters of new token hashes, the OWASP minimum for argon2id. Every
+// request with an unknown token is checked against every hash, so they are kept
+// modest; the lockout limits how often a source can make the server pay for them.
+const (
+	argon2Time    = 2
+	argon2Memory  = 19 * 1024 // KiB
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// tokenBytes is the number of random bytes in a generated token
+const tokenBytes = 32
+
+// GenerateToken returns a new random API token of 64 hex digits
+func GenerateToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken returns the argon2id hash of a token, in the PHC string format
+// "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>", for the tokens file
+func HashToken(token string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(token), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time,
+		argon2Threads, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// isTokenHash reports whether a line of the tokens file is an argon2id or bcrypt
+// hash rather than a plaintext token
+func isTokenHash(line string) bool {
+	for _, prefix := range []string{"$argon2id$", "$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// argon2Hash is a parsed argon2id hash
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2Hash parses an argon2id hash in the PHC string format
+func parseArgon2Hash(hash string) (*argon2Hash, error) {
+	// $argon2id$v=19$m=...,t=...,p=...$salt$key splits into 6 fields, the first empty
+	fields := strings.Split(hash, "$")
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version %q", fields[2])
+	}
+	h := &argon2Hash{}
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, fmt.Errorf("malformed argon2id parameters %q: %w", fields[3], err)
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(fields[4]); err != nil {
+		return nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(fields[5]); err != nil || len(h.key) == 0 {
+		return nil, fmt.Errorf("malformed argon2id key")
+	}
+	return h, nil
+}
+
+// checkTokenHash returns an error if a hash in the tokens file cannot be verified against
+func checkTokenHash(hash string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		_, err := parseArgon2Hash(hash)
+		return err
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return fmt.Errorf("malformed bcrypt hash: %w", err)
+	}
+	return nil
+}
+
+// verifyTokenHash reports whether a token matches an argon2id or bcrypt hash
+func verifyTokenHash(hash, token string) bool {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(token)) == nil
+	}
+	h, err := parseArgon2Hash(hash)
+	if err != nil {
+		return false
+	}
+	//nolint:gosec // The key length was decoded from a hash, and is far below uint32
+	candidate := argon2.IDKey([]byte(token), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(h.key, candidate) == 1
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestGenerateToken(t *testing.T) {
+	token, err := GenerateToken()
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{64}$`, token)
+
+	other, err := GenerateToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestHashToken(t *testing.T) {
+	hash, err := HashToken("valid-token")
+	require.NoError(t, err)
+	assert.Regexp(t, `^\$argon2id\$v=19\$m=19456,t=2,p=1\$[A-Za-z0-9+/]+\$[A-Za-z0-9+/]+$`, hash)
+	assert.True(t, isTokenHash(hash))
+	assert.NoError(t, checkTokenHash(hash))
+
+	assert.True(t, verifyTokenHash(hash, "valid-token"))
+	assert.False(t, verifyTokenHash(hash, "invalid-token"))
+
+	// Hashes are salted
+	other, err := HashToken("valid-token")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+}
+
+func TestVerifyTokenHash_Bcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("valid-token"), bcrypt.MinCost)
+	require.NoError(t, err)
+	assert.True(t, isTokenHash(string(hash)))
+	assert.NoError(t, checkTokenHash(string(hash)))
+	assert.True(t, verifyTokenHash(string(hash), "valid-token"))
+	assert.False(t, verifyTokenHash(string(hash), "invalid-token"))
+}
+
+func TestCheckTokenHash_Malformed(t *testing.T) {
+	for _, hash := range []string{
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdA",
+		"$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=lots$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$!!$a2V5",
+		"$2b$10$short",
+	} {
+		assert.Error(t, checkTokenHash(hash), hash)
+	}
+}
+
+func TestLoadAPITokens_Hashed(t *testing.T) {
+	hash, err := HashToken("hashed-token")
+	require.NoError(t, err)
+	tokenFile := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("plain-token\n"+hash+"\n"), 0o600))
+	t.Setenv("API_TOKENS_FILE", tokenFile)
+
+	validator := &Validator{apiTokens: make(map[string]bool)}
+	require.NoError(t, validator.loadAPITokens())
+	assert.Equal(t, map[string]bool{"plain-token": true}, validator.apiTokens)
+	assert.Equal(t, []string{hash}, validator.tokenHashes)
+
+	for _, tt := range []struct {
+		token string
+		want  bool
+	}{
+		{"plain-token", true},
+		{"hashed-token", true},
+		{"hashed-token", true}, // Remembered after the first match
+		{hash, false},
+		{"invalid-token", false},
+	} {
+		c, _ := gin.CreateTestContext(nil)
+		c.Request = &http.Request{Header: make(http.Header)}
+		c.Request.Header.Set("X-API-Token", tt.token)
+		assert.Equal(t, tt.want, validator.validateAPIToken(c), tt.token)
+	}
+	assert.Len(t, validator.verified, 1)
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte("$argon2id$v=19$broken\n"), 0o600))
+	validator = &Validator{apiTokens: make(map[string]bool)}
+	assert.ErrorContains(t, validator.loadAPITokens(), "line 1")
+}
@@ -0,0 +1,653 @@
+// Package cache provides a filesystem-based image cache for the libvirt-volume-provisioner.
+// Images are stored as plain files in one or more pool directories, keyed by SHA256 checksum,
+// and do not require a libvirt connection.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultCacheDir is the directory under which cache pools are created by default
+const DefaultCacheDir = "/var/lib/libvirt"
+
+// ErrInsufficientSpace is returned when the filesystem holding a cache pool
+// does not have room for an image plus the free space margin
+var ErrInsufficientSpace = errors.New("insufficient free space")
+
+// Entry represents a cached image
+type Entry struct {
+	Pool     string
+	Path     string
+	Size     uint64
+	Checksum string
+}
+
+// Pool represents a single image cache directory
+type Pool struct {
+	Name     string
+	Path     string
+	MaxBytes uint64 // 0 means unlimited
+}
+
+// PoolCapacity reports usage and limits for a single cache pool
+type PoolCapacity struct {
+	Name           string
+	Path           string
+	Default        bool
+	UsedBytes      uint64
+	MaxBytes       uint64
+	AvailableBytes uint64
+}
+
+// DirectoryCache caches images as plain files in one or more pool directories
+type DirectoryCache struct {
+	pools       map[string]*Pool
+	defaultPool string
+	// minFreeBytes is the free space that must remain on a pool's filesystem after a download
+	minFreeBytes uint64
+
+	// OnChange, if set, is called with the affected pool after an image is added or removed
+	OnChange func(pool *Pool)
+}
+
+// NewDirectoryCache creates a new filesystem image cache.
+// poolSpec is a comma-separated list of pool names, each optionally suffixed
+// with ":<max_gb>" to limit the cache size (e.g. "images,fast-images:200").
+// The first pool listed is used when a request does not select one.
+// Pools are subdirectories of cacheDir (DefaultCacheDir if empty).
+func NewDirectoryCache(poolSpec, cacheDir string) (*DirectoryCache, error) {
+	pools, err := ParsePoolSpec(poolSpec, cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	dc := &DirectoryCache{
+		pools:       make(map[string]*Pool, len(pools)),
+		defaultPool: pools[0].Name,
+	}
+	for _, pool := range pools {
+		dc.pools[pool.Name] = pool
+	}
+
+	return dc, nil
+}
+
+// ParsePoolSpec parses a comma-separated cache pool specification,
+// placing each pool in a subdirectory of cacheDir (DefaultCacheDir if empty)
+func ParsePoolSpec(poolSpec, cacheDir string) ([]*Pool, error) {
+	if cacheDir == "" {
+		cacheDir = DefaultCacheDir
+	}
+	if !filepath.IsAbs(cacheDir) {
+		return nil, fmt.Errorf("invalid cache directory '%s': must be an absolute path", cacheDir)
+	}
+	cacheDir = filepath.Clean(cacheDir)
+
+	var pools []*Pool
+	seen := make(map[string]bool)
+
+	for _, entry := range strings.Split(poolSpec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, limit, hasLimit := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, "/\\") || strings.Contains(name, "..") {
+			return nil, fmt.Errorf("invalid cache pool name '%s'", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate cache pool name '%s'", name)
+		}
+		seen[name] = true
+
+		pool := &Pool{
+			Name: name,
+			Path: filepath.Join(cacheDir, name),
+		}
+		if hasLimit {
+			maxGB, err := strconv.ParseUint(strings.TrimSpace(limit), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size limit for cache pool '%s': %w", name, err)
+			}
+			pool.MaxBytes = maxGB * 1024 * 1024 * 1024
+		}
+
+		pools = append(pools, pool)
+	}
+
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("no cache pools configured")
+	}
+
+	return pools, nil
+}
+
+// SetMinFreeBytes sets the free space that must remain on a pool's filesystem
+// after an image is downloaded, so downloads fail fast instead of filling it
+func (dc *DirectoryCache) SetMinFreeBytes(bytes uint64) {
+	dc.minFreeBytes = bytes
+}
+
+// Pools returns all configured pools, default pool first
+func (dc *DirectoryCache) Pools() []*Pool {
+	names := make([]string, 0, len(dc.pools))
+	for name := range dc.pools {
+		if name != dc.defaultPool {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	pools := []*Pool{dc.pools[dc.defaultPool]}
+	for _, name := range names {
+		pools = append(pools, dc.pools[name])
+	}
+	return pools
+}
+
+// getPool resolves a pool by name, falling back to the default pool when name is empty
+func (dc *DirectoryCache) getPool(poolName string) (*Pool, error) {
+	if poolName == "" {
+		poolName = dc.defaultPool
+	}
+
+	pool, exists := dc.pools[poolName]
+	if !exists {
+		return nil, fmt.Errorf("unknown cache pool: %s", poolName)
+	}
+	return pool, nil
+}
+
+// HasPool reports whether a pool name is configured. An empty name selects the default pool.
+func (dc *DirectoryCache) HasPool(poolName string) bool {
+	_, err := dc.getPool(poolName)
+	return err == nil
+}
+
+// PoolPaths returns the directories of all configured cache pools
+func (dc *DirectoryCache) PoolPaths() []string {
+	paths := make([]string, 0, len(dc.pools))
+	for _, pool := range dc.pools {
+		paths = append(paths, pool.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// IsCachePath reports whether path lies inside one of the configured cache pool directories
+func (dc *DirectoryCache) IsCachePath(path string) bool {
+	return dc.poolForPath(path) != nil
+}
+
+// poolForPath returns the cache pool containing path, or nil if none does
+func (dc *DirectoryCache) poolForPath(path string) *Pool {
+	for _, pool := range dc.pools {
+		if isWithinDir(path, pool.Path) {
+			return pool
+		}
+	}
+	return nil
+}
+
+// isWithinDir reports whether path is a file strictly inside dir
+func isWithinDir(path, dir string) bool {
+	if !filepath.IsAbs(path) {
+		return false
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// notifyChange invokes the OnChange hook for the pool containing path
+func (dc *DirectoryCache) notifyChange(path string) {
+	if dc.OnChange == nil {
+		return
+	}
+	if pool := dc.poolForPath(path); pool != nil {
+		dc.OnChange(pool)
+	}
+}
+
+// AllocateImageFile allocates a file path for caching an image.
+// Images are stored as plain files, which preserves compression in QCOW2 images.
+// sizeBytes is checked against the pool's size limit and the free space of its
+// filesystem; pass 0 if the size is unknown.
+func (dc *DirectoryCache) AllocateImageFile(poolName, imageName string, sizeBytes uint64) (string, error) {
+	pool, err := dc.getPool(poolName)
+	if err != nil {
+		return "", err
+	}
+
+	// Ensure cache directory exists
+	if err := os.MkdirAll(pool.Path, 0o750); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Enforce the per-pool size limit
+	if pool.MaxBytes > 0 {
+		used, err := directorySize(pool.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to determine cache pool usage: %w", err)
+		}
+		if used+sizeBytes > pool.MaxBytes {
+			return "", fmt.Errorf("cache pool %s is full: %d bytes used, %d bytes requested, limit %d bytes",
+				pool.Name, used, sizeBytes, pool.MaxBytes)
+		}
+	}
+
+	// Refuse downloads that would fill the filesystem, which is often shared with libvirt's pools
+	available, err := FilesystemAvailable(pool.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine free space of cache pool %s: %w", pool.Name, err)
+	}
+	if sizeBytes > available || available-sizeBytes < dc.minFreeBytes {
+		return "", fmt.Errorf("%w in cache pool %s: %d bytes available, %d bytes requested, %d bytes must remain free",
+			ErrInsufficientSpace, pool.Name, available, sizeBytes, dc.minFreeBytes)
+	}
+
+	// Return the full path where the image file will be stored
+	imagePath := filepath.Join(pool.Path, imageName)
+	return imagePath, nil
+}
+
+// CheckCache checks if an image is already cached by looking for a checksum file
+// containing checksum. Returns cached image metadata if found, nil if not cached, or error on failure.
+func (dc *DirectoryCache) CheckCache(poolName, checksum string) (*Entry, error) {
+	pool, err := dc.getPool(poolName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure cache directory exists
+	if err := os.MkdirAll(pool.Path, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to access cache directory: %w", err)
+	}
+
+	// Images named after their checksum are found directly
+	if !strings.ContainsAny(checksum, "/\\") {
+		entry, err := dc.checkNamedEntry(pool, checksum)
+		if err != nil || entry != nil {
+			return entry, err
+		}
+	}
+
+	// Otherwise the checksum is recorded in the "{imagePath}.sha256" file of an image named after its URL
+	entries, err := poolEntries(pool)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Checksum == checksum {
+			return &entry, nil
+		}
+	}
+	return nil, nil //nolint:nilnil // Image not cached
+}
+
+// checkNamedEntry looks for an image named after its checksum
+func (dc *DirectoryCache) checkNamedEntry(pool *Pool, checksum string) (*Entry, error) {
+	// Look for checksum file in the cache directory
+	checksumFile := filepath.Join(pool.Path, checksum+".sha256")
+
+	// Check if checksum file exists
+	if _, err := os.Stat(checksumFile); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil //nolint:nilnil // Image not cached
+		}
+		return nil, fmt.Errorf("failed to check checksum file: %w", err)
+	}
+
+	// Checksum file exists, now find the corresponding image file.
+	// Convention: checksum file is "{imagePath}.sha256", so image path is "{checksum_file_path}" minus ".sha256"
+	imagePath := strings.TrimSuffix(checksumFile, ".sha256")
+
+	// Verify image file exists
+	fileInfo, err := os.Stat(imagePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Checksum file orphaned - image was deleted
+			logrus.WithFields(logrus.Fields{
+				"checksum":      checksum,
+				"checksum_file": checksumFile,
+				"image_path":    imagePath,
+			}).Warn("Orphaned checksum file - image file missing")
+			return nil, nil //nolint:nilnil // Image not cached
+		}
+		return nil, fmt.Errorf("failed to stat image file: %w", err)
+	}
+
+	// Return cached image information
+	size := fileInfo.Size()
+	if size < 0 {
+		return nil, fmt.Errorf("invalid file size: %d", size)
+	}
+	entry := &Entry{
+		Pool:     pool.Name,
+		Path:     imagePath,
+		Size:     uint64(size),
+		Checksum: checksum,
+	}
+
+	return entry, nil
+}
+
+// Entries lists the cached images of every pool, default pool first.
+// Images without a checksum file (e.g. downloads in progress) are omitted.
+func (dc *DirectoryCache) Entries() ([]Entry, error) {
+	var entries []Entry
+	for _, pool := range dc.Pools() {
+		poolEntries, err := poolEntries(pool)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, poolEntries...)
+	}
+	return entries, nil
+}
+
+// poolEntries lists the cached images of a single pool
+func poolEntries(pool *Pool) ([]Entry, error) {
+	checksumFiles, err := filepath.Glob(filepath.Join(pool.Path, "*.sha256"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache pool %s: %w", pool.Name, err)
+	}
+	sort.Strings(checksumFiles)
+
+	var entries []Entry
+	for _, checksumFile := range checksumFiles {
+		imagePath := strings.TrimSuffix(checksumFile, ".sha256")
+		fileInfo, err := os.Stat(imagePath)
+		if err != nil || !fileInfo.Mode().IsRegular() {
+			continue // Orphaned checksum file
+		}
+
+		checksum, err := os.ReadFile(checksumFile) // #nosec G304 -- Path listed from the pool directory
+		if err != nil {
+			return nil, fmt.Errorf("failed to read checksum file: %w", err)
+		}
+
+		entries = append(entries, Entry{
+			Pool:     pool.Name,
+			Path:     imagePath,
+			Size:     uint64(max(fileInfo.Size(), 0)),
+			Checksum: strings.TrimSpace(string(checksum)),
+		})
+	}
+	return entries, nil
+}
+
+// PartialPath returns the path an image is downloaded to before it is verified.
+// Partial files have no checksum file, so they never match as a cache hit.
+func PartialPath(imagePath string) string {
+	return imagePath + ".partial"
+}
+
+// CommitImageFile atomically moves a verified partial download to its final path
+func (dc *DirectoryCache) CommitImageFile(partialPath, imagePath string) error {
+	if !dc.IsCachePath(partialPath) || !dc.IsCachePath(imagePath) {
+		return fmt.Errorf("invalid file path: %s", imagePath)
+	}
+	if err := os.Rename(partialPath, imagePath); err != nil {
+		return fmt.Errorf("failed to move downloaded image into place: %w", err)
+	}
+	return nil
+}
+
+// CreateCacheEntry creates a cache entry with checksum file
+func (dc *DirectoryCache) CreateCacheEntry(imagePath, checksum string) error {
+	checksumFile := imagePath + ".sha256"
+
+	// Write checksum to file
+	err := os.WriteFile(checksumFile, []byte(checksum), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write checksum file: %w", err)
+	}
+
+	dc.notifyChange(imagePath)
+
+	return nil
+}
+
+// CalculateChecksum calculates SHA256 checksum of a file in one of the cache pools
+func (dc *DirectoryCache) CalculateChecksum(filePath string) (string, error) {
+	// Validate path to prevent directory traversal
+	if strings.Contains(filePath, "..") || !dc.IsCachePath(filePath) {
+		return "", fmt.Errorf("invalid file path: %s", filePath)
+	}
+
+	file, err := os.Open(filePath) // #nosec G304 -- Path validated above
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for checksum: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// GetImageNameFromURL extracts a suitable volume name from the image URL
+func GetImageNameFromURL(imageURL string) string {
+	// Extract filename from URL
+	parts := strings.Split(imageURL, "/")
+	filename := parts[len(parts)-1]
+
+	// Remove file extension and sanitize
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+	name = strings.ReplaceAll(name, "-", "_")
+	name = strings.ReplaceAll(name, ".", "_")
+
+	return name
+}
+
+// Validator identifies the version of a MinIO object an image was downloaded from,
+// so that images cached without a checksum can be revalidated with a conditional request
+type Validator struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// validatorPath returns the path of the file recording an image's validator
+func validatorPath(imagePath string) string {
+	return imagePath + ".validator"
+}
+
+// SetValidator records the object version a cached image was downloaded from
+func (dc *DirectoryCache) SetValidator(imagePath string, validator Validator) error {
+	if !dc.IsCachePath(imagePath) {
+		return fmt.Errorf("invalid file path: %s", imagePath)
+	}
+	data, err := json.Marshal(validator)
+	if err != nil {
+		return fmt.Errorf("failed to encode validator: %w", err)
+	}
+	if err := os.WriteFile(validatorPath(imagePath), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write validator file: %w", err)
+	}
+	return nil
+}
+
+// Validator returns the object version a cached image was downloaded from,
+// or nil if none was recorded
+func (dc *DirectoryCache) Validator(imagePath string) (*Validator, error) {
+	if !dc.IsCachePath(imagePath) {
+		return nil, fmt.Errorf("invalid file path: %s", imagePath)
+	}
+	data, err := os.ReadFile(validatorPath(imagePath)) // #nosec G304 -- Path validated above
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil //nolint:nilnil // No validator recorded
+		}
+		return nil, fmt.Errorf("failed to read validator file: %w", err)
+	}
+
+	var validator Validator
+	if err := json.Unmarshal(data, &validator); err != nil {
+		return nil, fmt.Errorf("failed to parse validator file: %w", err)
+	}
+	return &validator, nil
+}
+
+// DeleteImage removes an image and its checksum from the cache
+func (dc *DirectoryCache) DeleteImage(imagePath string) error {
+	// Remove image file
+	if err := os.Remove(imagePath); err != nil && !os.IsNotExist(err) {
+		logrus.WithError(err).Warn("Failed to remove cached image file")
+	}
+
+	// Remove checksum file
+	checksumPath := imagePath + ".sha256"
+	if err := os.Remove(checksumPath); err != nil && !os.IsNotExist(err) {
+		logrus.WithError(err).Warn("Failed to remove checksum file")
+	}
+
+	// Remove validator file
+	if err := os.Remove(validatorPath(imagePath)); err != nil && !os.IsNotExist(err) {
+		logrus.WithError(err).Warn("Failed to remove validator file")
+	}
+
+	dc.notifyChange(imagePath)
+
+	return nil
+}
+
+// Capacity returns usage information for every configured cache pool, default pool first
+func (dc *DirectoryCache) Capacity() ([]PoolCapacity, error) {
+	pools := dc.Pools()
+	capacities := make([]PoolCapacity, 0, len(pools))
+	for _, pool := range pools {
+		used, err := directorySize(pool.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine usage of cache pool %s: %w", pool.Name, err)
+		}
+
+		available, err := FilesystemAvailable(pool.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine free space of cache pool %s: %w", pool.Name, err)
+		}
+
+		// A size limit caps what can still be cached regardless of free disk space
+		if pool.MaxBytes > 0 {
+			remaining := uint64(0)
+			if used < pool.MaxBytes {
+				remaining = pool.MaxBytes - used
+			}
+			available = min(available, remaining)
+		}
+
+		capacities = append(capacities, PoolCapacity{
+			Name:           pool.Name,
+			Path:           pool.Path,
+			Default:        pool.Name == dc.defaultPool,
+			UsedBytes:      used,
+			MaxBytes:       pool.MaxBytes,
+			AvailableBytes: available,
+		})
+	}
+
+	return capacities, nil
+}
+
+// directorySize returns the total size of regular files under dir.
+// A missing directory is reported as empty.
+func directorySize(dir string) (uint64, error) {
+	var total uint64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", d.Name(), err)
+		}
+		if info.Size() > 0 {
+			total += uint64(info.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to walk directory %s: %w", dir, err)
+	}
+	return total, nil
+}
+
+// FilesystemAvailable returns the bytes available to unprivileged users on the filesystem containing path.
+// A missing path is reported as having no space available.
+func FilesystemAvailable(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to statfs %s: %w", path, err)
+	}
+	//nolint:gosec // Block size is always positive
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// FilesystemUsage returns the size of the filesystem containing path and the bytes used
+// on it, counting the blocks reserved for root as used since the provisioner cannot use them
+func FilesystemUsage(path string) (size, used uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, fmt.Errorf("failed to statfs %s: %w", path, err)
+	}
+	//nolint:gosec // Block size is always positive
+	blockSize := uint64(stat.Bsize)
+	return stat.Blocks * blockSize, (stat.Blocks - stat.Bavail) * blockSize, nil
+}
+
+// CheckWritable writes and removes a file in a cache directory, returning the space
+// available in it. Downloads fail mid-job on a read-only or full cache otherwise.
+func CheckWritable(dir string) (string, error) {
+	file, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return "", fmt.Errorf("cache directory %s is not writable: %w", dir, err)
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+
+	_, err = file.WriteString("selftest")
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write to cache directory %s: %w", dir, err)
+	}
+
+	available, err := FilesystemAvailable(dir)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s: %d bytes available", dir, available), nil
+}
@@ -0,0 +1,606 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCache returns a DirectoryCache with a single default pool at poolPath
+func newTestCache(poolPath string) *DirectoryCache {
+	return &DirectoryCache{
+		pools: map[string]*Pool{
+			"images": {Name: "images", Path: poolPath},
+		},
+		defaultPool: "images",
+	}
+}
+
+func TestAllocateImageFile(t *testing.T) {
+	tests := []struct {
+		expectError      bool
+		expectPathSuffix string
+		imageName        string
+		name             string
+	}{
+		{
+			name:             "simple image name",
+			imageName:        "ubuntu_20_04_qcow2",
+			expectError:      false,
+			expectPathSuffix: "ubuntu_20_04_qcow2",
+		},
+		{
+			name:             "image name with extension",
+			imageName:        "debian_11_qcow2.img",
+			expectError:      false,
+			expectPathSuffix: "debian_11_qcow2.img",
+		},
+		{
+			name:             "image name with spaces",
+			imageName:        "my image name",
+			expectError:      false,
+			expectPathSuffix: "my image name",
+		},
+		{
+			name:             "empty image name",
+			imageName:        "",
+			expectError:      false,
+			expectPathSuffix: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Create temporary pool directory
+			tmpDir := t.TempDir()
+			dc := newTestCache(tmpDir)
+
+			// Test AllocateImageFile
+			imagePath, err := dc.AllocateImageFile("", tt.imageName, 0)
+
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, imagePath)
+				assert.True(t, filepath.IsAbs(imagePath), "Path should be absolute")
+				if tt.expectPathSuffix != "" {
+					assert.True(t, strings.HasPrefix(imagePath, tmpDir), "Path should be under pool directory")
+					assert.Equal(t, tt.imageName, filepath.Base(imagePath))
+				}
+			}
+		})
+	}
+}
+
+func TestAllocateImageFileCreatesDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	nonExistentPool := filepath.Join(tmpDir, "cache", "images")
+
+	dc := newTestCache(nonExistentPool)
+
+	// Verify directory doesn't exist yet
+	_, err := os.Stat(nonExistentPool)
+	require.True(t, os.IsNotExist(err), "Directory should not exist initially")
+
+	// Allocate image file
+	imagePath, err := dc.AllocateImageFile("", "test_image", 0)
+
+	// Verify directory was created
+	assert.NoError(t, err)
+	assert.NotEmpty(t, imagePath)
+	info, err := os.Stat(nonExistentPool)
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir(), "Directory should be created")
+}
+
+func TestAllocateImageFileSelectsPool(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(filepath.Join(tmpDir, "images"))
+	dc.pools["fast"] = &Pool{Name: "fast", Path: filepath.Join(tmpDir, "fast")}
+
+	imagePath, err := dc.AllocateImageFile("fast", "test_image", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(tmpDir, "fast", "test_image"), imagePath)
+
+	imagePath, err = dc.AllocateImageFile("", "test_image", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(tmpDir, "images", "test_image"), imagePath)
+
+	_, err = dc.AllocateImageFile("missing", "test_image", 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown cache pool")
+}
+
+func TestAllocateImageFileSizeLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+	dc.pools["images"].MaxBytes = 1024
+
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "existing"), make([]byte, 600), 0o600))
+
+	_, err := dc.AllocateImageFile("", "fits", 400)
+	assert.NoError(t, err)
+
+	_, err = dc.AllocateImageFile("", "too_big", 500)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cache pool images is full")
+}
+
+func TestFilesystemUsage(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	size, used, err := FilesystemUsage(tmpDir)
+	require.NoError(t, err)
+	available, err := FilesystemAvailable(tmpDir)
+	require.NoError(t, err)
+	assert.Positive(t, size)
+	assert.Equal(t, size-used, available)
+
+	_, _, err = FilesystemUsage(filepath.Join(tmpDir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestAllocateImageFileFreeSpace(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	available, err := FilesystemAvailable(tmpDir)
+	require.NoError(t, err)
+
+	_, err = dc.AllocateImageFile("", "fits", 1024)
+	assert.NoError(t, err)
+
+	_, err = dc.AllocateImageFile("", "larger_than_disk", available+1)
+	assert.ErrorIs(t, err, ErrInsufficientSpace)
+
+	// The margin must remain free after the download
+	dc.SetMinFreeBytes(available)
+	_, err = dc.AllocateImageFile("", "within_margin", 1024*1024)
+	assert.ErrorIs(t, err, ErrInsufficientSpace)
+}
+
+func TestParsePoolSpec(t *testing.T) {
+	pools, err := ParsePoolSpec("images, fast-images:200", "")
+	require.NoError(t, err)
+	require.Len(t, pools, 2)
+	assert.Equal(t, "images", pools[0].Name)
+	assert.Equal(t, "/var/lib/libvirt/images", pools[0].Path)
+	assert.Equal(t, uint64(0), pools[0].MaxBytes)
+	assert.Equal(t, "fast-images", pools[1].Name)
+	assert.Equal(t, uint64(200*1024*1024*1024), pools[1].MaxBytes)
+
+	for _, spec := range []string{"", "images,images", "../etc", "images:big"} {
+		_, err := ParsePoolSpec(spec, "")
+		assert.Error(t, err, "spec %q should be rejected", spec)
+	}
+}
+
+func TestParsePoolSpecCacheDir(t *testing.T) {
+	pools, err := ParsePoolSpec("images", "/srv/cache/")
+	require.NoError(t, err)
+	require.Len(t, pools, 1)
+	assert.Equal(t, "/srv/cache/images", pools[0].Path)
+
+	_, err = ParsePoolSpec("images", "relative/cache")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must be an absolute path")
+}
+
+func TestPoolForPath(t *testing.T) {
+	dc := newTestCache("/srv/cache/images")
+	dc.pools["fast"] = &Pool{Name: "fast", Path: "/srv/cache/fast"}
+
+	pool := dc.poolForPath("/srv/cache/fast/ubuntu.sha256")
+	require.NotNil(t, pool)
+	assert.Equal(t, "fast", pool.Name)
+
+	pool = dc.poolForPath("/srv/cache/images/ubuntu")
+	require.NotNil(t, pool)
+	assert.Equal(t, "images", pool.Name)
+
+	assert.Nil(t, dc.poolForPath("/tmp/ubuntu"))
+}
+
+func TestIsCachePath(t *testing.T) {
+	dc := newTestCache("/srv/cache/images")
+
+	assert.True(t, dc.IsCachePath("/srv/cache/images/ubuntu"))
+	assert.False(t, dc.IsCachePath("/srv/cache/images"))
+	assert.False(t, dc.IsCachePath("/srv/cache/images-other/ubuntu"))
+	assert.False(t, dc.IsCachePath("/srv/cache/images/../secret"))
+	assert.False(t, dc.IsCachePath("images/ubuntu"))
+	assert.Equal(t, []string{"/srv/cache/images"}, dc.PoolPaths())
+}
+
+func TestCapacity(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(filepath.Join(tmpDir, "images"))
+	dc.pools["archive"] = &Pool{Name: "archive", Path: filepath.Join(tmpDir, "archive"), MaxBytes: 2048}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "images"), 0o750))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "archive"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "archive", "image"), make([]byte, 512), 0o600))
+
+	capacities, err := dc.Capacity()
+	require.NoError(t, err)
+	require.Len(t, capacities, 2)
+
+	assert.Equal(t, "images", capacities[0].Name)
+	assert.True(t, capacities[0].Default)
+	assert.Equal(t, uint64(0), capacities[0].UsedBytes)
+
+	assert.Equal(t, "archive", capacities[1].Name)
+	assert.False(t, capacities[1].Default)
+	assert.Equal(t, uint64(512), capacities[1].UsedBytes)
+	assert.Equal(t, uint64(2048), capacities[1].MaxBytes)
+	assert.LessOrEqual(t, capacities[1].AvailableBytes, uint64(1536))
+}
+
+func TestEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(filepath.Join(tmpDir, "images"))
+	dc.pools["archive"] = &Pool{Name: "archive", Path: filepath.Join(tmpDir, "archive")}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "images"), 0o750))
+	imagePath := filepath.Join(tmpDir, "images", "ubuntu_22_04")
+	require.NoError(t, os.WriteFile(imagePath, make([]byte, 256), 0o600))
+	require.NoError(t, dc.CreateCacheEntry(imagePath, "abc123"))
+
+	// Downloads in progress and orphaned checksum files are not listed
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "images", "partial"), []byte("x"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "images", "gone.sha256"), []byte("def456"), 0o600))
+
+	entries, err := dc.Entries()
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{{Pool: "images", Path: imagePath, Size: 256, Checksum: "abc123"}}, entries)
+}
+
+func TestCheckCacheCacheHit(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	checksum := "abc123def456"
+	imagePath := filepath.Join(tmpDir, checksum)
+	checksumFile := imagePath + ".sha256"
+
+	// Create image file first, then checksum file (checksum points to image by convention)
+	require.NoError(t, os.WriteFile(imagePath, []byte("fake image data"), 0o600))
+	require.NoError(t, os.WriteFile(checksumFile, []byte(checksum), 0o600))
+
+	// Test cache hit
+	cache, err := dc.CheckCache("", checksum)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, cache)
+	assert.Equal(t, imagePath, cache.Path)
+	assert.Equal(t, checksum, cache.Checksum)
+	assert.Greater(t, cache.Size, uint64(0))
+}
+
+func TestCheckCacheByURL(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	// Without a .sha256 object, images are named after their URL and keyed by it
+	imageURL := "https://minio.example.com/images/ubuntu-22.04.qcow2"
+	imagePath := filepath.Join(tmpDir, GetImageNameFromURL(imageURL))
+	require.NoError(t, os.WriteFile(imagePath, []byte("fake image data"), 0o600))
+	require.NoError(t, dc.CreateCacheEntry(imagePath, imageURL))
+
+	entry, err := dc.CheckCache("", imageURL)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, imagePath, entry.Path)
+	assert.Equal(t, imageURL, entry.Checksum)
+}
+
+func TestValidator(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	imagePath := filepath.Join(tmpDir, "ubuntu")
+	require.NoError(t, os.WriteFile(imagePath, []byte("fake image data"), 0o600))
+
+	validator, err := dc.Validator(imagePath)
+	require.NoError(t, err)
+	assert.Nil(t, validator)
+
+	modified := time.Date(2026, 1, 14, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, dc.SetValidator(imagePath, Validator{ETag: "abc", LastModified: modified}))
+
+	validator, err = dc.Validator(imagePath)
+	require.NoError(t, err)
+	require.NotNil(t, validator)
+	assert.Equal(t, "abc", validator.ETag)
+	assert.True(t, modified.Equal(validator.LastModified))
+
+	require.NoError(t, dc.DeleteImage(imagePath))
+	assert.NoFileExists(t, validatorPath(imagePath))
+
+	assert.Error(t, dc.SetValidator("/etc/ubuntu", Validator{}))
+}
+
+func TestCheckCacheMiss(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	// Test cache miss - no checksum file exists
+	cache, err := dc.CheckCache("", "nonexistent_checksum")
+
+	assert.NoError(t, err)
+	assert.Nil(t, cache)
+}
+
+func TestCheckCacheOrphanedChecksumFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	checksum := "orphaned_checksum"
+	checksumFile := filepath.Join(tmpDir, checksum+".sha256")
+
+	// Create checksum file but NO image file
+	require.NoError(t, os.WriteFile(checksumFile, []byte(checksum), 0600))
+
+	// Test orphaned checksum detection
+	cache, err := dc.CheckCache("", checksum)
+
+	// Should return nil (not an error) for orphaned checksums
+	assert.NoError(t, err)
+	assert.Nil(t, cache)
+}
+
+func TestCheckCacheImageFileSizeAccuracy(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	checksum := "size_test_checksum"
+	imagePath := filepath.Join(tmpDir, checksum)
+	checksumFile := imagePath + ".sha256"
+
+	imageData := make([]byte, 5*1024*1024) // 5MB
+	require.NoError(t, os.WriteFile(imagePath, imageData, 0o600))
+	require.NoError(t, os.WriteFile(checksumFile, []byte(checksum), 0o600))
+
+	// Test that size is correctly reported
+	cache, err := dc.CheckCache("", checksum)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, cache)
+	assert.Equal(t, uint64(5*1024*1024), cache.Size)
+}
+
+func TestCheckCacheCreatesMissingDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	nonExistentPool := filepath.Join(tmpDir, "missing", "cache")
+
+	dc := newTestCache(nonExistentPool)
+
+	// Should not error even if directory doesn't exist
+	cache, err := dc.CheckCache("", "any_checksum")
+
+	assert.NoError(t, err)
+	assert.Nil(t, cache)
+
+	// Directory should be created
+	info, err := os.Stat(nonExistentPool)
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+}
+
+func TestCommitImageFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	imagePath := filepath.Join(tmpDir, "ubuntu")
+	partialPath := PartialPath(imagePath)
+	require.NoError(t, os.WriteFile(partialPath, []byte("image"), 0o600))
+
+	require.NoError(t, dc.CommitImageFile(partialPath, imagePath))
+	assert.FileExists(t, imagePath)
+	assert.NoFileExists(t, partialPath)
+
+	assert.Error(t, dc.CommitImageFile(imagePath, "/etc/ubuntu"))
+}
+
+func TestCreateCacheEntry(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	imagePath := filepath.Join(tmpDir, "test_image")
+	checksum := "test_checksum_value"
+
+	// Create the image file first
+	require.NoError(t, os.WriteFile(imagePath, []byte("image data"), 0o600))
+
+	// Create cache entry
+	err := dc.CreateCacheEntry(imagePath, checksum)
+
+	assert.NoError(t, err)
+
+	// Verify checksum file was created
+	checksumFile := imagePath + ".sha256"
+	//nolint:gosec // checksumFile is constructed from controlled imagePath in test
+	data, err := os.ReadFile(checksumFile)
+	assert.NoError(t, err)
+	assert.Equal(t, checksum, string(data))
+}
+
+func TestGetImageNameFromURL(t *testing.T) {
+	tests := []struct {
+		expectedName string
+		imageURL     string
+		name         string
+	}{
+		{
+			expectedName: "ubuntu_20_04",
+			imageURL:     "https://minio.example.com/bucket/ubuntu-20.04.qcow2",
+			name:         "simple QCOW2 URL",
+		},
+		{
+			expectedName: "debian_11_0",
+			imageURL:     "https://minio.example.com/bucket/debian.11.0.raw",
+			name:         "URL with multiple dots",
+		},
+		{
+			expectedName: "centos_8_stream",
+			imageURL:     "https://minio.example.com/bucket/centos-8-stream.img",
+			name:         "URL with dashes",
+		},
+		{
+			expectedName: "image",
+			imageURL:     "https://minio.example.com/bucket/image",
+			name:         "URL with no extension",
+		},
+		{
+			expectedName: "ubuntu",
+			imageURL:     "https://minio.example.com/bucket/images/v1.0/ubuntu.qcow2",
+			name:         "URL with path components",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := GetImageNameFromURL(tt.imageURL)
+			assert.Equal(t, tt.expectedName, name)
+		})
+	}
+}
+
+func TestDeleteImage(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	imagePath := filepath.Join(tmpDir, "test_image")
+	checksumPath := imagePath + ".sha256"
+
+	// Create image and checksum files
+	require.NoError(t, os.WriteFile(imagePath, []byte("image data"), 0o600))
+	require.NoError(t, os.WriteFile(checksumPath, []byte("checksum"), 0o600))
+
+	// Verify files exist
+	_, err := os.Stat(imagePath)
+	require.NoError(t, err)
+	_, err = os.Stat(checksumPath)
+	require.NoError(t, err)
+
+	// Delete image
+	err = dc.DeleteImage(imagePath)
+	assert.NoError(t, err)
+
+	// Verify both files are deleted
+	_, err = os.Stat(imagePath)
+	assert.True(t, os.IsNotExist(err), "Image file should be deleted")
+	_, err = os.Stat(checksumPath)
+	assert.True(t, os.IsNotExist(err), "Checksum file should be deleted")
+}
+
+func TestDeleteImageNonExistent(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	imagePath := filepath.Join(tmpDir, "nonexistent_image")
+
+	// Deleting non-existent file should not error
+	err := dc.DeleteImage(imagePath)
+	assert.NoError(t, err)
+}
+
+func TestCalculateChecksum(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	imagePath := filepath.Join(tmpDir, "test_image")
+	require.NoError(t, os.WriteFile(imagePath, []byte("image data"), 0o600))
+
+	checksum, err := dc.CalculateChecksum(imagePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "b41b86dcfdc6219bc2fb987591ad9995bcf3a1e40c2bdd3fdbec622371e6e1af", checksum)
+}
+
+func TestCalculateChecksumPathTraversal(t *testing.T) {
+	dc := newTestCache(t.TempDir())
+
+	// Attempt to use path traversal should fail
+	checksum, err := dc.CalculateChecksum("../../../etc/passwd")
+	assert.Error(t, err)
+	assert.Empty(t, checksum)
+	assert.Contains(t, err.Error(), "invalid file path")
+}
+
+func TestCalculateChecksumOutsidePool(t *testing.T) {
+	dc := newTestCache(t.TempDir())
+
+	checksum, err := dc.CalculateChecksum("/etc/passwd")
+	assert.Error(t, err)
+	assert.Empty(t, checksum)
+	assert.Contains(t, err.Error(), "invalid file path")
+}
+
+func TestCalculateChecksumNonExistent(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	checksum, err := dc.CalculateChecksum(filepath.Join(tmpDir, "nonexistent_file"))
+	assert.Error(t, err)
+	assert.Empty(t, checksum)
+}
+
+func TestOnChangeHook(t *testing.T) {
+	tmpDir := t.TempDir()
+	dc := newTestCache(tmpDir)
+
+	var changed []string
+	dc.OnChange = func(pool *Pool) {
+		changed = append(changed, pool.Name)
+	}
+
+	imagePath := filepath.Join(tmpDir, "test_image")
+	require.NoError(t, os.WriteFile(imagePath, []byte("image data"), 0o600))
+
+	require.NoError(t, dc.CreateCacheEntry(imagePath, "checksum"))
+	require.NoError(t, dc.DeleteImage(imagePath))
+
+	// Paths outside the cache do not trigger the hook
+	require.NoError(t, dc.DeleteImage("/tmp/not-cached"))
+
+	assert.Equal(t, []string{"images", "images"}, changed)
+}
+
+func TestNewDirectoryCache(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	dc, err := NewDirectoryCache("images,fast:10", tmpDir)
+	require.NoError(t, err)
+
+	pools := dc.Pools()
+	require.Len(t, pools, 2)
+	assert.Equal(t, "images", pools[0].Name)
+	assert.Equal(t, "fast", pools[1].Name)
+	assert.True(t, dc.HasPool(""))
+	assert.True(t, dc.HasPool("fast"))
+	assert.False(t, dc.HasPool("slow"))
+
+	_, err = NewDirectoryCache("", tmpDir)
+	assert.Error(t, err)
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	detail, err := CheckWritable(dir)
+	require.NoError(t, err)
+	assert.Contains(t, detail, dir)
+
+	// The probe file is removed
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = CheckWritable(filepath.Join(dir, "missing"))
+	assert.ErrorContains(t, err, "not writable")
+}
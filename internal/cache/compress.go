@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// CompressedSuffix is appended to the path of images compressed for the cache.
+// Compressed images are qcow2 images, whatever the format of the original.
+const CompressedSuffix = ".compressed.qcow2"
+
+// CompressedPath returns the path an image is cached at once compressed
+func CompressedPath(imagePath string) string {
+	return imagePath + CompressedSuffix
+}
+
+// IsCompressed reports whether a cached image was compressed for the cache
+func IsCompressed(imagePath string) bool {
+	return strings.HasSuffix(imagePath, CompressedSuffix)
+}
+
+// CompressImage converts an image into a compressed qcow2 image with the zlib or
+// zstd algorithm. parallel limits the number of concurrent compression coroutines,
+// and so the CPU used.
+func CompressImage(ctx context.Context, srcPath, srcFormat, dstPath, algorithm string, parallel int) error {
+	args := []string{"convert", "-c", "-O", "qcow2", "-o", "compression_type=" + algorithm,
+		"-m", strconv.Itoa(max(parallel, 1))}
+	if srcFormat != "" {
+		args = append(args, "-f", srcFormat)
+	}
+	args = append(args, srcPath, dstPath)
+
+	output, err := exec.CommandContext(ctx, "qemu-img", args...).CombinedOutput() // #nosec G204 -- Paths are cache paths
+	if err != nil {
+		return fmt.Errorf("failed to compress image: %w, output: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressedPath(t *testing.T) {
+	path := CompressedPath("/var/lib/libvirt/images/ubuntu.raw")
+	assert.Equal(t, "/var/lib/libvirt/images/ubuntu.raw.compressed.qcow2", path)
+	assert.True(t, IsCompressed(path))
+	assert.False(t, IsCompressed("/var/lib/libvirt/images/ubuntu.qcow2"))
+}
@@ -0,0 +1,134 @@
+// Package events publishes structured job and volume lifecycle events to
+// configurable sinks (NATS, webhooks, journald), so consumers need not poll the API.
+package events
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Type identifies the kind of lifecycle event
+type Type string
+
+// Event types.
+const (
+	// JobStarted is emitted when a job begins running.
+	JobStarted Type = "job.started"
+	// JobStageChanged is emitted when a job moves to a new stage.
+	JobStageChanged Type = "job.stage_changed"
+	// JobPaused is emitted when a job is paused.
+	JobPaused Type = "job.paused"
+	// JobResumed is emitted when a paused job is resumed.
+	JobResumed Type = "job.resumed"
+	// JobCompleted is emitted when a job finishes successfully.
+	JobCompleted Type = "job.completed"
+	// JobFailed is emitted when a job finishes with an error.
+	JobFailed Type = "job.failed"
+	// CacheEvicted is emitted when an image is removed from the cache.
+	CacheEvicted Type = "cache.evicted"
+	// VolumeDeleted is emitted when an LVM volume is deleted.
+	VolumeDeleted Type = "volume.deleted"
+)
+
+// queueSize is the number of events buffered before new events are dropped
+const queueSize = 256
+
+// Event is a lifecycle event
+type Event struct {
+	Type       Type      `json:"type"`
+	Timestamp  time.Time `json:"timestamp"`
+	JobID      string    `json:"job_id,omitempty"`
+	VolumeName string    `json:"volume_name,omitempty"`
+	Stage      string    `json:"stage,omitempty"`
+	ImageURL   string    `json:"image_url,omitempty"`
+	ImagePath  string    `json:"image_path,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ErrorCode  string    `json:"error_code,omitempty"`
+	// Labels are the labels of the job the event is about
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Sink delivers events to a destination
+type Sink interface {
+	Name() string
+	Publish(event Event) error
+}
+
+// Emitter delivers events to its sinks in the background so that publishing
+// never blocks provisioning. Events are dropped if the queue is full.
+type Emitter struct {
+	sinks []Sink
+	queue chan Event
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewEmitter creates an emitter for sinks and starts delivering events
+func NewEmitter(sinks ...Sink) *Emitter {
+	e := &Emitter{
+		sinks: sinks,
+		queue: make(chan Event, queueSize),
+		done:  make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Emit queues an event for delivery, setting its timestamp if unset
+func (e *Emitter) Emit(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	select {
+	case e.queue <- event:
+	default:
+		logrus.WithField("type", event.Type).Warn("Event queue full, dropping event")
+	}
+}
+
+// Close delivers queued events and stops the emitter
+func (e *Emitter) Close() {
+	e.once.Do(func() {
+		close(e.queue)
+		<-e.done
+	})
+}
+
+// run delivers queued events until the queue is closed
+func (e *Emitter) run() {
+	defer close(e.done)
+
+	for event := range e.queue {
+		for _, sink := range e.sinks {
+			if err := sink.Publish(event); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"sink": sink.Name(),
+					"type": event.Type,
+				}).Warn("Failed to publish event")
+			}
+		}
+	}
+}
+
+// ParseSinks parses a comma-separated list of sink names and validates them
+func ParseSinks(spec string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		switch name {
+		case "nats", "webhook", "journald":
+			names = append(names, name)
+		default:
+			return nil, fmt.Errorf("unknown event sink '%s': must be nats, webhook or journald", name)
+		}
+	}
+	return names, nil
+}
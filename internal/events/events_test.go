@@ -0,0 +1,110 @@
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Publish(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestEmitter(t *testing.T) {
+	first := &recordingSink{}
+	second := &recordingSink{}
+	emitter := NewEmitter(first, second)
+
+	emitter.Emit(Event{Type: JobStarted, JobID: "job-1"})
+	emitter.Emit(Event{Type: JobCompleted, JobID: "job-1"})
+	emitter.Close()
+	emitter.Close() // Closing twice is safe
+
+	for _, sink := range []*recordingSink{first, second} {
+		require.Len(t, sink.events, 2)
+		assert.Equal(t, JobStarted, sink.events[0].Type)
+		assert.Equal(t, JobCompleted, sink.events[1].Type)
+		assert.False(t, sink.events[0].Timestamp.IsZero())
+	}
+}
+
+func TestParseSinks(t *testing.T) {
+	sinks, err := ParseSinks("nats, webhook,journald")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nats", "webhook", "journald"}, sinks)
+
+	sinks, err = ParseSinks("")
+	require.NoError(t, err)
+	assert.Empty(t, sinks)
+
+	_, err = ParseSinks("kafka")
+	assert.Error(t, err)
+}
+
+func TestWebhookSink(t *testing.T) {
+	var mu sync.Mutex
+	var received []Event
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	first := httptest.NewServer(handler)
+	defer first.Close()
+	second := httptest.NewServer(handler)
+	defer second.Close()
+
+	sink, err := NewWebhookSink([]string{first.URL, second.URL})
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Publish(Event{Type: VolumeDeleted, VolumeName: "vm-disk"}))
+	assert.Len(t, received, 2)
+	assert.Equal(t, "vm-disk", received[0].VolumeName)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	sink, err = NewWebhookSink([]string{failing.URL, first.URL})
+	require.NoError(t, err)
+	assert.ErrorContains(t, sink.Publish(Event{Type: JobStarted}), "status 500")
+	assert.Len(t, received, 3)
+
+	_, err = NewWebhookSink(nil)
+	assert.Error(t, err)
+}
+
+func TestJournalEntry(t *testing.T) {
+	entry := string(journalEntry(Event{Type: JobFailed, JobID: "job-1", Error: "line one\nline two"}))
+
+	assert.Contains(t, entry, "MESSAGE=job.failed job=job-1 volume=\n")
+	assert.Contains(t, entry, "PRIORITY=3\n")
+	assert.Contains(t, entry, "LVP_EVENT_TYPE=job.failed\n")
+	assert.NotContains(t, entry, "LVP_STAGE")
+	assert.True(t, strings.Contains(entry, "LVP_ERROR\n\x11\x00\x00\x00\x00\x00\x00\x00line one\nline two\n"))
+	assert.NotContains(t, entry, "LVP_LABELS")
+
+	labels := map[string]string{"tenant": "acme", "env": "prod"}
+	entry = string(journalEntry(Event{Type: JobStarted, JobID: "job-2", Labels: labels}))
+	assert.Contains(t, entry, "LVP_LABELS=env=prod,tenant=acme\n")
+}
@@ -0,0 +1,186 @@
+package events
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSSink publishes events to "<prefix>.<type>" subjects
+type NATSSink struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+// NewNATSSink connects to NATS and publishes events under subject prefix
+func NewNATSSink(url, prefix, credsFile string) (*NATSSink, error) {
+	options := []nats.Option{nats.Name("libvirt-volume-provisioner-events"), nats.MaxReconnects(-1)}
+	if credsFile != "" {
+		options = append(options, nats.UserCredentials(credsFile))
+	}
+
+	conn, err := nats.Connect(url, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	return &NATSSink{conn: conn, prefix: prefix}, nil
+}
+
+// Name returns the sink name
+func (s *NATSSink) Name() string { return "nats" }
+
+// Publish publishes an event as JSON
+func (s *NATSSink) Publish(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	return s.conn.Publish(s.prefix+"."+string(event.Type), data)
+}
+
+// Close closes the NATS connection
+func (s *NATSSink) Close() {
+	s.conn.Close()
+}
+
+// WebhookSink posts events as JSON to each configured URL
+type WebhookSink struct {
+	urls       []string
+	httpClient *http.Client
+}
+
+// NewWebhookSink creates a sink that fans events out to urls
+func NewWebhookSink(urls []string) (*WebhookSink, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no webhook URLs configured")
+	}
+	return &WebhookSink{urls: urls, httpClient: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// Name returns the sink name
+func (s *WebhookSink) Name() string { return "webhook" }
+
+// Publish posts an event to every webhook, returning the first failure
+func (s *WebhookSink) Publish(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	var firstErr error
+	for _, url := range s.urls {
+		if err := s.post(url, data); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// post sends an event body to a single webhook
+func (s *WebhookSink) post(url string, data []byte) error {
+	//nolint:noctx // Events are delivered in the background with a client timeout
+	resp, err := s.httpClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("webhook %s failed: %w", url, err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned status %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// journaldSocket is the systemd journal native protocol socket
+const journaldSocket = "/run/systemd/journal/socket"
+
+// JournaldSink writes events as structured journal entries
+type JournaldSink struct {
+	conn *net.UnixConn
+}
+
+// NewJournaldSink connects to the local systemd journal
+func NewJournaldSink() (*JournaldSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+	return &JournaldSink{conn: conn}, nil
+}
+
+// Name returns the sink name
+func (s *JournaldSink) Name() string { return "journald" }
+
+// Publish writes an event as a journal entry with LVP_* fields
+func (s *JournaldSink) Publish(event Event) error {
+	if _, err := s.conn.Write(journalEntry(event)); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal socket
+func (s *JournaldSink) Close() {
+	_ = s.conn.Close()
+}
+
+// journalEntry encodes an event using the journal native protocol
+func journalEntry(event Event) []byte {
+	message := fmt.Sprintf("%s job=%s volume=%s", event.Type, event.JobID, event.VolumeName)
+	priority := "6" // info
+	if event.Type == JobFailed {
+		priority = "3" // err
+	}
+
+	fields := [][2]string{
+		{"MESSAGE", message},
+		{"PRIORITY", priority},
+		{"SYSLOG_IDENTIFIER", "libvirt-volume-provisioner"},
+		{"LVP_EVENT_TYPE", string(event.Type)},
+		{"LVP_JOB_ID", event.JobID},
+		{"LVP_VOLUME_NAME", event.VolumeName},
+		{"LVP_STAGE", event.Stage},
+		{"LVP_IMAGE_URL", event.ImageURL},
+		{"LVP_IMAGE_PATH", event.ImagePath},
+		{"LVP_ERROR", event.Error},
+		{"LVP_ERROR_CODE", event.ErrorCode},
+		{"LVP_LABELS", journalLabels(event.Labels)},
+	}
+
+	var buf bytes.Buffer
+	for _, field := range fields {
+		key, value := field[0], field[1]
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "\n") {
+			fmt.Fprintf(&buf, "%s=%s\n", key, value)
+			continue
+		}
+		// Multi-line values use the length-prefixed binary encoding
+		buf.WriteString(key)
+		buf.WriteByte('\n')
+		_ = binary.Write(&buf, binary.LittleEndian, uint64(len(value)))
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// journalLabels formats job labels as comma-separated key=value pairs, sorted by key
+func journalLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,643 @@
+// Package fleet provides a coordinator that fronts a fleet of provisioner instances,
+// forwarding provisioning requests to peers and aggregating their job status and capacity.
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// jobIDSeparator separates the peer name from the peer's job ID in coordinator job IDs
+const jobIDSeparator = ":"
+
+// peerNamePattern matches valid peer names; they must not contain the job ID separator
+var peerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Peer is a provisioner instance managed by the coordinator
+type Peer struct {
+	Name string
+	URL  string
+}
+
+// ParsePeers parses a comma-separated list of name=url peer definitions
+// (e.g. "hv1=https://hv1:8080,hv2=https://hv2:8080").
+func ParsePeers(spec string) ([]Peer, error) {
+	var peers []Peer
+	seen := make(map[string]bool)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, peerURL, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid peer '%s': expected name=url", entry)
+		}
+		name = strings.TrimSpace(name)
+		peerURL = strings.TrimSuffix(strings.TrimSpace(peerURL), "/")
+
+		if !peerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid peer name '%s'", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate peer '%s'", name)
+		}
+		u, err := url.Parse(peerURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL for peer '%s': %s", name, peerURL)
+		}
+
+		seen[name] = true
+		peers = append(peers, Peer{Name: name, URL: peerURL})
+	}
+
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no fleet peers configured")
+	}
+	return peers, nil
+}
+
+// Coordinator forwards jobs to fleet peers. It implements the API job manager
+// interface, so the regular REST API serves the whole fleet from a single endpoint.
+// Coordinator job IDs have the form "<peer>:<peer job ID>".
+type Coordinator struct {
+	peers      []Peer
+	token      string
+	httpClient *http.Client
+
+	mu   sync.Mutex
+	jobs map[string]types.JobStatus // last known status of forwarded, unfinished jobs
+}
+
+// NewCoordinator creates a coordinator for peers, authenticating with an API token.
+// tlsConfig may be nil to use the system defaults.
+func NewCoordinator(peers []Peer, token string, tlsConfig *tls.Config) (*Coordinator, error) {
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no fleet peers configured")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("fleet peer API token must not be empty")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &Coordinator{
+		peers:      peers,
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		jobs:       make(map[string]types.JobStatus),
+	}, nil
+}
+
+// StartJob forwards a provisioning request to the requested target host,
+// or to the peer with the most available capacity in the requested cache pool
+func (c *Coordinator) StartJob(req types.ProvisionRequest) (string, error) {
+	ctx := context.Background()
+
+	req, err := c.routeDependencies(req)
+	if err != nil {
+		return "", err
+	}
+	peer, err := c.selectPeer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	req.TargetHost = ""
+	var resp types.ProvisionResponse
+	if err := c.do(ctx, peer, http.MethodPost, "/api/v2/provision", req, &resp); err != nil {
+		return "", err
+	}
+
+	jobID := peer.Name + jobIDSeparator + resp.JobID
+	c.mu.Lock()
+	c.jobs[jobID] = types.StatusPending
+	c.mu.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"job_id": jobID,
+		"peer":   peer.Name,
+		"volume": req.VolumeName,
+	}).Info("Forwarded provisioning job to fleet peer")
+	return jobID, nil
+}
+
+// GetJobStatus returns the status of a job from the peer running it
+func (c *Coordinator) GetJobStatus(jobID string) (*types.StatusResponse, error) {
+	peer, peerJobID, err := c.splitJobID(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	var status types.StatusResponse
+	err = c.do(context.Background(), peer, http.MethodGet, "/api/v2/status/"+url.PathEscape(peerJobID), nil, &status)
+	if err != nil {
+		return nil, err
+	}
+
+	status.JobID = jobID
+	status.Host = peer.Name
+
+	c.mu.Lock()
+	if status.Status == types.StatusCompleted || status.Status == types.StatusFailed {
+		delete(c.jobs, jobID)
+	} else {
+		c.jobs[jobID] = status.Status
+	}
+	c.mu.Unlock()
+
+	return &status, nil
+}
+
+// CancelJob cancels a job on the peer running it
+func (c *Coordinator) CancelJob(jobID string) error {
+	peer, peerJobID, err := c.splitJobID(jobID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.do(context.Background(), peer, http.MethodDelete, "/api/v2/cancel/"+url.PathEscape(peerJobID), nil, nil); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	delete(c.jobs, jobID)
+	c.mu.Unlock()
+	return nil
+}
+
+// CancelJobs cancels the jobs matching the request's filters on all reachable peers.
+// Unreachable peers are logged and omitted.
+func (c *Coordinator) CancelJobs(req types.BulkCancelRequest) (*types.BulkCancelResponse, error) {
+	// Rejected here rather than by every peer
+	if _, err := req.Validate(); err != nil {
+		return nil, types.NewError(types.ErrCodeInvalidRequest, err, nil)
+	}
+
+	response := &types.BulkCancelResponse{Cancelled: []string{}}
+	reachable := 0
+	for _, peer := range c.peers {
+		var peerResponse types.BulkCancelResponse
+		if err := c.do(context.Background(), peer, http.MethodPost, "/api/v2/jobs/cancel", req, &peerResponse); err != nil {
+			logrus.WithError(err).WithField("peer", peer.Name).Warn("Failed to cancel jobs on fleet peer")
+			continue
+		}
+		reachable++
+
+		c.mu.Lock()
+		for _, peerJobID := range peerResponse.Cancelled {
+			jobID := peer.Name + jobIDSeparator + peerJobID
+			response.Cancelled = append(response.Cancelled, jobID)
+			delete(c.jobs, jobID)
+		}
+		c.mu.Unlock()
+		for peerJobID, reason := range peerResponse.Failed {
+			if response.Failed == nil {
+				response.Failed = make(map[string]string)
+			}
+			response.Failed[peer.Name+jobIDSeparator+peerJobID] = reason
+		}
+	}
+
+	if reachable == 0 {
+		return nil, types.NewError(types.ErrCodePeerUnavailable, fmt.Errorf("no fleet peer reachable"), nil)
+	}
+	return response, nil
+}
+
+// PauseJob pauses a job on the peer running it
+func (c *Coordinator) PauseJob(jobID string) error {
+	return c.jobAction(jobID, "pause")
+}
+
+// ResumeJob resumes a paused job on the peer running it
+func (c *Coordinator) ResumeJob(jobID string) error {
+	return c.jobAction(jobID, "resume")
+}
+
+// jobAction posts a job action such as "pause" to the peer running the job
+func (c *Coordinator) jobAction(jobID, action string) error {
+	peer, peerJobID, err := c.splitJobID(jobID)
+	if err != nil {
+		return err
+	}
+
+	path := "/api/v2/jobs/" + url.PathEscape(peerJobID) + "/" + action
+	return c.do(context.Background(), peer, http.MethodPost, path, nil, nil)
+}
+
+// GetActiveJobs returns the number of forwarded jobs not yet seen to finish
+func (c *Coordinator) GetActiveJobs() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.jobs)
+}
+
+// GetJobCacheInfo returns cache information for a completed job
+func (c *Coordinator) GetJobCacheInfo(jobID string) (bool, string, error) {
+	status, err := c.GetJobStatus(jobID)
+	if err != nil {
+		return false, "", err
+	}
+
+	if status.Status != types.StatusCompleted {
+		return false, "", fmt.Errorf("job not completed: %s", status.Status)
+	}
+
+	cacheHit := status.CacheHit != nil && *status.CacheHit
+	return cacheHit, status.ImagePath, nil
+}
+
+// GetCapacity returns the image cache pools of all reachable peers.
+// Unreachable peers are logged and omitted.
+func (c *Coordinator) GetCapacity() ([]types.PoolCapacity, error) {
+	var pools []types.PoolCapacity
+	reachable := 0
+
+	for _, peer := range c.peers {
+		peerPools, err := c.peerCapacity(context.Background(), peer)
+		if err != nil {
+			logrus.WithError(err).WithField("peer", peer.Name).Warn("Failed to get fleet peer capacity")
+			continue
+		}
+		reachable++
+		pools = append(pools, peerPools...)
+	}
+
+	if reachable == 0 {
+		return nil, types.NewError(types.ErrCodePeerUnavailable, fmt.Errorf("no fleet peer reachable"), nil)
+	}
+	return pools, nil
+}
+
+// ValidateImage validates an image on the first reachable peer
+func (c *Coordinator) ValidateImage(ctx context.Context, req types.ValidateImageRequest) (*types.ValidateImageResponse, error) {
+	for _, peer := range c.peers {
+		var resp types.ValidateImageResponse
+		if err := c.do(ctx, peer, http.MethodPost, "/api/v2/validate-image", req, &resp); err != nil {
+			logrus.WithError(err).WithField("peer", peer.Name).Warn("Failed to validate image on fleet peer")
+			continue
+		}
+		return &resp, nil
+	}
+	return nil, types.NewError(types.ErrCodePeerUnavailable, fmt.Errorf("no fleet peer reachable"), nil)
+}
+
+// ListJobs is not supported by the coordinator, as each peer keeps its own job history
+func (c *Coordinator) ListJobs(_ types.JobListRequest) (*types.JobListResponse, error) {
+	return nil, types.NewError(types.ErrCodeNotSupported,
+		fmt.Errorf("job listing is not supported in coordinator mode; list jobs on each peer"), nil)
+}
+
+// GetMaintenance is not supported by the coordinator, as each peer drains independently
+func (c *Coordinator) GetMaintenance() (*types.MaintenanceStatus, error) {
+	return nil, types.NewError(types.ErrCodeNotSupported,
+		fmt.Errorf("maintenance mode is not supported in coordinator mode; drain each peer"), nil)
+}
+
+// SetMaintenance is not supported by the coordinator, as each peer drains independently
+func (c *Coordinator) SetMaintenance(_ bool) error {
+	return types.NewError(types.ErrCodeNotSupported,
+		fmt.Errorf("maintenance mode is not supported in coordinator mode; drain each peer"), nil)
+}
+
+// GetSettings is not supported by the coordinator, as each peer has its own settings
+func (c *Coordinator) GetSettings() (*types.RuntimeSettings, error) {
+	return nil, types.NewError(types.ErrCodeNotSupported,
+		fmt.Errorf("runtime settings are not supported in coordinator mode; change them on each peer"), nil)
+}
+
+// UpdateSettings is not supported by the coordinator, as each peer has its own settings
+func (c *Coordinator) UpdateSettings(_ types.SettingsUpdate) (*types.RuntimeSettings, error) {
+	return nil, types.NewError(types.ErrCodeNotSupported,
+		fmt.Errorf("runtime settings are not supported in coordinator mode; change them on each peer"), nil)
+}
+
+// PreviewVolumeDeletion is not supported by the coordinator; volumes are deleted on each peer
+func (c *Coordinator) PreviewVolumeDeletion(_ string) (*types.VolumeDeletionPreview, error) {
+	return nil, types.NewError(types.ErrCodeNotSupported,
+		fmt.Errorf("volume deletion is not supported in coordinator mode; delete volumes on each peer"), nil)
+}
+
+// DeleteVolume is not supported by the coordinator; volumes are deleted on each peer
+func (c *Coordinator) DeleteVolume(_ string, _ types.VolumeDeletionRequest) error {
+	return types.NewError(types.ErrCodeNotSupported,
+		fmt.Errorf("volume deletion is not supported in coordinator mode; delete volumes on each peer"), nil)
+}
+
+// AdoptVolume is not supported by the coordinator; volumes are adopted on each peer
+func (c *Coordinator) AdoptVolume(_ string, _ types.VolumeAdoptionRequest) (*types.ProvisionedVolume, error) {
+	return nil, types.NewError(types.ErrCodeNotSupported,
+		fmt.Errorf("volume adoption is not supported in coordinator mode; adopt volumes on each peer"), nil)
+}
+
+// VerifyVolume is not supported by the coordinator; volumes are verified on each peer
+func (c *Coordinator) VerifyVolume(_, _ string) (*types.VerifyVolumeResponse, error) {
+	return nil, types.NewError(types.ErrCodeNotSupported,
+		fmt.Errorf("volume verification is not supported in coordinator mode; verify volumes on each peer"), nil)
+}
+
+// ListCachedImages returns the cached images of all reachable peers.
+// Unreachable peers are logged and omitted.
+func (c *Coordinator) ListCachedImages() ([]types.CachedImage, error) {
+	var images []types.CachedImage
+	reachable := 0
+
+	for _, peer := range c.peers {
+		var resp types.CacheListResponse
+		if err := c.do(context.Background(), peer, http.MethodGet, "/api/v2/cache", nil, &resp); err != nil {
+			logrus.WithError(err).WithField("peer", peer.Name).Warn("Failed to list fleet peer cached images")
+			continue
+		}
+		reachable++
+		for i := range resp.Images {
+			resp.Images[i].Host = peer.Name
+		}
+		images = append(images, resp.Images...)
+	}
+
+	if reachable == 0 {
+		return nil, types.NewError(types.ErrCodePeerUnavailable, fmt.Errorf("no fleet peer reachable"), nil)
+	}
+	return images, nil
+}
+
+// ListVolumes returns the volumes of all reachable peers.
+// Unreachable peers are logged and omitted.
+func (c *Coordinator) ListVolumes() ([]types.Volume, error) {
+	var volumes []types.Volume
+	reachable := 0
+
+	for _, peer := range c.peers {
+		var resp types.VolumeListResponse
+		if err := c.do(context.Background(), peer, http.MethodGet, "/api/v2/volumes", nil, &resp); err != nil {
+			logrus.WithError(err).WithField("peer", peer.Name).Warn("Failed to list fleet peer volumes")
+			continue
+		}
+		reachable++
+		for i := range resp.Volumes {
+			resp.Volumes[i].Host = peer.Name
+		}
+		volumes = append(volumes, resp.Volumes...)
+	}
+
+	if reachable == 0 {
+		return nil, types.NewError(types.ErrCodePeerUnavailable, fmt.Errorf("no fleet peer reachable"), nil)
+	}
+	return volumes, nil
+}
+
+// ListCleanups returns the pending cleanups of all reachable peers.
+// Unreachable peers are logged and omitted.
+func (c *Coordinator) ListCleanups() ([]types.PendingCleanup, error) {
+	var cleanups []types.PendingCleanup
+	reachable := 0
+
+	for _, peer := range c.peers {
+		var resp types.CleanupListResponse
+		if err := c.do(context.Background(), peer, http.MethodGet, "/api/v2/cleanups", nil, &resp); err != nil {
+			logrus.WithError(err).WithField("peer", peer.Name).Warn("Failed to list fleet peer pending cleanups")
+			continue
+		}
+		reachable++
+		for i := range resp.Cleanups {
+			resp.Cleanups[i].Host = peer.Name
+		}
+		cleanups = append(cleanups, resp.Cleanups...)
+	}
+
+	if reachable == 0 {
+		return nil, types.NewError(types.ErrCodePeerUnavailable, fmt.Errorf("no fleet peer reachable"), nil)
+	}
+	return cleanups, nil
+}
+
+// ReconcileVolumes returns the reconciliation reports of all reachable peers, merged.
+// Unreachable peers are logged and omitted.
+func (c *Coordinator) ReconcileVolumes(ctx context.Context) (*types.ReconciliationReport, error) {
+	report := &types.ReconciliationReport{
+		Volumes:  []types.ReconciledVolume{},
+		Findings: []types.ReconciliationFinding{},
+	}
+	reachable := 0
+
+	for _, peer := range c.peers {
+		var resp types.ReconciliationReport
+		if err := c.do(ctx, peer, http.MethodGet, "/api/v2/reconciliation", nil, &resp); err != nil {
+			logrus.WithError(err).WithField("peer", peer.Name).Warn("Failed to reconcile fleet peer volumes")
+			continue
+		}
+		reachable++
+		for i := range resp.Volumes {
+			resp.Volumes[i].Host = peer.Name
+		}
+		for i := range resp.Findings {
+			resp.Findings[i].Host = peer.Name
+		}
+		report.Volumes = append(report.Volumes, resp.Volumes...)
+		report.Findings = append(report.Findings, resp.Findings...)
+	}
+
+	if reachable == 0 {
+		return nil, types.NewError(types.ErrCodePeerUnavailable, fmt.Errorf("no fleet peer reachable"), nil)
+	}
+	return report, nil
+}
+
+// ListImageVolumes returns the volumes built from an image on all reachable peers.
+// Unreachable peers are logged and omitted.
+func (c *Coordinator) ListImageVolumes(checksum string, includeDeleted bool) ([]types.ProvisionedVolume, error) {
+	path := "/api/v2/images/" + url.PathEscape(checksum) + "/volumes"
+	if includeDeleted {
+		path += "?include_deleted=true"
+	}
+
+	var volumes []types.ProvisionedVolume
+	reachable := 0
+
+	for _, peer := range c.peers {
+		var resp types.ImageVolumesResponse
+		if err := c.do(context.Background(), peer, http.MethodGet, path, nil, &resp); err != nil {
+			logrus.WithError(err).WithField("peer", peer.Name).Warn("Failed to list fleet peer image volumes")
+			continue
+		}
+		reachable++
+		for i := range resp.Volumes {
+			resp.Volumes[i].Host = peer.Name
+		}
+		volumes = append(volumes, resp.Volumes...)
+	}
+
+	if reachable == 0 {
+		return nil, types.NewError(types.ErrCodePeerUnavailable, fmt.Errorf("no fleet peer reachable"), nil)
+	}
+	return volumes, nil
+}
+
+// peerCapacity returns the image cache pools of a single peer
+func (c *Coordinator) peerCapacity(ctx context.Context, peer Peer) ([]types.PoolCapacity, error) {
+	var capacity types.CapacityResponse
+	if err := c.do(ctx, peer, http.MethodGet, "/api/v2/capacity", nil, &capacity); err != nil {
+		return nil, err
+	}
+
+	for i := range capacity.Pools {
+		capacity.Pools[i].Host = peer.Name
+	}
+	return capacity.Pools, nil
+}
+
+// selectPeer returns the requested target host, or the reachable peer whose
+// cache pool has the most available space
+func (c *Coordinator) selectPeer(ctx context.Context, req types.ProvisionRequest) (Peer, error) {
+	if req.TargetHost != "" {
+		peer, ok := c.peer(req.TargetHost)
+		if !ok {
+			return Peer{}, types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("unknown target host: %s", req.TargetHost), nil)
+		}
+		return peer, nil
+	}
+
+	var best Peer
+	var bestAvailable uint64
+	found := false
+
+	for _, peer := range c.peers {
+		pools, err := c.peerCapacity(ctx, peer)
+		if err != nil {
+			logrus.WithError(err).WithField("peer", peer.Name).Warn("Skipping unreachable fleet peer")
+			continue
+		}
+
+		for _, pool := range pools {
+			if (req.CachePool == "" && !pool.Default) || (req.CachePool != "" && pool.Name != req.CachePool) {
+				continue
+			}
+			if !found || pool.AvailableBytes > bestAvailable {
+				best, bestAvailable, found = peer, pool.AvailableBytes, true
+			}
+		}
+	}
+
+	if !found {
+		return Peer{}, types.NewError(types.ErrCodePeerUnavailable,
+			fmt.Errorf("no fleet peer available for cache pool '%s'", req.CachePool), nil)
+	}
+	return best, nil
+}
+
+// peer looks up a peer by name
+func (c *Coordinator) peer(name string) (Peer, bool) {
+	for _, peer := range c.peers {
+		if peer.Name == name {
+			return peer, true
+		}
+	}
+	return Peer{}, false
+}
+
+// routeDependencies sends a job with dependencies to the peer running them, replacing
+// their fleet job IDs with the peer's. A job cannot depend on jobs of other peers.
+func (c *Coordinator) routeDependencies(req types.ProvisionRequest) (types.ProvisionRequest, error) {
+	if len(req.DependsOn) == 0 {
+		return req, nil
+	}
+
+	dependsOn := make([]string, 0, len(req.DependsOn))
+	for _, jobID := range req.DependsOn {
+		peer, peerJobID, err := c.splitJobID(jobID)
+		if err != nil {
+			return req, types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("unknown dependency: %s", jobID),
+				map[string]string{"depends_on": "exists"})
+		}
+		if req.TargetHost == "" {
+			req.TargetHost = peer.Name
+		} else if req.TargetHost != peer.Name {
+			return req, types.NewError(types.ErrCodeInvalidRequest,
+				fmt.Errorf("dependency %s does not run on %s", jobID, req.TargetHost),
+				map[string]string{"depends_on": "same_host"})
+		}
+		dependsOn = append(dependsOn, peerJobID)
+	}
+	req.DependsOn = dependsOn
+	return req, nil
+}
+
+// splitJobID resolves a coordinator job ID to the peer and the peer's job ID
+func (c *Coordinator) splitJobID(jobID string) (Peer, string, error) {
+	name, peerJobID, ok := strings.Cut(jobID, jobIDSeparator)
+	if !ok || peerJobID == "" {
+		return Peer{}, "", types.NewError(types.ErrCodeJobNotFound, fmt.Errorf("job not found: %s", jobID), nil)
+	}
+
+	peer, ok := c.peer(name)
+	if !ok {
+		return Peer{}, "", types.NewError(types.ErrCodeJobNotFound, fmt.Errorf("job not found: %s", jobID), nil)
+	}
+	return peer, peerJobID, nil
+}
+
+// do sends an authenticated API request to a peer, encoding body and decoding the
+// response into out when they are set
+func (c *Coordinator) do(ctx context.Context, peer Peer, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, peer.URL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return types.NewError(types.ErrCodePeerUnavailable, fmt.Errorf("peer %s: request failed: %w", peer.Name, err), nil)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp types.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && errResp.Message != "" {
+			peerErr := fmt.Errorf("peer %s: %s: %s", peer.Name, errResp.Error, errResp.Message)
+			if errResp.ErrorCode != "" {
+				return types.NewError(errResp.ErrorCode, peerErr, errResp.Details)
+			}
+			return peerErr
+		}
+		return fmt.Errorf("peer %s: unexpected status %d", peer.Name, resp.StatusCode)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("peer %s: failed to decode response: %w", peer.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePeer is a minimal provisioner API used as a fleet peer
+type fakePeer struct {
+	available uint64
+	status    types.JobStatus
+	requests  []types.ProvisionRequest
+	cancelled []string
+	actions   []string
+	bulk      []types.BulkCancelRequest
+}
+
+func (p *fakePeer) server(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2/capacity", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		_ = json.NewEncoder(w).Encode(types.CapacityResponse{Pools: []types.PoolCapacity{
+			{Name: "images", Default: true, AvailableBytes: p.available},
+			{Name: "fast-images", AvailableBytes: 1},
+		}})
+	})
+	mux.HandleFunc("GET /api/v2/volumes", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(types.VolumeListResponse{Volumes: []types.Volume{
+			{Name: "vm-disk", DevicePath: "/dev/data/vm-disk", SizeBytes: 10 << 30},
+		}})
+	})
+	mux.HandleFunc("GET /api/v2/cleanups", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(types.CleanupListResponse{Cleanups: []types.PendingCleanup{
+			{VolumeName: "vm-disk", JobID: "job-1", Attempts: 1},
+		}})
+	})
+	mux.HandleFunc("GET /api/v2/reconciliation", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(types.ReconciliationReport{
+			Volumes: []types.ReconciledVolume{{Name: "vm-disk", SizeBytes: 10 << 30}},
+			Findings: []types.ReconciliationFinding{
+				{Kind: types.FindingOrphanVolume, VolumeName: "vm-disk", Message: "volume vm-disk is not used"},
+			},
+		})
+	})
+	mux.HandleFunc("GET /api/v2/images/{checksum}/volumes", func(w http.ResponseWriter, r *http.Request) {
+		volumes := []types.ProvisionedVolume{{Name: "vm-disk", ImageChecksum: r.PathValue("checksum")}}
+		if r.URL.Query().Get("include_deleted") == "true" {
+			volumes = append(volumes, types.ProvisionedVolume{Name: "old-disk", ImageChecksum: r.PathValue("checksum")})
+		}
+		_ = json.NewEncoder(w).Encode(types.ImageVolumesResponse{Checksum: r.PathValue("checksum"), Volumes: volumes})
+	})
+	mux.HandleFunc("POST /api/v2/provision", func(w http.ResponseWriter, r *http.Request) {
+		var req types.ProvisionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		p.requests = append(p.requests, req)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(types.ProvisionResponse{JobID: "job-1"})
+	})
+	mux.HandleFunc("GET /api/v2/status/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "job-1" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(types.ErrorResponse{Error: "job not found", Message: "job not found: x", Code: 404})
+			return
+		}
+		cacheHit := true
+		_ = json.NewEncoder(w).Encode(types.StatusResponse{
+			JobID: "job-1", Status: p.status, CacheHit: &cacheHit, ImagePath: "/var/lib/libvirt/images/ubuntu",
+		})
+	})
+	mux.HandleFunc("DELETE /api/v2/cancel/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p.cancelled = append(p.cancelled, r.PathValue("id"))
+		_, _ = w.Write([]byte(`{"status": "cancelled"}`))
+	})
+	mux.HandleFunc("POST /api/v2/jobs/cancel", func(w http.ResponseWriter, r *http.Request) {
+		var req types.BulkCancelRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		p.bulk = append(p.bulk, req)
+		_ = json.NewEncoder(w).Encode(types.BulkCancelResponse{
+			Cancelled: []string{"job-1"},
+			Failed:    map[string]string{"job-2": "job cannot be cancelled: completed"},
+		})
+	})
+	mux.HandleFunc("POST /api/v2/jobs/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		p.actions = append(p.actions, r.PathValue("id")+" "+r.PathValue("action"))
+		_, _ = w.Write([]byte(`{}`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestFleet(t *testing.T) (*Coordinator, *fakePeer, *fakePeer) {
+	t.Helper()
+	hv1 := &fakePeer{available: 100, status: types.StatusRunning}
+	hv2 := &fakePeer{available: 500, status: types.StatusRunning}
+	srv1 := hv1.server(t)
+	srv2 := hv2.server(t)
+	t.Cleanup(srv1.Close)
+	t.Cleanup(srv2.Close)
+
+	coordinator, err := NewCoordinator([]Peer{{Name: "hv1", URL: srv1.URL}, {Name: "hv2", URL: srv2.URL}}, "secret", nil)
+	require.NoError(t, err)
+	return coordinator, hv1, hv2
+}
+
+func TestParsePeers(t *testing.T) {
+	peers, err := ParsePeers("hv1=https://hv1:8080/, hv2=http://hv2:8080")
+	require.NoError(t, err)
+	assert.Equal(t, []Peer{{Name: "hv1", URL: "https://hv1:8080"}, {Name: "hv2", URL: "http://hv2:8080"}}, peers)
+
+	for _, spec := range []string{"", "hv1", "hv:1=https://hv1", "hv1=ftp://hv1", "hv1=https://a,hv1=https://b"} {
+		_, err := ParsePeers(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestStartJobSelectsPeerByCapacity(t *testing.T) {
+	coordinator, hv1, hv2 := newTestFleet(t)
+
+	jobID, err := coordinator.StartJob(types.ProvisionRequest{VolumeName: "vm-disk", VolumeSizeGB: 10})
+	require.NoError(t, err)
+	assert.Equal(t, "hv2:job-1", jobID)
+	assert.Empty(t, hv1.requests)
+	assert.Len(t, hv2.requests, 1)
+	assert.Equal(t, 1, coordinator.GetActiveJobs())
+
+	// The named cache pool is used for selection when given
+	hv1.available = 1000
+	jobID, err = coordinator.StartJob(types.ProvisionRequest{VolumeName: "vm-disk", CachePool: "images"})
+	require.NoError(t, err)
+	assert.Equal(t, "hv1:job-1", jobID)
+}
+
+func TestStartJobTargetHost(t *testing.T) {
+	coordinator, hv1, _ := newTestFleet(t)
+
+	jobID, err := coordinator.StartJob(types.ProvisionRequest{VolumeName: "vm-disk", TargetHost: "hv1"})
+	require.NoError(t, err)
+	assert.Equal(t, "hv1:job-1", jobID)
+	require.Len(t, hv1.requests, 1)
+	assert.Empty(t, hv1.requests[0].TargetHost)
+
+	_, err = coordinator.StartJob(types.ProvisionRequest{VolumeName: "vm-disk", TargetHost: "hv3"})
+	assert.ErrorContains(t, err, "unknown target host")
+}
+
+func TestStartJobDependencies(t *testing.T) {
+	coordinator, hv1, hv2 := newTestFleet(t)
+
+	// A job runs on the peer of the jobs it depends on, with their peer job IDs
+	jobID, err := coordinator.StartJob(types.ProvisionRequest{VolumeName: "vm-disk", DependsOn: []string{"hv1:job-1"}})
+	require.NoError(t, err)
+	assert.Equal(t, "hv1:job-1", jobID)
+	require.Len(t, hv1.requests, 1)
+	assert.Equal(t, []string{"job-1"}, hv1.requests[0].DependsOn)
+	assert.Empty(t, hv2.requests)
+
+	_, err = coordinator.StartJob(types.ProvisionRequest{VolumeName: "vm-disk", DependsOn: []string{"hv1:a", "hv2:b"}})
+	assert.ErrorContains(t, err, "does not run on hv1")
+
+	_, err = coordinator.StartJob(types.ProvisionRequest{VolumeName: "vm-disk", DependsOn: []string{"hv3:job-1"}})
+	code, _ := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeInvalidRequest, code)
+}
+
+func TestGetJobStatus(t *testing.T) {
+	coordinator, _, hv2 := newTestFleet(t)
+
+	jobID, err := coordinator.StartJob(types.ProvisionRequest{VolumeName: "vm-disk"})
+	require.NoError(t, err)
+
+	status, err := coordinator.GetJobStatus(jobID)
+	require.NoError(t, err)
+	assert.Equal(t, "hv2:job-1", status.JobID)
+	assert.Equal(t, "hv2", status.Host)
+	assert.Equal(t, types.StatusRunning, status.Status)
+
+	_, _, err = coordinator.GetJobCacheInfo(jobID)
+	assert.ErrorContains(t, err, "not completed")
+
+	hv2.status = types.StatusCompleted
+	cacheHit, imagePath, err := coordinator.GetJobCacheInfo(jobID)
+	require.NoError(t, err)
+	assert.True(t, cacheHit)
+	assert.Equal(t, "/var/lib/libvirt/images/ubuntu", imagePath)
+	assert.Equal(t, 0, coordinator.GetActiveJobs())
+
+	for _, id := range []string{"job-1", "hv3:job-1", "hv2:job-2"} {
+		_, err := coordinator.GetJobStatus(id)
+		assert.Error(t, err, id)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	coordinator, hv1, _ := newTestFleet(t)
+
+	require.NoError(t, coordinator.CancelJob("hv1:job-1"))
+	assert.Equal(t, []string{"job-1"}, hv1.cancelled)
+}
+
+func TestCancelJobs(t *testing.T) {
+	coordinator, hv1, hv2 := newTestFleet(t)
+
+	req := types.BulkCancelRequest{CorrelationIDPrefix: "rollout-42"}
+	response, err := coordinator.CancelJobs(req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hv1:job-1", "hv2:job-1"}, response.Cancelled)
+	assert.Len(t, response.Failed, 2)
+	assert.Contains(t, response.Failed, "hv2:job-2")
+	assert.Equal(t, []types.BulkCancelRequest{req}, hv1.bulk)
+
+	// Requests without a filter are not forwarded
+	_, err = coordinator.CancelJobs(types.BulkCancelRequest{})
+	assert.Error(t, err)
+	assert.Len(t, hv2.bulk, 1)
+}
+
+func TestPauseResumeJob(t *testing.T) {
+	coordinator, _, hv2 := newTestFleet(t)
+
+	require.NoError(t, coordinator.PauseJob("hv2:job-1"))
+	require.NoError(t, coordinator.ResumeJob("hv2:job-1"))
+	assert.Equal(t, []string{"job-1 pause", "job-1 resume"}, hv2.actions)
+}
+
+func TestGetCapacity(t *testing.T) {
+	coordinator, _, _ := newTestFleet(t)
+
+	pools, err := coordinator.GetCapacity()
+	require.NoError(t, err)
+	require.Len(t, pools, 4)
+	assert.Equal(t, "hv1", pools[0].Host)
+	assert.Equal(t, "hv2", pools[2].Host)
+}
+
+func TestListVolumes(t *testing.T) {
+	coordinator, _, _ := newTestFleet(t)
+
+	volumes, err := coordinator.ListVolumes()
+	require.NoError(t, err)
+	require.Len(t, volumes, 2)
+	assert.Equal(t, "hv1", volumes[0].Host)
+	assert.Equal(t, "hv2", volumes[1].Host)
+
+	// Peers without the endpoint are skipped like unreachable peers
+	_, err = coordinator.ListCachedImages()
+	assert.ErrorContains(t, err, "no fleet peer reachable")
+}
+
+func TestListCleanups(t *testing.T) {
+	coordinator, _, _ := newTestFleet(t)
+
+	cleanups, err := coordinator.ListCleanups()
+	require.NoError(t, err)
+	require.Len(t, cleanups, 2)
+	assert.Equal(t, "hv1", cleanups[0].Host)
+	assert.Equal(t, "hv2", cleanups[1].Host)
+	assert.Equal(t, "job-1", cleanups[1].JobID)
+}
+
+func TestReconcileVolumes(t *testing.T) {
+	coordinator, _, _ := newTestFleet(t)
+
+	report, err := coordinator.ReconcileVolumes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, report.Volumes, 2)
+	assert.Equal(t, "hv2", report.Volumes[1].Host)
+	require.Len(t, report.Findings, 2)
+	assert.Equal(t, "hv1", report.Findings[0].Host)
+	assert.Equal(t, types.FindingOrphanVolume, report.Findings[1].Kind)
+}
+
+func TestListImageVolumes(t *testing.T) {
+	coordinator, _, _ := newTestFleet(t)
+
+	volumes, err := coordinator.ListImageVolumes("abc123", false)
+	require.NoError(t, err)
+	require.Len(t, volumes, 2)
+	assert.Equal(t, "hv1", volumes[0].Host)
+	assert.Equal(t, "hv2", volumes[1].Host)
+	assert.Equal(t, "abc123", volumes[1].ImageChecksum)
+
+	volumes, err = coordinator.ListImageVolumes("abc123", true)
+	require.NoError(t, err)
+	assert.Len(t, volumes, 4)
+}
+
+func TestGetCapacityUnreachable(t *testing.T) {
+	coordinator, err := NewCoordinator([]Peer{{Name: "hv1", URL: "http://127.0.0.1:1"}}, "secret", nil)
+	require.NoError(t, err)
+
+	_, err = coordinator.GetCapacity()
+	assert.ErrorContains(t, err, "no fleet peer reachable")
+
+	_, err = coordinator.StartJob(types.ProvisionRequest{VolumeName: "vm-disk"})
+	assert.ErrorContains(t, err, "no fleet peer available")
+}
@@ -0,0 +1,266 @@
+// Package intake receives provisioning requests from message queues and publishes
+// job status events back, for deployments without inbound HTTP connectivity.
+package intake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultPollInterval is how often job status is checked for changes to publish
+const defaultPollInterval = 2 * time.Second
+
+// Identity is the client identity of jobs submitted over NATS, e.g. in TENANT_PREFIXES
+const Identity = "nats"
+
+// JobManager is the subset of job operations used by the consumer
+type JobManager interface {
+	StartJob(req types.ProvisionRequest) (string, error)
+	GetJobStatus(jobID string) (*types.StatusResponse, error)
+}
+
+// TenantChecker confines clients to the volumes of their tenant. It is implemented
+// by *auth.Tenants.
+type TenantChecker interface {
+	Check(identity, volumeName string) error
+}
+
+// publisher publishes messages to a subject; it is implemented by *nats.Conn
+type publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// Config holds NATS consumer configuration
+type Config struct {
+	URL           string
+	Subject       string
+	QueueGroup    string
+	StatusSubject string
+	CredsFile     string
+	// Tenants, if set, confines requests to the volumes of the tenant of Identity
+	Tenants TenantChecker
+}
+
+// Consumer receives ProvisionRequests from a NATS subject and publishes job status events
+type Consumer struct {
+	conn          *nats.Conn
+	sub           *nats.Subscription
+	publisher     publisher
+	jobManager    JobManager
+	tenants       TenantChecker
+	statusSubject string
+	pollInterval  time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewConsumer connects to NATS and subscribes to the request subject
+func NewConsumer(config Config, jobManager JobManager) (*Consumer, error) {
+	if config.Subject == "" {
+		return nil, fmt.Errorf("NATS request subject must not be empty")
+	}
+	if config.StatusSubject == "" {
+		return nil, fmt.Errorf("NATS status subject must not be empty")
+	}
+
+	options := []nats.Option{
+		nats.Name("libvirt-volume-provisioner"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			logrus.WithError(err).Warn("Disconnected from NATS")
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			logrus.WithField("url", conn.ConnectedUrl()).Info("Reconnected to NATS")
+		}),
+	}
+	if config.CredsFile != "" {
+		options = append(options, nats.UserCredentials(config.CredsFile))
+	}
+
+	conn, err := nats.Connect(config.URL, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	c := newConsumer(conn, jobManager, config.StatusSubject)
+	c.conn = conn
+	c.tenants = config.Tenants
+
+	handler := func(msg *nats.Msg) { c.handleRequest(msg.Data, msg.Reply) }
+	if config.QueueGroup != "" {
+		c.sub, err = conn.QueueSubscribe(config.Subject, config.QueueGroup, handler)
+	} else {
+		c.sub, err = conn.Subscribe(config.Subject, handler)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", config.Subject, err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"subject":        config.Subject,
+		"queue_group":    config.QueueGroup,
+		"status_subject": config.StatusSubject,
+	}).Info("Subscribed to NATS provisioning requests")
+	return c, nil
+}
+
+// newConsumer creates a consumer that publishes through p
+func newConsumer(p publisher, jobManager JobManager, statusSubject string) *Consumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Consumer{
+		publisher:     p,
+		jobManager:    jobManager,
+		statusSubject: statusSubject,
+		pollInterval:  defaultPollInterval,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Close stops receiving requests, stops watching jobs and closes the connection
+func (c *Consumer) Close() {
+	if c.sub != nil {
+		_ = c.sub.Drain() // Ignore error, the connection is being closed
+	}
+	c.cancel()
+	c.wg.Wait()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// handleRequest starts a job for a request message, replies with the job ID
+// if the sender expects a reply, and watches the job to publish its status
+func (c *Consumer) handleRequest(data []byte, reply string) {
+	var req types.ProvisionRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.replyError(reply, types.NewErrorResponse(400, "invalid request", err, types.ErrCodeInvalidRequest))
+		return
+	}
+	if req.VolumeName == "" || (req.Profile == "" && ((req.NeedsImage() && req.ImageURL == "") || !req.HasSize())) {
+		c.replyError(reply, types.ErrorResponse{
+			Error:     "invalid request",
+			Message:   "volume_name is required, and image_url and a volume size are required unless a profile is given, and image_url unless type is blank",
+			Code:      400,
+			ErrorCode: types.ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	req.Identity = Identity
+	if c.tenants != nil {
+		if err := c.tenants.Check(req.Identity, req.VolumeName); err != nil {
+			c.replyError(reply, types.NewErrorResponse(403, "volume outside tenant", err, types.ErrCodeInternal))
+			return
+		}
+	}
+	jobID, err := c.jobManager.StartJob(req)
+	if err != nil {
+		logrus.WithError(err).WithField("volume", req.VolumeName).Error("Failed to start job from NATS request")
+		response := types.NewErrorResponse(400, "failed to start provisioning", err, types.ErrCodeInternal)
+		c.replyError(reply, response)
+		c.publishEvent(types.JobEvent{
+			VolumeName: req.VolumeName,
+			Status:     types.StatusFailed,
+			Error:      err.Error(),
+			ErrorCode:  response.ErrorCode,
+			Timestamp:  time.Now(),
+		})
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"job_id": jobID,
+		"volume": req.VolumeName,
+	}).Info("Started job from NATS request")
+
+	if reply != "" {
+		c.publish(reply, types.ProvisionResponse{JobID: jobID})
+	}
+
+	c.wg.Add(1)
+	go c.watchJob(jobID, req.VolumeName)
+}
+
+// watchJob publishes an event whenever the job's status or stage changes, until it finishes
+func (c *Consumer) watchJob(jobID, volumeName string) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	var last types.JobEvent
+	for {
+		status, err := c.jobManager.GetJobStatus(jobID)
+		if err != nil {
+			logrus.WithError(err).WithField("job_id", jobID).Warn("Stopped watching job")
+			return
+		}
+
+		event := types.JobEvent{
+			JobID:      jobID,
+			VolumeName: volumeName,
+			Status:     status.Status,
+			Error:      status.Error,
+			ErrorCode:  status.ErrorCode,
+		}
+		if status.Progress != nil {
+			event.Stage = status.Progress.Stage
+		}
+
+		if event.Status != last.Status || event.Stage != last.Stage {
+			last = event
+			event.Timestamp = time.Now()
+			c.publishEvent(event)
+		}
+
+		if status.Status == types.StatusCompleted || status.Status == types.StatusFailed {
+			return
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishEvent publishes a job status event to the status subject
+func (c *Consumer) publishEvent(event types.JobEvent) {
+	c.publish(c.statusSubject, event)
+}
+
+// replyError sends an error response if the sender expects a reply
+func (c *Consumer) replyError(reply string, response types.ErrorResponse) {
+	if reply == "" {
+		logrus.WithFields(logrus.Fields{
+			"message":    response.Message,
+			"error_code": response.ErrorCode,
+		}).Warn("Rejected NATS provisioning request")
+		return
+	}
+	c.publish(reply, response)
+}
+
+// publish encodes v as JSON and publishes it to subject, logging failures
+func (c *Consumer) publish(subject string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode NATS message")
+		return
+	}
+	if err := c.publisher.Publish(subject, data); err != nil {
+		logrus.WithError(err).WithField("subject", subject).Warn("Failed to publish NATS message")
+	}
+}
@@ -0,0 +1,166 @@
+package intake
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/auth"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type message struct {
+	subject string
+	data    []byte
+}
+
+type fakePublisher struct {
+	mu       sync.Mutex
+	messages []message
+}
+
+func (p *fakePublisher) Publish(subject string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, message{subject: subject, data: data})
+	return nil
+}
+
+func (p *fakePublisher) on(subject string) []message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var messages []message
+	for _, m := range p.messages {
+		if m.subject == subject {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+type fakeJobManager struct {
+	mu       sync.Mutex
+	statuses []types.StatusResponse // returned in order, the last one repeats
+	startErr error
+	started  []types.ProvisionRequest
+}
+
+func (f *fakeJobManager) StartJob(req types.ProvisionRequest) (string, error) {
+	f.mu.Lock()
+	f.started = append(f.started, req)
+	f.mu.Unlock()
+	if f.startErr != nil {
+		return "", f.startErr
+	}
+	return "job-1", nil
+}
+
+func (f *fakeJobManager) GetJobStatus(_ string) (*types.StatusResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := f.statuses[0]
+	if len(f.statuses) > 1 {
+		f.statuses = f.statuses[1:]
+	}
+	return &status, nil
+}
+
+func provisionRequest(t *testing.T) []byte {
+	t.Helper()
+	data, err := json.Marshal(types.ProvisionRequest{
+		ImageURL:     "https://minio/images/ubuntu.qcow2",
+		VolumeName:   "vm-disk",
+		VolumeSizeGB: 10,
+	})
+	require.NoError(t, err)
+	return data
+}
+
+func TestHandleRequest(t *testing.T) {
+	publisher := &fakePublisher{}
+	jobManager := &fakeJobManager{statuses: []types.StatusResponse{
+		{Status: types.StatusRunning, Progress: &types.ProgressInfo{Stage: "checking_cache"}},
+		{Status: types.StatusRunning, Progress: &types.ProgressInfo{Stage: "checking_cache"}},
+		{Status: types.StatusRunning, Progress: &types.ProgressInfo{Stage: "converting"}},
+		{Status: types.StatusCompleted, Progress: &types.ProgressInfo{Stage: "finalizing"}},
+	}}
+	consumer := newConsumer(publisher, jobManager, "provisioner.status")
+	consumer.pollInterval = time.Millisecond
+
+	consumer.handleRequest(provisionRequest(t), "reply.1")
+	consumer.wg.Wait()
+
+	replies := publisher.on("reply.1")
+	require.Len(t, replies, 1)
+	var resp types.ProvisionResponse
+	require.NoError(t, json.Unmarshal(replies[0].data, &resp))
+	assert.Equal(t, "job-1", resp.JobID)
+
+	var stages []string
+	for _, m := range publisher.on("provisioner.status") {
+		var event types.JobEvent
+		require.NoError(t, json.Unmarshal(m.data, &event))
+		assert.Equal(t, "job-1", event.JobID)
+		assert.Equal(t, "vm-disk", event.VolumeName)
+		stages = append(stages, fmt.Sprintf("%s/%s", event.Status, event.Stage))
+	}
+	assert.Equal(t, []string{"running/checking_cache", "running/converting", "completed/finalizing"}, stages)
+}
+
+func TestHandleRequestInvalid(t *testing.T) {
+	publisher := &fakePublisher{}
+	consumer := newConsumer(publisher, &fakeJobManager{}, "provisioner.status")
+
+	consumer.handleRequest([]byte(`{"volume_name": "vm-disk"}`), "reply.1")
+	consumer.handleRequest([]byte(`not json`), "reply.2")
+	consumer.handleRequest([]byte(`not json`), "")
+
+	for _, reply := range []string{"reply.1", "reply.2"} {
+		replies := publisher.on(reply)
+		require.Len(t, replies, 1)
+		var resp types.ErrorResponse
+		require.NoError(t, json.Unmarshal(replies[0].data, &resp))
+		assert.Equal(t, "invalid request", resp.Error)
+	}
+	assert.Empty(t, publisher.on("provisioner.status"))
+}
+
+func TestHandleRequestStartFailure(t *testing.T) {
+	publisher := &fakePublisher{}
+	consumer := newConsumer(publisher, &fakeJobManager{startErr: fmt.Errorf("unknown cache pool: x")}, "provisioner.status")
+
+	consumer.handleRequest(provisionRequest(t), "")
+
+	events := publisher.on("provisioner.status")
+	require.Len(t, events, 1)
+	var event types.JobEvent
+	require.NoError(t, json.Unmarshal(events[0].data, &event))
+	assert.Equal(t, types.StatusFailed, event.Status)
+	assert.Equal(t, "vm-disk", event.VolumeName)
+	assert.Contains(t, event.Error, "unknown cache pool")
+}
+
+func TestHandleRequestOutsideTenant(t *testing.T) {
+	tenants, err := auth.ParseTenants("nats=team-a-", false)
+	require.NoError(t, err)
+	publisher := &fakePublisher{}
+	jobManager := &fakeJobManager{}
+	consumer := newConsumer(publisher, jobManager, "provisioner.status")
+	consumer.tenants = tenants
+
+	consumer.handleRequest(provisionRequest(t), "reply.1")
+
+	replies := publisher.on("reply.1")
+	require.Len(t, replies, 1)
+	var resp types.ErrorResponse
+	require.NoError(t, json.Unmarshal(replies[0].data, &resp))
+	assert.Equal(t, 403, resp.Code)
+	assert.Equal(t, types.ErrCodeVolumeOutsideTenant, resp.ErrorCode)
+	assert.Equal(t, "team-a-", resp.Details["prefix"])
+	assert.Empty(t, jobManager.started)
+	assert.Empty(t, publisher.on("provisioner.status"))
+}
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// AdoptVolume records a volume created outside the provisioner, such as one made by
+// hand before the provisioner was deployed, in the volume records, optionally with the
+// image it was built from. Volumes being provisioned, left incomplete by an interrupted
+// job or already recorded are refused.
+func (m *Manager) AdoptVolume(volumeName string, req types.VolumeAdoptionRequest) (*types.ProvisionedVolume, error) {
+	if m.lvmManager == nil {
+		return nil, types.NewError(types.ErrCodeNotSupported, fmt.Errorf("LVM is not configured"), nil)
+	}
+	if m.store == nil {
+		return nil, types.NewError(types.ErrCodeNotSupported,
+			fmt.Errorf("volume records are not available without a database"), nil)
+	}
+	if err := validateVolumeName(volumeName); err != nil {
+		return nil, err
+	}
+
+	if jobID := m.activeJobForVolume(volumeName); jobID != "" {
+		return nil, types.NewError(types.ErrCodeVolumeInUse,
+			fmt.Errorf("volume %s is being provisioned by job %s", volumeName, jobID), map[string]string{"job_id": jobID})
+	}
+	if !m.lvmManager.VolumeExists(volumeName) {
+		return nil, volumeNotFound(volumeName)
+	}
+	incomplete, err := m.lvmManager.IncompleteVolumes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check whether the volume is incomplete: %w", err)
+	}
+	if slices.Contains(incomplete, volumeName) {
+		return nil, types.NewError(types.ErrCodeVolumeInUse,
+			fmt.Errorf("volume %s was left incomplete by an interrupted job", volumeName), nil)
+	}
+
+	volumeGroup := m.lvmManager.VolumeGroup()
+	records, err := m.store.ListVolumes(storage.ListVolumesFilter{
+		Name:        volumeName,
+		VolumeGroup: volumeGroup,
+		Limit:       1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up volume record: %w", err)
+	}
+	if len(records) > 0 {
+		details := map[string]string{}
+		if records[0].JobID != "" {
+			details["job_id"] = records[0].JobID
+		}
+		return nil, types.NewError(types.ErrCodeVolumeAlreadyManaged,
+			fmt.Errorf("volume %s is already recorded", volumeName), details)
+	}
+
+	info, err := m.lvmManager.GetVolumeInfo(volumeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume info: %w", err)
+	}
+
+	record := &storage.VolumeRecord{
+		Name:          volumeName,
+		VolumeGroup:   volumeGroup,
+		SizeGB:        int((info.SizeBytes + 1<<30 - 1) >> 30),
+		ImageURL:      req.ImageURL,
+		ImageChecksum: req.ImageChecksum,
+		CreatedAt:     time.Now(),
+	}
+	if err := m.store.SaveVolume(context.Background(), record); err != nil {
+		return nil, fmt.Errorf("failed to record volume: %w", err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"volume_name":  volumeName,
+		"volume_group": volumeGroup,
+		"image_url":    req.ImageURL,
+	}).Info("Adopted volume")
+
+	return &types.ProvisionedVolume{
+		Name:          record.Name,
+		VolumeGroup:   record.VolumeGroup,
+		SizeGB:        record.SizeGB,
+		ImageURL:      record.ImageURL,
+		ImageChecksum: record.ImageChecksum,
+		Adopted:       true,
+		CreatedAt:     record.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdoptVolume(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	volumes := newFakeVolumeManager("legacy-root", "leaked-root", "busy-root")
+	volumes.volumes["legacy-root"] = 20<<30 + 1
+	volumes.incomplete["leaked-root"] = true
+	manager := NewManager(&fakeImageStore{}, volumes, nil, store)
+	manager.jobs["busy-job"] = &Job{
+		ID:      "busy-job",
+		Status:  types.StatusRunning,
+		Request: types.ProvisionRequest{VolumeName: "busy-root"},
+	}
+
+	req := types.VolumeAdoptionRequest{ImageURL: testImageURL}
+	adopted, err := manager.AdoptVolume("legacy-root", req)
+	require.NoError(t, err)
+	assert.Equal(t, "data", adopted.VolumeGroup)
+	assert.Equal(t, 21, adopted.SizeGB)
+	assert.Equal(t, testImageURL, adopted.ImageURL)
+	assert.Empty(t, adopted.JobID)
+	assert.True(t, adopted.Adopted)
+
+	records, err := store.ListVolumes(storage.ListVolumesFilter{Name: "legacy-root"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, testImageURL, records[0].ImageURL)
+
+	tests := []struct {
+		volume string
+		code   types.ErrorCode
+	}{
+		{"legacy-root", types.ErrCodeVolumeAlreadyManaged},
+		{"missing-root", types.ErrCodeVolumeNotFound},
+		{"leaked-root", types.ErrCodeVolumeInUse},
+		{"busy-root", types.ErrCodeVolumeInUse},
+		{"../root", types.ErrCodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		_, err := manager.AdoptVolume(tt.volume, req)
+		code, _ := types.ErrorCodeOf(err, types.ErrCodeInternal)
+		assert.Equal(t, tt.code, code, tt.volume)
+	}
+}
+
+func TestAdoptVolume_NoDatabase(t *testing.T) {
+	manager := NewManager(&fakeImageStore{}, newFakeVolumeManager("legacy-root"), nil, nil)
+	_, err := manager.AdoptVolume("legacy-root", types.VolumeAdoptionRequest{})
+	code, _ := types.ErrorCodeOf(err, types.ErrCodeInternal)
+	assert.Equal(t, types.ErrCodeNotSupported, code)
+}
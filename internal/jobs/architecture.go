@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// architectureAliases maps the names Go and Debian use for CPU architectures to
+// the names libguestfs reports
+var architectureAliases = map[string]string{
+	"amd64":   "x86_64",
+	"arm64":   "aarch64",
+	"386":     "i386",
+	"i686":    "i386",
+	"ppc64el": "ppc64le",
+}
+
+// architectures are the CPU architectures requests may ask for
+var architectures = []string{"x86_64", "aarch64", "i386", "ppc64le", "s390x", "riscv64"}
+
+// normalizeArchitecture returns the libguestfs name of a CPU architecture
+func normalizeArchitecture(arch string) string {
+	arch = strings.ToLower(strings.TrimSpace(arch))
+	if alias, ok := architectureAliases[arch]; ok {
+		return alias
+	}
+	return arch
+}
+
+// HostArchitecture returns the CPU architecture of the provisioner's host
+func HostArchitecture() string {
+	return normalizeArchitecture(runtime.GOARCH)
+}
+
+// SetDefaultArchitecture sets the architecture images must be built for when a
+// request does not name one, e.g. the host's; empty leaves them unchecked
+func (m *Manager) SetDefaultArchitecture(arch string) {
+	m.defaultArchitecture = normalizeArchitecture(arch)
+}
+
+// requestArchitecture returns the architecture the image of a request must be built
+// for, normalized and defaulted, or an error if it is unknown
+func (m *Manager) requestArchitecture(req types.ProvisionRequest) (string, error) {
+	if !req.NeedsImage() {
+		if req.Architecture != "" {
+			return "", types.NewError(types.ErrCodeInvalidRequest,
+				fmt.Errorf("architecture only applies to image volumes"),
+				map[string]string{"architecture": "excluded"})
+		}
+		return "", nil
+	}
+
+	arch := normalizeArchitecture(req.Architecture)
+	if arch == "" {
+		return m.defaultArchitecture, nil
+	}
+	if !slices.Contains(architectures, arch) {
+		return "", types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("unknown architecture: %s", req.Architecture),
+			map[string]string{"architecture": "oneof=" + strings.Join(architectures, " ")})
+	}
+	return arch, nil
+}
+
+// checkArchitectureStep records the architecture of the image, from its metadata or
+// .arch file in MinIO or, if the request names an architecture, by inspecting the
+// image, and fails if it is not the architecture requested
+func (m *Manager) checkArchitectureStep(ctx context.Context, p *provision) error {
+	var arch string
+	if p.job.ImageMetadata != nil {
+		arch = p.job.ImageMetadata.Architecture
+	}
+	if arch == "" {
+		arch = m.sidecarArchitecture(ctx, p.req.ImageURL)
+	}
+	if arch == "" && p.req.Architecture != "" {
+		inspected, err := lvm.ImageArchitecture(p.imagePath, p.imageFormat())
+		if err != nil {
+			return types.NewError(types.ErrCodeArchitectureMismatch,
+				fmt.Errorf("could not determine image architecture: %w", err), commandDetails(err))
+		}
+		arch = normalizeArchitecture(inspected)
+	}
+	p.job.ImageArchitecture = arch
+
+	if p.req.Architecture != "" && arch != p.req.Architecture {
+		return types.NewError(types.ErrCodeArchitectureMismatch,
+			fmt.Errorf("image is built for %s, not %s", arch, p.req.Architecture),
+			map[string]string{"expected": p.req.Architecture, "actual": arch})
+	}
+	if arch != "" {
+		logrus.WithFields(logrus.Fields{
+			"job_id":       p.job.ID,
+			"architecture": arch,
+		}).Debug("Image architecture")
+	}
+	return nil
+}
+
+// sidecarArchitecture returns the architecture recorded in an image's .arch file in
+// MinIO, or "" if the image has none
+func (m *Manager) sidecarArchitecture(ctx context.Context, imageURL string) string {
+	if m.minioClient == nil {
+		return ""
+	}
+	bucketName, objectName, err := parseImageURL(imageURL)
+	if err != nil {
+		return ""
+	}
+	data, err := m.minioClient.GetObjectContent(ctx, bucketName, objectName+".arch")
+	if err != nil {
+		return ""
+	}
+	return normalizeArchitecture(string(data))
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestArchitecture(t *testing.T) {
+	manager := &Manager{}
+
+	arch, err := manager.requestArchitecture(types.ProvisionRequest{Architecture: "arm64"})
+	require.NoError(t, err)
+	assert.Equal(t, "aarch64", arch)
+	arch, err = manager.requestArchitecture(types.ProvisionRequest{Architecture: "X86_64"})
+	require.NoError(t, err)
+	assert.Equal(t, "x86_64", arch)
+
+	// Without a default, requests naming no architecture are not checked
+	arch, err = manager.requestArchitecture(types.ProvisionRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, arch)
+	manager.SetDefaultArchitecture("amd64")
+	arch, err = manager.requestArchitecture(types.ProvisionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "x86_64", arch)
+	arch, err = manager.requestArchitecture(types.ProvisionRequest{Type: types.VolumeTypeBlank})
+	require.NoError(t, err)
+	assert.Empty(t, arch)
+
+	for _, req := range []types.ProvisionRequest{
+		{Architecture: "sparc"},
+		{Architecture: "aarch64", Type: types.VolumeTypeBlank},
+	} {
+		_, err := manager.requestArchitecture(req)
+		code, details := types.ErrorCodeOf(err, "")
+		assert.Equal(t, types.ErrCodeInvalidRequest, code, req)
+		assert.Contains(t, details, "architecture")
+	}
+}
+
+func TestCheckArchitectureStep(t *testing.T) {
+	manager := &Manager{}
+
+	// Without an .arch file, images are only inspected if the request names an architecture
+	p := &provision{job: &Job{ID: "job"}, req: types.ProvisionRequest{ImageURL: "https://minio/images/ubuntu.qcow2"}}
+	require.NoError(t, manager.checkArchitectureStep(context.Background(), p))
+	assert.Empty(t, p.job.ImageArchitecture)
+
+	// An image whose architecture cannot be determined fails the check
+	p.req.Architecture = "aarch64"
+	p.imagePath = filepath.Join(t.TempDir(), "missing.qcow2")
+	err := manager.checkArchitectureStep(context.Background(), p)
+	code, _ := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeArchitectureMismatch, code)
+}
+
+func TestHostArchitecture(t *testing.T) {
+	assert.Contains(t, architectures, HostArchitecture())
+}
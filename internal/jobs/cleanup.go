@@ -0,0 +1,214 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultCleanupRetryInterval is how long after a failed rollback the volume is
+	// first deleted again; the interval doubles with each failure up to maxCleanupRetryInterval
+	defaultCleanupRetryInterval = 30 * time.Second
+	maxCleanupRetryInterval     = 30 * time.Minute
+	// cleanupCheckInterval is how often due cleanups are looked for
+	cleanupCheckInterval = 5 * time.Second
+)
+
+// Outcomes of pending cleanups
+const (
+	cleanupDeleted = "deleted"
+	cleanupFailed  = "failed"
+	cleanupDropped = "dropped"
+)
+
+var (
+	// pendingCleanupsGauge is the number of volumes waiting to be deleted after a failed rollback
+	pendingCleanupsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "libvirt_volume_provisioner_pending_cleanups",
+			Help: "Number of volumes of failed jobs waiting to be deleted after their rollback failed",
+		},
+	)
+	// cleanupsTotal counts the attempts to delete such volumes by result
+	cleanupsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "libvirt_volume_provisioner_cleanups_total",
+			Help: "Total number of background attempts to delete volumes whose rollback failed, by result",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(pendingCleanupsGauge, cleanupsTotal)
+}
+
+// SetCleanupRetryInterval sets how long after a failed rollback the volume is deleted
+// again in the background. The interval doubles with each failure.
+func (m *Manager) SetCleanupRetryInterval(interval time.Duration) {
+	m.cleanupMu.Lock()
+	defer m.cleanupMu.Unlock()
+	m.cleanupRetry = interval
+}
+
+// enqueueCleanup queues the volume of a job whose rollback failed to be deleted in
+// the background, rather than leaving it behind until the next restart
+func (m *Manager) enqueueCleanup(jobID, volumeName string, err error) {
+	m.cleanupMu.Lock()
+	defer m.cleanupMu.Unlock()
+	if m.cleanups == nil {
+		m.cleanups = make(map[string]*types.PendingCleanup)
+	}
+	now := time.Now()
+	m.cleanups[volumeName] = &types.PendingCleanup{
+		VolumeName:    volumeName,
+		JobID:         jobID,
+		Attempts:      1,
+		LastError:     err.Error(),
+		CreatedAt:     now,
+		NextAttemptAt: now.Add(m.cleanupInterval(1)),
+	}
+	pendingCleanupsGauge.Set(float64(len(m.cleanups)))
+	logrus.WithFields(logrus.Fields{
+		"job_id":      jobID,
+		"volume_name": volumeName,
+	}).Warn("Queued volume for deletion in the background after its rollback failed")
+}
+
+// cleanupInterval returns how long to wait after the given number of failed attempts
+func (m *Manager) cleanupInterval(attempts int) time.Duration {
+	interval := m.cleanupRetry
+	if interval <= 0 {
+		interval = defaultCleanupRetryInterval
+	}
+	for range attempts - 1 {
+		if interval >= maxCleanupRetryInterval {
+			break
+		}
+		interval *= 2
+	}
+	return min(interval, maxCleanupRetryInterval)
+}
+
+// ListCleanups returns the volumes waiting to be deleted after their rollback failed,
+// oldest first
+func (m *Manager) ListCleanups() ([]types.PendingCleanup, error) {
+	m.cleanupMu.Lock()
+	defer m.cleanupMu.Unlock()
+	cleanups := make([]types.PendingCleanup, 0, len(m.cleanups))
+	for _, cleanup := range m.cleanups {
+		cleanups = append(cleanups, *cleanup)
+	}
+	slices.SortFunc(cleanups, func(a, b types.PendingCleanup) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.VolumeName, b.VolumeName)
+	})
+	return cleanups, nil
+}
+
+// RunCleanups deletes the volumes whose rollback failed, retrying until they are
+// gone, until ctx is done. Pending cleanups are not persisted: after a restart, the
+// volumes are removed with the other incomplete volumes.
+func (m *Manager) RunCleanups(ctx context.Context) {
+	ticker := time.NewTicker(cleanupCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.runDueCleanups(now)
+		}
+	}
+}
+
+// runDueCleanups attempts the cleanups that are due at now
+func (m *Manager) runDueCleanups(now time.Time) {
+	m.cleanupMu.Lock()
+	var due []types.PendingCleanup
+	for _, cleanup := range m.cleanups {
+		if !now.Before(cleanup.NextAttemptAt) {
+			due = append(due, *cleanup)
+		}
+	}
+	m.cleanupMu.Unlock()
+
+	for _, cleanup := range due {
+		m.cleanUp(cleanup, now)
+	}
+}
+
+// cleanUp deletes the volume of a pending cleanup, unless it no longer needs to be:
+// it is gone, a new job is provisioning it, or it was since provisioned successfully
+func (m *Manager) cleanUp(cleanup types.PendingCleanup, now time.Time) {
+	fields := logrus.Fields{"job_id": cleanup.JobID, "volume_name": cleanup.VolumeName}
+
+	reason, err := m.cleanupNotNeeded(cleanup.VolumeName)
+	if reason != "" {
+		logrus.WithFields(fields).WithField("reason", reason).Info("Dropped pending cleanup of volume")
+		m.finishCleanup(cleanup.VolumeName, cleanupDropped)
+		return
+	}
+	if err == nil {
+		err = m.lvmManager.DeleteVolume(cleanup.VolumeName)
+	}
+	if err != nil {
+		cleanupsTotal.WithLabelValues(cleanupFailed).Inc()
+		m.cleanupMu.Lock()
+		defer m.cleanupMu.Unlock()
+		if pending, ok := m.cleanups[cleanup.VolumeName]; ok {
+			pending.Attempts++
+			pending.LastError = err.Error()
+			pending.NextAttemptAt = now.Add(m.cleanupInterval(pending.Attempts))
+			logrus.WithError(err).WithFields(fields).WithFields(logrus.Fields{
+				"attempts":     pending.Attempts,
+				"next_attempt": pending.NextAttemptAt,
+			}).Warn("Failed to delete volume whose rollback failed")
+		}
+		return
+	}
+
+	logrus.WithFields(fields).WithField("attempts", cleanup.Attempts+1).Info("Deleted volume whose rollback failed")
+	m.finishCleanup(cleanup.VolumeName, cleanupDeleted)
+	m.emit(events.Event{Type: events.VolumeDeleted, JobID: cleanup.JobID, VolumeName: cleanup.VolumeName})
+	m.recordVolumeDeleted(context.Background(), m.lvmManager.VolumeGroup(), cleanup.VolumeName)
+}
+
+// cleanupNotNeeded returns why a volume whose rollback failed need not be deleted
+// any more, or "" if it must be. Volumes are only deleted while they are incomplete,
+// so an error checking that postpones the cleanup.
+func (m *Manager) cleanupNotNeeded(volumeName string) (string, error) {
+	if jobID := m.activeJobForVolume(volumeName); jobID != "" {
+		return "provisioned by job " + jobID, nil
+	}
+	if !m.lvmManager.VolumeExists(volumeName) {
+		return "volume no longer exists", nil
+	}
+	incomplete, err := m.lvmManager.IncompleteVolumes()
+	if err != nil {
+		return "", fmt.Errorf("failed to check whether the volume is incomplete: %w", err)
+	}
+	if !slices.Contains(incomplete, volumeName) {
+		return "volume was provisioned since", nil
+	}
+	return "", nil
+}
+
+// finishCleanup removes a pending cleanup
+func (m *Manager) finishCleanup(volumeName, result string) {
+	cleanupsTotal.WithLabelValues(result).Inc()
+	m.cleanupMu.Lock()
+	defer m.cleanupMu.Unlock()
+	delete(m.cleanups, volumeName)
+	pendingCleanupsGauge.Set(float64(len(m.cleanups)))
+}
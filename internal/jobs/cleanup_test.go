@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanupInterval(t *testing.T) {
+	manager := NewManager(&fakeImageStore{}, newFakeVolumeManager(), nil, nil)
+	assert.Equal(t, defaultCleanupRetryInterval, manager.cleanupInterval(1))
+
+	manager.SetCleanupRetryInterval(10 * time.Second)
+	assert.Equal(t, 10*time.Second, manager.cleanupInterval(1))
+	assert.Equal(t, 20*time.Second, manager.cleanupInterval(2))
+	assert.Equal(t, 80*time.Second, manager.cleanupInterval(4))
+	assert.Equal(t, maxCleanupRetryInterval, manager.cleanupInterval(100))
+}
+
+func TestProvisionVolume_RollbackFailureQueuesCleanup(t *testing.T) {
+	volumes := newFakeVolumeManager()
+	volumes.failures = map[string]error{
+		"PopulateVolume": errors.New("qemu-img convert failed"),
+		"DeleteVolume":   lvmFailed("lvremove", "  Logical volume data/web01-root in use.\n"),
+	}
+	manager, _ := newProvisionTestManager(t, volumes)
+	manager.SetCleanupRetryInterval(10 * time.Second)
+
+	req := types.ProvisionRequest{VolumeName: "web01-root", ImageURL: testImageURL, ImageType: "raw", VolumeSizeGB: 10}
+	require.Error(t, manager.ProvisionVolume(context.Background(), provisionJob(req)))
+
+	cleanups, err := manager.ListCleanups()
+	require.NoError(t, err)
+	require.Len(t, cleanups, 1)
+	cleanup := cleanups[0]
+	assert.Equal(t, "web01-root", cleanup.VolumeName)
+	assert.Equal(t, "provision-job", cleanup.JobID)
+	assert.Equal(t, 1, cleanup.Attempts)
+	assert.Contains(t, cleanup.LastError, "web01-root in use")
+	assert.Equal(t, 10*time.Second, cleanup.NextAttemptAt.Sub(cleanup.CreatedAt))
+
+	// Nothing is attempted before the cleanup is due
+	manager.runDueCleanups(cleanup.CreatedAt.Add(time.Second))
+	assert.Equal(t, "DeleteVolume web01-root", volumes.Calls()[len(volumes.Calls())-1])
+	calls := len(volumes.Calls())
+
+	// A failed attempt is retried after twice the interval
+	manager.runDueCleanups(cleanup.NextAttemptAt)
+	assert.Len(t, volumes.Calls(), calls+1)
+	cleanups, err = manager.ListCleanups()
+	require.NoError(t, err)
+	require.Len(t, cleanups, 1)
+	assert.Equal(t, 2, cleanups[0].Attempts)
+	assert.Equal(t, cleanup.NextAttemptAt.Add(20*time.Second), cleanups[0].NextAttemptAt)
+
+	// The volume is deleted once it is no longer in use
+	volumes.failures = nil
+	manager.runDueCleanups(cleanups[0].NextAttemptAt)
+	assert.False(t, volumes.VolumeExists("web01-root"))
+	cleanups, err = manager.ListCleanups()
+	require.NoError(t, err)
+	assert.Empty(t, cleanups)
+}
+
+func TestRunDueCleanups_Dropped(t *testing.T) {
+	volumes := newFakeVolumeManager("gone-root", "complete-root", "leaked-root")
+	volumes.incomplete["leaked-root"] = true
+	delete(volumes.volumes, "gone-root")
+	manager := NewManager(&fakeImageStore{}, volumes, nil, nil)
+
+	busy := errors.New("lvremove failed")
+	for _, name := range []string{"gone-root", "complete-root", "leaked-root"} {
+		manager.enqueueCleanup("job-"+name, name, busy)
+	}
+	manager.runDueCleanups(time.Now().Add(maxCleanupRetryInterval))
+
+	// Only the volume that is still incomplete is deleted
+	assert.Equal(t, []string{"DeleteVolume leaked-root"}, volumes.Calls())
+	assert.True(t, volumes.VolumeExists("complete-root"))
+	cleanups, err := manager.ListCleanups()
+	require.NoError(t, err)
+	assert.Empty(t, cleanups)
+}
@@ -0,0 +1,230 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// deletionTokenTTL is how long a deletion preview's token confirms the deletion
+const deletionTokenTTL = 5 * time.Minute
+
+// deletionToken confirms the deletion of the volume it was issued for
+type deletionToken struct {
+	volumeName string
+	expiresAt  time.Time
+}
+
+// PreviewVolumeDeletion shows what deleting a volume would remove, issuing a
+// short-lived token that confirms the deletion of that volume only
+func (m *Manager) PreviewVolumeDeletion(volumeName string) (*types.VolumeDeletionPreview, error) {
+	if m.lvmManager == nil {
+		return nil, types.NewError(types.ErrCodeNotSupported, fmt.Errorf("LVM is not configured"), nil)
+	}
+	if err := validateVolumeName(volumeName); err != nil {
+		return nil, err
+	}
+	if !m.lvmManager.VolumeExists(volumeName) {
+		return nil, volumeNotFound(volumeName)
+	}
+
+	info, err := m.lvmManager.GetVolumeInfo(volumeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume info: %w", err)
+	}
+
+	preview := &types.VolumeDeletionPreview{
+		Name:        volumeName,
+		VolumeGroup: m.lvmManager.VolumeGroup(),
+		DevicePath:  m.lvmManager.DevicePath(volumeName),
+		SizeBytes:   info.SizeBytes,
+		Open:        info.Open(),
+	}
+	if preview.Domains, err = m.attachedDomains(volumeName, preview.DevicePath); err != nil {
+		return nil, err
+	}
+	if m.store != nil {
+		records, err := m.store.ListVolumes(storage.ListVolumesFilter{
+			Name:        volumeName,
+			VolumeGroup: preview.VolumeGroup,
+			Limit:       1,
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("volume_name", volumeName).Warn("Failed to look up volume record")
+		} else if len(records) > 0 {
+			preview.JobID = records[0].JobID
+			preview.ImageURL = records[0].ImageURL
+			preview.CreatedAt = &records[0].CreatedAt
+		}
+	}
+
+	token, err := newDeletionToken()
+	if err != nil {
+		return nil, err
+	}
+	preview.Token = token
+	preview.ExpiresAt = time.Now().Add(deletionTokenTTL)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deletionTokens == nil {
+		m.deletionTokens = make(map[string]deletionToken)
+	}
+	for t, issued := range m.deletionTokens {
+		if time.Now().After(issued.expiresAt) {
+			delete(m.deletionTokens, t)
+		}
+	}
+	m.deletionTokens[token] = deletionToken{volumeName: volumeName, expiresAt: preview.ExpiresAt}
+
+	return preview, nil
+}
+
+// DeleteVolume deletes a volume. Unless forced, the deletion must be confirmed with
+// the token of a deletion preview of the same volume, so that a typo in a volume
+// name cannot delete the wrong disk. Volumes being provisioned or open are refused,
+// as are volumes used by a libvirt domain unless the request allows it.
+func (m *Manager) DeleteVolume(volumeName string, req types.VolumeDeletionRequest) error {
+	if m.lvmManager == nil {
+		return types.NewError(types.ErrCodeNotSupported, fmt.Errorf("LVM is not configured"), nil)
+	}
+	if err := validateVolumeName(volumeName); err != nil {
+		return err
+	}
+	if !req.Force {
+		if err := m.redeemDeletionToken(volumeName, req.Token); err != nil {
+			return err
+		}
+	}
+
+	if jobID := m.activeJobForVolume(volumeName); jobID != "" {
+		return types.NewError(types.ErrCodeVolumeInUse,
+			fmt.Errorf("volume %s is being provisioned by job %s", volumeName, jobID), map[string]string{"job_id": jobID})
+	}
+	if !m.lvmManager.VolumeExists(volumeName) {
+		return volumeNotFound(volumeName)
+	}
+	info, err := m.lvmManager.GetVolumeInfo(volumeName)
+	if err != nil {
+		return fmt.Errorf("failed to get volume info: %w", err)
+	}
+	if info.Open() {
+		return types.NewError(types.ErrCodeVolumeInUse, fmt.Errorf("volume %s is open", volumeName), nil)
+	}
+	if !req.AllowAttached {
+		if err := m.checkNotAttached(volumeName, m.lvmManager.DevicePath(volumeName)); err != nil {
+			return err
+		}
+	}
+
+	if err := m.lvmManager.DeleteVolume(volumeName); err != nil {
+		if lvmErr := m.lvmError(context.Background(), "delete volume", err); lvmErr != nil {
+			return lvmErr
+		}
+		return fmt.Errorf("failed to delete volume: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"volume_name": volumeName,
+		"size_bytes":  info.SizeBytes,
+		"forced":      req.Force,
+	}).Info("Deleted volume")
+	m.emit(events.Event{Type: events.VolumeDeleted, VolumeName: volumeName})
+	m.recordVolumeDeleted(context.Background(), m.lvmManager.VolumeGroup(), volumeName)
+	return nil
+}
+
+// redeemDeletionToken checks and consumes the token confirming a volume's deletion
+func (m *Manager) redeemDeletionToken(volumeName, token string) error {
+	if token == "" {
+		return types.NewError(types.ErrCodeConfirmationRequired,
+			fmt.Errorf("deleting volume %s requires a token from a deletion preview, or force", volumeName), nil)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	issued, ok := m.deletionTokens[token]
+	if !ok || issued.volumeName != volumeName || time.Now().After(issued.expiresAt) {
+		return types.NewError(types.ErrCodeConfirmationRequired,
+			fmt.Errorf("deletion token is invalid or expired for volume %s", volumeName), nil)
+	}
+	delete(m.deletionTokens, token)
+	return nil
+}
+
+// activeJobForVolume returns the ID of a job provisioning a volume, or "" if there is none
+func (m *Manager) activeJobForVolume(volumeName string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for id, job := range m.jobs {
+		if job.Request.VolumeName == volumeName &&
+			(job.Status == types.StatusRunning || job.Status == types.StatusPending) {
+			return id
+		}
+	}
+	return ""
+}
+
+// newDeletionToken returns a random deletion token
+func newDeletionToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate deletion token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validateVolumeName rejects volume names that could refer outside the volume group
+func validateVolumeName(volumeName string) error {
+	if volumeName == "" || strings.ContainsAny(volumeName, "/\\") {
+		return types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("invalid volume name '%s'", volumeName), nil)
+	}
+	return nil
+}
+
+// volumeNotFound returns the error for a volume that does not exist
+func volumeNotFound(volumeName string) error {
+	return types.NewError(types.ErrCodeVolumeNotFound, fmt.Errorf("volume %s does not exist", volumeName), nil)
+}
+
+// attachedDomains returns the libvirt domains using a volume's device or overlay file,
+// or none if domains are not checked
+func (m *Manager) attachedDomains(volumeName, path string) ([]types.AttachedDomain, error) {
+	if m.domains == nil {
+		return nil, nil
+	}
+	domains, err := m.domains.DomainsUsingDevice(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check domains using volume %s: %w", volumeName, err)
+	}
+	return domains, nil
+}
+
+// checkNotAttached fails if a libvirt domain, running or not, uses a volume's device or overlay file
+func (m *Manager) checkNotAttached(volumeName, path string) error {
+	domains, err := m.attachedDomains(volumeName, path)
+	if err != nil {
+		return err
+	}
+	if len(domains) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		names = append(names, domain.Name)
+	}
+	return types.NewError(types.ErrCodeVolumeAttached,
+		fmt.Errorf("volume %s is used by domain %s", volumeName, strings.Join(names, ", ")),
+		map[string]string{"domains": strings.Join(names, ",")})
+}
@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedeemDeletionToken(t *testing.T) {
+	manager := &Manager{
+		jobs: make(map[string]*Job),
+		deletionTokens: map[string]deletionToken{
+			"token":   {volumeName: "vm01-root", expiresAt: time.Now().Add(time.Minute)},
+			"expired": {volumeName: "vm01-root", expiresAt: time.Now().Add(-time.Second)},
+		},
+	}
+
+	for _, token := range []string{"", "unknown", "expired"} {
+		code, _ := types.ErrorCodeOf(manager.redeemDeletionToken("vm01-root", token), "")
+		assert.Equal(t, types.ErrCodeConfirmationRequired, code, token)
+	}
+
+	// A token only confirms the deletion of the previewed volume, once
+	code, _ := types.ErrorCodeOf(manager.redeemDeletionToken("vm02-root", "token"), "")
+	assert.Equal(t, types.ErrCodeConfirmationRequired, code)
+	assert.NoError(t, manager.redeemDeletionToken("vm01-root", "token"))
+	assert.Error(t, manager.redeemDeletionToken("vm01-root", "token"))
+}
+
+func TestActiveJobForVolume(t *testing.T) {
+	manager := &Manager{jobs: map[string]*Job{
+		"done":    {Status: types.StatusCompleted, Request: types.ProvisionRequest{VolumeName: "vm01-root"}},
+		"running": {Status: types.StatusRunning, Request: types.ProvisionRequest{VolumeName: "vm02-root"}},
+	}}
+
+	assert.Empty(t, manager.activeJobForVolume("vm01-root"))
+	assert.Equal(t, "running", manager.activeJobForVolume("vm02-root"))
+}
+
+func TestValidateVolumeName(t *testing.T) {
+	assert.NoError(t, validateVolumeName("vm01-root"))
+	for _, name := range []string{"", "../vm01-root", "other-vg/vm01-root"} {
+		code, _ := types.ErrorCodeOf(validateVolumeName(name), "")
+		assert.Equal(t, types.ErrCodeInvalidRequest, code, name)
+	}
+}
+
+// fakeDomainLister reports the domains using each device path
+type fakeDomainLister map[string][]types.AttachedDomain
+
+func (f fakeDomainLister) DomainsUsingDevice(devicePath string) ([]types.AttachedDomain, error) {
+	return f[devicePath], nil
+}
+
+func (f fakeDomainLister) DomainDisks() ([]types.DomainDisk, error) {
+	var disks []types.DomainDisk
+	for path, domains := range f {
+		for _, domain := range domains {
+			disks = append(disks, types.DomainDisk{Domain: domain.Name, Running: domain.Running, Path: path})
+		}
+	}
+	return disks, nil
+}
+
+func TestCheckNotAttached(t *testing.T) {
+	lvmManager := &lvm.Manager{}
+	manager := &Manager{jobs: make(map[string]*Job), lvmManager: lvmManager}
+
+	// Without libvirt, domains are not checked
+	assert.NoError(t, manager.checkNotAttached("web01-root", lvmManager.DevicePath("web01-root")))
+
+	manager.SetDomainLister(fakeDomainLister{
+		lvmManager.DevicePath("web01-root"): {{Name: "web01", Running: false}, {Name: "web01-clone", Running: true}},
+	})
+	assert.NoError(t, manager.checkNotAttached("web02-root", lvmManager.DevicePath("web02-root")))
+
+	err := manager.checkNotAttached("web01-root", lvmManager.DevicePath("web01-root"))
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeVolumeAttached, code)
+	assert.Equal(t, "web01,web01-clone", details["domains"])
+}
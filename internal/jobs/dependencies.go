@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// maxDependencies bounds the number of jobs a request may depend on
+const maxDependencies = 16
+
+// validateDependencies checks that the jobs a request depends on exist and have not
+// failed. A job can only depend on jobs submitted before it, so there are no cycles.
+func (m *Manager) validateDependencies(req types.ProvisionRequest) error {
+	if len(req.DependsOn) > maxDependencies {
+		return types.NewError(types.ErrCodeInvalidRequest,
+			fmt.Errorf("a job may depend on at most %d jobs", maxDependencies),
+			map[string]string{"depends_on": fmt.Sprintf("max=%d", maxDependencies)})
+	}
+	for _, id := range req.DependsOn {
+		status, ok := m.dependencyStatus(id)
+		if !ok {
+			return types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("unknown dependency: %s", id),
+				map[string]string{"depends_on": "exists"})
+		}
+		if status == types.StatusFailed {
+			return dependencyFailed(id, status)
+		}
+	}
+	return nil
+}
+
+// dependencyStatus returns the status of a job another job depends on, looking in
+// the database for jobs no longer held in memory
+func (m *Manager) dependencyStatus(id string) (types.JobStatus, bool) {
+	m.mu.RLock()
+	job, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if ok {
+		return job.Status, true
+	}
+	if m.store == nil {
+		return "", false
+	}
+	record, err := m.store.GetJob(id)
+	if err != nil {
+		return "", false
+	}
+	return types.JobStatus(record.Status), true
+}
+
+// waitForDependencies blocks until the jobs a job depends on have finished, failing
+// if any of them did not complete successfully
+func (m *Manager) waitForDependencies(ctx context.Context, job *Job) error {
+	for _, id := range job.Request.DependsOn {
+		m.mu.RLock()
+		dependency, inMemory := m.jobs[id]
+		m.mu.RUnlock()
+		if !inMemory {
+			// The dependency finished before a restart, or was cleaned up since
+			if status, ok := m.dependencyStatus(id); !ok || status != types.StatusCompleted {
+				return dependencyFailed(id, status)
+			}
+			continue
+		}
+
+		if dependency.done != nil {
+			select {
+			case <-dependency.done:
+			default:
+				job.setWaiting("waiting_for_dependencies", time.Now())
+				logrus.WithFields(logrus.Fields{
+					"job_id":     job.ID,
+					"depends_on": id,
+				}).Info("Job waiting for dependency")
+
+				select {
+				case <-dependency.done:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+
+		if dependency.Status != types.StatusCompleted {
+			return dependencyFailed(id, dependency.Status)
+		}
+	}
+	return nil
+}
+
+// dependencyFailed returns the error of a job whose dependency did not complete
+func dependencyFailed(id string, status types.JobStatus) error {
+	if status == "" {
+		status = "unknown"
+	}
+	return types.NewError(types.ErrCodeDependencyFailed, fmt.Errorf("dependency %s did not complete: %s", id, status),
+		map[string]string{"job_id": id, "status": string(status)})
+}
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	manager := &Manager{
+		jobs: map[string]*Job{
+			"running": {ID: "running", Status: types.StatusRunning},
+			"failed":  {ID: "failed", Status: types.StatusFailed},
+		},
+		store: store,
+	}
+	// Jobs finished before a restart are found in the database
+	manager.syncToDatabase(context.Background(), &Job{ID: "archived", Status: types.StatusCompleted})
+
+	assert.NoError(t, manager.validateDependencies(types.ProvisionRequest{DependsOn: []string{"running", "archived"}}))
+
+	err = manager.validateDependencies(types.ProvisionRequest{DependsOn: []string{"running", "missing"}})
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeInvalidRequest, code)
+	assert.Equal(t, "exists", details["depends_on"])
+
+	err = manager.validateDependencies(types.ProvisionRequest{DependsOn: []string{"failed"}})
+	code, details = types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeDependencyFailed, code)
+	assert.Equal(t, "failed", details["job_id"])
+
+	err = manager.validateDependencies(types.ProvisionRequest{DependsOn: make([]string, maxDependencies+1)})
+	code, _ = types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeInvalidRequest, code)
+}
+
+func TestWaitForDependencies(t *testing.T) {
+	dependency := &Job{ID: "first", Status: types.StatusRunning, done: make(chan struct{})}
+	manager := &Manager{jobs: map[string]*Job{"first": dependency}}
+	job := &Job{ID: "second", Request: types.ProvisionRequest{DependsOn: []string{"first"}}}
+
+	result := make(chan error, 1)
+	go func() { result <- manager.waitForDependencies(context.Background(), job) }()
+
+	select {
+	case err := <-result:
+		require.Fail(t, "job should wait for its dependency", "returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	dependency.Status = types.StatusCompleted
+	close(dependency.done)
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "job should start once its dependency completed")
+	}
+	assert.Equal(t, "waiting_for_dependencies", job.Progress.Stage)
+}
+
+func TestWaitForDependenciesFailed(t *testing.T) {
+	dependency := &Job{ID: "first", Status: types.StatusFailed, done: make(chan struct{})}
+	close(dependency.done)
+	manager := &Manager{jobs: map[string]*Job{"first": dependency}}
+	job := &Job{ID: "second", Request: types.ProvisionRequest{DependsOn: []string{"first"}}}
+
+	err := manager.waitForDependencies(context.Background(), job)
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeDependencyFailed, code)
+	assert.Equal(t, map[string]string{"job_id": "first", "status": "failed"}, details)
+
+	// A dependency that is no longer known did not complete
+	job.Request.DependsOn = []string{"forgotten"}
+	err = manager.waitForDependencies(context.Background(), job)
+	_, details = types.ErrorCodeOf(err, "")
+	assert.Equal(t, "unknown", details["status"])
+
+	// Cancelling the waiting job stops the wait
+	pending := &Job{ID: "third", Status: types.StatusPending, done: make(chan struct{})}
+	manager.jobs["third"] = pending
+	job.Request.DependsOn = []string{"third"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, manager.waitForDependencies(ctx, job), context.Canceled)
+}
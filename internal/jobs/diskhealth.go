@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"fmt"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+)
+
+// filesystemUsage returns the size of the filesystem containing a path and the bytes
+// used on it; tests replace it
+var filesystemUsage = cache.FilesystemUsage
+
+// SetDiskThresholds sets the usage percentages of the cache pool and database
+// filesystems at which health is reported as degraded and readiness fails, so that
+// schedulers stop sending work to a host about to run out of disk. Zero disables a threshold.
+func (m *Manager) SetDiskThresholds(degradedPercent, notReadyPercent int) error {
+	if degradedPercent < 0 || degradedPercent > 100 || notReadyPercent < 0 || notReadyPercent > 100 {
+		return fmt.Errorf("disk usage thresholds must be percentages between 0 and 100")
+	}
+	if degradedPercent > 0 && notReadyPercent > 0 && degradedPercent > notReadyPercent {
+		return fmt.Errorf("degraded disk usage threshold %d%% is above the readiness threshold %d%%",
+			degradedPercent, notReadyPercent)
+	}
+	m.diskDegradedPercent = degradedPercent
+	m.diskNotReadyPercent = notReadyPercent
+	return nil
+}
+
+// ReadinessChecks reports the cache pool and database filesystems that are at least
+// as full as the readiness threshold, or could not be checked
+func (m *Manager) ReadinessChecks() map[string]error {
+	return m.diskChecks(m.diskNotReadyPercent, "readiness")
+}
+
+// diskChecks reports the cache pool and database filesystems that are at least
+// percent full, by check name. Zero disables the checks.
+func (m *Manager) diskChecks(percent int, threshold string) map[string]error {
+	if percent <= 0 {
+		return nil
+	}
+	paths := make(map[string]string)
+	if m.imageCache != nil {
+		for _, pool := range m.imageCache.Pools() {
+			paths["cache_disk:"+pool.Name] = pool.Path
+		}
+	}
+	// An in-memory database uses no disk
+	if m.store != nil && m.store.Path() != ":memory:" {
+		paths["database_disk"] = m.store.Path()
+	}
+
+	checks := make(map[string]error)
+	for name, path := range paths {
+		size, used, err := filesystemUsage(path)
+		if err != nil {
+			checks[name] = err
+			continue
+		}
+		if size == 0 {
+			continue
+		}
+		usedPercent := float64(used) * 100 / float64(size)
+		if usedPercent < float64(percent) {
+			continue
+		}
+		checks[name] = fmt.Errorf("filesystem of %s is %.1f%% full with %d bytes free, at or above the %d%% %s threshold",
+			path, usedPercent, size-used, percent, threshold)
+	}
+	return checks
+}
@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"errors"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDiskThresholds(t *testing.T) {
+	manager := NewManager(&fakeImageStore{}, newFakeVolumeManager(), nil, nil)
+	assert.NoError(t, manager.SetDiskThresholds(90, 95))
+	assert.NoError(t, manager.SetDiskThresholds(90, 0))
+	assert.Error(t, manager.SetDiskThresholds(96, 95))
+	assert.Error(t, manager.SetDiskThresholds(-1, 95))
+	assert.Error(t, manager.SetDiskThresholds(90, 101))
+}
+
+func TestDiskChecks(t *testing.T) {
+	cacheDir := t.TempDir()
+	imageCache, err := cache.NewDirectoryCache("images", cacheDir)
+	require.NoError(t, err)
+	dbPath := filepath.Join(t.TempDir(), "provisioner.db")
+	store, err := storage.NewStore(dbPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	manager := NewManager(&fakeImageStore{}, newFakeVolumeManager(), imageCache, store)
+
+	// The cache disk is 92% full, the database disk cannot be checked
+	usage := map[string][2]uint64{cacheDir + "/images": {100 << 30, 92 << 30}}
+	original := filesystemUsage
+	filesystemUsage = func(path string) (uint64, uint64, error) {
+		if u, ok := usage[path]; ok {
+			return u[0], u[1], nil
+		}
+		return 0, 0, errors.New("failed to statfs " + path)
+	}
+	t.Cleanup(func() { filesystemUsage = original })
+
+	// Disabled by default
+	assert.Equal(t, []string{"minio"}, slices.Collect(maps.Keys(manager.HealthChecks())))
+	assert.Empty(t, manager.ReadinessChecks())
+
+	require.NoError(t, manager.SetDiskThresholds(90, 95))
+	checks := manager.HealthChecks()
+	require.Len(t, checks, 3)
+	assert.EqualError(t, checks["cache_disk:images"], "filesystem of "+cacheDir+
+		"/images is 92.0% full with 8589934592 bytes free, at or above the 90% degraded threshold")
+	assert.EqualError(t, checks["database_disk"], "failed to statfs "+dbPath)
+
+	usage[dbPath] = [2]uint64{100 << 30, 10 << 30}
+	readiness := manager.ReadinessChecks()
+	assert.Empty(t, readiness)
+
+	usage[cacheDir+"/images"] = [2]uint64{100 << 30, 95 << 30}
+	readiness = manager.ReadinessChecks()
+	require.Len(t, readiness, 1)
+	assert.ErrorContains(t, readiness["cache_disk:images"], "at or above the 95% readiness threshold")
+}
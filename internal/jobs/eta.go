@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"time"
+)
+
+const (
+	// throughputWindow is how far back progress updates are used to measure throughput,
+	// so the estimate follows changes in e.g. WAN conditions
+	throughputWindow = 10 * time.Second
+	// minThroughputSpan is the shortest span of updates throughput is measured over
+	minThroughputSpan = time.Second
+)
+
+// progressSample is the bytes processed by a stage at a point in time
+type progressSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// throughput tracks the recent throughput of a stage that reports the bytes it processed
+type throughput struct {
+	stage   string
+	samples []progressSample
+}
+
+// update records the bytes processed by stage at now, returning the throughput over
+// the last throughputWindow and the time the remaining bytes will be processed at that
+// rate. Both are zero until updates span minThroughputSpan, and after a stage change.
+func (t *throughput) update(now time.Time, stage string, processed, total int64) (float64, *time.Time) {
+	// A new stage, or a download restarted by a retry, starts a new measurement
+	restarted := len(t.samples) > 0 && processed < t.samples[len(t.samples)-1].bytes
+	if stage != t.stage || restarted || total <= 0 {
+		t.stage, t.samples = stage, t.samples[:0]
+	}
+	if total <= 0 {
+		return 0, nil
+	}
+	t.samples = append(t.samples, progressSample{at: now, bytes: processed})
+
+	// Keep the newest sample older than the window as the start of the span
+	cutoff := now.Add(-throughputWindow)
+	drop := 0
+	for drop+1 < len(t.samples) && !t.samples[drop+1].at.After(cutoff) {
+		drop++
+	}
+	t.samples = t.samples[drop:]
+
+	first := t.samples[0]
+	span := now.Sub(first.at)
+	if span < minThroughputSpan || processed <= first.bytes {
+		return 0, nil
+	}
+	rate := float64(processed-first.bytes) / span.Seconds()
+	remaining := time.Duration(float64(max(total-processed, 0)) / rate * float64(time.Second))
+	eta := now.Add(remaining).Truncate(time.Second)
+	return rate, &eta
+}
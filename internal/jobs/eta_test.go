@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThroughput(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	var tp throughput
+
+	// No estimate until updates span a second
+	rate, eta := tp.update(start, "downloading", 0, 1000)
+	assert.Zero(t, rate)
+	assert.Nil(t, eta)
+	_, eta = tp.update(start.Add(500*time.Millisecond), "downloading", 50, 1000)
+	assert.Nil(t, eta)
+
+	rate, eta = tp.update(start.Add(2*time.Second), "downloading", 200, 1000)
+	assert.InDelta(t, 100.0, rate, 0.001)
+	require.NotNil(t, eta)
+	assert.Equal(t, start.Add(10*time.Second), *eta)
+
+	// Only the last throughputWindow counts, so the estimate follows a slowdown
+	_, _ = tp.update(start.Add(20*time.Second), "downloading", 600, 1000)
+	rate, eta = tp.update(start.Add(30*time.Second), "downloading", 700, 1000)
+	assert.InDelta(t, 10.0, rate, 0.001)
+	assert.Equal(t, start.Add(60*time.Second), *eta)
+
+	// A retry restarting the download, or a new stage, starts a new measurement
+	_, eta = tp.update(start.Add(31*time.Second), "downloading", 10, 1000)
+	assert.Nil(t, eta)
+	_, eta = tp.update(start.Add(32*time.Second), "converting", 900, 1000)
+	assert.Nil(t, eta)
+	rate, _ = tp.update(start.Add(34*time.Second), "converting", 1000, 1000)
+	assert.InDelta(t, 50.0, rate, 0.001)
+
+	// Stages without byte counts have no estimate
+	rate, eta = tp.update(start.Add(40*time.Second), "converting", 0, 0)
+	assert.Zero(t, rate)
+	assert.Nil(t, eta)
+}
+
+func TestJobUpdateProgressETA(t *testing.T) {
+	job := &Job{ID: "eta-job"}
+	job.UpdateProgress("downloading", 10, 0, 1<<30)
+	assert.Nil(t, job.Progress.ETA)
+
+	// Rewind the first sample instead of sleeping
+	job.throughput.samples[0].at = job.throughput.samples[0].at.Add(-4 * time.Second)
+	job.UpdateProgress("downloading", 20, 1<<28, 1<<30)
+	assert.Positive(t, job.Progress.BytesPerSec)
+	require.NotNil(t, job.Progress.ETA)
+	assert.WithinDuration(t, time.Now().Add(12*time.Second), *job.Progress.ETA, 2*time.Second)
+
+	// Stages without byte counts report no estimate
+	job.setStage("verifying", 40)
+	assert.Zero(t, job.Progress.BytesPerSec)
+	assert.Nil(t, job.Progress.ETA)
+}
@@ -0,0 +1,207 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// What happens to jobs for images past their expiry date
+const (
+	ExpiredImageWarn   = "warn"
+	ExpiredImageReject = "reject"
+)
+
+// expiryCheckInterval is how often expired images are evicted from the cache
+const expiryCheckInterval = time.Hour
+
+var (
+	// expiredImageJobsTotal counts the jobs for images past their expiry date
+	expiredImageJobsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "libvirt_volume_provisioner_expired_image_jobs_total",
+			Help: "Total number of jobs for images past their expiry date, by policy",
+		},
+		[]string{"policy"},
+	)
+	// expiredImagesEvictedTotal counts the cached images evicted because they expired
+	expiredImagesEvictedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "libvirt_volume_provisioner_expired_images_evicted_total",
+			Help: "Total number of cached images evicted because their image expired",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(expiredImageJobsTotal, expiredImagesEvictedTotal)
+}
+
+// imageExpiries holds the dates images expire, from configuration and from the
+// metadata of images seen by jobs
+type imageExpiries struct {
+	mu sync.Mutex
+	// configured expiries take precedence over the images' metadata
+	configured map[string]time.Time
+	published  map[string]time.Time
+}
+
+// LoadImageExpiries reads a JSON file mapping image URLs to the time they expire
+func LoadImageExpiries(path string) (map[string]time.Time, error) {
+	//nolint:gosec // File path is controlled by admin via environment variable
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image expiries: %w", err)
+	}
+
+	var expiries map[string]time.Time
+	if err := json.Unmarshal(data, &expiries); err != nil {
+		return nil, fmt.Errorf("failed to parse image expiries: %w", err)
+	}
+	for imageURL := range expiries {
+		if _, _, err := parseImageURL(imageURL); err != nil {
+			return nil, err
+		}
+	}
+	return expiries, nil
+}
+
+// SetImageExpiry sets the expiry dates of images, overriding those in their
+// metadata, and what happens to jobs for expired images
+func (m *Manager) SetImageExpiry(expiries map[string]time.Time, policy string) error {
+	switch policy {
+	case ExpiredImageWarn, ExpiredImageReject:
+	default:
+		return fmt.Errorf("unknown expired image policy: %s", policy)
+	}
+	m.expiredImagePolicy = policy
+	m.expiries.mu.Lock()
+	m.expiries.configured = maps.Clone(expiries)
+	m.expiries.mu.Unlock()
+	return nil
+}
+
+// imageExpiry returns when an image expires, or nil if it does not, and remembers
+// the expiry in its metadata so the image is evicted from the cache once it passes
+func (m *Manager) imageExpiry(imageURL string, metadata *types.ImageMetadata) *time.Time {
+	m.expiries.mu.Lock()
+	defer m.expiries.mu.Unlock()
+
+	if metadata != nil && metadata.Expires != nil {
+		if m.expiries.published == nil {
+			m.expiries.published = make(map[string]time.Time)
+		}
+		m.expiries.published[imageURL] = *metadata.Expires
+	}
+	if expires, ok := m.expiries.configured[imageURL]; ok {
+		return &expires
+	}
+	if expires, ok := m.expiries.published[imageURL]; ok {
+		return &expires
+	}
+	return nil
+}
+
+// checkImageExpiry fails a job for an image past its expiry date, evicting the image
+// from the cache, or only logs a warning if expired images are allowed. The expiry is
+// reported in the job's image metadata.
+func (m *Manager) checkImageExpiry(p *provision) error {
+	expires := m.imageExpiry(p.req.ImageURL, p.job.ImageMetadata)
+	if expires == nil {
+		return nil
+	}
+	if p.job.ImageMetadata == nil {
+		p.job.ImageMetadata = &types.ImageMetadata{}
+	}
+	p.job.ImageMetadata.Expires = expires
+	if time.Now().Before(*expires) {
+		return nil
+	}
+
+	policy := m.expiredImagePolicy
+	if policy == "" {
+		policy = ExpiredImageWarn
+	}
+	expiredImageJobsTotal.WithLabelValues(policy).Inc()
+	logger := logrus.WithFields(logrus.Fields{
+		"job_id":    p.job.ID,
+		"image_url": p.req.ImageURL,
+		"expires":   *expires,
+	})
+	if policy == ExpiredImageWarn {
+		logger.Warn("Provisioning from expired image")
+		return nil
+	}
+
+	logger.Warn("Refusing to provision from expired image")
+	m.evictExpiredImage(p.req.ImageURL)
+	return types.NewError(types.ErrCodeImageExpired,
+		fmt.Errorf("image expired at %s", expires.Format(time.RFC3339)),
+		map[string]string{"expires": expires.Format(time.RFC3339)})
+}
+
+// MonitorImageExpiry evicts expired images from the cache until ctx is done
+func (m *Manager) MonitorImageExpiry(ctx context.Context) {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		m.evictExpiredImages(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// evictExpiredImages removes the cached copies of the images that expired before now,
+// and returns the number of images evicted
+func (m *Manager) evictExpiredImages(now time.Time) int {
+	m.expiries.mu.Lock()
+	expiries := maps.Clone(m.expiries.published)
+	if expiries == nil {
+		expiries = make(map[string]time.Time)
+	}
+	maps.Copy(expiries, m.expiries.configured)
+	m.expiries.mu.Unlock()
+
+	evicted := 0
+	for imageURL, expires := range expiries {
+		if now.Before(expires) {
+			continue
+		}
+		evicted += m.evictExpiredImage(imageURL)
+	}
+	return evicted
+}
+
+// evictExpiredImage removes the cached copies of an expired image
+func (m *Manager) evictExpiredImage(imageURL string) int {
+	if m.imageCache == nil {
+		return 0
+	}
+	bucketName, objectName, err := parseImageURL(imageURL)
+	if err != nil {
+		return 0
+	}
+	evicted, err := m.InvalidateObject(bucketName, objectName)
+	if err != nil {
+		logrus.WithError(err).WithField("image_url", imageURL).Warn("Failed to evict expired image")
+	}
+	if evicted > 0 {
+		expiredImagesEvictedTotal.Add(float64(evicted))
+		logrus.WithFields(logrus.Fields{
+			"image_url": imageURL,
+			"evicted":   evicted,
+		}).Info("Evicted expired image from cache")
+	}
+	return evicted
+}
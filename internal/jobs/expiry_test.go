@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadImageExpiries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "expiries.json")
+	require.NoError(t, os.WriteFile(path,
+		[]byte(`{"https://minio/images/ubuntu-20.04.qcow2":"2025-04-30T00:00:00Z"}`), 0o600))
+	expiries, err := LoadImageExpiries(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2025, expiries["https://minio/images/ubuntu-20.04.qcow2"].Year())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"ubuntu.qcow2":"2025-04-30T00:00:00Z"}`), 0o600))
+	_, err = LoadImageExpiries(path)
+	assert.Error(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(`{"https://minio/images/ubuntu.qcow2":"April"}`), 0o600))
+	_, err = LoadImageExpiries(path)
+	assert.Error(t, err)
+}
+
+func TestCheckImageExpiry(t *testing.T) {
+	const imageURL = "https://minio/images/ubuntu.qcow2"
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	manager := &Manager{}
+	assert.Error(t, manager.SetImageExpiry(nil, "ignore"))
+
+	// Images without an expiry, or whose expiry has not passed, are not checked
+	p := &provision{job: &Job{ID: "job"}, req: types.ProvisionRequest{ImageURL: imageURL}}
+	require.NoError(t, manager.checkImageExpiry(p))
+	assert.Nil(t, p.job.ImageMetadata)
+	p.job.ImageMetadata = &types.ImageMetadata{Expires: &future}
+	require.NoError(t, manager.checkImageExpiry(p))
+
+	// Expired images only warn by default
+	p.job.ImageMetadata = &types.ImageMetadata{Expires: &past}
+	require.NoError(t, manager.checkImageExpiry(p))
+
+	require.NoError(t, manager.SetImageExpiry(nil, ExpiredImageReject))
+	err := manager.checkImageExpiry(p)
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeImageExpired, code)
+	assert.Contains(t, details, "expires")
+
+	// Configured expiries override the metadata, and are reported in it
+	require.NoError(t, manager.SetImageExpiry(map[string]time.Time{imageURL: future}, ExpiredImageReject))
+	p.job.ImageMetadata = nil
+	require.NoError(t, manager.checkImageExpiry(p))
+	require.NotNil(t, p.job.ImageMetadata)
+	assert.True(t, future.Equal(*p.job.ImageMetadata.Expires))
+}
+
+func TestEvictExpiredImages(t *testing.T) {
+	cacheDir := t.TempDir()
+	imageCache, err := cache.NewDirectoryCache("images", cacheDir)
+	require.NoError(t, err)
+	poolDir := filepath.Join(cacheDir, "images")
+	require.NoError(t, os.MkdirAll(poolDir, 0o750))
+	for _, name := range []string{"ubuntu", "debian"} {
+		path := filepath.Join(poolDir, name)
+		require.NoError(t, os.WriteFile(path, []byte("image"), 0o600))
+		require.NoError(t, os.WriteFile(path+".sha256", []byte(name), 0o600))
+	}
+
+	now := time.Now()
+	later := now.Add(time.Hour)
+	manager := &Manager{jobs: make(map[string]*Job), imageCache: imageCache}
+	require.NoError(t, manager.SetImageExpiry(map[string]time.Time{
+		"https://minio/images/ubuntu.qcow2": now.Add(-time.Hour),
+	}, ExpiredImageWarn))
+	// Expiries from image metadata are remembered once a job has seen them
+	manager.imageExpiry("https://minio/images/debian.qcow2", &types.ImageMetadata{Expires: &later})
+
+	assert.Equal(t, 1, manager.evictExpiredImages(now))
+	assert.NoFileExists(t, filepath.Join(poolDir, "ubuntu"))
+	assert.FileExists(t, filepath.Join(poolDir, "debian"))
+
+	assert.Equal(t, 1, manager.evictExpiredImages(now.Add(2*time.Hour)))
+	assert.NoFileExists(t, filepath.Join(poolDir, "debian"))
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// checksumFailureLimit is the number of checksum mismatches after which an image is memoized
+const checksumFailureLimit = 2
+
+// failureMemo remembers images that are missing from MinIO or keep failing checksum
+// verification, so jobs for them fail immediately instead of downloading them again.
+// A nil failureMemo remembers nothing.
+type failureMemo struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*memoEntry
+}
+
+// memoEntry tracks the failures of a single image URL
+type memoEntry struct {
+	err      error
+	failures int
+	first    time.Time
+	// until is when the image may be downloaded again; zero while below the failure limit
+	until time.Time
+}
+
+// newFailureMemo creates a memo that remembers failures for ttl
+func newFailureMemo(ttl time.Duration) *failureMemo {
+	return &failureMemo{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*memoEntry),
+	}
+}
+
+// check returns the remembered failure of imageURL, or nil if it may be downloaded
+func (f *failureMemo) check(imageURL string) error {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.entries[imageURL]
+	if !ok || entry.until.IsZero() {
+		return nil
+	}
+	if !f.now().Before(entry.until) {
+		delete(f.entries, imageURL)
+		return nil
+	}
+
+	code, details := types.ErrorCodeOf(entry.err, types.ErrCodeDownloadFailed)
+	memoDetails := map[string]string{"retry_after": entry.until.UTC().Format(time.RFC3339)}
+	maps.Copy(memoDetails, details)
+	return types.NewError(code,
+		fmt.Errorf("image failed recently and will not be downloaded again until %s: %w",
+			entry.until.UTC().Format(time.RFC3339), entry.err),
+		memoDetails)
+}
+
+// record remembers a failed download of imageURL. Missing or inaccessible images are
+// remembered immediately, checksum mismatches once they repeat; other failures are
+// assumed to be transient.
+func (f *failureMemo) record(imageURL string, err error) {
+	if f == nil {
+		return
+	}
+
+	limit := 0
+	switch code, _ := types.ErrorCodeOf(err, ""); code {
+	case types.ErrCodeImageNotAccessible:
+		limit = 1
+	case types.ErrCodeChecksumMismatch:
+		limit = checksumFailureLimit
+	default:
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	entry, ok := f.entries[imageURL]
+	if !ok || now.Sub(entry.first) > f.ttl {
+		entry = &memoEntry{first: now}
+		f.entries[imageURL] = entry
+	}
+	entry.err = err
+	entry.failures++
+	if entry.failures >= limit {
+		entry.until = now.Add(f.ttl)
+	}
+}
+
+// forget clears the failures of imageURL, e.g. after it was downloaded successfully
+func (f *failureMemo) forget(imageURL string) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.entries, imageURL)
+}
+
+// forgetObject clears the failures of every image URL referring to a MinIO object
+func (f *failureMemo) forgetObject(bucket, object string) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for imageURL := range f.entries {
+		if b, o, err := parseImageURL(imageURL); err == nil && b == bucket && o == object {
+			delete(f.entries, imageURL)
+		}
+	}
+}
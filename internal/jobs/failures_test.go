@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailureMemo(t *testing.T) {
+	now := time.Date(2026, 1, 14, 10, 0, 0, 0, time.UTC)
+	memo := newFailureMemo(5 * time.Minute)
+	memo.now = func() time.Time { return now }
+
+	const missing = "https://minio/images/missing.qcow2"
+	const corrupt = "https://minio/images/corrupt.qcow2"
+
+	// Transient failures are not remembered
+	memo.record(missing, types.NewError(types.ErrCodeDownloadFailed, errors.New("connection reset"), nil))
+	assert.NoError(t, memo.check(missing))
+
+	// Missing images are remembered immediately, keeping the original code and details
+	memo.record(missing, types.NewError(types.ErrCodeImageNotAccessible, errors.New("not found"),
+		map[string]string{"minio_code": "NoSuchKey"}))
+	err := memo.check(missing)
+	require.Error(t, err)
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeImageNotAccessible, code)
+	assert.Equal(t, "NoSuchKey", details["minio_code"])
+	assert.Equal(t, "2026-01-14T10:05:00Z", details["retry_after"])
+
+	// Checksum mismatches are remembered once they repeat
+	mismatch := types.NewError(types.ErrCodeChecksumMismatch, errors.New("checksum mismatch"), nil)
+	memo.record(corrupt, mismatch)
+	assert.NoError(t, memo.check(corrupt))
+	memo.record(corrupt, mismatch)
+	assert.Error(t, memo.check(corrupt))
+
+	// Failures expire after the TTL
+	now = now.Add(5 * time.Minute)
+	assert.NoError(t, memo.check(missing))
+
+	memo.forget(corrupt)
+	assert.NoError(t, memo.check(corrupt))
+
+	// A nil memo remembers nothing
+	var disabled *failureMemo
+	disabled.record(missing, err)
+	assert.NoError(t, disabled.check(missing))
+}
+
+func TestFailureMemoForgetObject(t *testing.T) {
+	memo := newFailureMemo(5 * time.Minute)
+	missing := types.NewError(types.ErrCodeImageNotAccessible, errors.New("not found"), nil)
+	memo.record("https://minio/images/ubuntu.qcow2", missing)
+	memo.record("https://minio/images/debian.qcow2", missing)
+
+	memo.forgetObject("images", "ubuntu.qcow2")
+	assert.NoError(t, memo.check("https://minio/images/ubuntu.qcow2"))
+	assert.Error(t, memo.check("https://minio/images/debian.qcow2"))
+}
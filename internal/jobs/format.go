@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// formatted reports whether a request creates a filesystem on its volume
+func formatted(req types.ProvisionRequest) bool {
+	return req.Filesystem != "" && req.Filesystem != types.FilesystemNone
+}
+
+// validateFilesystem checks the filesystem and mkfs options of a request, which
+// only blank volumes may have
+func validateFilesystem(req types.ProvisionRequest) error {
+	if !formatted(req) {
+		if req.MkfsOptions != "" {
+			return types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("mkfs_options require a filesystem"),
+				map[string]string{"mkfs_options": "excluded"})
+		}
+		return nil
+	}
+	if req.Type != types.VolumeTypeBlank {
+		return types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("only blank volumes can be formatted"),
+			map[string]string{"filesystem": "excluded"})
+	}
+	if err := lvm.ValidateFilesystem(req.Filesystem, strings.Fields(req.MkfsOptions)); err != nil {
+		return types.NewError(types.ErrCodeInvalidRequest, err, map[string]string{"filesystem": "invalid"})
+	}
+	return nil
+}
+
+// formatVolumeStep creates the requested filesystem on a new blank volume. Existing
+// volumes are not formatted, as they may hold data.
+func (m *Manager) formatVolumeStep(_ context.Context, p *provision) error {
+	fields := logrus.Fields{
+		"job_id":      p.job.ID,
+		"volume_name": p.req.VolumeName,
+		"filesystem":  p.req.Filesystem,
+	}
+	if p.existing {
+		logrus.WithFields(fields).Info("Not formatting existing volume")
+		return nil
+	}
+
+	if err := m.lvmManager.FormatVolume(p.req.VolumeName, p.req.Filesystem, strings.Fields(p.req.MkfsOptions)); err != nil {
+		return types.NewError(types.ErrCodeFormatFailed, err, commandDetails(err))
+	}
+	logrus.WithFields(fields).Info("Formatted volume")
+	return nil
+}
+
+// makeSwapStep sets up a new swap volume as swap space. Existing volumes are left
+// as they are, as they may be in use as swap already.
+func (m *Manager) makeSwapStep(_ context.Context, p *provision) error {
+	fields := logrus.Fields{"job_id": p.job.ID, "volume_name": p.req.VolumeName}
+	if p.existing {
+		logrus.WithFields(fields).Info("Not setting up existing volume as swap")
+		return nil
+	}
+
+	if err := m.lvmManager.MakeSwap(p.req.VolumeName); err != nil {
+		return types.NewError(types.ErrCodeFormatFailed, err, commandDetails(err))
+	}
+	logrus.WithFields(fields).Info("Set up swap volume")
+	return nil
+}
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFilesystem(t *testing.T) {
+	blank := types.ProvisionRequest{VolumeName: "data-1", VolumeSizeGB: 10, Type: types.VolumeTypeBlank}
+	assert.NoError(t, validateFilesystem(blank))
+
+	blank.Filesystem = "xfs"
+	blank.MkfsOptions = "-L data"
+	assert.NoError(t, validateFilesystem(blank))
+
+	blank.Filesystem = types.FilesystemNone
+	assert.Error(t, validateFilesystem(blank), "options without a filesystem")
+
+	blank.Filesystem = "ext4"
+	blank.MkfsOptions = "-d /root"
+	assert.Error(t, validateFilesystem(blank))
+
+	swap := types.ProvisionRequest{VolumeName: "swap-1", VolumeSizeGB: 2, Type: types.VolumeTypeSwap, Filesystem: "ext4"}
+	assert.Error(t, validateFilesystem(swap))
+
+	image := types.ProvisionRequest{ImageURL: "https://minio/images/a.qcow2", Filesystem: "ext4"}
+	code, _ := types.ErrorCodeOf(validateFilesystem(image), "")
+	assert.Equal(t, types.ErrCodeInvalidRequest, code)
+}
@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+// collectGarbage removes what jobs interrupted by a restart left behind: partial
+// downloads in the image cache pools, and volumes that were created but never
+// populated. Failures are logged, as they must not prevent startup.
+func (m *Manager) collectGarbage() {
+	if m.imageCache != nil {
+		m.removePartialDownloads()
+	}
+	if m.lvmManager != nil {
+		m.removeIncompleteVolumes()
+	}
+}
+
+// removePartialDownloads deletes the partial files of downloads that never completed
+func (m *Manager) removePartialDownloads() {
+	for _, pool := range m.imageCache.Pools() {
+		files, err := os.ReadDir(pool.Path)
+		if err != nil {
+			logrus.WithError(err).WithField("pool", pool.Name).Warn("Failed to scan cache pool for partial downloads")
+			continue
+		}
+
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), ".partial") {
+				continue
+			}
+			var size int64
+			if info, err := file.Info(); err == nil {
+				size = info.Size()
+			}
+
+			path := filepath.Join(pool.Path, file.Name())
+			if err := m.imageCache.DeleteImage(path); err != nil {
+				logrus.WithError(err).WithField("path", path).Warn("Failed to remove partial download")
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				"pool":       pool.Name,
+				"path":       path,
+				"size_bytes": size,
+			}).Info("Removed partial download of interrupted job")
+		}
+	}
+}
+
+// removeIncompleteVolumes deletes the volumes of interrupted jobs, or only reports
+// them if they are to be kept
+func (m *Manager) removeIncompleteVolumes() {
+	volumes, err := m.lvmManager.IncompleteVolumes()
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to scan for incomplete volumes")
+		return
+	}
+
+	for _, volumeName := range volumes {
+		fields := logrus.Fields{"volume_name": volumeName, "volume_group": m.lvmManager.VolumeGroup()}
+		if m.keepIncompleteVolumes {
+			logrus.WithFields(fields).Warn("Keeping incomplete volume of interrupted job")
+			continue
+		}
+
+		if err := m.lvmManager.DeleteVolume(volumeName); err != nil {
+			logrus.WithError(err).WithFields(fields).Warn("Failed to remove incomplete volume")
+			continue
+		}
+		logrus.WithFields(fields).Info("Removed incomplete volume of interrupted job")
+		m.emit(events.Event{Type: events.VolumeDeleted, VolumeName: volumeName})
+		m.recordVolumeDeleted(context.Background(), m.lvmManager.VolumeGroup(), volumeName)
+	}
+}
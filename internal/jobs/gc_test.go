@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverJobsRemovesPartialDownloads(t *testing.T) {
+	cacheDir := t.TempDir()
+	imageCache, err := cache.NewDirectoryCache("images", cacheDir)
+	require.NoError(t, err)
+	poolDir := filepath.Join(cacheDir, "images")
+	require.NoError(t, os.MkdirAll(poolDir, 0o750))
+
+	cached := filepath.Join(poolDir, "ubuntu.qcow2")
+	partial := cache.PartialPath(filepath.Join(poolDir, "debian.qcow2"))
+	for _, path := range []string{cached, cached + ".sha256", partial} {
+		require.NoError(t, os.WriteFile(path, []byte("image"), 0o600))
+	}
+
+	manager := &Manager{jobs: make(map[string]*Job), imageCache: imageCache}
+	require.NoError(t, manager.RecoverJobs())
+
+	assert.FileExists(t, cached)
+	assert.FileExists(t, cached+".sha256")
+	assert.NoFileExists(t, partial)
+}
@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+const (
+	// maxLabels bounds the labels of a job, and maxLabelValueLength their values
+	maxLabels           = 32
+	maxLabelValueLength = 256
+	// maxMetricLabelValues bounds the values of each label finished jobs are counted
+	// by; further values are counted together as "other"
+	maxMetricLabelValues = 100
+)
+
+// labelKeyPattern allows keys such as "env", "ticket-id" or "example.com/tenant"
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_./-]{0,61}[A-Za-z0-9])?$`)
+
+var labelledJobsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "libvirt_volume_provisioner_labelled_jobs_total",
+		Help: "Total number of finished jobs by status and the value of each label configured in JOB_METRIC_LABELS",
+	},
+	[]string{"label", "value", "status"},
+)
+
+func init() {
+	prometheus.MustRegister(labelledJobsTotal)
+}
+
+// validateLabels checks the labels of a request
+func validateLabels(req types.ProvisionRequest) error {
+	if len(req.Labels) > maxLabels {
+		return types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("a job may have at most %d labels", maxLabels),
+			map[string]string{"labels": fmt.Sprintf("max=%d", maxLabels)})
+	}
+	for key, value := range req.Labels {
+		if !labelKeyPattern.MatchString(key) {
+			return types.NewError(types.ErrCodeInvalidRequest,
+				fmt.Errorf("invalid label key %q: must be up to 63 letters, digits, '_', '.', '/' or '-', "+
+					"starting and ending with a letter or digit", key),
+				map[string]string{"labels": "invalid key"})
+		}
+		if len(value) > maxLabelValueLength || strings.ContainsFunc(value, unicode.IsControl) {
+			return types.NewError(types.ErrCodeInvalidRequest,
+				fmt.Errorf("invalid value of label %s: must be up to %d characters without control characters",
+					key, maxLabelValueLength),
+				map[string]string{"labels": "invalid value"})
+		}
+	}
+	return nil
+}
+
+// parseLabelFilter parses the key=value label filters of a job listing
+func parseLabelFilter(filters []string) (map[string]string, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(filters))
+	for _, filter := range filters {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok || !labelKeyPattern.MatchString(key) {
+			return nil, types.NewError(types.ErrCodeInvalidRequest,
+				fmt.Errorf("invalid label filter %q: must be key=value", filter), map[string]string{"label": "invalid"})
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// metricLabels counts finished jobs by the values of some of their labels, keeping
+// the number of values of each bounded
+type metricLabels struct {
+	keys   []string
+	mu     sync.Mutex
+	values map[string]map[string]bool
+}
+
+// SetMetricLabels sets the job labels finished jobs are counted by in the
+// libvirt_volume_provisioner_labelled_jobs_total metric. Each label should have few
+// values, e.g. an environment or tenant rather than a ticket ID.
+func (m *Manager) SetMetricLabels(keys []string) error {
+	for _, key := range keys {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid label key %q", key)
+		}
+	}
+	if len(keys) == 0 {
+		m.metricLabels = nil
+		return nil
+	}
+	m.metricLabels = &metricLabels{keys: keys, values: make(map[string]map[string]bool)}
+	return nil
+}
+
+// countLabelledJob counts a finished job by its labels, if metric labels are configured
+func (m *Manager) countLabelledJob(job *Job) {
+	if m.metricLabels == nil {
+		return
+	}
+	for _, key := range m.metricLabels.keys {
+		if value, ok := job.Request.Labels[key]; ok {
+			labelledJobsTotal.WithLabelValues(key, m.metricLabels.value(key, value), string(job.Status)).Inc()
+		}
+	}
+}
+
+// value returns the metric label value of a job label
+func (l *metricLabels) value(key, value string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seen := l.values[key]
+	if seen == nil {
+		seen = make(map[string]bool)
+		l.values[key] = seen
+	}
+	if !seen[value] {
+		if len(seen) >= maxMetricLabelValues {
+			return "other"
+		}
+		seen[value] = true
+	}
+	return value
+}
@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLabels(t *testing.T) {
+	valid := map[string]string{"env": "prod", "ticket-id": "OPS-1234", "example.com/tenant": "Acme Corp", "empty": ""}
+	assert.NoError(t, validateLabels(types.ProvisionRequest{Labels: valid}))
+	assert.NoError(t, validateLabels(types.ProvisionRequest{}))
+
+	for _, labels := range []map[string]string{
+		{"": "prod"},
+		{"-env": "prod"},
+		{"env=": "prod"},
+		{strings.Repeat("k", 64): "prod"},
+		{"env": "prod\nstaging"},
+		{"env": strings.Repeat("v", maxLabelValueLength+1)},
+	} {
+		err := validateLabels(types.ProvisionRequest{Labels: labels})
+		code, _ := types.ErrorCodeOf(err, "")
+		assert.Equal(t, types.ErrCodeInvalidRequest, code, labels)
+	}
+
+	tooMany := make(map[string]string)
+	for i := range maxLabels + 1 {
+		tooMany[fmt.Sprintf("label-%d", i)] = "x"
+	}
+	assert.Error(t, validateLabels(types.ProvisionRequest{Labels: tooMany}))
+}
+
+func TestParseLabelFilter(t *testing.T) {
+	labels, err := parseLabelFilter([]string{"env=prod", "ticket=", "note=a=b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "ticket": "", "note": "a=b"}, labels)
+
+	labels, err = parseLabelFilter(nil)
+	require.NoError(t, err)
+	assert.Nil(t, labels)
+
+	for _, invalid := range []string{"env", "=prod", "bad key=x"} {
+		_, err := parseLabelFilter([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestJobLabels(t *testing.T) {
+	emitter := &recordingEmitter{}
+	manager := NewManager(&fakeImageStore{}, newFakeVolumeManager(), nil, nil)
+	manager.SetEventEmitter(emitter)
+	require.Error(t, manager.SetMetricLabels([]string{"bad key"}))
+	require.NoError(t, manager.SetMetricLabels([]string{"env"}))
+
+	labels := map[string]string{"env": "labels-test", "ticket": "OPS-1234"}
+	jobID, err := manager.StartJob(types.ProvisionRequest{
+		VolumeName:   "data",
+		VolumeSizeGB: 1,
+		Type:         types.VolumeTypeBlank,
+		Labels:       labels,
+	})
+	require.NoError(t, err)
+	<-manager.jobs[jobID].done
+
+	status, err := manager.GetJobStatus(jobID)
+	require.NoError(t, err)
+	assert.Equal(t, types.StatusCompleted, status.Status)
+	assert.Equal(t, labels, status.Labels)
+
+	var completed bool
+	for _, event := range emitter.events {
+		assert.Equal(t, labels, event.Labels, event.Type)
+		completed = completed || event.Type == events.JobCompleted
+	}
+	assert.True(t, completed)
+	assert.InDelta(t, 1, testutil.ToFloat64(labelledJobsTotal.WithLabelValues("env", "labels-test", "completed")), 0)
+}
+
+func TestMetricLabelValues(t *testing.T) {
+	labels := &metricLabels{keys: []string{"tenant"}, values: make(map[string]map[string]bool)}
+	for i := range maxMetricLabelValues {
+		assert.Equal(t, fmt.Sprint(i), labels.value("tenant", fmt.Sprint(i)))
+	}
+	assert.Equal(t, "other", labels.value("tenant", "new"))
+	assert.Equal(t, "0", labels.value("tenant", "0"))
+}
@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// lvmFailure is a common lvcreate or lvremove failure, recognised by its error message
+type lvmFailure struct {
+	pattern *regexp.Regexp
+	code    types.ErrorCode
+	reason  string
+	hint    string
+}
+
+var lvmFailures = []lvmFailure{
+	{
+		pattern: regexp.MustCompile(`(?i)insufficient free (space|extents)`),
+		code:    types.ErrCodeVolumeGroupFull,
+		reason:  "the volume group has too little free space",
+		hint: "delete unused volumes or extend the volume group with vgextend; vg_free_bytes is the space " +
+			"left for new volumes",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)volume group "?[^" ]*"? not found|cannot process volume group`),
+		code:    types.ErrCodeVolumeGroupNotFound,
+		reason:  "the volume group does not exist",
+		hint: "check that LVM_VOLUME_GROUP names a volume group listed by vgs, and that its physical " +
+			"volumes are present",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)excluded by (a )?filter|rejected by (a )?filter`),
+		code:    types.ErrCodeDeviceFiltered,
+		reason:  "a device of the volume group is excluded by LVM's device filter",
+		hint:    "check filter and global_filter in /etc/lvm/lvm.conf, and the LVM devices file (lvmdevices)",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)(logical volume .* in use|can't remove open logical volume)`),
+		code:    types.ErrCodeVolumeInUse,
+		reason:  "the volume is open",
+		hint:    "stop the domain or process holding the volume open, e.g. as shown by dmsetup info",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)failed to find logical volume`),
+		code:    types.ErrCodeVolumeNotFound,
+		reason:  "the volume does not exist",
+		hint:    "list the volume group's volumes with GET /api/v2/volumes",
+	},
+}
+
+// lvmError translates a common LVM failure into an error with its own code, the
+// line of the command's output explaining it, a remediation hint and the state of
+// the volume group as reported by vgs, so that operators can understand it without
+// access to the host. It returns nil for other errors.
+func (m *Manager) lvmError(ctx context.Context, action string, err error) *types.Error {
+	var cmdErr *lvm.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Command == "qemu-img" {
+		return nil
+	}
+	for _, failure := range lvmFailures {
+		line := matchingLine(cmdErr.Output, failure.pattern)
+		if line == "" {
+			continue
+		}
+		details := map[string]string{"command": cmdErr.Command, "error": line, "hint": failure.hint}
+		maps.Copy(details, m.volumeGroupDetails(ctx))
+		return types.NewError(failure.code, fmt.Errorf("failed to %s: %s: %s", action, failure.reason, line), details)
+	}
+	return nil
+}
+
+// volumeGroupDetails describes the volume group for error details, or why it
+// could not be described
+func (m *Manager) volumeGroupDetails(ctx context.Context) map[string]string {
+	status, err := m.lvmManager.VolumeGroupStatus(ctx)
+	if err != nil {
+		var cmdErr *lvm.CommandError
+		if errors.As(err, &cmdErr) {
+			return map[string]string{"vgs_error": strings.TrimSpace(cmdErr.Output)}
+		}
+		return map[string]string{"vgs_error": err.Error()}
+	}
+	return map[string]string{
+		"volume_group":  status.Name,
+		"vg_size_bytes": strconv.FormatInt(status.SizeBytes, 10),
+		"vg_free_bytes": strconv.FormatInt(status.FreeBytes, 10),
+		"vg_pv_count":   strconv.Itoa(status.PhysicalVolumes),
+		"vg_lv_count":   strconv.Itoa(status.LogicalVolumes),
+		"vg_attr":       status.Attributes,
+	}
+}
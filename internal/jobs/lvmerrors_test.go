@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lvmFailed(command, output string) error {
+	return &lvm.CommandError{Command: command, Output: output, Err: errors.New("exit status 5")}
+}
+
+func TestLVMError(t *testing.T) {
+	manager := NewManager(&fakeImageStore{}, newFakeVolumeManager("vm01-root"), nil, nil)
+
+	for _, tc := range []struct {
+		err  error
+		code types.ErrorCode
+		line string
+	}{
+		{
+			err:  lvmFailed("lvcreate", `  Volume group "data" has insufficient free space (2559 extents): 2560 required.`),
+			code: types.ErrCodeVolumeGroupFull,
+			line: `Volume group "data" has insufficient free space (2559 extents): 2560 required.`,
+		},
+		{
+			err:  lvmFailed("lvcreate", "  Volume group \"data\" not found\n  Cannot process volume group data\n"),
+			code: types.ErrCodeVolumeGroupNotFound,
+			line: `Volume group "data" not found`,
+		},
+		{
+			err:  lvmFailed("lvcreate", "  Device /dev/sdb excluded by a filter.\n"),
+			code: types.ErrCodeDeviceFiltered,
+			line: "Device /dev/sdb excluded by a filter.",
+		},
+		{
+			err:  lvmFailed("lvremove", "  Logical volume data/vm01-root contains a filesystem in use.\n"),
+			code: types.ErrCodeVolumeInUse,
+			line: "Logical volume data/vm01-root contains a filesystem in use.",
+		},
+		{
+			err:  lvmFailed("lvremove", `  Failed to find logical volume "data/vm02-root"`),
+			code: types.ErrCodeVolumeNotFound,
+			line: `Failed to find logical volume "data/vm02-root"`,
+		},
+	} {
+		lvmErr := manager.lvmError(context.Background(), "create volume", tc.err)
+		require.NotNil(t, lvmErr, tc.line)
+		assert.Equal(t, tc.code, lvmErr.Code, tc.line)
+		assert.Equal(t, tc.line, lvmErr.Details["error"], tc.line)
+		assert.NotEmpty(t, lvmErr.Details["hint"], tc.line)
+		assert.Equal(t, "data", lvmErr.Details["volume_group"], tc.line)
+		assert.Equal(t, "106300440576", lvmErr.Details["vg_free_bytes"], tc.line)
+		assert.Equal(t, "1", lvmErr.Details["vg_lv_count"], tc.line)
+	}
+
+	assert.Nil(t, manager.lvmError(context.Background(), "create volume", lvmFailed("lvcreate", "  Internal error\n")))
+	assert.Nil(t, manager.lvmError(context.Background(), "create volume",
+		lvmFailed("qemu-img", "qemu-img: Permission denied: excluded by a filter")))
+	assert.Nil(t, manager.lvmError(context.Background(), "create volume", errors.New("insufficient free space")))
+}
+
+func TestProvisionVolume_LVMFailure(t *testing.T) {
+	volumes := newFakeVolumeManager()
+	full := `  Volume group "data" has insufficient free space (10 extents): 2560 required.`
+	volumes.failures = map[string]error{"CreateVolume": lvmFailed("lvcreate", full)}
+	manager, _ := newProvisionTestManager(t, volumes)
+
+	req := types.ProvisionRequest{VolumeName: "web01-root", ImageURL: testImageURL, ImageType: "raw", VolumeSizeGB: 10}
+	err := manager.ProvisionVolume(context.Background(), provisionJob(req))
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeVolumeGroupFull, code)
+	assert.Equal(t, "lvcreate", details["command"])
+	assert.Equal(t, "107374182400", details["vg_size_bytes"])
+	assert.Contains(t, err.Error(), "failed to create volume: the volume group has too little free space")
+
+	// Rollback failures keep their code, with the diagnostics in their details
+	volumes.failures = map[string]error{
+		"PopulateVolume": errors.New("qemu-img convert failed"),
+		"DeleteVolume":   lvmFailed("lvremove", "  Logical volume data/web01-root in use.\n"),
+	}
+	job := provisionJob(req)
+	require.Error(t, manager.ProvisionVolume(context.Background(), job))
+	code, details = types.ErrorCodeOf(job.Error, "")
+	assert.Equal(t, types.ErrCodeRollbackFailed, code)
+	assert.Equal(t, "Logical volume data/web01-root in use.", details["error"])
+	assert.Equal(t, "wz--n-", details["vg_attr"])
+}
@@ -5,16 +5,29 @@ package jobs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/rossigee/libvirt-volume-provisioner/internal/libvirt"
+	miniogo "github.com/minio/minio-go/v7"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
 	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
 	"github.com/rossigee/libvirt-volume-provisioner/internal/minio"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/netbox"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/overlay"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/profiles"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/retry"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/schedule"
 	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
 	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
 	"github.com/sirupsen/logrus"
@@ -22,50 +35,631 @@ import (
 
 // Job represents a volume provisioning job.
 type Job struct {
-	ID         string
-	Status     types.JobStatus
-	Request    types.ProvisionRequest
-	Progress   *types.ProgressInfo
-	Error      error
-	CacheHit   bool
-	ImagePath  string
+	ID        string
+	Status    types.JobStatus
+	Request   types.ProvisionRequest
+	Progress  *types.ProgressInfo
+	Error     error
+	CacheHit  bool
+	ImagePath string
+	NetBox    *netbox.Object
+	// SubmittedRequest is the request before the profile and server-side defaults were applied
+	SubmittedRequest types.ProvisionRequest
+	// VolumeGroup is the volume group the volume is created in
+	VolumeGroup string
+	// ImageChecksum is the SHA256 of the image the volume is populated from, if known
+	ImageChecksum string
+	// DevicePath is the block device or overlay file of the provisioned volume
+	DevicePath string
+	// VolumeSizeBytes is the actual size of the created volume, after LVM rounded it up
+	VolumeSizeBytes int64
+	// ImageArchitecture is the CPU architecture of the image, if known
+	ImageArchitecture string
+	// ImageMetadata is read from the image's .meta.json file, if it has one
+	ImageMetadata *types.ImageMetadata
+	// SLO is the job's duration against its provisioning SLO target, once measured
+	SLO *types.SLOResult
+	// WrittenChecksum is the SHA256 of the WrittenBytes bytes written to the volume,
+	// for raw images
+	WrittenChecksum string
+	WrittenBytes    int64
+	// WriteVerified records whether WrittenChecksum matched ImageChecksum, if both are known
+	WriteVerified *bool
+	// Verification is set for jobs checking the integrity of an existing volume rather
+	// than provisioning one, and records the outcome of the check
+	Verification *types.VolumeVerification
+	// StageTimings records when the job entered and left each stage
+	StageTimings []types.StageTiming
+	// OriginalError is the error that failed the job and RollbackError the failure to
+	// roll it back, if rolling back failed. Error is then the rollback failure, as it
+	// leaves something behind that needs attention.
+	OriginalError error
+	RollbackError error
+	// RetryCount is the number of retries made across all stages
+	RetryCount int
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 	cancelFunc context.CancelFunc
+	// startedAt is when the job started running, after waiting to start
+	startedAt time.Time
+	// done is closed once the job has finished, for the jobs depending on it
+	done chan struct{}
+	// queued is set while the job waits for capacity to start work; workStartedAt is
+	// when its first pipeline step started
+	queued        atomic.Bool
+	workStartedAt time.Time
+
+	// onStageChange, if set, is called when the job moves to a new stage
+	onStageChange func(stage string)
+	// throughput measures the recent throughput of the current stage for its ETA
+	throughput throughput
+
+	// stateMu guards the status, progress, error and update time of the job where they
+	// change while other goroutines read them: waiting to start, starting, finishing
+	// and being cancelled. The database sync and status lookups read them under it.
+	stateMu sync.Mutex
+
+	// resumed is closed when a paused job is resumed; nil while the job is not paused
+	pauseMu     sync.Mutex
+	resumed     chan struct{}
+	pausedAt    time.Time
+	pausedTotal time.Duration
+}
+
+// setWaiting reports the job as waiting to start, in stage
+func (j *Job) setWaiting(stage string, now time.Time) {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	j.Progress = &types.ProgressInfo{Stage: stage}
+	j.UpdatedAt = now
+}
+
+// setStatus moves the job to status at now. An error, if given, is recorded unless
+// the job already has one, e.g. from being cancelled.
+func (j *Job) setStatus(status types.JobStatus, now time.Time, err error) {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	j.Status = status
+	j.UpdatedAt = now
+	if j.Error == nil {
+		j.Error = err
+	}
+}
+
+// touch records that the job changed at now
+func (j *Job) touch(now time.Time) {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	j.UpdatedAt = now
+}
+
+// Paused reports whether the job has been paused
+func (j *Job) Paused() bool {
+	j.pauseMu.Lock()
+	defer j.pauseMu.Unlock()
+	return j.resumed != nil
+}
+
+// pause makes the job stop at its next checkpoint, returning false if it was already paused
+func (j *Job) pause() bool {
+	j.pauseMu.Lock()
+	defer j.pauseMu.Unlock()
+	if j.resumed != nil {
+		return false
+	}
+	j.resumed = make(chan struct{})
+	j.pausedAt = time.Now()
+	return true
+}
+
+// resume lets a paused job continue, returning false if it was not paused
+func (j *Job) resume() bool {
+	j.pauseMu.Lock()
+	defer j.pauseMu.Unlock()
+	if j.resumed == nil {
+		return false
+	}
+	close(j.resumed)
+	j.resumed = nil
+	j.pausedTotal += time.Since(j.pausedAt)
+	return true
+}
+
+// pausedTime returns how long the job has spent paused up to now
+func (j *Job) pausedTime(now time.Time) time.Duration {
+	j.pauseMu.Lock()
+	defer j.pauseMu.Unlock()
+	if j.resumed != nil {
+		return j.pausedTotal + now.Sub(j.pausedAt)
+	}
+	return j.pausedTotal
+}
+
+// withTimeout returns a context that is cancelled once the job has run for timeout,
+// not counting time spent paused
+func (j *Job) withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	start := time.Now()
+	pausedBefore := j.pausedTime(start)
+
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-timer.C:
+				active := now.Sub(start) - (j.pausedTime(now) - pausedBefore)
+				if active >= timeout {
+					cancel(context.DeadlineExceeded)
+					return
+				}
+				timer.Reset(timeout - active)
+			}
+		}
+	}()
+
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// WaitWhilePaused implements the minio.Pauser interface. It blocks while the job
+// is paused, returning early if ctx is done.
+func (j *Job) WaitWhilePaused(ctx context.Context) error {
+	j.pauseMu.Lock()
+	resumed := j.resumed
+	j.pauseMu.Unlock()
+
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("job cancelled while paused: %w", ctx.Err())
+	}
+}
+
+// status returns the job status, reporting unfinished jobs that are paused as paused
+func (j *Job) status() types.JobStatus {
+	if (j.Status == types.StatusRunning || j.Status == types.StatusPending) && j.Paused() {
+		return types.StatusPaused
+	}
+	return j.Status
 }
 
 // UpdateProgress implements the ProgressUpdater interface.
 func (j *Job) UpdateProgress(stage string, percent float64, bytesProcessed, bytesTotal int64) {
+	previous := ""
+	if j.Progress != nil {
+		previous = j.Progress.Stage
+	}
+
+	now := time.Now()
+	rate, eta := j.throughput.update(now, stage, bytesProcessed, bytesTotal)
 	j.Progress = &types.ProgressInfo{
 		Stage:          stage,
 		Percent:        percent,
 		BytesProcessed: bytesProcessed,
 		BytesTotal:     bytesTotal,
+		BytesPerSec:    rate,
+		ETA:            eta,
+	}
+	j.UpdatedAt = now
+
+	if stage != previous {
+		j.stageChanged(stage)
+	}
+}
+
+// UpdateHashRate implements the minio.HashRateUpdater interface.
+func (j *Job) UpdateHashRate(bytesPerSec float64) {
+	if j.Progress != nil {
+		j.Progress.HashBytesPerSec = bytesPerSec
+	}
+}
+
+// effectiveRequest returns the request as the server carries it out
+func (j *Job) effectiveRequest() *types.EffectiveRequest {
+	return &types.EffectiveRequest{
+		ProvisionRequest: j.Request,
+		VolumeGroup:      j.VolumeGroup,
+		TimeoutSeconds:   int(jobTimeout.Seconds()),
+		Verify:           j.Verification != nil,
 	}
+}
+
+// setStage moves the job to a new stage, keeping its byte counters
+func (j *Job) setStage(stage string, percent float64) {
+	previous := j.Progress.Stage
+	j.Progress.Stage = stage
+	j.Progress.Percent = percent
+	j.Progress.HashBytesPerSec = 0
+	j.Progress.BytesPerSec, j.Progress.ETA = 0, nil
 	j.UpdatedAt = time.Now()
+
+	if stage != previous {
+		j.stageChanged(stage)
+	}
+}
+
+// stageChanged records the timing of a new stage and notifies onStageChange
+func (j *Job) stageChanged(stage string) {
+	j.finishStage(j.UpdatedAt)
+	j.StageTimings = append(j.StageTimings, types.StageTiming{Stage: stage, StartedAt: j.UpdatedAt})
+
+	if j.onStageChange != nil {
+		j.onStageChange(stage)
+	}
+}
+
+// retryContext returns a context in which retried operations record their attempts
+// against the job's current stage
+func (j *Job) retryContext(ctx context.Context) context.Context {
+	return retry.RecordAttempts(ctx, j.recordAttempts)
+}
+
+// recordAttempts records the attempts a retried operation made in the current stage
+func (j *Job) recordAttempts(attempts int) {
+	if n := len(j.StageTimings); n > 0 {
+		j.StageTimings[n-1].Attempts += attempts
+	}
+	if attempts > 1 {
+		j.RetryCount += attempts - 1
+	}
+}
+
+// finishStage ends the timing of the current stage, if one is in progress
+func (j *Job) finishStage(now time.Time) {
+	n := len(j.StageTimings)
+	if n == 0 || j.StageTimings[n-1].FinishedAt != nil {
+		return
+	}
+	current := &j.StageTimings[n-1]
+	current.FinishedAt = &now
+	current.DurationMs = now.Sub(current.StartedAt).Milliseconds()
+}
+
+// ImageStore fetches images and their sidecar objects from object storage.
+// It is implemented by minio.Client.
+type ImageStore interface {
+	Available() error
+	StatImage(ctx context.Context, imageURL string) (miniogo.ObjectInfo, error)
+	StatObject(ctx context.Context, bucketName, objectName string) (miniogo.ObjectInfo, error)
+	ObjectModified(ctx context.Context, bucketName, objectName, etag string, lastModified time.Time) (bool, error)
+	GetObjectContent(ctx context.Context, bucketName, objectName string) ([]byte, error)
+	ProbeImage(ctx context.Context, imageURL string) (*minio.ImageInfo, error)
+	DownloadImageToPath(ctx context.Context, imageURL, destPath string, updater minio.ProgressUpdater) (string, error)
+}
+
+// VolumeManager creates, populates and removes the logical volumes jobs provision.
+// It is implemented by lvm.Manager.
+type VolumeManager interface {
+	VolumeGroup() string
+	VolumeExists(volumeName string) bool
+	DevicePath(volumeName string) string
+	CheckQuota(ctx context.Context, sizeBytes int64) error
+	CheckAlignment() error
+	MultipathChecked() bool
+	CheckPaths(ctx context.Context) error
+	CreateVolume(ctx context.Context, volumeName string, sizeBytes int64) error
+	VolumeFormat() string
+	PopulateVolume(ctx context.Context, imagePath, volumeName, imageType, format string,
+		updater lvm.ProgressUpdater) (string, error)
+	HashVolume(ctx context.Context, volumeName string, length int64, updater lvm.ProgressUpdater) (string, error)
+	CheckVolume(ctx context.Context, volumeName string) (*lvm.CheckResult, error)
+	PopulateVolumeExpanding(ctx context.Context, imagePath, volumeName, imageType, partition string) error
+	FormatVolume(volumeName, filesystem string, options []string) error
+	MakeSwap(volumeName string) error
+	CreateSnapshot(volumeName string) (string, error)
+	MergeSnapshot(snapshotName string) error
+	MarkComplete(volumeName string) error
+	IncompleteVolumes() ([]string, error)
+	SetResultTag(volumeName string, document []byte) error
+	GetVolumeInfo(volumeName string) (*lvm.VolumeInfo, error)
+	ListVolumeInfo() ([]lvm.VolumeInfo, error)
+	DeleteVolume(volumeName string) error
+	VolumeGroupStatus(ctx context.Context) (*lvm.VolumeGroupStatus, error)
+}
+
+// ImageCache stores downloaded images keyed by checksum.
+// It is implemented by libvirt.PoolManager and, without libvirt, by cache.DirectoryCache.
+type ImageCache interface {
+	HasPool(poolName string) bool
+	CheckCache(poolName, checksum string) (*cache.Entry, error)
+	AllocateImageFile(poolName, imageName string, sizeBytes uint64) (string, error)
+	CommitImageFile(partialPath, imagePath string) error
+	SetValidator(imagePath string, validator cache.Validator) error
+	Validator(imagePath string) (*cache.Validator, error)
+	CreateCacheEntry(imagePath, checksum string) error
+	Pools() []*cache.Pool
+	CalculateChecksum(filePath string) (string, error)
+	DeleteImage(imagePath string) error
+	Capacity() ([]cache.PoolCapacity, error)
+	Entries() ([]cache.Entry, error)
+}
+
+// NetBoxClient validates requested sizes against NetBox, records provisioned volumes and
+// looks up the disk sizes NetBox records. It is implemented by netbox.Client.
+type NetBoxClient interface {
+	ValidateVolume(ctx context.Context, vmID int, diskName string, sizeMB int) (*netbox.Object, error)
+	RecordVolume(ctx context.Context, object *netbox.Object, comments string) error
+	RecordedSize(ctx context.Context, vmID int, diskName string) (*netbox.Object, int, error)
+}
+
+// DomainLister finds the libvirt domains using a volume, and lists the disks of all
+// domains. It is implemented by libvirt.PoolManager.
+type DomainLister interface {
+	DomainsUsingDevice(devicePath string) ([]types.AttachedDomain, error)
+	DomainDisks() ([]types.DomainDisk, error)
+}
+
+// ManifestWriter stores job manifests in MinIO. It is implemented by minio.Client.
+type ManifestWriter interface {
+	PutURLContent(ctx context.Context, objectURL string, content []byte, contentType string) error
+}
+
+// EventEmitter receives job lifecycle events. It is implemented by events.Emitter.
+type EventEmitter interface {
+	Emit(event events.Event)
 }
 
 // Manager manages volume provisioning jobs.
 type Manager struct {
-	minioClient *minio.Client
-	jobs        map[string]*Job
-	lvmManager  *lvm.Manager
-	libvirtPool *libvirt.PoolManager
-	store       *storage.Store
-	semaphore   chan struct{}
-	mu          sync.RWMutex
+	minioClient     ImageStore
+	jobs            map[string]*Job
+	lvmManager      VolumeManager
+	imageCache      ImageCache
+	store           *storage.Store
+	netbox          NetBoxClient
+	netboxWriteBack bool
+	events          EventEmitter
+	domains         DomainLister
+	overlays        *overlay.Manager
+	profiles        profiles.Profiles
+	failures        *failureMemo
+	// windows restricts when jobs may start work; maintenance rejects new jobs
+	windows     schedule.Windows
+	maintenance atomic.Bool
+	// selfTest is the startup self-test report; jobs are rejected if it is not ready
+	selfTest atomic.Pointer[types.SelfTestReport]
+	// version is the version of this provisioner, recorded with each job
+	version string
+	// downloadSlots and diskSlots limit concurrent downloads and volume writes separately,
+	// so one job can download while another converts
+	downloadSlots *semaphore
+	diskSlots     *semaphore
+	// keepIncompleteVolumes leaves volumes of interrupted jobs in place at startup
+	keepIncompleteVolumes bool
+	// compressionBudget limits the coroutines compressing an image for the cache
+	compressionBudget int
+	// deletionTokens holds the unexpired tokens confirming volume deletions, guarded by mu
+	deletionTokens map[string]deletionToken
+	// stuckThreshold is how long a running job may go without progress before it is
+	// reported as stuck, and failed if failStuckJobs is set; zero disables it
+	stuckThreshold time.Duration
+	failStuckJobs  bool
+	// stuckReported holds the last update of the stuck jobs already logged, guarded by mu
+	stuckReported map[string]time.Time
+	// diskDegradedPercent and diskNotReadyPercent are the usage percentages of the cache
+	// pool and database filesystems at which health is degraded and readiness fails;
+	// zero disables them
+	diskDegradedPercent int
+	diskNotReadyPercent int
+	// resultTarget is where completed jobs leave a result document, empty for nowhere
+	resultTarget string
+	// manifests, if set, receives a manifest of each completed job under manifestURL,
+	// named after manifestHost
+	manifests    ManifestWriter
+	manifestURL  string
+	manifestHost string
+	// expiredImagePolicy is what happens to jobs for images past their expiry date
+	expiredImagePolicy string
+	expiries           imageExpiries
+	// defaultArchitecture is the architecture images must be built for when requests name none
+	defaultArchitecture string
+	// settingsMu guards the settings changed at runtime, which take precedence over the
+	// configured concurrency; queueResumed is closed when the paused queue is resumed,
+	// and nil while it is not paused
+	settingsMu           sync.Mutex
+	settings             types.SettingsUpdate
+	settingsUpdatedAt    time.Time
+	configuredDownloads  int
+	configuredDiskWrites int
+	queueResumed         chan struct{}
+	// maxQueueDepth is how many jobs may wait for capacity before new jobs are refused,
+	// zero for any; queueDepth counts them and workDuration estimates when they start
+	maxQueueDepth int
+	queueDepth    atomic.Int64
+	workDuration  workDuration
+	// metricLabels are the job labels finished jobs are counted by, if configured
+	metricLabels *metricLabels
+	// slo measures completed jobs against their provisioning SLO target, if configured
+	slo *sloTracker
+	// cleanupMu guards the volumes waiting to be deleted after their rollback failed,
+	// by volume name, and how long after the rollback they are deleted again
+	cleanupMu    sync.Mutex
+	cleanups     map[string]*types.PendingCleanup
+	cleanupRetry time.Duration
+	mu           sync.RWMutex
 }
 
 // NewManager creates a new job manager.
-func NewManager(minioClient *minio.Client, lvmManager *lvm.Manager,
-	libvirtPool *libvirt.PoolManager, store *storage.Store) *Manager {
+func NewManager(minioClient ImageStore, lvmManager VolumeManager,
+	imageCache ImageCache, store *storage.Store) *Manager {
 	return &Manager{
 		minioClient: minioClient,
 		lvmManager:  lvmManager,
-		libvirtPool: libvirtPool,
+		imageCache:  imageCache,
 		store:       store,
 		jobs:        make(map[string]*Job),
-		semaphore:   make(chan struct{}, 2), // Max 2 concurrent operations
+		// Max 2 concurrent downloads and 2 concurrent volume writes
+		downloadSlots:        newSemaphore(2),
+		diskSlots:            newSemaphore(2),
+		configuredDownloads:  2,
+		configuredDiskWrites: 2,
+	}
+}
+
+// SetConcurrency sets how many jobs may download images and write volumes at the same
+// time, unless changed at runtime. Jobs holding slots when the limits are lowered keep
+// them until they are done.
+func (m *Manager) SetConcurrency(downloads, diskWrites int) {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	m.configuredDownloads, m.configuredDiskWrites = downloads, diskWrites
+	m.applySettings()
+}
+
+// SetDomainLister enables refusing to overwrite or delete volumes used by libvirt domains
+func (m *Manager) SetDomainLister(domains DomainLister) {
+	m.domains = domains
+}
+
+// SetCompressionBudget sets how many coroutines may compress an image for the cache at once
+func (m *Manager) SetCompressionBudget(coroutines int) {
+	m.compressionBudget = coroutines
+}
+
+// SetKeepIncompleteVolumes keeps volumes left behind by interrupted jobs at startup,
+// reporting them instead of deleting them
+func (m *Manager) SetKeepIncompleteVolumes(keep bool) {
+	m.keepIncompleteVolumes = keep
+}
+
+// SetNetBoxClient enables validation of requests that reference a NetBox virtual machine.
+// When writeBack is set, completed volumes are recorded as NetBox journal entries.
+func (m *Manager) SetNetBoxClient(client NetBoxClient, writeBack bool) {
+	m.netbox = client
+	m.netboxWriteBack = writeBack
+}
+
+// SetProfiles sets the named profiles requests may reference
+func (m *Manager) SetProfiles(p profiles.Profiles) {
+	m.profiles = p
+}
+
+// SetEventEmitter enables publishing of job lifecycle events
+func (m *Manager) SetEventEmitter(emitter EventEmitter) {
+	m.events = emitter
+}
+
+// SetFailureTTL enables remembering images that are missing or fail checksum
+// verification for ttl, failing jobs for them immediately. Zero disables it.
+func (m *Manager) SetFailureTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		m.failures = nil
+		return
+	}
+	m.failures = newFailureMemo(ttl)
+}
+
+// SetWindows restricts provisioning to the given time windows. Jobs submitted
+// outside them wait in the pending state until a window opens.
+func (m *Manager) SetWindows(windows schedule.Windows) {
+	m.windows = windows
+}
+
+// SetMaintenance enters or leaves maintenance mode. In maintenance mode new jobs
+// and image refreshes are rejected, while running jobs are left to finish.
+func (m *Manager) SetMaintenance(enabled bool) error {
+	if m.maintenance.Swap(enabled) != enabled {
+		logrus.WithField("maintenance", enabled).Info("Maintenance mode changed")
+	}
+	return nil
+}
+
+// GetMaintenance reports maintenance mode, the jobs still draining and the provisioning windows
+func (m *Manager) GetMaintenance() (*types.MaintenanceStatus, error) {
+	now := time.Now()
+	status := &types.MaintenanceStatus{
+		Maintenance: m.maintenance.Load(),
+		ActiveJobs:  m.GetActiveJobs(),
+		WindowOpen:  m.windows.Open(now),
+	}
+	if len(m.windows) > 0 {
+		status.Windows = m.windows.String()
+		if next, ok := m.windows.NextOpen(now); ok && !status.WindowOpen {
+			status.NextWindow = &next
+		}
+	}
+	return status, nil
+}
+
+// SetVersion sets the version of this provisioner, recorded with each job so that
+// the binary that ran a job can be told
+func (m *Manager) SetVersion(version string) {
+	m.version = version
+}
+
+// SetSelfTestReport records the startup self-test report. While the report has
+// failing critical checks, new jobs and image refreshes are rejected.
+func (m *Manager) SetSelfTestReport(report *types.SelfTestReport) {
+	m.selfTest.Store(report)
+}
+
+// SelfTestReport returns the startup self-test report, or nil if none was recorded
+func (m *Manager) SelfTestReport() *types.SelfTestReport {
+	return m.selfTest.Load()
+}
+
+// checkReady returns an error if the self-test found the environment unusable.
+// A manager without a report, as in tests, is ready.
+func (m *Manager) checkReady() error {
+	report := m.selfTest.Load()
+	if report == nil || report.Ready {
+		return nil
+	}
+	var failed []string
+	for _, check := range report.Checks {
+		if check.Critical && !check.Passed {
+			failed = append(failed, check.Name)
+		}
+	}
+	return types.NewError(types.ErrCodeNotReady,
+		fmt.Errorf("provisioner failed its startup self-test: %s", strings.Join(failed, ", ")),
+		map[string]string{"failed_checks": strings.Join(failed, ",")})
+}
+
+// errMaintenance is returned for work submitted in maintenance mode
+func errMaintenance() error {
+	return types.NewError(types.ErrCodeMaintenance,
+		fmt.Errorf("provisioner is in maintenance mode and accepts no new jobs"), nil)
+}
+
+// waitForWindow blocks until a provisioning window is open or ctx is done
+func (m *Manager) waitForWindow(ctx context.Context, job *Job) error {
+	for {
+		now := time.Now()
+		next, ok := m.windows.NextOpen(now)
+		if !ok {
+			return fmt.Errorf("no provisioning window is configured to open")
+		}
+		if !next.After(now) {
+			return nil
+		}
+
+		job.setWaiting("waiting_for_window", now)
+		logrus.WithFields(logrus.Fields{
+			"job_id":      job.ID,
+			"next_window": next,
+		}).Info("Job waiting for provisioning window")
+
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// emit publishes a lifecycle event if an emitter is configured
+func (m *Manager) emit(event events.Event) {
+	if m.events != nil {
+		m.events.Emit(event)
 	}
 }
 
@@ -74,11 +668,31 @@ func (m *Manager) syncToDatabase(ctx context.Context, job *Job) {
 	if m.store == nil {
 		return // Database not available
 	}
+	record, ok := jobRecord(job)
+	if !ok {
+		return
+	}
+	record.ProvisionerVersion = m.version
+
+	if err := m.store.SaveJob(ctx, record); err != nil {
+		logrus.WithError(err).WithField("job_id", job.ID).Error("Failed to sync job to database")
+	}
+}
 
-	requestJSON, err := json.Marshal(job.Request)
+// jobRecord builds the database record of a job, reporting false if it cannot be encoded
+func jobRecord(job *Job) (*storage.JobRecord, bool) {
+	job.stateMu.Lock()
+	defer job.stateMu.Unlock()
+
+	requestJSON, err := json.Marshal(job.SubmittedRequest)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to marshal job request for database sync")
-		return
+		return nil, false
+	}
+	effectiveJSON, err := json.Marshal(job.effectiveRequest())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to marshal effective job request for database sync")
+		return nil, false
 	}
 	progressJSON := ""
 	if job.Progress != nil {
@@ -91,66 +705,187 @@ func (m *Manager) syncToDatabase(ctx context.Context, job *Job) {
 	if job.Error != nil {
 		errorMessage = job.Error.Error()
 	}
+	originalError, rollbackError := "", ""
+	if job.RollbackError != nil {
+		originalError, rollbackError = job.OriginalError.Error(), job.RollbackError.Error()
+	}
 
 	completedAt := (*time.Time)(nil)
 	if job.Status == types.StatusCompleted || job.Status == types.StatusFailed {
-		completedAt = &job.UpdatedAt
+		updatedAt := job.UpdatedAt
+		completedAt = &updatedAt
 	}
-
-	record := &storage.JobRecord{
-		ID:           job.ID,
-		Status:       string(job.Status),
-		RequestJSON:  string(requestJSON),
-		ProgressJSON: progressJSON,
-		ErrorMessage: errorMessage,
-		RetryCount:   0, // TODO: Integrate retry count once retry logic is implemented
-		CreatedAt:    job.CreatedAt,
-		UpdatedAt:    job.UpdatedAt,
-		CompletedAt:  completedAt,
+	sloJSON := ""
+	if job.SLO != nil {
+		if data, err := json.Marshal(job.SLO); err == nil {
+			sloJSON = string(data)
+		}
 	}
 
-	if err := m.store.SaveJob(ctx, record); err != nil {
-		logrus.WithError(err).WithField("job_id", job.ID).Error("Failed to sync job to database")
-	}
+	return &storage.JobRecord{
+		ID:                   job.ID,
+		Status:               string(job.status()),
+		RequestJSON:          string(requestJSON),
+		EffectiveRequestJSON: string(effectiveJSON),
+		ProgressJSON:         progressJSON,
+		ErrorMessage:         errorMessage,
+		RetryCount:           job.RetryCount,
+		CreatedAt:            job.CreatedAt,
+		UpdatedAt:            job.UpdatedAt,
+		CompletedAt:          completedAt,
+		Identity:             job.Request.Identity,
+		SLOJSON:              sloJSON,
+		SLOViolated:          job.SLO != nil && job.SLO.Violated,
+		OriginalError:        originalError,
+		RollbackError:        rollbackError,
+	}, true
 }
 
-// RecoverJobs marks any in-progress jobs from previous runs as failed
-// This should be called during startup to clean up jobs interrupted by daemon restart
+// RecoverJobs marks any in-progress jobs from previous runs as failed, then removes
+// the artifacts they left behind. Jobs that had not started yet are resumed once
+// that is done. This should be called during startup, before any job is started,
+// to clean up jobs interrupted by daemon restart.
 func (m *Manager) RecoverJobs() error {
-	if m.store == nil {
-		return nil // Database not available
+	var pending []*storage.JobRecord
+	if m.store != nil {
+		logrus.Info("Recovering jobs from previous run...")
+		var err error
+		if pending, err = m.pendingJobs(); err != nil {
+			return fmt.Errorf("failed to list pending jobs: %w", err)
+		}
+		if err := m.store.MarkInProgressJobsFailed(); err != nil {
+			return fmt.Errorf("failed to mark in-progress jobs as failed: %w", err)
+		}
+		logrus.Info("Job recovery completed")
 	}
 
-	logrus.Info("Recovering jobs from previous run...")
-	if err := m.store.MarkInProgressJobsFailed(); err != nil {
-		return fmt.Errorf("failed to mark in-progress jobs as failed: %w", err)
-	}
-	logrus.Info("Job recovery completed")
+	m.collectGarbage()
+	m.requeueJobs(pending)
 	return nil
 }
 
 // StartJob starts a new volume provisioning job.
 func (m *Manager) StartJob(req types.ProvisionRequest) (string, error) {
+	if m.maintenance.Load() {
+		return "", errMaintenance()
+	}
+	if err := m.checkReady(); err != nil {
+		return "", err
+	}
+	if err := m.checkQueueDepth(); err != nil {
+		return "", err
+	}
+
+	submitted := req
+	req, err := m.profiles.Apply(req)
+	if err != nil {
+		return "", types.NewError(types.ErrCodeUnknownProfile, err, nil)
+	}
+	switch {
+	case !slices.Contains([]string{"", types.VolumeTypeImage, types.VolumeTypeBlank, types.VolumeTypeSwap}, req.Type):
+		return "", types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("unknown volume type: %s", req.Type),
+			map[string]string{"type": "oneof=image blank swap"})
+	case req.NeedsImage() && req.ImageURL == "":
+		return "", types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("image_url is required"),
+			map[string]string{"image_url": "required"})
+	case !req.NeedsImage() && req.ImageURL != "":
+		return "", types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("image_url must not be set for %s volumes", req.Type),
+			map[string]string{"image_url": "excluded"})
+	case !req.NeedsImage() && req.Overlay:
+		return "", types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("%s volumes cannot be overlays", req.Type),
+			map[string]string{"overlay": "excluded"})
+	}
+	if err := validateFilesystem(req); err != nil {
+		return "", err
+	}
+	if err := validateWindows(req); err != nil {
+		return "", err
+	}
+	if req.VolumeFormat, err = m.volumeFormat(req); err != nil {
+		return "", err
+	}
+	if err := validateLabels(req); err != nil {
+		return "", err
+	}
+	if req.Architecture, err = m.requestArchitecture(req); err != nil {
+		return "", err
+	}
+	if err := m.validateDependencies(req); err != nil {
+		return "", err
+	}
+	if !slices.Contains([]string{"", "zlib", "zstd"}, req.CacheCompression) {
+		return "", types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("unknown cache compression: %s", req.CacheCompression),
+			map[string]string{"cache_compression": "oneof=zlib zstd"})
+	}
+	if err := validateSize(req); err != nil {
+		return "", err
+	}
+	if req.Overlay && m.overlays == nil {
+		return "", types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("overlay volumes are not configured"), nil)
+	}
+	if err := m.checkQuota(req); err != nil {
+		return "", err
+	}
+
+	if m.imageCache != nil {
+		if !m.imageCache.HasPool(req.CachePool) {
+			return "", types.NewError(types.ErrCodeUnknownCachePool, fmt.Errorf("unknown cache pool: %s", req.CachePool), nil)
+		}
+		if req.CachePool == "" {
+			req.CachePool = m.imageCache.Pools()[0].Name // The default pool comes first
+		}
+	}
+
+	var netboxObject *netbox.Object
+	if req.NetBoxVMID != 0 {
+		if m.netbox == nil {
+			return "", types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("NetBox integration is not configured"), nil)
+		}
+		object, err := m.netbox.ValidateVolume(context.Background(), req.NetBoxVMID, req.NetBoxDisk, netboxSizeMB(req))
+		if err != nil {
+			return "", types.NewError(types.ErrCodeNetBoxValidationFailed, fmt.Errorf("NetBox validation failed: %w", err), nil)
+		}
+		netboxObject = object
+	}
+
 	jobID := uuid.New().String()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute) // 30 minute timeout
+	// The job timeout starts once the job may run, see runJob
+	ctx, cancel := context.WithCancel(context.Background())
 
 	job := &Job{
-		ID:         jobID,
-		Status:     types.StatusPending,
-		Request:    req,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
-		cancelFunc: cancel,
+		ID:               jobID,
+		Status:           types.StatusPending,
+		Request:          req,
+		SubmittedRequest: submitted,
+		NetBox:           netboxObject,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+		cancelFunc:       cancel,
+		done:             make(chan struct{}),
+	}
+	if m.lvmManager != nil && !req.Overlay {
+		job.VolumeGroup = m.lvmManager.VolumeGroup()
 	}
 
 	m.mu.Lock()
 	m.jobs[jobID] = job
 	m.mu.Unlock()
+	// Jobs that may start at once join the queue before returning, so that a burst of
+	// submissions counts against the maximum queue depth
+	if len(req.DependsOn) == 0 && (req.NotBefore == nil || !req.NotBefore.After(job.CreatedAt)) {
+		m.enqueue(job)
+	}
 
 	// Persist to database
 	m.syncToDatabase(ctx, job)
 
+	logrus.WithFields(logrus.Fields{
+		"job_id":      jobID,
+		"volume_name": req.VolumeName,
+		"identity":    req.Identity,
+	}).Info("Job submitted")
+
 	// Start job in background
 	go m.runJob(ctx, job)
 
@@ -164,49 +899,202 @@ func (m *Manager) GetJobStatus(jobID string) (*types.StatusResponse, error) {
 	m.mu.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("job not found: %s", jobID)
+		return nil, types.NewError(types.ErrCodeJobNotFound, fmt.Errorf("job not found: %s", jobID), nil)
 	}
 
+	job.stateMu.Lock()
 	response := &types.StatusResponse{
-		JobID:         job.ID,
-		Status:        job.Status,
-		Progress:      job.Progress,
-		CorrelationID: job.ID, // Use job ID as correlation ID
-		CreatedAt:     job.CreatedAt,
-		UpdatedAt:     job.UpdatedAt,
+		JobID:              job.ID,
+		Status:             job.status(),
+		Progress:           job.Progress,
+		StageTimings:       append([]types.StageTiming(nil), job.StageTimings...),
+		RetryCount:         job.RetryCount,
+		CorrelationID:      job.Request.CorrelationID,
+		Identity:           job.Request.Identity,
+		ProvisionerVersion: m.version,
+		Labels:             job.Request.Labels,
+		CreatedAt:          job.CreatedAt,
+		UpdatedAt:          job.UpdatedAt,
+	}
+	if job.SubmittedRequest.VolumeName != "" {
+		submitted := job.SubmittedRequest
+		response.Request = &submitted
+		response.EffectiveRequest = job.effectiveRequest()
+	}
+	if response.CorrelationID == "" {
+		response.CorrelationID = job.ID // Use job ID as correlation ID
 	}
 
 	if job.Error != nil {
 		response.Error = job.Error.Error()
+		response.ErrorCode, response.ErrorDetails = types.ErrorCodeOf(job.Error, types.ErrCodeInternal)
+	}
+	if job.RollbackError != nil {
+		response.OriginalError = job.OriginalError.Error()
+		response.OriginalErrorCode, _ = types.ErrorCodeOf(job.OriginalError, types.ErrCodeInternal)
+		response.RollbackError = job.RollbackError.Error()
+	}
+
+	if job.NetBox != nil {
+		response.NetBox = &types.NetBoxObject{
+			Type: job.NetBox.Type,
+			ID:   job.NetBox.ID,
+			Name: job.NetBox.Name,
+			URL:  job.NetBox.URL,
+		}
 	}
 
-	// Include cache information for completed jobs
+	// Include the volume and cache information for completed jobs, e.g. for domain XML
 	if job.Status == types.StatusCompleted {
-		response.CacheHit = &job.CacheHit
-		response.ImagePath = job.ImagePath
+		response.DevicePath = job.DevicePath
+		response.VolumeSizeBytes = job.VolumeSizeBytes
+		response.WrittenChecksum = job.WrittenChecksum
+		response.WriteVerified = job.WriteVerified
+		if job.Request.NeedsImage() {
+			response.CacheHit = &job.CacheHit
+			response.ImagePath = job.ImagePath
+			response.ImageChecksum = job.ImageChecksum
+			response.ImageArchitecture = job.ImageArchitecture
+			response.ImageMetadata = job.ImageMetadata
+		}
+		response.SLO = job.SLO
+	}
+	job.stateMu.Unlock()
+	response.Queue = m.queueInfo(job, time.Now())
+	response.Verification = job.Verification
+
+	return response, nil
+}
+
+// defaultListLimit is the page size of job listings that do not set a limit
+const defaultListLimit = 50
+
+// ListJobs returns a page of the job history from the database. Jobs still held
+// in memory are reported with their live status.
+func (m *Manager) ListJobs(req types.JobListRequest) (*types.JobListResponse, error) {
+	if m.store == nil {
+		return nil, types.NewError(types.ErrCodeNotSupported, fmt.Errorf("job history is not available without a database"), nil)
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	labels, err := parseLabelFilter(req.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := storage.ListJobsFilter{
+		Status:    req.Status,
+		Identity:  req.Identity,
+		SortBy:    req.SortBy,
+		Ascending: req.Order == "asc",
+		Since:     req.Since,
+		Until:     req.Until,
+		Cursor:    req.Cursor,
+		Limit:     limit + 1, // One extra record tells whether there is a next page
+		// Only completed jobs are measured against their SLO target
+		SLOViolated:      req.SLOViolated,
+		Labels:           labels,
+		VolumeNamePrefix: req.VolumeNamePrefix,
+	}
+
+	records, err := m.store.ListJobs(filter)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			return nil, types.NewError(types.ErrCodeInvalidRequest, err, map[string]string{"cursor": "invalid"})
+		}
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	response := &types.JobListResponse{Jobs: make([]types.StatusResponse, 0, len(records))}
+	if len(records) > limit {
+		records = records[:limit]
+		response.NextCursor = storage.EncodeCursor(records[limit-1], req.SortBy)
+	}
+
+	for _, record := range records {
+		if status, err := m.GetJobStatus(record.ID); err == nil {
+			response.Jobs = append(response.Jobs, *status)
+			continue
+		}
+		response.Jobs = append(response.Jobs, statusFromRecord(record))
 	}
 
 	return response, nil
 }
 
+// statusFromRecord builds the status of a job that is only held in the database
+func statusFromRecord(record *storage.JobRecord) types.StatusResponse {
+	status := types.StatusResponse{
+		JobID:              record.ID,
+		Status:             types.JobStatus(record.Status),
+		Error:              record.ErrorMessage,
+		RetryCount:         record.RetryCount,
+		CorrelationID:      record.ID,
+		Identity:           record.Identity,
+		ProvisionerVersion: record.ProvisionerVersion,
+		OriginalError:      record.OriginalError,
+		RollbackError:      record.RollbackError,
+		CreatedAt:          record.CreatedAt,
+		UpdatedAt:          record.UpdatedAt,
+	}
+
+	var req types.ProvisionRequest
+	if err := json.Unmarshal([]byte(record.RequestJSON), &req); err == nil {
+		status.Request = &req
+	}
+	// Jobs recorded before effective requests were stored only have the request
+	if record.EffectiveRequestJSON != "" {
+		var effective types.EffectiveRequest
+		if err := json.Unmarshal([]byte(record.EffectiveRequestJSON), &effective); err == nil {
+			status.EffectiveRequest = &effective
+			req = effective.ProvisionRequest
+		}
+	}
+	if req.CorrelationID != "" {
+		status.CorrelationID = req.CorrelationID
+	}
+	status.Labels = req.Labels
+	if record.ProgressJSON != "" {
+		var progress types.ProgressInfo
+		if err := json.Unmarshal([]byte(record.ProgressJSON), &progress); err == nil {
+			status.Progress = &progress
+		}
+	}
+	if record.SLOJSON != "" {
+		var slo types.SLOResult
+		if err := json.Unmarshal([]byte(record.SLOJSON), &slo); err == nil {
+			status.SLO = &slo
+		}
+	}
+
+	return status
+}
+
 // CancelJob cancels a running job
 func (m *Manager) CancelJob(jobID string) error {
 	m.mu.Lock()
 	job, exists := m.jobs[jobID]
 	if !exists {
 		m.mu.Unlock()
-		return fmt.Errorf("job not found: %s", jobID)
+		return types.NewError(types.ErrCodeJobNotFound, fmt.Errorf("job not found: %s", jobID), nil)
 	}
 
+	job.stateMu.Lock()
 	if job.Status != types.StatusRunning && job.Status != types.StatusPending {
+		status := job.Status
+		job.stateMu.Unlock()
 		m.mu.Unlock()
-		return fmt.Errorf("job cannot be cancelled: %s", job.Status)
+		return types.NewError(types.ErrCodeJobNotCancellable, fmt.Errorf("job cannot be cancelled: %s", status), nil)
 	}
 
 	job.cancelFunc()
 	job.Status = types.StatusFailed
 	job.UpdatedAt = time.Now()
-	job.Error = fmt.Errorf("job cancelled by user")
+	job.Error = types.NewError(types.ErrCodeJobCancelled, fmt.Errorf("job cancelled by user"), nil)
+	job.stateMu.Unlock()
 	m.mu.Unlock()
 
 	// Persist cancellation to database
@@ -215,123 +1103,505 @@ func (m *Manager) CancelJob(jobID string) error {
 	return nil
 }
 
+// CancelJobs cancels the unfinished jobs matching all of a request's filters at once,
+// e.g. the jobs enqueued by a bad rollout. A matching job that finishes before it is
+// cancelled is reported as failed rather than failing the request.
+func (m *Manager) CancelJobs(req types.BulkCancelRequest) (*types.BulkCancelResponse, error) {
+	olderThan, err := req.Validate()
+	if err != nil {
+		return nil, types.NewError(types.ErrCodeInvalidRequest, err, nil)
+	}
+
+	now := time.Now()
+	var matched []string
+	m.mu.RLock()
+	for id, job := range m.jobs {
+		status := job.status()
+		if status != types.StatusPending && status != types.StatusRunning && status != types.StatusPaused {
+			continue
+		}
+		correlationID := job.Request.CorrelationID
+		if correlationID == "" {
+			correlationID = job.ID
+		}
+		if (req.Status != "" && string(status) != req.Status) ||
+			!strings.HasPrefix(correlationID, req.CorrelationIDPrefix) ||
+			!strings.HasPrefix(job.Request.VolumeName, req.VolumeNamePrefix) ||
+			(olderThan > 0 && now.Sub(job.CreatedAt) < olderThan) {
+			continue
+		}
+		matched = append(matched, id)
+	}
+	m.mu.RUnlock()
+	slices.Sort(matched)
+
+	response := &types.BulkCancelResponse{Cancelled: []string{}}
+	for _, id := range matched {
+		if err := m.CancelJob(id); err != nil {
+			if response.Failed == nil {
+				response.Failed = make(map[string]string)
+			}
+			response.Failed[id] = err.Error()
+			continue
+		}
+		response.Cancelled = append(response.Cancelled, id)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status":                req.Status,
+		"correlation_id_prefix": req.CorrelationIDPrefix,
+		"volume_name_prefix":    req.VolumeNamePrefix,
+		"older_than":            req.OlderThan,
+		"cancelled":             len(response.Cancelled),
+		"failed":                len(response.Failed),
+	}).Warn("Cancelled jobs in bulk")
+	return response, nil
+}
+
+// jobTimeout limits how long a job may run once its provisioning window is open,
+// not counting time spent paused
+const jobTimeout = 30 * time.Minute
+
+// PauseJob pauses an unfinished job. The job stops before its next stage, or within a
+// download, and keeps any volume it has created until it is resumed or cancelled.
+func (m *Manager) PauseJob(jobID string) error {
+	job, err := m.unfinishedJob(jobID, types.ErrCodeJobNotPausable, "paused")
+	if err != nil {
+		return err
+	}
+
+	if !job.pause() {
+		return types.NewError(types.ErrCodeJobNotPausable, fmt.Errorf("job is already paused: %s", jobID), nil)
+	}
+	job.touch(time.Now())
+	m.syncToDatabase(context.Background(), job)
+	m.emit(events.Event{
+		Type:       events.JobPaused,
+		JobID:      job.ID,
+		VolumeName: job.Request.VolumeName,
+		Labels:     job.Request.Labels,
+	})
+	return nil
+}
+
+// ResumeJob lets a paused job continue from where it stopped
+func (m *Manager) ResumeJob(jobID string) error {
+	job, err := m.unfinishedJob(jobID, types.ErrCodeJobNotPaused, "resumed")
+	if err != nil {
+		return err
+	}
+
+	if !job.resume() {
+		return types.NewError(types.ErrCodeJobNotPaused, fmt.Errorf("job is not paused: %s", jobID), nil)
+	}
+	job.touch(time.Now())
+	m.syncToDatabase(context.Background(), job)
+	m.emit(events.Event{
+		Type:       events.JobResumed,
+		JobID:      job.ID,
+		VolumeName: job.Request.VolumeName,
+		Labels:     job.Request.Labels,
+	})
+	return nil
+}
+
+// unfinishedJob looks up a pending or running job, failing with code if it has finished
+func (m *Manager) unfinishedJob(jobID string, code types.ErrorCode, action string) (*Job, error) {
+	m.mu.RLock()
+	job, exists := m.jobs[jobID]
+	m.mu.RUnlock()
+
+	if !exists {
+		return nil, types.NewError(types.ErrCodeJobNotFound, fmt.Errorf("job not found: %s", jobID), nil)
+	}
+	if job.Status != types.StatusRunning && job.Status != types.StatusPending {
+		return nil, types.NewError(code, fmt.Errorf("job cannot be %s: %s", action, job.Status), nil)
+	}
+	return job, nil
+}
+
 // runJob executes a provisioning job
 func (m *Manager) runJob(ctx context.Context, job *Job) {
-	// Acquire semaphore (limit concurrent operations)
-	select {
-	case m.semaphore <- struct{}{}:
-		defer func() { <-m.semaphore }()
-	case <-ctx.Done():
-		job.Status = types.StatusFailed
-		job.UpdatedAt = time.Now()
-		m.syncToDatabase(ctx, job)
-		return
+	job.onStageChange = func(stage string) {
+		m.emit(events.Event{
+			Type:       events.JobStageChanged,
+			JobID:      job.ID,
+			VolumeName: job.Request.VolumeName,
+			Stage:      stage,
+			Labels:     job.Request.Labels,
+		})
 	}
 
-	job.Status = types.StatusRunning
-	job.UpdatedAt = time.Now()
-	m.syncToDatabase(ctx, job)
-
 	defer func() {
-		job.UpdatedAt = time.Now()
+		m.dequeue(job)
+		job.touch(time.Now())
 		m.syncToDatabase(ctx, job)
+		if job.done != nil {
+			close(job.done)
+		}
+		// Written once the job is finished, so that waiting for MinIO holds nothing up
+		if job.Status == types.StatusCompleted && job.Verification == nil {
+			m.writeJobManifest(job)
+		}
+	}()
+
+	// A panic fails the job, with the stack trace in its error, rather than crashing
+	// the provisioner and leaving the job running in the database
+	defer func() {
+		if r := recover(); r != nil {
+			job.finishStage(time.Now())
+			job.Error = panicError(job, r)
+			m.failJob(job, job.Error)
+		}
 	}()
 
-	// Execute provisioning steps
-	err := m.ProvisionVolume(ctx, job)
+	// The job stays pending until the jobs it depends on have completed, its
+	// scheduled time has come, the queue is not paused and a provisioning window opens
+	err := m.waitForDependencies(ctx, job)
+	if err == nil {
+		err = m.waitForSchedule(ctx, job)
+	}
+	if err == nil {
+		m.enqueue(job)
+		err = m.waitForQueue(ctx, job)
+	}
+	if err == nil {
+		err = m.waitForWindow(ctx, job)
+	}
+	if err == nil {
+		runCtx, cancel := job.withTimeout(ctx, jobTimeout)
+		defer cancel()
+
+		job.startedAt = time.Now()
+		job.setStatus(types.StatusRunning, job.startedAt, nil)
+		m.syncToDatabase(ctx, job)
+		m.emit(events.Event{
+			Type:       events.JobStarted,
+			JobID:      job.ID,
+			VolumeName: job.Request.VolumeName,
+			Labels:     job.Request.Labels,
+		})
+
+		// Execute provisioning or verification steps
+		if job.Verification != nil {
+			err = m.runVerification(runCtx, job)
+		} else {
+			err = m.ProvisionVolume(runCtx, job)
+		}
+	}
+	finished := time.Now()
+	job.finishStage(finished)
+	// Verifications do not count towards the duration queued provisioning jobs are estimated to take
+	if !job.workStartedAt.IsZero() && job.Verification == nil {
+		m.workDuration.record(finished.Sub(job.workStartedAt))
+	}
 	if err != nil {
-		job.Status = types.StatusFailed
-		job.Error = err
+		m.failJob(job, err)
 		return
 	}
 
-	job.Status = types.StatusCompleted
+	job.setStatus(types.StatusCompleted, finished, nil)
+	if job.Verification != nil {
+		m.emit(events.Event{
+			Type:       events.JobCompleted,
+			JobID:      job.ID,
+			VolumeName: job.Request.VolumeName,
+		})
+		return
+	}
+	m.evaluateSLO(job, finished)
+	m.countLabelledJob(job)
+	m.emit(events.Event{
+		Type:       events.JobCompleted,
+		JobID:      job.ID,
+		VolumeName: job.Request.VolumeName,
+		ImagePath:  job.ImagePath,
+		Labels:     job.Request.Labels,
+	})
+
+	if m.netboxWriteBack && job.NetBox != nil {
+		m.recordNetBoxVolume(ctx, job)
+	}
+	m.writeResultDocument(job)
 }
 
-// ProvisionVolume performs the actual volume provisioning
-func (m *Manager) ProvisionVolume(ctx context.Context, job *Job) error {
-	req := job.Request
+// panicError logs a panic recovered from a job with its stack trace, returning the
+// error the job fails with
+func panicError(job *Job, r any) error {
+	stack := debug.Stack()
+	logrus.WithFields(logrus.Fields{
+		"job_id": job.ID,
+		"panic":  fmt.Sprint(r),
+		"stack":  string(stack),
+	}).Error("Job panicked")
+	return types.NewError(types.ErrCodeInternal, fmt.Errorf("job panicked: %v\n%s", r, stack),
+		map[string]string{"panic": fmt.Sprint(r)})
+}
 
-	// Track provisioning state for rollback
-	volumeCreated := false
-	provisionFailed := false
+// failJob marks a job failed with err, unless a step already recorded a more
+// specific error, and reports the failure
+func (m *Manager) failJob(job *Job, err error) {
+	job.setStatus(types.StatusFailed, time.Now(), err)
+	code, _ := types.ErrorCodeOf(job.Error, types.ErrCodeInternal)
+	stage := ""
+	if job.Progress != nil {
+		stage = job.Progress.Stage
+	}
+	m.countLabelledJob(job)
+	m.emit(events.Event{
+		Type:       events.JobFailed,
+		JobID:      job.ID,
+		VolumeName: job.Request.VolumeName,
+		Stage:      stage,
+		ImageURL:   job.Request.ImageURL,
+		Error:      job.Error.Error(),
+		ErrorCode:  string(code),
+		Labels:     job.Request.Labels,
+	})
+}
+
+// recordNetBoxVolume writes the provisioned volume details back to NetBox.
+// Failures are logged but do not fail the job, as the volume itself is usable.
+func (m *Manager) recordNetBoxVolume(ctx context.Context, job *Job) {
+	req := job.Request
+	source := req.ImageURL
+	if !req.NeedsImage() {
+		source = "no image"
+	}
+	comments := fmt.Sprintf("Provisioned LVM volume %s (%d GB) from %s (job %s)",
+		req.VolumeName, req.SizeGB(), source, job.ID)
+
+	if err := m.netbox.RecordVolume(ctx, job.NetBox, comments); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"job_id":    job.ID,
+			"netbox_vm": job.NetBox.ID,
+		}).Warn("Failed to record volume in NetBox")
+	}
+}
 
+// ProvisionVolume performs the actual volume provisioning
+func (m *Manager) ProvisionVolume(ctx context.Context, job *Job) error {
 	// Update progress
 	job.Progress = &types.ProgressInfo{
 		Stage:   "initializing",
 		Percent: 0,
 	}
 
-	// Step 1: Check image cache or download
-	job.Progress.Stage = "checking_cache"
-	job.Progress.Percent = 5
+	return m.runPipeline(ctx, job, m.provisioningSteps(job.Request))
+}
 
-	imagePath, err := m.getOrDownloadImage(ctx, req, job)
+// fetchImageStep checks the request against the image's metadata, then checks the
+// image cache, downloading the image on a miss
+func (m *Manager) fetchImageStep(ctx context.Context, p *provision) error {
+	if err := m.fetchImageMetadata(ctx, p); err != nil {
+		return err
+	}
+	imagePath, err := m.getOrDownloadImage(ctx, p.req, p.job)
 	if err != nil {
 		return fmt.Errorf("failed to get image: %w", err)
 	}
+	p.imagePath = imagePath
+	return nil
+}
 
-	// Step 2: Create LVM volume
-	job.Progress.Stage = "creating_volume"
-	job.Progress.Percent = 50
+// createVolumeStep creates the LVM volume. An existing volume used by a libvirt
+// domain is not reused unless the request allows it, as it would be overwritten.
+func (m *Manager) createVolumeStep(ctx context.Context, p *provision) error {
+	p.existing = m.lvmManager.VolumeExists(p.req.VolumeName)
+	if p.existing && !p.req.AllowAttached {
+		if err := m.checkNotAttached(p.req.VolumeName, m.lvmManager.DevicePath(p.req.VolumeName)); err != nil {
+			return err
+		}
+	}
+	if err := m.lvmManager.CreateVolume(p.job.retryContext(ctx), p.req.VolumeName, p.req.SizeBytes()); err != nil {
+		var quota *lvm.QuotaError
+		if errors.As(err, &quota) {
+			return quotaExceeded(quota)
+		}
+		if lvmErr := m.lvmError(ctx, "create volume", err); lvmErr != nil {
+			return lvmErr
+		}
+		code := types.ErrCodeVolumeCreateFailed
+		var incompatible *lvm.IncompatibleError
+		if errors.As(err, &incompatible) {
+			code = types.ErrCodeVolumeIncompatible
+		}
+		return types.NewError(code, fmt.Errorf("failed to create volume: %w", err), commandDetails(err))
+	}
+	p.job.DevicePath = m.lvmManager.DevicePath(p.req.VolumeName)
+	p.job.VolumeSizeBytes = m.volumeSize(p)
+	m.recordVolume(ctx, p.job)
+	return nil
+}
 
-	if err := m.lvmManager.CreateVolume(ctx, req.VolumeName, req.VolumeSizeGB); err != nil {
-		provisionFailed = true
-		return fmt.Errorf("failed to create volume: %w", err)
+// deleteVolumeStep deletes a volume whose provisioning failed after it was created.
+// Existing volumes that were to be snapshotted are kept, as they are restored instead,
+// and so are existing volumes reused as blank volumes, as they were not written to.
+func (m *Manager) deleteVolumeStep(p *provision) error {
+	if p.existing && (p.req.Snapshot || !p.req.NeedsImage()) {
+		return nil
 	}
-	volumeCreated = true
 
-	// Rollback defer: Delete volume if provisioning fails after creation
-	defer func() {
-		if volumeCreated && provisionFailed {
-			logrus.WithFields(logrus.Fields{
-				"job_id":      job.ID,
-				"volume_name": req.VolumeName,
-			}).Warn("Rolling back: deleting failed volume")
-
-			if deleteErr := m.lvmManager.DeleteVolume(req.VolumeName); deleteErr != nil {
-				logrus.WithError(deleteErr).WithFields(logrus.Fields{
-					"job_id":      job.ID,
-					"volume_name": req.VolumeName,
-				}).Error("Rollback failed: could not delete volume")
-
-				// Combine errors: original error + rollback failure
-				job.Error = fmt.Errorf("provision failed + rollback failed: %w", deleteErr)
-			}
+	logrus.WithFields(logrus.Fields{
+		"job_id":      p.job.ID,
+		"volume_name": p.req.VolumeName,
+	}).Warn("Rolling back: deleting failed volume")
+
+	if err := m.lvmManager.DeleteVolume(p.req.VolumeName); err != nil {
+		// Combine errors: original error + rollback failure
+		details := commandDetails(err)
+		if lvmErr := m.lvmError(context.Background(), "delete volume", err); lvmErr != nil {
+			details = lvmErr.Details
 		}
-	}()
+		m.enqueueCleanup(p.job.ID, p.req.VolumeName, err)
+		return types.NewError(types.ErrCodeRollbackFailed,
+			fmt.Errorf("provision failed + rollback failed: %w", err), details)
+	}
+	m.emit(events.Event{Type: events.VolumeDeleted, JobID: p.job.ID, VolumeName: p.req.VolumeName})
+	m.recordVolumeDeleted(context.Background(), p.job.VolumeGroup, p.req.VolumeName)
+	return nil
+}
+
+// recordVolume adds a created volume to the volume records, so the volumes built
+// from an image can be found later. Failures are logged, as the volume is usable.
+func (m *Manager) recordVolume(ctx context.Context, job *Job) {
+	if m.store == nil {
+		return
+	}
+
+	record := &storage.VolumeRecord{
+		Name:          job.Request.VolumeName,
+		VolumeGroup:   job.VolumeGroup,
+		SizeGB:        job.Request.SizeGB(),
+		ImageURL:      job.Request.ImageURL,
+		ImageChecksum: job.ImageChecksum,
+		VolumeFormat:  job.Request.VolumeFormat,
+		JobID:         job.ID,
+		CreatedAt:     time.Now(),
+	}
+	if err := m.store.SaveVolume(ctx, record); err != nil {
+		logrus.WithError(err).WithField("job_id", job.ID).Error("Failed to record volume")
+	}
+}
+
+// recordVolumeWrite records the checksum and size of the data written to a job's
+// volume, recorded when the volume was created, so the volume can be verified later
+func (m *Manager) recordVolumeWrite(ctx context.Context, job *Job) {
+	if m.store == nil || job.WrittenChecksum == "" || job.WrittenBytes == 0 {
+		return
+	}
 
-	// Step 3: Convert and populate volume
-	job.Progress.Stage = "converting"
-	job.Progress.Percent = 75
+	if err := m.store.UpdateVolumeWrite(ctx, job.VolumeGroup, job.Request.VolumeName, job.ID,
+		job.WrittenChecksum, job.WrittenBytes); err != nil {
+		logrus.WithError(err).WithField("job_id", job.ID).Error("Failed to record volume write")
+	}
+}
 
-	if err := m.lvmManager.PopulateVolume(ctx, imagePath, req.VolumeName, req.ImageType, job); err != nil {
-		provisionFailed = true
-		return fmt.Errorf("failed to populate volume: %w", err)
+// recordVolumeDeleted marks a volume as deleted in the volume records
+func (m *Manager) recordVolumeDeleted(ctx context.Context, volumeGroup, volumeName string) {
+	m.removeResultDocument(volumeName)
+	if m.store == nil {
+		return
 	}
 
-	// Step 4: Finalize
-	job.Progress.Stage = "finalizing"
-	job.Progress.Percent = 100
+	if err := m.store.MarkVolumeDeleted(ctx, volumeGroup, volumeName, time.Now()); err != nil {
+		logrus.WithError(err).WithField("volume_name", volumeName).Error("Failed to record volume deletion")
+	}
+}
 
+// populateVolumeStep converts the image and writes it to the volume, expanding a
+// partition of a Windows image to fill the volume if the request asks for it.
+// Common qemu-img failures are reported with their own error codes, and corrupt
+// images are evicted from the cache.
+func (m *Manager) populateVolumeStep(ctx context.Context, p *provision) error {
+	if p.req.Windows != nil && p.req.Windows.ExpandPartition != "" {
+		if err := m.lvmManager.PopulateVolumeExpanding(p.job.retryContext(ctx), p.imagePath, p.req.VolumeName,
+			p.imageFormat(), p.req.Windows.ExpandPartition); err != nil {
+			return types.NewError(types.ErrCodeVolumePopulateFailed, err, commandDetails(err))
+		}
+		return nil
+	}
+	written, err := m.lvmManager.PopulateVolume(p.job.retryContext(ctx), p.imagePath, p.req.VolumeName,
+		p.imageFormat(), p.req.VolumeFormat, p.job)
+	if err != nil {
+		if qemuErr := qemuImgError(err); qemuErr != nil {
+			if qemuErr.Code == types.ErrCodeImageCorrupt {
+				m.evictImage(p.job, p.imagePath)
+			}
+			return qemuErr
+		}
+		return types.NewError(types.ErrCodeVolumePopulateFailed,
+			fmt.Errorf("failed to populate volume: %w", err), commandDetails(err))
+	}
+	if written != "" {
+		return m.verifyWrite(ctx, p, written)
+	}
+	return nil
+}
+
+// verifyWrite compares the checksum of the bytes written to a volume with the
+// image's checksum, recording the result. A mismatch means the cached image is
+// corrupt, so it is evicted for the next job to download it again.
+func (m *Manager) verifyWrite(ctx context.Context, p *provision, written string) error {
+	p.job.WrittenChecksum = written
+	// Raw images are written whole, so the volume can be verified later
+	if info, err := os.Stat(p.imagePath); err == nil {
+		p.job.WrittenBytes = info.Size()
+	}
+	m.recordVolumeWrite(ctx, p.job)
+	if p.job.ImageChecksum == "" {
+		return nil // Nothing to compare with
+	}
+
+	verified := written == p.job.ImageChecksum
+	p.job.WriteVerified = &verified
+	if !verified {
+		m.evictImage(p.job, p.imagePath)
+		return types.NewError(types.ErrCodeVolumeChecksumMismatch,
+			fmt.Errorf("checksum %s of the data written does not match image checksum %s", written, p.job.ImageChecksum),
+			map[string]string{"expected": p.job.ImageChecksum, "actual": written})
+	}
 	return nil
 }
 
-// getOrDownloadImage checks cache or downloads image and returns the path
+// getOrDownloadImage checks cache or downloads image and returns the path.
+// Images that recently could not be found or verified fail without a download.
 func (m *Manager) getOrDownloadImage(ctx context.Context, req types.ProvisionRequest, job *Job) (string, error) {
+	if err := m.failures.check(req.ImageURL); err != nil {
+		return "", err
+	}
+
+	imagePath, err := m.fetchImage(ctx, req, job)
+	if err != nil {
+		m.failures.record(req.ImageURL, err)
+		return "", err
+	}
+	m.failures.forget(req.ImageURL)
+	return imagePath, nil
+}
+
+// fetchImage returns the cached image for a request, downloading it on a cache miss
+func (m *Manager) fetchImage(ctx context.Context, req types.ProvisionRequest, job *Job) (string, error) {
 	// Get checksum from MinIO .sha256 file
 	checksum, err := m.getImageChecksum(ctx, req.ImageURL)
+	verifyChecksum := err == nil
 	if err != nil {
 		logrus.WithError(err).Warn("Failed to get image checksum from MinIO, using URL as cache key")
 		checksum = req.ImageURL // Fallback to URL
 	}
 
 	// Check if image is cached using checksum as key
-	cachedImage, err := m.libvirtPool.CheckCache(checksum)
+	cachedImage, err := m.imageCache.CheckCache(req.CachePool, checksum)
 	if err != nil {
 		logrus.WithError(err).Warn("Failed to check image cache, proceeding with download")
 	}
 
+	// Without a .sha256 object the cache is keyed by URL, so check the object has not been replaced
+	if cachedImage != nil && !verifyChecksum && !m.cachedImageCurrent(ctx, req.ImageURL, cachedImage.Path) &&
+		m.evictImage(job, cachedImage.Path) {
+		cachedImage = nil
+	}
+
 	if cachedImage != nil {
 		logrus.WithFields(logrus.Fields{
 			"job_id":      job.ID,
@@ -342,6 +1612,9 @@ func (m *Manager) getOrDownloadImage(ctx context.Context, req types.ProvisionReq
 		}).Info("Using cached image")
 		job.CacheHit = true
 		job.ImagePath = cachedImage.Path
+		if verifyChecksum {
+			job.ImageChecksum = checksum
+		}
 		return cachedImage.Path, nil
 	}
 
@@ -353,36 +1626,79 @@ func (m *Manager) getOrDownloadImage(ctx context.Context, req types.ProvisionReq
 	}).Info("Image not cached, downloading")
 
 	// Generate image name from URL
-	imageName := libvirt.GetImageNameFromURL(req.ImageURL)
+	imageName := cache.GetImageNameFromURL(req.ImageURL)
+
+	// Determine the image size so the pool's size limit can be enforced, and its
+	// version so an image cached by URL can be revalidated later
+	var imageSize uint64
+	var validator *cache.Validator
+	if bucketName, objectName, err := parseImageURL(req.ImageURL); err == nil {
+		if objInfo, err := m.minioClient.StatObject(ctx, bucketName, objectName); err == nil {
+			imageSize = uint64(max(objInfo.Size, 0))
+			validator = &cache.Validator{ETag: objInfo.ETag, LastModified: objInfo.LastModified}
+		}
+	}
 
 	// Allocate file path in cache directory (no libvirt volume allocation).
 	// This preserves compression for QCOW2 images by storing them as plain files.
-	imagePath, err := m.libvirtPool.AllocateImageFile(imageName)
+	imagePath, err := m.imageCache.AllocateImageFile(req.CachePool, imageName, imageSize)
 	if err != nil {
-		return "", fmt.Errorf("failed to allocate cache file: %w", err)
+		code := types.ErrCodeCacheAllocationFailed
+		if errors.Is(err, cache.ErrInsufficientSpace) {
+			code = types.ErrCodeInsufficientSpace
+		}
+		return "", types.NewError(code, fmt.Errorf("failed to allocate cache file: %w", err), nil)
+	}
+	// A new version of an image must not replace the one overlays are backed by
+	cachePath := imagePath
+	if req.CacheCompression != "" {
+		cachePath = cache.CompressedPath(imagePath)
+	}
+	if err := m.checkImageNotPinned(cachePath); err != nil {
+		return "", types.NewError(types.ErrCodeCacheAllocationFailed, err, nil)
 	}
 
-	// Download image to cache path
-	job.Progress.Stage = "downloading"
-	job.Progress.Percent = 10
+	// Download next to the cache path and move the image into place only once it is
+	// verified, so an interrupted download never leaves a truncated image behind
+	job.setStage("downloading", 10)
 
-	if err := m.minioClient.DownloadImageToPath(ctx, req.ImageURL, imagePath, job); err != nil {
-		// Cleanup failed download
-		_ = m.libvirtPool.DeleteImage(imagePath)
-		return "", fmt.Errorf("failed to download image: %w", err)
+	partialPath := cache.PartialPath(imagePath)
+	actual, err := m.minioClient.DownloadImageToPath(job.retryContext(ctx), req.ImageURL, partialPath, job)
+	if err != nil {
+		_ = m.imageCache.DeleteImage(partialPath)
+		return "", downloadError(fmt.Errorf("failed to download image: %w", err))
 	}
 
-	// If we don't have a checksum from MinIO, calculate it locally
-	if checksum == "" {
-		var err error
-		checksum, err = libvirt.CalculateChecksum(imagePath)
-		if err != nil {
-			logrus.WithError(err).Warn("Failed to calculate checksum, cache may not work properly")
-			checksum = req.ImageURL // Fallback to URL as cache key
+	// The checksum was calculated while downloading, so verification needs no second read
+	if verifyChecksum {
+		job.setStage("verifying", 40)
+		if actual != checksum {
+			_ = m.imageCache.DeleteImage(partialPath)
+			return "", types.NewError(types.ErrCodeChecksumMismatch,
+				fmt.Errorf("downloaded image checksum %s does not match expected %s", actual, checksum),
+				map[string]string{"expected": checksum, "actual": actual})
 		}
 	}
 
-	if err := m.libvirtPool.CreateCacheEntry(imagePath, checksum); err != nil {
+	if req.CacheCompression != "" {
+		if err := m.compressImage(ctx, job, req, partialPath, cachePath); err != nil {
+			return "", err
+		}
+		partialPath, imagePath = cache.PartialPath(cachePath), cachePath
+	}
+
+	if err := m.imageCache.CommitImageFile(partialPath, imagePath); err != nil {
+		_ = m.imageCache.DeleteImage(partialPath)
+		return "", types.NewError(types.ErrCodeCacheAllocationFailed, err, nil)
+	}
+
+	if !verifyChecksum && validator != nil {
+		if err := m.imageCache.SetValidator(imagePath, *validator); err != nil {
+			logrus.WithError(err).Warn("Failed to record cached image version")
+		}
+	}
+
+	if err := m.imageCache.CreateCacheEntry(imagePath, checksum); err != nil {
 		logrus.WithError(err).Warn("Failed to create cache entry")
 	}
 
@@ -394,24 +1710,150 @@ func (m *Manager) getOrDownloadImage(ctx context.Context, req types.ProvisionReq
 
 	job.CacheHit = false
 	job.ImagePath = imagePath
+	job.ImageChecksum = actual
 	return imagePath, nil
 }
 
-// getImageChecksum retrieves the SHA256 checksum from MinIO .sha256 file
-func (m *Manager) getImageChecksum(ctx context.Context, imageURL string) (string, error) {
-	// Parse the image URL to extract bucket and object
+// cachedImageCurrent revalidates an image cached by URL with a conditional request.
+// Images without a recorded version cannot be revalidated and are downloaded again;
+// if MinIO cannot be reached, the cached image is used.
+func (m *Manager) cachedImageCurrent(ctx context.Context, imageURL, imagePath string) bool {
+	validator, err := m.imageCache.Validator(imagePath)
+	if err != nil || validator == nil {
+		return false
+	}
+
+	bucketName, objectName, err := parseImageURL(imageURL)
+	if err != nil {
+		return false
+	}
+
+	modified, err := m.minioClient.ObjectModified(ctx, bucketName, objectName, validator.ETag, validator.LastModified)
+	if err != nil {
+		logrus.WithError(err).WithField("image_url", imageURL).Warn("Failed to revalidate cached image, using cached copy")
+		return true
+	}
+	if modified {
+		logrus.WithField("image_url", imageURL).Info("Image changed in MinIO, discarding cached copy")
+	}
+	return !modified
+}
+
+// downloadError classifies a failed download, reporting missing or forbidden
+// objects and unreachable MinIO separately from transfer failures
+func downloadError(err error) error {
+	if errors.Is(err, minio.ErrUnavailable) {
+		return types.NewError(types.ErrCodeSourceUnavailable, err, nil)
+	}
+
+	minioCode := minio.ErrorCode(err)
+	if minioCode == "" {
+		return types.NewError(types.ErrCodeDownloadFailed, err, nil)
+	}
+
+	code := types.ErrCodeDownloadFailed
+	switch minioCode {
+	case "NoSuchKey", "NoSuchBucket", "AccessDenied":
+		code = types.ErrCodeImageNotAccessible
+	}
+	return types.NewError(code, err, map[string]string{"minio_code": minioCode})
+}
+
+// commandDetails returns the failed command and its output from an LVM error
+func commandDetails(err error) map[string]string {
+	var cmdErr *lvm.CommandError
+	if !errors.As(err, &cmdErr) {
+		return nil
+	}
+	return map[string]string{"command": cmdErr.Command, "output": strings.TrimSpace(cmdErr.Output)}
+}
+
+// compressImage converts a verified download into a compressed qcow2 image next to
+// the path it is cached at, removing the download
+func (m *Manager) compressImage(ctx context.Context, job *Job, req types.ProvisionRequest, partialPath, cachePath string) error {
+	job.setStage("compressing", 45)
+	compressedPartial := cache.PartialPath(cachePath)
+
+	err := cache.CompressImage(ctx, partialPath, req.ImageType, compressedPartial, req.CacheCompression, m.compressionBudget)
+	_ = m.imageCache.DeleteImage(partialPath)
+	if err != nil {
+		_ = m.imageCache.DeleteImage(compressedPartial)
+		return types.NewError(types.ErrCodeCompressionFailed, err, nil)
+	}
+	return nil
+}
+
+// evictImage removes an image from the cache and publishes a cache eviction event.
+// Images backing overlays are kept, and used until the overlays are deleted.
+func (m *Manager) evictImage(job *Job, imagePath string) bool {
+	if err := m.checkImageNotPinned(imagePath); err != nil {
+		logrus.WithError(err).WithField("image_path", imagePath).Warn("Keeping outdated cached image")
+		return false
+	}
+	if err := m.imageCache.DeleteImage(imagePath); err != nil {
+		logrus.WithError(err).WithField("image_path", imagePath).Warn("Failed to remove cached image")
+		return false
+	}
+	m.emit(events.Event{Type: events.CacheEvicted, JobID: job.ID, ImagePath: imagePath})
+	return true
+}
+
+// InvalidateObject removes the cached copies of a MinIO object after it was overwritten
+// or deleted, and forgets its remembered failures. Changes to an image's .sha256 object
+// invalidate the image too. Images backing overlays are kept. It returns the number of
+// images evicted.
+func (m *Manager) InvalidateObject(bucket, object string) (int, error) {
+	object = strings.TrimSuffix(object, ".sha256")
+	m.failures.forgetObject(bucket, object)
+
+	entries, err := m.imageCache.Entries()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list cached images: %w", err)
+	}
+
+	// Cached images are named after the last element of the object name
+	imageName := cache.GetImageNameFromURL(object)
+	evicted := 0
+	for _, entry := range entries {
+		name := strings.TrimSuffix(filepath.Base(entry.Path), cache.CompressedSuffix)
+		if name != imageName {
+			continue
+		}
+		if err := m.checkImageNotPinned(entry.Path); err != nil {
+			logrus.WithError(err).WithField("image_path", entry.Path).Warn("Keeping invalidated cached image")
+			continue
+		}
+		if err := m.imageCache.DeleteImage(entry.Path); err != nil {
+			return evicted, fmt.Errorf("failed to evict %s: %w", entry.Path, err)
+		}
+		m.emit(events.Event{Type: events.CacheEvicted, ImagePath: entry.Path})
+		evicted++
+	}
+	return evicted, nil
+}
+
+// parseImageURL extracts the bucket and object name from an image URL
+func parseImageURL(imageURL string) (string, string, error) {
 	u, err := url.Parse(imageURL)
 	if err != nil {
-		return "", fmt.Errorf("invalid image URL: %w", err)
+		return "", "", fmt.Errorf("invalid image URL: %w", err)
 	}
 
 	pathParts := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
 	if len(pathParts) < 2 {
-		return "", fmt.Errorf("invalid image URL path: %s", u.Path)
+		return "", "", fmt.Errorf("invalid image URL path: %s", u.Path)
 	}
 
-	bucketName := pathParts[0]
-	imageObjectName := strings.Join(pathParts[1:], "/")
+	return pathParts[0], strings.Join(pathParts[1:], "/"), nil
+}
+
+// getImageChecksum retrieves the SHA256 checksum from MinIO .sha256 file
+func (m *Manager) getImageChecksum(ctx context.Context, imageURL string) (string, error) {
+	// Parse the image URL to extract bucket and object
+	bucketName, imageObjectName, err := parseImageURL(imageURL)
+	if err != nil {
+		return "", err
+	}
 	checksumObjectName := imageObjectName + ".sha256"
 
 	// Try to get the checksum file content
@@ -459,6 +1901,209 @@ func (m *Manager) GetJobCacheInfo(jobID string) (bool, string, error) {
 	return job.CacheHit, job.ImagePath, nil
 }
 
+// RefreshImage downloads an image into the cache unless the cache already holds
+// the version matching its current upstream checksum. It returns whether a new
+// version was downloaded and the cached image path.
+func (m *Manager) RefreshImage(ctx context.Context, imageURL, cachePool string) (bool, string, error) {
+	if m.maintenance.Load() {
+		return false, "", errMaintenance()
+	}
+	if err := m.checkReady(); err != nil {
+		return false, "", err
+	}
+	if m.imageCache == nil || !m.imageCache.HasPool(cachePool) {
+		return false, "", fmt.Errorf("unknown cache pool: %s", cachePool)
+	}
+
+	// Share the download concurrency limit with provisioning jobs
+	release, err := m.downloadSlots.acquire(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	defer release()
+
+	job := &Job{
+		ID:       "refresh",
+		Request:  types.ProvisionRequest{ImageURL: imageURL, CachePool: cachePool},
+		Progress: &types.ProgressInfo{Stage: "refreshing"},
+	}
+
+	imagePath, err := m.getOrDownloadImage(ctx, job.Request, job)
+	if err != nil {
+		return false, "", err
+	}
+	return !job.CacheHit, imagePath, nil
+}
+
+// ValidateImage checks that an image is accessible and readable by qemu-img,
+// without downloading it. Problems with the image are reported in the response
+// rather than returned as an error.
+func (m *Manager) ValidateImage(ctx context.Context, req types.ValidateImageRequest) (*types.ValidateImageResponse, error) {
+	resp := &types.ValidateImageResponse{ImageURL: req.ImageURL}
+
+	objInfo, err := m.minioClient.StatImage(ctx, req.ImageURL)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp, nil
+	}
+	resp.SizeBytes = objInfo.Size
+
+	info, err := m.minioClient.ProbeImage(ctx, req.ImageURL)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp, nil
+	}
+	resp.Format = info.Format
+	resp.VirtualSizeBytes = info.VirtualSize
+
+	resp.Error = checkImageInfo(req, info)
+	if resp.Error == "" {
+		resp.Metadata, err = m.imageMetadata(ctx, req.ImageURL)
+		if err == nil {
+			err = checkImageMetadata(types.ProvisionRequest{VolumeSizeGB: req.VolumeSizeGB}, resp.Metadata)
+		}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	resp.Valid = resp.Error == ""
+	return resp, nil
+}
+
+// checkImageInfo compares a probed image with the requested type and volume size,
+// returning a description of the first mismatch
+func checkImageInfo(req types.ValidateImageRequest, info *minio.ImageInfo) string {
+	if req.ImageType != "" && info.Format != req.ImageType {
+		return fmt.Sprintf("image format is %s, not %s", info.Format, req.ImageType)
+	}
+	if req.VolumeSizeGB > 0 && info.VirtualSize > int64(req.VolumeSizeGB)<<30 {
+		return fmt.Sprintf("image virtual size %d bytes exceeds the %d GB volume", info.VirtualSize, req.VolumeSizeGB)
+	}
+	return ""
+}
+
+// HealthChecks reports whether MinIO is reachable, as judged by its circuit breaker,
+// and the cache pool and database filesystems that are at least as full as the
+// degraded threshold
+func (m *Manager) HealthChecks() map[string]error {
+	checks := m.diskChecks(m.diskDegradedPercent, "degraded")
+	if m.minioClient != nil {
+		if checks == nil {
+			checks = make(map[string]error)
+		}
+		checks["minio"] = m.minioClient.Available()
+	}
+	return checks
+}
+
+// GetCapacity returns usage information for each configured image cache pool
+func (m *Manager) GetCapacity() ([]types.PoolCapacity, error) {
+	if m.imageCache == nil {
+		return []types.PoolCapacity{}, nil
+	}
+
+	pools, err := m.imageCache.Capacity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cache pool capacity: %w", err)
+	}
+
+	capacities := make([]types.PoolCapacity, 0, len(pools))
+	for _, pool := range pools {
+		capacities = append(capacities, types.PoolCapacity{
+			Name:           pool.Name,
+			Path:           pool.Path,
+			Default:        pool.Default,
+			UsedBytes:      pool.UsedBytes,
+			MaxBytes:       pool.MaxBytes,
+			AvailableBytes: pool.AvailableBytes,
+		})
+	}
+
+	return capacities, nil
+}
+
+// ListCachedImages returns the images held in every image cache pool
+func (m *Manager) ListCachedImages() ([]types.CachedImage, error) {
+	if m.imageCache == nil {
+		return []types.CachedImage{}, nil
+	}
+
+	entries, err := m.imageCache.Entries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cached images: %w", err)
+	}
+
+	images := make([]types.CachedImage, 0, len(entries))
+	for _, entry := range entries {
+		images = append(images, types.CachedImage{
+			Pool:      entry.Pool,
+			Path:      entry.Path,
+			SizeBytes: entry.Size,
+			Checksum:  entry.Checksum,
+		})
+	}
+	return images, nil
+}
+
+// ListVolumes returns the LVM volumes in the provisioner's volume group
+func (m *Manager) ListVolumes() ([]types.Volume, error) {
+	if m.lvmManager == nil {
+		return nil, types.NewError(types.ErrCodeNotSupported, fmt.Errorf("LVM is not configured"), nil)
+	}
+
+	infos, err := m.lvmManager.ListVolumeInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	volumes := make([]types.Volume, 0, len(infos))
+	for _, info := range infos {
+		volumes = append(volumes, types.Volume{
+			Name:        info.Name,
+			DevicePath:  m.lvmManager.DevicePath(info.Name),
+			SizeBytes:   info.SizeBytes,
+			Attributes:  info.Attributes,
+			Origin:      info.Origin,
+			Pool:        info.Pool,
+			DataPercent: info.DataPercent,
+		})
+	}
+	return volumes, nil
+}
+
+// ListImageVolumes returns the volumes built from the image with a checksum,
+// newest first. Deleted volumes are only included if includeDeleted is set.
+func (m *Manager) ListImageVolumes(checksum string, includeDeleted bool) ([]types.ProvisionedVolume, error) {
+	if m.store == nil {
+		return nil, types.NewError(types.ErrCodeNotSupported, fmt.Errorf("volume records are not available without a database"), nil)
+	}
+
+	records, err := m.store.ListVolumes(storage.ListVolumesFilter{
+		ImageChecksum:  checksum,
+		IncludeDeleted: includeDeleted,
+		Limit:          10000,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	volumes := make([]types.ProvisionedVolume, 0, len(records))
+	for _, record := range records {
+		volumes = append(volumes, types.ProvisionedVolume{
+			Name:          record.Name,
+			VolumeGroup:   record.VolumeGroup,
+			SizeGB:        record.SizeGB,
+			ImageURL:      record.ImageURL,
+			ImageChecksum: record.ImageChecksum,
+			JobID:         record.JobID,
+			Adopted:       record.JobID == "",
+			CreatedAt:     record.CreatedAt,
+			DeletedAt:     record.DeletedAt,
+		})
+	}
+	return volumes, nil
+}
+
 // CleanupCompletedJobs removes old completed jobs (keep last 100)
 func (m *Manager) CleanupCompletedJobs() {
 	m.mu.Lock()
@@ -1,10 +1,22 @@
 package jobs
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
-
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/minio"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/netbox"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/profiles"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
 	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestJobUpdateProgress tests the progress update functionality
@@ -81,8 +93,9 @@ func TestJobStatusInitialization(t *testing.T) {
 // TestGetJobCacheInfo tests getting cache info for completed jobs
 func TestGetJobCacheInfo(t *testing.T) {
 	manager := &Manager{
-		jobs:      make(map[string]*Job),
-		semaphore: make(chan struct{}, 2),
+		jobs:          make(map[string]*Job),
+		downloadSlots: newSemaphore(2),
+		diskSlots:     newSemaphore(2),
 	}
 
 	manager.jobs["completed-job"] = &Job{
@@ -99,11 +112,52 @@ func TestGetJobCacheInfo(t *testing.T) {
 	assert.Equal(t, "/var/lib/libvirt/images/ubuntu_image", imagePath)
 }
 
+// TestGetJobStatusCompleted tests that completed jobs report what is needed to attach the volume
+func TestGetJobStatusCompleted(t *testing.T) {
+	manager := &Manager{jobs: make(map[string]*Job)}
+	manager.jobs["image"] = &Job{
+		ID:              "image",
+		Status:          types.StatusCompleted,
+		Request:         types.ProvisionRequest{VolumeName: "web01-root", VolumeSizeGB: 20},
+		DevicePath:      "/dev/data/web01-root",
+		VolumeSizeBytes: 20 << 30,
+		ImageChecksum:   "abc123",
+	}
+	manager.jobs["blank"] = &Job{
+		ID:              "blank",
+		Status:          types.StatusCompleted,
+		Request:         types.ProvisionRequest{VolumeName: "data-1", VolumeSizeGB: 10, Type: types.VolumeTypeBlank},
+		DevicePath:      "/dev/data/data-1",
+		VolumeSizeBytes: 10 << 30,
+	}
+
+	status, err := manager.GetJobStatus("image")
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/data/web01-root", status.DevicePath)
+	assert.Equal(t, int64(20<<30), status.VolumeSizeBytes)
+	assert.Equal(t, "abc123", status.ImageChecksum)
+
+	status, err = manager.GetJobStatus("blank")
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/data/data-1", status.DevicePath)
+	assert.Equal(t, int64(10<<30), status.VolumeSizeBytes)
+	assert.Empty(t, status.ImageChecksum)
+	assert.Nil(t, status.CacheHit)
+
+	// Running jobs have no volume to attach yet
+	manager.jobs["image"].Status = types.StatusRunning
+	status, err = manager.GetJobStatus("image")
+	require.NoError(t, err)
+	assert.Empty(t, status.DevicePath)
+	assert.Empty(t, status.ImageChecksum)
+}
+
 // TestGetJobCacheInfoNotCompleted tests that getting cache info for non-completed job fails
 func TestGetJobCacheInfoNotCompleted(t *testing.T) {
 	manager := &Manager{
-		jobs:      make(map[string]*Job),
-		semaphore: make(chan struct{}, 2),
+		jobs:          make(map[string]*Job),
+		downloadSlots: newSemaphore(2),
+		diskSlots:     newSemaphore(2),
 	}
 
 	manager.jobs["running-job"] = &Job{
@@ -120,8 +174,9 @@ func TestGetJobCacheInfoNotCompleted(t *testing.T) {
 // TestGetJobCacheInfoNotFound tests that getting cache info for non-existent job fails
 func TestGetJobCacheInfoNotFound(t *testing.T) {
 	manager := &Manager{
-		jobs:      make(map[string]*Job),
-		semaphore: make(chan struct{}, 2),
+		jobs:          make(map[string]*Job),
+		downloadSlots: newSemaphore(2),
+		diskSlots:     newSemaphore(2),
 	}
 
 	_, _, err := manager.GetJobCacheInfo("nonexistent-job")
@@ -133,8 +188,9 @@ func TestGetJobCacheInfoNotFound(t *testing.T) {
 // TestCleanupCompletedJobs removes old completed jobs beyond limit
 func TestCleanupCompletedJobs(t *testing.T) {
 	manager := &Manager{
-		jobs:      make(map[string]*Job),
-		semaphore: make(chan struct{}, 2),
+		jobs:          make(map[string]*Job),
+		downloadSlots: newSemaphore(2),
+		diskSlots:     newSemaphore(2),
 	}
 
 	// Add 102 completed jobs (more than the 100 job limit)
@@ -166,8 +222,9 @@ func TestCleanupCompletedJobs(t *testing.T) {
 // TestGetActiveJobs returns correct count of active jobs
 func TestGetActiveJobs(t *testing.T) {
 	manager := &Manager{
-		jobs:      make(map[string]*Job),
-		semaphore: make(chan struct{}, 2),
+		jobs:          make(map[string]*Job),
+		downloadSlots: newSemaphore(2),
+		diskSlots:     newSemaphore(2),
 	}
 
 	// Add some jobs with different statuses
@@ -197,3 +254,643 @@ func TestGetActiveJobs(t *testing.T) {
 	// Should count running and pending jobs only
 	assert.Equal(t, 3, activeCount)
 }
+
+// fakeNetBoxClient records NetBox calls and rejects volumes larger than maxGB.
+// disksMB are the disk sizes it records, by disk name.
+type fakeNetBoxClient struct {
+	maxGB    int
+	disksMB  map[string]int
+	comments []string
+}
+
+func (f *fakeNetBoxClient) ValidateVolume(_ context.Context, vmID int, _ string, sizeMB int) (*netbox.Object, error) {
+	if sizeMB > f.maxGB*netbox.MegabytesPerGB {
+		return nil, fmt.Errorf("requested size %d MB exceeds NetBox", sizeMB)
+	}
+	return &netbox.Object{Type: "virtualization.virtualmachine", ID: vmID, Name: "web01"}, nil
+}
+
+func (f *fakeNetBoxClient) RecordedSize(_ context.Context, vmID int, diskName string) (*netbox.Object, int, error) {
+	sizeMB, ok := f.disksMB[diskName]
+	if !ok {
+		return nil, 0, fmt.Errorf("virtual machine web01 has no disk named %s in NetBox", diskName)
+	}
+	return &netbox.Object{Type: "virtualization.virtualmachine", ID: vmID, Name: "web01"}, sizeMB, nil
+}
+
+func (f *fakeNetBoxClient) RecordVolume(_ context.Context, _ *netbox.Object, comments string) error {
+	f.comments = append(f.comments, comments)
+	return nil
+}
+
+// TestStartJobNetBoxValidation tests that requests referencing NetBox are validated before starting
+func TestStartJobNetBoxValidation(t *testing.T) {
+	manager := &Manager{
+		jobs:          make(map[string]*Job),
+		downloadSlots: newSemaphore(2),
+		diskSlots:     newSemaphore(2),
+	}
+	req := types.ProvisionRequest{
+		ImageURL:     "https://minio/images/ubuntu.qcow2",
+		VolumeName:   "web01-root",
+		VolumeSizeGB: 50,
+		NetBoxVMID:   42,
+	}
+
+	_, err := manager.StartJob(req)
+	assert.ErrorContains(t, err, "not configured")
+
+	manager.SetNetBoxClient(&fakeNetBoxClient{maxGB: 40}, false)
+	_, err = manager.StartJob(req)
+	assert.ErrorContains(t, err, "NetBox validation failed")
+	assert.Empty(t, manager.jobs)
+}
+
+// TestStartJobBlankVolumes tests that blank volumes are validated without an image
+func TestStartJobBlankVolumes(t *testing.T) {
+	manager := &Manager{jobs: make(map[string]*Job)}
+
+	for _, req := range []types.ProvisionRequest{
+		{VolumeName: "data-1", VolumeSizeGB: 10, Type: "empty"},
+		{VolumeName: "data-1", VolumeSizeGB: 10, Type: types.VolumeTypeBlank, ImageURL: "https://minio/images/a.qcow2"},
+		{VolumeName: "data-1", VolumeSizeGB: 10, Type: types.VolumeTypeBlank, Overlay: true},
+	} {
+		_, err := manager.StartJob(req)
+		code, _ := types.ErrorCodeOf(err, "")
+		assert.Equal(t, types.ErrCodeInvalidRequest, code, req)
+	}
+	assert.Empty(t, manager.jobs)
+
+	stages := func(req types.ProvisionRequest) []string {
+		p := &provision{req: req}
+		var names []string
+		for _, s := range manager.provisioningSteps(req) {
+			if s.when == nil || s.when(p) {
+				names = append(names, s.name)
+			}
+		}
+		return names
+	}
+	assert.Equal(t, []string{"creating_volume", "finalizing"},
+		stages(types.ProvisionRequest{Type: types.VolumeTypeBlank}))
+	assert.Equal(t, []string{"creating_volume", "formatting", "finalizing"},
+		stages(types.ProvisionRequest{Type: types.VolumeTypeBlank, Filesystem: "xfs"}))
+	assert.Equal(t, []string{"creating_volume", "making_swap", "finalizing"},
+		stages(types.ProvisionRequest{Type: types.VolumeTypeSwap}))
+}
+
+// TestStartJobVolumeGroup tests that a job's volume group is known from its first
+// database record, before the job runs
+func TestStartJobVolumeGroup(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	manager := NewManager(&fakeImageStore{}, newFakeVolumeManager(), nil, store)
+	// The job is scheduled, so that it does not update its record before it is read
+	soon := time.Now().Add(100 * time.Millisecond)
+	jobID, err := manager.StartJob(types.ProvisionRequest{
+		VolumeName: "data-1", VolumeSizeGB: 10, Type: types.VolumeTypeBlank, NotBefore: &soon,
+	})
+	require.NoError(t, err)
+
+	record, err := store.GetJob(jobID)
+	require.NoError(t, err)
+	var effective types.EffectiveRequest
+	require.NoError(t, json.Unmarshal([]byte(record.EffectiveRequestJSON), &effective))
+	assert.Equal(t, "data", effective.VolumeGroup)
+	assert.Equal(t, types.StatusCompleted, waitForJob(t, manager, jobID).Status)
+}
+
+// TestStartJobProfiles tests that profiles are applied before requests are validated
+func TestStartJobProfiles(t *testing.T) {
+	manager := &Manager{
+		jobs:          make(map[string]*Job),
+		downloadSlots: newSemaphore(2),
+		diskSlots:     newSemaphore(2),
+	}
+	manager.SetProfiles(profiles.Profiles{
+		"web": {ImageURL: "https://minio/images/ubuntu.qcow2", VolumeSizeGB: 50},
+	})
+
+	_, err := manager.StartJob(types.ProvisionRequest{VolumeName: "web01-root", Profile: "missing"})
+	assert.ErrorContains(t, err, "unknown profile")
+
+	_, err = manager.StartJob(types.ProvisionRequest{VolumeName: "web01-root", VolumeSizeGB: 10})
+	assert.ErrorContains(t, err, "image_url is required")
+
+	// The profile's size is what NetBox validates
+	manager.SetNetBoxClient(&fakeNetBoxClient{maxGB: 40}, false)
+	_, err = manager.StartJob(types.ProvisionRequest{VolumeName: "web01-root", Profile: "web", NetBoxVMID: 42})
+	assert.ErrorContains(t, err, "requested size 50000 MB")
+	assert.Empty(t, manager.jobs)
+}
+
+// TestStartJobNotReady tests that jobs are rejected after a failed self-test
+func TestStartJobNotReady(t *testing.T) {
+	manager := &Manager{jobs: make(map[string]*Job)}
+	manager.SetSelfTestReport(&types.SelfTestReport{
+		Ready: false,
+		Checks: []types.SelfTestCheck{
+			{Name: "lvm", Critical: true, Passed: true},
+			{Name: "qemu-img", Critical: true, Passed: false},
+			{Name: "minio", Critical: false, Passed: false},
+		},
+	})
+
+	_, err := manager.StartJob(types.ProvisionRequest{VolumeName: "data-1", VolumeSizeGB: 10, Type: types.VolumeTypeBlank})
+	code, _ := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeNotReady, code)
+	assert.ErrorContains(t, err, "self-test: qemu-img")
+	assert.Empty(t, manager.jobs)
+
+	_, _, err = manager.RefreshImage(context.Background(), "https://minio/images/a.qcow2", "images")
+	code, _ = types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeNotReady, code)
+}
+
+// TestGetJobStatusNetBox tests that the NetBox object is reported in job status
+func TestGetJobStatusNetBox(t *testing.T) {
+	manager := &Manager{
+		jobs:          make(map[string]*Job),
+		downloadSlots: newSemaphore(2),
+		diskSlots:     newSemaphore(2),
+	}
+	manager.jobs["job"] = &Job{
+		ID:     "job",
+		Status: types.StatusRunning,
+		NetBox: &netbox.Object{Type: "virtualization.virtualmachine", ID: 42, Name: "web01", URL: "https://netbox/vm/42/"},
+	}
+
+	status, err := manager.GetJobStatus("job")
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, status.NetBox) {
+		assert.Equal(t, 42, status.NetBox.ID)
+		assert.Equal(t, "https://netbox/vm/42/", status.NetBox.URL)
+	}
+}
+
+// TestGetJobStatusEffectiveRequest tests that status reports the request as submitted and as carried out
+func TestGetJobStatusEffectiveRequest(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = store.Close() }()
+
+	manager := &Manager{jobs: make(map[string]*Job), store: store}
+	job := &Job{
+		ID:               "job",
+		Status:           types.StatusCompleted,
+		SubmittedRequest: types.ProvisionRequest{VolumeName: "web01-root", Profile: "web"},
+		Request: types.ProvisionRequest{VolumeName: "web01-root", Profile: "web",
+			ImageURL: "https://minio/images/ubuntu.qcow2", VolumeSizeGB: 50, CachePool: "images"},
+		VolumeGroup: "data",
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	manager.jobs["job"] = job
+
+	status, err := manager.GetJobStatus("job")
+	assert.NoError(t, err)
+	if assert.NotNil(t, status.Request) && assert.NotNil(t, status.EffectiveRequest) {
+		assert.Empty(t, status.Request.ImageURL)
+		assert.Equal(t, "https://minio/images/ubuntu.qcow2", status.EffectiveRequest.ImageURL)
+		assert.Equal(t, "images", status.EffectiveRequest.CachePool)
+		assert.Equal(t, "data", status.EffectiveRequest.VolumeGroup)
+		assert.Equal(t, int(jobTimeout.Seconds()), status.EffectiveRequest.TimeoutSeconds)
+	}
+
+	// Both are persisted, so they are reported once the job has left memory
+	manager.syncToDatabase(context.Background(), job)
+	delete(manager.jobs, "job")
+	page, err := manager.ListJobs(types.JobListRequest{})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Jobs, 1) && assert.NotNil(t, page.Jobs[0].EffectiveRequest) {
+		assert.Equal(t, "web", page.Jobs[0].Request.Profile)
+		assert.Equal(t, 50, page.Jobs[0].EffectiveRequest.VolumeSizeGB)
+	}
+}
+
+func TestGetJobStatusProvisionerVersion(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = store.Close() }()
+
+	manager := &Manager{jobs: make(map[string]*Job), store: store}
+	manager.SetVersion("0.3.0")
+	job := &Job{ID: "job", Status: types.StatusCompleted, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	manager.jobs["job"] = job
+
+	status, err := manager.GetJobStatus("job")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.3.0", status.ProvisionerVersion)
+
+	// The version that ran the job is kept after an upgrade
+	manager.syncToDatabase(context.Background(), job)
+	delete(manager.jobs, "job")
+	manager.SetVersion("0.4.0")
+	page, err := manager.ListJobs(types.JobListRequest{})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Jobs, 1) {
+		assert.Equal(t, "0.3.0", page.Jobs[0].ProvisionerVersion)
+	}
+}
+
+// TestRecordNetBoxVolume tests that provisioned volume details are written back to NetBox
+func TestRecordNetBoxVolume(t *testing.T) {
+	client := &fakeNetBoxClient{maxGB: 40}
+	manager := &Manager{jobs: make(map[string]*Job)}
+	manager.SetNetBoxClient(client, true)
+
+	job := &Job{
+		ID:      "job",
+		Request: types.ProvisionRequest{ImageURL: "https://minio/images/ubuntu.qcow2", VolumeName: "web01-root", VolumeSizeGB: 20},
+		NetBox:  &netbox.Object{Type: "virtualization.virtualmachine", ID: 42},
+	}
+	manager.recordNetBoxVolume(context.Background(), job)
+
+	if assert.Len(t, client.comments, 1) {
+		assert.Contains(t, client.comments[0], "web01-root (20 GB)")
+	}
+}
+
+// TestRecordVolume tests that created volumes are recorded with their source image
+func TestRecordVolume(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = store.Close() }()
+
+	manager := &Manager{jobs: make(map[string]*Job), store: store}
+	job := &Job{
+		ID:            "job",
+		Request:       types.ProvisionRequest{ImageURL: "https://minio/images/ubuntu.qcow2", VolumeName: "web01-root", VolumeSizeGB: 20},
+		VolumeGroup:   "data",
+		ImageChecksum: "abc123",
+	}
+	manager.recordVolume(context.Background(), job)
+
+	volumes, err := store.ListVolumes(storage.ListVolumesFilter{ImageChecksum: "abc123"})
+	assert.NoError(t, err)
+	if assert.Len(t, volumes, 1) {
+		assert.Equal(t, "web01-root", volumes[0].Name)
+		assert.Equal(t, "data", volumes[0].VolumeGroup)
+		assert.Equal(t, "job", volumes[0].JobID)
+	}
+
+	manager.recordVolumeDeleted(context.Background(), "data", "web01-root")
+	provisioned, err := manager.ListImageVolumes("abc123", false)
+	assert.NoError(t, err)
+	assert.Empty(t, provisioned)
+
+	provisioned, err = manager.ListImageVolumes("abc123", true)
+	assert.NoError(t, err)
+	if assert.Len(t, provisioned, 1) {
+		assert.Equal(t, 20, provisioned[0].SizeGB)
+		assert.NotNil(t, provisioned[0].DeletedAt)
+	}
+}
+
+// recordingEmitter records emitted lifecycle events
+type recordingEmitter struct {
+	events []events.Event
+}
+
+func (r *recordingEmitter) Emit(event events.Event) {
+	r.events = append(r.events, event)
+}
+
+// TestJobStageChangeEvents tests that stage changes are reported once per stage
+func TestJobStageChangeEvents(t *testing.T) {
+	emitter := &recordingEmitter{}
+	manager := &Manager{jobs: make(map[string]*Job)}
+	manager.SetEventEmitter(emitter)
+
+	job := &Job{ID: "job", Progress: &types.ProgressInfo{Stage: "initializing"}}
+	job.onStageChange = func(stage string) {
+		manager.emit(events.Event{Type: events.JobStageChanged, JobID: job.ID, Stage: stage})
+	}
+
+	job.setStage("checking_cache", 5)
+	job.UpdateProgress("downloading", 20, 100, 1000)
+	job.UpdateProgress("downloading", 30, 300, 1000)
+	job.setStage("converting", 75)
+
+	var stages []string
+	for _, event := range emitter.events {
+		assert.Equal(t, events.JobStageChanged, event.Type)
+		stages = append(stages, event.Stage)
+	}
+	assert.Equal(t, []string{"checking_cache", "downloading", "converting"}, stages)
+	assert.Equal(t, int64(300), job.Progress.BytesProcessed)
+}
+
+// TestCheckImageInfo tests that probed images are compared with the requested type and size
+func TestCheckImageInfo(t *testing.T) {
+	info := &minio.ImageInfo{Format: "qcow2", VirtualSize: 20 << 30}
+
+	assert.Empty(t, checkImageInfo(types.ValidateImageRequest{}, info))
+	assert.Empty(t, checkImageInfo(types.ValidateImageRequest{ImageType: "qcow2", VolumeSizeGB: 20}, info))
+	assert.Contains(t, checkImageInfo(types.ValidateImageRequest{ImageType: "raw"}, info), "not raw")
+	assert.Contains(t, checkImageInfo(types.ValidateImageRequest{VolumeSizeGB: 10}, info), "exceeds")
+}
+
+// TestErrorClassification tests that failures carry stable error codes and details
+func TestErrorClassification(t *testing.T) {
+	manager := &Manager{jobs: make(map[string]*Job)}
+
+	_, err := manager.GetJobStatus("missing")
+	code, _ := types.ErrorCodeOf(err, types.ErrCodeInternal)
+	assert.Equal(t, types.ErrCodeJobNotFound, code)
+
+	_, err = manager.StartJob(types.ProvisionRequest{VolumeName: "vm", VolumeSizeGB: 10})
+	code, details := types.ErrorCodeOf(err, types.ErrCodeInternal)
+	assert.Equal(t, types.ErrCodeInvalidRequest, code)
+	assert.Equal(t, "required", details["image_url"])
+
+	lvmErr := fmt.Errorf("failed to create LVM volume: %w",
+		&lvm.CommandError{Command: "lvcreate", Output: "  Insufficient free space\n", Err: errors.New("exit status 5")})
+	assert.Equal(t, map[string]string{"command": "lvcreate", "output": "Insufficient free space"}, commandDetails(lvmErr))
+	assert.Nil(t, commandDetails(errors.New("other")))
+
+	code, _ = types.ErrorCodeOf(downloadError(errors.New("connection reset")), types.ErrCodeInternal)
+	assert.Equal(t, types.ErrCodeDownloadFailed, code)
+
+	// Job status reports the code of the job's error
+	manager.jobs["job"] = &Job{
+		ID:     "job",
+		Status: types.StatusFailed,
+		Error:  types.NewError(types.ErrCodeVolumeCreateFailed, lvmErr, commandDetails(lvmErr)),
+	}
+	status, err := manager.GetJobStatus("job")
+	assert.NoError(t, err)
+	assert.Equal(t, types.ErrCodeVolumeCreateFailed, status.ErrorCode)
+	assert.Equal(t, "lvcreate", status.ErrorDetails["command"])
+	assert.Contains(t, status.Error, "Insufficient free space")
+}
+
+// TestStageTimings tests that each stage's start and duration are recorded
+func TestStageTimings(t *testing.T) {
+	manager := &Manager{jobs: make(map[string]*Job)}
+	job := &Job{
+		ID:       "job",
+		Request:  types.ProvisionRequest{CorrelationID: "order-42"},
+		Progress: &types.ProgressInfo{Stage: "initializing"},
+	}
+	manager.jobs["job"] = job
+
+	job.setStage("downloading", 10)
+	job.UpdateProgress("downloading", 20, 100, 1000)
+	job.setStage("converting", 75)
+
+	status, err := manager.GetJobStatus("job")
+	assert.NoError(t, err)
+	assert.Equal(t, "order-42", status.CorrelationID)
+	if assert.Len(t, status.StageTimings, 2) {
+		assert.Equal(t, "downloading", status.StageTimings[0].Stage)
+		assert.NotNil(t, status.StageTimings[0].FinishedAt)
+		assert.Nil(t, status.StageTimings[1].FinishedAt)
+	}
+
+	job.finishStage(time.Now())
+	assert.NotNil(t, job.StageTimings[1].FinishedAt)
+}
+
+// TestListJobs tests paging through the job history, with live status for jobs held in memory
+func TestListJobs(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = store.Close() }()
+
+	manager := &Manager{jobs: make(map[string]*Job), store: store}
+	for i := 0; i < 3; i++ {
+		job := &Job{
+			ID:        fmt.Sprintf("job-%d", i),
+			Status:    types.StatusCompleted,
+			Request:   types.ProvisionRequest{VolumeName: "vm", CorrelationID: fmt.Sprintf("order-%d", i)},
+			CreatedAt: time.Now().Add(time.Duration(i) * time.Minute),
+			UpdatedAt: time.Now(),
+		}
+		manager.syncToDatabase(context.Background(), job)
+	}
+	manager.jobs["job-2"] = &Job{ID: "job-2", Status: types.StatusRunning}
+
+	page, err := manager.ListJobs(types.JobListRequest{SortBy: "created_at", Limit: 2})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Jobs, 2) {
+		assert.Equal(t, types.StatusRunning, page.Jobs[0].Status)
+		assert.Equal(t, "order-1", page.Jobs[1].CorrelationID)
+	}
+	assert.NotEmpty(t, page.NextCursor)
+
+	page, err = manager.ListJobs(types.JobListRequest{SortBy: "created_at", Limit: 2, Cursor: page.NextCursor})
+	assert.NoError(t, err)
+	assert.Len(t, page.Jobs, 1)
+	assert.Empty(t, page.NextCursor)
+
+	_, err = manager.ListJobs(types.JobListRequest{Cursor: "!"})
+	code, _ := types.ErrorCodeOf(err, types.ErrCodeInternal)
+	assert.Equal(t, types.ErrCodeInvalidRequest, code)
+}
+
+// TestSemaphore tests that resource slots limit concurrency, honour cancellation and can be resized
+func TestSemaphore(t *testing.T) {
+	slots := newSemaphore(1)
+
+	release, err := slots.acquire(context.Background())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = slots.acquire(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Raising the limit hands out a slot to a waiting job
+	acquired := make(chan func())
+	go func() {
+		r, _ := slots.acquire(context.Background())
+		acquired <- r
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("slot acquired beyond the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	slots.setLimit(2)
+	second := <-acquired
+
+	// Lowering it keeps the held slots, and waits until fewer than the limit are held
+	slots.setLimit(1)
+	limit, held := slots.usage()
+	assert.Equal(t, 1, limit)
+	assert.Equal(t, 2, held)
+	release()
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = slots.acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	second()
+	release, err = slots.acquire(context.Background())
+	assert.NoError(t, err)
+	release()
+}
+
+// TestPauseResumeJob tests that paused jobs report their status and block at checkpoints until resumed
+func TestPauseResumeJob(t *testing.T) {
+	manager := &Manager{jobs: make(map[string]*Job)}
+	job := &Job{ID: "job-1", Status: types.StatusRunning}
+	manager.jobs[job.ID] = job
+	manager.jobs["done"] = &Job{ID: "done", Status: types.StatusCompleted}
+
+	assert.NoError(t, manager.PauseJob("job-1"))
+	code, _ := types.ErrorCodeOf(manager.PauseJob("job-1"), "")
+	assert.Equal(t, types.ErrCodeJobNotPausable, code)
+	code, _ = types.ErrorCodeOf(manager.PauseJob("done"), "")
+	assert.Equal(t, types.ErrCodeJobNotPausable, code)
+
+	status, err := manager.GetJobStatus("job-1")
+	assert.NoError(t, err)
+	assert.Equal(t, types.StatusPaused, status.Status)
+	assert.Equal(t, 1, manager.GetActiveJobs())
+
+	// A paused job waits at its next checkpoint until resumed
+	resumed := make(chan error)
+	go func() { resumed <- job.WaitWhilePaused(context.Background()) }()
+	select {
+	case <-resumed:
+		t.Fatal("paused job continued")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	assert.NoError(t, manager.ResumeJob("job-1"))
+	assert.NoError(t, <-resumed)
+	assert.Equal(t, types.StatusRunning, job.status())
+
+	code, _ = types.ErrorCodeOf(manager.ResumeJob("job-1"), "")
+	assert.Equal(t, types.ErrCodeJobNotPaused, code)
+
+	// Cancelling a paused job releases it
+	assert.NoError(t, manager.PauseJob("job-1"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, job.WaitWhilePaused(ctx), context.Canceled)
+}
+
+// TestCancelJobs tests that bulk cancellation cancels the unfinished jobs matching every filter
+func TestCancelJobs(t *testing.T) {
+	manager := &Manager{jobs: make(map[string]*Job)}
+	newJob := func(id, correlationID string, status types.JobStatus, age time.Duration) *Job {
+		_, cancel := context.WithCancel(context.Background())
+		job := &Job{ID: id, Status: status, CreatedAt: time.Now().Add(-age), cancelFunc: cancel,
+			Request: types.ProvisionRequest{CorrelationID: correlationID, VolumeName: id + "-root"}}
+		manager.jobs[id] = job
+		return job
+	}
+	newJob("rollout-1", "rollout-42-web01", types.StatusRunning, time.Hour)
+	newJob("rollout-2", "rollout-42-web02", types.StatusPending, time.Minute)
+	newJob("rollout-3", "rollout-42-web03", types.StatusRunning, time.Hour).pause()
+	newJob("rollout-4", "rollout-42-web04", types.StatusCompleted, time.Hour)
+	newJob("other", "", types.StatusRunning, time.Hour)
+
+	_, err := manager.CancelJobs(types.BulkCancelRequest{})
+	code, _ := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeInvalidRequest, code)
+	_, err = manager.CancelJobs(types.BulkCancelRequest{OlderThan: "yesterday"})
+	code, _ = types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeInvalidRequest, code)
+
+	response, err := manager.CancelJobs(types.BulkCancelRequest{CorrelationIDPrefix: "rollout-42", OlderThan: "30m"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rollout-1", "rollout-3"}, response.Cancelled)
+	assert.Empty(t, response.Failed)
+	assert.Equal(t, types.StatusFailed, manager.jobs["rollout-3"].Status)
+
+	// Jobs without a correlation ID match by their ID, which is their correlation ID
+	response, err = manager.CancelJobs(types.BulkCancelRequest{Status: "running", CorrelationIDPrefix: "oth"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other"}, response.Cancelled)
+
+	// Tenants' bulk cancellations are confined to their volumes
+	response, err = manager.CancelJobs(types.BulkCancelRequest{VolumeNamePrefix: "rollout-9"})
+	require.NoError(t, err)
+	assert.Empty(t, response.Cancelled)
+	response, err = manager.CancelJobs(types.BulkCancelRequest{VolumeNamePrefix: "rollout-2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rollout-2"}, response.Cancelled)
+
+	response, err = manager.CancelJobs(types.BulkCancelRequest{All: true})
+	require.NoError(t, err)
+	assert.Empty(t, response.Cancelled)
+	assert.Equal(t, types.StatusCompleted, manager.jobs["rollout-4"].Status)
+}
+
+// TestJobTimeoutExcludesPausedTime tests that time spent paused does not count towards the job timeout
+func TestJobTimeoutExcludesPausedTime(t *testing.T) {
+	job := &Job{ID: "job-1"}
+	ctx, cancel := job.withTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	job.pause()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, ctx.Err())
+
+	job.resume()
+	<-ctx.Done()
+	assert.ErrorIs(t, context.Cause(ctx), context.DeadlineExceeded)
+}
+
+// panickingEmitter panics when a job starts, standing in for a bug in a provisioning step
+type panickingEmitter struct {
+	recordingEmitter
+}
+
+func (p *panickingEmitter) Emit(event events.Event) {
+	if event.Type == events.JobStarted {
+		panic("step exploded")
+	}
+	p.recordingEmitter.Emit(event)
+}
+
+// TestRunJobPanic tests that a panicking job is failed and persisted with its stack trace
+func TestRunJobPanic(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = store.Close() }()
+
+	emitter := &panickingEmitter{}
+	manager := &Manager{jobs: make(map[string]*Job), store: store}
+	manager.SetEventEmitter(emitter)
+	job := &Job{
+		ID:      "job",
+		Status:  types.StatusPending,
+		Request: types.ProvisionRequest{Type: types.VolumeTypeBlank, VolumeName: "data", VolumeSizeGB: 1},
+	}
+	manager.jobs[job.ID] = job
+
+	assert.NotPanics(t, func() { manager.runJob(context.Background(), job) })
+
+	assert.Equal(t, types.StatusFailed, job.Status)
+	code, details := types.ErrorCodeOf(job.Error, "")
+	assert.Equal(t, types.ErrCodeInternal, code)
+	assert.Equal(t, "step exploded", details["panic"])
+
+	record, err := store.GetJob(job.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(types.StatusFailed), record.Status)
+		assert.Contains(t, record.ErrorMessage, "job panicked: step exploded")
+		assert.Contains(t, record.ErrorMessage, "jobs.(*Manager).runJob")
+	}
+	if assert.Len(t, emitter.events, 1) {
+		assert.Equal(t, events.JobFailed, emitter.events[0].Type)
+	}
+}
@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// jobManifestTimeout bounds writing a job manifest to MinIO
+const jobManifestTimeout = 30 * time.Second
+
+var jobManifestsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "libvirt_volume_provisioner_job_manifests_total",
+		Help: "Total number of job manifests written to MinIO, by result",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(jobManifestsTotal)
+}
+
+// SetJobManifests enables writing a manifest of each completed job to MinIO, as
+// <baseURL>/<host>/<job_id>.json. baseURL names a bucket and optional prefix, such
+// as https://minio.example.com/reports/provisioner.
+func (m *Manager) SetJobManifests(writer ManifestWriter, baseURL, host string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid job manifest URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || strings.Trim(u.Path, "/") == "" {
+		return fmt.Errorf("invalid job manifest URL %s: expected https://host/bucket[/prefix]", baseURL)
+	}
+	if host == "" || strings.Contains(host, "/") {
+		return fmt.Errorf("invalid job manifest host: %q", host)
+	}
+	m.manifests = writer
+	m.manifestURL = strings.TrimSuffix(baseURL, "/")
+	m.manifestHost = host
+	return nil
+}
+
+// writeJobManifest writes the manifest of a completed job to MinIO. Failures are
+// logged, as the volume itself is usable.
+func (m *Manager) writeJobManifest(job *Job) {
+	if m.manifests == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), jobManifestTimeout)
+	defer cancel()
+
+	status, err := m.GetJobStatus(job.ID)
+	if err == nil {
+		manifest := types.JobManifest{Host: m.manifestHost, Job: status, WrittenAt: time.Now().UTC()}
+		var data []byte
+		if data, err = json.Marshal(manifest); err == nil {
+			err = m.manifests.PutURLContent(ctx, m.manifestObjectURL(job.ID), data, "application/json")
+		}
+	}
+	if err != nil {
+		jobManifestsTotal.WithLabelValues("failed").Inc()
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"job_id":      job.ID,
+			"volume_name": job.Request.VolumeName,
+		}).Warn("Failed to write job manifest")
+		return
+	}
+	jobManifestsTotal.WithLabelValues("written").Inc()
+}
+
+// manifestObjectURL returns the URL of a job's manifest
+func (m *Manager) manifestObjectURL(jobID string) string {
+	return m.manifestURL + "/" + m.manifestHost + "/" + jobID + ".json"
+}
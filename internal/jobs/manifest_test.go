@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeManifestWriter records the objects written to it, announcing each write on puts
+type fakeManifestWriter struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	err     error
+	// block, if set, holds writes up until it is closed
+	block chan struct{}
+	puts  chan error
+}
+
+func newFakeManifestWriter() *fakeManifestWriter {
+	return &fakeManifestWriter{objects: make(map[string][]byte), puts: make(chan error, 10)}
+}
+
+func (f *fakeManifestWriter) PutURLContent(ctx context.Context, objectURL string, content []byte, _ string) error {
+	f.mu.Lock()
+	block, err := f.block, f.err
+	f.mu.Unlock()
+	if _, ok := ctx.Deadline(); !ok {
+		err = errors.New("no deadline")
+	}
+	if block != nil {
+		<-block
+	}
+	if err == nil {
+		f.mu.Lock()
+		f.objects[objectURL] = content
+		f.mu.Unlock()
+	}
+	f.puts <- err
+	return err
+}
+
+// awaitPut waits for the next write, returning its error
+func (f *fakeManifestWriter) awaitPut(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-f.puts:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("no manifest written")
+		return nil
+	}
+}
+
+func TestSetJobManifests(t *testing.T) {
+	manager := &Manager{}
+	writer := newFakeManifestWriter()
+	assert.NoError(t, manager.SetJobManifests(writer, "https://minio/reports/provisioner/", "hv01"))
+	assert.Equal(t, "https://minio/reports/provisioner/hv01/job.json", manager.manifestObjectURL("job"))
+	assert.NoError(t, manager.SetJobManifests(writer, "https://minio/reports", "hv01"))
+
+	for _, invalid := range []string{"", "minio/reports", "https://minio", "https://minio/", "s3://minio/reports"} {
+		assert.Error(t, manager.SetJobManifests(writer, invalid, "hv01"), invalid)
+	}
+	assert.Error(t, manager.SetJobManifests(writer, "https://minio/reports", ""))
+	assert.Error(t, manager.SetJobManifests(writer, "https://minio/reports", "hv/01"))
+}
+
+func TestJobManifests(t *testing.T) {
+	writer := newFakeManifestWriter()
+	manager := NewManager(&fakeImageStore{}, newFakeVolumeManager(), nil, nil)
+	require.NoError(t, manager.SetJobManifests(writer, "https://minio/reports", "hv01"))
+	written := testutil.ToFloat64(jobManifestsTotal.WithLabelValues("written"))
+
+	jobID, err := manager.StartJob(types.ProvisionRequest{
+		VolumeName:   "data-1",
+		VolumeSizeGB: 1,
+		Type:         types.VolumeTypeBlank,
+		Labels:       map[string]string{"ticket": "OPS-1234"},
+	})
+	require.NoError(t, err)
+	job := waitForJob(t, manager, jobID)
+	require.NoError(t, writer.awaitPut(t))
+
+	writer.mu.Lock()
+	data := writer.objects["https://minio/reports/hv01/"+jobID+".json"]
+	writer.mu.Unlock()
+	require.NotNil(t, data)
+	var manifest types.JobManifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	assert.Equal(t, "hv01", manifest.Host)
+	require.NotNil(t, manifest.Job)
+	assert.Equal(t, jobID, manifest.Job.JobID)
+	assert.Equal(t, types.StatusCompleted, manifest.Job.Status)
+	assert.Equal(t, "OPS-1234", manifest.Job.Labels["ticket"])
+	assert.True(t, job.UpdatedAt.Equal(manifest.Job.UpdatedAt), "the job's final update time")
+	assert.False(t, manifest.WrittenAt.IsZero())
+	assert.InDelta(t, written+1, testutil.ToFloat64(jobManifestsTotal.WithLabelValues("written")), 0)
+
+	// A failed write does not fail the job
+	writer.mu.Lock()
+	writer.err = errors.New("bucket not found")
+	writer.mu.Unlock()
+	failed := testutil.ToFloat64(jobManifestsTotal.WithLabelValues("failed"))
+	jobID, err = manager.StartJob(types.ProvisionRequest{VolumeName: "data-2", VolumeSizeGB: 1, Type: types.VolumeTypeBlank})
+	require.NoError(t, err)
+	job = waitForJob(t, manager, jobID)
+	assert.Equal(t, types.StatusCompleted, job.Status)
+	require.Error(t, writer.awaitPut(t))
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(jobManifestsTotal.WithLabelValues("failed")) == failed+1
+	}, time.Second, 10*time.Millisecond)
+
+	// A hanging MinIO holds up neither the job nor its record
+	writer.mu.Lock()
+	writer.err = nil
+	writer.block = make(chan struct{})
+	writer.mu.Unlock()
+	jobID, err = manager.StartJob(types.ProvisionRequest{VolumeName: "data-3", VolumeSizeGB: 1, Type: types.VolumeTypeBlank})
+	require.NoError(t, err)
+	job = waitForJob(t, manager, jobID)
+	assert.Equal(t, types.StatusCompleted, job.Status)
+	close(writer.block)
+	require.NoError(t, writer.awaitPut(t))
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// osFamilyWindows is the os_family of Windows images in image metadata
+const osFamilyWindows = "windows"
+
+// imageMetadata returns the metadata in an image's .meta.json file in MinIO, or nil
+// if the image has none
+func (m *Manager) imageMetadata(ctx context.Context, imageURL string) (*types.ImageMetadata, error) {
+	if m.minioClient == nil {
+		return nil, nil
+	}
+	bucketName, objectName, err := parseImageURL(imageURL)
+	if err != nil {
+		return nil, err
+	}
+	data, err := m.minioClient.GetObjectContent(ctx, bucketName, objectName+".meta.json")
+	if err != nil {
+		return nil, nil //nolint:nilerr // Images need not have metadata
+	}
+	return parseImageMetadata(data)
+}
+
+// parseImageMetadata decodes and checks the contents of a .meta.json file
+func parseImageMetadata(data []byte) (*types.ImageMetadata, error) {
+	var metadata types.ImageMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid image metadata: %w", err)
+	}
+	if metadata.MinDiskGB < 0 {
+		return nil, fmt.Errorf("invalid image metadata: min_disk_gb must not be negative")
+	}
+	if metadata.Architecture != "" {
+		metadata.Architecture = normalizeArchitecture(metadata.Architecture)
+		if !slices.Contains(architectures, metadata.Architecture) {
+			return nil, fmt.Errorf("invalid image metadata: unknown architecture %s", metadata.Architecture)
+		}
+	}
+	return &metadata, nil
+}
+
+// checkImageMetadata fails a request the image's metadata says it cannot be
+// provisioned with, such as a volume smaller than the image's minimum disk size
+func checkImageMetadata(req types.ProvisionRequest, metadata *types.ImageMetadata) error {
+	if metadata == nil {
+		return nil
+	}
+	if size := req.SizeBytes(); size > 0 && size < int64(metadata.MinDiskGB)<<30 {
+		return types.NewError(types.ErrCodeImageRequirements,
+			fmt.Errorf("volume of %d bytes is smaller than the image's minimum disk size of %d GB", size, metadata.MinDiskGB),
+			map[string]string{"min_disk_gb": fmt.Sprint(metadata.MinDiskGB)})
+	}
+	if req.Windows != nil && metadata.OSFamily != "" && metadata.OSFamily != osFamilyWindows {
+		return types.NewError(types.ErrCodeImageRequirements,
+			fmt.Errorf("windows options do not apply to a %s image", metadata.OSFamily),
+			map[string]string{"os_family": metadata.OSFamily})
+	}
+	return nil
+}
+
+// fetchImageMetadata reads the metadata of a job's image and checks the request and
+// the image's expiry against it, before the image is downloaded. Unreadable metadata
+// is only logged.
+func (m *Manager) fetchImageMetadata(ctx context.Context, p *provision) error {
+	metadata, err := m.imageMetadata(ctx, p.req.ImageURL)
+	if err != nil {
+		logrus.WithError(err).WithField("job_id", p.job.ID).Warn("Ignoring image metadata")
+	}
+	p.job.ImageMetadata = metadata
+	if err := m.checkImageExpiry(p); err != nil {
+		return err
+	}
+	return checkImageMetadata(p.req, metadata)
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageMetadata(t *testing.T) {
+	metadata, err := parseImageMetadata([]byte(`{"os_family":"linux","min_disk_gb":20,` +
+		`"default_login":"ubuntu","architecture":"arm64","expires":"2027-04-30T00:00:00Z"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "linux", metadata.OSFamily)
+	assert.Equal(t, 20, metadata.MinDiskGB)
+	assert.Equal(t, "ubuntu", metadata.DefaultLogin)
+	assert.Equal(t, "aarch64", metadata.Architecture)
+	require.NotNil(t, metadata.Expires)
+	assert.Equal(t, 2027, metadata.Expires.Year())
+
+	for _, data := range []string{`not json`, `{"min_disk_gb":-1}`, `{"architecture":"sparc"}`} {
+		_, err := parseImageMetadata([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestCheckImageMetadata(t *testing.T) {
+	metadata := &types.ImageMetadata{OSFamily: "linux", MinDiskGB: 20}
+
+	assert.NoError(t, checkImageMetadata(types.ProvisionRequest{VolumeSizeGB: 20}, metadata))
+	assert.NoError(t, checkImageMetadata(types.ProvisionRequest{VolumeSizeGB: 10}, nil))
+
+	err := checkImageMetadata(types.ProvisionRequest{VolumeSizeGB: 10}, metadata)
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeImageRequirements, code)
+	assert.Equal(t, "20", details["min_disk_gb"])
+
+	err = checkImageMetadata(types.ProvisionRequest{VolumeSizeGB: 20, Windows: &types.WindowsOptions{}}, metadata)
+	code, details = types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeImageRequirements, code)
+	assert.Equal(t, "linux", details["os_family"])
+}
@@ -0,0 +1,337 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	miniogo "github.com/minio/minio-go/v7"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/minio"
+)
+
+// errNoSuchObject is returned by fakeImageStore for objects it does not hold
+var errNoSuchObject = errors.New("no such object")
+
+// fakeImageStore serves objects from memory, keyed by bucket/object
+type fakeImageStore struct {
+	objects map[string][]byte
+	// downloadErr, if set, fails every download
+	downloadErr error
+	downloads   int
+}
+
+func (f *fakeImageStore) object(bucketName, objectName string) ([]byte, error) {
+	data, ok := f.objects[path.Join(bucketName, objectName)]
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: %w", bucketName, objectName, errNoSuchObject)
+	}
+	return data, nil
+}
+
+func (f *fakeImageStore) Available() error {
+	return nil
+}
+
+func (f *fakeImageStore) StatImage(ctx context.Context, imageURL string) (miniogo.ObjectInfo, error) {
+	bucketName, objectName, err := parseImageURL(imageURL)
+	if err != nil {
+		return miniogo.ObjectInfo{}, err
+	}
+	return f.StatObject(ctx, bucketName, objectName)
+}
+
+func (f *fakeImageStore) StatObject(_ context.Context, bucketName, objectName string) (miniogo.ObjectInfo, error) {
+	data, err := f.object(bucketName, objectName)
+	if err != nil {
+		return miniogo.ObjectInfo{}, err
+	}
+	return miniogo.ObjectInfo{Key: objectName, Size: int64(len(data)), ETag: fmt.Sprintf("%x", sha256.Sum256(data))}, nil
+}
+
+func (f *fakeImageStore) ObjectModified(context.Context, string, string, string, time.Time) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeImageStore) GetObjectContent(_ context.Context, bucketName, objectName string) ([]byte, error) {
+	return f.object(bucketName, objectName)
+}
+
+func (f *fakeImageStore) ProbeImage(_ context.Context, imageURL string) (*minio.ImageInfo, error) {
+	bucketName, objectName, err := parseImageURL(imageURL)
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.object(bucketName, objectName)
+	if err != nil {
+		return nil, err
+	}
+	return &minio.ImageInfo{Format: "raw", VirtualSize: int64(len(data))}, nil
+}
+
+func (f *fakeImageStore) DownloadImageToPath(_ context.Context, imageURL, destPath string,
+	_ minio.ProgressUpdater) (string, error) {
+	f.downloads++
+	if f.downloadErr != nil {
+		return "", f.downloadErr
+	}
+	bucketName, objectName, err := parseImageURL(imageURL)
+	if err != nil {
+		return "", err
+	}
+	data, err := f.object(bucketName, objectName)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(destPath, data, 0o600); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// fakeVolumeManager keeps volumes in memory, recording the operations made on them
+// in order so tests can check the order of provisioning and rollback
+type fakeVolumeManager struct {
+	mu         sync.Mutex
+	volumes    map[string]int64
+	incomplete map[string]bool
+	// failures fails the named operations with the given errors
+	failures map[string]error
+	// written is the checksum PopulateVolume reports for the data it wrote, and
+	// HashVolume for the data it reads back
+	written string
+	calls   []string
+	// multipath makes jobs check the multipath paths before creating volumes
+	multipath bool
+	// format is the backend's volume format, raw if unset
+	format string
+	// panics names an operation that panics, standing in for a bug
+	panics string
+	// check is what CheckVolume finds in a qcow2 volume
+	check lvm.CheckResult
+}
+
+func newFakeVolumeManager(volumes ...string) *fakeVolumeManager {
+	f := &fakeVolumeManager{
+		volumes:    make(map[string]int64),
+		incomplete: make(map[string]bool),
+		failures:   make(map[string]error),
+	}
+	for _, name := range volumes {
+		f.volumes[name] = 1 << 30
+	}
+	return f
+}
+
+// call records an operation, returning the error it is set to fail with
+func (f *fakeVolumeManager) call(operation, volumeName string) error {
+	f.calls = append(f.calls, operation+" "+volumeName)
+	if operation == f.panics {
+		panic(operation + " exploded")
+	}
+	return f.failures[operation]
+}
+
+// Calls returns the operations made so far
+func (f *fakeVolumeManager) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *fakeVolumeManager) VolumeGroup() string {
+	return "data"
+}
+
+func (f *fakeVolumeManager) VolumeGroupStatus(context.Context) (*lvm.VolumeGroupStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var used int64
+	for _, size := range f.volumes {
+		used += size
+	}
+	return &lvm.VolumeGroupStatus{Name: "data", SizeBytes: 100 << 30, FreeBytes: 100<<30 - used,
+		PhysicalVolumes: 1, LogicalVolumes: len(f.volumes), Attributes: "wz--n-"}, nil
+}
+
+func (f *fakeVolumeManager) VolumeExists(volumeName string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.volumes[volumeName]
+	return ok
+}
+
+func (f *fakeVolumeManager) DevicePath(volumeName string) string {
+	return "/dev/data/" + volumeName
+}
+
+func (f *fakeVolumeManager) CheckQuota(context.Context, int64) error {
+	return nil
+}
+
+func (f *fakeVolumeManager) CheckAlignment() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.call("CheckAlignment", "")
+}
+
+func (f *fakeVolumeManager) MultipathChecked() bool {
+	return f.multipath
+}
+
+func (f *fakeVolumeManager) CheckPaths(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.call("CheckPaths", "")
+}
+
+func (f *fakeVolumeManager) CreateVolume(_ context.Context, volumeName string, sizeBytes int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CreateVolume", volumeName); err != nil {
+		return err
+	}
+	f.volumes[volumeName] = max(f.volumes[volumeName], sizeBytes)
+	f.incomplete[volumeName] = true
+	return nil
+}
+
+func (f *fakeVolumeManager) VolumeFormat() string {
+	if f.format == "" {
+		return lvm.FormatRaw
+	}
+	return f.format
+}
+
+func (f *fakeVolumeManager) PopulateVolume(_ context.Context, _, volumeName, _, _ string,
+	_ lvm.ProgressUpdater) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.written, f.call("PopulateVolume", volumeName)
+}
+
+func (f *fakeVolumeManager) PopulateVolumeExpanding(_ context.Context, _, volumeName, _, _ string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.call("PopulateVolumeExpanding", volumeName)
+}
+
+func (f *fakeVolumeManager) HashVolume(_ context.Context, volumeName string, length int64,
+	updater lvm.ProgressUpdater) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("HashVolume", volumeName); err != nil {
+		return "", err
+	}
+	if updater != nil {
+		updater.UpdateProgress("verifying", 95, length, length)
+	}
+	return f.written, nil
+}
+
+func (f *fakeVolumeManager) CheckVolume(_ context.Context, volumeName string) (*lvm.CheckResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CheckVolume", volumeName); err != nil {
+		return nil, err
+	}
+	result := f.check
+	return &result, nil
+}
+
+func (f *fakeVolumeManager) FormatVolume(volumeName, _ string, _ []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.call("FormatVolume", volumeName)
+}
+
+func (f *fakeVolumeManager) MakeSwap(volumeName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.call("MakeSwap", volumeName)
+}
+
+func (f *fakeVolumeManager) CreateSnapshot(volumeName string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CreateSnapshot", volumeName); err != nil {
+		return "", err
+	}
+	snapshot := volumeName + "-snap"
+	f.volumes[snapshot] = f.volumes[volumeName]
+	return snapshot, nil
+}
+
+func (f *fakeVolumeManager) MergeSnapshot(snapshotName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("MergeSnapshot", snapshotName); err != nil {
+		return err
+	}
+	delete(f.volumes, snapshotName)
+	return nil
+}
+
+func (f *fakeVolumeManager) MarkComplete(volumeName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("MarkComplete", volumeName); err != nil {
+		return err
+	}
+	delete(f.incomplete, volumeName)
+	return nil
+}
+
+func (f *fakeVolumeManager) IncompleteVolumes() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(f.incomplete))
+	for name := range f.incomplete {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (f *fakeVolumeManager) SetResultTag(volumeName string, _ []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.call("SetResultTag", volumeName)
+}
+
+func (f *fakeVolumeManager) GetVolumeInfo(volumeName string) (*lvm.VolumeInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	size, ok := f.volumes[volumeName]
+	if !ok {
+		return nil, fmt.Errorf("volume %s not found", volumeName)
+	}
+	return &lvm.VolumeInfo{Name: volumeName, SizeBytes: size}, nil
+}
+
+func (f *fakeVolumeManager) ListVolumeInfo() ([]lvm.VolumeInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	volumes := make([]lvm.VolumeInfo, 0, len(f.volumes))
+	for name, size := range f.volumes {
+		volumes = append(volumes, lvm.VolumeInfo{Name: name, SizeBytes: size})
+	}
+	return volumes, nil
+}
+
+func (f *fakeVolumeManager) DeleteVolume(volumeName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DeleteVolume", volumeName); err != nil {
+		return err
+	}
+	delete(f.volumes, volumeName)
+	delete(f.incomplete, volumeName)
+	return nil
+}
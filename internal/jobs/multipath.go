@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// checksPaths reports whether the multipath devices under the volume group are checked
+// before a job creates its volume
+func (m *Manager) checksPaths(_ *provision) bool {
+	return m.lvmManager != nil && m.lvmManager.MultipathChecked()
+}
+
+// checkPathsStep fails a job before it writes to a volume group on multipath devices
+// that have lost paths, rather than letting a write hang until the job times out
+func (m *Manager) checkPathsStep(ctx context.Context, _ *provision) error {
+	err := m.lvmManager.CheckPaths(ctx)
+	var multipath *lvm.MultipathError
+	if errors.As(err, &multipath) {
+		return types.NewError(types.ErrCodeMultipathDegraded, err, map[string]string{
+			"device":       multipath.Device.Name,
+			"active_paths": strconv.Itoa(multipath.Device.ActivePaths),
+			"total_paths":  strconv.Itoa(multipath.Device.TotalPaths),
+		})
+	}
+	if err != nil {
+		// A check that fails or times out suggests the storage is not answering either
+		return types.NewError(types.ErrCodeMultipathDegraded, err, commandDetails(err))
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvisionVolumeChecksPaths(t *testing.T) {
+	volumes := newFakeVolumeManager()
+	volumes.multipath = true
+	manager, _ := newProvisionTestManager(t, volumes)
+
+	req := types.ProvisionRequest{VolumeName: "web01-root", ImageURL: testImageURL, ImageType: "raw", VolumeSizeGB: 10}
+	require.NoError(t, manager.ProvisionVolume(context.Background(), provisionJob(req)))
+	assert.Equal(t, []string{
+		"CheckPaths ",
+		"CreateVolume web01-root",
+		"PopulateVolume web01-root",
+		"MarkComplete web01-root",
+	}, volumes.Calls())
+
+	// A degraded device fails the job before the volume is created
+	volumes = newFakeVolumeManager()
+	volumes.multipath = true
+	volumes.failures["CheckPaths"] = &lvm.MultipathError{
+		VolumeGroup: "data",
+		Device:      lvm.MultipathDevice{Name: "mpatha", ActivePaths: 0, TotalPaths: 2},
+		MinPaths:    1,
+	}
+	manager, _ = newProvisionTestManager(t, volumes)
+	err := manager.ProvisionVolume(context.Background(), provisionJob(req))
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeMultipathDegraded, code)
+	assert.Equal(t, map[string]string{"device": "mpatha", "active_paths": "0", "total_paths": "2"}, details)
+	assert.Equal(t, []string{"CheckPaths "}, volumes.Calls())
+	assert.False(t, volumes.VolumeExists("web01-root"))
+}
@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/events"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/overlay"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// SetOverlayManager enables requests for qcow2 overlays backed by cached images
+func (m *Manager) SetOverlayManager(overlays *overlay.Manager) {
+	m.overlays = overlays
+}
+
+// createOverlayStep creates a qcow2 overlay backed by the cached image. An existing
+// overlay used by a libvirt domain is not replaced unless the request allows it.
+func (m *Manager) createOverlayStep(ctx context.Context, p *provision) error {
+	p.existing = m.overlays.Exists(p.req.VolumeName)
+	if p.existing && !p.req.AllowAttached {
+		if err := m.checkNotAttached(p.req.VolumeName, m.overlays.Path(p.req.VolumeName)); err != nil {
+			return err
+		}
+	}
+
+	path, err := m.overlays.Create(p.req.VolumeName, p.imagePath, p.imageFormat(), p.req.SizeBytes())
+	if err != nil {
+		return types.NewError(types.ErrCodeVolumeCreateFailed, err, commandDetails(err))
+	}
+
+	p.job.DevicePath = path
+	logrus.WithFields(logrus.Fields{
+		"job_id":       p.job.ID,
+		"volume_name":  p.req.VolumeName,
+		"overlay_path": path,
+		"backing_file": p.imagePath,
+	}).Info("Created overlay")
+	m.recordVolume(ctx, p.job)
+	return nil
+}
+
+// deleteOverlayStep deletes an overlay whose provisioning failed after it was created
+func (m *Manager) deleteOverlayStep(p *provision) error {
+	if err := m.overlays.Delete(p.req.VolumeName); err != nil {
+		return types.NewError(types.ErrCodeRollbackFailed,
+			fmt.Errorf("provision failed + rollback failed: %w", err), nil)
+	}
+	m.emit(events.Event{Type: events.VolumeDeleted, JobID: p.job.ID, VolumeName: p.req.VolumeName})
+	m.recordVolumeDeleted(context.Background(), "", p.req.VolumeName)
+	return nil
+}
+
+// checkImageNotPinned fails if overlays are backed by a cached image, as removing
+// or replacing the image would corrupt them
+func (m *Manager) checkImageNotPinned(imagePath string) error {
+	if m.overlays == nil {
+		return nil
+	}
+	volumes, err := m.overlays.BackedBy(imagePath)
+	if err != nil {
+		return fmt.Errorf("failed to check overlays backed by %s: %w", imagePath, err)
+	}
+	if len(volumes) > 0 {
+		return fmt.Errorf("cached image %s is the backing file of overlays: %s", imagePath, strings.Join(volumes, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartJobOverlayNotConfigured(t *testing.T) {
+	manager := &Manager{jobs: make(map[string]*Job)}
+
+	_, err := manager.StartJob(types.ProvisionRequest{
+		ImageURL:     "https://minio/images/ubuntu.qcow2",
+		VolumeName:   "test01-root",
+		VolumeSizeGB: 20,
+		Overlay:      true,
+	})
+	code, _ := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeInvalidRequest, code)
+	assert.Empty(t, manager.jobs)
+}
+
+func TestProvisioningStepsOverlay(t *testing.T) {
+	manager := &Manager{}
+
+	var stages []string
+	for _, s := range manager.provisioningSteps(types.ProvisionRequest{Overlay: true}) {
+		stages = append(stages, s.name)
+	}
+	assert.Equal(t, []string{"checking_cache", "checking_architecture", "creating_overlay", "finalizing"}, stages)
+
+	// Without overlays, checking a cached image never pins it
+	assert.NoError(t, manager.checkImageNotPinned("/var/lib/libvirt/images/ubuntu.qcow2"))
+}
@@ -0,0 +1,195 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Slots a pipeline step may hold while it runs
+const (
+	slotDownload = "download"
+	slotDisk     = "disk"
+)
+
+// step is one stage of the provisioning pipeline. Each step is reported as a
+// stage of the job, so its progress and timing are visible individually.
+type step struct {
+	// name is reported as the job's stage while the step runs
+	name string
+	// percent is the job's progress when the step starts
+	percent float64
+	// slot limits how many jobs may run the step at once. Consecutive steps
+	// with the same slot hold it between them, unless the job is paused.
+	slot string
+	run  func(ctx context.Context, p *provision) error
+	// rollback, if set, undoes the step when a later step fails
+	rollback func(p *provision) error
+	// when, if set, decides whether the step applies to a job. Steps that do not
+	// apply are skipped without being reported as a stage.
+	when func(p *provision) bool
+}
+
+// provision carries the state of a job from one pipeline step to the next
+type provision struct {
+	job *Job
+	req types.ProvisionRequest
+	// imagePath is the cached image the volume is populated from
+	imagePath string
+	// existing is set if the volume existed before the job, and is being overwritten
+	existing bool
+	// snapshot is the snapshot taken of an existing volume, if any
+	snapshot string
+}
+
+// imageFormat returns the format of the cached image, which is qcow2 for images
+// compressed for the cache whatever the requested image type
+func (p *provision) imageFormat() string {
+	if cache.IsCompressed(p.imagePath) {
+		return "qcow2"
+	}
+	return p.req.ImageType
+}
+
+// provisioningSteps returns the steps a provisioning job runs through. New
+// processing, e.g. decompressing or customizing an image, is added as a step here.
+func (m *Manager) provisioningSteps(req types.ProvisionRequest) []step {
+	if req.Overlay {
+		return []step{
+			{name: "checking_cache", percent: 5, slot: slotDownload, run: m.fetchImageStep},
+			{name: "checking_architecture", percent: 40, run: m.checkArchitectureStep},
+			{name: "creating_overlay", percent: 50, slot: slotDisk, run: m.createOverlayStep, rollback: m.deleteOverlayStep},
+			{name: "finalizing", percent: 100},
+		}
+	}
+	if !req.NeedsImage() {
+		return []step{
+			{name: "checking_paths", percent: 45, slot: slotDisk, run: m.checkPathsStep, when: m.checksPaths},
+			{name: "creating_volume", percent: 50, slot: slotDisk, run: m.createVolumeStep, rollback: m.deleteVolumeStep},
+			{name: "formatting", percent: 75, slot: slotDisk, run: m.formatVolumeStep,
+				when: func(p *provision) bool { return formatted(p.req) }},
+			{name: "making_swap", percent: 75, slot: slotDisk, run: m.makeSwapStep,
+				when: func(p *provision) bool { return p.req.Type == types.VolumeTypeSwap }},
+			{name: "finalizing", percent: 100, run: m.finalizeStep},
+		}
+	}
+	windows := func(p *provision) bool { return p.req.Windows != nil }
+	return []step{
+		{name: "checking_cache", percent: 5, slot: slotDownload, run: m.fetchImageStep},
+		{name: "checking_architecture", percent: 40, run: m.checkArchitectureStep},
+		{name: "checking_drivers", percent: 45, run: m.checkDriversStep,
+			when: func(p *provision) bool { return windows(p) && p.req.Windows.RequireVirtio }},
+		{name: "checking_paths", percent: 48, slot: slotDisk, run: m.checkPathsStep, when: m.checksPaths},
+		{name: "creating_volume", percent: 50, slot: slotDisk, run: m.createVolumeStep, rollback: m.deleteVolumeStep},
+		{name: "checking_alignment", percent: 55, slot: slotDisk, run: m.checkAlignmentStep, when: windows},
+		{name: "snapshotting", percent: 60, slot: slotDisk, run: m.snapshotVolumeStep, rollback: m.restoreSnapshotStep,
+			when: func(p *provision) bool { return p.existing && p.req.Snapshot }},
+		{name: "converting", percent: 75, slot: slotDisk, run: m.populateVolumeStep},
+		{name: "finalizing", percent: 100, run: m.finalizeStep},
+	}
+}
+
+// slots returns the semaphore of a named slot, or nil for none
+func (m *Manager) slots(name string) *semaphore {
+	switch name {
+	case slotDownload:
+		return m.downloadSlots
+	case slotDisk:
+		return m.diskSlots
+	default:
+		return nil
+	}
+}
+
+// runPipeline runs the steps of a job in order. Paused jobs stop between steps,
+// without holding a slot. If a step fails or panics, the completed steps are rolled
+// back in reverse order.
+func (m *Manager) runPipeline(ctx context.Context, job *Job, steps []step) (err error) {
+	p := &provision{job: job, req: job.Request}
+
+	held := ""
+	release := func() {}
+	defer func() { release() }()
+
+	var completed []step
+	defer func() {
+		if err != nil {
+			m.rollbackSteps(p, completed, err)
+		}
+	}()
+	// Run before the rollback, so that a panicking step leaves nothing behind either
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(job, r)
+		}
+	}()
+
+	for _, s := range steps {
+		if s.when != nil && !s.when(p) {
+			continue
+		}
+		if s.slot != held {
+			release()
+			release, held = func() {}, ""
+		}
+
+		// A paused job gives up its slot while it waits, so other jobs are not held up
+		for job.Paused() {
+			release()
+			release, held = func() {}, ""
+			if err := job.WaitWhilePaused(ctx); err != nil {
+				return err
+			}
+		}
+
+		if s.slot != held {
+			r, err := m.slots(s.slot).acquire(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to wait for %s slot: %w", s.slot, err)
+			}
+			release, held = r, s.slot
+		}
+
+		m.startWork(job)
+		job.setStage(s.name, s.percent)
+		if s.run != nil {
+			if err := s.run(ctx, p); err != nil {
+				return err
+			}
+		}
+		completed = append(completed, s)
+	}
+
+	return nil
+}
+
+// rollbackSteps undoes completed steps in reverse order after cause failed the job.
+// A failed rollback replaces the job's error, as it leaves something behind that needs
+// attention, and is kept apart from cause so that the root cause is not lost.
+func (m *Manager) rollbackSteps(p *provision, completed []step, cause error) {
+	for i := len(completed) - 1; i >= 0; i-- {
+		s := completed[i]
+		if s.rollback == nil {
+			continue
+		}
+		if err := s.rollback(p); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"job_id": p.job.ID,
+				"step":   s.name,
+			}).Error("Rollback failed")
+			if p.job.RollbackError == nil {
+				// A cancelled job's error was set when it was cancelled
+				p.job.OriginalError = cause
+				if p.job.Error != nil {
+					p.job.OriginalError = p.job.Error
+				}
+			}
+			p.job.RollbackError = errors.Join(p.job.RollbackError, err)
+			p.job.Error = err
+		}
+	}
+}
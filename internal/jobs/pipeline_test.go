@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPipeline(t *testing.T) {
+	manager := &Manager{
+		downloadSlots: newSemaphore(1),
+		diskSlots:     newSemaphore(1),
+	}
+	job := &Job{ID: "pipeline-job", Progress: &types.ProgressInfo{Stage: "initializing"}}
+
+	var ran []string
+	record := func(name string) func(context.Context, *provision) error {
+		return func(context.Context, *provision) error {
+			ran = append(ran, name)
+			return nil
+		}
+	}
+	steps := []step{
+		{name: "download", percent: 10, slot: slotDownload, run: record("download")},
+		{name: "create", percent: 50, slot: slotDisk, run: record("create")},
+		{name: "snapshot", percent: 60, slot: slotDisk, run: record("snapshot"),
+			when: func(*provision) bool { return false }},
+		{name: "write", percent: 75, slot: slotDisk, run: func(context.Context, *provision) error {
+			// The disk slot is held from the previous step, and the download slot released
+			_, held := manager.diskSlots.usage()
+			assert.Equal(t, 1, held)
+			_, held = manager.downloadSlots.usage()
+			assert.Zero(t, held)
+			ran = append(ran, "write")
+			return nil
+		}},
+		{name: "finalize", percent: 100},
+	}
+
+	require.NoError(t, manager.runPipeline(context.Background(), job, steps))
+	assert.Equal(t, []string{"download", "create", "write"}, ran)
+	_, held := manager.diskSlots.usage()
+	assert.Zero(t, held)
+	assert.Equal(t, "finalize", job.Progress.Stage)
+
+	stages := make([]string, 0, len(job.StageTimings))
+	for _, timing := range job.StageTimings {
+		stages = append(stages, timing.Stage)
+	}
+	assert.Equal(t, []string{"download", "create", "write", "finalize"}, stages)
+}
+
+func TestRunPipelineRollback(t *testing.T) {
+	manager := &Manager{
+		downloadSlots: newSemaphore(1),
+		diskSlots:     newSemaphore(1),
+	}
+	job := &Job{ID: "pipeline-job", Progress: &types.ProgressInfo{Stage: "initializing"}}
+
+	var rolledBack []string
+	undo := func(name string, err error) func(*provision) error {
+		return func(*provision) error {
+			rolledBack = append(rolledBack, name)
+			return err
+		}
+	}
+	failed := errors.New("write failed")
+	rollbackFailed := types.NewError(types.ErrCodeRollbackFailed, errors.New("volume busy"), nil)
+	steps := []step{
+		{name: "first", rollback: undo("first", nil)},
+		{name: "second", slot: slotDisk, rollback: undo("second", rollbackFailed)},
+		{name: "third", slot: slotDisk, run: func(context.Context, *provision) error { return failed }},
+		{name: "never", rollback: undo("never", nil)},
+	}
+
+	err := manager.runPipeline(context.Background(), job, steps)
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, []string{"second", "first"}, rolledBack)
+	_, held := manager.diskSlots.usage()
+	assert.Zero(t, held)
+
+	// A failed rollback is reported instead of the original error
+	code, _ := types.ErrorCodeOf(job.Error, "")
+	assert.Equal(t, types.ErrCodeRollbackFailed, code)
+}
+
+// TestRunPipelinePaused tests that a job paused between two disk steps gives up its
+// disk slot, so another job can take it
+func TestRunPipelinePaused(t *testing.T) {
+	manager := &Manager{
+		downloadSlots: newSemaphore(1),
+		diskSlots:     newSemaphore(1),
+	}
+	paused := &Job{ID: "paused-job", Progress: &types.ProgressInfo{Stage: "initializing"}}
+	other := &Job{ID: "other-job", Progress: &types.ProgressInfo{Stage: "initializing"}}
+
+	created := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- manager.runPipeline(context.Background(), paused, []step{
+			{name: "create", slot: slotDisk, run: func(context.Context, *provision) error {
+				paused.pause()
+				close(created)
+				return nil
+			}},
+			{name: "write", slot: slotDisk},
+		})
+	}()
+	<-created
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, manager.runPipeline(ctx, other, []step{{name: "create", slot: slotDisk}}))
+	assert.Equal(t, "create", other.Progress.Stage)
+	select {
+	case err := <-done:
+		t.Fatalf("paused job finished: %v", err)
+	default:
+	}
+
+	paused.resume()
+	require.NoError(t, <-done)
+	assert.Equal(t, "write", paused.Progress.Stage)
+	_, held := manager.diskSlots.usage()
+	assert.Zero(t, held)
+}
@@ -0,0 +1,268 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testImageURL = "https://minio.example.com/images/ubuntu.raw"
+
+// testImage is the image at testImageURL
+var testImage = []byte("raw image")
+
+// newProvisionTestManager returns a manager provisioning onto volumes, with an
+// image store holding an image and its .sha256 file
+func newProvisionTestManager(t *testing.T, volumes *fakeVolumeManager) (*Manager, *fakeImageStore) {
+	t.Helper()
+	return newProvisionTestManagerWithStore(t, volumes, nil)
+}
+
+// newProvisionTestManagerWithStore is newProvisionTestManager recording jobs and
+// volumes in store
+func newProvisionTestManagerWithStore(t *testing.T, volumes *fakeVolumeManager,
+	store *storage.Store) (*Manager, *fakeImageStore) {
+	t.Helper()
+	imageCache, err := cache.NewDirectoryCache("images", t.TempDir())
+	require.NoError(t, err)
+
+	sum := sha256.Sum256(testImage)
+	images := &fakeImageStore{objects: map[string][]byte{
+		"images/ubuntu.raw":        testImage,
+		"images/ubuntu.raw.sha256": []byte(hex.EncodeToString(sum[:]) + "\n"),
+	}}
+	return NewManager(images, volumes, imageCache, store), images
+}
+
+func provisionJob(req types.ProvisionRequest) *Job {
+	return &Job{ID: "provision-job", Request: req, done: make(chan struct{})}
+}
+
+func TestProvisionVolume(t *testing.T) {
+	volumes := newFakeVolumeManager()
+	manager, images := newProvisionTestManager(t, volumes)
+
+	job := provisionJob(types.ProvisionRequest{
+		VolumeName: "web01-root", ImageURL: testImageURL, ImageType: "raw", VolumeSizeGB: 10,
+	})
+	require.NoError(t, manager.ProvisionVolume(context.Background(), job))
+
+	assert.Equal(t, []string{
+		"CreateVolume web01-root",
+		"PopulateVolume web01-root",
+		"MarkComplete web01-root",
+	}, volumes.Calls())
+	assert.Equal(t, 1, images.downloads)
+	assert.False(t, job.CacheHit)
+	assert.Equal(t, "/dev/data/web01-root", job.DevicePath)
+	assert.Len(t, job.ImageChecksum, 64)
+
+	// The second job uses the cached image
+	job = provisionJob(job.Request)
+	require.NoError(t, manager.ProvisionVolume(context.Background(), job))
+	assert.Equal(t, 1, images.downloads)
+	assert.True(t, job.CacheHit)
+}
+
+func TestProvisionVolumeRollback(t *testing.T) {
+	populateFailed := errors.New("qemu-img convert failed")
+
+	for _, tc := range []struct {
+		name        string
+		existing    bool
+		req         types.ProvisionRequest
+		downloadErr error
+		failures    map[string]error
+		calls       []string
+		code        types.ErrorCode
+		// remains is set if the volume is left in place
+		remains bool
+	}{
+		{
+			name:     "new volume is deleted",
+			failures: map[string]error{"PopulateVolume": populateFailed},
+			calls:    []string{"CreateVolume web01-root", "PopulateVolume web01-root", "DeleteVolume web01-root"},
+			code:     types.ErrCodeVolumePopulateFailed,
+		},
+		{
+			name:        "volume is not created for an image that cannot be downloaded",
+			downloadErr: errors.New("connection reset"),
+			code:        types.ErrCodeDownloadFailed,
+		},
+		{
+			name:     "failed creation is not rolled back",
+			failures: map[string]error{"CreateVolume": errors.New("lvcreate failed")},
+			calls:    []string{"CreateVolume web01-root"},
+			code:     types.ErrCodeVolumeCreateFailed,
+		},
+		{
+			name:     "existing volume is restored from its snapshot",
+			existing: true,
+			req:      types.ProvisionRequest{Snapshot: true},
+			failures: map[string]error{"PopulateVolume": populateFailed},
+			calls: []string{
+				"CreateVolume web01-root", "CreateSnapshot web01-root", "PopulateVolume web01-root",
+				"MergeSnapshot web01-root-snap",
+			},
+			code:    types.ErrCodeVolumePopulateFailed,
+			remains: true,
+		},
+		{
+			name:     "failed rollback is reported",
+			failures: map[string]error{"PopulateVolume": populateFailed, "DeleteVolume": errors.New("volume busy")},
+			calls:    []string{"CreateVolume web01-root", "PopulateVolume web01-root", "DeleteVolume web01-root"},
+			code:     types.ErrCodeRollbackFailed,
+			remains:  true,
+		},
+		{
+			name:     "volume that cannot be marked complete is deleted",
+			failures: map[string]error{"MarkComplete": errors.New("lvchange failed")},
+			calls: []string{
+				"CreateVolume web01-root", "PopulateVolume web01-root", "MarkComplete web01-root",
+				"DeleteVolume web01-root",
+			},
+			code: types.ErrCodeVolumePopulateFailed,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			volumes := newFakeVolumeManager()
+			if tc.existing {
+				volumes = newFakeVolumeManager("web01-root")
+			}
+			if tc.failures != nil {
+				volumes.failures = tc.failures
+			}
+			manager, images := newProvisionTestManager(t, volumes)
+			images.downloadErr = tc.downloadErr
+
+			req := tc.req
+			req.VolumeName, req.ImageURL, req.ImageType, req.VolumeSizeGB = "web01-root", testImageURL, "raw", 10
+			job := provisionJob(req)
+			err := manager.ProvisionVolume(context.Background(), job)
+			require.Error(t, err)
+			if job.Error != nil {
+				err = job.Error
+			}
+
+			code, _ := types.ErrorCodeOf(err, "")
+			assert.Equal(t, tc.code, code)
+			assert.Equal(t, tc.calls, volumes.Calls())
+			assert.Equal(t, tc.remains, volumes.VolumeExists("web01-root"))
+		})
+	}
+}
+
+func TestProvisionVolumeRollbackErrorKeepsCause(t *testing.T) {
+	volumes := newFakeVolumeManager()
+	volumes.failures = map[string]error{
+		"PopulateVolume": errors.New("qemu-img convert failed"),
+		"DeleteVolume":   errors.New("volume busy"),
+	}
+	manager, _ := newProvisionTestManager(t, volumes)
+
+	job := provisionJob(types.ProvisionRequest{
+		VolumeName: "web01-root", ImageURL: testImageURL, ImageType: "raw", VolumeSizeGB: 10,
+	})
+	manager.jobs[job.ID] = job
+	require.Error(t, manager.ProvisionVolume(context.Background(), job))
+	manager.failJob(job, errors.New("provisioning failed"))
+
+	status, err := manager.GetJobStatus(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ErrCodeRollbackFailed, status.ErrorCode)
+	assert.Equal(t, types.ErrCodeVolumePopulateFailed, status.OriginalErrorCode)
+	assert.Contains(t, status.OriginalError, "qemu-img convert failed")
+	assert.Contains(t, status.RollbackError, "volume busy")
+	assert.NotContains(t, status.RollbackError, "qemu-img")
+}
+
+func TestProvisionVolumeRemovesSnapshot(t *testing.T) {
+	volumes := newFakeVolumeManager("web01-root")
+	manager, _ := newProvisionTestManager(t, volumes)
+
+	job := provisionJob(types.ProvisionRequest{
+		VolumeName: "web01-root", ImageURL: testImageURL, ImageType: "raw", VolumeSizeGB: 10, Snapshot: true,
+	})
+	require.NoError(t, manager.ProvisionVolume(context.Background(), job))
+
+	assert.Equal(t, []string{
+		"CreateVolume web01-root",
+		"CreateSnapshot web01-root",
+		"PopulateVolume web01-root",
+		"MarkComplete web01-root",
+		"DeleteVolume web01-root-snap",
+	}, volumes.Calls())
+	assert.False(t, volumes.VolumeExists("web01-root-snap"))
+}
+
+func TestProvisionVolumeBlank(t *testing.T) {
+	volumes := newFakeVolumeManager()
+	manager, images := newProvisionTestManager(t, volumes)
+
+	job := provisionJob(types.ProvisionRequest{
+		VolumeName: "data-1", Type: types.VolumeTypeBlank, VolumeSizeGB: 10, Filesystem: "xfs",
+	})
+	require.NoError(t, manager.ProvisionVolume(context.Background(), job))
+	assert.Equal(t, []string{"CreateVolume data-1", "FormatVolume data-1", "MarkComplete data-1"}, volumes.Calls())
+	assert.Zero(t, images.downloads)
+
+	// A volume that cannot be formatted is deleted
+	volumes = newFakeVolumeManager()
+	volumes.failures["FormatVolume"] = errors.New("mkfs.xfs failed")
+	manager, _ = newProvisionTestManager(t, volumes)
+	err := manager.ProvisionVolume(context.Background(), provisionJob(job.Request))
+	code, _ := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeFormatFailed, code)
+	assert.Equal(t, []string{"CreateVolume data-1", "FormatVolume data-1", "DeleteVolume data-1"}, volumes.Calls())
+	assert.False(t, volumes.VolumeExists("data-1"))
+}
+
+func TestProvisionVolumeVerifiesWrite(t *testing.T) {
+	volumes := newFakeVolumeManager()
+	volumes.written = "0000000000000000000000000000000000000000000000000000000000000000"
+	manager, _ := newProvisionTestManager(t, volumes)
+
+	job := provisionJob(types.ProvisionRequest{
+		VolumeName: "web01-root", ImageURL: testImageURL, ImageType: "raw", VolumeSizeGB: 10,
+	})
+	err := manager.ProvisionVolume(context.Background(), job)
+	code, _ := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeVolumeChecksumMismatch, code)
+	assert.Equal(t, []string{"CreateVolume web01-root", "PopulateVolume web01-root", "DeleteVolume web01-root"},
+		volumes.Calls())
+	require.NotNil(t, job.WriteVerified)
+	assert.False(t, *job.WriteVerified)
+}
+
+// TestProvisionVolumePanic tests that a panicking step fails the job and rolls back
+// the steps completed before it
+func TestProvisionVolumePanic(t *testing.T) {
+	volumes := newFakeVolumeManager()
+	volumes.panics = "PopulateVolume"
+	manager, _ := newProvisionTestManager(t, volumes)
+
+	jobID, err := manager.StartJob(types.ProvisionRequest{
+		VolumeName: "web01-root", ImageURL: testImageURL, ImageType: "raw", VolumeSizeGB: 10,
+	})
+	require.NoError(t, err)
+	job := waitForJob(t, manager, jobID)
+
+	assert.Equal(t, types.StatusFailed, job.Status)
+	code, details := types.ErrorCodeOf(job.Error, "")
+	assert.Equal(t, types.ErrCodeInternal, code)
+	assert.Equal(t, "PopulateVolume exploded", details["panic"])
+	assert.Equal(t, []string{
+		"CreateVolume web01-root",
+		"PopulateVolume web01-root",
+		"DeleteVolume web01-root",
+	}, volumes.Calls())
+	assert.False(t, volumes.VolumeExists("web01-root"))
+}
@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// qemuImgFailure is a common qemu-img failure, recognised by its error message
+type qemuImgFailure struct {
+	pattern *regexp.Regexp
+	code    types.ErrorCode
+	reason  string
+	hint    string
+}
+
+// qemuImgFailures are checked in order, so unsupported compression types are not
+// mistaken for corruption
+var qemuImgFailures = []qemuImgFailure{
+	{
+		pattern: regexp.MustCompile(`(?i)no space left on device|disk quota exceeded`),
+		code:    types.ErrCodeVolumeNoSpace,
+		reason:  "the volume is smaller than the image",
+		hint:    "request a volume at least as large as the image's virtual size, as reported by qemu-img info",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)compression type`),
+		code:    types.ErrCodeImageUnsupported,
+		reason:  "the image uses a compression type the host's qemu-img does not support",
+		hint:    "recompress the image with -o compression_type=zlib, or upgrade qemu-img on the host",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)image is corrupt|not in qcow2? format|qcow2? header|bad magic|` +
+			`invalid (l1|l2|refcount|cluster)|could not read (l1|l2|snapshots|image)`),
+		code:   types.ErrCodeImageCorrupt,
+		reason: "the image is corrupt",
+		hint:   "check the image with qemu-img check and upload it again",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)permission denied|operation not permitted`),
+		code:    types.ErrCodePermissionDenied,
+		reason:  "qemu-img was denied access to the image or the volume",
+		hint: "check that the provisioner's user may read the image cache and write to the volume's device, " +
+			"including any AppArmor or SELinux policy",
+	},
+}
+
+// qemuImgError translates a common qemu-img failure into an error with its own code,
+// the line of qemu-img's output explaining it and a remediation hint, rather than the
+// command's combined output. It returns nil for other errors.
+func qemuImgError(err error) *types.Error {
+	var cmdErr *lvm.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Command != "qemu-img" {
+		return nil
+	}
+	for _, failure := range qemuImgFailures {
+		line := matchingLine(cmdErr.Output, failure.pattern)
+		if line == "" {
+			continue
+		}
+		return types.NewError(failure.code,
+			fmt.Errorf("failed to populate volume: %s: %s", failure.reason, line),
+			map[string]string{"command": cmdErr.Command, "error": line, "hint": failure.hint})
+	}
+	return nil
+}
+
+// matchingLine returns the first line of output matching pattern, without the
+// "qemu-img: " prefix, or "" if none does
+func matchingLine(output string, pattern *regexp.Regexp) string {
+	for _, line := range strings.Split(output, "\n") {
+		if pattern.MatchString(line) {
+			return strings.TrimPrefix(strings.TrimSpace(line), "qemu-img: ")
+		}
+	}
+	return ""
+}
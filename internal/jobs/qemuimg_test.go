@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func qemuImgFailed(output string) error {
+	return fmt.Errorf("failed to populate volume web01-root after retries: %w",
+		&lvm.CommandError{Command: "qemu-img", Output: output, Err: errors.New("exit status 1")})
+}
+
+func TestQemuImgError(t *testing.T) {
+	for _, tc := range []struct {
+		output string
+		code   types.ErrorCode
+		line   string
+	}{
+		{
+			output: "qemu-img: error while writing at byte 10737418240: No space left on device\n",
+			code:   types.ErrCodeVolumeNoSpace,
+			line:   "error while writing at byte 10737418240: No space left on device",
+		},
+		{
+			output: "qemu-img: Could not open 'disk.qcow2': qcow2: Image is corrupt; cannot be opened read/write\n",
+			code:   types.ErrCodeImageCorrupt,
+			line:   "Could not open 'disk.qcow2': qcow2: Image is corrupt; cannot be opened read/write",
+		},
+		{
+			output: "qemu-img: Could not open 'disk.qcow2': Image is not in qcow2 format\n",
+			code:   types.ErrCodeImageCorrupt,
+			line:   "Could not open 'disk.qcow2': Image is not in qcow2 format",
+		},
+		{
+			output: "qemu-img: Could not open 'disk.qcow2': " +
+				"qcow2: Compression type 'zstd' is not supported\n",
+			code: types.ErrCodeImageUnsupported,
+			line: "Could not open 'disk.qcow2': qcow2: Compression type 'zstd' is not supported",
+		},
+		{
+			output: "qemu-img: /dev/data/web01-root: error while converting raw: Could not open " +
+				"'/dev/data/web01-root': Permission denied\n",
+			code: types.ErrCodePermissionDenied,
+			line: "/dev/data/web01-root: error while converting raw: Could not open '/dev/data/web01-root': " +
+				"Permission denied",
+		},
+	} {
+		qemuErr := qemuImgError(qemuImgFailed(tc.output))
+		require.NotNil(t, qemuErr, tc.output)
+		assert.Equal(t, tc.code, qemuErr.Code, tc.output)
+		assert.Equal(t, tc.line, qemuErr.Details["error"], tc.output)
+		assert.NotEmpty(t, qemuErr.Details["hint"], tc.output)
+		assert.NotContains(t, qemuErr.Error(), "exit status", tc.output)
+	}
+
+	assert.Nil(t, qemuImgError(qemuImgFailed("qemu-img: something unexpected happened\n")))
+	assert.Nil(t, qemuImgError(errors.New("Permission denied")))
+	assert.Nil(t, qemuImgError(&lvm.CommandError{Command: "lvcreate", Output: "No space left on device"}))
+}
+
+func TestProvisionVolume_QemuImgFailure(t *testing.T) {
+	volumes := newFakeVolumeManager()
+	volumes.failures = map[string]error{
+		"PopulateVolume": qemuImgFailed("qemu-img: Could not open 'disk.qcow2': qcow2: Image is corrupt\n"),
+	}
+	manager, images := newProvisionTestManager(t, volumes)
+
+	req := types.ProvisionRequest{VolumeName: "web01-root", ImageURL: testImageURL, ImageType: "raw", VolumeSizeGB: 10}
+	err := manager.ProvisionVolume(context.Background(), provisionJob(req))
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeImageCorrupt, code)
+	assert.Equal(t, "Could not open 'disk.qcow2': qcow2: Image is corrupt", details["error"])
+	assert.Equal(t, "qemu-img", details["command"])
+
+	// The corrupt image was evicted, so the next job downloads it again
+	volumes.failures = nil
+	require.NoError(t, manager.ProvisionVolume(context.Background(), provisionJob(req)))
+	assert.Equal(t, 2, images.downloads)
+}
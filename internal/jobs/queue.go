@@ -0,0 +1,161 @@
+package jobs
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+const (
+	// workDurationWeight is the weight of the latest job in the average time jobs take
+	// from starting work to finishing
+	workDurationWeight = 0.2
+	// defaultRetryAfter is suggested to clients refused by a full queue before any job
+	// has finished, and maxRetryAfter bounds the suggestion
+	defaultRetryAfter = 30 * time.Second
+	maxRetryAfter     = 10 * time.Minute
+)
+
+var (
+	queueDepthGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "libvirt_volume_provisioner_queue_depth",
+			Help: "Jobs waiting for capacity to start work",
+		},
+	)
+	queueFullTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "libvirt_volume_provisioner_queue_full_total",
+			Help: "Total number of jobs refused because the queue was full",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(queueDepthGauge, queueFullTotal)
+}
+
+// workDuration keeps a moving average of how long jobs take from starting work to
+// finishing, to estimate when queued jobs will start
+type workDuration struct {
+	mu      sync.Mutex
+	average time.Duration
+}
+
+// record adds the duration of a finished job to the average
+func (w *workDuration) record(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.average == 0 {
+		w.average = d
+		return
+	}
+	w.average += time.Duration(workDurationWeight * float64(d-w.average))
+}
+
+// get returns the average, or zero before any job has finished
+func (w *workDuration) get() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.average
+}
+
+// SetMaxQueueDepth sets how many jobs may wait for capacity to start work before new
+// jobs are refused with QUEUE_FULL. Zero, the default, accepts any number.
+func (m *Manager) SetMaxQueueDepth(depth int) error {
+	if depth < 0 {
+		return fmt.Errorf("invalid maximum queue depth %d", depth)
+	}
+	m.maxQueueDepth = depth
+	return nil
+}
+
+// checkQueueDepth refuses a new job while the queue is full, suggesting when to retry
+func (m *Manager) checkQueueDepth() error {
+	depth := int(m.queueDepth.Load())
+	if m.maxQueueDepth == 0 || depth < m.maxQueueDepth {
+		return nil
+	}
+	queueFullTotal.Inc()
+	retryAfter := m.retryAfter()
+	return types.NewError(types.ErrCodeQueueFull,
+		fmt.Errorf("job queue is full with %d jobs waiting to start; retry in %s or submit elsewhere", depth, retryAfter),
+		map[string]string{
+			"queue_depth": strconv.Itoa(depth),
+			"retry_after": strconv.Itoa(int(retryAfter / time.Second)),
+		})
+}
+
+// retryAfter estimates when a place in the queue frees up: one job starts each time a
+// job finishes, on average after the average duration divided by the disk concurrency
+func (m *Manager) retryAfter() time.Duration {
+	average := m.workDuration.get()
+	if average == 0 {
+		return defaultRetryAfter
+	}
+	limit, _ := m.diskSlots.usage()
+	seconds := math.Ceil((average / time.Duration(max(limit, 1))).Seconds())
+	return min(max(time.Duration(seconds)*time.Second, time.Second), maxRetryAfter)
+}
+
+// enqueue counts a job as waiting for capacity to start work
+func (m *Manager) enqueue(job *Job) {
+	if job.queued.CompareAndSwap(false, true) {
+		m.queueDepth.Add(1)
+		queueDepthGauge.Inc()
+	}
+}
+
+// dequeue stops counting a job as waiting, when it starts work or finishes without
+// having started
+func (m *Manager) dequeue(job *Job) {
+	if job.queued.CompareAndSwap(true, false) {
+		m.queueDepth.Add(-1)
+		queueDepthGauge.Dec()
+	}
+}
+
+// startWork takes a job out of the queue as its first pipeline step starts
+func (m *Manager) startWork(job *Job) {
+	if job.workStartedAt.IsZero() {
+		job.workStartedAt = time.Now()
+	}
+	m.dequeue(job)
+}
+
+// queueInfo returns where a job waiting for capacity stands in the queue, or nil for
+// a job that is not waiting. Its position counts the waiting jobs submitted before it.
+func (m *Manager) queueInfo(job *Job, now time.Time) *types.QueueInfo {
+	if !job.queued.Load() {
+		return nil
+	}
+
+	m.mu.RLock()
+	position := 1
+	for _, other := range m.jobs {
+		if other != job && other.queued.Load() &&
+			(other.CreatedAt.Before(job.CreatedAt) || (other.CreatedAt.Equal(job.CreatedAt) && other.ID < job.ID)) {
+			position++
+		}
+	}
+	m.mu.RUnlock()
+
+	info := &types.QueueInfo{Position: position}
+	// Nothing starts while the queue is paused or outside the provisioning windows
+	m.settingsMu.Lock()
+	paused := m.queueResumed != nil
+	m.settingsMu.Unlock()
+	average := m.workDuration.get()
+	if average > 0 && !paused && m.windows.Open(now) {
+		limit, _ := m.diskSlots.usage()
+		wait := time.Duration(position) * average / time.Duration(max(limit, 1))
+		start := now.Add(wait).Truncate(time.Second)
+		info.EstimatedStart = &start
+	}
+	return info
+}
@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueBackpressure(t *testing.T) {
+	volumes := newFakeVolumeManager()
+	manager := NewManager(&fakeImageStore{}, volumes, nil, nil)
+	require.Error(t, manager.SetMaxQueueDepth(-1))
+	require.NoError(t, manager.SetMaxQueueDepth(2))
+
+	// Jobs wait in the queue while it is paused
+	paused := true
+	_, err := manager.UpdateSettings(types.SettingsUpdate{QueuePaused: &paused})
+	require.NoError(t, err)
+
+	var jobIDs []string
+	for _, name := range []string{"data-1", "data-2"} {
+		jobID, err := manager.StartJob(types.ProvisionRequest{VolumeName: name, VolumeSizeGB: 1, Type: types.VolumeTypeBlank})
+		require.NoError(t, err)
+		jobIDs = append(jobIDs, jobID)
+	}
+
+	_, err = manager.StartJob(types.ProvisionRequest{VolumeName: "data-3", VolumeSizeGB: 1, Type: types.VolumeTypeBlank})
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeQueueFull, code)
+	assert.Equal(t, map[string]string{"queue_depth": "2", "retry_after": "30"}, details)
+
+	for i, jobID := range jobIDs {
+		status, err := manager.GetJobStatus(jobID)
+		require.NoError(t, err)
+		require.NotNil(t, status.Queue)
+		assert.Equal(t, i+1, status.Queue.Position)
+		// Nothing has finished yet, and the queue is paused
+		assert.Nil(t, status.Queue.EstimatedStart)
+	}
+
+	paused = false
+	_, err = manager.UpdateSettings(types.SettingsUpdate{QueuePaused: &paused})
+	require.NoError(t, err)
+	for _, jobID := range jobIDs {
+		<-manager.jobs[jobID].done
+		status, err := manager.GetJobStatus(jobID)
+		require.NoError(t, err)
+		assert.Equal(t, types.StatusCompleted, status.Status)
+		assert.Nil(t, status.Queue)
+	}
+	assert.Zero(t, manager.queueDepth.Load())
+	assert.Positive(t, manager.workDuration.get())
+
+	_, err = manager.StartJob(types.ProvisionRequest{VolumeName: "data-3", VolumeSizeGB: 1, Type: types.VolumeTypeBlank})
+	assert.NoError(t, err)
+}
+
+func TestQueueEstimates(t *testing.T) {
+	manager := NewManager(&fakeImageStore{}, nil, nil, nil)
+	created := time.Now()
+	for _, id := range []string{"first", "second", "third"} {
+		job := &Job{ID: id, CreatedAt: created}
+		manager.jobs[id] = job
+		manager.enqueue(job)
+		created = created.Add(time.Second)
+	}
+	manager.startWork(manager.jobs["first"])
+	assert.Equal(t, int64(2), manager.queueDepth.Load())
+	assert.Nil(t, manager.queueInfo(manager.jobs["first"], time.Now()))
+	assert.Equal(t, defaultRetryAfter, manager.retryAfter())
+
+	// With two disk slots taking 2 minutes per job, a job starts every minute
+	manager.workDuration.record(2 * time.Minute)
+	assert.Equal(t, time.Minute, manager.retryAfter())
+
+	now := time.Date(2026, 1, 14, 10, 0, 0, 0, time.UTC)
+	info := manager.queueInfo(manager.jobs["third"], now)
+	require.NotNil(t, info)
+	assert.Equal(t, 2, info.Position)
+	require.NotNil(t, info.EstimatedStart)
+	assert.Equal(t, now.Add(2*time.Minute), *info.EstimatedStart)
+
+	// The average follows recent jobs
+	manager.workDuration.record(7 * time.Minute)
+	assert.Equal(t, 3*time.Minute, manager.workDuration.get())
+}
@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// checkQuota refuses a job whose new volume would take the volume group above its
+// hard quota. The quota is checked again before the volume is created, as other
+// jobs may have allocated space in the meantime.
+func (m *Manager) checkQuota(req types.ProvisionRequest) error {
+	if m.lvmManager == nil || req.Overlay || m.lvmManager.VolumeExists(req.VolumeName) {
+		return nil
+	}
+	err := m.lvmManager.CheckQuota(context.Background(), req.SizeBytes())
+	var quota *lvm.QuotaError
+	if errors.As(err, &quota) {
+		return quotaExceeded(quota)
+	}
+	if err != nil {
+		// The volume group could not be queried; creating the volume will tell
+		logrus.WithError(err).Warn("Failed to check volume group quota")
+	}
+	return nil
+}
+
+// quotaExceeded returns the error of a volume refused by the volume group's hard quota
+func quotaExceeded(quota *lvm.QuotaError) error {
+	return types.NewError(types.ErrCodeQuotaExceeded, quota, map[string]string{
+		"volume_group":      quota.VolumeGroup,
+		"projected_percent": fmt.Sprintf("%.1f", quota.ProjectedPercent),
+		"quota_percent":     fmt.Sprintf("%.1f", quota.HardPercent),
+	})
+}
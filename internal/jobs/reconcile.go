@@ -0,0 +1,253 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/netbox"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// extentTolerance allows for LVM rounding volume sizes up to whole extents when they
+// are compared with the sizes NetBox records
+const extentTolerance = 64 << 20
+
+// netboxDisk identifies the NetBox disk volumes were provisioned for: a virtual disk of
+// a virtual machine, or all of its disks if disk is empty
+type netboxDisk struct {
+	vmID int
+	disk string
+}
+
+// ReconcileVolumes cross-references the volumes of the volume group with the disks of
+// the libvirt domains, the volume records and, for volumes provisioned for a NetBox
+// virtual machine, the disk sizes NetBox records. It reports volumes whose size differs
+// from NetBox, volumes no domain uses or missing from the records, and volumes domains
+// or the records refer to that do not exist. Checks against libvirt, the records or
+// NetBox are skipped when they are not configured.
+func (m *Manager) ReconcileVolumes(ctx context.Context) (*types.ReconciliationReport, error) {
+	if m.lvmManager == nil {
+		return nil, types.NewError(types.ErrCodeNotSupported, fmt.Errorf("LVM is not configured"), nil)
+	}
+
+	infos, err := m.lvmManager.ListVolumeInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+	incomplete, err := m.lvmManager.IncompleteVolumes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list incomplete volumes: %w", err)
+	}
+
+	report := &types.ReconciliationReport{
+		Volumes:  []types.ReconciledVolume{},
+		Findings: []types.ReconciliationFinding{},
+	}
+	for _, info := range infos {
+		// Snapshots and thin pools are not VM disks
+		if info.Origin != "" || strings.HasPrefix(info.Attributes, "t") {
+			continue
+		}
+		report.Volumes = append(report.Volumes, types.ReconciledVolume{Name: info.Name, SizeBytes: info.SizeBytes})
+	}
+	sort.Slice(report.Volumes, func(i, j int) bool { return report.Volumes[i].Name < report.Volumes[j].Name })
+	volumes := make(map[string]*types.ReconciledVolume, len(report.Volumes))
+	for i := range report.Volumes {
+		volumes[report.Volumes[i].Name] = &report.Volumes[i]
+	}
+	addFinding := func(kind, volumeName, domain, format string, args ...any) {
+		report.Findings = append(report.Findings, types.ReconciliationFinding{
+			Kind:       kind,
+			VolumeName: volumeName,
+			Domain:     domain,
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+	// Volumes being provisioned are neither used by a domain nor recorded yet
+	provisioning := func(volumeName string) bool {
+		return slices.Contains(incomplete, volumeName) || m.activeJobForVolume(volumeName) != ""
+	}
+
+	if m.domains != nil {
+		disks, err := m.domains.DomainDisks()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list domain disks: %w", err)
+		}
+		for _, disk := range disks {
+			name, ok := m.volumeForDiskPath(disk.Path)
+			if !ok {
+				continue
+			}
+			volume, exists := volumes[name]
+			if !exists {
+				addFinding(types.FindingMissingVolume, name, disk.Domain,
+					"domain %s has a disk on volume %s, which does not exist", disk.Domain, name)
+				continue
+			}
+			if !slices.Contains(volume.Domains, disk.Domain) {
+				volume.Domains = append(volume.Domains, disk.Domain)
+			}
+		}
+		for _, volume := range report.Volumes {
+			if len(volume.Domains) == 0 && !provisioning(volume.Name) {
+				addFinding(types.FindingOrphanVolume, volume.Name, "",
+					"volume %s is not a disk of any libvirt domain", volume.Name)
+			}
+		}
+	}
+
+	if m.store != nil {
+		records, err := m.store.ListVolumes(storage.ListVolumesFilter{
+			VolumeGroup: m.lvmManager.VolumeGroup(),
+			Limit:       10000,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list volume records: %w", err)
+		}
+		// Records are newest first, so each volume takes its latest record
+		for _, record := range records {
+			volume, exists := volumes[record.Name]
+			if !exists {
+				addFinding(types.FindingMissingVolume, record.Name, "",
+					"volume %s is in the volume records but does not exist", record.Name)
+				continue
+			}
+			if !volume.Recorded {
+				volume.Recorded = true
+				volume.JobID = record.JobID
+			}
+		}
+		for _, volume := range report.Volumes {
+			if !volume.Recorded && !provisioning(volume.Name) {
+				addFinding(types.FindingUnrecordedVolume, volume.Name, "",
+					"volume %s is not in the volume records; adopt it to manage it", volume.Name)
+			}
+		}
+	}
+
+	if m.netbox != nil {
+		m.reconcileNetBox(ctx, report, addFinding)
+	}
+	return report, nil
+}
+
+// reconcileNetBox compares the sizes of the volumes provisioned for NetBox virtual
+// machines with the sizes NetBox records. Volumes provisioned for a virtual machine
+// without naming a disk are compared together with its total disk size.
+func (m *Manager) reconcileNetBox(ctx context.Context, report *types.ReconciliationReport,
+	addFinding func(kind, volumeName, domain, format string, args ...any)) {
+	groups := make(map[netboxDisk][]*types.ReconciledVolume)
+	var keys []netboxDisk
+	for i := range report.Volumes {
+		volume := &report.Volumes[i]
+		if volume.JobID == "" {
+			continue
+		}
+		key, ok := m.netboxDiskOfJob(volume.JobID)
+		if !ok {
+			continue
+		}
+		if _, seen := groups[key]; !seen {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], volume)
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		object, recordedMB, err := m.netbox.RecordedSize(ctx, key.vmID, key.disk)
+		if err != nil {
+			for _, volume := range group {
+				addFinding(types.FindingNetBoxLookupFailed, volume.Name, "",
+					"failed to look up NetBox size of volume %s: %v", volume.Name, err)
+			}
+			continue
+		}
+
+		var sizeBytes int64
+		names := make([]string, 0, len(group))
+		for _, volume := range group {
+			volume.NetBox = &types.NetBoxObject{Type: object.Type, ID: object.ID, Name: object.Name, URL: object.URL}
+			volume.NetBoxDisk = key.disk
+			volume.NetBoxSizeMB = recordedMB
+			sizeBytes += volume.SizeBytes
+			names = append(names, volume.Name)
+		}
+		if sizeMatches(sizeBytes, recordedMB) {
+			continue
+		}
+
+		recordedFor := object.Name
+		if key.disk != "" {
+			recordedFor += " disk " + key.disk
+		}
+		sizeMB := (sizeBytes + bytesPerMB - 1) / bytesPerMB
+		for _, volume := range group {
+			if len(group) == 1 {
+				addFinding(types.FindingSizeMismatch, volume.Name, "",
+					"volume %s is %d MB but NetBox records %d MB for %s", volume.Name, sizeMB, recordedMB, recordedFor)
+				continue
+			}
+			addFinding(types.FindingSizeMismatch, volume.Name, "",
+				"volumes %s total %d MB but NetBox records %d MB for %s",
+				strings.Join(names, ", "), sizeMB, recordedMB, recordedFor)
+		}
+	}
+}
+
+// netboxDiskOfJob returns the NetBox disk a job provisioned its volume for, if any
+func (m *Manager) netboxDiskOfJob(jobID string) (netboxDisk, bool) {
+	m.mu.RLock()
+	job, ok := m.jobs[jobID]
+	m.mu.RUnlock()
+
+	var req types.ProvisionRequest
+	switch {
+	case ok:
+		req = job.Request
+	case m.store != nil:
+		record, err := m.store.GetJob(jobID)
+		if err != nil || json.Unmarshal([]byte(record.RequestJSON), &req) != nil {
+			return netboxDisk{}, false
+		}
+	}
+	if req.NetBoxVMID == 0 {
+		return netboxDisk{}, false
+	}
+	return netboxDisk{vmID: req.NetBoxVMID, disk: req.NetBoxDisk}, true
+}
+
+// sizeMatches reports whether a volume size matches the size NetBox records. NetBox
+// sizes in GB are provisioned as GiB, so any size from the recorded megabytes up to
+// as many GiB per 1000 MB, rounded up to whole extents, matches.
+func sizeMatches(sizeBytes int64, recordedMB int) bool {
+	smallest := int64(recordedMB-1) * bytesPerMB
+	largest := int64(recordedMB)*(1<<30)/netbox.MegabytesPerGB + extentTolerance
+	return sizeBytes > smallest && sizeBytes <= largest
+}
+
+// volumeForDiskPath returns the volume of the volume group a domain disk refers to,
+// as /dev/<vg>/<volume> or /dev/mapper/<vg>-<volume>
+func (m *Manager) volumeForDiskPath(path string) (string, bool) {
+	path = filepath.Clean(path)
+	if filepath.Dir(path) == filepath.Dir(m.lvmManager.DevicePath("volume")) {
+		return filepath.Base(path), true
+	}
+
+	// Device mapper names escape hyphens in volume group and volume names by doubling them
+	volumeGroup := m.lvmManager.VolumeGroup()
+	if volumeGroup == "" {
+		return "", false
+	}
+	mapped, ok := strings.CutPrefix(path, "/dev/mapper/"+strings.ReplaceAll(volumeGroup, "-", "--")+"-")
+	if !ok || mapped == "" || strings.HasPrefix(mapped, "-") {
+		return "", false
+	}
+	return strings.ReplaceAll(mapped, "--", "-"), true
+}
@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileVolumes(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+	ctx := context.Background()
+
+	volumes := newFakeVolumeManager("web01-root", "web01-data", "web01-swap", "stray-root", "new-root")
+	volumes.volumes["web01-root"] = 50 << 30
+	volumes.volumes["web01-data"] = 100 << 30
+	volumes.incomplete["new-root"] = true
+	manager := NewManager(&fakeImageStore{}, volumes, nil, store)
+	manager.SetDomainLister(fakeDomainLister{
+		"/dev/data/web01-root":         {{Name: "web01", Running: true}},
+		"/dev/mapper/data-web01--data": {{Name: "web01", Running: true}},
+		"/dev/data/web01-swap":         {{Name: "web01", Running: true}},
+		"/dev/data/web01-old":          {{Name: "web01", Running: true}},
+		"/var/lib/libvirt/seed.iso":    {{Name: "web01", Running: true}},
+	})
+	// NetBox records 100 GB for the root disk provisioned with 50 GB
+	manager.SetNetBoxClient(&fakeNetBoxClient{disksMB: map[string]int{"root": 100000, "data": 100000}}, false)
+
+	manager.jobs["job-root"] = &Job{
+		ID:      "job-root",
+		Status:  types.StatusCompleted,
+		Request: types.ProvisionRequest{VolumeName: "web01-root", NetBoxVMID: 1, NetBoxDisk: "root"},
+	}
+	for id, request := range map[string]string{
+		"job-data": `{"volume_name":"web01-data","netbox_vm_id":1,"netbox_disk":"data"}`,
+		"job-swap": `{"volume_name":"web01-swap","netbox_vm_id":1,"netbox_disk":"swap"}`,
+	} {
+		require.NoError(t, store.SaveJob(ctx, &storage.JobRecord{
+			ID:          id,
+			Status:      string(types.StatusCompleted),
+			RequestJSON: request,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}))
+	}
+	for name, jobID := range map[string]string{
+		"web01-root": "job-root", "web01-data": "job-data", "web01-swap": "job-swap", "gone-root": "job-gone",
+	} {
+		require.NoError(t, store.SaveVolume(ctx, &storage.VolumeRecord{
+			Name: name, VolumeGroup: "data", SizeGB: 10, JobID: jobID, CreatedAt: time.Now(),
+		}))
+	}
+
+	report, err := manager.ReconcileVolumes(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, report.Volumes, 5)
+	root := report.Volumes[3]
+	assert.Equal(t, "web01-root", root.Name)
+	assert.Equal(t, []string{"web01"}, root.Domains)
+	assert.True(t, root.Recorded)
+	assert.Equal(t, "job-root", root.JobID)
+	require.NotNil(t, root.NetBox)
+	assert.Equal(t, "web01", root.NetBox.Name)
+	assert.Equal(t, 100000, root.NetBoxSizeMB)
+	assert.Equal(t, []string{"web01"}, report.Volumes[2].Domains, "matched through /dev/mapper")
+
+	type finding struct{ kind, volume string }
+	var findings []finding
+	for _, f := range report.Findings {
+		findings = append(findings, finding{f.Kind, f.VolumeName})
+		if f.Kind == types.FindingSizeMismatch {
+			assert.Equal(t, "volume web01-root is 53688 MB but NetBox records 100000 MB for web01 disk root", f.Message)
+		}
+	}
+	assert.ElementsMatch(t, []finding{
+		{types.FindingMissingVolume, "web01-old"},
+		{types.FindingMissingVolume, "gone-root"},
+		{types.FindingOrphanVolume, "stray-root"},
+		{types.FindingUnrecordedVolume, "stray-root"},
+		{types.FindingSizeMismatch, "web01-root"},
+		{types.FindingNetBoxLookupFailed, "web01-swap"},
+	}, findings)
+}
+
+func TestReconcileVolumes_TotalDiskSize(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+	ctx := context.Background()
+
+	volumes := newFakeVolumeManager("web01-root", "web01-data")
+	volumes.volumes["web01-root"] = 20 << 30
+	volumes.volumes["web01-data"] = 30 << 30
+	manager := NewManager(&fakeImageStore{}, volumes, nil, store)
+	netbox := &fakeNetBoxClient{disksMB: map[string]int{"": 50000}}
+	manager.SetNetBoxClient(netbox, false)
+	for _, name := range []string{"web01-root", "web01-data"} {
+		manager.jobs["job-"+name] = &Job{ID: "job-" + name, Status: types.StatusCompleted,
+			Request: types.ProvisionRequest{VolumeName: name, NetBoxVMID: 1}}
+		require.NoError(t, store.SaveVolume(ctx, &storage.VolumeRecord{
+			Name: name, VolumeGroup: "data", JobID: "job-" + name, CreatedAt: time.Now(),
+		}))
+	}
+
+	// Volumes provisioned without naming a disk are compared with the total disk size
+	report, err := manager.ReconcileVolumes(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, report.Findings)
+
+	netbox.disksMB[""] = 40000
+	report, err = manager.ReconcileVolumes(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Findings, 2)
+	assert.Equal(t, "volumes web01-data, web01-root total 53688 MB but NetBox records 40000 MB for web01",
+		report.Findings[0].Message)
+}
+
+func TestSizeMatches(t *testing.T) {
+	assert.True(t, sizeMatches(50<<30, 50000))
+	assert.True(t, sizeMatches(50*1000*1000*1000, 50000))
+	assert.True(t, sizeMatches(40<<30, 42950), "GiB rounded up to whole MB")
+	assert.True(t, sizeMatches(50<<30+4<<20, 50000), "rounded up to a whole extent")
+	assert.False(t, sizeMatches(50<<30, 100000))
+	assert.False(t, sizeMatches(100<<30, 50000))
+}
+
+func TestVolumeForDiskPath(t *testing.T) {
+	manager := NewManager(&fakeImageStore{}, newFakeVolumeManager(), nil, nil)
+
+	tests := []struct {
+		path   string
+		volume string
+	}{
+		{"/dev/data/web01-root", "web01-root"},
+		{"/dev/data/../data/web01-root", "web01-root"},
+		{"/dev/mapper/data-web01--root", "web01-root"},
+		{"/dev/mapper/other-web01--root", ""},
+		{"/var/lib/libvirt/images/seed.iso", ""},
+	}
+	for _, tt := range tests {
+		volume, ok := manager.volumeForDiskPath(tt.path)
+		assert.Equal(t, tt.volume != "", ok, tt.path)
+		assert.Equal(t, tt.volume, volume, tt.path)
+	}
+}
@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Where completed jobs leave their result document
+const (
+	// ResultToCache writes the document to the results directory of the job's cache pool
+	ResultToCache = "cache"
+	// ResultToTag stores the document in an LVM tag on the volume
+	ResultToTag = "tag"
+)
+
+// resultDir is the directory of a cache pool holding result documents. It is hidden
+// so that it is not listed as a volume of a libvirt directory pool.
+const resultDir = ".results"
+
+// SetResultTarget sets where completed jobs leave a result document identifying the
+// source of the volume: ResultToCache, ResultToTag, or "" for nowhere
+func (m *Manager) SetResultTarget(target string) error {
+	switch target {
+	case "", ResultToCache, ResultToTag:
+		m.resultTarget = target
+		return nil
+	default:
+		return fmt.Errorf("unknown result document target: %s", target)
+	}
+}
+
+// writeResultDocument leaves the result document of a completed job alongside its
+// volume. Failures are logged, as the volume itself is usable.
+func (m *Manager) writeResultDocument(job *Job) {
+	if m.resultTarget == "" {
+		return
+	}
+
+	document := types.ResultDocument{
+		Name:          job.Request.VolumeName,
+		VolumeGroup:   job.VolumeGroup,
+		DevicePath:    job.DevicePath,
+		VolumeFormat:  job.Request.VolumeFormat,
+		SizeBytes:     job.VolumeSizeBytes,
+		ImageURL:      job.Request.ImageURL,
+		ImageChecksum: job.ImageChecksum,
+		Architecture:  job.ImageArchitecture,
+		JobID:         job.ID,
+		ProvisionedAt: time.Now().UTC(),
+	}
+	data, err := json.Marshal(document)
+	if err != nil {
+		logrus.WithError(err).WithField("job_id", job.ID).Warn("Failed to encode result document")
+		return
+	}
+
+	switch {
+	case m.resultTarget == ResultToTag && !job.Request.Overlay && m.lvmManager != nil:
+		err = m.lvmManager.SetResultTag(job.Request.VolumeName, data)
+	case m.resultTarget == ResultToCache:
+		err = m.writeResultFile(job.Request.CachePool, job.Request.VolumeName, data)
+	default:
+		return // Overlays have no LVM volume to tag
+	}
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"job_id":      job.ID,
+			"volume_name": job.Request.VolumeName,
+			"target":      m.resultTarget,
+		}).Warn("Failed to write result document")
+	}
+}
+
+// writeResultFile writes a result document to the results directory of a cache
+// pool, replacing it atomically so readers never see a partial document
+func (m *Manager) writeResultFile(poolName, volumeName string, data []byte) error {
+	if err := validateVolumeName(volumeName); err != nil {
+		return err
+	}
+	dir, err := m.resultDir(poolName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create result directory: %w", err)
+	}
+
+	path := filepath.Join(dir, volumeName+".json")
+	partial := path + ".partial"
+	if err := os.WriteFile(partial, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write result document: %w", err)
+	}
+	if err := os.Rename(partial, path); err != nil {
+		return fmt.Errorf("failed to write result document: %w", err)
+	}
+	return nil
+}
+
+// resultDir returns the results directory of a cache pool, the default pool if unnamed
+func (m *Manager) resultDir(poolName string) (string, error) {
+	if m.imageCache == nil {
+		return "", fmt.Errorf("no image cache to write result documents to")
+	}
+	pools := m.imageCache.Pools()
+	for _, pool := range pools {
+		if pool.Name == poolName || (poolName == "" && pool == pools[0]) {
+			return filepath.Join(pool.Path, resultDir), nil
+		}
+	}
+	return "", fmt.Errorf("unknown cache pool: %s", poolName)
+}
+
+// removeResultDocument removes the result document of a deleted volume from the
+// cache pools. Result tags go with the volume.
+func (m *Manager) removeResultDocument(volumeName string) {
+	if m.resultTarget != ResultToCache || m.imageCache == nil {
+		return
+	}
+	for _, pool := range m.imageCache.Pools() {
+		path := filepath.Join(pool.Path, resultDir, volumeName+".json")
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logrus.WithError(err).WithField("volume_name", volumeName).Warn("Failed to remove result document")
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetResultTarget(t *testing.T) {
+	manager := &Manager{}
+	for _, target := range []string{"", ResultToCache, ResultToTag} {
+		assert.NoError(t, manager.SetResultTarget(target))
+	}
+	assert.Error(t, manager.SetResultTarget("file"))
+}
+
+func TestResultDocumentInCachePool(t *testing.T) {
+	cacheDir := t.TempDir()
+	imageCache, err := cache.NewDirectoryCache("images", cacheDir)
+	require.NoError(t, err)
+	manager := &Manager{jobs: make(map[string]*Job), imageCache: imageCache}
+	require.NoError(t, manager.SetResultTarget(ResultToCache))
+
+	job := &Job{
+		ID: "job",
+		Request: types.ProvisionRequest{VolumeName: "web01-root", ImageURL: "https://minio/images/ubuntu.qcow2",
+			VolumeFormat: "raw"},
+		VolumeGroup:     "data",
+		DevicePath:      "/dev/data/web01-root",
+		VolumeSizeBytes: 20 << 30,
+		ImageChecksum:   "abc123",
+	}
+	manager.writeResultDocument(job)
+
+	path := filepath.Join(cacheDir, "images", resultDir, "web01-root.json")
+	data, err := os.ReadFile(path) //nolint:gosec // Path in the test's temporary directory
+	require.NoError(t, err)
+	var document types.ResultDocument
+	require.NoError(t, json.Unmarshal(data, &document))
+	assert.Equal(t, "web01-root", document.Name)
+	assert.Equal(t, "data", document.VolumeGroup)
+	assert.Equal(t, "/dev/data/web01-root", document.DevicePath)
+	assert.Equal(t, "raw", document.VolumeFormat)
+	assert.Equal(t, int64(20<<30), document.SizeBytes)
+	assert.Equal(t, "https://minio/images/ubuntu.qcow2", document.ImageURL)
+	assert.Equal(t, "abc123", document.ImageChecksum)
+	assert.Equal(t, "job", document.JobID)
+	assert.False(t, document.ProvisionedAt.IsZero())
+
+	// Result documents are not mistaken for cached images
+	entries, err := imageCache.Entries()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// The document goes with the volume
+	manager.recordVolumeDeleted(context.Background(), "data", "web01-root")
+	assert.NoFileExists(t, path)
+}
@@ -0,0 +1,134 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// maxRequeuedJobs bounds the number of pending jobs resumed after a restart
+const maxRequeuedJobs = 10000
+
+// waitForSchedule blocks until the time a job was scheduled for with not_before
+func (m *Manager) waitForSchedule(ctx context.Context, job *Job) error {
+	if job.Request.NotBefore == nil {
+		return nil
+	}
+	now := time.Now()
+	wait := job.Request.NotBefore.Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+
+	job.setWaiting("waiting_for_schedule", now)
+	logrus.WithFields(logrus.Fields{
+		"job_id":     job.ID,
+		"not_before": *job.Request.NotBefore,
+	}).Info("Job waiting for its scheduled time")
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pendingJobs returns the jobs of a previous run that had not started, oldest first,
+// so jobs are resumed after the jobs they depend on
+func (m *Manager) pendingJobs() ([]*storage.JobRecord, error) {
+	if m.store == nil {
+		return nil, nil
+	}
+	return m.store.ListJobs(storage.ListJobsFilter{
+		Status:    string(types.StatusPending),
+		SortBy:    storage.SortByCreatedAt,
+		Ascending: true,
+		Limit:     maxRequeuedJobs,
+	})
+}
+
+// requeueJobs resumes the jobs of a previous run that had not started yet, such as
+// jobs waiting for their scheduled time, a provisioning window or their dependencies.
+// They keep their ID, and are carried out as originally requested.
+func (m *Manager) requeueJobs(records []*storage.JobRecord) {
+	for _, record := range records {
+		job, err := jobFromRecord(record)
+		if err != nil {
+			logrus.WithError(err).WithField("job_id", record.ID).Error("Failed to resume pending job")
+			continue
+		}
+
+		// Write-back to NetBox needs the object the request was validated against
+		if job.Request.NetBoxVMID != 0 && m.netbox != nil {
+			object, err := m.netbox.ValidateVolume(context.Background(), job.Request.NetBoxVMID,
+				job.Request.NetBoxDisk, netboxSizeMB(job.Request))
+			if err != nil {
+				job.Status = types.StatusFailed
+				job.Error = types.NewError(types.ErrCodeNetBoxValidationFailed,
+					fmt.Errorf("NetBox validation failed: %w", err), nil)
+				m.syncToDatabase(context.Background(), job)
+				continue
+			}
+			job.NetBox = object
+		}
+		if m.lvmManager != nil && !job.Request.Overlay {
+			job.VolumeGroup = m.lvmManager.VolumeGroup()
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		job.cancelFunc = cancel
+		m.mu.Lock()
+		m.jobs[job.ID] = job
+		m.mu.Unlock()
+		m.syncToDatabase(ctx, job)
+
+		fields := logrus.Fields{"job_id": job.ID, "volume_name": job.Request.VolumeName}
+		if job.Request.NotBefore != nil {
+			fields["not_before"] = *job.Request.NotBefore
+		}
+		logrus.WithFields(fields).Info("Resumed pending job from previous run")
+
+		go m.runJob(ctx, job)
+	}
+}
+
+// jobFromRecord rebuilds a pending job from its database record
+func jobFromRecord(record *storage.JobRecord) (*Job, error) {
+	var submitted types.ProvisionRequest
+	if err := json.Unmarshal([]byte(record.RequestJSON), &submitted); err != nil {
+		return nil, fmt.Errorf("failed to decode job request: %w", err)
+	}
+	req := submitted
+	var verification *types.VolumeVerification
+	// Jobs recorded before effective requests were stored only have the request
+	if record.EffectiveRequestJSON != "" {
+		var effective types.EffectiveRequest
+		if err := json.Unmarshal([]byte(record.EffectiveRequestJSON), &effective); err != nil {
+			return nil, fmt.Errorf("failed to decode effective job request: %w", err)
+		}
+		req = effective.ProvisionRequest
+		if effective.Verify {
+			verification = &types.VolumeVerification{VolumeName: req.VolumeName, Method: verifyMethod(req)}
+		}
+	}
+	req.Identity = record.Identity
+
+	return &Job{
+		ID:               record.ID,
+		Status:           types.StatusPending,
+		Request:          req,
+		SubmittedRequest: submitted,
+		Verification:     verification,
+		CreatedAt:        record.CreatedAt,
+		UpdatedAt:        time.Now(),
+		done:             make(chan struct{}),
+	}, nil
+}
@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForSchedule(t *testing.T) {
+	manager := &Manager{}
+
+	// Jobs without a schedule, or whose time has come, start at once
+	job := &Job{ID: "job"}
+	require.NoError(t, manager.waitForSchedule(context.Background(), job))
+	past := time.Now().Add(-time.Minute)
+	job.Request.NotBefore = &past
+	require.NoError(t, manager.waitForSchedule(context.Background(), job))
+	assert.Nil(t, job.Progress)
+
+	soon := time.Now().Add(50 * time.Millisecond)
+	job.Request.NotBefore = &soon
+	require.NoError(t, manager.waitForSchedule(context.Background(), job))
+	assert.False(t, time.Now().Before(soon))
+	assert.Equal(t, "waiting_for_schedule", job.Progress.Stage)
+
+	// Cancelling a scheduled job stops the wait
+	later := time.Now().Add(time.Hour)
+	job.Request.NotBefore = &later
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, manager.waitForSchedule(ctx, job), context.Canceled)
+}
+
+func TestRecoverJobsResumesPendingJobs(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	created := time.Now().Add(-time.Hour)
+	require.NoError(t, store.SaveJob(context.Background(), &storage.JobRecord{
+		ID:          "running",
+		Status:      string(types.StatusRunning),
+		RequestJSON: `{"volume_name":"web01-root"}`,
+		CreatedAt:   created,
+		UpdatedAt:   created,
+	}))
+	notBefore := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	effective := `{"volume_name":"data-1","type":"blank","volume_size_gb":10,` +
+		`"not_before":"` + notBefore.Format(time.RFC3339) + `","timeout_seconds":1800}`
+	require.NoError(t, store.SaveJob(context.Background(), &storage.JobRecord{
+		ID:                   "scheduled",
+		Status:               string(types.StatusPending),
+		RequestJSON:          `{"volume_name":"data-1","profile":"data"}`,
+		EffectiveRequestJSON: effective,
+		Identity:             "token:0123456789ab",
+		CreatedAt:            created,
+		UpdatedAt:            created,
+	}))
+
+	manager := &Manager{jobs: make(map[string]*Job), store: store}
+	require.NoError(t, manager.RecoverJobs())
+	defer func() { _ = manager.CancelJob("scheduled") }()
+
+	// Started jobs are failed, jobs that had not started are resumed
+	record, err := store.GetJob("running")
+	require.NoError(t, err)
+	assert.Equal(t, string(types.StatusFailed), record.Status)
+	record, err = store.GetJob("scheduled")
+	require.NoError(t, err)
+	assert.Equal(t, string(types.StatusPending), record.Status)
+
+	status, err := manager.GetJobStatus("scheduled")
+	require.NoError(t, err)
+	assert.Equal(t, types.StatusPending, status.Status)
+	assert.Equal(t, "token:0123456789ab", status.Identity)
+	assert.Equal(t, "data", status.Request.Profile)
+	require.NotNil(t, status.EffectiveRequest.NotBefore)
+	assert.True(t, notBefore.Equal(*status.EffectiveRequest.NotBefore))
+	assert.Equal(t, created.Unix(), status.CreatedAt.Unix())
+}
@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+)
+
+// semaphore limits how many jobs use a resource at once. Unlike a buffered channel,
+// its limit can be changed while slots are held: lowering it lets the holders finish,
+// and further slots are only handed out once fewer than the new limit are held.
+type semaphore struct {
+	mu    sync.Mutex
+	limit int
+	held  int
+	// freed is closed and replaced whenever a slot may have become available
+	freed chan struct{}
+}
+
+// newSemaphore creates a semaphore with limit slots, at least one
+func newSemaphore(limit int) *semaphore {
+	return &semaphore{limit: max(limit, 1), freed: make(chan struct{})}
+}
+
+// acquire takes a slot, waiting until one is free, returning a function that releases it
+func (s *semaphore) acquire(ctx context.Context) (func(), error) {
+	for {
+		s.mu.Lock()
+		if s.held < s.limit {
+			s.held++
+			s.mu.Unlock()
+			return s.release, nil
+		}
+		freed := s.freed
+		s.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// release returns a slot
+func (s *semaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held--
+	s.notify()
+}
+
+// setLimit changes the number of slots, at least one
+func (s *semaphore) setLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = max(limit, 1)
+	s.notify()
+}
+
+// notify wakes the goroutines waiting for a slot; the caller holds mu
+func (s *semaphore) notify() {
+	close(s.freed)
+	s.freed = make(chan struct{})
+}
+
+// usage returns the number of slots and how many of them are held
+func (s *semaphore) usage() (limit, held int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit, s.held
+}
@@ -0,0 +1,212 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// runtimeSettingsName is the job database setting the settings changed at runtime are kept in
+const runtimeSettingsName = "runtime"
+
+var queuePausedGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "libvirt_volume_provisioner_queue_paused",
+		Help: "Whether the job queue is paused, holding new and pending jobs (1) or not (0)",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(queuePausedGauge)
+}
+
+// BandwidthLimiter may be implemented by an ImageStore whose download bandwidth can be
+// limited at runtime. It is implemented by minio.Client.
+type BandwidthLimiter interface {
+	SetDownloadBandwidth(bytesPerSec int64)
+	DownloadBandwidth() int64
+}
+
+// GetSettings returns the runtime settings in effect
+func (m *Manager) GetSettings() (*types.RuntimeSettings, error) {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	return m.runtimeSettings(), nil
+}
+
+// UpdateSettings changes runtime settings, keeping the changes in the job database so
+// that they survive restarts. Jobs holding slots when concurrency is lowered keep them.
+func (m *Manager) UpdateSettings(update types.SettingsUpdate) (*types.RuntimeSettings, error) {
+	if update.DownloadBytesPerSec != nil {
+		if _, ok := m.minioClient.(BandwidthLimiter); !ok {
+			return nil, types.NewError(types.ErrCodeNotSupported,
+				fmt.Errorf("the image store does not support limiting download bandwidth"), nil)
+		}
+	}
+
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+
+	overrides := m.settings
+	if update.Reset {
+		overrides = types.SettingsUpdate{}
+	}
+	if update.DownloadConcurrency != nil {
+		overrides.DownloadConcurrency = update.DownloadConcurrency
+	}
+	if update.DiskConcurrency != nil {
+		overrides.DiskConcurrency = update.DiskConcurrency
+	}
+	if update.DownloadBytesPerSec != nil {
+		overrides.DownloadBytesPerSec = update.DownloadBytesPerSec
+	}
+	if update.QueuePaused != nil {
+		overrides.QueuePaused = update.QueuePaused
+	}
+
+	// Saved before being applied, so that a failure changes nothing
+	now := time.Now()
+	if m.store != nil {
+		value, err := json.Marshal(overrides)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode runtime settings: %w", err)
+		}
+		if err := m.store.SaveSetting(context.Background(), runtimeSettingsName, string(value), now); err != nil {
+			return nil, err
+		}
+	}
+	m.settings, m.settingsUpdatedAt = overrides, now
+	m.applySettings()
+
+	settings := m.runtimeSettings()
+	logrus.WithFields(logrus.Fields{
+		"download_concurrency":   settings.DownloadConcurrency,
+		"disk_concurrency":       settings.DiskConcurrency,
+		"download_bytes_per_sec": settings.DownloadBytesPerSec,
+		"queue_paused":           settings.QueuePaused,
+		"overridden":             settings.Overridden,
+	}).Warn("Runtime settings changed")
+	return settings, nil
+}
+
+// RestoreSettings applies the settings last changed at runtime, kept in the job
+// database, over the configuration. It is called at startup after SetConcurrency.
+func (m *Manager) RestoreSettings() error {
+	if m.store == nil {
+		return nil
+	}
+	value, updatedAt, err := m.store.GetSetting(runtimeSettingsName)
+	if err != nil || value == "" {
+		return err
+	}
+
+	var overrides types.SettingsUpdate
+	if err := json.Unmarshal([]byte(value), &overrides); err != nil {
+		return fmt.Errorf("failed to parse runtime settings: %w", err)
+	}
+
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	m.settings, m.settingsUpdatedAt = overrides, updatedAt
+	m.applySettings()
+
+	settings := m.runtimeSettings()
+	if len(settings.Overridden) > 0 {
+		logrus.WithFields(logrus.Fields{
+			"overridden": settings.Overridden,
+			"updated_at": updatedAt,
+		}).Info("Restored settings changed at runtime, overriding the configuration")
+	}
+	if settings.QueuePaused {
+		logrus.Warn("Job queue is paused; jobs stay pending until it is resumed through the admin API")
+	}
+	return nil
+}
+
+// applySettings puts the configuration, overridden by the settings changed at runtime,
+// into effect. The caller holds settingsMu.
+func (m *Manager) applySettings() {
+	downloads, diskWrites := m.configuredDownloads, m.configuredDiskWrites
+	if m.settings.DownloadConcurrency != nil {
+		downloads = *m.settings.DownloadConcurrency
+	}
+	if m.settings.DiskConcurrency != nil {
+		diskWrites = *m.settings.DiskConcurrency
+	}
+	m.downloadSlots.setLimit(downloads)
+	m.diskSlots.setLimit(diskWrites)
+
+	if limiter, ok := m.minioClient.(BandwidthLimiter); ok {
+		var bandwidth int64
+		if m.settings.DownloadBytesPerSec != nil {
+			bandwidth = *m.settings.DownloadBytesPerSec
+		}
+		limiter.SetDownloadBandwidth(bandwidth)
+	}
+
+	paused := m.settings.QueuePaused != nil && *m.settings.QueuePaused
+	switch {
+	case paused && m.queueResumed == nil:
+		m.queueResumed = make(chan struct{})
+		queuePausedGauge.Set(1)
+	case !paused && m.queueResumed != nil:
+		close(m.queueResumed)
+		m.queueResumed = nil
+		queuePausedGauge.Set(0)
+	}
+}
+
+// runtimeSettings returns the settings in effect. The caller holds settingsMu.
+func (m *Manager) runtimeSettings() *types.RuntimeSettings {
+	settings := &types.RuntimeSettings{QueuePaused: m.queueResumed != nil}
+	settings.DownloadConcurrency, _ = m.downloadSlots.usage()
+	settings.DiskConcurrency, _ = m.diskSlots.usage()
+	if limiter, ok := m.minioClient.(BandwidthLimiter); ok {
+		settings.DownloadBytesPerSec = limiter.DownloadBandwidth()
+	}
+
+	for _, setting := range []struct {
+		name string
+		set  bool
+	}{
+		{"download_concurrency", m.settings.DownloadConcurrency != nil},
+		{"disk_concurrency", m.settings.DiskConcurrency != nil},
+		{"download_bytes_per_sec", m.settings.DownloadBytesPerSec != nil},
+		{"queue_paused", m.settings.QueuePaused != nil},
+	} {
+		if setting.set {
+			settings.Overridden = append(settings.Overridden, setting.name)
+		}
+	}
+
+	if !m.settingsUpdatedAt.IsZero() {
+		updatedAt := m.settingsUpdatedAt
+		settings.UpdatedAt = &updatedAt
+	}
+	return settings
+}
+
+// waitForQueue holds a job pending while the job queue is paused
+func (m *Manager) waitForQueue(ctx context.Context, job *Job) error {
+	m.settingsMu.Lock()
+	resumed := m.queueResumed
+	m.settingsMu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+
+	job.setWaiting("queue_paused", time.Now())
+	logrus.WithField("job_id", job.ID).Info("Job waiting for the paused queue to resume")
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// limitedImageStore is an image store whose download bandwidth can be limited
+type limitedImageStore struct {
+	fakeImageStore
+	bytesPerSec int64
+}
+
+func (s *limitedImageStore) SetDownloadBandwidth(bytesPerSec int64) { s.bytesPerSec = bytesPerSec }
+func (s *limitedImageStore) DownloadBandwidth() int64               { return s.bytesPerSec }
+
+func TestUpdateSettings(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	images := &limitedImageStore{}
+	manager := NewManager(images, nil, nil, store)
+	manager.SetConcurrency(4, 3)
+
+	downloads, bandwidth, paused := 1, int64(50<<20), true
+	settings, err := manager.UpdateSettings(types.SettingsUpdate{
+		DownloadConcurrency: &downloads, DownloadBytesPerSec: &bandwidth, QueuePaused: &paused,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, settings.DownloadConcurrency)
+	assert.Equal(t, 3, settings.DiskConcurrency)
+	assert.Equal(t, int64(50<<20), images.bytesPerSec)
+	assert.True(t, settings.QueuePaused)
+	assert.Equal(t, []string{"download_concurrency", "download_bytes_per_sec", "queue_paused"}, settings.Overridden)
+	require.NotNil(t, settings.UpdatedAt)
+
+	// A restarted manager restores the changes over its configuration
+	restarted := NewManager(&limitedImageStore{}, nil, nil, store)
+	restarted.SetConcurrency(4, 3)
+	require.NoError(t, restarted.RestoreSettings())
+	restored, err := restarted.GetSettings()
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored.DownloadConcurrency)
+	assert.Equal(t, int64(50<<20), restored.DownloadBytesPerSec)
+	assert.True(t, restored.QueuePaused)
+
+	// Resetting returns to the configuration, except for the settings given with it
+	diskWrites := 1
+	settings, err = restarted.UpdateSettings(types.SettingsUpdate{Reset: true, DiskConcurrency: &diskWrites})
+	require.NoError(t, err)
+	assert.Equal(t, 4, settings.DownloadConcurrency)
+	assert.Equal(t, 1, settings.DiskConcurrency)
+	assert.Zero(t, settings.DownloadBytesPerSec)
+	assert.False(t, settings.QueuePaused)
+	assert.Equal(t, []string{"disk_concurrency"}, settings.Overridden)
+
+	// Bandwidth cannot be limited without a store that supports it
+	plain := NewManager(&fakeImageStore{}, nil, nil, nil)
+	_, err = plain.UpdateSettings(types.SettingsUpdate{DownloadBytesPerSec: &bandwidth})
+	code, _ := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeNotSupported, code)
+}
+
+func TestWaitForQueue(t *testing.T) {
+	manager := NewManager(&fakeImageStore{}, nil, nil, nil)
+	job := &Job{ID: "queued"}
+	require.NoError(t, manager.waitForQueue(context.Background(), job))
+	assert.Nil(t, job.Progress)
+
+	paused := true
+	_, err := manager.UpdateSettings(types.SettingsUpdate{QueuePaused: &paused})
+	require.NoError(t, err)
+
+	waited := make(chan error)
+	go func() { waited <- manager.waitForQueue(context.Background(), job) }()
+	select {
+	case <-waited:
+		t.Fatal("job started while the queue was paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	paused = false
+	_, err = manager.UpdateSettings(types.SettingsUpdate{QueuePaused: &paused})
+	require.NoError(t, err)
+	require.NoError(t, <-waited)
+	assert.Equal(t, "queue_paused", job.Progress.Stage)
+
+	// Cancelled jobs stop waiting
+	paused = true
+	_, err = manager.UpdateSettings(types.SettingsUpdate{QueuePaused: &paused})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, manager.waitForQueue(ctx, job), context.Canceled)
+}
+
+// TestCancelJobWaitingForQueue tests that a job waiting for the paused queue can be
+// looked up and cancelled while it waits
+func TestCancelJobWaitingForQueue(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	manager := NewManager(&fakeImageStore{}, newFakeVolumeManager(), nil, store)
+	paused := true
+	_, err = manager.UpdateSettings(types.SettingsUpdate{QueuePaused: &paused})
+	require.NoError(t, err)
+
+	jobID, err := manager.StartJob(types.ProvisionRequest{
+		VolumeName: "data-1", VolumeSizeGB: 10, Type: types.VolumeTypeBlank,
+	})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		status, err := manager.GetJobStatus(jobID)
+		return err == nil && status.Progress != nil && status.Progress.Stage == "queue_paused"
+	}, 5*time.Second, 5*time.Millisecond)
+
+	require.NoError(t, manager.CancelJob(jobID))
+	job := waitForJob(t, manager, jobID)
+	assert.Equal(t, types.StatusFailed, job.Status)
+	code, _ := types.ErrorCodeOf(job.Error, "")
+	assert.Equal(t, types.ErrCodeJobCancelled, code)
+}
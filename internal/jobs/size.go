@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"fmt"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/netbox"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// bytesPerMB is the size of the megabytes NetBox records disk sizes in
+const bytesPerMB = 1000 * 1000
+
+// validateSize checks that a request sets its volume size with exactly one of
+// volume_size, volume_size_gb and volume_size_mib
+func validateSize(req types.ProvisionRequest) error {
+	sizes := 0
+	for _, set := range []bool{req.VolumeSize != "", req.VolumeSizeGB != 0, req.VolumeSizeMiB != 0} {
+		if set {
+			sizes++
+		}
+	}
+	if sizes > 1 {
+		return types.NewError(types.ErrCodeInvalidRequest,
+			fmt.Errorf("only one of volume_size, volume_size_gb and volume_size_mib may be set"), nil)
+	}
+
+	switch {
+	case req.VolumeSize != "":
+		if _, err := types.ParseSize(req.VolumeSize); err != nil {
+			return types.NewError(types.ErrCodeInvalidRequest, err, map[string]string{"volume_size": "format"})
+		}
+	case req.VolumeSizeMiB != 0 && req.VolumeSizeMiB < 1:
+		return types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("volume_size_mib must be at least 1"),
+			map[string]string{"volume_size_mib": "min=1"})
+	case req.VolumeSizeMiB == 0 && req.VolumeSizeGB < 1:
+		return types.NewError(types.ErrCodeInvalidRequest, fmt.Errorf("volume_size_gb must be at least 1"),
+			map[string]string{"volume_size_gb": "min=1"})
+	}
+	return nil
+}
+
+// netboxSizeMB returns the requested size in the megabytes NetBox records disk sizes
+// in. Sizes in GB are compared the way NetBox displays them, as 1000 MB to the GB;
+// sizes given in bytes or MiB are rounded up to whole megabytes.
+func netboxSizeMB(req types.ProvisionRequest) int {
+	if req.VolumeSize == "" && req.VolumeSizeMiB == 0 {
+		return req.VolumeSizeGB * netbox.MegabytesPerGB
+	}
+	return int((req.SizeBytes() + bytesPerMB - 1) / bytesPerMB)
+}
+
+// volumeSize returns the actual size of a created volume, which LVM rounds up to
+// whole extents, or 0 if it cannot be read
+func (m *Manager) volumeSize(p *provision) int64 {
+	info, err := m.lvmManager.GetVolumeInfo(p.req.VolumeName)
+	if err != nil {
+		logrus.WithError(err).WithField("job_id", p.job.ID).Warn("Failed to read size of created volume")
+		return 0
+	}
+	if info.SizeBytes != p.req.SizeBytes() {
+		logrus.WithFields(logrus.Fields{
+			"job_id":          p.job.ID,
+			"volume_name":     p.req.VolumeName,
+			"requested_bytes": p.req.SizeBytes(),
+			"actual_bytes":    info.SizeBytes,
+		}).Info("Volume size differs from the requested size")
+	}
+	return info.SizeBytes
+}
@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     types.ProvisionRequest
+		wantErr bool
+		detail  string
+	}{
+		{name: "gb", req: types.ProvisionRequest{VolumeSizeGB: 10}},
+		{name: "mib", req: types.ProvisionRequest{VolumeSizeMiB: 512}},
+		{name: "size", req: types.ProvisionRequest{VolumeSize: "50GiB"}},
+		{name: "none", req: types.ProvisionRequest{}, wantErr: true, detail: "volume_size_gb"},
+		{name: "gb and mib", req: types.ProvisionRequest{VolumeSizeGB: 1, VolumeSizeMiB: 512}, wantErr: true},
+		{name: "size and gb", req: types.ProvisionRequest{VolumeSize: "1GiB", VolumeSizeGB: 1}, wantErr: true},
+		{name: "negative mib", req: types.ProvisionRequest{VolumeSizeMiB: -1}, wantErr: true, detail: "volume_size_mib"},
+		{name: "invalid size", req: types.ProvisionRequest{VolumeSize: "50GB"}, wantErr: true, detail: "volume_size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSize(tt.req)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			code, details := types.ErrorCodeOf(err, "")
+			assert.Equal(t, types.ErrCodeInvalidRequest, code)
+			if tt.detail != "" {
+				assert.Contains(t, details, tt.detail)
+			}
+		})
+	}
+}
+
+func TestRequestSize(t *testing.T) {
+	req := types.ProvisionRequest{VolumeSizeGB: 10}
+	assert.Equal(t, int64(10<<30), req.SizeBytes())
+	assert.Equal(t, 10, req.SizeGB())
+
+	// Sizes in MiB are rounded up to whole GB where GB are needed
+	req = types.ProvisionRequest{VolumeSizeMiB: 1536}
+	assert.Equal(t, int64(1536<<20), req.SizeBytes())
+	assert.Equal(t, 2, req.SizeGB())
+
+	req = types.ProvisionRequest{VolumeSize: "107374182400"}
+	assert.Equal(t, int64(100<<30), req.SizeBytes())
+	req = types.ProvisionRequest{VolumeSize: "invalid"}
+	assert.Zero(t, req.SizeBytes())
+}
+
+func TestNetBoxSizeMB(t *testing.T) {
+	// Whole GB are compared as NetBox displays them
+	assert.Equal(t, 40000, netboxSizeMB(types.ProvisionRequest{VolumeSizeGB: 40}))
+	// Byte-precise sizes are compared exactly, rounding up to whole megabytes
+	assert.Equal(t, 40000, netboxSizeMB(types.ProvisionRequest{VolumeSize: "40000000000"}))
+	assert.Equal(t, 42950, netboxSizeMB(types.ProvisionRequest{VolumeSize: "40GiB"}))
+	assert.Equal(t, 537, netboxSizeMB(types.ProvisionRequest{VolumeSizeMiB: 512}))
+}
+
+func TestGetJobStatusVolumeSize(t *testing.T) {
+	manager := &Manager{jobs: make(map[string]*Job)}
+	manager.jobs["job"] = &Job{
+		ID:              "job",
+		Status:          types.StatusCompleted,
+		Request:         types.ProvisionRequest{VolumeName: "data-1", VolumeSizeMiB: 100},
+		VolumeSizeBytes: 104 << 20,
+	}
+
+	status, err := manager.GetJobStatus("job")
+	require.NoError(t, err)
+	assert.Equal(t, int64(104<<20), status.VolumeSizeBytes)
+}
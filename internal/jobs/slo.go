@@ -0,0 +1,291 @@
+package jobs
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultSLOObjective is the fraction of jobs that must meet their target if the
+// SLO configuration sets none
+const defaultSLOObjective = 0.99
+
+// sloWindows are the windows burn rates are reported over. Outcomes are kept for the last.
+var sloWindows = []struct {
+	name   string
+	length time.Duration
+}{
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+}
+
+var (
+	sloJobsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "libvirt_volume_provisioner_slo_jobs_total",
+			Help: "Total number of completed jobs measured against a provisioning SLO target, by image size bucket",
+		},
+		[]string{"max_image_size"},
+	)
+	sloViolationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "libvirt_volume_provisioner_slo_violations_total",
+			Help: "Total number of completed jobs that took longer than their provisioning SLO target, by image size bucket",
+		},
+		[]string{"max_image_size"},
+	)
+	sloTargetDesc = prometheus.NewDesc(
+		"libvirt_volume_provisioner_slo_target_seconds",
+		"Provisioning duration SLO target, by image size bucket",
+		[]string{"max_image_size"}, nil,
+	)
+	sloBurnRateDesc = prometheus.NewDesc(
+		"libvirt_volume_provisioner_slo_burn_rate",
+		"Fraction of jobs missing their SLO target over a window, relative to the fraction the objective allows",
+		[]string{"max_image_size", "window"}, nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(sloJobsTotal, sloViolationsTotal)
+}
+
+// SLOTarget is the provisioning duration target of jobs whose image is at most
+// MaxImageSizeGB
+type SLOTarget struct {
+	// MaxImageSizeGB is the largest image the target applies to; zero applies it to
+	// images larger than those of every other target
+	MaxImageSizeGB float64 `json:"max_image_size_gb,omitempty"`
+	TargetSeconds  int     `json:"target_seconds"`
+}
+
+// bucket returns the image size bucket of the target, as reported in metrics
+func (t SLOTarget) bucket() string {
+	if t.MaxImageSizeGB == 0 {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(t.MaxImageSizeGB, 'f', -1, 64) + "GB"
+}
+
+// SLOConfig sets the provisioning duration targets of jobs by the size of their image
+type SLOConfig struct {
+	// Objective is the fraction of jobs that must meet their target
+	Objective float64     `json:"objective,omitempty"`
+	Targets   []SLOTarget `json:"targets"`
+}
+
+// validate checks an SLO configuration, sorting its targets by image size and
+// defaulting its objective
+func (c *SLOConfig) validate() error {
+	if c.Objective == 0 {
+		c.Objective = defaultSLOObjective
+	}
+	if c.Objective <= 0 || c.Objective >= 1 {
+		return fmt.Errorf("SLO objective must be between 0 and 1, exclusive")
+	}
+	if len(c.Targets) == 0 {
+		return fmt.Errorf("SLO configuration has no targets")
+	}
+
+	seen := make(map[float64]bool)
+	for _, target := range c.Targets {
+		if target.MaxImageSizeGB < 0 {
+			return fmt.Errorf("SLO target max_image_size_gb must not be negative")
+		}
+		if target.TargetSeconds <= 0 {
+			return fmt.Errorf("SLO target for %s images: target_seconds must be positive", target.bucket())
+		}
+		if seen[target.MaxImageSizeGB] {
+			return fmt.Errorf("duplicate SLO target for %s images", target.bucket())
+		}
+		seen[target.MaxImageSizeGB] = true
+	}
+
+	// Smallest images first, with the target for images of any size last
+	slices.SortFunc(c.Targets, func(a, b SLOTarget) int {
+		switch {
+		case a.MaxImageSizeGB == 0:
+			return 1
+		case b.MaxImageSizeGB == 0:
+			return -1
+		}
+		return cmp.Compare(a.MaxImageSizeGB, b.MaxImageSizeGB)
+	})
+	return nil
+}
+
+// LoadSLOConfig reads the provisioning SLO targets from a JSON file
+func LoadSLOConfig(path string) (SLOConfig, error) {
+	//nolint:gosec // File path is controlled by admin via environment variable
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SLOConfig{}, fmt.Errorf("failed to read SLO configuration: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var config SLOConfig
+	if err := decoder.Decode(&config); err != nil {
+		return SLOConfig{}, fmt.Errorf("failed to parse SLO configuration: %w", err)
+	}
+	if err := config.validate(); err != nil {
+		return SLOConfig{}, err
+	}
+	return config, nil
+}
+
+// sloOutcome records whether a job measured against an SLO target missed it
+type sloOutcome struct {
+	at       time.Time
+	violated bool
+}
+
+// sloTracker keeps the outcomes of recent jobs for burn rates
+type sloTracker struct {
+	config SLOConfig
+	mu     sync.Mutex
+	// outcomes holds the outcomes within the longest window by bucket, oldest first
+	outcomes map[string][]sloOutcome
+}
+
+// target returns the SLO target of a job whose image is sizeBytes, if one applies
+func (t *sloTracker) target(sizeBytes int64) (SLOTarget, bool) {
+	for _, target := range t.config.Targets {
+		if target.MaxImageSizeGB == 0 || float64(sizeBytes) <= target.MaxImageSizeGB*(1<<30) {
+			return target, true
+		}
+	}
+	return SLOTarget{}, false
+}
+
+// record adds the outcome of a job, forgetting outcomes older than the longest window
+func (t *sloTracker) record(bucket string, outcome sloOutcome) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := outcome.at.Add(-sloWindows[len(sloWindows)-1].length)
+	outcomes := t.outcomes[bucket]
+	for len(outcomes) > 0 && outcomes[0].at.Before(cutoff) {
+		outcomes = outcomes[1:]
+	}
+	t.outcomes[bucket] = append(outcomes, outcome)
+}
+
+// burnRate returns the fraction of jobs that missed a bucket's target in the window
+// before now, divided by the fraction the objective allows to miss it. A rate of 1
+// spends the error budget exactly; there is no rate without jobs in the window.
+func (t *sloTracker) burnRate(bucket string, window time.Duration, now time.Time) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var total, violated int
+	for _, outcome := range t.outcomes[bucket] {
+		if outcome.at.Before(now.Add(-window)) {
+			continue
+		}
+		total++
+		if outcome.violated {
+			violated++
+		}
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return float64(violated) / float64(total) / (1 - t.config.Objective), true
+}
+
+// SetSLO enables measuring the duration of completed jobs against the targets of config
+func (m *Manager) SetSLO(config SLOConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	m.slo = &sloTracker{config: config, outcomes: make(map[string][]sloOutcome)}
+	return nil
+}
+
+// evaluateSLO measures a completed job against the SLO target for the size of its
+// image. The duration runs from when the job started running, after waiting for its
+// dependencies, schedule and a provisioning window, to finished, less the time it was
+// paused. Jobs without an image, e.g. blank volumes, are not measured.
+func (m *Manager) evaluateSLO(job *Job, finished time.Time) {
+	if m.slo == nil || job.ImagePath == "" || job.startedAt.IsZero() {
+		return
+	}
+	info, err := os.Stat(job.ImagePath)
+	if err != nil {
+		logrus.WithError(err).WithField("job_id", job.ID).Debug("Not measuring job against SLO, image size unknown")
+		return
+	}
+	target, ok := m.slo.target(info.Size())
+	if !ok {
+		return
+	}
+
+	duration := finished.Sub(job.startedAt) - job.pausedTime(finished)
+	limit := time.Duration(target.TargetSeconds) * time.Second
+	job.SLO = &types.SLOResult{
+		MaxImageSize: target.bucket(),
+		TargetMs:     limit.Milliseconds(),
+		DurationMs:   duration.Milliseconds(),
+		Violated:     duration > limit,
+	}
+	m.slo.record(target.bucket(), sloOutcome{at: finished, violated: job.SLO.Violated})
+
+	sloJobsTotal.WithLabelValues(target.bucket()).Inc()
+	if job.SLO.Violated {
+		sloViolationsTotal.WithLabelValues(target.bucket()).Inc()
+		logrus.WithFields(logrus.Fields{
+			"job_id":         job.ID,
+			"max_image_size": target.bucket(),
+			"duration":       duration.Round(time.Second).String(),
+			"target":         limit.String(),
+			"cache_hit":      job.CacheHit,
+		}).Warn("Job missed its provisioning SLO target")
+	}
+}
+
+// SLOCollector exports the provisioning SLO targets and their burn rates as
+// Prometheus metrics. Burn rates are calculated on every scrape.
+type SLOCollector struct {
+	manager *Manager
+}
+
+// NewSLOCollector creates a collector for the manager's SLO targets
+func NewSLOCollector(manager *Manager) *SLOCollector {
+	return &SLOCollector{manager: manager}
+}
+
+// Describe implements prometheus.Collector
+func (c *SLOCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sloTargetDesc
+	ch <- sloBurnRateDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *SLOCollector) Collect(ch chan<- prometheus.Metric) {
+	tracker := c.manager.slo
+	if tracker == nil {
+		return
+	}
+	now := time.Now()
+	for _, target := range tracker.config.Targets {
+		bucket := target.bucket()
+		ch <- prometheus.MustNewConstMetric(sloTargetDesc, prometheus.GaugeValue, float64(target.TargetSeconds), bucket)
+		for _, window := range sloWindows {
+			if rate, ok := tracker.burnRate(bucket, window.length, now); ok {
+				ch <- prometheus.MustNewConstMetric(sloBurnRateDesc, prometheus.GaugeValue, rate, bucket, window.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSLOConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slo.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"targets":[
+		{"target_seconds":1800},
+		{"max_image_size_gb":20,"target_seconds":600},
+		{"max_image_size_gb":2.5,"target_seconds":120}
+	]}`), 0o600))
+	config, err := LoadSLOConfig(path)
+	require.NoError(t, err)
+	assert.InDelta(t, defaultSLOObjective, config.Objective, 0.0001)
+	buckets := make([]string, 0, len(config.Targets))
+	for _, target := range config.Targets {
+		buckets = append(buckets, target.bucket())
+	}
+	assert.Equal(t, []string{"2.5GB", "20GB", "+Inf"}, buckets)
+
+	for _, invalid := range []string{
+		`{"targets":[]}`,
+		`{"objective":1,"targets":[{"target_seconds":60}]}`,
+		`{"targets":[{"max_image_size_gb":2,"target_seconds":0}]}`,
+		`{"targets":[{"max_image_size_gb":-1,"target_seconds":60}]}`,
+		`{"targets":[{"max_image_size_gb":2,"target_seconds":60},{"max_image_size_gb":2,"target_seconds":90}]}`,
+		`{"targets":[{"target":"5m"}]}`,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(invalid), 0o600))
+		_, err := LoadSLOConfig(path)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestEvaluateSLO(t *testing.T) {
+	manager := &Manager{}
+	require.NoError(t, manager.SetSLO(SLOConfig{
+		Objective: 0.9,
+		Targets:   []SLOTarget{{MaxImageSizeGB: 1, TargetSeconds: 60}},
+	}))
+
+	imagePath := filepath.Join(t.TempDir(), "ubuntu.raw")
+	require.NoError(t, os.WriteFile(imagePath, []byte("image"), 0o600))
+	finished := time.Now()
+
+	fast := &Job{ID: "fast", ImagePath: imagePath, startedAt: finished.Add(-30 * time.Second)}
+	manager.evaluateSLO(fast, finished)
+	require.NotNil(t, fast.SLO)
+	assert.Equal(t, types.SLOResult{MaxImageSize: "1GB", TargetMs: 60000, DurationMs: 30000}, *fast.SLO)
+
+	// Time spent paused does not count
+	paused := &Job{ID: "paused", ImagePath: imagePath, startedAt: finished.Add(-90 * time.Second),
+		pausedTotal: time.Minute}
+	manager.evaluateSLO(paused, finished)
+	assert.False(t, paused.SLO.Violated)
+
+	slow := &Job{ID: "slow", ImagePath: imagePath, startedAt: finished.Add(-2 * time.Minute)}
+	manager.evaluateSLO(slow, finished)
+	assert.True(t, slow.SLO.Violated)
+
+	// Blank volumes are not measured
+	blank := &Job{ID: "blank", startedAt: finished.Add(-time.Hour)}
+	manager.evaluateSLO(blank, finished)
+	assert.Nil(t, blank.SLO)
+
+	// One job in three missed the target, where the objective allows one in ten
+	rate, ok := manager.slo.burnRate("1GB", time.Hour, finished)
+	require.True(t, ok)
+	assert.InDelta(t, 10.0/3, rate, 0.0001)
+	_, ok = manager.slo.burnRate("1GB", time.Hour, finished.Add(2*time.Hour))
+	assert.False(t, ok)
+}
+
+func TestSLOTrackerTarget(t *testing.T) {
+	manager := &Manager{}
+	require.NoError(t, manager.SetSLO(SLOConfig{Targets: []SLOTarget{
+		{MaxImageSizeGB: 20, TargetSeconds: 600},
+		{MaxImageSizeGB: 2, TargetSeconds: 120},
+	}}))
+
+	target, ok := manager.slo.target(2 << 30)
+	require.True(t, ok)
+	assert.Equal(t, "2GB", target.bucket())
+	target, ok = manager.slo.target(2<<30 + 1)
+	require.True(t, ok)
+	assert.Equal(t, "20GB", target.bucket())
+	// Without a target for any size, larger images are not measured
+	_, ok = manager.slo.target(21 << 30)
+	assert.False(t, ok)
+}
+
+func TestListJobsSLOViolated(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+	manager := &Manager{jobs: make(map[string]*Job), store: store}
+
+	for _, job := range []*Job{
+		{ID: "met", Status: types.StatusCompleted, SLO: &types.SLOResult{MaxImageSize: "2GB", TargetMs: 1000}},
+		{ID: "missed", Status: types.StatusCompleted,
+			SLO: &types.SLOResult{MaxImageSize: "2GB", TargetMs: 1000, DurationMs: 2000, Violated: true}},
+		{ID: "unmeasured", Status: types.StatusCompleted},
+	} {
+		job.CreatedAt, job.UpdatedAt = time.Now(), time.Now()
+		manager.syncToDatabase(context.Background(), job)
+	}
+
+	response, err := manager.ListJobs(types.JobListRequest{SLOViolated: true})
+	require.NoError(t, err)
+	require.Len(t, response.Jobs, 1)
+	assert.Equal(t, "missed", response.Jobs[0].JobID)
+	require.NotNil(t, response.Jobs[0].SLO)
+	assert.Equal(t, int64(2000), response.Jobs[0].SLO.DurationMs)
+
+	response, err = manager.ListJobs(types.JobListRequest{})
+	require.NoError(t, err)
+	assert.Len(t, response.Jobs, 3)
+}
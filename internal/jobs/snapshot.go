@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// snapshotVolumeStep snapshots an existing volume before it is overwritten, so a
+// failed write can be undone instead of leaving the volume half-written
+func (m *Manager) snapshotVolumeStep(_ context.Context, p *provision) error {
+	snapshot, err := m.lvmManager.CreateSnapshot(p.req.VolumeName)
+	if err != nil {
+		return types.NewError(types.ErrCodeSnapshotFailed,
+			fmt.Errorf("failed to snapshot existing volume: %w", err), commandDetails(err))
+	}
+	p.snapshot = snapshot
+
+	logrus.WithFields(logrus.Fields{
+		"job_id":      p.job.ID,
+		"volume_name": p.req.VolumeName,
+		"snapshot":    snapshot,
+	}).Info("Snapshotted existing volume")
+	return nil
+}
+
+// restoreSnapshotStep merges the snapshot back into a volume whose write failed,
+// restoring its previous contents
+func (m *Manager) restoreSnapshotStep(p *provision) error {
+	logrus.WithFields(logrus.Fields{
+		"job_id":      p.job.ID,
+		"volume_name": p.req.VolumeName,
+		"snapshot":    p.snapshot,
+	}).Warn("Rolling back: restoring volume from snapshot")
+
+	if err := m.lvmManager.MergeSnapshot(p.snapshot); err != nil {
+		return types.NewError(types.ErrCodeRollbackFailed,
+			fmt.Errorf("provision failed + restoring snapshot failed: %w", err), commandDetails(err))
+	}
+	p.snapshot = ""
+	return nil
+}
+
+// finalizeStep marks a volume complete and removes the snapshot of a successfully
+// overwritten volume. A snapshot left behind is only logged, as the volume itself
+// is complete.
+func (m *Manager) finalizeStep(_ context.Context, p *provision) error {
+	// A volume left tagged would be removed as incomplete at the next startup
+	if err := m.lvmManager.MarkComplete(p.req.VolumeName); err != nil {
+		return types.NewError(types.ErrCodeVolumePopulateFailed, err, commandDetails(err))
+	}
+	if p.snapshot == "" {
+		return nil
+	}
+
+	if err := m.lvmManager.DeleteVolume(p.snapshot); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"job_id":   p.job.ID,
+			"snapshot": p.snapshot,
+		}).Warn("Failed to remove snapshot of provisioned volume")
+		return nil
+	}
+	p.snapshot = ""
+	return nil
+}
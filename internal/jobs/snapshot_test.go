@@ -0,0 +1,20 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteVolumeStepKeepsSnapshottedVolume(t *testing.T) {
+	manager := &Manager{}
+	p := &provision{
+		job:      &Job{ID: "snapshot-job"},
+		req:      types.ProvisionRequest{VolumeName: "vm-disk", Snapshot: true},
+		existing: true,
+	}
+
+	// The existing volume is restored from its snapshot, not deleted
+	assert.NoError(t, manager.deleteVolumeStep(p))
+}
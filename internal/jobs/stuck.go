@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// maxStuckCheckInterval bounds how long a stuck job may go unnoticed after crossing the threshold
+const maxStuckCheckInterval = time.Minute
+
+var (
+	// stuckJobsGauge is the number of running jobs that made no progress for the stuck job threshold
+	stuckJobsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "libvirt_volume_provisioner_stuck_jobs",
+			Help: "Number of running jobs that have made no progress for the stuck job threshold",
+		},
+	)
+	// stuckJobsFailedTotal counts the stuck jobs that were failed by the stuck job detector
+	stuckJobsFailedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "libvirt_volume_provisioner_stuck_jobs_failed_total",
+			Help: "Total number of stuck jobs failed by the stuck job detector",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(stuckJobsGauge, stuckJobsFailedTotal)
+}
+
+// SetStuckJobDetection enables reporting running jobs whose progress has not been
+// updated for threshold, and failing them if failStuck is set. Zero disables it.
+func (m *Manager) SetStuckJobDetection(threshold time.Duration, failStuck bool) {
+	m.stuckThreshold = threshold
+	m.failStuckJobs = failStuck
+}
+
+// MonitorStuckJobs checks for stuck jobs until ctx is done. It returns at once if
+// stuck job detection is disabled.
+func (m *Manager) MonitorStuckJobs(ctx context.Context) {
+	if m.stuckThreshold <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(min(m.stuckThreshold/4, maxStuckCheckInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.checkStuckJobs(now)
+		}
+	}
+}
+
+// checkStuckJobs reports the running jobs whose progress has not been updated for the
+// threshold, failing them if configured. Paused jobs are not stuck, and pending jobs
+// are waiting for a provisioning window or a slot. Each job is logged once per
+// stall, and the IDs of the stuck jobs are returned.
+func (m *Manager) checkStuckJobs(now time.Time) []string {
+	m.mu.Lock()
+	var stuck []string
+	var failed []*Job
+	reported := make(map[string]time.Time)
+	for id, job := range m.jobs {
+		if job.Status != types.StatusRunning || job.Paused() {
+			continue
+		}
+		idle := now.Sub(job.UpdatedAt)
+		if idle < m.stuckThreshold {
+			continue
+		}
+		stuck = append(stuck, id)
+
+		stage := ""
+		if job.Progress != nil {
+			stage = job.Progress.Stage
+		}
+		if !m.failStuckJobs {
+			// The job stays stuck until its progress is updated
+			reported[id] = job.UpdatedAt
+			if m.stuckReported[id].Equal(job.UpdatedAt) {
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				"job_id":      id,
+				"volume_name": job.Request.VolumeName,
+				"stage":       stage,
+				"idle":        idle.Round(time.Second).String(),
+			}).Warn("Job stuck, no progress reported")
+			continue
+		}
+
+		// Cancelling the job rolls back its volume once the stalled step returns;
+		// if it never does, the volume is removed at the next startup
+		logrus.WithFields(logrus.Fields{
+			"job_id":      id,
+			"volume_name": job.Request.VolumeName,
+			"stage":       stage,
+			"idle":        idle.Round(time.Second).String(),
+		}).Error("Job stuck, failing it")
+		if job.cancelFunc != nil {
+			job.cancelFunc()
+		}
+		job.stateMu.Lock()
+		job.Status = types.StatusFailed
+		job.UpdatedAt = now
+		job.Error = types.NewError(types.ErrCodeJobStuck,
+			fmt.Errorf("job made no progress for %s in stage %q", idle.Round(time.Second), stage),
+			map[string]string{"stage": stage, "idle_seconds": strconv.Itoa(int(idle.Seconds()))})
+		job.stateMu.Unlock()
+		failed = append(failed, job)
+	}
+	m.stuckReported = reported
+	m.mu.Unlock()
+
+	stuckJobsGauge.Set(float64(len(stuck) - len(failed)))
+	for _, job := range failed {
+		stuckJobsFailedTotal.Inc()
+		m.syncToDatabase(context.Background(), job)
+	}
+	return stuck
+}
@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckStuckJobs(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	paused := &Job{ID: "paused", Status: types.StatusRunning, UpdatedAt: now.Add(-time.Hour)}
+	paused.pause()
+	manager := &Manager{
+		jobs: map[string]*Job{
+			"stuck": {
+				ID:        "stuck",
+				Status:    types.StatusRunning,
+				Progress:  &types.ProgressInfo{Stage: "converting"},
+				UpdatedAt: now.Add(-20 * time.Minute),
+			},
+			"progressing": {ID: "progressing", Status: types.StatusRunning, UpdatedAt: now.Add(-time.Minute)},
+			"pending":     {ID: "pending", Status: types.StatusPending, UpdatedAt: now.Add(-time.Hour)},
+			"paused":      paused,
+		},
+	}
+	manager.SetStuckJobDetection(15*time.Minute, false)
+
+	// Stuck jobs are only reported
+	assert.Equal(t, []string{"stuck"}, manager.checkStuckJobs(now))
+	assert.Equal(t, types.StatusRunning, manager.jobs["stuck"].Status)
+	assert.Contains(t, manager.stuckReported, "stuck")
+
+	// A job is no longer stuck once it reports progress
+	manager.jobs["stuck"].UpdatedAt = now
+	assert.Empty(t, manager.checkStuckJobs(now.Add(time.Minute)))
+	assert.Empty(t, manager.stuckReported)
+}
+
+func TestCheckStuckJobsFail(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stuck := &Job{
+		ID:         "stuck",
+		Status:     types.StatusRunning,
+		Progress:   &types.ProgressInfo{Stage: "creating_volume"},
+		UpdatedAt:  now.Add(-20 * time.Minute),
+		cancelFunc: cancel,
+	}
+	manager := &Manager{jobs: map[string]*Job{"stuck": stuck}}
+	manager.SetStuckJobDetection(15*time.Minute, true)
+
+	assert.Equal(t, []string{"stuck"}, manager.checkStuckJobs(now))
+	assert.Equal(t, types.StatusFailed, stuck.Status)
+	assert.Equal(t, now, stuck.UpdatedAt)
+	assert.Error(t, ctx.Err(), "the job's context is cancelled")
+
+	code, details := types.ErrorCodeOf(stuck.Error, "")
+	assert.Equal(t, types.ErrCodeJobStuck, code)
+	assert.Equal(t, "creating_volume", details["stage"])
+	assert.Equal(t, "1200", details["idle_seconds"])
+
+	// The failure recorded by the detector is kept when the job's step finally returns
+	manager.failJob(stuck, context.Canceled)
+	code, _ = types.ErrorCodeOf(stuck.Error, "")
+	assert.Equal(t, types.ErrCodeJobStuck, code)
+
+	// Failed jobs are not stuck
+	assert.Empty(t, manager.checkStuckJobs(now.Add(time.Hour)))
+}
+
+func TestMonitorStuckJobsDisabled(t *testing.T) {
+	manager := &Manager{}
+	done := make(chan struct{})
+	go func() {
+		manager.MonitorStuckJobs(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "MonitorStuckJobs should return when stuck job detection is disabled")
+	}
+}
@@ -0,0 +1,219 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// VerifyVolume starts a job checking the integrity of a volume, e.g. after a storage
+// incident. qcow2 overlays, and volumes images were written to as qcow2, are checked
+// with qemu-img check. Volumes populated from a raw image have the data written to
+// them hashed again and compared with the checksum recorded when they were
+// provisioned; other volumes have nothing to verify against.
+// The job takes a disk slot and reports its progress like a provisioning job.
+func (m *Manager) VerifyVolume(volumeName, identity string) (*types.VerifyVolumeResponse, error) {
+	if m.maintenance.Load() {
+		return nil, errMaintenance()
+	}
+	if err := m.checkReady(); err != nil {
+		return nil, err
+	}
+	if err := m.checkQueueDepth(); err != nil {
+		return nil, err
+	}
+	if err := validateVolumeName(volumeName); err != nil {
+		return nil, err
+	}
+	if jobID := m.activeJobForVolume(volumeName); jobID != "" {
+		return nil, types.NewError(types.ErrCodeVolumeInUse,
+			fmt.Errorf("volume %s has an unfinished job %s", volumeName, jobID), map[string]string{"job_id": jobID})
+	}
+
+	req := types.ProvisionRequest{VolumeName: volumeName, Identity: identity}
+	volumeGroup := ""
+	switch {
+	case m.overlays != nil && m.overlays.Exists(volumeName):
+		req.Overlay = true
+	case m.lvmManager != nil && m.lvmManager.VolumeExists(volumeName):
+		record, err := m.recordedWrite(volumeName)
+		if err != nil {
+			return nil, err
+		}
+		req.VolumeFormat = record.VolumeFormat
+		volumeGroup = m.lvmManager.VolumeGroup()
+	default:
+		return nil, volumeNotFound(volumeName)
+	}
+
+	// The job timeout starts once the job may run, see runJob
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		ID:               uuid.New().String(),
+		Status:           types.StatusPending,
+		Request:          req,
+		SubmittedRequest: req,
+		VolumeGroup:      volumeGroup,
+		Verification:     &types.VolumeVerification{VolumeName: volumeName, Method: verifyMethod(req)},
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+		cancelFunc:       cancel,
+		done:             make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+	m.enqueue(job)
+	m.syncToDatabase(ctx, job)
+
+	logrus.WithFields(logrus.Fields{
+		"job_id":      job.ID,
+		"volume_name": volumeName,
+		"method":      job.Verification.Method,
+		"identity":    identity,
+	}).Info("Verification job submitted")
+
+	go m.runJob(ctx, job)
+
+	return &types.VerifyVolumeResponse{JobID: job.ID, VolumeName: volumeName, Method: job.Verification.Method}, nil
+}
+
+// verifyMethod returns how the volume of a verification job is checked
+func verifyMethod(req types.ProvisionRequest) string {
+	if req.Overlay || req.VolumeFormat == lvm.FormatQcow2 {
+		return types.VerifyMethodQemuImgCheck
+	}
+	return types.VerifyMethodChecksum
+}
+
+// recordedWrite returns the latest record of a volume, which must have the checksum
+// of the data written to it, or have had it written as qcow2
+func (m *Manager) recordedWrite(volumeName string) (*storage.VolumeRecord, error) {
+	if m.store != nil {
+		records, err := m.store.ListVolumes(storage.ListVolumesFilter{
+			Name:        volumeName,
+			VolumeGroup: m.lvmManager.VolumeGroup(),
+			Limit:       1,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up volume record: %w", err)
+		}
+		if len(records) > 0 && ((records[0].WrittenChecksum != "" && records[0].WrittenBytes > 0) ||
+			records[0].VolumeFormat == lvm.FormatQcow2) {
+			return records[0], nil
+		}
+	}
+	return nil, types.NewError(types.ErrCodeVolumeNotVerifiable,
+		fmt.Errorf("volume %s has no recorded checksum to verify against; only volumes populated "+
+			"from raw images since checksums were recorded have one, and only volumes recorded as "+
+			"written in qcow2 can be checked with qemu-img", volumeName), nil)
+}
+
+// runVerification runs the steps of a verification job
+func (m *Manager) runVerification(ctx context.Context, job *Job) error {
+	job.Progress = &types.ProgressInfo{
+		Stage:   "initializing",
+		Percent: 0,
+	}
+
+	return m.runPipeline(ctx, job, m.verificationSteps(job.Request))
+}
+
+// verificationSteps returns the steps a verification job runs through
+func (m *Manager) verificationSteps(req types.ProvisionRequest) []step {
+	if req.Overlay {
+		return []step{
+			{name: "checking_overlay", percent: 5, slot: slotDisk, run: m.checkOverlayStep},
+			{name: "finalizing", percent: 100},
+		}
+	}
+	if req.VolumeFormat == lvm.FormatQcow2 {
+		return []step{
+			{name: "checking_volume", percent: 5, slot: slotDisk, run: m.checkVolumeStep},
+			{name: "finalizing", percent: 100},
+		}
+	}
+	return []step{
+		{name: "verifying", percent: 5, slot: slotDisk, run: m.hashVolumeStep},
+		{name: "finalizing", percent: 100},
+	}
+}
+
+// checkOverlayStep runs qemu-img check on an overlay. Corruptions, or parts of the
+// overlay that could not be checked, fail the job; leaked clusters are only reported.
+func (m *Manager) checkOverlayStep(ctx context.Context, p *provision) error {
+	if m.overlays == nil {
+		return types.NewError(types.ErrCodeNotSupported, fmt.Errorf("overlay volumes are not configured"), nil)
+	}
+	result, err := m.overlays.Check(ctx, p.req.VolumeName)
+	if err != nil {
+		return types.NewError(types.ErrCodeInternal, err, commandDetails(err))
+	}
+	return checkResult(p, result, "overlay")
+}
+
+// checkVolumeStep runs qemu-img check on a volume images were written to as qcow2,
+// failing the job like checkOverlayStep
+func (m *Manager) checkVolumeStep(ctx context.Context, p *provision) error {
+	result, err := m.lvmManager.CheckVolume(ctx, p.req.VolumeName)
+	if err != nil {
+		return types.NewError(types.ErrCodeInternal, err, commandDetails(err))
+	}
+	return checkResult(p, result, "volume")
+}
+
+// checkResult records what qemu-img check found in a verification job's qcow2
+// overlay or volume, failing the job on corruptions and check errors
+func checkResult(p *provision, result *lvm.CheckResult, kind string) error {
+	verification := p.job.Verification
+	verification.Corruptions = result.Corruptions
+	verification.Leaks = result.Leaks
+	verification.CheckErrors = result.CheckErrors
+	verified := result.Corruptions == 0 && result.CheckErrors == 0
+	verification.Verified = &verified
+	if !verified {
+		return types.NewError(types.ErrCodeVolumeCorrupt,
+			fmt.Errorf("qemu-img check found %d corruptions and %d check errors in %s %s",
+				result.Corruptions, result.CheckErrors, kind, p.req.VolumeName),
+			map[string]string{
+				"corruptions":  strconv.Itoa(result.Corruptions),
+				"check_errors": strconv.Itoa(result.CheckErrors),
+			})
+	}
+	return nil
+}
+
+// hashVolumeStep hashes the data written to a volume when it was provisioned, and
+// compares it with the checksum recorded then
+func (m *Manager) hashVolumeStep(ctx context.Context, p *provision) error {
+	record, err := m.recordedWrite(p.req.VolumeName)
+	if err != nil {
+		return err
+	}
+	verification := p.job.Verification
+	verification.ExpectedChecksum = record.WrittenChecksum
+	verification.VerifiedBytes = record.WrittenBytes
+
+	actual, err := m.lvmManager.HashVolume(ctx, p.req.VolumeName, record.WrittenBytes, p.job)
+	if err != nil {
+		return types.NewError(types.ErrCodeInternal, err, nil)
+	}
+	verification.ActualChecksum = actual
+	verified := actual == record.WrittenChecksum
+	verification.Verified = &verified
+	if !verified {
+		return types.NewError(types.ErrCodeVolumeChecksumMismatch,
+			fmt.Errorf("checksum %s of the first %d bytes of volume %s does not match checksum %s recorded by job %s",
+				actual, record.WrittenBytes, p.req.VolumeName, record.WrittenChecksum, record.JobID),
+			map[string]string{"expected": record.WrittenChecksum, "actual": actual})
+	}
+	return nil
+}
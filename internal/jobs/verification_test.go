@@ -0,0 +1,171 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/storage"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForJob waits for a job of the manager to finish
+func waitForJob(t *testing.T, manager *Manager, jobID string) *Job {
+	t.Helper()
+	manager.mu.RLock()
+	job := manager.jobs[jobID]
+	manager.mu.RUnlock()
+	require.NotNil(t, job)
+	select {
+	case <-job.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("job %s did not finish", jobID)
+	}
+	return job
+}
+
+func TestVerifyVolume(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	volumes := newFakeVolumeManager("legacy-root", "busy-root")
+	sum := sha256.Sum256(testImage)
+	volumes.written = hex.EncodeToString(sum[:])
+	manager, _ := newProvisionTestManagerWithStore(t, volumes, store)
+
+	// The checksum of the data written by a raw provision is recorded for verification
+	jobID, err := manager.StartJob(types.ProvisionRequest{
+		VolumeName: "web01-root", ImageURL: testImageURL, ImageType: "raw", VolumeSizeGB: 10,
+	})
+	require.NoError(t, err)
+	provisioned := waitForJob(t, manager, jobID)
+	require.NoError(t, provisioned.Error)
+	require.NoError(t, store.SaveVolume(context.Background(), &storage.VolumeRecord{
+		Name: "legacy-root", VolumeGroup: "data", SizeGB: 10, ImageURL: testImageURL,
+		JobID: "legacy-job", CreatedAt: time.Now(),
+	}))
+	manager.jobs["busy-job"] = &Job{
+		ID:      "busy-job",
+		Status:  types.StatusRunning,
+		Request: types.ProvisionRequest{VolumeName: "busy-root"},
+	}
+
+	resp, err := manager.VerifyVolume("web01-root", "token:abc")
+	require.NoError(t, err)
+	assert.Equal(t, types.VerifyMethodChecksum, resp.Method)
+	job := waitForJob(t, manager, resp.JobID)
+	require.NoError(t, job.Error)
+	assert.Equal(t, types.StatusCompleted, job.Status)
+
+	status, err := manager.GetJobStatus(resp.JobID)
+	require.NoError(t, err)
+	require.NotNil(t, status.Verification)
+	require.NotNil(t, status.Verification.Verified)
+	assert.True(t, *status.Verification.Verified)
+	assert.Equal(t, int64(len(testImage)), status.Verification.VerifiedBytes)
+	assert.Equal(t, volumes.written, status.Verification.ActualChecksum)
+	assert.Equal(t, "token:abc", status.Identity)
+	assert.Contains(t, volumes.Calls(), "HashVolume web01-root")
+
+	// Verification jobs are recorded as such, to be resumed as verifications
+	record, err := store.GetJob(resp.JobID)
+	require.NoError(t, err)
+	var effective types.EffectiveRequest
+	require.NoError(t, json.Unmarshal([]byte(record.EffectiveRequestJSON), &effective))
+	assert.True(t, effective.Verify)
+	resumed, err := jobFromRecord(record)
+	require.NoError(t, err)
+	require.NotNil(t, resumed.Verification)
+	assert.Equal(t, types.VerifyMethodChecksum, resumed.Verification.Method)
+
+	// Data that changed since it was written fails the job
+	volumes.mu.Lock()
+	volumes.written = "bbbb"
+	volumes.mu.Unlock()
+	resp, err = manager.VerifyVolume("web01-root", "")
+	require.NoError(t, err)
+	job = waitForJob(t, manager, resp.JobID)
+	assert.Equal(t, types.StatusFailed, job.Status)
+	code, details := types.ErrorCodeOf(job.Error, types.ErrCodeInternal)
+	assert.Equal(t, types.ErrCodeVolumeChecksumMismatch, code)
+	assert.Equal(t, hex.EncodeToString(sum[:]), details["expected"])
+	assert.Equal(t, "bbbb", details["actual"])
+	assert.False(t, *job.Verification.Verified)
+
+	tests := []struct {
+		volume string
+		code   types.ErrorCode
+	}{
+		{"missing-root", types.ErrCodeVolumeNotFound},
+		{"legacy-root", types.ErrCodeVolumeNotVerifiable},
+		{"busy-root", types.ErrCodeVolumeInUse},
+		{"../root", types.ErrCodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		_, err := manager.VerifyVolume(tt.volume, "")
+		code, _ := types.ErrorCodeOf(err, types.ErrCodeInternal)
+		assert.Equal(t, tt.code, code, tt.volume)
+	}
+}
+
+// TestVerifyVolume_Qcow2 tests that volumes images were written to as qcow2 are
+// checked with qemu-img check, having no written checksum
+func TestVerifyVolume_Qcow2(t *testing.T) {
+	store, err := storage.NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	volumes := newFakeVolumeManager()
+	manager, _ := newProvisionTestManagerWithStore(t, volumes, store)
+
+	jobID, err := manager.StartJob(types.ProvisionRequest{
+		VolumeName: "web01-root", ImageURL: testImageURL, ImageType: "raw", VolumeSizeGB: 10,
+		VolumeFormat: "qcow2",
+	})
+	require.NoError(t, err)
+	require.NoError(t, waitForJob(t, manager, jobID).Error)
+
+	resp, err := manager.VerifyVolume("web01-root", "")
+	require.NoError(t, err)
+	assert.Equal(t, types.VerifyMethodQemuImgCheck, resp.Method)
+	job := waitForJob(t, manager, resp.JobID)
+	require.NoError(t, job.Error)
+	require.NotNil(t, job.Verification.Verified)
+	assert.True(t, *job.Verification.Verified)
+	assert.Contains(t, volumes.Calls(), "CheckVolume web01-root")
+	assert.NotContains(t, volumes.Calls(), "HashVolume web01-root")
+
+	// Resumed verifications are checked the same way
+	record, err := store.GetJob(resp.JobID)
+	require.NoError(t, err)
+	resumed, err := jobFromRecord(record)
+	require.NoError(t, err)
+	assert.Equal(t, types.VerifyMethodQemuImgCheck, resumed.Verification.Method)
+
+	// Corruptions fail the job; leaks are only reported
+	volumes.mu.Lock()
+	volumes.check = lvm.CheckResult{Corruptions: 2, Leaks: 1}
+	volumes.mu.Unlock()
+	resp, err = manager.VerifyVolume("web01-root", "")
+	require.NoError(t, err)
+	job = waitForJob(t, manager, resp.JobID)
+	code, details := types.ErrorCodeOf(job.Error, types.ErrCodeInternal)
+	assert.Equal(t, types.ErrCodeVolumeCorrupt, code)
+	assert.Equal(t, "2", details["corruptions"])
+	assert.Equal(t, 1, job.Verification.Leaks)
+	assert.False(t, *job.Verification.Verified)
+}
+
+func TestVerifyVolume_NoDatabase(t *testing.T) {
+	manager := NewManager(&fakeImageStore{}, newFakeVolumeManager("web01-root"), nil, nil)
+	_, err := manager.VerifyVolume("web01-root", "")
+	code, _ := types.ErrorCodeOf(err, types.ErrCodeInternal)
+	assert.Equal(t, types.ErrCodeVolumeNotVerifiable, code)
+}
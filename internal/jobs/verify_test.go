@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyWrite(t *testing.T) {
+	cacheDir := t.TempDir()
+	imageCache, err := cache.NewDirectoryCache("images", cacheDir)
+	require.NoError(t, err)
+	imagePath := filepath.Join(cacheDir, "images", "disk.raw")
+	require.NoError(t, os.MkdirAll(filepath.Dir(imagePath), 0o750))
+	require.NoError(t, os.WriteFile(imagePath, []byte("image"), 0o600))
+
+	manager := &Manager{jobs: make(map[string]*Job), imageCache: imageCache}
+
+	// Without an image checksum, the checksum is only recorded
+	p := &provision{job: &Job{ID: "unverified"}, imagePath: imagePath}
+	require.NoError(t, manager.verifyWrite(context.Background(), p, "aaaa"))
+	assert.Equal(t, "aaaa", p.job.WrittenChecksum)
+	assert.Equal(t, int64(len("image")), p.job.WrittenBytes)
+	assert.Nil(t, p.job.WriteVerified)
+
+	p = &provision{job: &Job{ID: "verified", ImageChecksum: "aaaa"}, imagePath: imagePath}
+	require.NoError(t, manager.verifyWrite(context.Background(), p, "aaaa"))
+	require.NotNil(t, p.job.WriteVerified)
+	assert.True(t, *p.job.WriteVerified)
+
+	// A mismatch fails the job and evicts the corrupt cached image
+	p = &provision{job: &Job{ID: "mismatch", ImageChecksum: "bbbb"}, imagePath: imagePath}
+	err = manager.verifyWrite(context.Background(), p, "aaaa")
+	code, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, types.ErrCodeVolumeChecksumMismatch, code)
+	assert.Equal(t, "bbbb", details["expected"])
+	assert.False(t, *p.job.WriteVerified)
+	assert.NoFileExists(t, imagePath)
+}
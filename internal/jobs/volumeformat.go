@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"fmt"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// volumeFormat returns the format a request's image is converted to on its volume:
+// the requested format, or else the volume backend's, which applies to every job of
+// the deployment. Only image volumes written to LVM are converted, and Windows
+// partitions are only expanded on raw volumes.
+func (m *Manager) volumeFormat(req types.ProvisionRequest) (string, error) {
+	expands := req.Windows != nil && req.Windows.ExpandPartition != ""
+	switch {
+	case req.VolumeFormat == "":
+	case !req.NeedsImage() || req.Overlay:
+		return "", types.NewError(types.ErrCodeInvalidRequest,
+			fmt.Errorf("volume_format only applies to image volumes written to LVM"),
+			map[string]string{"volume_format": "excluded"})
+	case lvm.ValidateVolumeFormat(req.VolumeFormat) != nil:
+		return "", types.NewError(types.ErrCodeInvalidRequest, lvm.ValidateVolumeFormat(req.VolumeFormat),
+			map[string]string{"volume_format": "oneof=raw qcow2"})
+	case expands && req.VolumeFormat != lvm.FormatRaw:
+		return "", types.NewError(types.ErrCodeInvalidRequest,
+			fmt.Errorf("windows partitions can only be expanded on raw volumes"),
+			map[string]string{"volume_format": "invalid"})
+	default:
+		return req.VolumeFormat, nil
+	}
+
+	switch {
+	case !req.NeedsImage() || req.Overlay || m.lvmManager == nil:
+		return "", nil
+	case expands:
+		return lvm.FormatRaw, nil
+	default:
+		return m.lvmManager.VolumeFormat(), nil
+	}
+}
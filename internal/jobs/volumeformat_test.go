@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVolumeFormat(t *testing.T) {
+	volumes := newFakeVolumeManager()
+	volumes.format = "qcow2"
+	manager := &Manager{lvmManager: volumes}
+
+	image := types.ProvisionRequest{ImageURL: "https://minio/images/a.qcow2", VolumeSizeGB: 10}
+	format, err := manager.volumeFormat(image)
+	require.NoError(t, err)
+	assert.Equal(t, "qcow2", format, "the backend's format by default")
+
+	image.VolumeFormat = "raw"
+	format, err = manager.volumeFormat(image)
+	require.NoError(t, err)
+	assert.Equal(t, "raw", format)
+
+	image.VolumeFormat = "vmdk"
+	_, err = manager.volumeFormat(image)
+	_, details := types.ErrorCodeOf(err, "")
+	assert.Equal(t, "oneof=raw qcow2", details["volume_format"])
+
+	// Expanded Windows partitions need a raw volume
+	image.VolumeFormat = ""
+	image.Windows = &types.WindowsOptions{ExpandPartition: "/dev/sda3"}
+	format, err = manager.volumeFormat(image)
+	require.NoError(t, err)
+	assert.Equal(t, "raw", format)
+	image.VolumeFormat = "qcow2"
+	_, err = manager.volumeFormat(image)
+	assert.Error(t, err)
+
+	overlay := types.ProvisionRequest{ImageURL: "https://minio/images/a.qcow2", Overlay: true}
+	format, err = manager.volumeFormat(overlay)
+	require.NoError(t, err)
+	assert.Empty(t, format)
+	overlay.VolumeFormat = "qcow2"
+	_, err = manager.volumeFormat(overlay)
+	_, details = types.ErrorCodeOf(err, "")
+	assert.Equal(t, "excluded", details["volume_format"])
+
+	blank := types.ProvisionRequest{VolumeName: "data-1", VolumeSizeGB: 10, Type: types.VolumeTypeBlank,
+		VolumeFormat: "raw"}
+	_, err = manager.volumeFormat(blank)
+	assert.Error(t, err)
+}
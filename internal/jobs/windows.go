@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/lvm"
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// validateWindows checks the Windows options of a request, which only apply to
+// image volumes written to LVM
+func validateWindows(req types.ProvisionRequest) error {
+	if req.Windows == nil {
+		return nil
+	}
+	if !req.NeedsImage() || req.Overlay {
+		return types.NewError(types.ErrCodeInvalidRequest,
+			fmt.Errorf("windows options only apply to image volumes written to LVM"),
+			map[string]string{"windows": "excluded"})
+	}
+	if req.Windows.ExpandPartition != "" {
+		if err := lvm.ValidatePartition(req.Windows.ExpandPartition); err != nil {
+			return types.NewError(types.ErrCodeInvalidRequest, err,
+				map[string]string{"windows.expand_partition": "invalid"})
+		}
+	}
+	return nil
+}
+
+// checkDriversStep fails if a Windows image lacks the drivers to boot from a virtio disk
+func (m *Manager) checkDriversStep(_ context.Context, p *provision) error {
+	drivers, err := lvm.VirtioDrivers(p.imagePath, p.imageFormat())
+	if err != nil {
+		return types.NewError(types.ErrCodeVirtioDriversMissing, err, commandDetails(err))
+	}
+	if len(drivers) == 0 {
+		return types.NewError(types.ErrCodeVirtioDriversMissing,
+			fmt.Errorf("image has no virtio storage driver (viostor.sys or vioscsi.sys)"), nil)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"job_id":  p.job.ID,
+		"drivers": strings.Join(drivers, ","),
+	}).Info("Found virtio storage drivers in Windows image")
+	return nil
+}
+
+// checkAlignmentStep fails if the volume does not start on a 1 MiB boundary, which
+// Windows needs for its partitions to be aligned on the underlying storage
+func (m *Manager) checkAlignmentStep(_ context.Context, _ *provision) error {
+	if err := m.lvmManager.CheckAlignment(); err != nil {
+		return types.NewError(types.ErrCodeVolumeMisaligned, err, commandDetails(err))
+	}
+	return nil
+}
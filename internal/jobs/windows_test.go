@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateWindows(t *testing.T) {
+	req := types.ProvisionRequest{ImageURL: "https://minio/images/win2022.qcow2", VolumeSizeGB: 80}
+	assert.NoError(t, validateWindows(req))
+
+	req.Windows = &types.WindowsOptions{ExpandPartition: "/dev/sda3", RequireVirtio: true}
+	assert.NoError(t, validateWindows(req))
+
+	req.Windows.ExpandPartition = "C:"
+	code, details := types.ErrorCodeOf(validateWindows(req), "")
+	assert.Equal(t, types.ErrCodeInvalidRequest, code)
+	assert.Equal(t, "invalid", details["windows.expand_partition"])
+
+	req.Windows.ExpandPartition = ""
+	req.Overlay = true
+	assert.Error(t, validateWindows(req))
+
+	blank := types.ProvisionRequest{Type: types.VolumeTypeBlank, Windows: &types.WindowsOptions{}}
+	assert.Error(t, validateWindows(blank))
+}
@@ -0,0 +1,117 @@
+package libvirt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// domainXMLDesc is the subset of libvirt domain XML used by the provisioner
+type domainXMLDesc struct {
+	Disks []struct {
+		Source struct {
+			Dev  string `xml:"dev,attr"`
+			File string `xml:"file,attr"`
+		} `xml:"source"`
+	} `xml:"devices>disk"`
+}
+
+// parseDomainDisks returns the block devices and files a domain's disks refer to
+func parseDomainDisks(xmlDesc string) ([]string, error) {
+	var desc domainXMLDesc
+	if err := xml.Unmarshal([]byte(xmlDesc), &desc); err != nil {
+		return nil, fmt.Errorf("failed to parse domain XML: %w", err)
+	}
+
+	var paths []string
+	for _, disk := range desc.Disks {
+		for _, path := range []string{disk.Source.Dev, disk.Source.File} {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// samePath reports whether two paths refer to the same file, following symlinks
+// such as /dev/<vg>/<lv> and /dev/mapper/<vg>-<lv>, which both point at /dev/dm-N
+func samePath(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	resolvedA, errA := filepath.EvalSymlinks(a)
+	resolvedB, errB := filepath.EvalSymlinks(b)
+	return errA == nil && errB == nil && resolvedA == resolvedB
+}
+
+// DomainsUsingDevice returns the defined and running domains with a disk backed by devicePath
+func (pm *PoolManager) DomainsUsingDevice(devicePath string) ([]types.AttachedDomain, error) {
+	disks, err := pm.DomainDisks()
+	if err != nil {
+		return nil, err
+	}
+
+	var attached []types.AttachedDomain
+	for _, disk := range disks {
+		// A domain is listed once, however many of its disks use the device
+		if !samePath(disk.Path, devicePath) ||
+			slices.ContainsFunc(attached, func(d types.AttachedDomain) bool { return d.Name == disk.Domain }) {
+			continue
+		}
+		attached = append(attached, types.AttachedDomain{Name: disk.Domain, Running: disk.Running})
+	}
+	return attached, nil
+}
+
+// DomainDisks returns the block devices and files backing the disks of the defined and
+// running domains
+func (pm *PoolManager) DomainDisks() ([]types.DomainDisk, error) {
+	conn, err := pm.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	domains, err := conn.ListAllDomains(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+	defer func() {
+		for i := range domains {
+			_ = domains[i].Free() // Ignore free errors
+		}
+	}()
+
+	var disks []types.DomainDisk
+	for i := range domains {
+		domain := &domains[i]
+		xmlDesc, err := domain.GetXMLDesc(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get domain XML: %w", err)
+		}
+		paths, err := parseDomainDisks(xmlDesc)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			continue
+		}
+
+		name, err := domain.GetName()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get domain name: %w", err)
+		}
+		running, err := domain.IsActive()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get domain state: %w", err)
+		}
+		for _, path := range paths {
+			disks = append(disks, types.DomainDisk{Domain: name, Running: running, Path: path})
+		}
+	}
+	return disks, nil
+}
@@ -0,0 +1,45 @@
+package libvirt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDomainDisks(t *testing.T) {
+	xmlDesc := `<domain type="kvm">
+  <name>web01</name>
+  <devices>
+    <disk type="block" device="disk">
+      <source dev="/dev/data/web01-root"/>
+      <target dev="vda" bus="virtio"/>
+    </disk>
+    <disk type="file" device="cdrom">
+      <source file="/var/lib/libvirt/images/seed.iso"/>
+    </disk>
+    <disk type="file" device="cdrom"/>
+    <interface type="bridge"/>
+  </devices>
+</domain>`
+
+	paths, err := parseDomainDisks(xmlDesc)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/dev/data/web01-root", "/var/lib/libvirt/images/seed.iso"}, paths)
+
+	_, err = parseDomainDisks("not xml")
+	assert.Error(t, err)
+}
+
+func TestSamePath(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dm-3")
+	link := filepath.Join(dir, "web01-root")
+	assert.NoError(t, os.WriteFile(target, nil, 0o600))
+	assert.NoError(t, os.Symlink(target, link))
+
+	assert.True(t, samePath("/dev/data/web01-root/", "/dev/data/web01-root"))
+	assert.True(t, samePath(link, target))
+	assert.False(t, samePath(link, filepath.Join(dir, "dm-4")))
+}
@@ -3,56 +3,230 @@
 package libvirt
 
 import (
-	"crypto/sha256"
+	"context"
+	"encoding/xml"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/libvirt/libvirt-go"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/retry"
 	"github.com/sirupsen/logrus"
 )
 
-// ImageCache represents a cached image in the libvirt storage pool
-type ImageCache struct {
-	Path     string
-	Size     uint64
-	Checksum string
+// PoolManager handles libvirt storage pool operations for image caching.
+// Cache pools are backed by libvirt directory pools; cache operations are
+// provided by the embedded DirectoryCache.
+type PoolManager struct {
+	*cache.DirectoryCache
+	conn        *libvirt.Connect
+	uri         string
+	retryConfig retry.Config
+	connMu      sync.Mutex
 }
 
-// PoolManager handles libvirt storage pool operations for image caching
-type PoolManager struct {
-	conn     *libvirt.Connect
-	poolName string
-	poolPath string
+const (
+	// defaultURI is the libvirt connection URI
+	defaultURI = "qemu:///system"
+
+	// Keep-alive settings: probe every 5 seconds, drop the connection after 3 missed responses
+	keepAliveInterval = 5
+	keepAliveCount    = 3
+)
+
+var eventLoopOnce sync.Once
+
+// startEventLoop registers and runs the default libvirt event loop, which is
+// required for connection keep-alive messages to be processed
+func startEventLoop() {
+	eventLoopOnce.Do(func() {
+		if err := libvirt.EventRegisterDefaultImpl(); err != nil {
+			logrus.WithError(err).Warn("Failed to register libvirt event loop, keep-alive disabled")
+			return
+		}
+		go func() {
+			for {
+				if err := libvirt.EventRunDefaultImpl(); err != nil {
+					logrus.WithError(err).Warn("Libvirt event loop iteration failed")
+					time.Sleep(time.Second)
+				}
+			}
+		}()
+	})
 }
 
-// NewPoolManager creates a new libvirt pool manager
-func NewPoolManager(poolName string) (*PoolManager, error) {
+// NewPoolManager creates a new libvirt pool manager.
+// poolSpec is a comma-separated list of pool names, each optionally suffixed
+// with ":<max_gb>" to limit the cache size (e.g. "images,fast-images:200").
+// The first pool listed is used when a request does not select one.
+// New pools are created as subdirectories of cacheDir (cache.DefaultCacheDir if empty).
+func NewPoolManager(poolSpec, cacheDir string) (*PoolManager, error) {
+	directoryCache, err := cache.NewDirectoryCache(poolSpec, cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	startEventLoop()
+
 	// Connect to libvirt
-	conn, err := libvirt.NewConnect("qemu:///system")
+	conn, err := openConnection(defaultURI)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+		return nil, err
 	}
 
 	pm := &PoolManager{
-		conn:     conn,
-		poolName: poolName,
-		poolPath: fmt.Sprintf("/var/lib/libvirt/%s", poolName),
+		DirectoryCache: directoryCache,
+		conn:           conn,
+		uri:            defaultURI,
+		retryConfig: parseLibvirtRetryConfig(
+			os.Getenv("LIBVIRT_RETRY_ATTEMPTS"),
+			os.Getenv("LIBVIRT_RETRY_BACKOFF_MS"),
+		),
 	}
 
-	// Ensure the pool exists and is active
-	if err := pm.ensurePool(); err != nil {
-		_, _ = conn.Close() // Ignore close error
-		return nil, fmt.Errorf("failed to ensure pool exists: %w", err)
+	// Make images added to or removed from the cache visible to other libvirt consumers
+	directoryCache.OnChange = pm.refreshPool
+
+	for _, pool := range directoryCache.Pools() {
+		// Ensure the pool exists and is active
+		if err := pm.ensurePool(pool); err != nil {
+			_, _ = conn.Close() // Ignore close error
+			return nil, fmt.Errorf("failed to ensure pool %s exists: %w", pool.Name, err)
+		}
 	}
 
 	return pm, nil
 }
 
+// openConnection opens a libvirt connection with keep-alive enabled
+func openConnection(uri string) (*libvirt.Connect, error) {
+	conn, err := libvirt.NewConnect(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+
+	if err := conn.SetKeepAlive(keepAliveInterval, keepAliveCount); err != nil {
+		logrus.WithError(err).Warn("Failed to enable libvirt connection keep-alive")
+	}
+
+	return conn, nil
+}
+
+// parseLibvirtRetryConfig parses reconnect retry configuration from environment variables
+func parseLibvirtRetryConfig(attemptsStr, backoffStr string) retry.Config {
+	// Default values: libvirtd restarts typically take a few seconds
+	maxAttempts := 5
+	delays := []time.Duration{500 * time.Millisecond, 1 * time.Second, 2 * time.Second, 5 * time.Second}
+
+	// Parse max attempts
+	if attemptsStr != "" {
+		if attempts, err := strconv.Atoi(attemptsStr); err == nil && attempts > 0 {
+			maxAttempts = attempts
+		}
+	}
+
+	// Parse backoff delays
+	if backoffStr != "" {
+		var parsedDelays []time.Duration
+		for _, delayStr := range strings.Split(backoffStr, ",") {
+			if ms, err := strconv.Atoi(strings.TrimSpace(delayStr)); err == nil && ms > 0 {
+				parsedDelays = append(parsedDelays, time.Duration(ms)*time.Millisecond)
+			}
+		}
+		if len(parsedDelays) > 0 {
+			delays = parsedDelays
+		}
+	}
+
+	return retry.Config{
+		MaxAttempts: maxAttempts,
+		Delays:      delays,
+	}
+}
+
+// connection returns a live libvirt connection, reconnecting with backoff if the
+// current connection has been lost (e.g. because libvirtd restarted)
+func (pm *PoolManager) connection() (*libvirt.Connect, error) {
+	pm.connMu.Lock()
+	defer pm.connMu.Unlock()
+
+	if pm.uri == "" {
+		return nil, fmt.Errorf("libvirt connection not configured")
+	}
+
+	if pm.conn != nil {
+		alive, err := pm.conn.IsAlive()
+		if err == nil && alive {
+			return pm.conn, nil
+		}
+		logrus.WithError(err).Warn("Libvirt connection lost, reconnecting")
+		_, _ = pm.conn.Close() // Ignore close error on a dead connection
+		pm.conn = nil
+	}
+
+	cfg := pm.retryConfig
+	cfg.OnRetry = func(attempt int, err error, delay time.Duration) {
+		logrus.WithError(err).WithFields(logrus.Fields{"attempt": attempt, "delay": delay}).Warn("Libvirt reconnect failed, retrying")
+	}
+
+	var conn *libvirt.Connect
+	err := retry.WithRetry(context.Background(), cfg, func() error {
+		var connErr error
+		conn, connErr = openConnection(pm.uri)
+		return connErr
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconnect to libvirt: %w", err)
+	}
+
+	pm.conn = conn
+	logrus.WithField("uri", pm.uri).Info("Reconnected to libvirt")
+	return pm.conn, nil
+}
+
+// StartHealthCheck periodically verifies the libvirt connection and reconnects
+// when it has been lost, until ctx is cancelled
+func (pm *PoolManager) StartHealthCheck(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := pm.connection(); err != nil {
+					logrus.WithError(err).Error("Libvirt connection health check failed")
+				}
+			}
+		}
+	}()
+}
+
+// CheckConnection reports the version of the libvirt daemon, failing if it cannot be reached
+func (pm *PoolManager) CheckConnection(_ context.Context) (string, error) {
+	conn, err := pm.connection()
+	if err != nil {
+		return "", err
+	}
+	version, err := conn.GetLibVersion()
+	if err != nil {
+		return "", fmt.Errorf("failed to get libvirt version: %w", err)
+	}
+	return fmt.Sprintf("libvirt %d.%d.%d at %s", version/1000000, version/1000%1000, version%1000, pm.uri), nil
+}
+
 // Close closes the libvirt connection
 func (pm *PoolManager) Close() error {
+	pm.connMu.Lock()
+	defer pm.connMu.Unlock()
+
 	if pm.conn != nil {
 		_, err := pm.conn.Close()
 		if err != nil {
@@ -63,8 +237,13 @@ func (pm *PoolManager) Close() error {
 }
 
 // ensurePool ensures the storage pool exists and is active
-func (pm *PoolManager) ensurePool() error {
-	pool, err := pm.conn.LookupStoragePoolByName(pm.poolName)
+func (pm *PoolManager) ensurePool(cachePool *cache.Pool) error {
+	conn, err := pm.connection()
+	if err != nil {
+		return err
+	}
+
+	pool, err := conn.LookupStoragePoolByName(cachePool.Name)
 	if err != nil {
 		// Pool doesn't exist, create it
 		poolXML := fmt.Sprintf(`
@@ -73,12 +252,34 @@ func (pm *PoolManager) ensurePool() error {
   <target>
     <path>%s</path>
   </target>
-</pool>`, pm.poolName, pm.poolPath)
+</pool>`, cachePool.Name, cachePool.Path)
 
-		pool, err = pm.conn.StoragePoolDefineXML(poolXML, 0)
+		pool, err = conn.StoragePoolDefineXML(poolXML, 0)
 		if err != nil {
 			return fmt.Errorf("failed to define storage pool: %w", err)
 		}
+	} else {
+		// Pool already exists; use its configured target rather than the assumed path
+		xmlDesc, err := pool.GetXMLDesc(0)
+		if err != nil {
+			_ = pool.Free() // Ignore error
+			return fmt.Errorf("failed to get storage pool XML: %w", err)
+		}
+
+		targetPath, err := parsePoolTargetPath(xmlDesc)
+		if err != nil {
+			_ = pool.Free() // Ignore error
+			return err
+		}
+
+		if targetPath != cachePool.Path {
+			logrus.WithFields(logrus.Fields{
+				"pool":         cachePool.Name,
+				"assumed_path": cachePool.Path,
+				"target_path":  targetPath,
+			}).Info("Using existing storage pool target path")
+			cachePool.Path = targetPath
+		}
 	}
 
 	// Ensure pool is active
@@ -100,10 +301,66 @@ func (pm *PoolManager) ensurePool() error {
 	return nil
 }
 
+// poolXMLDesc is the subset of libvirt storage pool XML used by the provisioner
+type poolXMLDesc struct {
+	Target struct {
+		Path string `xml:"path"`
+	} `xml:"target"`
+}
+
+// parsePoolTargetPath extracts the target directory from a storage pool XML description
+func parsePoolTargetPath(xmlDesc string) (string, error) {
+	var desc poolXMLDesc
+	if err := xml.Unmarshal([]byte(xmlDesc), &desc); err != nil {
+		return "", fmt.Errorf("failed to parse storage pool XML: %w", err)
+	}
+
+	targetPath := strings.TrimSpace(desc.Target.Path)
+	if targetPath == "" {
+		return "", fmt.Errorf("storage pool XML has no target path")
+	}
+	if !filepath.IsAbs(targetPath) {
+		return "", fmt.Errorf("storage pool target path is not absolute: %s", targetPath)
+	}
+
+	return filepath.Clean(targetPath), nil
+}
+
+// refreshPool asks libvirt to rescan a pool so that files written to or removed from
+// the pool directory are reflected in its volume list (e.g. virsh vol-list).
+// Refresh failures are logged but not returned, as the cache itself remains consistent.
+func (pm *PoolManager) refreshPool(cachePool *cache.Pool) {
+	if pm.uri == "" {
+		return
+	}
+
+	conn, err := pm.connection()
+	if err != nil {
+		logrus.WithError(err).WithField("pool", cachePool.Name).Warn("Failed to refresh storage pool")
+		return
+	}
+
+	pool, err := conn.LookupStoragePoolByName(cachePool.Name)
+	if err != nil {
+		logrus.WithError(err).WithField("pool", cachePool.Name).Warn("Failed to lookup pool for refresh")
+		return
+	}
+	defer func() { _ = pool.Free() }()
+
+	if err := pool.Refresh(0); err != nil {
+		logrus.WithError(err).WithField("pool", cachePool.Name).Warn("Failed to refresh storage pool")
+	}
+}
+
 // AllocateImage allocates space for an image in the libvirt storage pool
 // DEPRECATED: Use AllocateImageFile instead for better compression handling
 func (pm *PoolManager) AllocateImage(imageName string, sizeBytes uint64) (string, error) {
-	pool, err := pm.conn.LookupStoragePoolByName(pm.poolName)
+	conn, err := pm.connection()
+	if err != nil {
+		return "", err
+	}
+
+	pool, err := conn.LookupStoragePoolByName(pm.Pools()[0].Name)
 	if err != nil {
 		return "", fmt.Errorf("failed to lookup pool: %w", err)
 	}
@@ -134,132 +391,3 @@ func (pm *PoolManager) AllocateImage(imageName string, sizeBytes uint64) (string
 
 	return volPath, nil
 }
-
-// AllocateImageFile allocates a file path for caching an image without creating a libvirt volume.
-// This preserves compression in QCOW2 images by storing them as plain files instead of RAW volumes.
-func (pm *PoolManager) AllocateImageFile(imageName string) (string, error) {
-	// Ensure cache directory exists
-	if err := os.MkdirAll(pm.poolPath, 0o750); err != nil {
-		return "", fmt.Errorf("failed to create cache directory: %w", err)
-	}
-
-	// Return the full path where the image file will be stored
-	imagePath := filepath.Join(pm.poolPath, imageName)
-	return imagePath, nil
-}
-
-// CheckCache checks if an image is already cached by looking for the checksum file.
-// Returns cached image metadata if found, nil if not cached, or error on failure.
-func (pm *PoolManager) CheckCache(checksum string) (*ImageCache, error) {
-	// Ensure cache directory exists
-	if err := os.MkdirAll(pm.poolPath, 0o750); err != nil {
-		return nil, fmt.Errorf("failed to access cache directory: %w", err)
-	}
-
-	// Look for checksum file in the cache directory
-	checksumFile := filepath.Join(pm.poolPath, checksum+".sha256")
-
-	// Check if checksum file exists
-	if _, err := os.Stat(checksumFile); err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil //nolint:nilnil // Image not cached
-		}
-		return nil, fmt.Errorf("failed to check checksum file: %w", err)
-	}
-
-	// Checksum file exists, now find the corresponding image file.
-	// Convention: checksum file is "{imagePath}.sha256", so image path is "{checksum_file_path}" minus ".sha256"
-	imagePath := strings.TrimSuffix(checksumFile, ".sha256")
-
-	// Verify image file exists
-	fileInfo, err := os.Stat(imagePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Checksum file orphaned - image was deleted
-			logrus.WithFields(logrus.Fields{
-				"checksum":      checksum,
-				"checksum_file": checksumFile,
-				"image_path":    imagePath,
-			}).Warn("Orphaned checksum file - image file missing")
-			return nil, nil //nolint:nilnil // Image not cached
-		}
-		return nil, fmt.Errorf("failed to stat image file: %w", err)
-	}
-
-	// Return cached image information
-	size := fileInfo.Size()
-	if size < 0 {
-		return nil, fmt.Errorf("invalid file size: %d", size)
-	}
-	cache := &ImageCache{
-		Path:     imagePath,
-		Size:     uint64(size),
-		Checksum: checksum,
-	}
-
-	return cache, nil
-}
-
-// CreateCacheEntry creates a cache entry with checksum file
-func (pm *PoolManager) CreateCacheEntry(imagePath, checksum string) error {
-	checksumFile := imagePath + ".sha256"
-
-	// Write checksum to file
-	err := os.WriteFile(checksumFile, []byte(checksum), 0600)
-	if err != nil {
-		return fmt.Errorf("failed to write checksum file: %w", err)
-	}
-
-	return nil
-}
-
-// CalculateChecksum calculates SHA256 checksum of a file
-func CalculateChecksum(filePath string) (string, error) {
-	// Validate path to prevent directory traversal
-	if strings.Contains(filePath, "..") || !strings.HasPrefix(filePath, "/var/lib/libvirt/") {
-		return "", fmt.Errorf("invalid file path: %s", filePath)
-	}
-
-	file, err := os.Open(filePath) // #nosec G304 -- Path validated above
-	if err != nil {
-		return "", fmt.Errorf("failed to open file for checksum: %w", err)
-	}
-	defer func() { _ = file.Close() }()
-
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", fmt.Errorf("failed to calculate checksum: %w", err)
-	}
-
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
-}
-
-// GetImageNameFromURL extracts a suitable volume name from the image URL
-func GetImageNameFromURL(imageURL string) string {
-	// Extract filename from URL
-	parts := strings.Split(imageURL, "/")
-	filename := parts[len(parts)-1]
-
-	// Remove file extension and sanitize
-	name := strings.TrimSuffix(filename, filepath.Ext(filename))
-	name = strings.ReplaceAll(name, "-", "_")
-	name = strings.ReplaceAll(name, ".", "_")
-
-	return name
-}
-
-// DeleteImage removes an image and its checksum from the cache
-func (pm *PoolManager) DeleteImage(imagePath string) error {
-	// Remove image file
-	if err := os.Remove(imagePath); err != nil && !os.IsNotExist(err) {
-		logrus.WithError(err).Warn("Failed to remove cached image file")
-	}
-
-	// Remove checksum file
-	checksumPath := imagePath + ".sha256"
-	if err := os.Remove(checksumPath); err != nil && !os.IsNotExist(err) {
-		logrus.WithError(err).Warn("Failed to remove checksum file")
-	}
-
-	return nil
-}
@@ -0,0 +1,58 @@
+package lvm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// CheckResult is what qemu-img check found in a qcow2 image
+type CheckResult struct {
+	// Corruptions are errors in the image's metadata that may lose data
+	Corruptions int `json:"corruptions"`
+	// Leaks are clusters allocated but unused, which waste space but are harmless
+	Leaks int `json:"leaks"`
+	// CheckErrors are parts of the image that could not be checked
+	CheckErrors int `json:"check-errors"`
+}
+
+// QemuImgCheck runs a qemu-img check command with JSON output. Problems found are
+// reported in the result; an error means the image could not be checked.
+func QemuImgCheck(cmd *exec.Cmd) (*CheckResult, error) {
+	output, err := cmd.Output()
+	// qemu-img check exits with 2 for corruptions and 3 for leaks, still reporting them
+	var exitErr *exec.ExitError
+	if err != nil && (!errors.As(err, &exitErr) || (exitErr.ExitCode() != 2 && exitErr.ExitCode() != 3)) {
+		stderr := ""
+		if exitErr != nil {
+			stderr = string(exitErr.Stderr)
+		}
+		return nil, &CommandError{Command: "qemu-img", Output: stderr, Err: err}
+	}
+	return parseCheck(output)
+}
+
+// parseCheck reads the result of the JSON output of qemu-img check
+func parseCheck(output []byte) (*CheckResult, error) {
+	var result CheckResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse qemu-img check output: %w", err)
+	}
+	return &result, nil
+}
+
+// CheckVolume runs qemu-img check on a volume images were written to as qcow2. The
+// volume may be in use by a domain, whose writes can then show up as leaks.
+func (m *Manager) CheckVolume(ctx context.Context, volumeName string) (*CheckResult, error) {
+	if !m.volumeExists(volumeName) {
+		return nil, fmt.Errorf("volume %s does not exist", volumeName)
+	}
+	result, err := QemuImgCheck(m.command(ctx, "qemu-img", "check", "--output=json", "-U", "-f", FormatQcow2,
+		m.DevicePath(volumeName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check volume %s: %w", volumeName, err)
+	}
+	return result, nil
+}
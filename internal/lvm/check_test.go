@@ -0,0 +1,30 @@
+package lvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCheck(t *testing.T) {
+	result, err := parseCheck([]byte(`{
+		"image-end-offset": 262144,
+		"total-clusters": 163840,
+		"check-errors": 0,
+		"leaks": 2,
+		"corruptions": 1,
+		"filename": "/var/lib/lvp/overlays/vm-1.qcow2",
+		"format": "qcow2"
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, CheckResult{Corruptions: 1, Leaks: 2}, *result)
+
+	// Counts that are zero may be left out
+	result, err = parseCheck([]byte(`{"check-errors": 0, "filename": "vm-1.qcow2", "format": "qcow2"}`))
+	require.NoError(t, err)
+	assert.Equal(t, CheckResult{}, *result)
+
+	_, err = parseCheck([]byte("not json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,279 @@
+package lvm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the LVM D-Bus API served by lvmdbusd
+const (
+	lvmDBusService     = "com.redhat.lvmdbus1"
+	lvmDBusManagerPath = dbus.ObjectPath("/com/redhat/lvmdbus1/Manager")
+	lvmDBusManager     = lvmDBusService + ".Manager"
+	lvmDBusVg          = lvmDBusService + ".Vg"
+	lvmDBusLv          = lvmDBusService + ".Lv"
+	lvmDBusLvCommon    = lvmDBusService + ".LvCommon"
+	lvmDBusJob         = lvmDBusService + ".Job"
+)
+
+// noObject is the object path lvmdbusd returns for no object
+const noObject = dbus.ObjectPath("/")
+
+// dbusJobPoll is how long each wait for a running lvmdbusd job lasts before its
+// progress is logged
+const dbusJobPoll = 5 * time.Second
+
+// dbusBackend creates, deletes and lists volumes through the LVM D-Bus API
+// instead of running LVM commands. lvmdbusd reports failures as D-Bus errors and
+// runs long operations as jobs that can be waited on, so no command output is parsed.
+type dbusBackend struct {
+	conn   *dbus.Conn
+	vgName string
+}
+
+// newDBusBackend connects to lvmdbusd on the system bus and checks it serves the volume group
+func newDBusBackend(vgName string) (*dbusBackend, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the system bus: %w", err)
+	}
+
+	b := &dbusBackend{conn: conn, vgName: vgName}
+	vg, err := b.lookUp(vgName)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if vg == noObject {
+		_ = conn.Close()
+		return nil, fmt.Errorf("lvmdbusd does not know volume group '%s'", vgName)
+	}
+	return b, nil
+}
+
+// object returns an lvmdbusd object
+func (b *dbusBackend) object(path dbus.ObjectPath) dbus.BusObject {
+	return b.conn.Object(lvmDBusService, path)
+}
+
+// lookUp returns the object of a volume group or "vg/lv" volume, or noObject if there is none
+func (b *dbusBackend) lookUp(lvmID string) (dbus.ObjectPath, error) {
+	var path dbus.ObjectPath
+	err := b.object(lvmDBusManagerPath).Call(lvmDBusManager+".LookUpByLvmId", 0, lvmID).Store(&path)
+	if err != nil {
+		return "", dbusError("Manager.LookUpByLvmId", err)
+	}
+	return path, nil
+}
+
+// volumeExists reports whether lvmdbusd knows a volume of the volume group
+func (b *dbusBackend) volumeExists(volumeName string) bool {
+	path, err := b.lookUp(b.vgName + "/" + volumeName)
+	return err == nil && path != noObject
+}
+
+// createVolume creates a linear volume carrying tag, waiting for lvmdbusd to finish
+func (b *dbusBackend) createVolume(volumeName string, sizeBytes uint64, tag string) error {
+	vg, err := b.lookUp(b.vgName)
+	if err != nil {
+		return err
+	}
+	if vg == noObject {
+		return fmt.Errorf("volume group %s not found", b.vgName)
+	}
+
+	// Options are passed on to lvcreate as command line options
+	options := map[string]dbus.Variant{"addtag": dbus.MakeVariant(tag)}
+	var result struct {
+		Volume dbus.ObjectPath
+		Job    dbus.ObjectPath
+	}
+	// A timeout of 0 returns a job at once, rather than blocking the call
+	err = b.object(vg).Call(lvmDBusVg+".LvCreateLinear", 0, volumeName, sizeBytes, false, int32(0), options).
+		Store(&result)
+	if err != nil {
+		return dbusError("Vg.LvCreateLinear", err)
+	}
+	return b.waitJob("Vg.LvCreateLinear", result.Job)
+}
+
+// deleteVolume removes a volume, waiting for lvmdbusd to finish
+func (b *dbusBackend) deleteVolume(volumeName string) error {
+	lv, err := b.lookUp(b.vgName + "/" + volumeName)
+	if err != nil {
+		return err
+	}
+	if lv == noObject {
+		return fmt.Errorf("volume %s does not exist", volumeName)
+	}
+
+	options := map[string]dbus.Variant{"force": dbus.MakeVariant("")}
+	var job dbus.ObjectPath
+	if err := b.object(lv).Call(lvmDBusLv+".Remove", 0, int32(0), options).Store(&job); err != nil {
+		return dbusError("Lv.Remove", err)
+	}
+	return b.waitJob("Lv.Remove", job)
+}
+
+// deleteTag removes an LVM tag from a volume, waiting for lvmdbusd to finish
+func (b *dbusBackend) deleteTag(volumeName, tag string) error {
+	lv, err := b.lookUp(b.vgName + "/" + volumeName)
+	if err != nil {
+		return err
+	}
+	if lv == noObject {
+		return fmt.Errorf("volume %s does not exist", volumeName)
+	}
+
+	var job dbus.ObjectPath
+	err = b.object(lv).Call(lvmDBusLv+".TagsDel", 0, []string{tag}, int32(0), map[string]dbus.Variant{}).Store(&job)
+	if err != nil {
+		return dbusError("Lv.TagsDel", err)
+	}
+	return b.waitJob("Lv.TagsDel", job)
+}
+
+// waitJob waits for an lvmdbusd job to complete, logging its progress, and returns its error.
+// Like the LVM commands it replaces, a job runs to completion once started.
+func (b *dbusBackend) waitJob(operation string, job dbus.ObjectPath) error {
+	if job == noObject || job == "" {
+		return nil // Completed within the call
+	}
+	obj := b.object(job)
+	// Completed jobs are kept until removed
+	defer func() { _ = obj.Call(lvmDBusJob+".Remove", 0).Err }()
+
+	started := time.Now()
+	for {
+		var complete bool
+		if err := obj.Call(lvmDBusJob+".Wait", 0, int32(dbusJobPoll/time.Second)).Store(&complete); err != nil {
+			return dbusError("Job.Wait", err)
+		}
+		if complete {
+			break
+		}
+		fields := logrus.Fields{"operation": operation, "job": job, "elapsed": time.Since(started)}
+		if percent, err := obj.GetProperty(lvmDBusJob + ".Percent"); err == nil {
+			fields["percent"] = percent.Value()
+		}
+		logrus.WithFields(fields).Info("Waiting for LVM D-Bus job")
+	}
+
+	property, err := obj.GetProperty(lvmDBusJob + ".GetError")
+	if err != nil {
+		return dbusError("Job.GetError", err)
+	}
+	var jobErr struct {
+		Code    int32
+		Message string
+	}
+	if err := property.Store(&jobErr); err != nil {
+		return fmt.Errorf("unexpected LVM D-Bus job error %v: %w", property, err)
+	}
+	if jobErr.Code != 0 {
+		return &CommandError{Command: operation, Output: jobErr.Message,
+			Err: fmt.Errorf("LVM D-Bus job failed with code %d", jobErr.Code)}
+	}
+	return nil
+}
+
+// listVolumes returns the volumes of the volume group, or only volumeName if it is set
+func (b *dbusBackend) listVolumes(volumeName string) ([]VolumeInfo, error) {
+	vg, err := b.lookUp(b.vgName)
+	if err != nil {
+		return nil, err
+	}
+	if vg == noObject {
+		return nil, fmt.Errorf("volume group %s not found", b.vgName)
+	}
+
+	property, err := b.object(vg).GetProperty(lvmDBusVg + ".Lvs")
+	if err != nil {
+		return nil, dbusError("Vg.Lvs", err)
+	}
+	var paths []dbus.ObjectPath
+	if err := property.Store(&paths); err != nil {
+		return nil, fmt.Errorf("unexpected volume list %v: %w", property, err)
+	}
+
+	// Snapshots and thin volumes refer to their origin and pool by object
+	all := make(map[dbus.ObjectPath]map[string]dbus.Variant, len(paths))
+	names := make(map[dbus.ObjectPath]string, len(paths))
+	for _, path := range paths {
+		var props map[string]dbus.Variant
+		err := b.object(path).Call("org.freedesktop.DBus.Properties.GetAll", 0, lvmDBusLvCommon).Store(&props)
+		if err != nil {
+			return nil, dbusError("LvCommon.GetAll", err)
+		}
+		all[path] = props
+		names[path], _ = props["Name"].Value().(string)
+	}
+
+	var volumes []VolumeInfo
+	for _, path := range paths {
+		if volumeName != "" && names[path] != volumeName {
+			continue
+		}
+		info, err := volumeFromProperties(all[path], names)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, info)
+	}
+	return volumes, nil
+}
+
+// volumeFromProperties converts the LvCommon properties of a volume to VolumeInfo,
+// naming the objects it refers to from names
+func volumeFromProperties(props map[string]dbus.Variant, names map[dbus.ObjectPath]string) (VolumeInfo, error) {
+	var info VolumeInfo
+	var sizeBytes uint64
+	var origin, pool dbus.ObjectPath
+	var dataPercent uint32
+	for field, dest := range map[string]any{
+		"Name":        &info.Name,
+		"SizeBytes":   &sizeBytes,
+		"Attr":        &info.Attributes,
+		"Tags":        &info.Tags,
+		"OriginLv":    &origin,
+		"PoolLv":      &pool,
+		"DataPercent": &dataPercent,
+	} {
+		value, ok := props[field]
+		if !ok {
+			return VolumeInfo{}, fmt.Errorf("volume %s has no %s property", info.Name, field)
+		}
+		if err := value.Store(dest); err != nil {
+			return VolumeInfo{}, fmt.Errorf("unexpected %s property %v: %w", field, value, err)
+		}
+	}
+
+	info.SizeBytes = int64(min(sizeBytes, 1<<63-1)) // #nosec G115 -- Clamped to int64
+	info.Origin = names[origin]
+	info.Pool = names[pool]
+	if len(info.Tags) == 0 {
+		info.Tags = nil
+	}
+	// lvmdbusd reports whole percentages, and 0 for volumes without data usage
+	if info.Attributes != "" && (info.Attributes[0] == 't' || info.Attributes[0] == 'V' ||
+		info.Attributes[0] == 's' || info.Attributes[0] == 'S') {
+		percent := float64(dataPercent)
+		info.DataPercent = &percent
+	}
+	return info, nil
+}
+
+// dbusError keeps the name and message of a D-Bus error for error reporting, like
+// the output of a failed command
+func dbusError(operation string, err error) error {
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) {
+		return &CommandError{Command: operation, Output: dbusErr.Error(),
+			Err: fmt.Errorf("LVM D-Bus call failed: %s", dbusErr.Name)}
+	}
+	return fmt.Errorf("LVM D-Bus call %s failed: %w", operation, err)
+}
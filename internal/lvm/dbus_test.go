@@ -0,0 +1,63 @@
+package lvm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVolumeFromProperties(t *testing.T) {
+	pool := dbus.ObjectPath("/com/redhat/lvmdbus1/ThinPool/0")
+	names := map[dbus.ObjectPath]string{pool: "pool"}
+	props := func(name, attr string, tags []string, origin, poolLv dbus.ObjectPath, percent uint32) map[string]dbus.Variant {
+		return map[string]dbus.Variant{
+			"Name":        dbus.MakeVariant(name),
+			"SizeBytes":   dbus.MakeVariant(uint64(21474836480)),
+			"Attr":        dbus.MakeVariant(attr),
+			"Tags":        dbus.MakeVariant(tags),
+			"OriginLv":    dbus.MakeVariant(origin),
+			"PoolLv":      dbus.MakeVariant(poolLv),
+			"DataPercent": dbus.MakeVariant(percent),
+		}
+	}
+
+	info, err := volumeFromProperties(props("vm01-root", "Vwi-aotz--", []string{IncompleteTag}, noObject, pool, 12), names)
+	require.NoError(t, err)
+	assert.Equal(t, "vm01-root", info.Name)
+	assert.Equal(t, int64(21474836480), info.SizeBytes)
+	assert.Equal(t, "pool", info.Pool)
+	assert.Empty(t, info.Origin)
+	assert.True(t, info.HasTag(IncompleteTag))
+	require.NotNil(t, info.DataPercent)
+	assert.InDelta(t, 12.0, *info.DataPercent, 0.001)
+
+	// Linear volumes have no data usage
+	info, err = volumeFromProperties(props("vm02-data", "-wi-a-----", []string{}, noObject, noObject, 0), names)
+	require.NoError(t, err)
+	assert.Nil(t, info.DataPercent)
+	assert.Nil(t, info.Tags)
+
+	incomplete := props("vm03-data", "-wi-a-----", nil, noObject, noObject, 0)
+	delete(incomplete, "Attr")
+	_, err = volumeFromProperties(incomplete, names)
+	assert.Error(t, err)
+}
+
+func TestDBusError(t *testing.T) {
+	err := dbusError("Vg.LvCreateLinear", dbus.Error{
+		Name: "com.redhat.lvmdbus1.Vg",
+		Body: []any{"Volume group \"data\" has insufficient free space"},
+	})
+	var cmdErr *CommandError
+	require.True(t, errors.As(err, &cmdErr))
+	assert.Equal(t, "Vg.LvCreateLinear", cmdErr.Command)
+	// Failures are classified by their message, as for LVM commands
+	assert.False(t, retryableCommand(err))
+
+	err = dbusError("Manager.LookUpByLvmId", dbus.ErrClosed)
+	assert.ErrorIs(t, err, dbus.ErrClosed)
+	assert.True(t, retryableCommand(err))
+}
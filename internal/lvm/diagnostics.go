@@ -0,0 +1,74 @@
+package lvm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// diagnosticsTimeout bounds the vgs call made to explain a failed command
+const diagnosticsTimeout = 10 * time.Second
+
+// VolumeGroupStatus is the state of the volume group as reported by vgs, for
+// explaining failed LVM commands to operators without access to the host
+type VolumeGroupStatus struct {
+	Name            string
+	SizeBytes       int64
+	FreeBytes       int64
+	PhysicalVolumes int
+	LogicalVolumes  int
+	// Attributes are the vg_attr flags, e.g. "wz--n-"
+	Attributes string
+}
+
+// VolumeGroupStatus reports the size, free space, volume counts and attributes of
+// the volume group
+func (m *Manager) VolumeGroupStatus(ctx context.Context) (*VolumeGroupStatus, error) {
+	if m.files != nil {
+		volumes, err := m.files.listVolumes("")
+		if err != nil {
+			return nil, err
+		}
+		vg, err := m.files.volumeGroup()
+		if err != nil {
+			return nil, err
+		}
+		return &VolumeGroupStatus{Name: m.vgName, SizeBytes: int64(vg.SizeBytes), FreeBytes: int64(vg.FreeBytes),
+			LogicalVolumes: len(volumes)}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, diagnosticsTimeout)
+	defer cancel()
+	cmd := m.command(ctx, "vgs", "--units", "b", "--nosuffix", "--noheadings", "--separator", "|",
+		"-o", "vg_name,vg_size,vg_free,pv_count,lv_count,vg_attr", m.vgName)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, &CommandError{Command: "vgs", Output: string(output), Err: err}
+	}
+	return parseVolumeGroupStatus(string(output))
+}
+
+// parseVolumeGroupStatus parses "name|size|free|pv_count|lv_count|attr" vgs output
+func parseVolumeGroupStatus(output string) (*VolumeGroupStatus, error) {
+	fields := strings.Split(strings.TrimSpace(output), "|")
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("unexpected vgs output: %q", strings.TrimSpace(output))
+	}
+	numbers := make([]int64, 4)
+	for i, field := range fields[1:5] {
+		n, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected vgs output: %q", strings.TrimSpace(output))
+		}
+		numbers[i] = n
+	}
+	return &VolumeGroupStatus{
+		Name:            strings.TrimSpace(fields[0]),
+		SizeBytes:       numbers[0],
+		FreeBytes:       numbers[1],
+		PhysicalVolumes: int(numbers[2]),
+		LogicalVolumes:  int(numbers[3]),
+		Attributes:      strings.TrimSpace(fields[5]),
+	}, nil
+}
@@ -0,0 +1,36 @@
+package lvm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVolumeGroupStatus(t *testing.T) {
+	status, err := parseVolumeGroupStatus("  data|107374182400|21474836480|2|14|wz--n-\n")
+	require.NoError(t, err)
+	assert.Equal(t, &VolumeGroupStatus{
+		Name: "data", SizeBytes: 107374182400, FreeBytes: 21474836480,
+		PhysicalVolumes: 2, LogicalVolumes: 14, Attributes: "wz--n-",
+	}, status)
+
+	for _, invalid := range []string{"", "data|1|2", "data|x|2|1|1|wz--n-"} {
+		_, err := parseVolumeGroupStatus(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestVolumeGroupStatus_Files(t *testing.T) {
+	m, err := NewFileManager("dev", t.TempDir(), 10<<30)
+	require.NoError(t, err)
+	require.NoError(t, m.CreateVolume(context.Background(), "vm01-root", 4<<30))
+
+	status, err := m.VolumeGroupStatus(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "dev", status.Name)
+	assert.Equal(t, int64(10<<30), status.SizeBytes)
+	assert.Equal(t, int64(6<<30), status.FreeBytes)
+	assert.Equal(t, 1, status.LogicalVolumes)
+}
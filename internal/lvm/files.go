@@ -0,0 +1,196 @@
+package lvm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// tagsSuffix names the file holding the tags of a volume kept as a file
+const tagsSuffix = ".tags"
+
+// fileBackend keeps volumes as sparse files in a directory, standing in for a volume
+// group of sizeBytes on hosts without LVM, such as CI containers and developer laptops
+type fileBackend struct {
+	dir       string
+	sizeBytes int64
+	// mu serializes changes to volumes and their tags
+	mu sync.Mutex
+}
+
+// NewFileManager creates a manager that keeps volumes as files in dir rather than
+// in a volume group, simulating a volume group of sizeBytes. Snapshots and other
+// operations that run LVM commands are not simulated.
+func NewFileManager(vgName, dir string, sizeBytes int64) (*Manager, error) {
+	if vgName == "" || strings.ContainsAny(vgName, "/\\") {
+		return nil, fmt.Errorf("invalid volume group name '%s'", vgName)
+	}
+	if sizeBytes <= 0 {
+		return nil, fmt.Errorf("invalid volume group size %d", sizeBytes)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create volume directory: %w", err)
+	}
+
+	files := &fileBackend{dir: dir, sizeBytes: sizeBytes}
+	retryConfig := parseLvmRetryConfig("", "")
+	return &Manager{
+		vgName:       vgName,
+		createRetry:  retryConfig,
+		convertRetry: retryConfig,
+		copyOptions:  DefaultCopyOptions(),
+		format:       FormatRaw,
+		backend:      files,
+		files:        files,
+	}, nil
+}
+
+// path returns the file a volume is kept in
+func (b *fileBackend) path(volumeName string) string {
+	return filepath.Join(b.dir, volumeName)
+}
+
+func (b *fileBackend) volumeExists(volumeName string) bool {
+	info, err := os.Stat(b.path(volumeName))
+	return err == nil && info.Mode().IsRegular()
+}
+
+func (b *fileBackend) createVolume(volumeName string, sizeBytes uint64, tag string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	vg, err := b.volumeGroup()
+	if err != nil {
+		return err
+	}
+	if float64(sizeBytes) > vg.FreeBytes {
+		return &CommandError{Command: "lvcreate", Output: "insufficient free space", Err: errors.New("volume group full")}
+	}
+	file, err := os.OpenFile(b.path(volumeName), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return &CommandError{Command: "lvcreate", Output: "already exists", Err: err}
+		}
+		return fmt.Errorf("failed to create volume file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	if err := file.Truncate(int64(sizeBytes)); err != nil { // #nosec G115 -- Sizes are validated positive
+		return fmt.Errorf("failed to size volume file: %w", err)
+	}
+	return b.writeTags(volumeName, []string{tag})
+}
+
+func (b *fileBackend) deleteVolume(volumeName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := os.Remove(b.path(volumeName)); err != nil {
+		return fmt.Errorf("failed to remove volume file: %w", err)
+	}
+	if err := os.Remove(b.path(volumeName) + tagsSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove volume tags: %w", err)
+	}
+	return nil
+}
+
+func (b *fileBackend) deleteTag(volumeName, tag string) error {
+	return b.replaceTags(volumeName, func(tags []string) []string {
+		return slices.DeleteFunc(tags, func(t string) bool { return t == tag })
+	})
+}
+
+// replaceTags rewrites the tags of a volume with the result of update
+func (b *fileBackend) replaceTags(volumeName string, update func([]string) []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.volumeExists(volumeName) {
+		return fmt.Errorf("volume %s does not exist", volumeName)
+	}
+	tags, err := b.readTags(volumeName)
+	if err != nil {
+		return err
+	}
+	return b.writeTags(volumeName, update(tags))
+}
+
+// readTags returns the tags of a volume, one per line of its tags file
+func (b *fileBackend) readTags(volumeName string) ([]string, error) {
+	data, err := os.ReadFile(b.path(volumeName) + tagsSuffix) // #nosec G304 -- Volume names are validated
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read volume tags: %w", err)
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// writeTags replaces the tags of a volume
+func (b *fileBackend) writeTags(volumeName string, tags []string) error {
+	var data string
+	for _, tag := range tags {
+		data += tag + "\n"
+	}
+	if err := os.WriteFile(b.path(volumeName)+tagsSuffix, []byte(data), 0o600); err != nil {
+		return fmt.Errorf("failed to write volume tags: %w", err)
+	}
+	return nil
+}
+
+func (b *fileBackend) listVolumes(volumeName string) ([]VolumeInfo, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume files: %w", err)
+	}
+
+	var volumes []VolumeInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasSuffix(name, tagsSuffix) {
+			continue
+		}
+		if volumeName != "" && name != volumeName {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat volume file: %w", err)
+		}
+		tags, err := b.readTags(name)
+		if err != nil {
+			return nil, err
+		}
+		// Volumes are reported as active linear volumes that are not open
+		volumes = append(volumes, VolumeInfo{Name: name, SizeBytes: info.Size(), Attributes: "-wi-a-----", Tags: tags})
+	}
+	return volumes, nil
+}
+
+// volumeGroup reports the simulated volume group, whose free space is what the
+// volumes do not take up
+func (b *fileBackend) volumeGroup() (*vgReport, error) {
+	volumes, err := b.listVolumes("")
+	if err != nil {
+		return nil, err
+	}
+	free := b.sizeBytes
+	for _, volume := range volumes {
+		free -= volume.SizeBytes
+	}
+	return &vgReport{SizeBytes: float64(b.sizeBytes), FreeBytes: float64(max(free, 0))}, nil
+}
+
+// checkFiles reports the directory volumes are kept in, for the self-test
+func (b *fileBackend) checkFiles(_ context.Context) (string, error) {
+	vg, err := b.volumeGroup()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("volumes kept as files in %s: %.0f of %.0f bytes free", b.dir, vg.FreeBytes, vg.SizeBytes), nil
+}
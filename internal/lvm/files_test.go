@@ -0,0 +1,53 @@
+package lvm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileManager(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFileManager("data", dir, 1<<30)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, m.CreateVolume(ctx, "web01-root", 512<<20))
+	assert.True(t, m.VolumeExists("web01-root"))
+	assert.Equal(t, filepath.Join(dir, "web01-root"), m.DevicePath("web01-root"))
+	incomplete, err := m.IncompleteVolumes()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"web01-root"}, incomplete)
+
+	// Raw images are copied into the volume's file, which keeps the volume's size
+	image := filepath.Join(t.TempDir(), "image.raw")
+	require.NoError(t, os.WriteFile(image, []byte("raw image contents"), 0o600))
+	written, err := m.PopulateVolume(ctx, image, "web01-root", "raw", "", nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, written)
+	require.NoError(t, m.MarkComplete("web01-root"))
+	require.NoError(t, m.SetResultTag("web01-root", []byte(`{"name":"web01-root"}`)))
+
+	info, err := m.GetVolumeInfo("web01-root")
+	require.NoError(t, err)
+	assert.Equal(t, int64(512<<20), info.SizeBytes)
+	assert.False(t, info.HasTag(IncompleteTag))
+	require.Len(t, info.Tags, 1)
+	assert.Contains(t, info.Tags[0], ResultTagPrefix)
+
+	// An existing compatible volume is reused, and the volume group cannot be overcommitted
+	require.NoError(t, m.CreateVolume(ctx, "web01-root", 512<<20))
+	assert.Error(t, m.CreateVolume(ctx, "web02-root", 768<<20))
+	vg, err := m.reportVolumeGroup(ctx)
+	require.NoError(t, err)
+	assert.InDelta(t, float64(512<<20), vg.FreeBytes, 0)
+
+	require.NoError(t, m.DeleteVolume("web01-root"))
+	volumes, err := m.ListVolumes()
+	require.NoError(t, err)
+	assert.Empty(t, volumes)
+}
@@ -0,0 +1,78 @@
+package lvm
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// mkfsCommands are the commands creating each supported filesystem
+var mkfsCommands = map[string]string{
+	"ext4": "mkfs.ext4",
+	"xfs":  "mkfs.xfs",
+}
+
+// mkfsOptionPattern matches the mkfs arguments a request may pass. Paths are not
+// allowed, so options cannot read host files, e.g. mkfs.ext4 -d or mkfs.xfs -p.
+var mkfsOptionPattern = regexp.MustCompile(`^[A-Za-z0-9=,._:+-]+$`)
+
+// forbiddenMkfsOptions are options that read from the host or are not needed on a
+// new volume
+var forbiddenMkfsOptions = map[string][]string{
+	"ext4": {"-d", "-c", "-l", "-n", "-S"},
+	"xfs":  {"-p", "-N", "-K"},
+}
+
+// ValidateFilesystem checks that a filesystem is supported and that its mkfs
+// options are safe to pass on
+func ValidateFilesystem(filesystem string, options []string) error {
+	if _, ok := mkfsCommands[filesystem]; !ok {
+		return fmt.Errorf("unsupported filesystem: %s", filesystem)
+	}
+	if len(options) > 0 && (options[0] == "" || options[0][0] != '-') {
+		return fmt.Errorf("mkfs options must start with an option, not %q", options[0])
+	}
+	for _, option := range options {
+		if !mkfsOptionPattern.MatchString(option) {
+			return fmt.Errorf("invalid mkfs option %q", option)
+		}
+		if slices.Contains(forbiddenMkfsOptions[filesystem], option) {
+			return fmt.Errorf("mkfs option %s is not allowed", option)
+		}
+	}
+	return nil
+}
+
+// SwapTag marks volumes set up as swap space by the provisioner
+const SwapTag = "lvp_swap"
+
+// MakeSwap sets up a volume as swap space and tags it as a swap volume
+func (m *Manager) MakeSwap(volumeName string) error {
+	output, err := m.command(context.Background(), "mkswap", m.DevicePath(volumeName)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to set up swap: %w", &CommandError{Command: "mkswap", Output: string(output), Err: err})
+	}
+
+	cmd := m.command(context.Background(), "lvchange", "--addtag", SwapTag, fmt.Sprintf("%s/%s", m.vgName, volumeName))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to tag swap volume: %w", &CommandError{Command: "lvchange", Output: string(output), Err: err})
+	}
+	return nil
+}
+
+// FormatVolume creates a filesystem on a volume
+func (m *Manager) FormatVolume(volumeName, filesystem string, options []string) error {
+	if err := ValidateFilesystem(filesystem, options); err != nil {
+		return err
+	}
+
+	command := mkfsCommands[filesystem]
+	args := append(slices.Clone(options), m.DevicePath(volumeName))
+	// Options are validated, the device path is internal
+	output, err := m.command(context.Background(), command, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to format volume: %w", &CommandError{Command: command, Output: string(output), Err: err})
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package lvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFilesystem(t *testing.T) {
+	assert.NoError(t, ValidateFilesystem("ext4", nil))
+	assert.NoError(t, ValidateFilesystem("ext4", []string{"-L", "data", "-m", "0", "-E", "lazy_itable_init=1"}))
+	assert.NoError(t, ValidateFilesystem("xfs", []string{"-L", "data", "-m", "reflink=1"}))
+
+	for _, tt := range []struct {
+		filesystem string
+		options    []string
+	}{
+		{"btrfs", nil},
+		{"none", nil},
+		{"ext4", []string{"data"}},
+		{"ext4", []string{"-d", "/etc"}},
+		{"ext4", []string{"-L", "my data"}},
+		{"ext4", []string{"-L", "data;reboot"}},
+		{"xfs", []string{"-p", "protofile"}},
+	} {
+		assert.Error(t, ValidateFilesystem(tt.filesystem, tt.options), tt)
+	}
+}
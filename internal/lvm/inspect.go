@@ -0,0 +1,48 @@
+package lvm
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// inspection is the subset of virt-inspector output used here
+type inspection struct {
+	OperatingSystems []struct {
+		Arch string `xml:"arch"`
+	} `xml:"operatingsystem"`
+}
+
+// ImageArchitecture inspects the operating system of an image with virt-inspector
+// and returns its CPU architecture as libguestfs names it, e.g. x86_64 or aarch64
+func ImageArchitecture(imagePath, imageType string) (string, error) {
+	//nolint:gosec,noctx // Image path is a cached image; virt-inspector does not need a context
+	cmd := exec.Command("virt-inspector", "--no-applications", "--no-icon", "--format", imageType, "-a", imagePath)
+	// Warnings on stderr must not end up in the XML
+	output, err := cmd.Output()
+	if err != nil {
+		var stderr string
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			stderr = string(exitErr.Stderr)
+		}
+		return "", fmt.Errorf("failed to inspect image: %w",
+			&CommandError{Command: "virt-inspector", Output: stderr, Err: err})
+	}
+	return parseInspection(output)
+}
+
+// parseInspection returns the architecture of the first operating system found by virt-inspector
+func parseInspection(output []byte) (string, error) {
+	var report inspection
+	if err := xml.Unmarshal(output, &report); err != nil {
+		return "", fmt.Errorf("failed to parse virt-inspector output: %w", err)
+	}
+	for _, system := range report.OperatingSystems {
+		if system.Arch != "" {
+			return system.Arch, nil
+		}
+	}
+	return "", fmt.Errorf("no operating system found in image")
+}
@@ -0,0 +1,29 @@
+package lvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInspection(t *testing.T) {
+	output := `<?xml version="1.0"?>
+<operatingsystems>
+  <operatingsystem>
+    <root>/dev/sda1</root>
+    <name>linux</name>
+    <arch>aarch64</arch>
+    <distro>ubuntu</distro>
+  </operatingsystem>
+</operatingsystems>
+`
+	arch, err := parseInspection([]byte(output))
+	require.NoError(t, err)
+	assert.Equal(t, "aarch64", arch)
+
+	_, err = parseInspection([]byte(`<operatingsystems/>`))
+	assert.ErrorContains(t, err, "no operating system")
+	_, err = parseInspection([]byte(`not xml`))
+	assert.Error(t, err)
+}
@@ -4,11 +4,14 @@ package lvm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rossigee/libvirt-volume-provisioner/internal/retry"
@@ -20,10 +23,75 @@ type ProgressUpdater interface {
 	UpdateProgress(stage string, percent float64, bytesProcessed, bytesTotal int64)
 }
 
+// CommandError is returned when an LVM or image conversion command fails,
+// keeping the command's output for error reporting
+type CommandError struct {
+	Command string
+	Output  string
+	Err     error
+}
+
+// Error formats the error with the command's output
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%v, output: %s", e.Err, e.Output)
+}
+
+// Unwrap returns the underlying command error
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// IncompatibleError is returned when an existing volume cannot be reused
+type IncompatibleError struct {
+	Err error
+}
+
+// Error returns the reason the volume is incompatible
+func (e *IncompatibleError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *IncompatibleError) Unwrap() error {
+	return e.Err
+}
+
+// IncompleteTag marks volumes created by the provisioner that have not yet been
+// populated. Volumes still tagged at startup were left behind by interrupted jobs.
+const IncompleteTag = "lvp_incomplete"
+
 // Manager handles LVM operations
 type Manager struct {
-	vgName      string
-	retryConfig retry.Config
+	vgName string
+	// createRetry and convertRetry configure retries of lvcreate and of populating volumes
+	createRetry  retry.Config
+	convertRetry retry.Config
+	// copyOptions configures how raw images are copied to volumes
+	copyOptions CopyOptions
+	// format is the format images are converted to by default, see VolumeFormat
+	format string
+	// backend, if set, creates, deletes and lists volumes instead of LVM commands
+	backend volumeBackend
+	// files, if set, is the backend keeping volumes as files instead of in the volume group
+	files *fileBackend
+	// wrapper, if set, is the command privileged commands are run through, e.g. sudo -n
+	wrapper []string
+	// quota limits the allocation of the volume group; createMu serializes checking
+	// it and creating volumes, so concurrent jobs cannot together exceed it
+	quota    Quota
+	createMu sync.Mutex
+	// multipath configures checking the paths of the multipath devices under the
+	// volume group before volumes are created
+	multipath MultipathCheck
+}
+
+// volumeBackend creates, deletes and lists volumes, such as through the LVM D-Bus API
+type volumeBackend interface {
+	volumeExists(volumeName string) bool
+	createVolume(volumeName string, sizeBytes uint64, tag string) error
+	deleteVolume(volumeName string) error
+	deleteTag(volumeName, tag string) error
+	listVolumes(volumeName string) ([]VolumeInfo, error)
 }
 
 // NewManager creates a new LVM manager with configurable volume group
@@ -39,18 +107,20 @@ func NewManager(vgName string) (*Manager, error) {
 		return nil, fmt.Errorf("invalid volume group name '%s': must not contain path separators", vgName)
 	}
 
-	// Verify the volume group exists
-	cmd := exec.CommandContext(context.Background(), "vgs", vgName)
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("volume group '%s' does not exist or is not accessible: %w", vgName, err)
+	// Privileged commands may run through a wrapper, so the provisioner need not run as root
+	wrapper, err := ParseWrapper(os.Getenv("PRIVILEGE_WRAPPER"))
+	if err != nil {
+		return nil, err
 	}
 
-	// Verify LVM commands are available
-	if _, err := exec.LookPath("lvcreate"); err != nil {
-		return nil, fmt.Errorf("lvcreate command not found: %w", err)
-	}
-	if _, err := exec.LookPath("qemu-img"); err != nil {
-		return nil, fmt.Errorf("qemu-img command not found: %w", err)
+	// Verify LVM commands are available. The wrapper finds them on its own path.
+	if len(wrapper) == 0 {
+		if _, err := exec.LookPath("lvcreate"); err != nil {
+			return nil, fmt.Errorf("lvcreate command not found: %w", err)
+		}
+		if _, err := exec.LookPath("qemu-img"); err != nil {
+			return nil, fmt.Errorf("qemu-img command not found: %w", err)
+		}
 	}
 
 	// Configure retry logic
@@ -59,10 +129,59 @@ func NewManager(vgName string) (*Manager, error) {
 		os.Getenv("LVM_RETRY_BACKOFF_MS"),
 	)
 
-	return &Manager{
-		vgName:      vgName,
-		retryConfig: retryConfig,
-	}, nil
+	m := &Manager{
+		vgName:       vgName,
+		createRetry:  retryConfig,
+		convertRetry: retryConfig,
+		copyOptions:  DefaultCopyOptions(),
+		format:       FormatRaw,
+		wrapper:      wrapper,
+	}
+
+	// Verify the volume group exists
+	if err := m.command(context.Background(), "vgs", vgName).Run(); err != nil {
+		return nil, fmt.Errorf("volume group '%s' does not exist or is not accessible: %w", vgName, err)
+	}
+	return m, nil
+}
+
+// VolumeGroup returns the name of the volume group volumes are created in
+func (m *Manager) VolumeGroup() string {
+	return m.vgName
+}
+
+// EnableDBus makes the manager create, delete and list volumes through the LVM
+// D-Bus API served by lvmdbusd, rather than by running LVM commands. Other
+// operations, such as snapshots, still run LVM commands.
+func (m *Manager) EnableDBus() error {
+	backend, err := newDBusBackend(m.vgName)
+	if err != nil {
+		return err
+	}
+	m.backend = backend
+	return nil
+}
+
+// SetCopyOptions configures how raw images are copied to volumes
+func (m *Manager) SetCopyOptions(opts CopyOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	m.copyOptions = opts
+	return nil
+}
+
+// SetRetryPolicy overrides the retry configuration of the lvcreate or convert stage
+func (m *Manager) SetRetryPolicy(stage string, policy retry.Policy) error {
+	switch stage {
+	case retry.StageLVCreate:
+		m.createRetry = policy.Apply(m.createRetry)
+	case retry.StageConvert:
+		m.convertRetry = policy.Apply(m.convertRetry)
+	default:
+		return fmt.Errorf("LVM has no retry stage %q", stage)
+	}
+	return nil
 }
 
 // parseLvmRetryConfig parses retry configuration from environment variables
@@ -94,28 +213,76 @@ func parseLvmRetryConfig(attemptsStr, backoffStr string) retry.Config {
 	return retry.Config{
 		MaxAttempts: maxAttempts,
 		Delays:      delays,
+		Jitter:      0.1,
+		Retryable:   retryableCommand,
+	}
+}
+
+// permanentOutputs are command output fragments of failures that retrying cannot fix
+var permanentOutputs = []string{
+	"already exists",
+	"insufficient free space",
+	"No space left on device",
+}
+
+// retryableCommand reports whether a failed LVM or conversion command may succeed if
+// retried, e.g. after a transient lock or udev race. Cancellation is not retried.
+func retryableCommand(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		return true
+	}
+	for _, output := range permanentOutputs {
+		if strings.Contains(cmdErr.Output, output) {
+			return false
+		}
+	}
+	return true
+}
+
+// withRetryLogging returns cfg logging each failed attempt of operation that will be retried
+func withRetryLogging(cfg retry.Config, operation, volumeName string) retry.Config {
+	cfg.OnRetry = func(attempt int, err error, delay time.Duration) {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"operation":   operation,
+			"volume_name": volumeName,
+			"attempt":     attempt,
+			"delay":       delay,
+		}).Warn("LVM operation failed, retrying")
 	}
+	return cfg
 }
 
-// CreateVolume creates a new LVM volume with exponential backoff retry
+// CreateVolume creates a new LVM volume of sizeBytes with exponential backoff retry.
+// LVM rounds the size up to whole extents; GetVolumeInfo reports the actual size.
 // If volume exists, validates it matches requirements and reuses if compatible
-func (m *Manager) CreateVolume(ctx context.Context, volumeName string, sizeGB int) error {
+func (m *Manager) CreateVolume(ctx context.Context, volumeName string, sizeBytes int64) error {
 	// Check if volume already exists
 	if m.volumeExists(volumeName) {
 		// Validate existing volume
-		if err := m.validateExistingVolume(volumeName, sizeGB); err != nil {
-			return fmt.Errorf("existing volume %s is incompatible: %w", volumeName, err)
+		if err := m.validateExistingVolume(volumeName, sizeBytes); err != nil {
+			return fmt.Errorf("existing volume %s is incompatible: %w", volumeName, &IncompatibleError{Err: err})
 		}
 		logrus.WithFields(logrus.Fields{
 			"volume_name": volumeName,
-			"size_gb":     sizeGB,
+			"size_bytes":  sizeBytes,
 		}).Info("Reusing existing compatible volume")
 		return nil
 	}
 
+	m.createMu.Lock()
+	defer m.createMu.Unlock()
+	if err := m.CheckQuota(ctx, sizeBytes); err != nil {
+		return err
+	}
+
 	// Create new volume
-	err := retry.WithRetry(ctx, m.retryConfig, func() error {
-		return m.createVolumeOnce(volumeName, sizeGB)
+	err := retry.WithRetry(ctx, withRetryLogging(m.createRetry, "lvcreate", volumeName), func() error {
+		return m.createVolumeOnce(volumeName, sizeBytes)
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create volume %s after retries: %w", volumeName, err)
@@ -123,79 +290,195 @@ func (m *Manager) CreateVolume(ctx context.Context, volumeName string, sizeGB in
 	return nil
 }
 
-// createVolumeOnce performs a single LVM volume creation attempt
-func (m *Manager) createVolumeOnce(volumeName string, sizeGB int) error {
+// createVolumeOnce performs a single LVM volume creation attempt. The volume is
+// tagged as incomplete until MarkComplete is called.
+func (m *Manager) createVolumeOnce(volumeName string, sizeBytes int64) error {
+	if m.backend != nil {
+		return m.backend.createVolume(volumeName, uint64(sizeBytes), IncompleteTag) // #nosec G115 -- Sizes are validated positive
+	}
+
 	// Create LVM volume
-	//nolint:gosec,noctx // LVM command parameters are validated and controlled internally
-	cmd := exec.Command("lvcreate", "-L", fmt.Sprintf("%dG", sizeGB), "-n", volumeName, m.vgName)
+	cmd := m.command(context.Background(), "lvcreate", "-L", fmt.Sprintf("%db", sizeBytes), "-n", volumeName,
+		"--addtag", IncompleteTag, m.vgName)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("failed to create LVM volume: %w, output: %s", err, string(output))
+		return fmt.Errorf("failed to create LVM volume: %w", &CommandError{Command: "lvcreate", Output: string(output), Err: err})
 	}
 
 	return nil
 }
 
-// PopulateVolume populates an LVM volume with image data with exponential backoff retry
+// PopulateVolume populates an LVM volume with image data with exponential backoff retry.
+// The image is converted to format, the manager's volume format if empty. For raw
+// images written to raw volumes, it returns the SHA256 checksum of the bytes written.
 func (m *Manager) PopulateVolume(
 	ctx context.Context,
-	imagePath, volumeName, imageType string,
+	imagePath, volumeName, imageType, format string,
 	updater ProgressUpdater,
-) error {
+) (string, error) {
+	if format == "" {
+		format = m.VolumeFormat()
+	}
+	if err := ValidateVolumeFormat(format); err != nil {
+		return "", err
+	}
+
+	var written string
 	// Wrap with retry logic
-	err := retry.WithRetry(ctx, m.retryConfig, func() error {
-		return m.populateVolumeOnce(imagePath, volumeName, imageType, updater)
+	err := retry.WithRetry(ctx, withRetryLogging(m.convertRetry, "convert", volumeName), func() error {
+		var err error
+		written, err = m.populateVolumeOnce(ctx, imagePath, volumeName, imageType, format, updater)
+		return err
 	})
 	if err != nil {
-		return fmt.Errorf("failed to populate volume %s after retries: %w", volumeName, err)
+		return "", fmt.Errorf("failed to populate volume %s after retries: %w", volumeName, err)
 	}
-	return nil
+	return written, nil
 }
 
 // populateVolumeOnce performs a single volume population attempt
-func (m *Manager) populateVolumeOnce(imagePath, volumeName, imageType string, updater ProgressUpdater) error {
+func (m *Manager) populateVolumeOnce(ctx context.Context, imagePath, volumeName, imageType, format string,
+	updater ProgressUpdater) (string, error) {
+	if imageType != "qcow2" && imageType != "raw" {
+		return "", retry.Permanent(fmt.Errorf("unsupported image type: %s", imageType))
+	}
+
 	// Get the device path for the LVM volume
-	devicePath := fmt.Sprintf("/dev/%s/%s", m.vgName, volumeName)
+	devicePath := m.DevicePath(volumeName)
+
+	convertArgs := []string{"convert", "-f", imageType, "-O", format}
 
 	// Verify the device exists
-	//nolint:gosec,noctx // Device path from internal volume name; validation doesn't need context
-	if _, err := exec.Command("test", "-b", devicePath).CombinedOutput(); err != nil {
-		return fmt.Errorf("LVM volume device does not exist: %s", devicePath)
+	if m.files != nil {
+		if !m.files.volumeExists(volumeName) {
+			return "", fmt.Errorf("volume file does not exist: %s", devicePath)
+		}
+	} else {
+		//nolint:gosec,noctx // Device path from internal volume name; validation doesn't need context
+		if _, err := exec.Command("test", "-b", devicePath).CombinedOutput(); err != nil {
+			return "", fmt.Errorf("LVM volume device does not exist: %s", devicePath)
+		}
+	}
+	switch {
+	case format != FormatRaw:
+		// Convert into an image sized to the volume rather than one of the image's size
+		if err := m.createTargetImage(ctx, volumeName, format); err != nil {
+			return "", err
+		}
+		convertArgs = append(convertArgs, "-n")
+	case m.files != nil:
+		// Write into the volume's file rather than replacing it with one of the image's size
+		convertArgs = append(convertArgs, "-n")
 	}
 
 	logrus.WithFields(logrus.Fields{
-		"volume_name": volumeName,
-		"device_path": devicePath,
-		"image_path":  imagePath,
-		"image_type":  imageType,
+		"volume_name":   volumeName,
+		"device_path":   devicePath,
+		"image_path":    imagePath,
+		"image_type":    imageType,
+		"volume_format": format,
 	}).Info("Starting volume population")
 
 	// Convert image format if needed and copy to LVM volume
-	var cmd *exec.Cmd
-	switch imageType {
-	case "qcow2":
-		// Convert QCOW2 to raw format directly to LVM device
-		//nolint:gosec,noctx // Image path is provided by caller, device path is internal
-		cmd = exec.Command("qemu-img", "convert", "-f", "qcow2", "-O", "raw", imagePath, devicePath)
-	case "raw":
-		// Direct copy for raw images
-		//nolint:gosec,noctx // Image path is provided by caller, device path is internal
-		cmd = exec.Command("dd", "if="+imagePath, "of="+devicePath, "bs=4M", "status=progress", "conv=fdatasync")
-	default:
-		return fmt.Errorf("unsupported image type: %s", imageType)
+	written := ""
+	if imageType == "raw" && format == FormatRaw {
+		// Copy raw images directly, hashing the bytes written
+		checksum, err := copyRaw(ctx, imagePath, devicePath, m.copyOptions, updater)
+		if err != nil {
+			return "", fmt.Errorf("failed to populate LVM volume: %w", err)
+		}
+		written = checksum
+	} else {
+		// Convert the image directly onto the LVM device
+		cmd := m.command(context.Background(), "qemu-img", append(convertArgs, imagePath, devicePath)...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("failed to populate LVM volume: %w",
+				&CommandError{Command: "qemu-img", Output: string(output), Err: err})
+		}
+	}
+
+	// Update progress
+	if updater != nil {
+		updater.UpdateProgress("converting", 90, 0, 0)
+	}
+
+	return written, nil
+}
+
+// HashVolume returns the SHA256 checksum of the first length bytes of a volume, to
+// compare with the checksum of the data written to it
+func (m *Manager) HashVolume(ctx context.Context, volumeName string, length int64,
+	updater ProgressUpdater) (string, error) {
+	if !m.volumeExists(volumeName) {
+		return "", fmt.Errorf("volume %s does not exist", volumeName)
+	}
+	checksum, err := hashDevice(ctx, m.DevicePath(volumeName), length, m.copyOptions.BlockSize, updater)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash volume %s: %w", volumeName, err)
+	}
+	return checksum, nil
+}
+
+// MarkComplete removes the incomplete tag from a populated volume
+func (m *Manager) MarkComplete(volumeName string) error {
+	if m.backend != nil {
+		if err := m.backend.deleteTag(volumeName, IncompleteTag); err != nil {
+			return fmt.Errorf("failed to mark volume complete: %w", err)
+		}
+		return nil
 	}
 
-	// Execute conversion with progress tracking
+	cmd := m.command(context.Background(), "lvchange", "--deltag", IncompleteTag, fmt.Sprintf("%s/%s", m.vgName, volumeName))
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("failed to populate LVM volume: %w, output: %s", err, string(output))
+		return fmt.Errorf("failed to mark volume complete: %w", &CommandError{Command: "lvchange", Output: string(output), Err: err})
 	}
+	return nil
+}
 
-	// Update progress
-	if updater != nil {
-		updater.UpdateProgress("converting", 90, 0, 0)
+// IncompleteVolumes returns the volumes still tagged as incomplete
+func (m *Manager) IncompleteVolumes() ([]string, error) {
+	infos, err := m.volumeReport("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	var volumes []string
+	for _, info := range infos {
+		if info.HasTag(IncompleteTag) {
+			volumes = append(volumes, info.Name)
+		}
+	}
+	return volumes, nil
+}
+
+// SnapshotName returns the name of the snapshot taken of a volume before it is overwritten
+func SnapshotName(volumeName string) string {
+	return volumeName + "-lvp-snapshot"
+}
+
+// CreateSnapshot takes a snapshot of a volume, large enough to hold a complete
+// overwrite of it, and returns the snapshot's name
+func (m *Manager) CreateSnapshot(volumeName string) (string, error) {
+	snapshotName := SnapshotName(volumeName)
+	cmd := m.command(context.Background(), "lvcreate", "--snapshot", "-l", "100%ORIGIN", "-n", snapshotName,
+		fmt.Sprintf("%s/%s", m.vgName, volumeName))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot: %w", &CommandError{Command: "lvcreate", Output: string(output), Err: err})
 	}
+	return snapshotName, nil
+}
 
+// MergeSnapshot restores a volume to the state of its snapshot, removing the snapshot.
+// If the volume is open, LVM completes the merge when it is next activated.
+func (m *Manager) MergeSnapshot(snapshotName string) error {
+	cmd := m.command(context.Background(), "lvconvert", "--merge", fmt.Sprintf("%s/%s", m.vgName, snapshotName))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to merge snapshot: %w", &CommandError{Command: "lvconvert", Output: string(output), Err: err})
+	}
 	return nil
 }
 
@@ -204,12 +487,17 @@ func (m *Manager) DeleteVolume(volumeName string) error {
 	if !m.volumeExists(volumeName) {
 		return fmt.Errorf("volume %s does not exist", volumeName)
 	}
+	if m.backend != nil {
+		if err := m.backend.deleteVolume(volumeName); err != nil {
+			return fmt.Errorf("failed to delete LVM volume: %w", err)
+		}
+		return nil
+	}
 
-	//nolint:gosec,noctx // Volume name is validated internally
-	cmd := exec.Command("lvremove", "-f", fmt.Sprintf("%s/%s", m.vgName, volumeName))
+	cmd := m.command(context.Background(), "lvremove", "-f", fmt.Sprintf("%s/%s", m.vgName, volumeName))
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("failed to delete LVM volume: %w, output: %s", err, string(output))
+		return fmt.Errorf("failed to delete LVM volume: %w", &CommandError{Command: "lvremove", Output: string(output), Err: err})
 	}
 
 	return nil
@@ -221,69 +509,70 @@ func (m *Manager) GetVolumeInfo(volumeName string) (*VolumeInfo, error) {
 		return nil, fmt.Errorf("volume %s does not exist", volumeName)
 	}
 
-	fullPath := fmt.Sprintf("%s/%s", m.vgName, volumeName)
-	//nolint:gosec,noctx // Path constructed from internal volume name
-	cmd := exec.Command("lvs", "--units", "b", "--noheadings", "-o", "lv_name,lv_size,lv_attr", fullPath)
-	output, err := cmd.CombinedOutput()
+	infos, err := m.volumeReport(volumeName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get volume info: %w, output: %s", err, string(output))
+		return nil, fmt.Errorf("failed to get volume info: %w", err)
 	}
-
-	// Parse output
-	fields := strings.Fields(strings.TrimSpace(string(output)))
-	if len(fields) < 3 {
-		return nil, fmt.Errorf("unexpected lvs output format")
+	if len(infos) != 1 {
+		return nil, fmt.Errorf("lvs reported %d volumes for %s", len(infos), volumeName)
 	}
+	return &infos[0], nil
+}
 
-	sizeStr := strings.TrimSuffix(fields[1], "B")
-	sizeBytes, err := strconv.ParseInt(sizeStr, 10, 64)
+// ListVolumes returns a list of all LVM volumes in the volume group
+func (m *Manager) ListVolumes() ([]string, error) {
+	infos, err := m.volumeReport("")
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse volume size: %w", err)
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
 	}
 
-	return &VolumeInfo{
-		Name:       fields[0],
-		SizeBytes:  sizeBytes,
-		Attributes: fields[2],
-	}, nil
+	volumes := make([]string, 0, len(infos))
+	for _, info := range infos {
+		volumes = append(volumes, info.Name)
+	}
+	return volumes, nil
 }
 
-// ListVolumes returns a list of all LVM volumes in the volume group
-func (m *Manager) ListVolumes() ([]string, error) {
-	//nolint:gosec,noctx // Volume group name is controlled internally
-	cmd := exec.Command("lvs", "--noheadings", "-o", "lv_name", m.vgName)
-	output, err := cmd.CombinedOutput()
+// ListVolumeInfo returns information about every LVM volume in the volume group
+func (m *Manager) ListVolumeInfo() ([]VolumeInfo, error) {
+	infos, err := m.volumeReport("")
 	if err != nil {
-		return nil, fmt.Errorf("failed to list volumes: %w, output: %s", err, string(output))
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
 	}
+	return infos, nil
+}
 
-	var volumes []string
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	for _, line := range lines {
-		if volume := strings.TrimSpace(line); volume != "" {
-			volumes = append(volumes, volume)
-		}
-	}
+// VolumeExists reports whether an LVM volume exists in the volume group
+func (m *Manager) VolumeExists(volumeName string) bool {
+	return m.volumeExists(volumeName)
+}
 
-	return volumes, nil
+// DevicePath returns the block device path of an LVM volume, or its file if volumes
+// are kept as files
+func (m *Manager) DevicePath(volumeName string) string {
+	if m.files != nil {
+		return m.files.path(volumeName)
+	}
+	return fmt.Sprintf("/dev/%s/%s", m.vgName, volumeName)
 }
 
 // volumeExists checks if an LVM volume exists
 func (m *Manager) volumeExists(volumeName string) bool {
-	//nolint:gosec,noctx // Volume name is validated internally
-	cmd := exec.Command("lvs", fmt.Sprintf("%s/%s", m.vgName, volumeName))
+	if m.backend != nil {
+		return m.backend.volumeExists(volumeName)
+	}
+	cmd := m.command(context.Background(), "lvs", fmt.Sprintf("%s/%s", m.vgName, volumeName))
 	return cmd.Run() == nil
 }
 
 // validateExistingVolume checks if an existing volume is compatible for reuse
-func (m *Manager) validateExistingVolume(volumeName string, requiredSizeGB int) error {
+func (m *Manager) validateExistingVolume(volumeName string, requiredSizeBytes int64) error {
 	info, err := m.GetVolumeInfo(volumeName)
 	if err != nil {
 		return fmt.Errorf("failed to get volume info: %w", err)
 	}
 
 	// Check size (allow some tolerance for filesystem overhead)
-	requiredSizeBytes := int64(requiredSizeGB) * 1024 * 1024 * 1024
 	actualSizeBytes := info.SizeBytes
 
 	// Allow 5% variance for filesystem/formatting differences
@@ -313,4 +602,21 @@ type VolumeInfo struct {
 	Name       string
 	SizeBytes  int64
 	Attributes string
+	// Origin is the volume a snapshot was taken of
+	Origin string
+	// Pool is the thin pool of a thin volume
+	Pool string
+	// DataPercent is the space used by thin pools, thin volumes and snapshots, or nil for other volumes
+	DataPercent *float64
+	Tags        []string
+}
+
+// HasTag reports whether the volume carries an LVM tag
+func (v VolumeInfo) HasTag(tag string) bool {
+	return slices.Contains(v.Tags, tag)
+}
+
+// Open reports whether the volume's device is open, e.g. by a running VM
+func (v VolumeInfo) Open() bool {
+	return len(v.Attributes) > 5 && v.Attributes[5] == 'o'
 }
@@ -1,6 +1,9 @@
 package lvm
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -56,6 +59,10 @@ func TestVolumeInfo(t *testing.T) {
 	assert.Equal(t, "test-volume", info.Name)
 	assert.Equal(t, int64(1073741824), info.SizeBytes)
 	assert.Equal(t, "-wi-a-----", info.Attributes)
+	assert.False(t, info.Open())
+
+	info.Attributes = "-wi-ao----"
+	assert.True(t, info.Open())
 }
 
 // MockProgressUpdater for testing
@@ -77,6 +84,19 @@ func (m *MockProgressUpdater) UpdateProgress(stage string, percent float64, byte
 	}{stage, percent, bytesProcessed, bytesTotal})
 }
 
+func TestRetryableCommand(t *testing.T) {
+	commandErr := func(output string) error {
+		return fmt.Errorf("failed to create LVM volume: %w",
+			&CommandError{Command: "lvcreate", Output: output, Err: errors.New("exit status 5")})
+	}
+
+	assert.True(t, retryableCommand(commandErr("Can't get lock for vg0")))
+	assert.True(t, retryableCommand(errors.New("LVM volume device does not exist: /dev/vg0/vm01")))
+	assert.False(t, retryableCommand(commandErr(`Logical Volume "vm01" already exists in volume group "vg0"`)))
+	assert.False(t, retryableCommand(commandErr(`Volume group "vg0" has insufficient free space (10 extents): 2560 required.`)))
+	assert.False(t, retryableCommand(fmt.Errorf("retry cancelled: %w", context.Canceled)))
+}
+
 func TestMockProgressUpdater(t *testing.T) {
 	updater := &MockProgressUpdater{}
 
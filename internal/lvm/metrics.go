@@ -0,0 +1,259 @@
+package lvm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// metricsTimeout bounds the lvs and vgs calls made for a single scrape
+const metricsTimeout = 10 * time.Second
+
+var (
+	vgSizeDesc = prometheus.NewDesc(
+		"libvirt_volume_provisioner_lvm_vg_size_bytes",
+		"Size of the volume group",
+		[]string{"vg"}, nil,
+	)
+	vgFreeDesc = prometheus.NewDesc(
+		"libvirt_volume_provisioner_lvm_vg_free_bytes",
+		"Unallocated space in the volume group",
+		[]string{"vg"}, nil,
+	)
+	lvSizeDesc = prometheus.NewDesc(
+		"libvirt_volume_provisioner_lvm_lv_size_bytes",
+		"Size of the logical volume",
+		[]string{"vg", "lv", "type"}, nil,
+	)
+	lvDataPercentDesc = prometheus.NewDesc(
+		"libvirt_volume_provisioner_lvm_lv_data_percent",
+		"Percentage of data space used by thin pools, thin volumes and snapshots",
+		[]string{"vg", "lv", "type", "pool"}, nil,
+	)
+	lvMetadataPercentDesc = prometheus.NewDesc(
+		"libvirt_volume_provisioner_lvm_thin_pool_metadata_percent",
+		"Percentage of thin pool metadata space used",
+		[]string{"vg", "lv"}, nil,
+	)
+	scrapeSuccessDesc = prometheus.NewDesc(
+		"libvirt_volume_provisioner_lvm_scrape_success",
+		"Whether the last collection of LVM metrics succeeded",
+		[]string{"vg"}, nil,
+	)
+)
+
+// lvReport is a logical volume as reported by lvs for metrics
+type lvReport struct {
+	Name            string
+	Attributes      string
+	SizeBytes       float64
+	DataPercent     *float64
+	MetadataPercent *float64
+	Pool            string
+}
+
+// Type classifies the volume by the first character of its attributes
+func (r lvReport) Type() string {
+	if r.Attributes == "" {
+		return "linear"
+	}
+	switch r.Attributes[0] {
+	case 't':
+		return "thin-pool"
+	case 'V':
+		return "thin"
+	case 's', 'S':
+		return "snapshot"
+	case 'o':
+		return "origin"
+	default:
+		return "linear"
+	}
+}
+
+// vgReport is the volume group as reported by vgs for metrics
+type vgReport struct {
+	SizeBytes float64
+	FreeBytes float64
+}
+
+// Collector exports volume group and logical volume usage as Prometheus metrics.
+// LVM is queried on every scrape.
+type Collector struct {
+	manager *Manager
+}
+
+// NewCollector creates a collector for the manager's volume group
+func NewCollector(manager *Manager) *Collector {
+	return &Collector{manager: manager}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- vgSizeDesc
+	ch <- vgFreeDesc
+	ch <- lvSizeDesc
+	ch <- lvDataPercentDesc
+	ch <- lvMetadataPercentDesc
+	ch <- scrapeSuccessDesc
+	ch <- quotaDesc
+	ch <- multipathPathsDesc
+	ch <- multipathQueueDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	vg := c.manager.vgName
+	ctx, cancel := context.WithTimeout(context.Background(), metricsTimeout)
+	defer cancel()
+
+	vgInfo, err := c.manager.reportVolumeGroup(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to collect volume group metrics")
+		ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, 0, vg)
+		return
+	}
+	volumes, err := c.manager.reportVolumes(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to collect logical volume metrics")
+		ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, 0, vg)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(vgSizeDesc, prometheus.GaugeValue, vgInfo.SizeBytes, vg)
+	ch <- prometheus.MustNewConstMetric(vgFreeDesc, prometheus.GaugeValue, vgInfo.FreeBytes, vg)
+	c.manager.collectQuota(ch)
+	if c.manager.MultipathChecked() {
+		c.manager.collectMultipath(ctx, ch)
+	}
+
+	for _, lv := range volumes {
+		lvType := lv.Type()
+		ch <- prometheus.MustNewConstMetric(lvSizeDesc, prometheus.GaugeValue, lv.SizeBytes, vg, lv.Name, lvType)
+		if lv.DataPercent != nil {
+			ch <- prometheus.MustNewConstMetric(lvDataPercentDesc, prometheus.GaugeValue,
+				*lv.DataPercent, vg, lv.Name, lvType, lv.Pool)
+		}
+		if lvType == "thin-pool" && lv.MetadataPercent != nil {
+			ch <- prometheus.MustNewConstMetric(lvMetadataPercentDesc, prometheus.GaugeValue,
+				*lv.MetadataPercent, vg, lv.Name)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, 1, vg)
+}
+
+// reportVolumeGroup returns the size and free space of the volume group
+func (m *Manager) reportVolumeGroup(ctx context.Context) (*vgReport, error) {
+	if m.files != nil {
+		return m.files.volumeGroup()
+	}
+	cmd := m.command(ctx, "vgs", "--units", "b", "--nosuffix", "--noheadings",
+		"--separator", "|", "-o", "vg_size,vg_free", m.vgName)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, &CommandError{Command: "vgs", Output: string(output), Err: err}
+	}
+	return parseVGReport(string(output))
+}
+
+// reportVolumes returns the usage of every logical volume in the volume group
+func (m *Manager) reportVolumes(ctx context.Context) ([]lvReport, error) {
+	if m.files != nil {
+		volumes, err := m.files.listVolumes("")
+		if err != nil {
+			return nil, err
+		}
+		reports := make([]lvReport, 0, len(volumes))
+		for _, volume := range volumes {
+			reports = append(reports, lvReport{Name: volume.Name, Attributes: volume.Attributes,
+				SizeBytes: float64(volume.SizeBytes)})
+		}
+		return reports, nil
+	}
+	cmd := m.command(ctx, "lvs", "--units", "b", "--nosuffix", "--noheadings", "--separator", "|",
+		"-o", "lv_name,lv_attr,lv_size,data_percent,metadata_percent,pool_lv", m.vgName)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, &CommandError{Command: "lvs", Output: string(output), Err: err}
+	}
+	return parseLVReport(string(output))
+}
+
+// parseVGReport parses "size|free" vgs output
+func parseVGReport(output string) (*vgReport, error) {
+	fields := strings.Split(strings.TrimSpace(output), "|")
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("unexpected vgs output: %q", strings.TrimSpace(output))
+	}
+
+	size, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse volume group size: %w", err)
+	}
+	free, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse volume group free space: %w", err)
+	}
+
+	return &vgReport{SizeBytes: size, FreeBytes: free}, nil
+}
+
+// parseLVReport parses "name|attr|size|data%|metadata%|pool" lvs output, one volume per line.
+// The percentages are empty for volumes they do not apply to.
+func parseLVReport(output string) ([]lvReport, error) {
+	var reports []lvReport
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("unexpected lvs output line: %q", strings.TrimSpace(line))
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		size, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse size of volume %s: %w", fields[0], err)
+		}
+		dataPercent, err := parseOptionalPercent(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse data usage of volume %s: %w", fields[0], err)
+		}
+		metadataPercent, err := parseOptionalPercent(fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse metadata usage of volume %s: %w", fields[0], err)
+		}
+
+		reports = append(reports, lvReport{
+			Name:            fields[0],
+			Attributes:      fields[1],
+			SizeBytes:       size,
+			DataPercent:     dataPercent,
+			MetadataPercent: metadataPercent,
+			Pool:            fields[5],
+		})
+	}
+	return reports, nil
+}
+
+// parseOptionalPercent parses a percentage that lvs leaves empty when it does not apply
+func parseOptionalPercent(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil //nolint:nilnil // Not applicable to this volume
+	}
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &percent, nil
+}
@@ -0,0 +1,51 @@
+package lvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVGReport(t *testing.T) {
+	report, err := parseVGReport("  107374182400|21474836480\n")
+	require.NoError(t, err)
+	assert.Equal(t, float64(107374182400), report.SizeBytes)
+	assert.Equal(t, float64(21474836480), report.FreeBytes)
+
+	_, err = parseVGReport("garbage")
+	assert.Error(t, err)
+}
+
+func TestParseLVReport(t *testing.T) {
+	output := `  pool|twi-aotz--|53687091200|42.50|3.10|
+  vm-1|Vwi-a-tz--|10737418240|80.00||pool
+  vm-2|-wi-a-----|5368709120|||
+  vm-2-snap|swi-a-s---|1073741824|12.00||
+`
+	reports, err := parseLVReport(output)
+	require.NoError(t, err)
+	require.Len(t, reports, 4)
+
+	assert.Equal(t, "pool", reports[0].Name)
+	assert.Equal(t, "thin-pool", reports[0].Type())
+	require.NotNil(t, reports[0].DataPercent)
+	assert.InDelta(t, 42.5, *reports[0].DataPercent, 0.001)
+	require.NotNil(t, reports[0].MetadataPercent)
+	assert.InDelta(t, 3.1, *reports[0].MetadataPercent, 0.001)
+
+	assert.Equal(t, "thin", reports[1].Type())
+	assert.Equal(t, "pool", reports[1].Pool)
+	assert.Nil(t, reports[1].MetadataPercent)
+
+	assert.Equal(t, "linear", reports[2].Type())
+	assert.Equal(t, float64(5368709120), reports[2].SizeBytes)
+	assert.Nil(t, reports[2].DataPercent)
+
+	assert.Equal(t, "snapshot", reports[3].Type())
+	require.NotNil(t, reports[3].DataPercent)
+	assert.InDelta(t, 12.0, *reports[3].DataPercent, 0.001)
+
+	_, err = parseLVReport("vm-1|-wi-a-----|notanumber|||")
+	assert.Error(t, err)
+}
@@ -0,0 +1,359 @@
+package lvm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// multipathTimeout bounds checking the multipath devices, as listing physical volumes
+// may itself hang on a device that queues I/O without a path
+const multipathTimeout = 30 * time.Second
+
+var (
+	multipathPathsDesc = prometheus.NewDesc(
+		"libvirt_volume_provisioner_multipath_paths",
+		"Paths of the multipath devices under the volume group, by state",
+		[]string{"vg", "device", "state"}, nil,
+	)
+	multipathQueueDesc = prometheus.NewDesc(
+		"libvirt_volume_provisioner_multipath_queue_if_no_path",
+		"Whether a multipath device under the volume group queues I/O while it has no active path",
+		[]string{"vg", "device"}, nil,
+	)
+)
+
+// MultipathCheck configures checking the multipath devices the volume group's physical
+// volumes are on before volumes are written, for volume groups on SAN storage
+type MultipathCheck struct {
+	// MinPaths is the fewest active paths each device must have; zero disables the check
+	MinPaths int
+	// RefuseQueueIfNoPath refuses to write to devices queueing I/O while they have no
+	// active path (queue_if_no_path), where losing the last path hangs a write rather
+	// than failing it
+	RefuseQueueIfNoPath bool
+}
+
+// MultipathDevice is the state of a device-mapper multipath device
+type MultipathDevice struct {
+	Name        string
+	ActivePaths int
+	TotalPaths  int
+	// QueueIfNoPath is set if the device queues I/O while it has no active path
+	QueueIfNoPath bool
+}
+
+// MultipathError is returned when a multipath device under the volume group has too
+// few active paths, or queues I/O without a path when that is refused
+type MultipathError struct {
+	VolumeGroup string
+	Device      MultipathDevice
+	MinPaths    int
+}
+
+func (e *MultipathError) Error() string {
+	if e.Device.ActivePaths < e.MinPaths {
+		return fmt.Sprintf("multipath device %s of volume group %s has %d of %d paths active, fewer than %d",
+			e.Device.Name, e.VolumeGroup, e.Device.ActivePaths, e.Device.TotalPaths, e.MinPaths)
+	}
+	return fmt.Sprintf("multipath device %s of volume group %s queues I/O when no path is active (queue_if_no_path)",
+		e.Device.Name, e.VolumeGroup)
+}
+
+// SetMultipathCheck configures checking the paths of the multipath devices under the
+// volume group before volumes are created
+func (m *Manager) SetMultipathCheck(check MultipathCheck) error {
+	if check.MinPaths < 0 {
+		return fmt.Errorf("invalid minimum of %d multipath paths", check.MinPaths)
+	}
+	if check.MinPaths == 0 && check.RefuseQueueIfNoPath {
+		return errors.New("refusing queue_if_no_path devices requires a minimum number of multipath paths")
+	}
+	if check.MinPaths > 0 && m.files != nil {
+		return errors.New("multipath devices cannot be checked for volumes kept as files")
+	}
+	m.multipath = check
+	return nil
+}
+
+// MultipathChecked reports whether the multipath devices are checked before volumes are created
+func (m *Manager) MultipathChecked() bool {
+	return m.multipath.MinPaths > 0
+}
+
+// CheckPaths returns a MultipathError if a multipath device under the volume group has
+// fewer active paths than configured, as writes to a device without a working path
+// hang rather than fail. Devices that have lost some paths are logged.
+func (m *Manager) CheckPaths(ctx context.Context) error {
+	if !m.MultipathChecked() {
+		return nil
+	}
+	devices, err := m.MultipathDevices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check multipath paths: %w", err)
+	}
+	return m.checkPaths(devices)
+}
+
+// checkPaths checks the paths of the multipath devices under the volume group
+func (m *Manager) checkPaths(devices []MultipathDevice) error {
+	for _, device := range devices {
+		if device.ActivePaths < m.multipath.MinPaths || (device.QueueIfNoPath && m.multipath.RefuseQueueIfNoPath) {
+			return &MultipathError{VolumeGroup: m.vgName, Device: device, MinPaths: m.multipath.MinPaths}
+		}
+		if device.ActivePaths < device.TotalPaths {
+			logrus.WithFields(logrus.Fields{
+				"volume_group": m.vgName,
+				"device":       device.Name,
+				"active_paths": device.ActivePaths,
+				"total_paths":  device.TotalPaths,
+			}).Warn("Multipath device has lost paths")
+		}
+	}
+	return nil
+}
+
+// CheckMultipathDevices reports the paths of the multipath devices under the volume
+// group, failing if one has too few active paths or none of its physical volumes is on one
+func (m *Manager) CheckMultipathDevices(ctx context.Context) (string, error) {
+	devices, err := m.MultipathDevices(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(devices) == 0 {
+		return "", fmt.Errorf("no physical volume of volume group %s is on a multipath device", m.vgName)
+	}
+	if err := m.checkPaths(devices); err != nil {
+		return "", err
+	}
+
+	active, total := 0, 0
+	var queueing []string
+	for _, device := range devices {
+		active += device.ActivePaths
+		total += device.TotalPaths
+		if device.QueueIfNoPath {
+			queueing = append(queueing, device.Name)
+		}
+	}
+	detail := fmt.Sprintf("%d multipath devices, %d of %d paths active", len(devices), active, total)
+	if len(queueing) > 0 {
+		detail += "; queue_if_no_path on " + strings.Join(queueing, ", ")
+	}
+	return detail, nil
+}
+
+// MultipathDevices returns the multipath devices the physical volumes of the volume group are on
+func (m *Manager) MultipathDevices(ctx context.Context) ([]MultipathDevice, error) {
+	ctx, cancel := context.WithTimeout(ctx, multipathTimeout)
+	defer cancel()
+
+	output, err := m.command(ctx, "pvs", "--noheadings", "-o", "pv_name", "--select", "vg_name="+m.vgName).
+		CombinedOutput()
+	if err != nil {
+		return nil, &CommandError{Command: "pvs", Output: string(output), Err: err}
+	}
+	pvs := strings.Fields(string(output))
+	if len(pvs) == 0 {
+		return nil, fmt.Errorf("volume group %s has no physical volumes", m.vgName)
+	}
+
+	// The physical volumes may be on partitions of multipath devices
+	args := append([]string{"-s", "-n", "-l", "-o", "NAME,TYPE"}, pvs...)
+	//nolint:gosec // Physical volume paths are listed by pvs
+	output, err = exec.CommandContext(ctx, "lsblk", args...).CombinedOutput()
+	if err != nil {
+		return nil, &CommandError{Command: "lsblk", Output: string(output), Err: err}
+	}
+	names := parseMultipathNames(string(output))
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	status, err := m.command(ctx, "dmsetup", "status", "--target", "multipath").CombinedOutput()
+	if err != nil {
+		return nil, &CommandError{Command: "dmsetup", Output: string(status), Err: err}
+	}
+	table, err := m.command(ctx, "dmsetup", "table", "--target", "multipath").CombinedOutput()
+	if err != nil {
+		return nil, &CommandError{Command: "dmsetup", Output: string(table), Err: err}
+	}
+	paths, err := parseMultipathStatus(string(status))
+	if err != nil {
+		return nil, err
+	}
+	queueing, err := parseMultipathTable(string(table))
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]MultipathDevice, 0, len(names))
+	for _, name := range names {
+		device, ok := paths[name]
+		if !ok {
+			return nil, fmt.Errorf("multipath device %s has no status", name)
+		}
+		device.QueueIfNoPath = queueing[name]
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// collectMultipath exports the paths of the multipath devices under the volume group
+func (m *Manager) collectMultipath(ctx context.Context, ch chan<- prometheus.Metric) {
+	devices, err := m.MultipathDevices(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to collect multipath metrics")
+		return
+	}
+	for _, device := range devices {
+		ch <- prometheus.MustNewConstMetric(multipathPathsDesc, prometheus.GaugeValue,
+			float64(device.ActivePaths), m.vgName, device.Name, "active")
+		ch <- prometheus.MustNewConstMetric(multipathPathsDesc, prometheus.GaugeValue,
+			float64(device.TotalPaths-device.ActivePaths), m.vgName, device.Name, "failed")
+		queueing := 0.0
+		if device.QueueIfNoPath {
+			queueing = 1
+		}
+		ch <- prometheus.MustNewConstMetric(multipathQueueDesc, prometheus.GaugeValue, queueing, m.vgName, device.Name)
+	}
+}
+
+// parseMultipathNames returns the multipath devices in lsblk -s -l -o NAME,TYPE output,
+// which lists each physical volume and the devices it is on
+func parseMultipathNames(output string) []string {
+	var names []string
+	for line := range strings.Lines(output) {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == "mpath" && !slices.Contains(names, fields[0]) {
+			names = append(names, fields[0])
+		}
+	}
+	return names
+}
+
+// parseMultipathStatus counts the paths of each device in dmsetup status --target multipath
+// output, such as "mpatha: 0 209715200 multipath 2 0 0 0 1 1 A 0 2 0 8:16 A 0 8:32 F 1"
+func parseMultipathStatus(output string) (map[string]MultipathDevice, error) {
+	devices := make(map[string]MultipathDevice)
+	for line := range strings.Lines(output) {
+		name, fields, ok := multipathTarget(line)
+		if !ok {
+			continue
+		}
+		r := &fieldReader{fields: fields}
+		r.skip(r.count()) // features
+		r.skip(r.count()) // hardware handler
+		groups := r.count()
+		r.next() // next path group
+		device := MultipathDevice{Name: name}
+		for range groups {
+			r.next() // group state
+			r.skip(r.count())
+			paths, pathArgs := r.count(), r.count()
+			for range paths {
+				r.next() // path device
+				if r.next() == "A" {
+					device.ActivePaths++
+				}
+				r.next() // fail count
+				r.skip(pathArgs)
+				device.TotalPaths++
+				if r.err != nil {
+					break
+				}
+			}
+			if r.err != nil {
+				break
+			}
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("unexpected dmsetup status output: %q", strings.TrimSpace(line))
+		}
+		devices[name] = device
+	}
+	return devices, nil
+}
+
+// parseMultipathTable returns whether each device queues I/O without a path from dmsetup
+// table --target multipath output, such as "mpatha: 0 209715200 multipath 1 queue_if_no_path ..."
+func parseMultipathTable(output string) (map[string]bool, error) {
+	queueing := make(map[string]bool)
+	for line := range strings.Lines(output) {
+		name, fields, ok := multipathTarget(line)
+		if !ok {
+			continue
+		}
+		r := &fieldReader{fields: fields}
+		features := r.count()
+		for range features {
+			if r.next() == "queue_if_no_path" {
+				queueing[name] = true
+			}
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("unexpected dmsetup table output: %q", strings.TrimSpace(line))
+		}
+	}
+	return queueing, nil
+}
+
+// multipathTarget splits a "name: start length multipath args..." line of dmsetup output
+// into the device name and the target's arguments
+func multipathTarget(line string) (string, []string, bool) {
+	name, rest, ok := strings.Cut(strings.TrimSpace(line), ": ")
+	if !ok {
+		return "", nil, false // e.g. "No devices found"
+	}
+	fields := strings.Fields(rest)
+	if len(fields) < 3 || fields[2] != "multipath" {
+		return "", nil, false
+	}
+	return name, fields[3:], true
+}
+
+// fieldReader reads the fields of device-mapper status and table lines, which are
+// counts followed by that many arguments. The first error is kept in err.
+type fieldReader struct {
+	fields []string
+	err    error
+}
+
+// next returns the next field
+func (r *fieldReader) next() string {
+	if len(r.fields) == 0 {
+		r.err = errors.New("too few fields")
+		return ""
+	}
+	field := r.fields[0]
+	r.fields = r.fields[1:]
+	return field
+}
+
+// count returns the next field as a count
+func (r *fieldReader) count() int {
+	n, err := strconv.Atoi(r.next())
+	if err != nil || n < 0 {
+		r.err = errors.New("invalid count")
+		return 0
+	}
+	return n
+}
+
+// skip skips n fields
+func (r *fieldReader) skip(n int) {
+	if n > len(r.fields) {
+		r.err = errors.New("too few fields")
+		r.fields = nil
+		return
+	}
+	r.fields = r.fields[n:]
+}
@@ -0,0 +1,82 @@
+package lvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMultipathCheck(t *testing.T) {
+	m := &Manager{vgName: "san"}
+	assert.False(t, m.MultipathChecked())
+	require.NoError(t, m.SetMultipathCheck(MultipathCheck{MinPaths: 2, RefuseQueueIfNoPath: true}))
+	assert.True(t, m.MultipathChecked())
+
+	assert.Error(t, m.SetMultipathCheck(MultipathCheck{MinPaths: -1}))
+	assert.Error(t, m.SetMultipathCheck(MultipathCheck{RefuseQueueIfNoPath: true}))
+
+	files := &Manager{vgName: "dev", files: &fileBackend{}}
+	assert.Error(t, files.SetMultipathCheck(MultipathCheck{MinPaths: 1}))
+	assert.NoError(t, files.SetMultipathCheck(MultipathCheck{}))
+}
+
+func TestParseMultipathNames(t *testing.T) {
+	// A physical volume on a partition of a multipath device, listed with the devices it is on
+	output := "mpatha-part1 part\nmpatha       mpath\nsdb          disk\nmpatha       mpath\nsdc          disk\n" +
+		"mpathb       mpath\nsdd          disk\n"
+	assert.Equal(t, []string{"mpatha", "mpathb"}, parseMultipathNames(output))
+	assert.Empty(t, parseMultipathNames("sda2 part\nsda  disk\n"))
+}
+
+func TestParseMultipathStatus(t *testing.T) {
+	output := "mpatha: 0 209715200 multipath 2 0 0 0 1 1 A 0 2 0 8:16 A 0 8:32 F 1 \n" +
+		// Two path groups, the service-time selector reporting two arguments per path
+		"mpathb: 0 104857600 multipath 2 0 0 0 2 1 A 0 1 2 8:48 A 0 0 1 E 0 1 2 8:64 A 0 0 1 \n"
+	devices, err := parseMultipathStatus(output)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]MultipathDevice{
+		"mpatha": {Name: "mpatha", ActivePaths: 1, TotalPaths: 2},
+		"mpathb": {Name: "mpathb", ActivePaths: 2, TotalPaths: 2},
+	}, devices)
+
+	devices, err = parseMultipathStatus("No devices found\n")
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+
+	_, err = parseMultipathStatus("mpatha: 0 209715200 multipath 2 0 0 0 1 1 A 0 2 0 8:16 A\n")
+	assert.Error(t, err)
+}
+
+func TestParseMultipathTable(t *testing.T) {
+	output := "mpatha: 0 209715200 multipath 1 queue_if_no_path 1 alua 1 1 service-time 0 2 1 8:16 1 8:32 1 \n" +
+		"mpathb: 0 104857600 multipath 0 0 1 1 service-time 0 1 1 8:48 1 \n"
+	queueing, err := parseMultipathTable(output)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"mpatha": true}, queueing)
+
+	_, err = parseMultipathTable("mpatha: 0 209715200 multipath x\n")
+	assert.Error(t, err)
+}
+
+func TestCheckPaths(t *testing.T) {
+	m := &Manager{vgName: "san"}
+	require.NoError(t, m.SetMultipathCheck(MultipathCheck{MinPaths: 2}))
+
+	healthy := MultipathDevice{Name: "mpatha", ActivePaths: 4, TotalPaths: 4, QueueIfNoPath: true}
+	degraded := MultipathDevice{Name: "mpathb", ActivePaths: 2, TotalPaths: 4}
+	assert.NoError(t, m.checkPaths([]MultipathDevice{healthy, degraded}))
+
+	failing := MultipathDevice{Name: "mpathc", ActivePaths: 1, TotalPaths: 4}
+	err := m.checkPaths([]MultipathDevice{healthy, failing})
+	var multipath *MultipathError
+	require.ErrorAs(t, err, &multipath)
+	assert.Equal(t, "mpathc", multipath.Device.Name)
+	assert.EqualError(t, err, "multipath device mpathc of volume group san has 1 of 4 paths active, fewer than 2")
+
+	require.NoError(t, m.SetMultipathCheck(MultipathCheck{MinPaths: 2, RefuseQueueIfNoPath: true}))
+	err = m.checkPaths([]MultipathDevice{degraded, healthy})
+	require.ErrorAs(t, err, &multipath)
+	assert.EqualError(t, err,
+		"multipath device mpatha of volume group san queues I/O when no path is active (queue_if_no_path)")
+}
@@ -0,0 +1,97 @@
+package lvm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// requiredPrivilegedCommands are the commands every job may run through the
+// privilege wrapper. mkfs, mkswap and virt-resize are only run for some requests.
+var requiredPrivilegedCommands = []string{
+	"lvm", "lvcreate", "lvchange", "lvremove", "lvconvert", "lvs", "vgs", "pvs", "qemu-img",
+}
+
+// accessWrite is W_OK, checking write permission with access(2)
+const accessWrite = 0x2
+
+// ParseWrapper splits a privilege wrapper command, such as "sudo -n", into its arguments
+func ParseWrapper(wrapper string) ([]string, error) {
+	args := strings.Fields(wrapper)
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, fmt.Errorf("privilege wrapper %s not found: %w", args[0], err)
+	}
+	return args, nil
+}
+
+// command returns a command that runs through the privilege wrapper, if one is
+// configured. Errors still name the command itself, not the wrapper.
+func (m *Manager) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if len(m.wrapper) == 0 {
+		return exec.CommandContext(ctx, name, args...)
+	}
+	wrapped := append(slices.Clone(m.wrapper[1:]), name)
+	//nolint:gosec // The wrapper is configured by the administrator
+	return exec.CommandContext(ctx, m.wrapper[0], append(wrapped, args...)...)
+}
+
+// CheckPrivileges verifies that the commands jobs run are allowed through the
+// privilege wrapper, that LVM can read the volume group, and that the provisioner
+// can write to volumes itself, as raw images are copied without a command
+func (m *Manager) CheckPrivileges(ctx context.Context) (string, error) {
+	if m.files != nil {
+		return "volumes kept as files, no privileges needed", nil
+	}
+	var denied []string
+	for _, name := range requiredPrivilegedCommands {
+		if output, err := m.command(ctx, name, "--version").CombinedOutput(); err != nil {
+			denied = append(denied, fmt.Sprintf("%s (%s)", name, firstLine(string(output), err)))
+		}
+	}
+	if len(denied) > 0 {
+		return "", fmt.Errorf("cannot run: %s", strings.Join(denied, "; "))
+	}
+
+	// LVM commands run without root privileges do not see the volume group
+	if _, err := m.reportVolumeGroup(ctx); err != nil {
+		return "", fmt.Errorf("LVM commands cannot read volume group %s, they need root privileges: %w", m.vgName, err)
+	}
+
+	detail := "running as root"
+	if uid := os.Geteuid(); uid != 0 {
+		detail = fmt.Sprintf("running as uid %d", uid)
+		if len(m.wrapper) > 0 {
+			detail += " with " + strings.Join(m.wrapper, " ")
+		}
+		// Volumes are created root:disk, so the provisioner must be in their group to copy to them
+		volumes, err := m.volumeReport("")
+		if err != nil {
+			return "", fmt.Errorf("failed to list volumes: %w", err)
+		}
+		if len(volumes) == 0 {
+			return detail + ", no volume to check write access to", nil
+		}
+		device := m.DevicePath(volumes[0].Name)
+		if err := syscall.Access(device, accessWrite); err != nil {
+			return "", fmt.Errorf("uid %d cannot write to volume %s, add it to the group owning the volume devices: %w",
+				uid, device, err)
+		}
+	}
+	return detail, nil
+}
+
+// firstLine returns the first line of a command's output, or err if there is none
+func firstLine(output string, err error) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	if line == "" {
+		return err.Error()
+	}
+	return line
+}
@@ -0,0 +1,48 @@
+package lvm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWrapper(t *testing.T) {
+	wrapper, err := ParseWrapper("")
+	require.NoError(t, err)
+	assert.Nil(t, wrapper)
+
+	wrapper, err = ParseWrapper("  env  LC_ALL=C ")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"env", "LC_ALL=C"}, wrapper)
+
+	_, err = ParseWrapper("no-such-wrapper -n")
+	assert.ErrorContains(t, err, "privilege wrapper no-such-wrapper not found")
+}
+
+func TestCommand(t *testing.T) {
+	m := &Manager{vgName: "data"}
+	cmd := m.command(context.Background(), "lvs", "data/vm01-root")
+	assert.Equal(t, []string{"lvs", "data/vm01-root"}, cmd.Args)
+
+	// The wrapper's options come before the command
+	m.wrapper = []string{"sudo", "-n"}
+	cmd = m.command(context.Background(), "lvs", "data/vm01-root")
+	assert.Equal(t, []string{"sudo", "-n", "lvs", "data/vm01-root"}, cmd.Args)
+	assert.Equal(t, []string{"sudo", "-n"}, m.wrapper)
+
+	// Commands run through the wrapper
+	m.wrapper = []string{"env", "LVP_WRAPPED=1"}
+	output, err := m.command(context.Background(), "sh", "-c", "echo $LVP_WRAPPED").Output()
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", string(output))
+}
+
+func TestFirstLine(t *testing.T) {
+	err := errors.New("exit status 1")
+	assert.Equal(t, "sudo: a password is required",
+		firstLine("sudo: a password is required\nmore\n", err))
+	assert.Equal(t, "exit status 1", firstLine("  \n", err))
+}
@@ -0,0 +1,116 @@
+package lvm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Quota levels, as reported by quotaExceededTotal and quotaDesc
+const (
+	quotaSoft = "soft"
+	quotaHard = "hard"
+)
+
+var (
+	quotaExceededTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "libvirt_volume_provisioner_lvm_quota_exceeded_total",
+			Help: "Total number of new volumes that would take the volume group above a quota, by quota",
+		},
+		[]string{"vg", "quota"},
+	)
+	quotaDesc = prometheus.NewDesc(
+		"libvirt_volume_provisioner_lvm_vg_quota_percent",
+		"Percentage of the volume group new volumes may allocate, by quota",
+		[]string{"vg", "quota"}, nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(quotaExceededTotal)
+}
+
+// Quota limits how much of the volume group new volumes may allocate, protecting
+// the space used by running VMs from large rollouts. Zero disables a limit.
+type Quota struct {
+	// SoftPercent logs a warning when a new volume takes allocation above it
+	SoftPercent float64
+	// HardPercent refuses new volumes that would take allocation above it
+	HardPercent float64
+}
+
+// QuotaError is returned for a volume that would take the allocation of the volume
+// group above its hard quota
+type QuotaError struct {
+	VolumeGroup      string
+	ProjectedPercent float64
+	HardPercent      float64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("volume would take allocation of volume group %s to %.1f%%, above its %.1f%% quota",
+		e.VolumeGroup, e.ProjectedPercent, e.HardPercent)
+}
+
+// SetQuota sets the quotas on the allocation of the volume group
+func (m *Manager) SetQuota(quota Quota) error {
+	for _, percent := range []float64{quota.SoftPercent, quota.HardPercent} {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("invalid quota %.1f%%, must be between 0 and 100", percent)
+		}
+	}
+	if quota.SoftPercent > 0 && quota.HardPercent > 0 && quota.SoftPercent > quota.HardPercent {
+		return fmt.Errorf("soft quota %.1f%% is above the hard quota %.1f%%", quota.SoftPercent, quota.HardPercent)
+	}
+	m.quota = quota
+	return nil
+}
+
+// CheckQuota returns a QuotaError if a new volume of sizeBytes would take the allocation
+// of the volume group above its hard quota, and logs a warning if it would exceed
+// the soft quota
+func (m *Manager) CheckQuota(ctx context.Context, sizeBytes int64) error {
+	if m.quota == (Quota{}) {
+		return nil
+	}
+	vg, err := m.reportVolumeGroup(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check volume group quota: %w", err)
+	}
+	return m.checkQuota(vg, float64(sizeBytes))
+}
+
+// checkQuota checks the allocation of the volume group after adding sizeBytes
+func (m *Manager) checkQuota(vg *vgReport, sizeBytes float64) error {
+	if vg.SizeBytes <= 0 {
+		return nil
+	}
+	projected := (vg.SizeBytes - vg.FreeBytes + sizeBytes) / vg.SizeBytes * 100
+
+	if m.quota.HardPercent > 0 && projected > m.quota.HardPercent {
+		quotaExceededTotal.WithLabelValues(m.vgName, quotaHard).Inc()
+		return &QuotaError{VolumeGroup: m.vgName, ProjectedPercent: projected, HardPercent: m.quota.HardPercent}
+	}
+	if m.quota.SoftPercent > 0 && projected > m.quota.SoftPercent {
+		quotaExceededTotal.WithLabelValues(m.vgName, quotaSoft).Inc()
+		logrus.WithFields(logrus.Fields{
+			"volume_group":      m.vgName,
+			"projected_percent": fmt.Sprintf("%.1f", projected),
+			"soft_quota":        m.quota.SoftPercent,
+		}).Warn("New volume takes volume group above its soft quota")
+	}
+	return nil
+}
+
+// collectQuota exports the configured quotas, for alerting on allocation approaching them
+func (m *Manager) collectQuota(ch chan<- prometheus.Metric) {
+	if m.quota.SoftPercent > 0 {
+		ch <- prometheus.MustNewConstMetric(quotaDesc, prometheus.GaugeValue, m.quota.SoftPercent, m.vgName, quotaSoft)
+	}
+	if m.quota.HardPercent > 0 {
+		ch <- prometheus.MustNewConstMetric(quotaDesc, prometheus.GaugeValue, m.quota.HardPercent, m.vgName, quotaHard)
+	}
+}
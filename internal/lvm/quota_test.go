@@ -0,0 +1,57 @@
+package lvm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetQuota(t *testing.T) {
+	m := &Manager{vgName: "data"}
+	require.NoError(t, m.SetQuota(Quota{SoftPercent: 80, HardPercent: 95}))
+	require.NoError(t, m.SetQuota(Quota{SoftPercent: 80}))
+
+	assert.Error(t, m.SetQuota(Quota{HardPercent: 101}))
+	assert.Error(t, m.SetQuota(Quota{SoftPercent: -1}))
+	assert.Error(t, m.SetQuota(Quota{SoftPercent: 95, HardPercent: 80}))
+}
+
+func TestCheckQuota(t *testing.T) {
+	m := &Manager{vgName: "data"}
+	require.NoError(t, m.SetQuota(Quota{SoftPercent: 80, HardPercent: 95}))
+
+	// 100 GiB volume group with 30 GiB free, so 70% allocated
+	vg := &vgReport{SizeBytes: 100 << 30, FreeBytes: 30 << 30}
+	assert.NoError(t, m.checkQuota(vg, 5<<30))
+	// Above the soft quota only warns
+	assert.NoError(t, m.checkQuota(vg, 20<<30))
+	assert.NoError(t, m.checkQuota(vg, 25<<30))
+
+	err := m.checkQuota(vg, 26<<30)
+	var quota *QuotaError
+	require.ErrorAs(t, err, &quota)
+	assert.Equal(t, "data", quota.VolumeGroup)
+	assert.InDelta(t, 96.0, quota.ProjectedPercent, 0.001)
+	assert.InDelta(t, 95.0, quota.HardPercent, 0.001)
+	assert.EqualError(t, err, "volume would take allocation of volume group data to 96.0%, above its 95.0% quota")
+}
+
+func TestCheckQuotaQueriesVolumeGroup(t *testing.T) {
+	// A wrapper standing in for vgs reports a 100 GiB volume group with 10 GiB free
+	vgs := filepath.Join(t.TempDir(), "vgs")
+	//nolint:gosec // The script must be executable
+	require.NoError(t, os.WriteFile(vgs, []byte("#!/bin/sh\necho '  107374182400|10737418240'\n"), 0o700))
+	m := &Manager{vgName: "data", wrapper: []string{vgs}}
+
+	// Without quotas, the volume group is not queried
+	assert.NoError(t, m.CheckQuota(context.Background(), 50<<30))
+
+	require.NoError(t, m.SetQuota(Quota{HardPercent: 95}))
+	assert.NoError(t, m.CheckQuota(context.Background(), 5<<30))
+	var quota *QuotaError
+	assert.ErrorAs(t, m.CheckQuota(context.Background(), 6<<30), &quota)
+}
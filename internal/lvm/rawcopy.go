@@ -0,0 +1,303 @@
+package lvm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+)
+
+// directAlignment is the alignment O_DIRECT requires of buffers, offsets and lengths
+const directAlignment = 4096
+
+// maxCopyBlockSize is the largest block size raw images can be copied in
+const maxCopyBlockSize = 64 << 20
+
+// errZeroOutUnsupported is returned by zeroOut for devices that cannot zero ranges
+var errZeroOutUnsupported = errors.New("zeroing ranges is not supported")
+
+// CopyOptions configures how raw images are copied to volumes
+type CopyOptions struct {
+	// BlockSize is the size of each read and write, a multiple of 4 KiB
+	BlockSize int
+	// Direct writes to the volume with O_DIRECT, bypassing the page cache so a large
+	// copy does not evict the cache of running VMs
+	Direct bool
+	// Sparse zeroes all-zero blocks of the image with a zero-out request to the
+	// device instead of writing them, which thin volumes and SSDs complete without
+	// writing any data
+	Sparse bool
+}
+
+// DefaultCopyOptions returns the options raw images are copied with by default
+func DefaultCopyOptions() CopyOptions {
+	return CopyOptions{BlockSize: 4 << 20, Direct: true, Sparse: true}
+}
+
+// Validate checks the block size is usable with O_DIRECT
+func (o CopyOptions) Validate() error {
+	if o.BlockSize < directAlignment || o.BlockSize > maxCopyBlockSize || o.BlockSize%directAlignment != 0 {
+		return fmt.Errorf("block size %d must be a multiple of %d between %d and %d bytes",
+			o.BlockSize, directAlignment, directAlignment, maxCopyBlockSize)
+	}
+	return nil
+}
+
+// copyRaw writes a raw image to a device, flushing it to disk, and returns the SHA256
+// checksum of the bytes written. Unlike dd's exit status, the checksum shows that
+// every byte of the image reached the device.
+func copyRaw(ctx context.Context, imagePath, devicePath string, opts CopyOptions,
+	updater ProgressUpdater) (string, error) {
+	if opts.BlockSize == 0 {
+		opts.BlockSize = DefaultCopyOptions().BlockSize
+	}
+
+	src, err := os.Open(imagePath) // #nosec G304 -- Image path is a cached image
+	if err != nil {
+		return "", fmt.Errorf("failed to open image: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	info, err := src.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat image: %w", err)
+	}
+	total := info.Size()
+
+	dst, direct, err := openDevice(devicePath, opts.Direct)
+	if err != nil {
+		return "", fmt.Errorf("failed to open volume: %w", err)
+	}
+	if opts.Direct && !direct {
+		logrus.WithField("device_path", devicePath).Debug("Volume does not support O_DIRECT, writing through the page cache")
+	}
+	writer := &deviceWriter{file: dst, path: devicePath, direct: direct, blockSize: opts.BlockSize}
+	defer writer.close()
+
+	hasher := sha256.New()
+	buffer := alignedBuffer(opts.BlockSize)
+	var offset int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("context cancelled: %w", err)
+		}
+
+		// Full blocks keep every write but the last aligned for O_DIRECT
+		n, readErr := io.ReadFull(src, buffer)
+		if n > 0 {
+			block := buffer[:n]
+			hasher.Write(block)
+			if opts.Sparse && n%directAlignment == 0 && isZero(block) {
+				err = writer.zero(offset, int64(n))
+			} else {
+				err = writer.writeAt(block, offset)
+			}
+			if err != nil {
+				return "", err
+			}
+			offset += int64(n)
+			if updater != nil && total > 0 {
+				updater.UpdateProgress("converting", 75+float64(offset)/float64(total)*15, offset, total)
+			}
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return "", fmt.Errorf("failed to read image at byte %d: %w", offset, readErr)
+		}
+	}
+
+	if offset != total {
+		return "", fmt.Errorf("copy incomplete: wrote %d bytes, image has %d", offset, total)
+	}
+	if err := writer.finish(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// hashDevice returns the SHA256 checksum of the first length bytes of a device,
+// failing if the device is shorter
+func hashDevice(ctx context.Context, devicePath string, length int64, blockSize int,
+	updater ProgressUpdater) (string, error) {
+	if blockSize == 0 {
+		blockSize = DefaultCopyOptions().BlockSize
+	}
+
+	device, err := os.Open(devicePath) // #nosec G304 -- Device path is internal
+	if err != nil {
+		return "", fmt.Errorf("failed to open volume: %w", err)
+	}
+	defer func() { _ = device.Close() }()
+
+	hasher := sha256.New()
+	buffer := make([]byte, blockSize)
+	var offset int64
+	for offset < length {
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("context cancelled: %w", err)
+		}
+
+		n, err := io.ReadFull(device, buffer[:min(int64(blockSize), length-offset)])
+		hasher.Write(buffer[:n])
+		offset += int64(n)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", fmt.Errorf("volume ends at byte %d, before the %d bytes to verify", offset, length)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read volume at byte %d: %w", offset, err)
+		}
+		if updater != nil {
+			updater.UpdateProgress("verifying", 5+float64(offset)/float64(length)*90, offset, length)
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// deviceWriter writes blocks of an image to a device, coalescing runs of zero
+// blocks into a single zero-out request
+type deviceWriter struct {
+	file *os.File
+	path string
+	// direct is set if file was opened with O_DIRECT
+	direct bool
+	// buffered is opened without O_DIRECT for writes that are not whole blocks
+	buffered  *os.File
+	blockSize int
+	// zeroFrom and zeroLen are the run of zero blocks not yet zeroed on the device
+	zeroFrom, zeroLen int64
+	// noZeroOut is set once the device refused a zero-out request, so zeros are written
+	noZeroOut bool
+	zeros     []byte
+}
+
+// writeAt writes a block at an offset of the device
+func (w *deviceWriter) writeAt(block []byte, offset int64) error {
+	if err := w.flushZeros(); err != nil {
+		return err
+	}
+
+	file := w.file
+	if w.direct && len(block)%directAlignment != 0 {
+		// O_DIRECT only writes whole blocks, so the end of the image goes through the page cache
+		if w.buffered == nil {
+			buffered, err := os.OpenFile(w.path, os.O_WRONLY, 0) // #nosec G304 -- Device path is internal
+			if err != nil {
+				return fmt.Errorf("failed to open volume: %w", err)
+			}
+			w.buffered = buffered
+		}
+		file = w.buffered
+	}
+	if _, err := file.WriteAt(block, offset); err != nil {
+		return fmt.Errorf("failed to write to volume at byte %d: %w", offset, err)
+	}
+	return nil
+}
+
+// zero records a zero block at an offset of the device, to be zeroed with the rest of its run
+func (w *deviceWriter) zero(offset, length int64) error {
+	if w.zeroLen > 0 && w.zeroFrom+w.zeroLen == offset {
+		w.zeroLen += length
+		return nil
+	}
+	if err := w.flushZeros(); err != nil {
+		return err
+	}
+	w.zeroFrom, w.zeroLen = offset, length
+	return nil
+}
+
+// flushZeros zeroes the pending run of zero blocks, writing zeros if the device
+// cannot zero ranges itself
+func (w *deviceWriter) flushZeros() error {
+	if w.zeroLen == 0 {
+		return nil
+	}
+	from, length := w.zeroFrom, w.zeroLen
+	w.zeroLen = 0
+
+	if !w.noZeroOut {
+		err := zeroOut(w.file, from, length)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, errZeroOutUnsupported) {
+			return fmt.Errorf("failed to zero volume at byte %d: %w", from, err)
+		}
+		w.noZeroOut = true
+	}
+
+	if w.zeros == nil {
+		w.zeros = alignedBuffer(w.blockSize)
+	}
+	for offset := from; offset < from+length; offset += int64(len(w.zeros)) {
+		n := min(int64(len(w.zeros)), from+length-offset)
+		if err := w.writeAt(w.zeros[:n], offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish zeroes any pending zero blocks, then flushes and closes the device
+func (w *deviceWriter) finish() error {
+	if err := w.flushZeros(); err != nil {
+		return err
+	}
+	for _, file := range []*os.File{w.buffered, w.file} {
+		if file == nil {
+			continue
+		}
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("failed to flush volume: %w", err)
+		}
+	}
+	if w.buffered != nil {
+		if err := w.buffered.Close(); err != nil {
+			return fmt.Errorf("failed to close volume: %w", err)
+		}
+		w.buffered = nil
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close volume: %w", err)
+	}
+	return nil
+}
+
+// close closes the device after a failed copy
+func (w *deviceWriter) close() {
+	if w.buffered != nil {
+		_ = w.buffered.Close()
+	}
+	_ = w.file.Close()
+}
+
+// alignedBuffer returns a buffer of size bytes starting at a multiple of
+// directAlignment, as O_DIRECT requires
+func alignedBuffer(size int) []byte {
+	buffer := make([]byte, size+directAlignment)
+	shift := 0
+	// #nosec G103 -- The address is only used to align the buffer
+	if rem := int(uintptr(unsafe.Pointer(&buffer[0])) & (directAlignment - 1)); rem != 0 {
+		shift = directAlignment - rem
+	}
+	return buffer[shift : shift+size : shift+size]
+}
+
+// isZero reports whether a block holds only zeros
+func isZero(block []byte) bool {
+	for _, b := range block {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
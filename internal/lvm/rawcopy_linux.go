@@ -0,0 +1,58 @@
+//go:build linux
+
+package lvm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// blkZeroOut is the BLKZEROOUT ioctl, _IO(0x12, 127), which zeroes a byte range of
+// a block device using the device's own zeroing where it has one
+const blkZeroOut = 0x127f
+
+// openDevice opens a device for writing, with O_DIRECT if direct is set and the
+// device supports it. It reports whether O_DIRECT is in use.
+func openDevice(path string, direct bool) (*os.File, bool, error) {
+	if direct {
+		file, err := os.OpenFile(path, os.O_WRONLY|syscall.O_DIRECT, 0) // #nosec G304 -- Device path is internal
+		if err == nil {
+			return file, true, nil
+		}
+		// Filesystems such as tmpfs refuse O_DIRECT
+		if !errors.Is(err, syscall.EINVAL) {
+			return nil, false, err
+		}
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY, 0) // #nosec G304 -- Device path is internal
+	return file, false, err
+}
+
+// zeroOut zeroes length bytes of a block device from offset
+func zeroOut(file *os.File, offset, length int64) error {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("failed to access device: %w", err)
+	}
+	byteRange := [2]uint64{uint64(offset), uint64(length)} // #nosec G115 -- Offsets are never negative
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		// #nosec G103 -- BLKZEROOUT takes a pointer to the range
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, blkZeroOut, uintptr(unsafe.Pointer(&byteRange)))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to access device: %w", err)
+	}
+	switch errno {
+	case 0:
+		return nil
+	case syscall.ENOTTY, syscall.EOPNOTSUPP:
+		// Not a block device, or one that cannot zero ranges
+		return errZeroOutUnsupported
+	default:
+		return errno
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package lvm
+
+import "os"
+
+// openDevice opens a device for writing. O_DIRECT is only supported on Linux.
+func openDevice(path string, _ bool) (*os.File, bool, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0) // #nosec G304 -- Device path is internal
+	return file, false, err
+}
+
+// zeroOut is only supported on Linux, so zeros are written instead
+func zeroOut(*os.File, int64, int64) error {
+	return errZeroOutUnsupported
+}
@@ -0,0 +1,86 @@
+package lvm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyRaw(t *testing.T) {
+	dir := t.TempDir()
+	opts := CopyOptions{BlockSize: 64 << 10, Direct: true, Sparse: true}
+	image := make([]byte, 4*opts.BlockSize+1234)
+	for i := range image {
+		image[i] = byte(i % 251)
+	}
+	// The second block is sparse, and must still overwrite what the device held
+	clear(image[opts.BlockSize : 2*opts.BlockSize])
+	imagePath := filepath.Join(dir, "image.raw")
+	require.NoError(t, os.WriteFile(imagePath, image, 0o600))
+
+	// The device is larger than the image, and its remainder is left alone
+	devicePath := filepath.Join(dir, "device")
+	device := bytes.Repeat([]byte{0xff}, 8*opts.BlockSize)
+	require.NoError(t, os.WriteFile(devicePath, device, 0o600))
+
+	updater := &MockProgressUpdater{}
+	checksum, err := copyRaw(context.Background(), imagePath, devicePath, opts, updater)
+	require.NoError(t, err)
+
+	expected := sha256.Sum256(image)
+	assert.Equal(t, hex.EncodeToString(expected[:]), checksum)
+
+	device, err = os.ReadFile(devicePath)
+	require.NoError(t, err)
+	assert.Equal(t, image, device[:len(image)])
+	assert.Len(t, device, 8*opts.BlockSize)
+	require.NotEmpty(t, updater.updates)
+	assert.Equal(t, 90.0, updater.updates[len(updater.updates)-1].percent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = copyRaw(ctx, imagePath, devicePath, opts, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestHashDevice(t *testing.T) {
+	dir := t.TempDir()
+	device := make([]byte, 3*4096+100)
+	for i := range device {
+		device[i] = byte(i % 251)
+	}
+	devicePath := filepath.Join(dir, "device")
+	require.NoError(t, os.WriteFile(devicePath, device, 0o600))
+
+	updater := &MockProgressUpdater{}
+	checksum, err := hashDevice(context.Background(), devicePath, 2*4096+10, 4096, updater)
+	require.NoError(t, err)
+	expected := sha256.Sum256(device[:2*4096+10])
+	assert.Equal(t, hex.EncodeToString(expected[:]), checksum)
+	require.Len(t, updater.updates, 3)
+	assert.Equal(t, 95.0, updater.updates[2].percent)
+
+	_, err = hashDevice(context.Background(), devicePath, int64(len(device))+1, 4096, nil)
+	assert.ErrorContains(t, err, "volume ends at byte")
+}
+
+func TestCopyOptionsValidate(t *testing.T) {
+	require.NoError(t, DefaultCopyOptions().Validate())
+	assert.Error(t, CopyOptions{BlockSize: 0}.Validate())
+	assert.Error(t, CopyOptions{BlockSize: 4096 + 512}.Validate())
+	assert.Error(t, CopyOptions{BlockSize: 128 << 20}.Validate())
+}
+
+func TestAlignedBuffer(t *testing.T) {
+	buffer := alignedBuffer(64 << 10)
+	assert.Len(t, buffer, 64<<10)
+	assert.Zero(t, uintptr(unsafe.Pointer(&buffer[0]))%directAlignment)
+}
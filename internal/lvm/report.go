@@ -0,0 +1,97 @@
+package lvm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// volumeReportFields are the lvs fields VolumeInfo is parsed from
+const volumeReportFields = "lv_name,lv_size,lv_attr,origin,pool_lv,data_percent,lv_tags"
+
+// lvsReport is the output of lvs --reportformat json. Every field is reported as a string.
+type lvsReport struct {
+	Report []struct {
+		LV []struct {
+			Name        string `json:"lv_name"`
+			Size        string `json:"lv_size"`
+			Attributes  string `json:"lv_attr"`
+			Origin      string `json:"origin"`
+			Pool        string `json:"pool_lv"`
+			DataPercent string `json:"data_percent"`
+			Tags        string `json:"lv_tags"`
+		} `json:"lv"`
+	} `json:"report"`
+}
+
+// volumeReport returns the volumes of the volume group, or only volumeName if it is set
+func (m *Manager) volumeReport(volumeName string) ([]VolumeInfo, error) {
+	if m.backend != nil {
+		return m.backend.listVolumes(volumeName)
+	}
+	target := m.vgName
+	if volumeName != "" {
+		target = fmt.Sprintf("%s/%s", m.vgName, volumeName)
+	}
+	return m.reportVolumeInfo(target)
+}
+
+// reportVolumeInfo returns the volumes lvs reports for target, a volume group or volume
+func (m *Manager) reportVolumeInfo(target string) ([]VolumeInfo, error) {
+	cmd := m.command(context.Background(), "lvs", "--reportformat", "json", "--units", "b", "--nosuffix",
+		"-o", volumeReportFields, target)
+	// Keep numbers in the C locale, so sizes and percentages parse whatever the host's locale
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	// Warnings on stderr must not end up in the JSON
+	output, err := cmd.Output()
+	if err != nil {
+		var stderr string
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			stderr = string(exitErr.Stderr)
+		}
+		return nil, &CommandError{Command: "lvs", Output: stderr, Err: err}
+	}
+	return parseVolumeReport(output)
+}
+
+// parseVolumeReport parses lvs JSON output with the fields in volumeReportFields
+func parseVolumeReport(output []byte) ([]VolumeInfo, error) {
+	var report lvsReport
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse lvs report: %w", err)
+	}
+
+	var volumes []VolumeInfo
+	for _, section := range report.Report {
+		for _, lv := range section.LV {
+			sizeBytes, err := strconv.ParseInt(strings.TrimSuffix(lv.Size, "B"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse size of volume %s: %w", lv.Name, err)
+			}
+			dataPercent, err := parseOptionalPercent(lv.DataPercent)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse data usage of volume %s: %w", lv.Name, err)
+			}
+
+			info := VolumeInfo{
+				Name:        lv.Name,
+				SizeBytes:   sizeBytes,
+				Attributes:  lv.Attributes,
+				Origin:      lv.Origin,
+				Pool:        lv.Pool,
+				DataPercent: dataPercent,
+			}
+			if lv.Tags != "" {
+				info.Tags = strings.Split(lv.Tags, ",")
+			}
+			volumes = append(volumes, info)
+		}
+	}
+	return volumes, nil
+}
@@ -0,0 +1,54 @@
+package lvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVolumeReport(t *testing.T) {
+	output := `  {
+      "report": [
+          {
+              "lv": [
+                  {"lv_name":"pool", "lv_size":"107374182400", "lv_attr":"twi-aotz--", "origin":"", "pool_lv":"", "data_percent":"42.50", "lv_tags":""},
+                  {"lv_name":"vm01-root", "lv_size":"21474836480", "lv_attr":"Vwi-aotz--", "origin":"", "pool_lv":"pool", "data_percent":"12.00", "lv_tags":"lvp_incomplete"},
+                  {"lv_name":"vm02-data", "lv_size":"10737418240", "lv_attr":"-wi-a-----", "origin":"", "pool_lv":"", "data_percent":"", "lv_tags":"backup,lvp_incomplete_old"},
+                  {"lv_name":"vm02-data-lvp-snapshot", "lv_size":"10737418240", "lv_attr":"swi-a-s---", "origin":"vm02-data", "pool_lv":"", "data_percent":"0.01", "lv_tags":""}
+              ]
+          }
+      ]
+  }
+`
+	volumes, err := parseVolumeReport([]byte(output))
+	require.NoError(t, err)
+	require.Len(t, volumes, 4)
+
+	assert.Equal(t, "pool", volumes[0].Name)
+	assert.Equal(t, int64(107374182400), volumes[0].SizeBytes)
+	require.NotNil(t, volumes[0].DataPercent)
+	assert.InDelta(t, 42.5, *volumes[0].DataPercent, 0.001)
+
+	assert.Equal(t, "pool", volumes[1].Pool)
+	assert.True(t, volumes[1].Open())
+	assert.True(t, volumes[1].HasTag(IncompleteTag))
+
+	assert.Equal(t, "vm02-data", volumes[2].Name)
+	assert.Equal(t, "-wi-a-----", volumes[2].Attributes)
+	assert.Nil(t, volumes[2].DataPercent)
+	assert.Equal(t, []string{"backup", "lvp_incomplete_old"}, volumes[2].Tags)
+	assert.False(t, volumes[2].HasTag(IncompleteTag))
+
+	assert.Equal(t, "vm02-data", volumes[3].Origin)
+	assert.Empty(t, volumes[3].Tags)
+
+	volumes, err = parseVolumeReport([]byte(`{"report": [{"lv": []}]}`))
+	require.NoError(t, err)
+	assert.Empty(t, volumes)
+
+	_, err = parseVolumeReport([]byte(`{"report": [{"lv": [{"lv_name":"vm01-root", "lv_size":"20G"}]}]}`))
+	assert.Error(t, err)
+	_, err = parseVolumeReport([]byte("  vm01-root 21474836480B -wi-ao----\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,50 @@
+package lvm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ResultTagPrefix starts the tag holding a volume's result document, encoded as
+// unpadded URL-safe base64 as LVM restricts the characters of tags
+const ResultTagPrefix = "lvp_result_"
+
+// maxTagLength is the longest tag LVM accepts
+const maxTagLength = 1024
+
+// SetResultTag tags a volume with its result document, replacing any result tag
+// left by an earlier provisioning of the volume
+func (m *Manager) SetResultTag(volumeName string, document []byte) error {
+	tag := ResultTagPrefix + base64.RawURLEncoding.EncodeToString(document)
+	if len(tag) > maxTagLength {
+		return fmt.Errorf("result document of %d bytes is too large for an LVM tag", len(document))
+	}
+
+	info, err := m.GetVolumeInfo(volumeName)
+	if err != nil {
+		return fmt.Errorf("failed to tag volume with result: %w", err)
+	}
+	if m.files != nil {
+		return m.files.replaceTags(volumeName, func(tags []string) []string {
+			tags = slices.DeleteFunc(tags, func(old string) bool { return strings.HasPrefix(old, ResultTagPrefix) })
+			return append(tags, tag)
+		})
+	}
+	args := []string{}
+	for _, old := range info.Tags {
+		if strings.HasPrefix(old, ResultTagPrefix) {
+			args = append(args, "--deltag", old)
+		}
+	}
+	args = append(args, "--addtag", tag, fmt.Sprintf("%s/%s", m.vgName, volumeName))
+
+	output, err := m.command(context.Background(), "lvchange", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to tag volume with result: %w",
+			&CommandError{Command: "lvchange", Output: string(output), Err: err})
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package lvm
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetResultTag(t *testing.T) {
+	// A wrapper standing in for lvs reports a volume tagged by an earlier
+	// provisioning, and records the arguments lvchange is run with
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "lvchange")
+	script := `#!/bin/sh
+case "$1" in
+lvs) echo '{"report":[{"lv":[{"lv_name":"vm01-root","lv_size":"21474836480","lv_attr":"-wi-a-----",` +
+		`"origin":"","pool_lv":"","data_percent":"","lv_tags":"lvp_result_e30,backup"}]}]}' ;;
+lvchange) echo "$@" > ` + calls + ` ;;
+esac
+`
+	wrapper := filepath.Join(dir, "wrapper")
+	//nolint:gosec // The script must be executable
+	require.NoError(t, os.WriteFile(wrapper, []byte(script), 0o700))
+	m := &Manager{vgName: "data", wrapper: []string{wrapper}}
+
+	document := []byte(`{"job_id":"job"}`)
+	require.NoError(t, m.SetResultTag("vm01-root", document))
+
+	args, err := os.ReadFile(calls) //nolint:gosec // Path in the test's temporary directory
+	require.NoError(t, err)
+	tag := ResultTagPrefix + base64.RawURLEncoding.EncodeToString(document)
+	assert.Equal(t, "lvchange --deltag lvp_result_e30 --addtag "+tag+" data/vm01-root", strings.TrimSpace(string(args)))
+
+	// Documents too large for a tag are refused before LVM is asked
+	assert.ErrorContains(t, m.SetResultTag("vm01-root", make([]byte, maxTagLength)), "too large")
+}
@@ -0,0 +1,117 @@
+package lvm
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// requiredQemuFormats are the formats qemu-img must support to populate volumes
+var requiredQemuFormats = []string{"qcow2", "raw"}
+
+// CheckQemuImg reports the qemu-img version, failing if it cannot convert the
+// image formats volumes are populated from
+func (m *Manager) CheckQemuImg(ctx context.Context) (string, error) {
+	version, err := m.QemuImgVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	helpOutput, err := m.command(ctx, "qemu-img", "--help").CombinedOutput()
+	if err != nil {
+		return "", &CommandError{Command: "qemu-img", Output: string(helpOutput), Err: err}
+	}
+
+	formats := parseQemuImgFormats(string(helpOutput))
+	var missing []string
+	for _, format := range requiredQemuFormats {
+		if !slices.Contains(formats, format) {
+			missing = append(missing, format)
+		}
+	}
+	if len(missing) > 0 {
+		return version, fmt.Errorf("qemu-img %s does not support formats: %s", version, strings.Join(missing, ", "))
+	}
+	return fmt.Sprintf("qemu-img %s, %d formats", version, len(formats)), nil
+}
+
+// CheckLVM reports the LVM version, or the directory volumes are kept in as files
+func (m *Manager) CheckLVM(ctx context.Context) (string, error) {
+	if m.files != nil {
+		return m.files.checkFiles(ctx)
+	}
+	version, err := m.LVMVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "LVM " + version, nil
+}
+
+// QemuImgVersion returns the version of qemu-img, such as "8.2.2"
+func (m *Manager) QemuImgVersion(ctx context.Context) (string, error) {
+	output, err := m.command(ctx, "qemu-img", "--version").CombinedOutput()
+	if err != nil {
+		return "", &CommandError{Command: "qemu-img", Output: string(output), Err: err}
+	}
+	return parseQemuImgVersion(string(output)), nil
+}
+
+// LVMVersion returns the version of LVM, such as "2.03.16(2) (2022-05-18)". Volumes
+// kept as files have no LVM version.
+func (m *Manager) LVMVersion(ctx context.Context) (string, error) {
+	if m.files != nil {
+		return "", nil
+	}
+	output, err := m.command(ctx, "lvm", "version").CombinedOutput()
+	if err != nil {
+		return "", &CommandError{Command: "lvm", Output: string(output), Err: err}
+	}
+	version := parseLVMVersion(string(output))
+	if version == "" {
+		return "", fmt.Errorf("unexpected lvm version output: %q", strings.TrimSpace(string(output)))
+	}
+	return version, nil
+}
+
+// CheckVolumeGroup reports the size and free space of the volume group
+func (m *Manager) CheckVolumeGroup(ctx context.Context) (string, error) {
+	vg, err := m.reportVolumeGroup(ctx)
+	if err != nil {
+		return "", fmt.Errorf("volume group %s is not accessible: %w", m.vgName, err)
+	}
+	return fmt.Sprintf("volume group %s: %.0f of %.0f bytes free", m.vgName, vg.FreeBytes, vg.SizeBytes), nil
+}
+
+// parseQemuImgVersion returns the version from the first line of qemu-img --version,
+// such as "qemu-img version 8.2.2 (Debian 1:8.2.2+ds-0ubuntu1)"
+func parseQemuImgVersion(output string) string {
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	fields := strings.Fields(firstLine)
+	for i, field := range fields {
+		if field == "version" && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	return strings.TrimSpace(firstLine)
+}
+
+// parseQemuImgFormats returns the formats listed on the "Supported formats:" line of qemu-img --help
+func parseQemuImgFormats(output string) []string {
+	for line := range strings.Lines(output) {
+		if formats, ok := strings.CutPrefix(strings.TrimSpace(line), "Supported formats:"); ok {
+			return strings.Fields(formats)
+		}
+	}
+	return nil
+}
+
+// parseLVMVersion returns the version from the "LVM version:" line of lvm version,
+// such as "2.03.16(2) (2022-05-18)"
+func parseLVMVersion(output string) string {
+	for line := range strings.Lines(output) {
+		if version, ok := strings.CutPrefix(strings.TrimSpace(line), "LVM version:"); ok {
+			return strings.TrimSpace(version)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package lvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQemuImgVersion(t *testing.T) {
+	assert.Equal(t, "8.2.2", parseQemuImgVersion("qemu-img version 8.2.2 (Debian 1:8.2.2+ds-0ubuntu1)\n"+
+		"Copyright (c) 2003-2023 Fabrice Bellard and the QEMU Project developers\n"))
+	assert.Equal(t, "7.0.0", parseQemuImgVersion("qemu-img version 7.0.0\n"))
+	assert.Equal(t, "something else", parseQemuImgVersion("something else\n"))
+}
+
+func TestParseQemuImgFormats(t *testing.T) {
+	output := "qemu-img version 8.2.2\nusage: qemu-img [standard options] command [command options]\n\n" +
+		"Supported formats: blkdebug luks qcow qcow2 raw vmdk\n\n" +
+		"See <https://qemu.org/contribute/report-a-bug> for how to report bugs.\n"
+	assert.Equal(t, []string{"blkdebug", "luks", "qcow", "qcow2", "raw", "vmdk"}, parseQemuImgFormats(output))
+	assert.Nil(t, parseQemuImgFormats("usage: qemu-img\n"))
+}
+
+func TestParseLVMVersion(t *testing.T) {
+	output := "  LVM version:     2.03.16(2) (2022-05-18)\n" +
+		"  Library version: 1.02.185 (2022-05-18)\n" +
+		"  Driver version:  4.47.0\n"
+	assert.Equal(t, "2.03.16(2) (2022-05-18)", parseLVMVersion(output))
+	assert.Empty(t, parseLVMVersion("command not found\n"))
+}
@@ -0,0 +1,85 @@
+package lvm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// Formats volumes can be written in. Raw volumes hold the guest disk byte for byte;
+// qcow2 volumes hold a qcow2 image, for backends and hypervisors that want one.
+const (
+	FormatRaw   = "raw"
+	FormatQcow2 = "qcow2"
+)
+
+// VolumeFormats are the formats volumes can be written in
+var VolumeFormats = []string{FormatRaw, FormatQcow2}
+
+// qcow2MetadataShare is the share of a qcow2 volume reserved for qcow2's metadata:
+// 1/256 of the volume, many times what its tables take with 64 KiB clusters
+const qcow2MetadataShare = 256
+
+// ValidateVolumeFormat checks that volumes can be written in a format
+func ValidateVolumeFormat(format string) error {
+	if !slices.Contains(VolumeFormats, format) {
+		return fmt.Errorf("unsupported volume format %q: must be one of %v", format, VolumeFormats)
+	}
+	return nil
+}
+
+// SetVolumeFormat sets the format images are converted to when populating volumes
+// that do not ask for another, raw unless set
+func (m *Manager) SetVolumeFormat(format string) error {
+	if err := ValidateVolumeFormat(format); err != nil {
+		return err
+	}
+	m.format = format
+	return nil
+}
+
+// VolumeFormat returns the format images are converted to by default
+func (m *Manager) VolumeFormat() string {
+	if m.format == "" {
+		return FormatRaw
+	}
+	return m.format
+}
+
+// qcow2VirtualSize returns the virtual size of a qcow2 image filling a volume of
+// sizeBytes, leaving room for its metadata so that the guest cannot fill the
+// volume, rounded down to whole MiB
+func qcow2VirtualSize(sizeBytes int64) int64 {
+	reserved := sizeBytes/qcow2MetadataShare + 1<<20
+	return max(sizeBytes-reserved, 0) &^ (1<<20 - 1)
+}
+
+// createTargetImage creates an empty image of a format other than raw on a volume,
+// to convert an image into, with the virtual size the volume leaves room for. A
+// volume kept as a file keeps its size, which the file backend accounts for.
+func (m *Manager) createTargetImage(ctx context.Context, volumeName, format string) error {
+	info, err := m.GetVolumeInfo(volumeName)
+	if err != nil {
+		return fmt.Errorf("failed to get volume size: %w", err)
+	}
+	virtualSize := qcow2VirtualSize(info.SizeBytes)
+	if virtualSize == 0 {
+		return fmt.Errorf("volume %s of %d bytes is too small for a %s image", volumeName, info.SizeBytes, format)
+	}
+
+	devicePath := m.DevicePath(volumeName)
+	output, err := m.command(ctx, "qemu-img", "create", "-f", format, devicePath,
+		strconv.FormatInt(virtualSize, 10)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to create %s image on volume: %w", format,
+			&CommandError{Command: "qemu-img", Output: string(output), Err: err})
+	}
+	if m.files != nil {
+		if err := os.Truncate(devicePath, info.SizeBytes); err != nil {
+			return fmt.Errorf("failed to size volume file: %w", err)
+		}
+	}
+	return nil
+}
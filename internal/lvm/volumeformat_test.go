@@ -0,0 +1,56 @@
+package lvm
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateVolumeFormat(t *testing.T) {
+	require.NoError(t, ValidateVolumeFormat("raw"))
+	require.NoError(t, ValidateVolumeFormat("qcow2"))
+	assert.Error(t, ValidateVolumeFormat("vmdk"))
+	assert.Error(t, ValidateVolumeFormat(""))
+
+	m := &Manager{}
+	assert.Equal(t, FormatRaw, m.VolumeFormat())
+	require.NoError(t, m.SetVolumeFormat(FormatQcow2))
+	assert.Equal(t, FormatQcow2, m.VolumeFormat())
+	assert.Error(t, m.SetVolumeFormat("vdi"))
+}
+
+func TestQcow2VirtualSize(t *testing.T) {
+	assert.Equal(t, int64(10<<30-41<<20), qcow2VirtualSize(10<<30))
+	assert.Equal(t, int64(0), qcow2VirtualSize(1<<20))
+	// Sizes are whole MiB
+	assert.Zero(t, qcow2VirtualSize(100<<20+12345)%(1<<20))
+}
+
+func TestFileManager_Qcow2(t *testing.T) {
+	if _, err := exec.LookPath("qemu-img"); err != nil {
+		t.Skip("qemu-img not available in test environment:", err)
+	}
+	m, err := NewFileManager("data", t.TempDir(), 1<<30)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, m.CreateVolume(ctx, "web01-root", 64<<20))
+
+	image := filepath.Join(t.TempDir(), "image.raw")
+	require.NoError(t, os.WriteFile(image, []byte("raw image contents"), 0o600))
+	written, err := m.PopulateVolume(ctx, image, "web01-root", "raw", FormatQcow2, nil)
+	require.NoError(t, err)
+	assert.Empty(t, written, "only raw copies are hashed")
+
+	// The volume holds a qcow2 image, and keeps its size
+	info, err := m.GetVolumeInfo("web01-root")
+	require.NoError(t, err)
+	assert.Equal(t, int64(64<<20), info.SizeBytes)
+	output, err := exec.Command("qemu-img", "info", m.DevicePath("web01-root")).Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "file format: qcow2")
+}
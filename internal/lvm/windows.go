@@ -0,0 +1,121 @@
+package lvm
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rossigee/libvirt-volume-provisioner/internal/retry"
+)
+
+// alignment is the boundary Windows expects partitions, and so volumes, to start on
+const alignment = 1 << 20
+
+// partitionPattern matches the guest partitions virt-resize can expand
+var partitionPattern = regexp.MustCompile(`^/dev/sd[a-z][0-9]+$`)
+
+// virtioStorageDrivers are the Windows drivers for virtio-blk and virtio-scsi disks
+var virtioStorageDrivers = []string{"viostor.sys", "vioscsi.sys"}
+
+// ValidatePartition checks that a guest partition can be expanded by virt-resize
+func ValidatePartition(partition string) error {
+	if !partitionPattern.MatchString(partition) {
+		return fmt.Errorf("invalid partition %q: must be a guest partition such as /dev/sda2", partition)
+	}
+	return nil
+}
+
+// CheckAlignment checks that volumes of the volume group start on a 1 MiB boundary,
+// as Windows partition layouts expect, which they do if both the start of the data
+// area of its physical volumes and its extent size are multiples of 1 MiB
+func (m *Manager) CheckAlignment() error {
+	cmd := m.command(context.Background(), "pvs", "--noheadings", "--units", "b", "--nosuffix",
+		"-o", "pe_start,vg_extent_size", "--select", "vg_name="+m.vgName)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to check alignment: %w", &CommandError{Command: "pvs", Output: string(output), Err: err})
+	}
+	return parseAlignment(string(output))
+}
+
+// parseAlignment checks the physical volume data offsets and extent sizes listed by
+// pvs -o pe_start,vg_extent_size for 1 MiB alignment
+func parseAlignment(output string) error {
+	lines := 0
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("unexpected pvs output: %q", line)
+		}
+		for _, field := range fields {
+			bytes, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return fmt.Errorf("unexpected pvs output: %q", line)
+			}
+			if bytes%alignment != 0 {
+				return fmt.Errorf("volume group is not aligned to 1 MiB: data offset %s and extent size %s bytes",
+					fields[0], fields[1])
+			}
+		}
+		lines++
+	}
+	if lines == 0 {
+		return fmt.Errorf("volume group has no physical volumes")
+	}
+	return nil
+}
+
+// VirtioDrivers returns the virtio storage drivers installed in a Windows image
+func VirtioDrivers(imagePath, imageType string) ([]string, error) {
+	//nolint:gosec,noctx // Image path is a cached image; virt-ls does not need a context
+	cmd := exec.Command("virt-ls", "--format", imageType, "-a", imagePath, "/Windows/System32/drivers")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Windows drivers: %w",
+			&CommandError{Command: "virt-ls", Output: string(output), Err: err})
+	}
+	return parseVirtioDrivers(string(output)), nil
+}
+
+// parseVirtioDrivers returns the virtio storage drivers in a driver directory listing.
+// Windows file names are case-insensitive.
+func parseVirtioDrivers(output string) []string {
+	var drivers []string
+	for _, name := range strings.Fields(output) {
+		if slices.Contains(virtioStorageDrivers, strings.ToLower(name)) {
+			drivers = append(drivers, strings.ToLower(name))
+		}
+	}
+	return drivers
+}
+
+// PopulateVolumeExpanding writes an image to a volume with virt-resize, growing a
+// partition and its NTFS filesystem to fill the volume
+func (m *Manager) PopulateVolumeExpanding(ctx context.Context, imagePath, volumeName, imageType, partition string) error {
+	if err := ValidatePartition(partition); err != nil {
+		return retry.Permanent(err)
+	}
+
+	err := retry.WithRetry(ctx, withRetryLogging(m.convertRetry, "convert", volumeName), func() error {
+		// The partition is validated, paths are internal
+		cmd := m.command(context.Background(), "virt-resize", "--format", imageType, "--output-format", "raw",
+			"--expand", partition, imagePath, m.DevicePath(volumeName))
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to expand image onto volume: %w",
+				&CommandError{Command: "virt-resize", Output: string(output), Err: err})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to populate volume %s after retries: %w", volumeName, err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package lvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAlignment(t *testing.T) {
+	assert.NoError(t, parseAlignment("  1048576 4194304\n  1048576 4194304\n"))
+	assert.Error(t, parseAlignment("  196608 4194304\n"), "data area starting at 192 KiB")
+	assert.Error(t, parseAlignment("  1048576 524288\n"), "512 KiB extents")
+	assert.Error(t, parseAlignment(""))
+	assert.Error(t, parseAlignment("  1048576\n"))
+}
+
+func TestParseVirtioDrivers(t *testing.T) {
+	output := "ACPI.sys\nviostor.sys\nVioScsi.sys\nnetkvm.sys\n"
+	assert.Equal(t, []string{"viostor.sys", "vioscsi.sys"}, parseVirtioDrivers(output))
+	assert.Empty(t, parseVirtioDrivers("ACPI.sys\nstorahci.sys\n"))
+}
+
+func TestValidatePartition(t *testing.T) {
+	assert.NoError(t, ValidatePartition("/dev/sda2"))
+	for _, partition := range []string{"", "/dev/sda", "sda2", "/dev/sda2; rm", "/etc/passwd"} {
+		assert.Error(t, ValidatePartition(partition), partition)
+	}
+}
@@ -0,0 +1,82 @@
+package minio
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// bandwidthLimiter limits the combined rate MinIO response bodies are read at. Bytes
+// already read are paid for afterwards, delaying the next read until the rate allows,
+// and up to a second of unused bandwidth may be spent in a burst.
+type bandwidthLimiter struct {
+	mu sync.Mutex
+	// bytesPerSec is the limit; zero is unlimited
+	bytesPerSec int64
+	// allowance is the bytes that may be read now; negative while reads are in debt
+	allowance float64
+	last      time.Time
+}
+
+// setLimit changes the limit; zero removes it
+func (l *bandwidthLimiter) setLimit(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bytesPerSec = max(bytesPerSec, 0)
+	l.allowance = 0
+	l.last = time.Now()
+}
+
+// limit returns the limit in bytes per second, zero if there is none
+func (l *bandwidthLimiter) limit() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bytesPerSec
+}
+
+// delay pays for n bytes read at now, returning how long to wait before reading more
+func (l *bandwidthLimiter) delay(n int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.bytesPerSec <= 0 {
+		return 0
+	}
+
+	rate := float64(l.bytesPerSec)
+	l.allowance = min(l.allowance+now.Sub(l.last).Seconds()*rate, rate) - float64(n)
+	l.last = now
+	if l.allowance >= 0 {
+		return 0
+	}
+	return time.Duration(-l.allowance / rate * float64(time.Second))
+}
+
+// throttledBody reads a response body no faster than its limiter allows, until the
+// request, whose Done channel and Err function it holds, is cancelled
+type throttledBody struct {
+	io.ReadCloser
+	limiter *bandwidthLimiter
+	done    <-chan struct{}
+	err     func() error
+}
+
+// newThrottledBody limits the rate the body of a response to a request with ctx is read at
+func newThrottledBody(ctx context.Context, body io.ReadCloser, limiter *bandwidthLimiter) *throttledBody {
+	return &throttledBody{ReadCloser: body, limiter: limiter, done: ctx.Done(), err: ctx.Err}
+}
+
+// Read waits after reading until the bytes read are within the limit
+func (b *throttledBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if wait := b.limiter.delay(n, time.Now()); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-b.done:
+			return n, b.err()
+		}
+	}
+	return n, err
+}
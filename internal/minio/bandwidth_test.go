@@ -0,0 +1,48 @@
+package minio
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBandwidthLimiter(t *testing.T) {
+	limiter := &bandwidthLimiter{}
+	now := time.Now()
+	assert.Zero(t, limiter.delay(1<<30, now))
+
+	limiter.setLimit(1000)
+	start := limiter.last
+	assert.Equal(t, int64(1000), limiter.limit())
+
+	// Reads are paid for afterwards at the limit
+	assert.Equal(t, 500*time.Millisecond, limiter.delay(500, start))
+	assert.Equal(t, time.Second, limiter.delay(500, start))
+	assert.Zero(t, limiter.delay(0, start.Add(time.Second)))
+
+	// Unused bandwidth accumulates for a second at most
+	assert.Zero(t, limiter.delay(1000, start.Add(10*time.Second)))
+	assert.Equal(t, 100*time.Millisecond, limiter.delay(100, start.Add(10*time.Second)))
+
+	limiter.setLimit(0)
+	assert.Zero(t, limiter.delay(1<<30, time.Now()))
+}
+
+func TestThrottledBody(t *testing.T) {
+	limiter := &bandwidthLimiter{}
+	limiter.setLimit(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	body := newThrottledBody(ctx, io.NopCloser(strings.NewReader("image data")), limiter)
+	buf := make([]byte, 5)
+	cancel()
+
+	// A cancelled download is not held up by the limit
+	n, err := body.Read(buf)
+	assert.Equal(t, 5, n)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,170 @@
+package minio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrUnavailable is returned without contacting MinIO while the circuit breaker is open
+var ErrUnavailable = errors.New("source storage unavailable")
+
+// Default circuit breaker settings
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+var breakerOpenGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "libvirt_volume_provisioner_minio_circuit_open",
+		Help: "Whether requests to MinIO are being refused because it appears to be down",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(breakerOpenGauge)
+}
+
+// breaker stops requests to MinIO after consecutive failures to reach it, so that
+// jobs fail fast instead of each spending its retry budget on a server that is down.
+// Once the cooldown has passed a single request is let through as a probe; its
+// success closes the breaker again. A nil breaker never opens.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	// openedAt is when the breaker opened; zero while closed
+	openedAt time.Time
+	probing  bool
+	lastErr  error
+}
+
+// newBreaker creates a breaker that opens after threshold consecutive failures.
+// It returns nil, disabling the breaker, if threshold is not positive.
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow returns ErrUnavailable if requests to MinIO should not be attempted
+func (b *breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return nil
+	}
+	retryAt := b.openedAt.Add(b.cooldown)
+	if b.probing || b.now().Before(retryAt) {
+		return fmt.Errorf("%w: %d consecutive failures, last: %w", ErrUnavailable, b.failures, b.lastErr)
+	}
+	b.probing = true
+	return nil
+}
+
+// record updates the breaker with the outcome of a request allowed through
+func (b *breaker) record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !unreachable(err) {
+		if !b.openedAt.IsZero() {
+			logrus.Info("MinIO reachable again, closing circuit breaker")
+			breakerOpenGauge.Set(0)
+		}
+		b.failures = 0
+		b.openedAt = time.Time{}
+		b.lastErr = nil
+		return
+	}
+
+	b.failures++
+	b.lastErr = err
+	if b.failures < b.threshold {
+		return
+	}
+	if b.openedAt.IsZero() {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"failures": b.failures,
+			"cooldown": b.cooldown,
+		}).Warn("MinIO unreachable, opening circuit breaker")
+		breakerOpenGauge.Set(1)
+	}
+	b.openedAt = b.now()
+}
+
+// status returns nil if the breaker is closed, or the reason it is open
+func (b *breaker) status() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return nil
+	}
+	return fmt.Errorf("%w since %s: %w", ErrUnavailable, b.openedAt.UTC().Format(time.RFC3339), b.lastErr)
+}
+
+// unreachable reports whether err shows that MinIO could not be reached or failed
+// to serve the request. Errors returned by a healthy server, such as a missing
+// object, and the caller's cancellation or deadline do not count as failures.
+func unreachable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrUnavailable) {
+		return false
+	}
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) {
+		return resp.StatusCode >= 500
+	}
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
+
+// parseBreakerConfig parses the circuit breaker configuration from environment
+// variables, keeping the defaults for values that are missing or invalid
+func parseBreakerConfig(thresholdStr, cooldownStr string) (int, time.Duration) {
+	threshold := defaultBreakerThreshold
+	cooldown := defaultBreakerCooldown
+
+	if thresholdStr != "" {
+		if value, err := strconv.Atoi(thresholdStr); err == nil && value >= 0 {
+			threshold = value
+		}
+	}
+	if cooldownStr != "" {
+		if seconds, err := strconv.Atoi(cooldownStr); err == nil && seconds > 0 {
+			cooldown = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return threshold, cooldown
+}
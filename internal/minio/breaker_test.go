@@ -0,0 +1,81 @@
+package minio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2026, 1, 14, 10, 0, 0, 0, time.UTC)
+	b := newBreaker(2, 30*time.Second)
+	b.now = func() time.Time { return now }
+
+	down := &url.Error{Op: "Get", URL: "https://minio", Err: errors.New("connection refused")}
+
+	// Errors from a healthy server do not count as failures
+	b.record(down)
+	b.record(minio.ErrorResponse{Code: "NoSuchKey", StatusCode: 404})
+	b.record(down)
+	require.NoError(t, b.allow())
+	assert.NoError(t, b.status())
+
+	// Consecutive failures open the breaker
+	b.record(down)
+	err := b.allow()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, b.status(), ErrUnavailable)
+
+	// After the cooldown a single probe is allowed through
+	now = now.Add(30 * time.Second)
+	require.NoError(t, b.allow())
+	assert.ErrorIs(t, b.allow(), ErrUnavailable)
+
+	// A failed probe keeps the breaker open for another cooldown
+	b.record(fmt.Errorf("failed to stat object: %w", minio.ErrorResponse{Code: "InternalError", StatusCode: 503}))
+	assert.ErrorIs(t, b.allow(), ErrUnavailable)
+
+	// A successful probe closes it
+	now = now.Add(30 * time.Second)
+	require.NoError(t, b.allow())
+	b.record(nil)
+	assert.NoError(t, b.allow())
+	assert.NoError(t, b.status())
+
+	// A nil breaker never opens
+	var disabled *breaker
+	disabled.record(down)
+	assert.NoError(t, disabled.allow())
+	assert.Nil(t, newBreaker(0, time.Minute))
+}
+
+func TestUnreachable(t *testing.T) {
+	assert.True(t, unreachable(&url.Error{Op: "Get", URL: "https://minio", Err: errors.New("no route to host")}))
+	assert.True(t, unreachable(minio.ErrorResponse{Code: "ServiceUnavailable", StatusCode: 503}))
+	assert.False(t, unreachable(minio.ErrorResponse{Code: "AccessDenied", StatusCode: 403}))
+	assert.False(t, unreachable(fmt.Errorf("download cancelled: %w", context.Canceled)))
+	assert.False(t, unreachable(errors.New("download incomplete")))
+	assert.False(t, unreachable(nil))
+}
+
+func TestParseBreakerConfig(t *testing.T) {
+	threshold, cooldown := parseBreakerConfig("", "")
+	assert.Equal(t, defaultBreakerThreshold, threshold)
+	assert.Equal(t, defaultBreakerCooldown, cooldown)
+
+	threshold, cooldown = parseBreakerConfig("0", "60")
+	assert.Equal(t, 0, threshold)
+	assert.Equal(t, time.Minute, cooldown)
+
+	threshold, cooldown = parseBreakerConfig("-1", "soon")
+	assert.Equal(t, defaultBreakerThreshold, threshold)
+	assert.Equal(t, defaultBreakerCooldown, cooldown)
+}
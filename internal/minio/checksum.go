@@ -0,0 +1,42 @@
+package minio
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"time"
+)
+
+// chunkHasher calculates a SHA256 checksum from the chunks of a download as they are
+// written, tracking the time spent hashing so its throughput can be reported
+type chunkHasher struct {
+	hash    hash.Hash
+	hashed  int64
+	elapsed time.Duration
+}
+
+// newChunkHasher creates a hasher for a single download
+func newChunkHasher() *chunkHasher {
+	return &chunkHasher{hash: sha256.New()}
+}
+
+// write adds a chunk to the checksum
+func (h *chunkHasher) write(chunk []byte) {
+	start := time.Now()
+	_, _ = h.hash.Write(chunk) // hash.Hash writes never fail
+	h.elapsed += time.Since(start)
+	h.hashed += int64(len(chunk))
+}
+
+// bytesPerSecond returns the hashing throughput so far
+func (h *chunkHasher) bytesPerSecond() float64 {
+	if h.elapsed <= 0 {
+		return 0
+	}
+	return float64(h.hashed) / h.elapsed.Seconds()
+}
+
+// sum returns the hex-encoded checksum of the chunks written so far
+func (h *chunkHasher) sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
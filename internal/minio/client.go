@@ -3,18 +3,24 @@
 package minio
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
 	"github.com/rossigee/libvirt-volume-provisioner/internal/retry"
 	"github.com/sirupsen/logrus"
 )
@@ -24,10 +30,43 @@ type ProgressUpdater interface {
 	UpdateProgress(stage string, percent float64, bytesProcessed, bytesTotal int64)
 }
 
+// HashRateUpdater may be implemented by a ProgressUpdater to receive the throughput
+// of the checksum calculated while downloading
+type HashRateUpdater interface {
+	UpdateHashRate(bytesPerSec float64)
+}
+
+// Pauser may be implemented by a ProgressUpdater to suspend a download while its job is paused
+type Pauser interface {
+	WaitWhilePaused(ctx context.Context) error
+}
+
+// probeURLExpiry is how long the presigned URL handed to qemu-img stays valid
+const probeURLExpiry = 5 * time.Minute
+
+// ImageInfo describes a remote image as reported by qemu-img info
+type ImageInfo struct {
+	Format      string `json:"format"`
+	VirtualSize int64  `json:"virtual-size"`
+}
+
+// defaultAllowedDir is the download destination allowed when no cache directories are configured
+const defaultAllowedDir = "/var/lib/libvirt"
+
 // Client handles MinIO operations.
 type Client struct {
 	minioClient *minio.Client
 	retryConfig retry.Config
+	allowedDirs []string
+	// stagingDir is where DownloadImage writes temporary files; the system temp directory if empty
+	stagingDir string
+	// stagingMinFree is the free space that must remain in stagingDir after a download
+	stagingMinFree uint64
+	breaker        *breaker
+	// downloadStreams is the number of connections DownloadImageToPath may use per image
+	downloadStreams int
+	// bandwidth limits the combined rate of all MinIO transfers
+	bandwidth *bandwidthLimiter
 }
 
 // NewClient creates a new MinIO client.
@@ -86,10 +125,21 @@ func NewClient() (*Client, error) {
 		return nil, fmt.Errorf("invalid MINIO_ENDPOINT '%s': missing hostname", endpoint)
 	}
 
+	transportConfig, err := transportConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	transport, err := newTransport(u.Scheme == "https", transportConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create MinIO client
+	bandwidth := &bandwidthLimiter{}
 	minioClient, err := minio.New(u.Host, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: u.Scheme == "https",
+		Creds:     credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure:    u.Scheme == "https",
+		Transport: instrumentedTransport{next: transport, bandwidth: bandwidth},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create MinIO client for %s: %w", u.Host, err)
@@ -101,12 +151,128 @@ func NewClient() (*Client, error) {
 		os.Getenv("MINIO_RETRY_BACKOFF_MS"),
 	)
 
+	downloadStreams := 1
+	if value := os.Getenv("MINIO_DOWNLOAD_STREAMS"); value != "" {
+		downloadStreams, err = strconv.Atoi(value)
+		if err != nil || downloadStreams < 1 {
+			return nil, fmt.Errorf("invalid MINIO_DOWNLOAD_STREAMS '%s': must be a positive number", value)
+		}
+	}
+
+	// Configure the circuit breaker
+	threshold, cooldown := parseBreakerConfig(
+		os.Getenv("MINIO_BREAKER_THRESHOLD"),
+		os.Getenv("MINIO_BREAKER_COOLDOWN_SECONDS"),
+	)
+
 	return &Client{
-		minioClient: minioClient,
-		retryConfig: retryConfig,
+		minioClient:     minioClient,
+		retryConfig:     retryConfig,
+		breaker:         newBreaker(threshold, cooldown),
+		downloadStreams: downloadStreams,
+		bandwidth:       bandwidth,
 	}, nil
 }
 
+// SetAllowedDirs restricts DownloadImageToPath to destinations inside the given directories
+func (c *Client) SetAllowedDirs(dirs ...string) {
+	c.allowedDirs = make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		c.allowedDirs = append(c.allowedDirs, filepath.Clean(dir))
+	}
+}
+
+// Available returns nil if MinIO is considered reachable, or an error wrapping
+// ErrUnavailable while the circuit breaker refuses requests to it
+func (c *Client) Available() error {
+	return c.breaker.status()
+}
+
+// guard runs a request to MinIO unless the circuit breaker is open, recording its outcome
+func (c *Client) guard(request func() error) error {
+	if err := c.breaker.allow(); err != nil {
+		return err
+	}
+	err := request()
+	c.breaker.record(err)
+	return err
+}
+
+// SetDownloadBandwidth limits the combined rate of all downloads from MinIO, for
+// example to leave a shared uplink to other traffic. Zero removes the limit.
+func (c *Client) SetDownloadBandwidth(bytesPerSec int64) {
+	c.bandwidth.setLimit(bytesPerSec)
+}
+
+// DownloadBandwidth returns the download bandwidth limit in bytes per second, zero if there is none
+func (c *Client) DownloadBandwidth() int64 {
+	return c.bandwidth.limit()
+}
+
+// SetRetryPolicy overrides the retry configuration of downloads
+func (c *Client) SetRetryPolicy(policy retry.Policy) {
+	c.retryConfig = policy.Apply(c.retryConfig)
+}
+
+// SetStagingDir sets the directory DownloadImage writes temporary files to and the
+// free space that must remain on its filesystem after a download
+func (c *Client) SetStagingDir(dir string, minFreeBytes uint64) error {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("invalid staging directory '%s': must be an absolute path", dir)
+	}
+	c.stagingDir = filepath.Clean(dir)
+	c.stagingMinFree = minFreeBytes
+	return nil
+}
+
+// createStagingFile creates a temporary file for a download of sizeBytes,
+// failing fast if the staging filesystem does not have room for it
+func (c *Client) createStagingFile(sizeBytes int64) (*os.File, error) {
+	dir := c.stagingDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	available, err := cache.FilesystemAvailable(dir)
+	if err != nil {
+		return nil, err
+	}
+	required := uint64(max(sizeBytes, 0))
+	if required > available || available-required < c.stagingMinFree {
+		return nil, fmt.Errorf("%w in staging directory %s: %d bytes available, %d bytes requested, %d bytes must remain free",
+			cache.ErrInsufficientSpace, dir, available, required, c.stagingMinFree)
+	}
+
+	tempFile, err := os.CreateTemp(dir, "provision-image-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	return tempFile, nil
+}
+
+// validateDestPath checks that destPath is inside one of the allowed directories
+func (c *Client) validateDestPath(destPath string) error {
+	allowedDirs := c.allowedDirs
+	if len(allowedDirs) == 0 {
+		allowedDirs = []string{defaultAllowedDir}
+	}
+
+	if strings.Contains(destPath, "..") || !filepath.IsAbs(destPath) {
+		return fmt.Errorf("invalid destination path: %s", destPath)
+	}
+
+	for _, dir := range allowedDirs {
+		if strings.HasPrefix(filepath.Clean(destPath), dir+string(filepath.Separator)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid destination path: %s", destPath)
+}
+
 // parseRetryConfig parses retry configuration from environment variables
 func parseRetryConfig(attemptsStr, backoffStr string) retry.Config {
 	// Default values
@@ -136,18 +302,52 @@ func parseRetryConfig(attemptsStr, backoffStr string) retry.Config {
 	return retry.Config{
 		MaxAttempts: maxAttempts,
 		Delays:      delays,
+		Jitter:      retryJitter,
+		Retryable:   retryableError,
 	}
 }
 
-// DownloadImage downloads an image from MinIO to a temporary file with exponential backoff retry
+// retryJitter spreads out retries of downloads that failed together, e.g. during a MinIO restart
+const retryJitter = 0.1
+
+// retryableError reports whether a failed download may succeed if retried. Missing
+// objects, denied access, cancellation, lack of disk space and an open circuit
+// breaker are not retried.
+func retryableError(err error) bool {
+	switch ErrorCode(err) {
+	case "NoSuchKey", "NoSuchBucket", "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, cache.ErrInsufficientSpace) &&
+		!errors.Is(err, ErrUnavailable)
+}
+
+// retryConfigFor returns the retry configuration for downloading imageURL,
+// logging each failed attempt that will be retried
+func (c *Client) retryConfigFor(imageURL string) retry.Config {
+	cfg := c.retryConfig
+	cfg.OnRetry = func(attempt int, err error, delay time.Duration) {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"image_url": imageURL,
+			"attempt":   attempt,
+			"delay":     delay,
+		}).Warn("Image download failed, retrying")
+	}
+	return cfg
+}
+
+// DownloadImage downloads an image from MinIO to a temporary file in the staging directory
+// with exponential backoff retry
 func (c *Client) DownloadImage(ctx context.Context, imageURL string, updater ProgressUpdater) (string, error) {
 	var tempPath string
 
 	// Wrap download with retry logic
-	err := retry.WithRetry(ctx, c.retryConfig, func() error {
-		path, downloadErr := c.downloadImageOnce(ctx, imageURL, updater)
-		tempPath = path
-		return downloadErr
+	err := retry.WithRetry(ctx, c.retryConfigFor(imageURL), func() error {
+		return c.guard(func() error {
+			path, downloadErr := c.downloadImageOnce(ctx, imageURL, updater)
+			tempPath = path
+			return downloadErr
+		})
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to download image from %s after retries: %w", imageURL, err)
@@ -156,33 +356,42 @@ func (c *Client) DownloadImage(ctx context.Context, imageURL string, updater Pro
 	return tempPath, nil
 }
 
-// DownloadImageToPath downloads an image from MinIO to a specific file path with exponential backoff retry
-func (c *Client) DownloadImageToPath(ctx context.Context, imageURL, destPath string, updater ProgressUpdater) error {
+// DownloadImageToPath downloads an image from MinIO to a specific file path with exponential backoff retry.
+// It returns the SHA256 checksum of the image, calculated while downloading so that
+// verifying a large image does not need a second pass over it.
+func (c *Client) DownloadImageToPath(ctx context.Context, imageURL, destPath string,
+	updater ProgressUpdater) (string, error) {
+	var checksum string
+
 	// Wrap download with retry logic
-	err := retry.WithRetry(ctx, c.retryConfig, func() error {
-		return c.downloadImageToPathOnce(ctx, imageURL, destPath, updater)
+	err := retry.WithRetry(ctx, c.retryConfigFor(imageURL), func() error {
+		return c.guard(func() error {
+			sum, downloadErr := c.downloadImageToPathOnce(ctx, imageURL, destPath, updater)
+			checksum = sum
+			return downloadErr
+		})
 	})
 	if err != nil {
-		return fmt.Errorf("failed to download image from %s to %s after retries: %w", imageURL, destPath, err)
+		return "", fmt.Errorf("failed to download image from %s to %s after retries: %w", imageURL, destPath, err)
 	}
 
-	return nil
+	return checksum, nil
 }
 
 // downloadImageToPathOnce performs a single download attempt to a specific path
-// without retry logic
+// without retry logic, returning the checksum of the downloaded image
 func (c *Client) downloadImageToPathOnce(ctx context.Context, imageURL, destPath string,
-	updater ProgressUpdater) error {
+	updater ProgressUpdater) (string, error) {
 	// Parse the image URL to extract bucket and object
 	u, err := url.Parse(imageURL)
 	if err != nil {
-		return fmt.Errorf("invalid image URL: %w", err)
+		return "", retry.Permanent(fmt.Errorf("invalid image URL: %w", err))
 	}
 
 	// Extract bucket and object from path
 	pathParts := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
 	if len(pathParts) < 2 {
-		return fmt.Errorf("invalid image URL path: %s", u.Path)
+		return "", retry.Permanent(fmt.Errorf("invalid image URL path: %s", u.Path))
 	}
 
 	bucketName := pathParts[0]
@@ -191,56 +400,74 @@ func (c *Client) downloadImageToPathOnce(ctx context.Context, imageURL, destPath
 	// Get object info for size
 	objInfo, err := c.minioClient.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to stat object: %w", err)
+		return "", fmt.Errorf("failed to stat object: %w", err)
 	}
 
 	totalSize := objInfo.Size
 
 	// Validate destination path
-	if strings.Contains(destPath, "..") || !strings.HasPrefix(destPath, "/var/lib/libvirt/") {
-		return fmt.Errorf("invalid destination path: %s", destPath)
+	if err := c.validateDestPath(destPath); err != nil {
+		return "", retry.Permanent(err)
 	}
 
 	// Create or truncate destination file
 	destFile, err := os.Create(destPath) // #nosec G304 -- Path validated above
 	if err != nil {
-		return fmt.Errorf("failed to create destination file: %w", err)
+		return "", fmt.Errorf("failed to create destination file: %w", err)
 	}
 	defer func() {
 		_ = destFile.Close() // Close errors are not critical
 	}()
 
+	// Large objects may be downloaded over several connections
+	if parts := c.partCount(totalSize); parts > 1 {
+		return c.downloadRanges(ctx, bucketName, objectName, objInfo.ETag, totalSize, parts, destFile, updater)
+	}
+
 	// Download object with progress tracking
 	object, err := c.minioClient.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to get object: %w", err)
+		return "", fmt.Errorf("failed to get object: %w", err)
 	}
 	defer func() {
 		_ = object.Close() // Close errors are not critical
 	}()
 
-	// Copy with progress tracking
+	// Copy with progress tracking, hashing each chunk as it is written
 	buffer := make([]byte, 32*1024*1024) // 32MB buffer
 	var downloaded int64
+	hasher := newChunkHasher()
+	hashRate, reportsHashRate := updater.(HashRateUpdater)
+	pauser, pausable := updater.(Pauser)
 
 	for {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("context cancelled: %w", ctx.Err())
+			return "", fmt.Errorf("context cancelled: %w", ctx.Err())
 		default:
 		}
 
+		if pausable {
+			if err := pauser.WaitWhilePaused(ctx); err != nil {
+				return "", err
+			}
+		}
+
 		n, err := object.Read(buffer)
 		if n > 0 {
 			if _, writeErr := destFile.Write(buffer[:n]); writeErr != nil {
-				return fmt.Errorf("failed to write to destination file: %w", writeErr)
+				return "", fmt.Errorf("failed to write to destination file: %w", writeErr)
 			}
+			hasher.write(buffer[:n])
 			downloaded += int64(n)
 
 			// Update progress
 			if updater != nil && totalSize > 0 {
 				percent := float64(downloaded) / float64(totalSize) * 30 // 30% of total progress
 				updater.UpdateProgress("downloading", 10+percent, downloaded, totalSize)
+				if reportsHashRate {
+					hashRate.UpdateHashRate(hasher.bytesPerSecond())
+				}
 			}
 		}
 
@@ -248,16 +475,16 @@ func (c *Client) downloadImageToPathOnce(ctx context.Context, imageURL, destPath
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("failed to read from MinIO: %w", err)
+			return "", fmt.Errorf("failed to read from MinIO: %w", err)
 		}
 	}
 
 	// Verify download
 	if downloaded != totalSize {
-		return fmt.Errorf("download incomplete: got %d bytes, expected %d", downloaded, totalSize)
+		return "", fmt.Errorf("download incomplete: got %d bytes, expected %d", downloaded, totalSize)
 	}
 
-	return nil
+	return hasher.sum(), nil
 }
 
 // downloadImageOnce performs a single download attempt without retry logic
@@ -265,38 +492,37 @@ func (c *Client) downloadImageOnce(ctx context.Context, imageURL string, updater
 	// Parse the image URL to extract bucket and object
 	u, err := url.Parse(imageURL)
 	if err != nil {
-		return "", fmt.Errorf("invalid image URL: %w", err)
+		return "", retry.Permanent(fmt.Errorf("invalid image URL: %w", err))
 	}
 
 	// Extract bucket and object from path
 	pathParts := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
 	if len(pathParts) < 2 {
-		return "", fmt.Errorf("invalid image URL path: %s", u.Path)
+		return "", retry.Permanent(fmt.Errorf("invalid image URL path: %s", u.Path))
 	}
 
 	bucketName := pathParts[0]
 	objectName := strings.Join(pathParts[1:], "/")
 
-	// Create temporary file
-	tempFile, err := os.CreateTemp("", "provision-image-*")
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
-	}
-	defer func() {
-		_ = tempFile.Close() // Close errors are not critical
-	}()
-
-	tempPath := tempFile.Name()
-
 	// Get object info for size
 	objInfo, err := c.minioClient.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
 	if err != nil {
-		_ = os.Remove(tempPath) // Cleanup errors are not critical
 		return "", fmt.Errorf("failed to stat object: %w", err)
 	}
 
 	totalSize := objInfo.Size
 
+	// Create temporary file in the staging directory
+	tempFile, err := c.createStagingFile(totalSize)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tempFile.Close() // Close errors are not critical
+	}()
+
+	tempPath := tempFile.Name()
+
 	// Download object with progress tracking
 	object, err := c.minioClient.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
 	if err != nil {
@@ -365,13 +591,43 @@ func (c *Client) Cleanup(tempPath string) error {
 
 // StatObject gets object information from MinIO
 func (c *Client) StatObject(ctx context.Context, bucketName, objectName string) (minio.ObjectInfo, error) {
-	objInfo, err := c.minioClient.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+	var objInfo minio.ObjectInfo
+	err := c.guard(func() (err error) {
+		objInfo, err = c.minioClient.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+		return err
+	})
 	if err != nil {
 		return objInfo, fmt.Errorf("failed to stat MinIO object: %w", err)
 	}
 	return objInfo, nil
 }
 
+// ObjectModified reports whether an object no longer matches the given version,
+// using a conditional request on its ETag, or on its modification time if the ETag is unknown
+func (c *Client) ObjectModified(ctx context.Context, bucketName, objectName, etag string,
+	lastModified time.Time) (bool, error) {
+	opts := minio.StatObjectOptions{}
+	if etag != "" {
+		if err := opts.SetMatchETagExcept(etag); err != nil {
+			return false, fmt.Errorf("invalid ETag: %w", err)
+		}
+	} else if err := opts.SetModified(lastModified); err != nil {
+		return false, fmt.Errorf("invalid modification time: %w", err)
+	}
+
+	err := c.guard(func() error {
+		_, err := c.minioClient.StatObject(ctx, bucketName, objectName, opts)
+		return err
+	})
+	if err == nil {
+		return true, nil
+	}
+	if minio.ToErrorResponse(err).StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to revalidate MinIO object: %w", err)
+}
+
 // GetObjectContent gets the content of a small object from MinIO
 func (c *Client) GetObjectContent(ctx context.Context, bucketName, objectName string) ([]byte, error) {
 	object, err := c.minioClient.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
@@ -380,7 +636,12 @@ func (c *Client) GetObjectContent(ctx context.Context, bucketName, objectName st
 	}
 	defer func() { _ = object.Close() }()
 
-	content, err := io.ReadAll(object)
+	// GetObject only contacts MinIO once the object is read
+	var content []byte
+	err = c.guard(func() (err error) {
+		content, err = io.ReadAll(object)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to read MinIO object content: %w", err)
 	}
@@ -388,26 +649,128 @@ func (c *Client) GetObjectContent(ctx context.Context, bucketName, objectName st
 	return content, nil
 }
 
+// GetURLContent gets the content of a small object from MinIO by its URL, such as
+// https://minio.example.com/releases/provisioner/manifest.json
+func (c *Client) GetURLContent(ctx context.Context, objectURL string) ([]byte, error) {
+	bucketName, objectName, err := splitImageURL(objectURL)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetObjectContent(ctx, bucketName, objectName)
+}
+
+// PutURLContent writes a small object to MinIO by its URL, replacing any object of
+// the same name. Writes bypass the circuit breaker, so that a bucket refusing them,
+// e.g. for lack of permission, does not stop image downloads.
+func (c *Client) PutURLContent(ctx context.Context, objectURL string, content []byte, contentType string) error {
+	bucketName, objectName, err := splitImageURL(objectURL)
+	if err != nil {
+		return err
+	}
+	_, err = c.minioClient.PutObject(ctx, bucketName, objectName, bytes.NewReader(content),
+		int64(len(content)), minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("failed to put MinIO object: %w", err)
+	}
+	return nil
+}
+
+// Ping checks MinIO is reachable, returning its endpoint. An error response, such
+// as access denied for credentials that may not list buckets, still shows MinIO is up.
+func (c *Client) Ping(ctx context.Context) (string, error) {
+	endpoint := c.minioClient.EndpointURL().String()
+	_, err := c.minioClient.ListBuckets(ctx)
+	if err != nil && minio.ToErrorResponse(err).Code == "" {
+		return endpoint, fmt.Errorf("MinIO at %s is not reachable: %w", endpoint, err)
+	}
+	return endpoint, nil
+}
+
 // ValidateImageURL validates that an image URL is accessible
 func (c *Client) ValidateImageURL(ctx context.Context, imageURL string) error {
-	u, err := url.Parse(imageURL)
+	_, err := c.StatImage(ctx, imageURL)
+	return err
+}
+
+// StatImage returns object information for the image an image URL refers to
+func (c *Client) StatImage(ctx context.Context, imageURL string) (minio.ObjectInfo, error) {
+	bucketName, objectName, err := splitImageURL(imageURL)
 	if err != nil {
-		return fmt.Errorf("invalid image URL: %w", err)
+		return minio.ObjectInfo{}, err
 	}
 
-	pathParts := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
-	if len(pathParts) < 2 {
-		return fmt.Errorf("invalid image URL path: %s", u.Path)
+	var objInfo minio.ObjectInfo
+	err = c.guard(func() (err error) {
+		objInfo, err = c.minioClient.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+		return err
+	})
+	if err != nil {
+		return objInfo, fmt.Errorf("image not accessible: %w", err)
 	}
 
-	bucketName := pathParts[0]
-	objectName := strings.Join(pathParts[1:], "/")
+	return objInfo, nil
+}
 
-	// Check if object exists
-	_, err = c.minioClient.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+// ProbeImage inspects a remote image with qemu-img info without downloading it.
+// qemu-img reads only the image headers through a short-lived presigned URL.
+func (c *Client) ProbeImage(ctx context.Context, imageURL string) (*ImageInfo, error) {
+	bucketName, objectName, err := splitImageURL(imageURL)
 	if err != nil {
-		return fmt.Errorf("image not accessible: %w", err)
+		return nil, err
 	}
 
-	return nil
+	presignedURL, err := c.minioClient.PresignedGetObject(ctx, bucketName, objectName, probeURLExpiry, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign image URL: %w", err)
+	}
+
+	//nolint:gosec // The presigned URL is generated by the MinIO client, not taken from the request
+	cmd := exec.CommandContext(ctx, "qemu-img", "info", "--output=json", presignedURL.String())
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("qemu-img info failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("qemu-img info failed: %w", err)
+	}
+
+	return parseImageInfo(output)
+}
+
+// parseImageInfo decodes the JSON output of qemu-img info
+func parseImageInfo(output []byte) (*ImageInfo, error) {
+	var info ImageInfo
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse qemu-img info output: %w", err)
+	}
+	if info.Format == "" {
+		return nil, fmt.Errorf("qemu-img info reported no image format")
+	}
+	return &info, nil
+}
+
+// ErrorCode returns the S3 error code, such as NoSuchKey, of a MinIO error in
+// err's chain, or an empty string if there is none
+func ErrorCode(err error) string {
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) {
+		return resp.Code
+	}
+	return ""
+}
+
+// splitImageURL extracts the bucket and object name from an image URL
+func splitImageURL(imageURL string) (string, string, error) {
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid image URL: %w", err)
+	}
+
+	pathParts := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+	if len(pathParts) < 2 {
+		return "", "", fmt.Errorf("invalid image URL path: %s", u.Path)
+	}
+
+	return pathParts[0], strings.Join(pathParts[1:], "/"), nil
 }
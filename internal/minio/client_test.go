@@ -2,9 +2,19 @@ package minio
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/notification"
+	"github.com/rossigee/libvirt-volume-provisioner/internal/cache"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -180,3 +190,176 @@ func TestValidateImageURL(t *testing.T) {
 		})
 	}
 }
+
+func TestParseImageInfo(t *testing.T) {
+	info, err := parseImageInfo([]byte(`{"virtual-size": 2361393152, "filename": "https://minio/images/a.qcow2", "format": "qcow2", "actual-size": 0}`))
+	require.NoError(t, err)
+	assert.Equal(t, "qcow2", info.Format)
+	assert.Equal(t, int64(2361393152), info.VirtualSize)
+
+	_, err = parseImageInfo([]byte(`{}`))
+	assert.Error(t, err)
+
+	_, err = parseImageInfo([]byte(`qemu-img: Could not open`))
+	assert.Error(t, err)
+}
+
+func TestValidateDestPath(t *testing.T) {
+	client := &Client{}
+
+	// Without configured directories the libvirt default applies
+	assert.NoError(t, client.validateDestPath("/var/lib/libvirt/images/ubuntu"))
+	assert.Error(t, client.validateDestPath("/srv/cache/images/ubuntu"))
+
+	client.SetAllowedDirs("/srv/cache/images/")
+
+	tests := []struct {
+		name        string
+		destPath    string
+		expectError bool
+	}{
+		{name: "inside allowed dir", destPath: "/srv/cache/images/ubuntu", expectError: false},
+		{name: "allowed dir itself", destPath: "/srv/cache/images", expectError: true},
+		{name: "sibling with common prefix", destPath: "/srv/cache/images-old/ubuntu", expectError: true},
+		{name: "path traversal", destPath: "/srv/cache/images/../../../etc/passwd", expectError: true},
+		{name: "relative path", destPath: "images/ubuntu", expectError: true},
+		{name: "previous default", destPath: "/var/lib/libvirt/images/ubuntu", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := client.validateDestPath(tt.destPath)
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "invalid destination path")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCreateStagingFile(t *testing.T) {
+	client := &Client{}
+	assert.Error(t, client.SetStagingDir("staging", 0))
+
+	stagingDir := filepath.Join(t.TempDir(), "staging")
+	require.NoError(t, client.SetStagingDir(stagingDir, 0))
+
+	// The staging directory is created on demand
+	file, err := client.createStagingFile(1024)
+	require.NoError(t, err)
+	_ = file.Close()
+	assert.Equal(t, stagingDir, filepath.Dir(file.Name()))
+
+	available, err := cache.FilesystemAvailable(stagingDir)
+	require.NoError(t, err)
+	require.NoError(t, client.SetStagingDir(stagingDir, available))
+
+	_, err = client.createStagingFile(1024 * 1024)
+	assert.ErrorIs(t, err, cache.ErrInsufficientSpace)
+}
+
+func TestObjectChange(t *testing.T) {
+	var record notification.Event
+	record.EventName = "s3:ObjectCreated:Put"
+	record.S3.Bucket.Name = "images"
+	record.S3.Object.Key = "ubuntu%2F22.04+server.qcow2"
+
+	change := objectChange(record)
+	assert.Equal(t, "images", change.Bucket)
+	assert.Equal(t, "ubuntu/22.04 server.qcow2", change.Object)
+	assert.Equal(t, "s3:ObjectCreated:Put", change.Event)
+}
+
+func TestChunkHasher(t *testing.T) {
+	hasher := newChunkHasher()
+	hasher.write([]byte("hello "))
+	hasher.write([]byte("world"))
+
+	// SHA256 of "hello world"
+	assert.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", hasher.sum())
+	assert.GreaterOrEqual(t, hasher.bytesPerSecond(), float64(0))
+}
+
+func TestRetryableError(t *testing.T) {
+	missing := fmt.Errorf("failed to stat object: %w", minio.ErrorResponse{Code: "NoSuchKey", StatusCode: 404})
+	assert.False(t, retryableError(missing))
+	assert.False(t, retryableError(fmt.Errorf("staging: %w", cache.ErrInsufficientSpace)))
+	assert.False(t, retryableError(context.Canceled))
+
+	assert.True(t, retryableError(minio.ErrorResponse{Code: "SlowDown", StatusCode: 503}))
+	assert.True(t, retryableError(errors.New("connection reset by peer")))
+}
+
+func TestPing(t *testing.T) {
+	// Credentials that may not list buckets still show MinIO is reachable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<Error><Code>AccessDenied</Code><Message>Access Denied.</Message></Error>`))
+	}))
+	defer server.Close()
+
+	t.Setenv("MINIO_ENDPOINT", server.URL)
+	t.Setenv("MINIO_ACCESS_KEY", "test-access-key")
+	t.Setenv("MINIO_SECRET_KEY", "test-secret-key")
+	client, err := NewClient()
+	require.NoError(t, err)
+
+	endpoint, err := client.Ping(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL, endpoint)
+
+	// Nothing listens once the server is closed
+	server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err = client.Ping(ctx)
+	assert.ErrorContains(t, err, "not reachable")
+}
+
+func TestPutURLContent(t *testing.T) {
+	var path, contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+				`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></LocationConstraint>`))
+			return
+		}
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	}))
+	defer server.Close()
+
+	t.Setenv("MINIO_ENDPOINT", server.URL)
+	t.Setenv("MINIO_ACCESS_KEY", "test-access-key")
+	t.Setenv("MINIO_SECRET_KEY", "test-secret-key")
+	t.Setenv("MINIO_BREAKER_THRESHOLD", "1")
+	client, err := NewClient()
+	require.NoError(t, err)
+
+	err = client.PutURLContent(context.Background(), server.URL+"/reports/hv01/job.json", []byte(`{"job":{}}`),
+		"application/json")
+	require.NoError(t, err)
+	assert.Equal(t, "/reports/hv01/job.json", path)
+	assert.Equal(t, "application/json", contentType)
+	assert.Contains(t, string(body), `{"job":{}}`) // Possibly in signed chunks
+
+	assert.Error(t, client.PutURLContent(context.Background(), server.URL+"/reports", nil, "application/json"))
+
+	// Failed writes do not stop image downloads
+	server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	assert.Error(t, client.PutURLContent(ctx, server.URL+"/reports/hv01/job.json", nil, "application/json"))
+	assert.NoError(t, client.Available())
+}
@@ -0,0 +1,167 @@
+package minio
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DirectoryServer serves the files of a directory over the S3 API as a stand-in for
+// MinIO, each subdirectory being a bucket, e.g. for development without MinIO. Only
+// the read requests the provisioner makes are supported, and requests are not
+// authenticated.
+type DirectoryServer struct {
+	root     *os.Root
+	listener net.Listener
+	server   *http.Server
+}
+
+// s3Error is the body of an S3 error response
+type s3Error struct {
+	XMLName    xml.Name `xml:"Error"`
+	Code       string   `xml:"Code"`
+	Message    string   `xml:"Message"`
+	BucketName string   `xml:"BucketName,omitempty"`
+	Key        string   `xml:"Key,omitempty"`
+}
+
+// listBucketsResult is the body of a ListBuckets response
+type listBucketsResult struct {
+	XMLName xml.Name     `xml:"ListAllMyBucketsResult"`
+	Buckets []bucketInfo `xml:"Buckets>Bucket"`
+}
+
+// bucketInfo is a bucket in a ListBuckets response
+type bucketInfo struct {
+	Name         string    `xml:"Name"`
+	CreationDate time.Time `xml:"CreationDate"`
+}
+
+// NewDirectoryServer serves dir on a local port until Close is called
+func NewDirectoryServer(dir string) (*DirectoryServer, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image directory: %w", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = root.Close()
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	s := &DirectoryServer{root: root, listener: listener}
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.WithError(err).Error("Image directory server failed")
+		}
+	}()
+	return s, nil
+}
+
+// URL returns the endpoint to configure as MINIO_ENDPOINT
+func (s *DirectoryServer) URL() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+// Close stops serving the directory
+func (s *DirectoryServer) Close() error {
+	err := s.server.Close()
+	_ = s.root.Close()
+	return err
+}
+
+// ServeHTTP answers ListBuckets, GetBucketLocation, and HeadObject and GetObject
+// requests, including ranges and conditional requests
+func (s *DirectoryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeS3Error(w, http.StatusNotImplemented, s3Error{Code: "NotImplemented", Message: "read-only server"})
+		return
+	}
+	bucket, object, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case bucket == "":
+		s.listBuckets(w)
+		return
+	case !fs.ValidPath(bucket):
+		writeS3Error(w, http.StatusBadRequest, s3Error{Code: "InvalidBucketName", Message: "invalid bucket name"})
+		return
+	}
+	if info, err := s.root.Stat(bucket); err != nil || !info.IsDir() {
+		writeS3Error(w, http.StatusNotFound, s3Error{Code: "NoSuchBucket", Message: "bucket does not exist",
+			BucketName: bucket})
+		return
+	}
+	if object == "" {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = fmt.Fprint(w, xml.Header+
+				`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></LocationConstraint>`)
+			return
+		}
+		writeS3Error(w, http.StatusNotImplemented, s3Error{Code: "NotImplemented", Message: "bucket listing"})
+		return
+	}
+	s.serveObject(w, r, bucket, object)
+}
+
+// serveObject serves the file of an object
+func (s *DirectoryServer) serveObject(w http.ResponseWriter, r *http.Request, bucket, object string) {
+	notFound := s3Error{Code: "NoSuchKey", Message: "object does not exist", BucketName: bucket, Key: object}
+	// Objects may not name files outside their bucket
+	if !fs.ValidPath(object) {
+		writeS3Error(w, http.StatusNotFound, notFound)
+		return
+	}
+	file, err := s.root.Open(path.Join(bucket, object))
+	if err != nil {
+		writeS3Error(w, http.StatusNotFound, notFound)
+		return
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		writeS3Error(w, http.StatusNotFound, notFound)
+		return
+	}
+
+	// The ETag changes whenever the file is replaced or written to
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, object, info.ModTime(), file)
+}
+
+// listBuckets lists the subdirectories of the directory as buckets
+func (s *DirectoryServer) listBuckets(w http.ResponseWriter) {
+	entries, err := fs.ReadDir(s.root.FS(), ".")
+	if err != nil {
+		writeS3Error(w, http.StatusInternalServerError, s3Error{Code: "InternalError", Message: err.Error()})
+		return
+	}
+	var result listBucketsResult
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		result.Buckets = append(result.Buckets, bucketInfo{Name: entry.Name(), CreationDate: info.ModTime().UTC()})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+// writeS3Error writes an S3 error response
+func writeS3Error(w http.ResponseWriter, status int, body s3Error) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,63 @@
+package minio
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryServer(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "images", "ubuntu"), 0o750))
+	image := []byte("raw image contents")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "images", "ubuntu", "22.04.raw"), image, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret"), []byte("outside"), 0o600))
+
+	server, err := NewDirectoryServer(dir)
+	require.NoError(t, err)
+	defer func() { _ = server.Close() }()
+
+	t.Setenv("MINIO_ENDPOINT", server.URL())
+	t.Setenv("MINIO_ACCESS_KEY", "dev")
+	t.Setenv("MINIO_SECRET_KEY", "dev")
+	t.Setenv("MINIO_RETRY_ATTEMPTS", "1")
+	client, err := NewClient()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = client.Ping(ctx)
+	require.NoError(t, err)
+
+	imageURL := "http://minio/images/ubuntu/22.04.raw"
+	info, err := client.StatImage(ctx, imageURL)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(image)), info.Size)
+
+	modified, err := client.ObjectModified(ctx, "images", "ubuntu/22.04.raw", info.ETag, info.LastModified)
+	require.NoError(t, err)
+	assert.False(t, modified)
+
+	content, err := client.GetObjectContent(ctx, "images", "ubuntu/22.04.raw")
+	require.NoError(t, err)
+	assert.Equal(t, image, content)
+
+	destDir := t.TempDir()
+	client.SetAllowedDirs(destDir)
+	_, err = client.DownloadImageToPath(ctx, imageURL, filepath.Join(destDir, "ubuntu.raw"), nil)
+	require.NoError(t, err)
+	downloaded, err := os.ReadFile(filepath.Join(destDir, "ubuntu.raw"))
+	require.NoError(t, err)
+	assert.Equal(t, image, downloaded)
+
+	// Missing objects and paths leaving the directory are not found
+	_, err = client.StatImage(ctx, "http://minio/images/ubuntu/20.04.raw")
+	assert.Error(t, err)
+	_, err = client.GetObjectContent(ctx, "images", "../secret")
+	assert.Error(t, err)
+	_, err = client.StatImage(ctx, "http://minio/missing/image.raw")
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+package minio
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// minThroughputSample is the smallest response body whose throughput is recorded,
+// so that small metadata requests do not drown out image transfers
+const minThroughputSample = 1 << 20
+
+var (
+	connectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "libvirt_volume_provisioner_minio_connections_total",
+			Help: "Connections used for MinIO requests, by whether an idle connection was reused",
+		},
+		[]string{"reused"},
+	)
+
+	tlsHandshakeSeconds = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "libvirt_volume_provisioner_minio_tls_handshake_seconds",
+			Help:    "Duration of TLS handshakes with MinIO",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 10),
+		},
+	)
+
+	minioRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "libvirt_volume_provisioner_minio_requests_total",
+			Help: "MinIO requests that received a response, by HTTP protocol version",
+		},
+		[]string{"protocol"},
+	)
+
+	transferThroughput = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "libvirt_volume_provisioner_minio_transfer_bytes_per_second",
+			Help:    "Throughput of MinIO response bodies of at least 1 MiB",
+			Buckets: prometheus.ExponentialBuckets(1<<20, 2, 12),
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(connectionsTotal)
+	prometheus.MustRegister(tlsHandshakeSeconds)
+	prometheus.MustRegister(minioRequestsTotal)
+	prometheus.MustRegister(transferThroughput)
+}
+
+// instrumentedTransport records connection reuse, TLS handshakes, protocol versions
+// and transfer throughput of the requests it sends, and limits their bandwidth
+type instrumentedTransport struct {
+	next      http.RoundTripper
+	bandwidth *bandwidthLimiter
+}
+
+// RoundTrip implements http.RoundTripper
+func (t instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var handshakeStart time.Time
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			connectionsTotal.WithLabelValues(strconv.FormatBool(info.Reused)).Inc()
+		},
+		TLSHandshakeStart: func() {
+			handshakeStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil && !handshakeStart.IsZero() {
+				tlsHandshakeSeconds.Observe(time.Since(handshakeStart).Seconds())
+			}
+		},
+	}
+
+	resp, err := t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		return nil, err
+	}
+	minioRequestsTotal.WithLabelValues(resp.Proto).Inc()
+	resp.Body = &throughputBody{ReadCloser: resp.Body, start: time.Now()}
+	if t.bandwidth != nil {
+		resp.Body = newThrottledBody(req.Context(), resp.Body, t.bandwidth)
+	}
+	return resp, nil
+}
+
+// throughputBody measures how fast a response body is read, recording the
+// throughput when the body is closed
+type throughputBody struct {
+	io.ReadCloser
+	start time.Time
+	read  int64
+	once  sync.Once
+}
+
+// Read counts the bytes read from the body
+func (b *throughputBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+// Close records the throughput of bodies large enough to be meaningful
+func (b *throughputBody) Close() error {
+	b.once.Do(func() {
+		if elapsed := time.Since(b.start); b.read >= minThroughputSample && elapsed > 0 {
+			transferThroughput.Observe(float64(b.read) / elapsed.Seconds())
+		}
+	})
+	return b.ReadCloser.Close()
+}
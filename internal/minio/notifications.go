@@ -0,0 +1,59 @@
+package minio
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/notification"
+	"github.com/sirupsen/logrus"
+)
+
+// notificationRetryDelay is how long to wait before listening again after a failure
+const notificationRetryDelay = 10 * time.Second
+
+// ObjectChange is an object that was created, overwritten or deleted
+type ObjectChange struct {
+	Bucket string
+	Object string
+	Event  string
+}
+
+// WatchObjectChanges listens for objects being created, overwritten or deleted in bucket
+// and calls onChange for each, listening again after failures until ctx is cancelled
+func (c *Client) WatchObjectChanges(ctx context.Context, bucket string, onChange func(ObjectChange)) {
+	events := []string{string(notification.ObjectCreatedAll), string(notification.ObjectRemovedAll)}
+
+	for ctx.Err() == nil {
+		for info := range c.minioClient.ListenBucketNotification(ctx, bucket, "", "", events) {
+			if info.Err != nil {
+				if ctx.Err() == nil {
+					logrus.WithError(info.Err).WithField("bucket", bucket).Warn("MinIO bucket notifications interrupted")
+				}
+				break
+			}
+			for _, record := range info.Records {
+				onChange(objectChange(record))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(notificationRetryDelay):
+		}
+	}
+}
+
+// objectChange converts a bucket notification record, whose object key is URL-encoded
+func objectChange(record notification.Event) ObjectChange {
+	object := record.S3.Object.Key
+	if decoded, err := url.QueryUnescape(object); err == nil {
+		object = decoded
+	}
+	return ObjectChange{
+		Bucket: record.S3.Bucket.Name,
+		Object: object,
+		Event:  record.EventName,
+	}
+}
@@ -0,0 +1,171 @@
+package minio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// minPartSize is the smallest range downloaded over a connection of its own
+const minPartSize = 64 << 20
+
+// partCount returns the number of ranges to download an object of totalSize in.
+// Objects smaller than two parts are downloaded over a single connection.
+func (c *Client) partCount(totalSize int64) int {
+	return int(min(int64(max(c.downloadStreams, 1)), max(totalSize/minPartSize, 1)))
+}
+
+// downloadRanges downloads an object into destFile as contiguous ranges fetched
+// concurrently over separate connections, which can make better use of a long fat
+// WAN link than a single TCP stream. Every range must match the object's ETag, so
+// an object replaced during the download is not stitched together from two versions.
+// The ranges complete out of order, so the checksum is calculated afterwards.
+func (c *Client) downloadRanges(ctx context.Context, bucketName, objectName, etag string, totalSize int64,
+	parts int, destFile *os.File, updater ProgressUpdater) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg sync.WaitGroup
+		// mu serializes progress updates and guards the counters below
+		mu         sync.Mutex
+		downloaded int64
+		firstErr   error
+	)
+	progress := func(n int) {
+		mu.Lock()
+		defer mu.Unlock()
+		downloaded += int64(n)
+		if updater != nil {
+			percent := float64(downloaded) / float64(totalSize) * 30 // 30% of total progress
+			updater.UpdateProgress("downloading", 10+percent, downloaded, totalSize)
+		}
+	}
+
+	partSize := (totalSize + int64(parts) - 1) / int64(parts)
+	for start := int64(0); start < totalSize; start += partSize {
+		end := min(start+partSize, totalSize) - 1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.downloadRange(ctx, bucketName, objectName, etag, start, end, destFile, updater, progress)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel() // Stop the other ranges
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return "", firstErr
+	}
+	if downloaded != totalSize {
+		return "", fmt.Errorf("download incomplete: got %d bytes, expected %d", downloaded, totalSize)
+	}
+
+	return hashFile(ctx, destFile, updater)
+}
+
+// downloadRange writes the bytes start to end, inclusive, of an object to the same
+// offsets in destFile, calling progress with the size of each chunk written
+func (c *Client) downloadRange(ctx context.Context, bucketName, objectName, etag string, start, end int64,
+	destFile *os.File, updater ProgressUpdater, progress func(n int)) error {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(start, end); err != nil {
+		return fmt.Errorf("invalid range %d-%d: %w", start, end, err)
+	}
+	if etag != "" {
+		if err := opts.SetMatchETag(etag); err != nil {
+			return fmt.Errorf("invalid ETag: %w", err)
+		}
+	}
+
+	object, err := c.minioClient.GetObject(ctx, bucketName, objectName, opts)
+	if err != nil {
+		return fmt.Errorf("failed to get object range %d-%d: %w", start, end, err)
+	}
+	defer func() {
+		_ = object.Close() // Close errors are not critical
+	}()
+
+	buffer := make([]byte, 8*1024*1024) // 8MB buffer per range
+	pauser, pausable := updater.(Pauser)
+	offset := start
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("context cancelled: %w", ctx.Err())
+		default:
+		}
+
+		if pausable {
+			if err := pauser.WaitWhilePaused(ctx); err != nil {
+				return err
+			}
+		}
+
+		n, err := object.Read(buffer)
+		if n > 0 {
+			if _, writeErr := destFile.WriteAt(buffer[:n], offset); writeErr != nil {
+				return fmt.Errorf("failed to write to destination file: %w", writeErr)
+			}
+			offset += int64(n)
+			progress(n)
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read range %d-%d from MinIO: %w", start, end, err)
+		}
+	}
+
+	if offset != end+1 {
+		return fmt.Errorf("range %d-%d incomplete: got %d bytes", start, end, offset-start)
+	}
+	return nil
+}
+
+// hashFile calculates the checksum of a downloaded file, reporting the hashing throughput
+func hashFile(ctx context.Context, file *os.File, updater ProgressUpdater) (string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to rewind destination file: %w", err)
+	}
+
+	buffer := make([]byte, 32*1024*1024) // 32MB buffer
+	hasher := newChunkHasher()
+	hashRate, reportsHashRate := updater.(HashRateUpdater)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("context cancelled: %w", err)
+		}
+
+		n, err := file.Read(buffer)
+		if n > 0 {
+			hasher.write(buffer[:n])
+			if reportsHashRate {
+				hashRate.UpdateHashRate(hasher.bytesPerSecond())
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return hasher.sum(), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read destination file: %w", err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package minio
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartCount(t *testing.T) {
+	single := &Client{}
+	assert.Equal(t, 1, single.partCount(10*minPartSize))
+
+	client := &Client{downloadStreams: 4}
+	assert.Equal(t, 1, client.partCount(0))
+	assert.Equal(t, 1, client.partCount(minPartSize+1))
+	assert.Equal(t, 2, client.partCount(2*minPartSize))
+	assert.Equal(t, 4, client.partCount(100*minPartSize))
+}
+
+func TestHashFile(t *testing.T) {
+	content := []byte("downloaded out of order")
+	path := filepath.Join(t.TempDir(), "image.qcow2")
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+
+	// The file position is wherever the last range left it
+	_, err = file.Seek(5, 0)
+	require.NoError(t, err)
+
+	sum, err := hashFile(context.Background(), file, nil)
+	require.NoError(t, err)
+	expected := sha256.Sum256(content)
+	assert.Equal(t, hex.EncodeToString(expected[:]), sum)
+}
@@ -0,0 +1,139 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// TransportConfig tunes the HTTP transport used for MinIO requests. There is
+// deliberately no overall request timeout, which would abort large downloads;
+// a stalled transfer is detected by ReadIdleTimeout instead. A zero timeout
+// disables it.
+type TransportConfig struct {
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	// ReadIdleTimeout fails a request when no data arrives on its connection for this long.
+	// Over HTTP/2 the connection is instead health checked with a ping.
+	ReadIdleTimeout     time.Duration
+	MaxIdleConnsPerHost int
+	// ForceHTTP2 negotiates HTTP/2 with MinIO over TLS, multiplexing requests on one connection
+	ForceHTTP2 bool
+}
+
+// DefaultTransportConfig returns the transport settings used unless overridden
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		DialTimeout:           10 * time.Second,
+		KeepAlive:             30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+		ReadIdleTimeout:       time.Minute,
+		MaxIdleConnsPerHost:   16,
+	}
+}
+
+// transportConfigFromEnv reads the transport settings from MINIO_*_SECONDS
+// environment variables, keeping the defaults for unset variables
+func transportConfigFromEnv() (TransportConfig, error) {
+	cfg := DefaultTransportConfig()
+
+	durations := []struct {
+		env   string
+		value *time.Duration
+	}{
+		{"MINIO_DIAL_TIMEOUT_SECONDS", &cfg.DialTimeout},
+		{"MINIO_KEEPALIVE_SECONDS", &cfg.KeepAlive},
+		{"MINIO_TLS_HANDSHAKE_TIMEOUT_SECONDS", &cfg.TLSHandshakeTimeout},
+		{"MINIO_RESPONSE_HEADER_TIMEOUT_SECONDS", &cfg.ResponseHeaderTimeout},
+		{"MINIO_IDLE_CONN_TIMEOUT_SECONDS", &cfg.IdleConnTimeout},
+		{"MINIO_READ_IDLE_TIMEOUT_SECONDS", &cfg.ReadIdleTimeout},
+	}
+	for _, d := range durations {
+		value := os.Getenv(d.env)
+		if value == "" {
+			continue
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return cfg, fmt.Errorf("invalid %s '%s': must be a non-negative number of seconds", d.env, value)
+		}
+		*d.value = time.Duration(seconds) * time.Second
+	}
+
+	if value := os.Getenv("MINIO_MAX_IDLE_CONNS_PER_HOST"); value != "" {
+		conns, err := strconv.Atoi(value)
+		if err != nil || conns < 1 {
+			return cfg, fmt.Errorf("invalid MINIO_MAX_IDLE_CONNS_PER_HOST '%s': must be a positive number", value)
+		}
+		cfg.MaxIdleConnsPerHost = conns
+	}
+
+	if value := os.Getenv("MINIO_FORCE_HTTP2"); value != "" {
+		force, err := strconv.ParseBool(value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid MINIO_FORCE_HTTP2 '%s': must be true or false", value)
+		}
+		cfg.ForceHTTP2 = force
+	}
+
+	return cfg, nil
+}
+
+// newTransport creates an HTTP transport for MinIO, starting from minio-go's
+// defaults so that TLS settings and disabled compression are kept
+func newTransport(secure bool, cfg TransportConfig) (*http.Transport, error) {
+	transport, err := minio.DefaultTransport(secure)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MinIO transport: %w", err)
+	}
+
+	// An HTTP/2 connection is read continuously on behalf of all its streams, so
+	// read deadlines would close it whenever it is idle; it is pinged instead
+	readIdleTimeout := cfg.ReadIdleTimeout
+	if cfg.ForceHTTP2 {
+		transport.ForceAttemptHTTP2 = true
+		transport.HTTP2 = &http.HTTP2Config{SendPingTimeout: cfg.ReadIdleTimeout}
+		readIdleTimeout = 0
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: cfg.KeepAlive}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil || readIdleTimeout <= 0 {
+			return conn, err
+		}
+		return &idleTimeoutConn{Conn: conn, timeout: readIdleTimeout}, nil
+	}
+	transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+
+	return transport, nil
+}
+
+// idleTimeoutConn fails reads that receive no data within timeout, while allowing
+// a transfer that keeps making progress to take as long as it needs
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+// Read extends the read deadline before every read
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
@@ -0,0 +1,63 @@
+package minio
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportConfigFromEnv(t *testing.T) {
+	cfg, err := transportConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTransportConfig(), cfg)
+
+	t.Setenv("MINIO_RESPONSE_HEADER_TIMEOUT_SECONDS", "120")
+	t.Setenv("MINIO_READ_IDLE_TIMEOUT_SECONDS", "0")
+	t.Setenv("MINIO_MAX_IDLE_CONNS_PER_HOST", "4")
+	cfg, err = transportConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, cfg.ResponseHeaderTimeout)
+	assert.Zero(t, cfg.ReadIdleTimeout)
+	assert.Equal(t, 4, cfg.MaxIdleConnsPerHost)
+
+	transport, err := newTransport(true, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, transport.ResponseHeaderTimeout)
+	assert.True(t, transport.DisableCompression)
+	require.NotNil(t, transport.TLSClientConfig)
+
+	t.Setenv("MINIO_FORCE_HTTP2", "true")
+	cfg, err = transportConfigFromEnv()
+	require.NoError(t, err)
+	transport, err = newTransport(true, cfg)
+	require.NoError(t, err)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	require.NotNil(t, transport.HTTP2)
+
+	t.Setenv("MINIO_DIAL_TIMEOUT_SECONDS", "-1")
+	_, err = transportConfigFromEnv()
+	assert.Error(t, err)
+}
+
+func TestIdleTimeoutConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = server.Close() }()
+	conn := &idleTimeoutConn{Conn: client, timeout: 50 * time.Millisecond}
+	defer func() { _ = conn.Close() }()
+
+	// Data arriving within the timeout is read normally
+	go func() { _, _ = server.Write([]byte("chunk")) }()
+	buf := make([]byte, 5)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "chunk", string(buf[:n]))
+
+	// A stalled transfer fails
+	_, err = conn.Read(buf)
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+}
@@ -0,0 +1,187 @@
+// Package netbox provides a minimal NetBox API client used to validate requested
+// volume sizes against the sizes recorded for virtual machines and their disks.
+package netbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// virtualMachineType is the NetBox content type of virtual machines
+	virtualMachineType = "virtualization.virtualmachine"
+
+	// MegabytesPerGB converts GB to the megabytes NetBox (4.0+) records disk sizes in
+	MegabytesPerGB = 1000
+)
+
+// Object identifies the NetBox object a job is tagged with
+type Object struct {
+	Type string
+	ID   int
+	Name string
+	URL  string
+}
+
+// Client is a NetBox REST API client
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient creates a NetBox client for the instance at baseURL
+func NewClient(baseURL, token string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid NetBox URL '%s'", baseURL)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("NetBox API token must not be empty")
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// virtualMachine is the subset of the NetBox virtual machine representation used here
+type virtualMachine struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	DisplayURL string `json:"display_url"`
+	Disk       *int   `json:"disk"`
+}
+
+// virtualDisk is the subset of the NetBox virtual disk representation used here
+type virtualDisk struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+// ValidateVolume checks a requested volume size against NetBox and returns the
+// virtual machine the volume belongs to. When diskName is set the size is checked
+// against that virtual disk, otherwise against the virtual machine's total disk size.
+// The size is given in megabytes, as NetBox records it.
+func (c *Client) ValidateVolume(ctx context.Context, vmID int, diskName string, sizeMB int) (*Object, error) {
+	object, recordedMB, err := c.RecordedSize(ctx, vmID, diskName)
+	if err != nil {
+		return nil, err
+	}
+
+	if sizeMB > recordedMB {
+		return nil, fmt.Errorf("requested size %d MB exceeds %d MB recorded in NetBox for %s",
+			sizeMB, recordedMB, object.Name)
+	}
+
+	return object, nil
+}
+
+// RecordedSize returns a virtual machine and the size in megabytes NetBox records for
+// its virtual disk diskName, or for its total disk size if diskName is empty
+func (c *Client) RecordedSize(ctx context.Context, vmID int, diskName string) (*Object, int, error) {
+	var vm virtualMachine
+	if err := c.get(ctx, fmt.Sprintf("/api/virtualization/virtual-machines/%d/", vmID), nil, &vm); err != nil {
+		return nil, 0, fmt.Errorf("failed to look up NetBox virtual machine %d: %w", vmID, err)
+	}
+
+	object := &Object{Type: virtualMachineType, ID: vm.ID, Name: vm.Name, URL: vm.DisplayURL}
+
+	if diskName == "" {
+		if vm.Disk == nil {
+			return nil, 0, fmt.Errorf("virtual machine %s has no disk size recorded in NetBox", vm.Name)
+		}
+		return object, *vm.Disk, nil
+	}
+
+	var disks struct {
+		Results []virtualDisk `json:"results"`
+	}
+	query := url.Values{"virtual_machine_id": {fmt.Sprint(vmID)}, "name": {diskName}}
+	if err := c.get(ctx, "/api/virtualization/virtual-disks/", query, &disks); err != nil {
+		return nil, 0, fmt.Errorf("failed to look up NetBox virtual disk %s: %w", diskName, err)
+	}
+	if len(disks.Results) == 0 {
+		return nil, 0, fmt.Errorf("virtual machine %s has no disk named %s in NetBox", vm.Name, diskName)
+	}
+	return object, disks.Results[0].Size, nil
+}
+
+// RecordVolume writes the provisioned volume details back to NetBox as a journal entry
+func (c *Client) RecordVolume(ctx context.Context, object *Object, comments string) error {
+	entry := map[string]interface{}{
+		"assigned_object_type": object.Type,
+		"assigned_object_id":   object.ID,
+		"kind":                 "success",
+		"comments":             comments,
+	}
+	if err := c.post(ctx, "/api/extras/journal-entries/", entry); err != nil {
+		return fmt.Errorf("failed to create NetBox journal entry: %w", err)
+	}
+	return nil
+}
+
+// get performs a GET request and decodes the JSON response into out
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	return c.do(req, out)
+}
+
+// post performs a POST request with a JSON body
+func (c *Client) post(ctx context.Context, path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(req, nil)
+}
+
+// do sends an authenticated request and decodes the JSON response into out, if set
+func (c *Client) do(req *http.Request, out interface{}) error {
+	req.Header.Set("Authorization", "Token "+c.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, journal *map[string]interface{}) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/virtualization/virtual-machines/42/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"id": 42, "name": "web01", "display_url": "https://netbox/vm/42/", "disk": 40000}`))
+	})
+	mux.HandleFunc("/api/virtualization/virtual-machines/43/", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 43, "name": "web02", "disk": null}`))
+	})
+	mux.HandleFunc("/api/virtualization/virtual-disks/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") == "root" {
+			_, _ = w.Write([]byte(`{"results": [{"id": 1, "name": "root", "size": 20000}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"results": []}`))
+	})
+	mux.HandleFunc("/api/extras/journal-entries/", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(journal))
+		w.WriteHeader(http.StatusCreated)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestNewClient(t *testing.T) {
+	_, err := NewClient("netbox.example.com", "secret")
+	assert.Error(t, err)
+
+	_, err = NewClient("https://netbox.example.com", "")
+	assert.Error(t, err)
+
+	client, err := NewClient("https://netbox.example.com/", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "https://netbox.example.com", client.baseURL)
+}
+
+func TestValidateVolume(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "secret")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		vmID        int
+		disk        string
+		sizeMB      int
+		expectError string
+	}{
+		{name: "within vm disk size", vmID: 42, sizeMB: 40000},
+		{name: "exceeds vm disk size", vmID: 42, sizeMB: 41000, expectError: "exceeds"},
+		{name: "within virtual disk size", vmID: 42, disk: "root", sizeMB: 20000},
+		{name: "exceeds virtual disk size", vmID: 42, disk: "root", sizeMB: 25000, expectError: "exceeds"},
+		{name: "unknown virtual disk", vmID: 42, disk: "data", sizeMB: 10000, expectError: "no disk named"},
+		{name: "no disk size recorded", vmID: 43, sizeMB: 10000, expectError: "no disk size"},
+		{name: "unknown vm", vmID: 44, sizeMB: 10000, expectError: "unexpected status 404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object, err := client.ValidateVolume(ctx, tt.vmID, tt.disk, tt.sizeMB)
+			if tt.expectError != "" {
+				assert.ErrorContains(t, err, tt.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "virtualization.virtualmachine", object.Type)
+			assert.Equal(t, 42, object.ID)
+			assert.Equal(t, "web01", object.Name)
+			assert.Equal(t, "https://netbox/vm/42/", object.URL)
+		})
+	}
+}
+
+func TestRecordedSize(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "secret")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	object, sizeMB, err := client.RecordedSize(ctx, 42, "")
+	require.NoError(t, err)
+	assert.Equal(t, "web01", object.Name)
+	assert.Equal(t, 40000, sizeMB)
+
+	_, sizeMB, err = client.RecordedSize(ctx, 42, "root")
+	require.NoError(t, err)
+	assert.Equal(t, 20000, sizeMB)
+
+	_, _, err = client.RecordedSize(ctx, 42, "data")
+	assert.ErrorContains(t, err, "no disk named data")
+}
+
+func TestRecordVolume(t *testing.T) {
+	var journal map[string]interface{}
+	server := newTestServer(t, &journal)
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "secret")
+	require.NoError(t, err)
+
+	object := &Object{Type: "virtualization.virtualmachine", ID: 42, Name: "web01"}
+	require.NoError(t, client.RecordVolume(context.Background(), object, "Provisioned LVM volume web01-root"))
+
+	assert.Equal(t, "virtualization.virtualmachine", journal["assigned_object_type"])
+	assert.InDelta(t, 42, journal["assigned_object_id"], 0)
+	assert.Equal(t, "Provisioned LVM volume web01-root", journal["comments"])
+}
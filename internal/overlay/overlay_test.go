@@ -0,0 +1,38 @@
+package overlay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBackingFile(t *testing.T) {
+	backing, err := parseBackingFile([]byte(`{
+		"virtual-size": 10737418240,
+		"filename": "/var/lib/lvp/overlays/vm-1.qcow2",
+		"format": "qcow2",
+		"backing-filename": "ubuntu.qcow2",
+		"full-backing-filename": "/var/lib/libvirt/images/ubuntu.qcow2",
+		"backing-filename-format": "qcow2"
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "/var/lib/libvirt/images/ubuntu.qcow2", backing)
+
+	backing, err = parseBackingFile([]byte(`{"filename": "standalone.qcow2", "format": "qcow2"}`))
+	require.NoError(t, err)
+	assert.Empty(t, backing)
+
+	_, err = parseBackingFile([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestNewManager(t *testing.T) {
+	_, err := NewManager("relative/overlays")
+	assert.Error(t, err)
+}
+
+func TestPath(t *testing.T) {
+	m := &Manager{dir: "/var/lib/lvp/overlays"}
+	assert.Equal(t, "/var/lib/lvp/overlays/vm-1.qcow2", m.Path("vm-1"))
+}
@@ -0,0 +1,95 @@
+// Package profiles provides named provisioning profiles, so that requests can
+// reference a profile and override only the fields that differ.
+package profiles
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// Profile holds default values for provisioning requests
+type Profile struct {
+	ImageURL     string `json:"image_url,omitempty"`
+	ImageType    string `json:"image_type,omitempty"`
+	VolumeSizeGB int    `json:"volume_size_gb,omitempty"`
+	CachePool    string `json:"cache_pool,omitempty"`
+	VolumeFormat string `json:"volume_format,omitempty"`
+}
+
+// Profiles is a set of named provisioning profiles
+type Profiles map[string]Profile
+
+// Load reads named profiles from a JSON file. Unknown fields are rejected so that
+// settings the provisioner does not support are not silently ignored.
+func Load(path string) (Profiles, error) {
+	//nolint:gosec // File path is controlled by admin via environment variable
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var profiles Profiles
+	if err := decoder.Decode(&profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles: %w", err)
+	}
+
+	for name, profile := range profiles {
+		if name == "" {
+			return nil, fmt.Errorf("profile name must not be empty")
+		}
+		if profile.VolumeSizeGB < 0 {
+			return nil, fmt.Errorf("profile %s: volume_size_gb must not be negative", name)
+		}
+	}
+
+	return profiles, nil
+}
+
+// Names returns the profile names in sorted order
+func (p Profiles) Names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply fills the fields a request leaves unset from the profile it references.
+// Requests without a profile are returned unchanged.
+func (p Profiles) Apply(req types.ProvisionRequest) (types.ProvisionRequest, error) {
+	if req.Profile == "" {
+		return req, nil
+	}
+
+	profile, ok := p[req.Profile]
+	if !ok {
+		return req, fmt.Errorf("unknown profile: %s", req.Profile)
+	}
+
+	if req.NeedsImage() && req.ImageURL == "" {
+		req.ImageURL = profile.ImageURL
+	}
+	if req.NeedsImage() && req.ImageType == "" {
+		req.ImageType = profile.ImageType
+	}
+	if !req.HasSize() {
+		req.VolumeSizeGB = profile.VolumeSizeGB
+	}
+	if req.CachePool == "" {
+		req.CachePool = profile.CachePool
+	}
+	if req.NeedsImage() && !req.Overlay && req.VolumeFormat == "" {
+		req.VolumeFormat = profile.VolumeFormat
+	}
+
+	return req, nil
+}
@@ -0,0 +1,89 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeProfiles(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	profiles, err := Load(writeProfiles(t, `{
+		"k8s-worker": {"image_url": "https://minio/images/ubuntu.qcow2", "image_type": "qcow2", "volume_size_gb": 50},
+		"db": {"image_url": "https://minio/images/debian.qcow2", "volume_size_gb": 200, "cache_pool": "fast-images"}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db", "k8s-worker"}, profiles.Names())
+	assert.Equal(t, 50, profiles["k8s-worker"].VolumeSizeGB)
+
+	tests := map[string]string{
+		"unsupported field": `{"k8s-worker": {"image_url": "https://minio/images/a.qcow2", "encryption": true}}`,
+		"negative size":     `{"k8s-worker": {"volume_size_gb": -1}}`,
+		"empty name":        `{"": {"volume_size_gb": 10}}`,
+		"invalid json":      `[`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writeProfiles(t, content))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	profiles := Profiles{
+		"k8s-worker": {
+			ImageURL:     "https://minio/images/ubuntu.qcow2",
+			ImageType:    "qcow2",
+			VolumeSizeGB: 50,
+			CachePool:    "images",
+		},
+	}
+
+	// Only the volume name is given
+	req, err := profiles.Apply(types.ProvisionRequest{VolumeName: "worker-1", Profile: "k8s-worker"})
+	require.NoError(t, err)
+	assert.Equal(t, types.ProvisionRequest{
+		ImageURL:     "https://minio/images/ubuntu.qcow2",
+		VolumeName:   "worker-1",
+		VolumeSizeGB: 50,
+		ImageType:    "qcow2",
+		CachePool:    "images",
+		Profile:      "k8s-worker",
+	}, req)
+
+	// Request fields override the profile
+	req, err = profiles.Apply(types.ProvisionRequest{VolumeName: "worker-2", Profile: "k8s-worker", VolumeSizeGB: 100})
+	require.NoError(t, err)
+	assert.Equal(t, 100, req.VolumeSizeGB)
+
+	// Blank volumes take the size but not the image
+	req, err = profiles.Apply(types.ProvisionRequest{VolumeName: "worker-3", Profile: "k8s-worker", Type: types.VolumeTypeBlank})
+	require.NoError(t, err)
+	assert.Empty(t, req.ImageURL)
+	assert.Empty(t, req.ImageType)
+	assert.Equal(t, 50, req.VolumeSizeGB)
+
+	// Requests without a profile are unchanged
+	original := types.ProvisionRequest{VolumeName: "vm", ImageURL: "https://minio/images/a.qcow2", VolumeSizeGB: 10}
+	req, err = profiles.Apply(original)
+	require.NoError(t, err)
+	assert.Equal(t, original, req)
+
+	_, err = profiles.Apply(types.ProvisionRequest{VolumeName: "vm", Profile: "missing"})
+	assert.ErrorContains(t, err, "unknown profile")
+
+	// A nil profile set rejects profile references
+	_, err = Profiles(nil).Apply(types.ProvisionRequest{VolumeName: "vm", Profile: "k8s-worker"})
+	assert.Error(t, err)
+}
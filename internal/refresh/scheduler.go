@@ -0,0 +1,164 @@
+// Package refresh re-downloads cached images on configurable cron schedules,
+// keeping golden images warm in the cache when their upstream version changes.
+package refresh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+// refreshTimeout bounds a single scheduled run
+const refreshTimeout = 2 * time.Hour
+
+// ImageRefresher refreshes a cached image. It is implemented by jobs.Manager.
+type ImageRefresher interface {
+	RefreshImage(ctx context.Context, imageURL, cachePool string) (bool, string, error)
+}
+
+// Schedule lists images refreshed together on a cron schedule
+type Schedule struct {
+	Schedule   string   `json:"schedule"`
+	Images     []string `json:"images"`
+	CachePool  string   `json:"cache_pool,omitempty"`
+	WebhookURL string   `json:"webhook_url,omitempty"`
+}
+
+// Notification is posted to a schedule's webhook when a new image version is cached
+type Notification struct {
+	ImageURL  string    `json:"image_url"`
+	CachePool string    `json:"cache_pool,omitempty"`
+	ImagePath string    `json:"image_path"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// LoadSchedules reads refresh schedules from a JSON file and validates them
+func LoadSchedules(path string) ([]Schedule, error) {
+	//nolint:gosec // File path is controlled by admin via environment variable
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refresh schedules: %w", err)
+	}
+
+	var schedules []Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return nil, fmt.Errorf("failed to parse refresh schedules: %w", err)
+	}
+
+	for i, schedule := range schedules {
+		if _, err := cron.ParseStandard(schedule.Schedule); err != nil {
+			return nil, fmt.Errorf("invalid cron expression in schedule %d: %w", i, err)
+		}
+		if len(schedule.Images) == 0 {
+			return nil, fmt.Errorf("schedule %d lists no images", i)
+		}
+	}
+
+	return schedules, nil
+}
+
+// Scheduler runs image refresh schedules
+type Scheduler struct {
+	cron       *cron.Cron
+	refresher  ImageRefresher
+	httpClient *http.Client
+}
+
+// NewScheduler creates a scheduler for the given schedules
+func NewScheduler(schedules []Schedule, refresher ImageRefresher) (*Scheduler, error) {
+	s := &Scheduler{
+		// Skip a run if the previous run of the same schedule is still in progress
+		cron:       cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger))),
+		refresher:  refresher,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	for _, schedule := range schedules {
+		schedule := schedule
+		if _, err := s.cron.AddFunc(schedule.Schedule, func() { s.run(schedule) }); err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %w", schedule.Schedule, err)
+		}
+	}
+
+	return s, nil
+}
+
+// Start starts running schedules in the background
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop stops scheduling new runs and waits for running ones to finish
+func (s *Scheduler) Stop() {
+	<-s.cron.Stop().Done()
+}
+
+// run refreshes every image of a schedule, notifying the webhook about new versions
+func (s *Scheduler) run(schedule Schedule) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	for _, imageURL := range schedule.Images {
+		logger := logrus.WithFields(logrus.Fields{
+			"image_url":  imageURL,
+			"cache_pool": schedule.CachePool,
+		})
+
+		updated, imagePath, err := s.refresher.RefreshImage(ctx, imageURL, schedule.CachePool)
+		if err != nil {
+			logger.WithError(err).Error("Scheduled image refresh failed")
+			continue
+		}
+		if !updated {
+			logger.Debug("Cached image is up to date")
+			continue
+		}
+
+		logger.WithField("image_path", imagePath).Info("Cached new image version")
+		if schedule.WebhookURL != "" {
+			s.notify(ctx, schedule.WebhookURL, Notification{
+				ImageURL:  imageURL,
+				CachePool: schedule.CachePool,
+				ImagePath: imagePath,
+				Timestamp: time.Now(),
+			})
+		}
+	}
+}
+
+// notify posts a new version notification, logging failures
+func (s *Scheduler) notify(ctx context.Context, webhookURL string, notification Notification) {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode refresh notification")
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(data))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create refresh notification")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		logrus.WithError(err).WithField("webhook", webhookURL).Warn("Failed to send refresh notification")
+		return
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		logrus.WithFields(logrus.Fields{
+			"webhook": webhookURL,
+			"status":  resp.StatusCode,
+		}).Warn("Refresh notification rejected")
+	}
+}
@@ -0,0 +1,109 @@
+package refresh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRefresher struct {
+	updated map[string]bool
+	failing map[string]bool
+	calls   []string
+}
+
+func (f *fakeRefresher) RefreshImage(_ context.Context, imageURL, cachePool string) (bool, string, error) {
+	f.calls = append(f.calls, cachePool+"|"+imageURL)
+	if f.failing[imageURL] {
+		return false, "", fmt.Errorf("download failed")
+	}
+	return f.updated[imageURL], "/var/lib/libvirt/images/" + filepath.Base(imageURL), nil
+}
+
+func writeSchedules(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "refresh.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadSchedules(t *testing.T) {
+	path := writeSchedules(t, `[
+		{"schedule": "0 3 * * *", "images": ["https://minio/images/ubuntu.qcow2"], "cache_pool": "images"},
+		{"schedule": "@hourly", "images": ["https://minio/images/debian.qcow2"], "webhook_url": "https://hooks/refresh"}
+	]`)
+
+	schedules, err := LoadSchedules(path)
+	require.NoError(t, err)
+	require.Len(t, schedules, 2)
+	assert.Equal(t, "images", schedules[0].CachePool)
+	assert.Equal(t, "https://hooks/refresh", schedules[1].WebhookURL)
+
+	tests := map[string]string{
+		"invalid cron": `[{"schedule": "every day", "images": ["https://minio/images/a.qcow2"]}]`,
+		"no images":    `[{"schedule": "0 3 * * *", "images": []}]`,
+		"invalid json": `{`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadSchedules(writeSchedules(t, content))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err = LoadSchedules(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	var notifications []Notification
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification Notification
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&notification))
+		notifications = append(notifications, notification)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	refresher := &fakeRefresher{
+		updated: map[string]bool{"https://minio/images/ubuntu.qcow2": true},
+		failing: map[string]bool{"https://minio/images/broken.qcow2": true},
+	}
+	schedule := Schedule{
+		Schedule: "0 3 * * *",
+		Images: []string{
+			"https://minio/images/broken.qcow2",
+			"https://minio/images/ubuntu.qcow2",
+			"https://minio/images/debian.qcow2",
+		},
+		CachePool:  "images",
+		WebhookURL: webhook.URL,
+	}
+
+	scheduler, err := NewScheduler([]Schedule{schedule}, refresher)
+	require.NoError(t, err)
+	scheduler.run(schedule)
+
+	// A failing image does not stop the remaining images from being refreshed
+	assert.Len(t, refresher.calls, 3)
+	assert.Equal(t, "images|https://minio/images/broken.qcow2", refresher.calls[0])
+
+	// Only new versions are notified
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "https://minio/images/ubuntu.qcow2", notifications[0].ImageURL)
+	assert.Equal(t, "/var/lib/libvirt/images/ubuntu.qcow2", notifications[0].ImagePath)
+	assert.Equal(t, "images", notifications[0].CachePool)
+}
+
+func TestNewSchedulerInvalidCron(t *testing.T) {
+	_, err := NewScheduler([]Schedule{{Schedule: "not cron", Images: []string{"x"}}}, &fakeRefresher{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,105 @@
+// Package release compares the running provisioner's version with the minimum
+// version published for the fleet, so that hosts left on an old binary are noticed.
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Manifest is the minimum version manifest published in MinIO, such as
+// {"minimum_version": "0.3.0", "message": "0.2.x misvalidates volume sizes"}
+type Manifest struct {
+	MinimumVersion string `json:"minimum_version"`
+	// Message explains why older versions must be replaced
+	Message string `json:"message,omitempty"`
+}
+
+// ParseManifest parses a minimum version manifest
+func ParseManifest(data []byte) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid version manifest: %w", err)
+	}
+	if manifest.MinimumVersion == "" {
+		return nil, fmt.Errorf("invalid version manifest: minimum_version is required")
+	}
+	if _, err := parse(manifest.MinimumVersion); err != nil {
+		return nil, fmt.Errorf("invalid version manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// Outdated reports whether version is older than the manifest's minimum version.
+// Versions that are not releases, such as "dev", cannot be compared.
+func (m *Manifest) Outdated(version string) (bool, error) {
+	c, err := Compare(version, m.MinimumVersion)
+	if err != nil {
+		return false, err
+	}
+	return c < 0, nil
+}
+
+// Compare compares two versions such as "0.3.0", "v1.2" or "1.0.0-rc1", returning -1,
+// 0 or 1. A pre-release is older than its release; build metadata after "+" is ignored.
+func Compare(a, b string) (int, error) {
+	va, err := parse(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parse(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range max(len(va.numbers), len(vb.numbers)) {
+		na, nb := va.number(i), vb.number(i)
+		if na != nb {
+			if na < nb {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	switch {
+	case va.preRelease == vb.preRelease:
+		return 0, nil
+	case va.preRelease == "":
+		return 1, nil
+	case vb.preRelease == "":
+		return -1, nil
+	}
+	return strings.Compare(va.preRelease, vb.preRelease), nil
+}
+
+// parsedVersion is a version split into its dot-separated numbers and pre-release
+type parsedVersion struct {
+	numbers    []int
+	preRelease string
+}
+
+// number returns the ith number of the version, missing numbers being zero
+func (v parsedVersion) number(i int) int {
+	if i < len(v.numbers) {
+		return v.numbers[i]
+	}
+	return 0
+}
+
+func parse(version string) (parsedVersion, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, preRelease, _ := strings.Cut(s, "-")
+
+	var parsed parsedVersion
+	for field := range strings.SplitSeq(s, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parsedVersion{}, fmt.Errorf("version %q is not a release version", version)
+		}
+		parsed.numbers = append(parsed.numbers, n)
+	}
+	parsed.preRelease = preRelease
+	return parsed, nil
+}
@@ -0,0 +1,52 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"0.3.0", "0.3.0", 0},
+		{"v0.3.0", "0.3", 0},
+		{"0.2.7", "0.3.0", -1},
+		{"0.10.0", "0.9.1", 1},
+		{"1.0.0-rc1", "1.0.0", -1},
+		{"1.0.0", "1.0.0-rc1", 1},
+		{"1.0.0-rc1", "1.0.0-rc2", -1},
+		{"1.0.0+abc123", "1.0.0", 0},
+	}
+	for _, tt := range tests {
+		got, err := Compare(tt.a, tt.b)
+		require.NoError(t, err, tt.a+" "+tt.b)
+		assert.Equal(t, tt.want, got, tt.a+" "+tt.b)
+	}
+
+	_, err := Compare("dev", "0.3.0")
+	assert.EqualError(t, err, `version "dev" is not a release version`)
+}
+
+func TestManifest(t *testing.T) {
+	manifest, err := ParseManifest([]byte(`{"minimum_version": "0.3.0", "message": "0.2.x misvalidates sizes"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "0.2.x misvalidates sizes", manifest.Message)
+
+	outdated, err := manifest.Outdated("0.2.7")
+	require.NoError(t, err)
+	assert.True(t, outdated)
+	outdated, err = manifest.Outdated("0.3.1")
+	require.NoError(t, err)
+	assert.False(t, outdated)
+	_, err = manifest.Outdated("dev")
+	assert.Error(t, err)
+
+	for _, data := range []string{`{}`, `{"minimum_version": "latest"}`, `not json`} {
+		_, err := ParseManifest([]byte(data))
+		assert.ErrorContains(t, err, "invalid version manifest", data)
+	}
+}
@@ -3,7 +3,9 @@ package retry
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"time"
 )
 
@@ -11,44 +13,121 @@ import (
 type Config struct {
 	MaxAttempts int
 	Delays      []time.Duration
+	// Jitter randomizes each delay by up to this fraction in either direction, e.g. 0.2 for ±20%
+	Jitter float64
+	// MaxElapsed stops retrying once another attempt would start after this much time; zero means no limit
+	MaxElapsed time.Duration
+	// Retryable classifies errors. Errors it rejects, and errors marked Permanent,
+	// fail immediately. If nil, every other error is retried.
+	Retryable func(err error) bool
+	// OnRetry, if set, is called after each failed attempt that will be retried
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// permanentError marks an error that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+// Error returns the underlying error message
+func (e *permanentError) Error() string { return e.err.Error() }
+
+// Unwrap returns the underlying error
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, e.g. a missing object or invalid input
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// retryable reports whether a failed attempt may be retried
+func (cfg Config) retryable(err error) bool {
+	if IsPermanent(err) {
+		return false
+	}
+	return cfg.Retryable == nil || cfg.Retryable(err)
+}
+
+// attemptsKey is the context key of the attempt recorder
+type attemptsKey struct{}
+
+// RecordAttempts returns a context in which WithRetry reports how many attempts it made
+// to record, e.g. so that a job can show how often each of its stages was retried.
+func RecordAttempts(ctx context.Context, record func(attempts int)) context.Context {
+	return context.WithValue(ctx, attemptsKey{}, record)
 }
 
 // WithRetry executes fn with exponential backoff retry logic.
-// It will attempt the function up to MaxAttempts times, with delays between attempts.
+// It will attempt the function up to MaxAttempts times, with delays between attempts,
+// unless an attempt fails with an error that is not retryable.
 // If MaxAttempts is exceeded, the last error is returned wrapped with context.
 func WithRetry(ctx context.Context, cfg Config, fn func() error) error {
 	if cfg.MaxAttempts <= 0 {
 		cfg.MaxAttempts = 1
 	}
 
-	var lastErr error
-	for attempt := 0; attempt < cfg.MaxAttempts; attempt++ {
-		// Apply delay before retry (not before first attempt)
-		if attempt > 0 {
-			// Get delay for this attempt
-			delayIndex := attempt - 1
-			if delayIndex >= len(cfg.Delays) {
-				delayIndex = len(cfg.Delays) - 1 // Use last delay if we run out
-			}
-			delay := cfg.Delays[delayIndex]
-
-			// Wait for delay or context cancellation
-			select {
-			case <-time.After(delay):
-				// Delay complete, continue to next attempt
-			case <-ctx.Done():
-				// Context cancelled
-				return fmt.Errorf("retry cancelled: %w", ctx.Err())
-			}
-		}
+	attempts := 0
+	if record, ok := ctx.Value(attemptsKey{}).(func(int)); ok {
+		defer func() { record(attempts) }()
+	}
 
+	start := time.Now()
+	for {
 		// Try the operation
+		attempts++
 		err := fn()
 		if err == nil {
 			return nil // Success!
 		}
-		lastErr = err
+
+		if !cfg.retryable(err) {
+			return fmt.Errorf("failed with non-retryable error after %d attempts: %w", attempts, err)
+		}
+		if attempts >= cfg.MaxAttempts {
+			return fmt.Errorf("failed after %d attempts: %w", cfg.MaxAttempts, err)
+		}
+
+		delay := cfg.delay(attempts - 1)
+		if cfg.MaxElapsed > 0 && time.Since(start)+delay > cfg.MaxElapsed {
+			return fmt.Errorf("failed after %d attempts, giving up after %s: %w", attempts, cfg.MaxElapsed, err)
+		}
+		if cfg.OnRetry != nil {
+			cfg.OnRetry(attempts, err, delay)
+		}
+
+		// Wait for delay or context cancellation
+		select {
+		case <-time.After(delay):
+			// Delay complete, continue to next attempt
+		case <-ctx.Done():
+			// Context cancelled
+			return fmt.Errorf("retry cancelled: %w", ctx.Err())
+		}
 	}
+}
 
-	return fmt.Errorf("failed after %d attempts: %w", cfg.MaxAttempts, lastErr)
+// delay returns the jittered delay before the retry following attempt index
+func (cfg Config) delay(index int) time.Duration {
+	if len(cfg.Delays) == 0 {
+		return 0
+	}
+	if index >= len(cfg.Delays) {
+		index = len(cfg.Delays) - 1 // Use last delay if we run out
+	}
+	delay := cfg.Delays[index]
+
+	if cfg.Jitter > 0 {
+		//nolint:gosec // Jitter does not need a cryptographic random source
+		delay = time.Duration(float64(delay) * (1 + cfg.Jitter*(2*rand.Float64()-1)))
+	}
+	return delay
 }
@@ -183,3 +183,117 @@ func TestWithRetry_SingleAttempt(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, 1, attempts)
 }
+
+func TestWithRetry_Jitter(t *testing.T) {
+	cfg := Config{
+		Delays: []time.Duration{100 * time.Millisecond},
+		Jitter: 0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		delay := cfg.delay(i)
+		assert.GreaterOrEqual(t, delay, 50*time.Millisecond)
+		assert.LessOrEqual(t, delay, 150*time.Millisecond)
+	}
+}
+
+func TestWithRetry_MaxElapsed(t *testing.T) {
+	cfg := Config{
+		MaxAttempts: 10,
+		Delays:      []time.Duration{20 * time.Millisecond},
+		MaxElapsed:  50 * time.Millisecond,
+	}
+
+	attempts := 0
+	err := WithRetry(context.Background(), cfg, func() error {
+		attempts++
+		return errors.New("error")
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "giving up after 50ms")
+	assert.Equal(t, 3, attempts)
+}
+
+func TestWithRetry_RecordAttempts(t *testing.T) {
+	cfg := Config{
+		MaxAttempts: 3,
+		Delays:      []time.Duration{time.Millisecond},
+	}
+
+	recorded := 0
+	ctx := RecordAttempts(context.Background(), func(attempts int) { recorded = attempts })
+
+	attempts := 0
+	err := WithRetry(ctx, cfg, func() error {
+		attempts++
+		if attempts < 2 {
+			return errors.New("transient error")
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, recorded)
+}
+
+func TestWithRetry_Permanent(t *testing.T) {
+	cfg := Config{
+		MaxAttempts: 3,
+		Delays:      []time.Duration{time.Millisecond},
+	}
+
+	notFound := errors.New("object not found")
+	attempts := 0
+	err := WithRetry(context.Background(), cfg, func() error {
+		attempts++
+		return Permanent(notFound)
+	})
+
+	assert.Equal(t, 1, attempts)
+	assert.ErrorIs(t, err, notFound)
+	assert.True(t, IsPermanent(err))
+	assert.Contains(t, err.Error(), "non-retryable")
+	assert.NoError(t, Permanent(nil))
+}
+
+func TestWithRetry_Classifier(t *testing.T) {
+	exists := errors.New("volume already exists")
+	cfg := Config{
+		MaxAttempts: 5,
+		Delays:      []time.Duration{time.Millisecond},
+		Retryable:   func(err error) bool { return !errors.Is(err, exists) },
+	}
+
+	attempts := 0
+	err := WithRetry(context.Background(), cfg, func() error {
+		attempts++
+		if attempts < 2 {
+			return errors.New("device busy")
+		}
+		return exists
+	})
+
+	assert.ErrorIs(t, err, exists)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestWithRetry_OnRetry(t *testing.T) {
+	var retried []int
+	cfg := Config{
+		MaxAttempts: 3,
+		Delays:      []time.Duration{time.Millisecond, 2 * time.Millisecond},
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			assert.EqualError(t, err, "error")
+			assert.Equal(t, time.Duration(attempt)*time.Millisecond, delay)
+			retried = append(retried, attempt)
+		},
+	}
+
+	err := WithRetry(context.Background(), cfg, func() error {
+		return errors.New("error")
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, []int{1, 2}, retried)
+}
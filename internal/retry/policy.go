@@ -0,0 +1,85 @@
+package retry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Stages that may be given their own retry policy
+const (
+	StageDownload = "download"
+	StageLVCreate = "lvcreate"
+	StageConvert  = "convert"
+)
+
+// Policy overrides the retry configuration of a stage. Unset fields keep the
+// configuration derived from the subsystem's environment variables.
+type Policy struct {
+	Attempts          int     `json:"attempts,omitempty"`
+	BackoffMs         []int   `json:"backoff_ms,omitempty"`
+	Jitter            float64 `json:"jitter,omitempty"`
+	MaxElapsedSeconds int     `json:"max_elapsed_seconds,omitempty"`
+}
+
+// Apply returns cfg with the fields set in the policy replaced
+func (p Policy) Apply(cfg Config) Config {
+	if p.Attempts > 0 {
+		cfg.MaxAttempts = p.Attempts
+	}
+	if len(p.BackoffMs) > 0 {
+		cfg.Delays = make([]time.Duration, len(p.BackoffMs))
+		for i, ms := range p.BackoffMs {
+			cfg.Delays[i] = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if p.Jitter > 0 {
+		cfg.Jitter = p.Jitter
+	}
+	if p.MaxElapsedSeconds > 0 {
+		cfg.MaxElapsed = time.Duration(p.MaxElapsedSeconds) * time.Second
+	}
+	return cfg
+}
+
+// LoadPolicies reads per-stage retry policies from a JSON object keyed by stage name.
+// Unknown stages and fields are rejected so that typos do not silently fall back to defaults.
+func LoadPolicies(path string) (map[string]Policy, error) {
+	//nolint:gosec // File path is controlled by admin via environment variable
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retry policies: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var policies map[string]Policy
+	if err := decoder.Decode(&policies); err != nil {
+		return nil, fmt.Errorf("failed to parse retry policies: %w", err)
+	}
+
+	for stage, policy := range policies {
+		switch stage {
+		case StageDownload, StageLVCreate, StageConvert:
+		default:
+			return nil, fmt.Errorf("unknown retry stage %q: must be %s, %s or %s",
+				stage, StageDownload, StageLVCreate, StageConvert)
+		}
+		if policy.Attempts < 0 || policy.MaxElapsedSeconds < 0 {
+			return nil, fmt.Errorf("retry stage %s: attempts and max_elapsed_seconds must not be negative", stage)
+		}
+		if policy.Jitter < 0 || policy.Jitter > 1 {
+			return nil, fmt.Errorf("retry stage %s: jitter must be between 0 and 1", stage)
+		}
+		for _, ms := range policy.BackoffMs {
+			if ms <= 0 {
+				return nil, fmt.Errorf("retry stage %s: backoff_ms values must be positive", stage)
+			}
+		}
+	}
+
+	return policies, nil
+}
@@ -0,0 +1,60 @@
+package retry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePolicies(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "retry.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadPolicies(t *testing.T) {
+	path := writePolicies(t, `{
+		"download": {"attempts": 5, "backoff_ms": [500, 5000], "jitter": 0.2, "max_elapsed_seconds": 600},
+		"convert": {"attempts": 1}
+	}`)
+
+	policies, err := LoadPolicies(path)
+	require.NoError(t, err)
+
+	base := Config{MaxAttempts: 2, Delays: []time.Duration{time.Second}}
+	download := policies[StageDownload].Apply(base)
+	assert.Equal(t, Config{
+		MaxAttempts: 5,
+		Delays:      []time.Duration{500 * time.Millisecond, 5 * time.Second},
+		Jitter:      0.2,
+		MaxElapsed:  10 * time.Minute,
+	}, download)
+
+	convert := policies[StageConvert].Apply(base)
+	assert.Equal(t, 1, convert.MaxAttempts)
+	assert.Equal(t, base.Delays, convert.Delays)
+
+	// Stages without a policy keep their configuration
+	assert.Equal(t, base, policies[StageLVCreate].Apply(base))
+}
+
+func TestLoadPolicies_Invalid(t *testing.T) {
+	for _, content := range []string{
+		`{"upload": {"attempts": 2}}`,
+		`{"download": {"retries": 2}}`,
+		`{"download": {"jitter": 1.5}}`,
+		`{"download": {"backoff_ms": [0]}}`,
+		`{"download": {"attempts": -1}}`,
+	} {
+		_, err := LoadPolicies(writePolicies(t, content))
+		assert.Error(t, err, content)
+	}
+
+	_, err := LoadPolicies(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,189 @@
+// Package schedule parses provisioning time windows, so storage-heavy work can be
+// kept out of business hours.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window allows provisioning on a set of weekdays between two times of day.
+// A window whose end is not after its start crosses midnight, and belongs to
+// the day on which it starts.
+type Window struct {
+	days  [7]bool
+	start time.Duration // offset from midnight
+	end   time.Duration
+}
+
+// Windows is a set of provisioning windows. An empty set is always open.
+type Windows []Window
+
+// dayNames maps abbreviated day names to time.Weekday
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Parse parses a comma-separated list of windows such as
+// "Mon-Fri 19:00-07:00,Sat-Sun 00:00-24:00". Days are abbreviated names, ranges
+// of names, or "*" for every day; times are in the local time zone.
+func Parse(spec string) (Windows, error) {
+	var windows Windows
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		window, err := parseWindow(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", part, err)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// parseWindow parses a single "<days> <start>-<end>" window
+func parseWindow(spec string) (Window, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return Window{}, fmt.Errorf("expected \"<days> <start>-<end>\"")
+	}
+
+	var window Window
+	if err := window.parseDays(fields[0]); err != nil {
+		return Window{}, err
+	}
+
+	start, end, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		return Window{}, fmt.Errorf("expected a time range like 19:00-07:00")
+	}
+	var err error
+	if window.start, err = parseTimeOfDay(start); err != nil {
+		return Window{}, err
+	}
+	if window.end, err = parseTimeOfDay(end); err != nil {
+		return Window{}, err
+	}
+	if window.start == 24*time.Hour {
+		return Window{}, fmt.Errorf("window cannot start at 24:00")
+	}
+	return window, nil
+}
+
+// parseDays sets the days of a window from "*", "Mon" or "Mon-Fri"
+func (w *Window) parseDays(spec string) error {
+	if spec == "*" {
+		for day := range w.days {
+			w.days[day] = true
+		}
+		return nil
+	}
+
+	first, last, isRange := strings.Cut(strings.ToLower(spec), "-")
+	if !isRange {
+		last = first
+	}
+	from, ok := dayNames[first]
+	if !ok {
+		return fmt.Errorf("unknown day %q", first)
+	}
+	to, ok := dayNames[last]
+	if !ok {
+		return fmt.Errorf("unknown day %q", last)
+	}
+
+	// Ranges may wrap around the week, e.g. Sat-Mon
+	for day := from; ; day = (day + 1) % 7 {
+		w.days[day] = true
+		if day == to {
+			return nil
+		}
+	}
+}
+
+// parseTimeOfDay parses "HH:MM" as an offset from midnight, allowing "24:00"
+func parseTimeOfDay(value string) (time.Duration, error) {
+	hours, minutes, ok := strings.Cut(value, ":")
+	h, hErr := strconv.Atoi(hours)
+	m, mErr := strconv.Atoi(minutes)
+	if !ok || hErr != nil || mErr != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// Open reports whether provisioning is allowed at t
+func (ws Windows) Open(t time.Time) bool {
+	if len(ws) == 0 {
+		return true
+	}
+	for _, window := range ws {
+		if window.open(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// open reports whether t falls within the window
+func (w Window) open(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	if w.end > w.start {
+		return w.days[t.Weekday()] && offset >= w.start && offset < w.end
+	}
+	// The window crosses midnight: it is open late on its own days and early on the following days
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.days[t.Weekday()] && offset >= w.start) || (w.days[yesterday] && offset < w.end)
+}
+
+// NextOpen returns the earliest time at or after t when provisioning is allowed.
+// It returns false if no window ever opens.
+func (ws Windows) NextOpen(t time.Time) (time.Time, bool) {
+	if ws.Open(t) {
+		return t, true
+	}
+
+	// Windows open on a minute boundary, so check every window start over the coming week
+	var next time.Time
+	for days := 0; days <= 7; days++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+days, 0, 0, 0, 0, t.Location())
+		for _, window := range ws {
+			if !window.days[day.Weekday()] {
+				continue
+			}
+			start := day.Add(window.start)
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// String returns a readable description of the windows
+func (ws Windows) String() string {
+	parts := make([]string, 0, len(ws))
+	for _, window := range ws {
+		var days []string
+		for day, allowed := range window.days {
+			if allowed {
+				days = append(days, time.Weekday(day).String()[:3])
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s %s-%s", strings.Join(days, "/"),
+			formatTimeOfDay(window.start), formatTimeOfDay(window.end)))
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatTimeOfDay formats an offset from midnight as "HH:MM"
+func formatTimeOfDay(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset.Hours()), int(offset.Minutes())%60)
+}
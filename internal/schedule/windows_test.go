@@ -0,0 +1,71 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"Mon-Fri",
+		"Funday 19:00-07:00",
+		"Mon 19:00",
+		"Mon 25:00-07:00",
+		"Mon 19:60-07:00",
+		"Mon 24:00-07:00",
+	} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestWindows_Open(t *testing.T) {
+	windows, err := Parse("Mon-Fri 19:00-07:00, Sat-Sun 00:00-24:00")
+	require.NoError(t, err)
+	require.Len(t, windows, 2)
+
+	// 2026-01-12 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		open bool
+	}{
+		{"Monday morning before the first window", at(12, 6, 0), false},
+		{"Monday business hours", at(12, 12, 0), false},
+		{"Monday evening", at(12, 19, 0), true},
+		{"Tuesday early morning", at(13, 6, 59), true},
+		{"Tuesday window end", at(13, 7, 0), false},
+		{"Saturday midday", at(17, 12, 0), true},
+		{"Saturday morning after Friday night", at(17, 6, 0), true},
+		{"Monday early morning after Sunday", at(19, 6, 0), false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.open, windows.Open(tt.t), tt.name)
+	}
+
+	assert.True(t, Windows(nil).Open(at(12, 12, 0)))
+}
+
+func TestWindows_NextOpen(t *testing.T) {
+	windows, err := Parse("Sat-Mon 22:00-02:00")
+	require.NoError(t, err)
+
+	// Wednesday 2026-01-14 waits for Saturday night
+	next, ok := windows.NextOpen(time.Date(2026, 1, 14, 12, 0, 0, 0, time.UTC))
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2026, 1, 17, 22, 0, 0, 0, time.UTC), next)
+
+	// Inside a window, provisioning may start immediately
+	now := time.Date(2026, 1, 13, 1, 0, 0, 0, time.UTC)
+	next, ok = windows.NextOpen(now)
+	require.True(t, ok)
+	assert.Equal(t, now, next)
+
+	assert.Equal(t, "Sun/Mon/Sat 22:00-02:00", windows.String())
+}
@@ -0,0 +1,78 @@
+// Package selftest checks the environment the provisioner depends on at startup,
+// so a host missing a tool or volume group is reported before a job fails on it.
+package selftest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rossigee/libvirt-volume-provisioner/pkg/types"
+)
+
+// DefaultTimeout bounds each check, so an unreachable service cannot hold up startup
+const DefaultTimeout = 15 * time.Second
+
+// Check probes one dependency, returning a short description of what it found
+type Check struct {
+	Name string
+	// Critical checks must pass for the provisioner to accept jobs. Dependencies
+	// that recover on their own, such as network services, are not critical.
+	Critical bool
+	Run      func(ctx context.Context) (string, error)
+}
+
+// Run runs the checks one after another, each bounded by timeout, and reports
+// the provisioner ready if every critical check passed
+func Run(ctx context.Context, checks []Check, timeout time.Duration) *types.SelfTestReport {
+	report := &types.SelfTestReport{
+		Ready:     true,
+		StartedAt: time.Now(),
+		Checks:    make([]types.SelfTestCheck, 0, len(checks)),
+	}
+	for _, check := range checks {
+		result := runCheck(ctx, check, timeout)
+		if !result.Passed && check.Critical {
+			report.Ready = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+// runCheck runs a single check. A check that overruns its timeout is abandoned
+// and fails, even if it ignores its context.
+func runCheck(ctx context.Context, check Check, timeout time.Duration) types.SelfTestCheck {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		detail string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	started := time.Now()
+	go func() {
+		detail, err := check.Run(ctx)
+		done <- outcome{detail, err}
+	}()
+
+	var result outcome
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result.err = fmt.Errorf("check did not complete: %w", ctx.Err())
+	}
+
+	checkResult := types.SelfTestCheck{
+		Name:       check.Name,
+		Critical:   check.Critical,
+		Passed:     result.err == nil,
+		Detail:     result.detail,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if result.err != nil {
+		checkResult.Error = result.err.Error()
+	}
+	return checkResult
+}
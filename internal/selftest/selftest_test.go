@@ -0,0 +1,95 @@
+package selftest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func passing(detail string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) { return detail, nil }
+}
+
+func failing(msg string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) { return "", errors.New(msg) }
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		checks    []Check
+		wantReady bool
+	}{
+		{
+			name: "all checks pass",
+			checks: []Check{
+				{Name: "lvm", Critical: true, Run: passing("2.03.16")},
+				{Name: "minio", Run: passing("http://minio:9000")},
+			},
+			wantReady: true,
+		},
+		{
+			name: "non-critical check fails",
+			checks: []Check{
+				{Name: "lvm", Critical: true, Run: passing("2.03.16")},
+				{Name: "minio", Run: failing("connection refused")},
+			},
+			wantReady: true,
+		},
+		{
+			name: "critical check fails",
+			checks: []Check{
+				{Name: "lvm", Critical: true, Run: failing("lvm not found")},
+				{Name: "minio", Run: passing("http://minio:9000")},
+			},
+			wantReady: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Run(context.Background(), tt.checks, time.Second)
+			assert.Equal(t, tt.wantReady, report.Ready)
+			require.Len(t, report.Checks, len(tt.checks))
+			for i, check := range tt.checks {
+				assert.Equal(t, check.Name, report.Checks[i].Name)
+				assert.Equal(t, check.Critical, report.Checks[i].Critical)
+			}
+		})
+	}
+}
+
+func TestRun_Results(t *testing.T) {
+	report := Run(context.Background(), []Check{
+		{Name: "qemu-img", Critical: true, Run: passing("qemu-img 8.2.2")},
+		{Name: "libvirt", Run: failing("connection refused")},
+	}, time.Second)
+
+	assert.True(t, report.Checks[0].Passed)
+	assert.Equal(t, "qemu-img 8.2.2", report.Checks[0].Detail)
+	assert.Empty(t, report.Checks[0].Error)
+	assert.False(t, report.Checks[1].Passed)
+	assert.Equal(t, "connection refused", report.Checks[1].Error)
+}
+
+func TestRun_Timeout(t *testing.T) {
+	blocked := make(chan struct{})
+	defer close(blocked)
+
+	report := Run(context.Background(), []Check{{
+		Name:     "stuck",
+		Critical: true,
+		Run: func(context.Context) (string, error) {
+			<-blocked // Ignores its context
+			return "", nil
+		},
+	}}, 10*time.Millisecond)
+
+	assert.False(t, report.Ready)
+	assert.False(t, report.Checks[0].Passed)
+	assert.Contains(t, report.Checks[0].Error, "did not complete")
+}
@@ -3,8 +3,13 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,15 +20,29 @@ import (
 
 // JobRecord represents a job stored in the database
 type JobRecord struct {
-	ID           string
-	Status       string
-	RequestJSON  string
-	ProgressJSON string
-	ErrorMessage string
-	RetryCount   int
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	CompletedAt  *time.Time
+	ID          string
+	Status      string
+	RequestJSON string
+	// EffectiveRequestJSON is the request after profiles and server-side defaults were applied
+	EffectiveRequestJSON string
+	ProgressJSON         string
+	ErrorMessage         string
+	RetryCount           int
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	CompletedAt          *time.Time
+	// Identity is the client that submitted the job
+	Identity string
+	// SLOJSON is the job's duration against its provisioning SLO target, if measured;
+	// SLOViolated is set if it missed the target
+	SLOJSON     string
+	SLOViolated bool
+	// OriginalError is the error that failed the job and RollbackError the failure to
+	// roll it back, if rolling back failed; ErrorMessage is then the rollback failure
+	OriginalError string
+	RollbackError string
+	// ProvisionerVersion is the version of the provisioner that ran the job
+	ProvisionerVersion string
 }
 
 // Store provides SQLite-based job persistence
@@ -133,7 +152,8 @@ func (s *Store) SaveJob(ctx context.Context, record *JobRecord) error {
 		_, err := tx.ExecContext(ctx,
 			`UPDATE jobs
 			 SET status = ?, progress_json = ?, error_message = ?,
-			     retry_count = ?, updated_at = ?, completed_at = ?
+			     retry_count = ?, updated_at = ?, completed_at = ?, slo_json = ?, slo_violated = ?,
+			     original_error = ?, rollback_error = ?, provisioner_version = ?
 			 WHERE id = ?`,
 			record.Status,
 			record.ProgressJSON,
@@ -141,6 +161,11 @@ func (s *Store) SaveJob(ctx context.Context, record *JobRecord) error {
 			record.RetryCount,
 			record.UpdatedAt.Unix(),
 			timeToUnixPtr(record.CompletedAt),
+			record.SLOJSON,
+			record.SLOViolated,
+			record.OriginalError,
+			record.RollbackError,
+			record.ProvisionerVersion,
 			record.ID,
 		)
 		if err != nil {
@@ -150,18 +175,26 @@ func (s *Store) SaveJob(ctx context.Context, record *JobRecord) error {
 		// Insert new job
 		_, err := tx.ExecContext(ctx,
 			`INSERT INTO jobs
-			 (id, status, request_json, progress_json, error_message,
-			  retry_count, created_at, updated_at, completed_at)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			 (id, status, request_json, effective_request_json, identity, progress_json, error_message,
+			  retry_count, created_at, updated_at, completed_at, slo_json, slo_violated, original_error, rollback_error,
+			  provisioner_version)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			record.ID,
 			record.Status,
 			record.RequestJSON,
+			record.EffectiveRequestJSON,
+			record.Identity,
 			record.ProgressJSON,
 			record.ErrorMessage,
 			record.RetryCount,
 			record.CreatedAt.Unix(),
 			record.UpdatedAt.Unix(),
 			timeToUnixPtr(record.CompletedAt),
+			record.SLOJSON,
+			record.SLOViolated,
+			record.OriginalError,
+			record.RollbackError,
+			record.ProvisionerVersion,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert job: %w", err)
@@ -186,20 +219,29 @@ func (s *Store) GetJob(id string) (*JobRecord, error) {
 	var completedAtUnix *int64
 
 	err := s.db.QueryRowContext(context.Background(),
-		`SELECT id, status, request_json, progress_json, error_message,
-		        retry_count, created_at, updated_at, completed_at
+		`SELECT id, status, request_json, COALESCE(effective_request_json, ''), COALESCE(identity, ''),
+		        progress_json, error_message, retry_count, created_at, updated_at, completed_at,
+		        COALESCE(slo_json, ''), slo_violated, COALESCE(original_error, ''), COALESCE(rollback_error, ''),
+		        COALESCE(provisioner_version, '')
 		 FROM jobs WHERE id = ?`,
 		id,
 	).Scan(
 		&record.ID,
 		&record.Status,
 		&record.RequestJSON,
+		&record.EffectiveRequestJSON,
+		&record.Identity,
 		&record.ProgressJSON,
 		&record.ErrorMessage,
 		&record.RetryCount,
 		&createdAtUnix,
 		&updatedAtUnix,
 		&completedAtUnix,
+		&record.SLOJSON,
+		&record.SLOViolated,
+		&record.OriginalError,
+		&record.RollbackError,
+		&record.ProvisionerVersion,
 	)
 
 	if err != nil {
@@ -219,14 +261,62 @@ func (s *Store) GetJob(id string) (*JobRecord, error) {
 	return record, nil
 }
 
+// Sort columns accepted by ListJobsFilter.SortBy
+const (
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+)
+
+// ErrInvalidCursor is returned when a listing cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 // ListJobsFilter defines filtering options for ListJobs
 type ListJobsFilter struct {
-	Status string // optional: filter by status
-	Limit  int    // default: 100
-	Offset int    // default: 0
+	Status    string    // optional: filter by status
+	Identity  string    // optional: filter by the client that submitted the job
+	SortBy    string    // SortByCreatedAt or SortByUpdatedAt (default)
+	Ascending bool      // default: newest first
+	Since     time.Time // optional: only jobs whose sort column is at or after this time
+	Until     time.Time // optional: only jobs whose sort column is before this time
+	Cursor    string    // optional: continue after the job a previous page ended with
+	Limit     int       // default: 100
+	Offset    int       // default: 0
+	// SLOViolated lists only the jobs that missed their provisioning SLO target
+	SLOViolated bool
+	// Labels lists only the jobs whose request has every one of these labels
+	Labels map[string]string
+	// VolumeNamePrefix lists only the jobs for volumes whose names start with it
+	VolumeNamePrefix string
+}
+
+// EncodeCursor returns the cursor continuing a listing sorted by sortBy after record
+func EncodeCursor(record *JobRecord, sortBy string) string {
+	sortValue := record.UpdatedAt
+	if sortBy == SortByCreatedAt {
+		sortValue = record.CreatedAt
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", sortValue.Unix(), record.ID)))
 }
 
-// ListJobs retrieves jobs with optional filtering
+// decodeCursor returns the sort value and job ID a cursor points at
+func decodeCursor(cursor string) (int64, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	sortValue, id, ok := strings.Cut(string(data), ":")
+	if !ok || id == "" {
+		return 0, "", ErrInvalidCursor
+	}
+	unix, err := strconv.ParseInt(sortValue, 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	return unix, id, nil
+}
+
+// ListJobs retrieves jobs with optional filtering. Jobs are ordered by the sort
+// column and then by ID, so that cursors resume exactly where a page ended.
 func (s *Store) ListJobs(filter ListJobsFilter) ([]*JobRecord, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -238,16 +328,71 @@ func (s *Store) ListJobs(filter ListJobsFilter) ([]*JobRecord, error) {
 		filter.Limit = 10000 // Cap limit to prevent excessive queries
 	}
 
-	query := "SELECT id, status, request_json, progress_json, error_message, " +
-		"retry_count, created_at, updated_at, completed_at FROM jobs"
+	sortColumn := SortByUpdatedAt
+	switch filter.SortBy {
+	case "", SortByUpdatedAt:
+	case SortByCreatedAt:
+		sortColumn = SortByCreatedAt
+	default:
+		return nil, fmt.Errorf("invalid sort column: %s", filter.SortBy)
+	}
+
+	query := "SELECT id, status, request_json, COALESCE(effective_request_json, ''), COALESCE(identity, ''), " +
+		"progress_json, error_message, retry_count, created_at, updated_at, completed_at, " +
+		"COALESCE(slo_json, ''), slo_violated, COALESCE(original_error, ''), COALESCE(rollback_error, ''), " +
+		"COALESCE(provisioner_version, '') FROM jobs"
+	var conditions []string
 	args := []interface{}{}
 
 	if filter.Status != "" {
-		query += " WHERE status = ?"
+		conditions = append(conditions, "status = ?")
 		args = append(args, filter.Status)
 	}
+	if filter.Identity != "" {
+		conditions = append(conditions, "identity = ?")
+		args = append(args, filter.Identity)
+	}
+	if filter.SLOViolated {
+		conditions = append(conditions, "slo_violated = 1")
+	}
+	if filter.VolumeNamePrefix != "" {
+		conditions = append(conditions,
+			"substr(COALESCE(json_extract(request_json, '$.volume_name'), ''), 1, length(?)) = ?")
+		args = append(args, filter.VolumeNamePrefix, filter.VolumeNamePrefix)
+	}
+	for _, key := range slices.Sorted(maps.Keys(filter.Labels)) {
+		conditions = append(conditions,
+			"EXISTS (SELECT 1 FROM json_each(request_json, '$.labels') WHERE key = ? AND value = ?)")
+		args = append(args, key, filter.Labels[key])
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, sortColumn+" >= ?")
+		args = append(args, filter.Since.Unix())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, sortColumn+" < ?")
+		args = append(args, filter.Until.Unix())
+	}
 
-	query += " ORDER BY updated_at DESC LIMIT ? OFFSET ?"
+	direction, comparison := "DESC", "<"
+	if filter.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+	if filter.Cursor != "" {
+		sortValue, id, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))",
+			sortColumn, comparison, sortColumn, comparison))
+		args = append(args, sortValue, sortValue, id)
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT ? OFFSET ?", sortColumn, direction, direction)
 	args = append(args, filter.Limit, filter.Offset)
 
 	rows, err := s.db.QueryContext(context.Background(), query, args...)
@@ -270,12 +415,19 @@ func (s *Store) ListJobs(filter ListJobsFilter) ([]*JobRecord, error) {
 			&record.ID,
 			&record.Status,
 			&record.RequestJSON,
+			&record.EffectiveRequestJSON,
+			&record.Identity,
 			&record.ProgressJSON,
 			&record.ErrorMessage,
 			&record.RetryCount,
 			&createdAtUnix,
 			&updatedAtUnix,
 			&completedAtUnix,
+			&record.SLOJSON,
+			&record.SLOViolated,
+			&record.OriginalError,
+			&record.RollbackError,
+			&record.ProvisionerVersion,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan job: %w", err)
 		}
@@ -297,7 +449,7 @@ func (s *Store) ListJobs(filter ListJobsFilter) ([]*JobRecord, error) {
 	return records, nil
 }
 
-// MarkInProgressJobsFailed marks all running/pending jobs as failed (called at startup)
+// MarkInProgressJobsFailed marks all running/pending/paused jobs as failed (called at startup)
 func (s *Store) MarkInProgressJobsFailed() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -306,13 +458,14 @@ func (s *Store) MarkInProgressJobsFailed() error {
 	_, err := s.db.ExecContext(context.Background(),
 		`UPDATE jobs
 		 SET status = ?, error_message = ?, updated_at = ?, completed_at = ?
-		 WHERE status IN (?, ?)`,
+		 WHERE status IN (?, ?, ?)`,
 		string(types.StatusFailed),
 		"daemon restarted while job in progress",
 		now,
 		now,
 		string(types.StatusRunning),
 		string(types.StatusPending),
+		string(types.StatusPaused),
 	)
 
 	if err != nil {
@@ -353,6 +506,11 @@ func (s *Store) DeleteOldJobs(olderThan time.Duration) error {
 	return nil
 }
 
+// Path returns the path of the database file
+func (s *Store) Path() string {
+	return s.dbPath
+}
+
 // Close closes the database connection
 func (s *Store) Close() error {
 	s.mu.Lock()
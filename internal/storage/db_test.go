@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 	"time"
@@ -97,6 +98,73 @@ func TestSaveJob_Update(t *testing.T) {
 	assert.Equal(t, string(types.StatusRunning), retrieved.Status)
 }
 
+func TestSaveJob_EffectiveRequest(t *testing.T) {
+	store, err := NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close() // Ignore error in test
+	}()
+
+	job := &JobRecord{
+		ID:                   "test-job-effective",
+		Status:               string(types.StatusPending),
+		RequestJSON:          `{"profile": "ubuntu"}`,
+		EffectiveRequestJSON: `{"profile": "ubuntu", "image_url": "https://minio/images/ubuntu.qcow2"}`,
+		CreatedAt:            time.Now(),
+		UpdatedAt:            time.Now(),
+	}
+	require.NoError(t, store.SaveJob(context.Background(), job))
+
+	// The effective request is recorded once, when the job is created
+	job.Status = string(types.StatusRunning)
+	job.EffectiveRequestJSON = ""
+	require.NoError(t, store.SaveJob(context.Background(), job))
+
+	retrieved, err := store.GetJob("test-job-effective")
+	require.NoError(t, err)
+	assert.Equal(t, `{"profile": "ubuntu"}`, retrieved.RequestJSON)
+	assert.Contains(t, retrieved.EffectiveRequestJSON, "ubuntu.qcow2")
+
+	records, err := store.ListJobs(ListJobsFilter{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, retrieved.EffectiveRequestJSON, records[0].EffectiveRequestJSON)
+}
+
+func TestSaveJob_RollbackError(t *testing.T) {
+	store, err := NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close() // Ignore error in test
+	}()
+
+	job := &JobRecord{
+		ID:          "test-job-rollback",
+		Status:      string(types.StatusRunning),
+		RequestJSON: `{"volume_name": "vm01-root"}`,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	require.NoError(t, store.SaveJob(context.Background(), job))
+
+	job.Status = string(types.StatusFailed)
+	job.ErrorMessage = "provision failed + rollback failed: volume busy"
+	job.OriginalError = "failed to populate volume: qemu-img convert failed"
+	job.RollbackError = "volume busy"
+	require.NoError(t, store.SaveJob(context.Background(), job))
+
+	retrieved, err := store.GetJob("test-job-rollback")
+	require.NoError(t, err)
+	assert.Equal(t, job.OriginalError, retrieved.OriginalError)
+	assert.Equal(t, job.RollbackError, retrieved.RollbackError)
+
+	records, err := store.ListJobs(ListJobsFilter{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, job.OriginalError, records[0].OriginalError)
+	assert.Equal(t, job.RollbackError, records[0].RollbackError)
+}
+
 func TestGetJob_NotFound(t *testing.T) {
 	store, err := NewStore(":memory:")
 	require.NoError(t, err)
@@ -150,6 +218,135 @@ func TestListJobs(t *testing.T) {
 	assert.Equal(t, 0, len(jobs))
 }
 
+func TestListJobs_Identity(t *testing.T) {
+	store, err := NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close() // Ignore error in test
+	}()
+
+	for i, identity := range []string{"cert:team-a", "token:0123456789ab", "cert:team-a", ""} {
+		err = store.SaveJob(context.Background(), &JobRecord{
+			ID:          fmt.Sprintf("job-%d", i),
+			Status:      string(types.StatusCompleted),
+			RequestJSON: `{}`,
+			Identity:    identity,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		})
+		require.NoError(t, err)
+	}
+
+	jobs, err := store.ListJobs(ListJobsFilter{Identity: "cert:team-a", SortBy: SortByCreatedAt, Ascending: true})
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "job-0", jobs[0].ID)
+	assert.Equal(t, "cert:team-a", jobs[0].Identity)
+
+	record, err := store.GetJob("job-1")
+	require.NoError(t, err)
+	assert.Equal(t, "token:0123456789ab", record.Identity)
+}
+
+func TestListJobs_Labels(t *testing.T) {
+	store, err := NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close() // Ignore error in test
+	}()
+
+	for i, request := range []string{
+		`{"volume_name":"acme-web01","labels":{"env":"prod","tenant":"acme"}}`,
+		`{"volume_name":"acme-web02","labels":{"env":"staging","tenant":"acme"}}`,
+		`{"volume_name":"globex-web01","labels":{"env":"prod"}}`,
+		`{}`,
+	} {
+		err = store.SaveJob(context.Background(), &JobRecord{
+			ID:          fmt.Sprintf("job-%d", i),
+			Status:      string(types.StatusCompleted),
+			RequestJSON: request,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		})
+		require.NoError(t, err)
+	}
+
+	ids := func(filter ListJobsFilter) []string {
+		filter.SortBy, filter.Ascending = SortByCreatedAt, true
+		jobs, err := store.ListJobs(filter)
+		require.NoError(t, err)
+		var ids []string
+		for _, job := range jobs {
+			ids = append(ids, job.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"job-0", "job-2"}, ids(ListJobsFilter{Labels: map[string]string{"env": "prod"}}))
+	assert.Equal(t, []string{"job-0"}, ids(ListJobsFilter{Labels: map[string]string{"env": "prod", "tenant": "acme"}}))
+	assert.Empty(t, ids(ListJobsFilter{Labels: map[string]string{"tenant": "globex"}}))
+	assert.Equal(t, []string{"job-0", "job-1"}, ids(ListJobsFilter{VolumeNamePrefix: "acme-"}))
+	assert.Equal(t, []string{"job-2"}, ids(ListJobsFilter{VolumeNamePrefix: "globex-web01"}))
+	assert.Empty(t, ids(ListJobsFilter{VolumeNamePrefix: "globex-web01-"}))
+}
+
+func TestListJobsPagination(t *testing.T) {
+	store, err := NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close() // Ignore error in test
+	}()
+
+	// Jobs 0-2 share a creation second, so pages must be split by ID as well
+	base := time.Date(2026, time.October, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		created := base.Add(time.Duration(i/3) * time.Hour)
+		job := &JobRecord{
+			ID:          fmt.Sprintf("job-%d", i),
+			Status:      string(types.StatusCompleted),
+			RequestJSON: `{}`,
+			CreatedAt:   created,
+			UpdatedAt:   base.Add(time.Duration(-i) * time.Minute),
+		}
+		require.NoError(t, store.SaveJob(context.Background(), job))
+	}
+
+	// Page through all jobs, newest first
+	var ids []string
+	filter := ListJobsFilter{SortBy: SortByCreatedAt, Limit: 2}
+	for page := 0; page < 4; page++ {
+		jobs, err := store.ListJobs(filter)
+		require.NoError(t, err)
+		if len(jobs) == 0 {
+			break
+		}
+		for _, job := range jobs {
+			ids = append(ids, job.ID)
+		}
+		filter.Cursor = EncodeCursor(jobs[len(jobs)-1], SortByCreatedAt)
+	}
+	assert.Equal(t, []string{"job-5", "job-4", "job-3", "job-2", "job-1", "job-0"}, ids)
+
+	// Ascending by update time
+	jobs, err := store.ListJobs(ListJobsFilter{Ascending: true, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "job-5", jobs[0].ID)
+
+	// Time range on the sort column
+	jobs, err = store.ListJobs(ListJobsFilter{
+		SortBy: SortByCreatedAt,
+		Since:  base.Add(30 * time.Minute),
+		Until:  base.Add(2 * time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Len(t, jobs, 3)
+
+	_, err = store.ListJobs(ListJobsFilter{Cursor: "not-a-cursor"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = store.ListJobs(ListJobsFilter{SortBy: "status"})
+	assert.Error(t, err)
+}
+
 func TestMarkInProgressJobsFailed(t *testing.T) {
 	store, err := NewStore(":memory:")
 	require.NoError(t, err)
@@ -178,6 +375,16 @@ func TestMarkInProgressJobsFailed(t *testing.T) {
 	err = store.SaveJob(context.Background(), pendingJob)
 	require.NoError(t, err)
 
+	pausedJob := &JobRecord{
+		ID:          "paused-1",
+		Status:      string(types.StatusPaused),
+		RequestJSON: `{}`,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	err = store.SaveJob(context.Background(), pausedJob)
+	require.NoError(t, err)
+
 	// Insert completed job (should not be changed)
 	completedJob := &JobRecord{
 		ID:          "completed-1",
@@ -204,6 +411,11 @@ func TestMarkInProgressJobsFailed(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, string(types.StatusFailed), retrieved.Status)
 
+	// Verify paused job is now failed
+	retrieved, err = store.GetJob("paused-1")
+	require.NoError(t, err)
+	assert.Equal(t, string(types.StatusFailed), retrieved.Status)
+
 	// Verify completed job is unchanged
 	retrieved, err = store.GetJob("completed-1")
 	require.NoError(t, err)
@@ -25,6 +25,79 @@ CREATE TABLE IF NOT EXISTS schema_version (
 	version INTEGER PRIMARY KEY,
 	applied_at INTEGER NOT NULL
 );
+`
+
+	// SchemaV2 adds indexes for keyset pagination of job listings
+	SchemaV2 = `
+CREATE INDEX IF NOT EXISTS idx_jobs_created_at_id ON jobs(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_jobs_updated_at_id ON jobs(updated_at, id);
+`
+
+	// SchemaV3 stores the request as carried out, after profiles and server-side defaults
+	SchemaV3 = `
+ALTER TABLE jobs ADD COLUMN effective_request_json TEXT;
+`
+
+	// SchemaV4 records the volumes the provisioner created and the images they came from
+	SchemaV4 = `
+CREATE TABLE IF NOT EXISTS volumes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	volume_group TEXT NOT NULL,
+	size_gb INTEGER NOT NULL,
+	image_url TEXT NOT NULL,
+	image_checksum TEXT,
+	job_id TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	deleted_at INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_volumes_name ON volumes(volume_group, name);
+CREATE INDEX IF NOT EXISTS idx_volumes_image_checksum ON volumes(image_checksum);
+`
+
+	// SchemaV5 records the client that submitted each job, for per-client usage reporting
+	SchemaV5 = `
+ALTER TABLE jobs ADD COLUMN identity TEXT;
+CREATE INDEX IF NOT EXISTS idx_jobs_identity ON jobs(identity);
+`
+
+	// SchemaV6 records how completed jobs measured against their provisioning SLO target
+	SchemaV6 = `
+ALTER TABLE jobs ADD COLUMN slo_json TEXT;
+ALTER TABLE jobs ADD COLUMN slo_violated INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_jobs_slo_violated ON jobs(slo_violated);
+`
+
+	// SchemaV7 keeps settings changed at runtime through the admin API across restarts
+	SchemaV7 = `
+CREATE TABLE IF NOT EXISTS settings (
+	name TEXT PRIMARY KEY,
+	value TEXT NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+`
+
+	// SchemaV8 keeps the error that failed a job apart from the failure to roll it back
+	SchemaV8 = `
+ALTER TABLE jobs ADD COLUMN original_error TEXT;
+ALTER TABLE jobs ADD COLUMN rollback_error TEXT;
+`
+
+	// SchemaV9 records the version of the provisioner that ran each job
+	SchemaV9 = `
+ALTER TABLE jobs ADD COLUMN provisioner_version TEXT;
+`
+
+	// SchemaV10 records the checksum of the data written to each volume, to verify it against later
+	SchemaV10 = `
+ALTER TABLE volumes ADD COLUMN written_checksum TEXT;
+ALTER TABLE volumes ADD COLUMN written_bytes INTEGER NOT NULL DEFAULT 0;
+`
+
+	// SchemaV11 records the format images were written to each volume in, to check qcow2 volumes
+	SchemaV11 = `
+ALTER TABLE volumes ADD COLUMN volume_format TEXT;
 `
 )
 
@@ -37,4 +110,44 @@ var Migrations = []struct {
 		Version: 1,
 		SQL:     SchemaV1,
 	},
+	{
+		Version: 2,
+		SQL:     SchemaV2,
+	},
+	{
+		Version: 3,
+		SQL:     SchemaV3,
+	},
+	{
+		Version: 4,
+		SQL:     SchemaV4,
+	},
+	{
+		Version: 5,
+		SQL:     SchemaV5,
+	},
+	{
+		Version: 6,
+		SQL:     SchemaV6,
+	},
+	{
+		Version: 7,
+		SQL:     SchemaV7,
+	},
+	{
+		Version: 8,
+		SQL:     SchemaV8,
+	},
+	{
+		Version: 9,
+		SQL:     SchemaV9,
+	},
+	{
+		Version: 10,
+		SQL:     SchemaV10,
+	},
+	{
+		Version: 11,
+		SQL:     SchemaV11,
+	},
 }
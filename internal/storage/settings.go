@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SaveSetting stores the value of a named setting, replacing any earlier value
+func (s *Store) SaveSetting(ctx context.Context, name, value string, updatedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO settings (name, value, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		name,
+		value,
+		updatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save setting %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// GetSetting retrieves the value of a named setting and when it was saved. The value
+// is empty and the time zero if the setting was never saved.
+func (s *Store) GetSetting(name string) (string, time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var value string
+	var updatedAt int64
+	err := s.db.QueryRowContext(context.Background(),
+		"SELECT value, updated_at FROM settings WHERE name = ?", name).Scan(&value, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", time.Time{}, nil
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get setting %s: %w", name, err)
+	}
+
+	return value, time.Unix(updatedAt, 0), nil
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettings(t *testing.T) {
+	store, err := NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close() // Ignore error in test
+	}()
+
+	value, updatedAt, err := store.GetSetting("runtime")
+	require.NoError(t, err)
+	assert.Empty(t, value)
+	assert.True(t, updatedAt.IsZero())
+
+	now := time.Now().Truncate(time.Second)
+	ctx := context.Background()
+	require.NoError(t, store.SaveSetting(ctx, "runtime", `{"queue_paused":true}`, now.Add(-time.Hour)))
+	require.NoError(t, store.SaveSetting(ctx, "runtime", `{"queue_paused":false}`, now))
+
+	value, updatedAt, err = store.GetSetting("runtime")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"queue_paused":false}`, value)
+	assert.True(t, now.Equal(updatedAt))
+}
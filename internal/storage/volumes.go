@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// VolumeRecord represents a volume created by the provisioner, or adopted by it
+type VolumeRecord struct {
+	ID          int64
+	Name        string
+	VolumeGroup string
+	SizeGB      int
+	ImageURL    string
+	// ImageChecksum is the SHA256 of the source image, empty if it was not known
+	ImageChecksum string
+	// WrittenChecksum is the SHA256 of the first WrittenBytes bytes written to the
+	// volume, empty unless it was populated from a raw image
+	WrittenChecksum string
+	WrittenBytes    int64
+	// VolumeFormat is the format the image was written to the volume in, empty if
+	// it is not known
+	VolumeFormat string
+	// JobID is the job that created the volume, empty for an adopted volume
+	JobID     string
+	CreatedAt time.Time
+	DeletedAt *time.Time
+}
+
+// ListVolumesFilter defines filtering options for ListVolumes
+type ListVolumesFilter struct {
+	Name           string // optional: filter by volume name
+	VolumeGroup    string // optional: filter by volume group
+	ImageChecksum  string // optional: filter by source image checksum
+	ImageURL       string // optional: filter by source image URL
+	IncludeDeleted bool   // default: only volumes that still exist
+	Limit          int    // default: 100
+}
+
+// SaveVolume records a newly created volume, setting its ID
+func (s *Store) SaveVolume(ctx context.Context, record *VolumeRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO volumes
+		 (name, volume_group, size_gb, image_url, image_checksum, written_checksum, written_bytes,
+		  volume_format, job_id, created_at, deleted_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.Name,
+		record.VolumeGroup,
+		record.SizeGB,
+		record.ImageURL,
+		record.ImageChecksum,
+		record.WrittenChecksum,
+		record.WrittenBytes,
+		record.VolumeFormat,
+		record.JobID,
+		record.CreatedAt.Unix(),
+		timeToUnixPtr(record.DeletedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert volume: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get volume ID: %w", err)
+	}
+	record.ID = id
+
+	return nil
+}
+
+// UpdateVolumeWrite records the checksum and size of the data a job wrote to the
+// volume it created, once the data is written
+func (s *Store) UpdateVolumeWrite(ctx context.Context, volumeGroup, name, jobID, checksum string,
+	writtenBytes int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE volumes SET written_checksum = ?, written_bytes = ?
+		 WHERE volume_group = ? AND name = ? AND job_id = ? AND deleted_at IS NULL`,
+		checksum,
+		writtenBytes,
+		volumeGroup,
+		name,
+		jobID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update volume write: %w", err)
+	}
+
+	return nil
+}
+
+// MarkVolumeDeleted records the deletion of a volume. Earlier volumes of the same
+// name, already deleted, keep their own deletion times.
+func (s *Store) MarkVolumeDeleted(ctx context.Context, volumeGroup, name string, deletedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE volumes SET deleted_at = ?
+		 WHERE volume_group = ? AND name = ? AND deleted_at IS NULL`,
+		deletedAt.Unix(),
+		volumeGroup,
+		name,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark volume deleted: %w", err)
+	}
+
+	return nil
+}
+
+// ListVolumes retrieves volumes with optional filtering, newest first
+func (s *Store) ListVolumes(filter ListVolumesFilter) ([]*VolumeRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if filter.Limit == 0 {
+		filter.Limit = 100
+	}
+	if filter.Limit > 10000 {
+		filter.Limit = 10000 // Cap limit to prevent excessive queries
+	}
+
+	query := "SELECT id, name, volume_group, size_gb, image_url, COALESCE(image_checksum, ''), " +
+		"COALESCE(written_checksum, ''), written_bytes, COALESCE(volume_format, ''), job_id, created_at, " +
+		"deleted_at FROM volumes"
+	var conditions []string
+	args := []interface{}{}
+
+	if filter.Name != "" {
+		conditions = append(conditions, "name = ?")
+		args = append(args, filter.Name)
+	}
+	if filter.VolumeGroup != "" {
+		conditions = append(conditions, "volume_group = ?")
+		args = append(args, filter.VolumeGroup)
+	}
+	if filter.ImageChecksum != "" {
+		conditions = append(conditions, "image_checksum = ?")
+		args = append(args, filter.ImageChecksum)
+	}
+	if filter.ImageURL != "" {
+		conditions = append(conditions, "image_url = ?")
+		args = append(args, filter.ImageURL)
+	}
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query volumes: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			logrus.WithError(closeErr).Warn("Failed to close database rows")
+		}
+	}()
+
+	var records []*VolumeRecord
+	for rows.Next() {
+		record := &VolumeRecord{}
+		var createdAtUnix int64
+		var deletedAtUnix sql.NullInt64
+
+		if err := rows.Scan(
+			&record.ID,
+			&record.Name,
+			&record.VolumeGroup,
+			&record.SizeGB,
+			&record.ImageURL,
+			&record.ImageChecksum,
+			&record.WrittenChecksum,
+			&record.WrittenBytes,
+			&record.VolumeFormat,
+			&record.JobID,
+			&createdAtUnix,
+			&deletedAtUnix,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan volume: %w", err)
+		}
+
+		record.CreatedAt = time.Unix(createdAtUnix, 0)
+		if deletedAtUnix.Valid {
+			t := time.Unix(deletedAtUnix.Int64, 0)
+			record.DeletedAt = &t
+		}
+
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating volumes: %w", err)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveVolume(t *testing.T) {
+	store, err := NewStore(":memory:")
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close() // Ignore error in test
+	}()
+
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	vulnerable := &VolumeRecord{
+		Name:            "web01-root",
+		VolumeGroup:     "data",
+		SizeGB:          50,
+		ImageURL:        "https://minio/images/ubuntu.raw",
+		ImageChecksum:   "abc123",
+		WrittenChecksum: "abc123",
+		WrittenBytes:    2 << 30,
+		JobID:           "job-1",
+		CreatedAt:       now.Add(-time.Hour),
+	}
+	require.NoError(t, store.SaveVolume(ctx, vulnerable))
+	assert.NotZero(t, vulnerable.ID)
+	require.NoError(t, store.SaveVolume(ctx, &VolumeRecord{
+		Name: "web02-root", VolumeGroup: "data", SizeGB: 50, VolumeFormat: "qcow2",
+		ImageURL: "https://minio/images/ubuntu.qcow2", ImageChecksum: "abc123", JobID: "job-2", CreatedAt: now,
+	}))
+	require.NoError(t, store.SaveVolume(ctx, &VolumeRecord{
+		Name: "db01-root", VolumeGroup: "data", SizeGB: 100,
+		ImageURL: "https://minio/images/debian.qcow2", ImageChecksum: "def456", JobID: "job-3", CreatedAt: now,
+	}))
+
+	volumes, err := store.ListVolumes(ListVolumesFilter{ImageChecksum: "abc123"})
+	require.NoError(t, err)
+	require.Len(t, volumes, 2)
+	assert.Equal(t, "web02-root", volumes[0].Name)
+	assert.Equal(t, "web01-root", volumes[1].Name)
+	assert.Equal(t, "job-1", volumes[1].JobID)
+	assert.Equal(t, 50, volumes[1].SizeGB)
+	assert.Equal(t, "abc123", volumes[1].WrittenChecksum)
+	assert.Equal(t, int64(2<<30), volumes[1].WrittenBytes)
+	assert.Empty(t, volumes[0].WrittenChecksum)
+	assert.Equal(t, "qcow2", volumes[0].VolumeFormat)
+	assert.Empty(t, volumes[1].VolumeFormat)
+
+	// The write is recorded once the data is written, for the job's own volume only
+	require.NoError(t, store.UpdateVolumeWrite(ctx, "data", "web02-root", "job-1", "stale", 1))
+	require.NoError(t, store.UpdateVolumeWrite(ctx, "data", "web02-root", "job-2", "def789", 4<<30))
+	volumes, err = store.ListVolumes(ListVolumesFilter{Name: "web02-root"})
+	require.NoError(t, err)
+	require.Len(t, volumes, 1)
+	assert.Equal(t, "def789", volumes[0].WrittenChecksum)
+	assert.Equal(t, int64(4<<30), volumes[0].WrittenBytes)
+
+	volumes, err = store.ListVolumes(ListVolumesFilter{ImageChecksum: "abc123"})
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-time.Hour), volumes[1].CreatedAt)
+	assert.Nil(t, volumes[1].DeletedAt)
+
+	// Deleted volumes are only listed on request
+	require.NoError(t, store.MarkVolumeDeleted(ctx, "data", "web01-root", now))
+	volumes, err = store.ListVolumes(ListVolumesFilter{ImageChecksum: "abc123"})
+	require.NoError(t, err)
+	require.Len(t, volumes, 1)
+	assert.Equal(t, "web02-root", volumes[0].Name)
+
+	volumes, err = store.ListVolumes(ListVolumesFilter{Name: "web01-root", IncludeDeleted: true})
+	require.NoError(t, err)
+	require.Len(t, volumes, 1)
+	require.NotNil(t, volumes[0].DeletedAt)
+	assert.Equal(t, now, *volumes[0].DeletedAt)
+}
@@ -0,0 +1,100 @@
+// Package systemd implements the parts of the systemd service protocols the
+// provisioner uses: socket activation and sd_notify readiness, status and watchdog
+// messages. Both are no-ops when the provisioner is not started by systemd.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation
+const listenFDsStart = 3
+
+// Listeners returns the sockets passed by systemd socket activation, or none if the
+// process was not socket-activated. The environment variables are unset, so the
+// sockets are not passed on to child processes.
+func Listeners() ([]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	// The sockets are meant for the process systemd started, not for its children
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+	return fileListeners(listenFDsStart, count)
+}
+
+// fileListeners returns listeners for count file descriptors starting at first
+func fileListeners(first, count int) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, count)
+	for fd := first; fd < first+count; fd++ {
+		syscall.CloseOnExec(fd)
+		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		listener, err := net.FileListener(file)
+		// FileListener duplicates the descriptor
+		_ = file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("socket %d passed by systemd is not a listening socket: %w", fd, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// Notify sends a state such as "READY=1" or "STATUS=..." to systemd. Several
+// states may be sent at once, separated by newlines. It returns false without an
+// error if the service manager does not accept notifications.
+func Notify(state string) (bool, error) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return false, nil
+	}
+	// A leading @ names a socket in the abstract namespace
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to systemd notify socket: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the watchdog timeout systemd enforces on the process,
+// or false if the watchdog is not enabled. "WATCHDOG=1" must be sent more often,
+// conventionally at half the interval.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil || pid != os.Getpid() {
+			return 0, false
+		}
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
@@ -0,0 +1,126 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListeners_NotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "")
+	listeners, err := Listeners()
+	assert.NoError(t, err)
+	assert.Empty(t, listeners)
+
+	// Sockets passed to another process are ignored, and not passed on
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	listeners, err = Listeners()
+	assert.NoError(t, err)
+	assert.Empty(t, listeners)
+	_, ok := os.LookupEnv("LISTEN_FDS")
+	assert.False(t, ok)
+}
+
+func TestFileListeners(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	file, err := listener.(*net.TCPListener).File()
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+
+	// fileListeners takes over the descriptors it is passed
+	fd, err := syscall.Dup(int(file.Fd()))
+	require.NoError(t, err)
+
+	listeners, err := fileListeners(fd, 1)
+	require.NoError(t, err)
+	require.Len(t, listeners, 1)
+	defer func() { _ = listeners[0].Close() }()
+	assert.Equal(t, listener.Addr().String(), listeners[0].Addr().String())
+
+	// Connections to the socket are accepted by the passed listener
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err == nil {
+			_ = conn.Close()
+		}
+	}()
+	conn, err := listeners[0].Accept()
+	require.NoError(t, err)
+	_ = conn.Close()
+}
+
+func TestFileListeners_NotASocket(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "fd")
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+
+	fd, err := syscall.Dup(int(file.Fd()))
+	require.NoError(t, err)
+
+	_, err = fileListeners(fd, 1)
+	assert.ErrorContains(t, err, "not a listening socket")
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := Notify("READY=1")
+	assert.NoError(t, err)
+	assert.False(t, sent)
+
+	socketPath := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+	sent, err = Notify("READY=1\nSTATUS=Idle")
+	require.NoError(t, err)
+	assert.True(t, sent)
+
+	buffer := make([]byte, 256)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := conn.Read(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, "READY=1\nSTATUS=Idle", string(buffer[:n]))
+
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing"))
+	_, err = Notify("READY=1")
+	assert.Error(t, err)
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name         string
+		usec         string
+		pid          string
+		wantInterval time.Duration
+		wantOK       bool
+	}{
+		{"not enabled", "", "", 0, false},
+		{"enabled", "30000000", pid, 30 * time.Second, true},
+		{"enabled without pid", "30000000", "", 30 * time.Second, true},
+		{"another process", "30000000", "1", 0, false},
+		{"invalid", "soon", pid, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			interval, ok := WatchdogInterval()
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantInterval, interval)
+		})
+	}
+}
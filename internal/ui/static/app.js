@@ -0,0 +1,220 @@
+'use strict';
+
+// How often active jobs are refreshed, and everything else
+const ACTIVE_INTERVAL_MS = 2000;
+const OVERVIEW_INTERVAL_MS = 30000;
+const HISTORY_PAGE_SIZE = 25;
+
+const tokenKey = 'lvp-api-token';
+let historyCursor = '';
+let historyPaged = false;
+
+function $(id) {
+  return document.getElementById(id);
+}
+
+async function api(path, options = {}) {
+  const headers = { Accept: 'application/json' };
+  const token = sessionStorage.getItem(tokenKey);
+  if (token) {
+    headers.Authorization = 'Bearer ' + token;
+  }
+
+  const resp = await fetch(path, { ...options, headers });
+  const body = await resp.json().catch(() => ({}));
+  if (!resp.ok) {
+    throw new Error(body.message || body.error || resp.status + ' ' + resp.statusText);
+  }
+  return body;
+}
+
+function showError(err) {
+  $('error').textContent = err ? err.message : '';
+  $('error').hidden = !err;
+}
+
+function formatBytes(bytes) {
+  if (!bytes) {
+    return '0 B';
+  }
+  const units = ['B', 'KiB', 'MiB', 'GiB', 'TiB'];
+  const exp = Math.min(Math.floor(Math.log(bytes) / Math.log(1024)), units.length - 1);
+  return (bytes / Math.pow(1024, exp)).toFixed(exp ? 1 : 0) + ' ' + units[exp];
+}
+
+function formatTime(value) {
+  return value ? new Date(value).toLocaleString() : '';
+}
+
+function cell(content, className) {
+  const td = document.createElement('td');
+  if (content instanceof Node) {
+    td.appendChild(content);
+  } else {
+    td.textContent = content === undefined || content === null ? '' : String(content);
+  }
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function row(cells) {
+  const tr = document.createElement('tr');
+  cells.forEach((c) => tr.appendChild(c instanceof Node ? c : cell(c)));
+  return tr;
+}
+
+function fill(tbodyId, rows, columns, append = false) {
+  const tbody = $(tbodyId);
+  if (!append) {
+    tbody.replaceChildren();
+  }
+  rows.forEach((r) => tbody.appendChild(r));
+  if (!tbody.children.length) {
+    const empty = cell('Nothing to show', 'empty');
+    empty.colSpan = columns;
+    tbody.appendChild(row([empty]));
+  }
+}
+
+function statusCell(status) {
+  return cell(status, 'status-' + status);
+}
+
+function progressCell(progress) {
+  if (!progress) {
+    return cell('');
+  }
+  const bar = document.createElement('progress');
+  bar.max = 100;
+  bar.value = progress.percent;
+  bar.title = progress.bytes_total
+    ? formatBytes(progress.bytes_processed) + ' of ' + formatBytes(progress.bytes_total)
+    : Math.round(progress.percent) + '%';
+  return cell(bar);
+}
+
+function cancelButton(jobID) {
+  const button = document.createElement('button');
+  button.type = 'button';
+  button.textContent = 'Cancel';
+  button.addEventListener('click', async () => {
+    if (!confirm('Cancel job ' + jobID + '?')) {
+      return;
+    }
+    try {
+      await api('/api/v2/cancel/' + encodeURIComponent(jobID), { method: 'DELETE' });
+      refreshActive();
+    } catch (err) {
+      showError(err);
+    }
+  });
+  return cell(button);
+}
+
+async function refreshActive() {
+  try {
+    const [running, pending] = await Promise.all([
+      api('/api/v2/jobs?status=running&limit=100'),
+      api('/api/v2/jobs?status=pending&limit=100'),
+    ]);
+    const jobs = running.jobs.concat(pending.jobs);
+    fill('active-jobs', jobs.map((job) => row([
+      job.job_id,
+      statusCell(job.status),
+      job.progress ? job.progress.stage : '',
+      progressCell(job.progress),
+      formatTime(job.created_at),
+      cancelButton(job.job_id),
+    ])), 6);
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function loadHistory(append) {
+  let query = '/api/v2/jobs?limit=' + HISTORY_PAGE_SIZE;
+  if (append && historyCursor) {
+    query += '&cursor=' + encodeURIComponent(historyCursor);
+  }
+  try {
+    const page = await api(query);
+    historyPaged = append;
+    historyCursor = page.next_cursor || '';
+    $('more-history').hidden = !historyCursor;
+    fill('job-history', page.jobs.map((job) => row([
+      job.job_id,
+      statusCell(job.status),
+      job.correlation_id,
+      cell(job.error_code || job.error || '', job.error ? 'error' : ''),
+      formatTime(job.created_at),
+      formatTime(job.updated_at),
+    ])), 6, append);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function refreshOverview() {
+  // Keep older pages the operator loaded on screen
+  if (!historyPaged) {
+    loadHistory(false);
+  }
+
+  try {
+    const capacity = await api('/api/v2/capacity');
+    fill('capacity', capacity.pools.map((pool) => row([
+      pool.host || '',
+      pool.name + (pool.default ? ' (default)' : ''),
+      pool.path,
+      formatBytes(pool.used_bytes),
+      pool.max_bytes ? formatBytes(pool.max_bytes) : 'unlimited',
+      formatBytes(pool.available_bytes),
+    ])), 6);
+  } catch (err) {
+    showError(err);
+  }
+
+  try {
+    const cache = await api('/api/v2/cache');
+    fill('cache', cache.images.map((image) => row([
+      image.host || '',
+      image.pool,
+      image.path,
+      formatBytes(image.size_bytes),
+      image.checksum,
+    ])), 5);
+  } catch (err) {
+    showError(err);
+  }
+
+  try {
+    const volumes = await api('/api/v2/volumes');
+    fill('volumes', volumes.volumes.map((volume) => row([
+      volume.host || '',
+      volume.name,
+      volume.device_path,
+      formatBytes(volume.size_bytes),
+      volume.attributes,
+    ])), 5);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+$('token-form').addEventListener('submit', (event) => {
+  event.preventDefault();
+  sessionStorage.setItem(tokenKey, $('token').value);
+  $('token').value = '';
+  refreshActive();
+  refreshOverview();
+});
+
+$('more-history').addEventListener('click', () => loadHistory(true));
+
+refreshActive();
+refreshOverview();
+setInterval(refreshActive, ACTIVE_INTERVAL_MS);
+setInterval(refreshOverview, OVERVIEW_INTERVAL_MS);
@@ -0,0 +1,32 @@
+// Package ui serves the embedded admin web UI, a single page that shows active jobs,
+// job history, cache contents, volumes and capacity using the /api/v2 endpoints.
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// basePath is where the UI is served
+const basePath = "/ui"
+
+//go:embed static
+var static embed.FS
+
+// Register serves the UI under /ui and redirects / to it. The page itself is public;
+// it authenticates its API calls with the token entered by the operator, or with the
+// browser's client certificate.
+func Register(router *gin.Engine) {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // The embedded directory is fixed at build time
+	}
+
+	router.StaticFS(basePath, http.FS(assets))
+	router.GET("/", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, basePath+"/")
+	})
+}
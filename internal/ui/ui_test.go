@@ -0,0 +1,41 @@
+package ui
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	router := gin.New()
+	Register(router)
+
+	tests := []struct {
+		path     string
+		code     int
+		contains string
+	}{
+		{"/ui/", http.StatusOK, "<title>libvirt-volume-provisioner</title>"},
+		{"/ui/app.js", http.StatusOK, "/api/v2/jobs"},
+		{"/ui/style.css", http.StatusOK, "progress"},
+		{"/ui/missing.js", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tt.path, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.path)
+		assert.Contains(t, w.Body.String(), tt.contains, tt.path)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/ui/", w.Header().Get("Location"))
+}
@@ -0,0 +1,109 @@
+package types
+
+import "errors"
+
+// ErrorCode is a stable, machine-readable identifier for a type of failure.
+type ErrorCode string
+
+// Error code constants.
+const (
+	ErrCodeInvalidRequest         ErrorCode = "INVALID_REQUEST"
+	ErrCodeUnknownProfile         ErrorCode = "UNKNOWN_PROFILE"
+	ErrCodeUnknownCachePool       ErrorCode = "UNKNOWN_CACHE_POOL"
+	ErrCodeNetBoxValidationFailed ErrorCode = "NETBOX_VALIDATION_FAILED"
+	ErrCodeJobNotFound            ErrorCode = "JOB_NOT_FOUND"
+	ErrCodeJobNotCancellable      ErrorCode = "JOB_NOT_CANCELLABLE"
+	ErrCodeJobNotPausable         ErrorCode = "JOB_NOT_PAUSABLE"
+	ErrCodeJobNotPaused           ErrorCode = "JOB_NOT_PAUSED"
+	ErrCodeJobCancelled           ErrorCode = "JOB_CANCELLED"
+	ErrCodeJobStuck               ErrorCode = "JOB_STUCK"
+	ErrCodeDependencyFailed       ErrorCode = "DEPENDENCY_FAILED"
+	ErrCodeImageNotAccessible     ErrorCode = "IMAGE_NOT_ACCESSIBLE"
+	ErrCodeCacheAllocationFailed  ErrorCode = "CACHE_ALLOCATION_FAILED"
+	ErrCodeInsufficientSpace      ErrorCode = "INSUFFICIENT_SPACE"
+	ErrCodeDownloadFailed         ErrorCode = "DOWNLOAD_FAILED"
+	ErrCodeSourceUnavailable      ErrorCode = "SOURCE_STORAGE_UNAVAILABLE"
+	ErrCodeChecksumMismatch       ErrorCode = "CHECKSUM_MISMATCH"
+	ErrCodeCompressionFailed      ErrorCode = "COMPRESSION_FAILED"
+	ErrCodeVolumeIncompatible     ErrorCode = "VOLUME_INCOMPATIBLE"
+	ErrCodeVolumeCreateFailed     ErrorCode = "VOLUME_CREATE_FAILED"
+	ErrCodeQuotaExceeded          ErrorCode = "QUOTA_EXCEEDED"
+	ErrCodeVolumeGroupFull        ErrorCode = "VOLUME_GROUP_FULL"
+	ErrCodeVolumeGroupNotFound    ErrorCode = "VOLUME_GROUP_NOT_FOUND"
+	ErrCodeDeviceFiltered         ErrorCode = "DEVICE_FILTERED"
+	ErrCodeVolumePopulateFailed   ErrorCode = "VOLUME_POPULATE_FAILED"
+	ErrCodeVolumeNoSpace          ErrorCode = "VOLUME_NO_SPACE"
+	ErrCodeImageCorrupt           ErrorCode = "IMAGE_CORRUPT"
+	ErrCodeImageUnsupported       ErrorCode = "IMAGE_UNSUPPORTED"
+	ErrCodePermissionDenied       ErrorCode = "PERMISSION_DENIED"
+	ErrCodeVolumeChecksumMismatch ErrorCode = "VOLUME_CHECKSUM_MISMATCH"
+	ErrCodeVolumeCorrupt          ErrorCode = "VOLUME_CORRUPT"
+	ErrCodeVolumeNotVerifiable    ErrorCode = "VOLUME_NOT_VERIFIABLE"
+	ErrCodeRollbackFailed         ErrorCode = "ROLLBACK_FAILED"
+	ErrCodeSnapshotFailed         ErrorCode = "SNAPSHOT_FAILED"
+	ErrCodeFormatFailed           ErrorCode = "FORMAT_FAILED"
+	ErrCodeVolumeMisaligned       ErrorCode = "VOLUME_MISALIGNED"
+	ErrCodeMultipathDegraded      ErrorCode = "MULTIPATH_DEGRADED"
+	ErrCodeVirtioDriversMissing   ErrorCode = "VIRTIO_DRIVERS_MISSING"
+	ErrCodeArchitectureMismatch   ErrorCode = "ARCHITECTURE_MISMATCH"
+	ErrCodeImageRequirements      ErrorCode = "IMAGE_REQUIREMENTS_NOT_MET"
+	ErrCodeImageExpired           ErrorCode = "IMAGE_EXPIRED"
+	ErrCodeVolumeNotFound         ErrorCode = "VOLUME_NOT_FOUND"
+	ErrCodeVolumeInUse            ErrorCode = "VOLUME_IN_USE"
+	ErrCodeVolumeAlreadyManaged   ErrorCode = "VOLUME_ALREADY_MANAGED"
+	ErrCodeVolumeAttached         ErrorCode = "VOLUME_ATTACHED"
+	ErrCodeVolumeOutsideTenant    ErrorCode = "VOLUME_OUTSIDE_TENANT"
+	ErrCodeConfirmationRequired   ErrorCode = "CONFIRMATION_REQUIRED"
+	ErrCodePeerUnavailable        ErrorCode = "PEER_UNAVAILABLE"
+	ErrCodeNotSupported           ErrorCode = "NOT_SUPPORTED"
+	ErrCodeMaintenance            ErrorCode = "MAINTENANCE_MODE"
+	ErrCodeQueueFull              ErrorCode = "QUEUE_FULL"
+	ErrCodeNotReady               ErrorCode = "NOT_READY"
+	ErrCodeInternal               ErrorCode = "INTERNAL_ERROR"
+)
+
+// Error is an error carrying an error code and optional details, such as
+// field errors or the output of a failed command.
+type Error struct {
+	Code    ErrorCode
+	Details map[string]string
+	Err     error
+}
+
+// NewError wraps err with an error code and optional details.
+func NewError(code ErrorCode, err error, details map[string]string) *Error {
+	return &Error{Code: code, Details: details, Err: err}
+}
+
+// Error returns the message of the wrapped error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCodeOf returns the code and details of the outermost coded error in
+// err's chain, or fallback and no details if there is none.
+func ErrorCodeOf(err error, fallback ErrorCode) (ErrorCode, map[string]string) {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code, coded.Details
+	}
+	return fallback, nil
+}
+
+// NewErrorResponse builds an error response for err, taking the error code and
+// details from err when it carries them.
+func NewErrorResponse(status int, errorMsg string, err error, fallback ErrorCode) ErrorResponse {
+	code, details := ErrorCodeOf(err, fallback)
+	return ErrorResponse{
+		Error:     errorMsg,
+		Message:   err.Error(),
+		Code:      status,
+		ErrorCode: code,
+		Details:   details,
+	}
+}
@@ -0,0 +1,52 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sectorSize is the granularity of volume sizes given in bytes
+const sectorSize = 512
+
+// sizeUnits are the units ParseSize accepts after the number
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// ParseSize parses a volume size given in bytes, e.g. "107374182400", or with a
+// binary unit, e.g. "50GiB". Decimal units such as GB are refused, as they are
+// read as either 10^9 or 2^30 bytes depending on the tool. The size must be a
+// positive whole number of 512 byte sectors.
+func ParseSize(s string) (int64, error) {
+	end := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(s)
+	}
+	digits, unit := s[:end], s[end:]
+	if digits == "" {
+		return 0, fmt.Errorf("invalid size %q: must start with a number", s)
+	}
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unit must be one of B, KiB, MiB, GiB or TiB", s)
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	size := n * multiplier
+	if size <= 0 {
+		return 0, fmt.Errorf("invalid size %q: must be positive", s)
+	}
+	if size%sectorSize != 0 {
+		return 0, fmt.Errorf("invalid size %q: must be a multiple of %d bytes", s, sectorSize)
+	}
+	return size, nil
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size        string
+		want        int64
+		expectError string
+	}{
+		{size: "107374182400", want: 100 << 30},
+		{size: "512B", want: 512},
+		{size: "64KiB", want: 64 << 10},
+		{size: "512MiB", want: 512 << 20},
+		{size: "50GiB", want: 50 << 30},
+		{size: "2TiB", want: 2 << 40},
+		{size: "", expectError: "must start with a number"},
+		{size: "GiB", expectError: "must start with a number"},
+		{size: "-1GiB", expectError: "must start with a number"},
+		{size: "50GB", expectError: "unit must be"},
+		{size: "50 GiB", expectError: "unit must be"},
+		{size: "50gib", expectError: "unit must be"},
+		{size: "1.5GiB", expectError: "unit must be"},
+		{size: "0", expectError: "must be positive"},
+		{size: "1000", expectError: "multiple of 512"},
+		{size: "99999999999999999999", expectError: "too large"},
+		{size: "9999999999TiB", expectError: "too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			size, err := ParseSize(tt.size)
+			if tt.expectError != "" {
+				assert.ErrorContains(t, err, tt.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, size)
+		})
+	}
+}
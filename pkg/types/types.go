@@ -4,21 +4,137 @@
 //nolint:revive // package name 'types' is standard for data structure definitions
 package types
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // ProvisionRequest represents a volume provisioning request.
 type ProvisionRequest struct {
-	ImageURL     string `binding:"required"       json:"image_url"`
-	VolumeName   string `binding:"required"       json:"volume_name"`
-	VolumeSizeGB int    `binding:"required,min=1" json:"volume_size_gb"`
+	ImageURL     string `json:"image_url"`
+	VolumeName   string `binding:"required"        json:"volume_name"`
+	VolumeSizeGB int    `binding:"omitempty,min=1" json:"volume_size_gb"`
 	ImageType    string `json:"image_type"`
+	// Type is the kind of volume to provision, VolumeTypeImage if unset
+	Type       string `binding:"omitempty,oneof=image blank swap" json:"type,omitempty"`
+	Profile    string `json:"profile,omitempty"`
+	CachePool  string `json:"cache_pool,omitempty"`
+	NetBoxVMID int    `json:"netbox_vm_id,omitempty"`
+	NetBoxDisk string `json:"netbox_disk,omitempty"`
+	TargetHost string `json:"target_host,omitempty"`
+	// AllowAttached overwrites an existing volume even if a libvirt domain uses it
+	AllowAttached bool `json:"allow_attached,omitempty"`
+	// Snapshot takes a snapshot of an existing volume before overwriting it, and
+	// restores the volume from it if provisioning fails
+	Snapshot bool `json:"snapshot,omitempty"`
+	// Filesystem is created on a new blank volume: ext4, xfs or none
+	Filesystem string `binding:"omitempty,oneof=ext4 xfs none" json:"filesystem,omitempty"`
+	// MkfsOptions are whitespace-separated arguments passed to mkfs before the device path
+	MkfsOptions string `json:"mkfs_options,omitempty"`
+	// CacheCompression stores a downloaded image in the cache as a qcow2 image
+	// compressed with zlib or zstd
+	CacheCompression string `binding:"omitempty,oneof=zlib zstd" json:"cache_compression,omitempty"`
+	// Windows enables checks and post-processing for Windows images
+	Windows *WindowsOptions `json:"windows,omitempty"`
+	// Overlay creates a qcow2 overlay file backed by the cached image instead of
+	// writing the image to an LVM volume
+	Overlay bool `json:"overlay,omitempty"`
+	// VolumeFormat is the format the image is converted to on the volume, raw or
+	// qcow2; it defaults to the volume backend's format
+	VolumeFormat string `binding:"omitempty,oneof=raw qcow2" json:"volume_format,omitempty"`
+	// CorrelationID is reported back in job status; it defaults to the job ID
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// VolumeSizeMiB sets the volume size in MiB instead of volume_size_gb, for volumes
+	// smaller than a GB or not a whole number of GB
+	VolumeSizeMiB int `binding:"omitempty,min=1" json:"volume_size_mib,omitempty"`
+	// Architecture is the CPU architecture the image must be built for, e.g. x86_64 or
+	// aarch64; the job fails if the image is for another or its architecture is unknown
+	Architecture string `json:"architecture,omitempty"`
+	// VolumeSize sets the volume size in bytes, or with a binary unit such as "50GiB",
+	// instead of volume_size_gb; see ParseSize
+	VolumeSize string `json:"volume_size,omitempty"`
+	// DependsOn lists the jobs that must complete successfully before this job starts
+	DependsOn []string `json:"depends_on,omitempty"`
+	// NotBefore defers the job until the given time; it is kept across restarts
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	// Labels tag the job with arbitrary key/value pairs, e.g. its environment, ticket
+	// or tenant; they are reported in job status and events and filter job listings
+	Labels map[string]string `json:"labels,omitempty"`
+	// Identity is the client that submitted the request, set by the server from
+	// the client's credentials and never read from the request body
+	Identity string `json:"-"`
+}
+
+// WindowsOptions configures the provisioning of a Windows image.
+type WindowsOptions struct {
+	// ExpandPartition is the guest partition, e.g. /dev/sda2, grown together with
+	// its NTFS filesystem to fill the volume
+	ExpandPartition string `json:"expand_partition,omitempty"`
+	// RequireVirtio fails the job if the image lacks virtio storage drivers
+	RequireVirtio bool `json:"require_virtio,omitempty"`
+}
+
+// Volume types of a provisioning request
+const (
+	// VolumeTypeImage volumes are populated from an image
+	VolumeTypeImage = "image"
+	// VolumeTypeBlank volumes are created empty, e.g. for data disks
+	VolumeTypeBlank = "blank"
+	// VolumeTypeSwap volumes are created empty and set up as swap space
+	VolumeTypeSwap = "swap"
+)
+
+// FilesystemNone leaves a blank volume unformatted
+const FilesystemNone = "none"
+
+// NeedsImage reports whether the requested volume is populated from an image
+func (r ProvisionRequest) NeedsImage() bool {
+	return r.Type == "" || r.Type == VolumeTypeImage
+}
+
+// HasSize reports whether the request sets a volume size
+func (r ProvisionRequest) HasSize() bool {
+	return r.VolumeSize != "" || r.VolumeSizeMiB != 0 || r.VolumeSizeGB != 0
+}
+
+// SizeBytes returns the requested volume size in bytes, from volume_size or
+// volume_size_mib if set, otherwise from volume_size_gb. An invalid volume_size
+// gives 0.
+func (r ProvisionRequest) SizeBytes() int64 {
+	if r.VolumeSize != "" {
+		size, err := ParseSize(r.VolumeSize)
+		if err != nil {
+			return 0
+		}
+		return size
+	}
+	if r.VolumeSizeMiB != 0 {
+		return int64(r.VolumeSizeMiB) << 20
+	}
+	return int64(r.VolumeSizeGB) << 30
+}
+
+// SizeGB returns the requested volume size in GB, rounded up
+func (r ProvisionRequest) SizeGB() int {
+	return int((r.SizeBytes() + 1<<30 - 1) >> 30)
+}
+
+// EffectiveRequest is a provisioning request as the server carries it out, after
+// the profile and server-side defaults have been applied. Verify is set instead for
+// jobs checking the integrity of an existing volume.
+type EffectiveRequest struct {
+	ProvisionRequest
+	VolumeGroup    string `json:"volume_group,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	Verify         bool   `json:"verify,omitempty"`
 }
 
 // ProvisionResponse represents the response to a provisioning request.
 type ProvisionResponse struct {
-	JobID     string `json:"job_id"`
-	CacheHit  bool   `json:"cache_hit,omitempty"`
-	ImagePath string `json:"image_path,omitempty"`
+	JobID         string `json:"job_id"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	CacheHit      bool   `json:"cache_hit,omitempty"`
+	ImagePath     string `json:"image_path,omitempty"`
 }
 
 // JobStatus represents the status of a provisioning job.
@@ -34,6 +150,8 @@ const (
 	StatusCompleted JobStatus = "completed"
 	// StatusFailed indicates the job finished with an error.
 	StatusFailed JobStatus = "failed"
+	// StatusPaused indicates the job was paused and will not proceed until resumed.
+	StatusPaused JobStatus = "paused"
 )
 
 // ProgressInfo represents progress information for a job.
@@ -42,26 +160,540 @@ type ProgressInfo struct {
 	Percent        float64 `json:"percent"`
 	BytesProcessed int64   `json:"bytes_processed"`
 	BytesTotal     int64   `json:"bytes_total"`
+	// HashBytesPerSec is the throughput of the checksum calculated while downloading
+	HashBytesPerSec float64 `json:"hash_bytes_per_sec,omitempty"`
+	// BytesPerSec is the recent throughput of a download or raw image copy, and ETA
+	// when the stage will finish at that rate
+	BytesPerSec float64    `json:"bytes_per_sec,omitempty"`
+	ETA         *time.Time `json:"eta,omitempty"`
+}
+
+// StageTiming records when a job entered and left a stage.
+type StageTiming struct {
+	Stage      string     `json:"stage"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DurationMs int64      `json:"duration_ms,omitempty"`
+	// Attempts is the number of attempts retried operations made in the stage
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// SLOResult reports a completed job's duration against its provisioning SLO target.
+type SLOResult struct {
+	// MaxImageSize is the image size bucket whose target applied, e.g. "10GB" or "+Inf"
+	MaxImageSize string `json:"max_image_size"`
+	TargetMs     int64  `json:"target_ms"`
+	DurationMs   int64  `json:"duration_ms"`
+	Violated     bool   `json:"violated"`
 }
 
 // StatusResponse represents the response to a status query.
 type StatusResponse struct {
-	JobID         string        `json:"job_id"`
-	Status        JobStatus     `json:"status"`
-	Progress      *ProgressInfo `json:"progress,omitempty"`
-	Error         string        `json:"error,omitempty"`
-	CorrelationID string        `json:"correlation_id,omitempty"`
-	CacheHit      *bool         `json:"cache_hit,omitempty"`
-	ImagePath     string        `json:"image_path,omitempty"`
-	CreatedAt     time.Time     `json:"created_at"`
-	UpdatedAt     time.Time     `json:"updated_at"`
+	JobID         string            `json:"job_id"`
+	Status        JobStatus         `json:"status"`
+	Progress      *ProgressInfo     `json:"progress,omitempty"`
+	StageTimings  []StageTiming     `json:"stage_timings,omitempty"`
+	RetryCount    int               `json:"retry_count,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	ErrorCode     ErrorCode         `json:"error_code,omitempty"`
+	ErrorDetails  map[string]string `json:"error_details,omitempty"`
+	CorrelationID string            `json:"correlation_id,omitempty"`
+	// OriginalError is the error that failed the job and RollbackError the failure to
+	// roll it back, set only if rolling back failed, when Error is ROLLBACK_FAILED
+	OriginalError     string    `json:"original_error,omitempty"`
+	OriginalErrorCode ErrorCode `json:"original_error_code,omitempty"`
+	RollbackError     string    `json:"rollback_error,omitempty"`
+	// Identity is the client that submitted the job, e.g. cert:<common name> or token:<hash prefix>
+	Identity string `json:"identity,omitempty"`
+	// ProvisionerVersion is the version of the provisioner that ran the job
+	ProvisionerVersion string `json:"provisioner_version,omitempty"`
+	// Labels are the key/value pairs the job was tagged with
+	Labels map[string]string `json:"labels,omitempty"`
+	// Request is the request as submitted; EffectiveRequest is what the server carries out
+	Request          *ProvisionRequest `json:"request,omitempty"`
+	EffectiveRequest *EffectiveRequest `json:"effective_request,omitempty"`
+	CacheHit         *bool             `json:"cache_hit,omitempty"`
+	ImagePath        string            `json:"image_path,omitempty"`
+	DevicePath       string            `json:"device_path,omitempty"`
+	VolumeSizeBytes  int64             `json:"volume_size_bytes,omitempty"`
+	ImageChecksum    string            `json:"image_checksum,omitempty"`
+	WrittenChecksum  string            `json:"written_checksum,omitempty"`
+	WriteVerified    *bool             `json:"write_verified,omitempty"`
+	NetBox           *NetBoxObject     `json:"netbox,omitempty"`
+	Host             string            `json:"host,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+
+	// ImageArchitecture is the CPU architecture of the image, if known
+	ImageArchitecture string `json:"image_architecture,omitempty"`
+	// ImageMetadata is read from the image's .meta.json file, if it has one
+	ImageMetadata *ImageMetadata `json:"image_metadata,omitempty"`
+	// SLO is the job's duration against its provisioning SLO target, if one applies
+	SLO *SLOResult `json:"slo,omitempty"`
+	// Queue is where the job stands while it waits for capacity to start work
+	Queue *QueueInfo `json:"queue,omitempty"`
+	// Verification is the outcome of a volume integrity check, for verification jobs
+	Verification *VolumeVerification `json:"verification,omitempty"`
+}
+
+// Methods of checking the integrity of a volume
+const (
+	// VerifyMethodChecksum re-hashes the data written to a volume and compares it with
+	// the checksum recorded when the volume was provisioned
+	VerifyMethodChecksum = "checksum"
+	// VerifyMethodQemuImgCheck runs qemu-img check on a qcow2 overlay or a volume written as qcow2
+	VerifyMethodQemuImgCheck = "qemu-img-check"
+)
+
+// VolumeVerification is the outcome of a volume integrity check. Verified is unset
+// until the check has finished.
+type VolumeVerification struct {
+	VolumeName string `json:"volume_name"`
+	Method     string `json:"method"`
+	Verified   *bool  `json:"verified,omitempty"`
+	// ExpectedChecksum is the checksum recorded for the first VerifiedBytes bytes of
+	// the volume, and ActualChecksum what they hash to now
+	ExpectedChecksum string `json:"expected_checksum,omitempty"`
+	ActualChecksum   string `json:"actual_checksum,omitempty"`
+	VerifiedBytes    int64  `json:"verified_bytes,omitempty"`
+	// Corruptions, Leaks and CheckErrors are what qemu-img check found in an overlay
+	// or a volume written as qcow2.
+	// Leaked clusters waste space but do not fail the check.
+	Corruptions int `json:"corruptions,omitempty"`
+	Leaks       int `json:"leaks,omitempty"`
+	CheckErrors int `json:"check_errors,omitempty"`
+}
+
+// VerifyVolumeResponse is the response to starting a volume integrity check.
+type VerifyVolumeResponse struct {
+	JobID      string `json:"job_id"`
+	VolumeName string `json:"volume_name"`
+	Method     string `json:"method"`
+}
+
+// QueueInfo is where a job waiting for capacity to start work stands in the queue.
+type QueueInfo struct {
+	// Position is 1 for the next job to start
+	Position int `json:"position"`
+	// EstimatedStart is when the job is expected to start, from the recent duration of
+	// jobs and the disk concurrency. It is omitted until a job has finished, and while
+	// the queue is paused or outside the provisioning windows.
+	EstimatedStart *time.Time `json:"estimated_start,omitempty"`
+}
+
+// JobListRequest represents the query parameters of a jobs listing.
+type JobListRequest struct {
+	Status string    `binding:"omitempty,oneof=pending running paused completed failed" form:"status"`
+	SortBy string    `binding:"omitempty,oneof=created_at updated_at"                   form:"sort"`
+	Order  string    `binding:"omitempty,oneof=asc desc"                                form:"order"`
+	Since  time.Time `form:"since"                                                      time_format:"2006-01-02T15:04:05Z07:00"`
+	Until  time.Time `form:"until"                                                      time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int       `binding:"omitempty,min=1,max=1000"                                form:"limit"`
+	Cursor string    `form:"cursor"`
+	// Identity lists only the jobs submitted by a client, as reported in job statuses
+	Identity string `form:"identity"`
+	// SLOViolated lists only the jobs that missed their provisioning SLO target
+	SLOViolated bool `form:"slo_violated"`
+	// Labels lists only the jobs tagged with every given label, each as key=value
+	Labels []string `form:"label"`
+	// VolumeNamePrefix lists only the jobs for volumes whose names start with it
+	VolumeNamePrefix string `form:"volume_name_prefix"`
+}
+
+// BulkCancelRequest selects the unfinished jobs to cancel at once. A job must match
+// every filter given; All is required to cancel every unfinished job without filters.
+type BulkCancelRequest struct {
+	Status string `binding:"omitempty,oneof=pending running paused" json:"status,omitempty"`
+	// CorrelationIDPrefix selects jobs whose correlation ID starts with it
+	CorrelationIDPrefix string `json:"correlation_id_prefix,omitempty"`
+	// OlderThan selects jobs submitted longer ago, as a duration such as "15m"
+	OlderThan string `json:"older_than,omitempty"`
+	// VolumeNamePrefix selects jobs for volumes whose names start with it
+	VolumeNamePrefix string `json:"volume_name_prefix,omitempty"`
+	All              bool   `json:"all,omitempty"`
+}
+
+// Validate checks that the request has a filter or All, returning the minimum age
+// of the jobs it selects
+func (r BulkCancelRequest) Validate() (time.Duration, error) {
+	var olderThan time.Duration
+	if r.OlderThan != "" {
+		var err error
+		if olderThan, err = time.ParseDuration(r.OlderThan); err != nil || olderThan <= 0 {
+			return 0, fmt.Errorf("older_than must be a positive duration such as 15m: %s", r.OlderThan)
+		}
+	}
+	if r.Status == "" && r.CorrelationIDPrefix == "" && r.VolumeNamePrefix == "" && olderThan == 0 && !r.All {
+		return 0, fmt.Errorf("cancelling jobs in bulk requires a filter, or all")
+	}
+	return olderThan, nil
+}
+
+// BulkCancelResponse lists the jobs cancelled by a bulk cancellation.
+type BulkCancelResponse struct {
+	Cancelled []string `json:"cancelled"`
+	// Failed holds the reason each matching job could not be cancelled, e.g. having
+	// finished in the meantime, by job ID
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// JobListResponse represents a page of jobs.
+type JobListResponse struct {
+	Jobs       []StatusResponse `json:"jobs"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// JobEvent represents a job status change published to message queues.
+type JobEvent struct {
+	JobID      string    `json:"job_id,omitempty"`
+	VolumeName string    `json:"volume_name,omitempty"`
+	Status     JobStatus `json:"status"`
+	Stage      string    `json:"stage,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ErrorCode  ErrorCode `json:"error_code,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// NetBoxObject identifies the NetBox object a job is tagged with.
+type NetBoxObject struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+// ValidateImageRequest represents a request to check an image without provisioning.
+type ValidateImageRequest struct {
+	ImageURL     string `binding:"required"        json:"image_url"`
+	ImageType    string `json:"image_type,omitempty"`
+	VolumeSizeGB int    `binding:"omitempty,min=1" json:"volume_size_gb,omitempty"`
+}
+
+// ValidateImageResponse reports whether an image can be provisioned from.
+type ValidateImageResponse struct {
+	ImageURL         string `json:"image_url"`
+	Valid            bool   `json:"valid"`
+	Error            string `json:"error,omitempty"`
+	SizeBytes        int64  `json:"size_bytes,omitempty"`
+	Format           string `json:"format,omitempty"`
+	VirtualSizeBytes int64  `json:"virtual_size_bytes,omitempty"`
+	// Metadata is read from the image's .meta.json file, if it has one
+	Metadata *ImageMetadata `json:"metadata,omitempty"`
+}
+
+// ImageMetadata describes an image, read from the optional .meta.json file next to
+// the image in MinIO.
+type ImageMetadata struct {
+	// OSFamily is the family of the image's operating system, e.g. linux or windows
+	OSFamily string `json:"os_family,omitempty"`
+	// MinDiskGB is the smallest volume the image can be provisioned onto
+	MinDiskGB int `json:"min_disk_gb,omitempty"`
+	// DefaultLogin is the user the image's cloud-init or equivalent sets up
+	DefaultLogin string `json:"default_login,omitempty"`
+	// Architecture is the CPU architecture the image is built for, e.g. x86_64
+	Architecture string `json:"architecture,omitempty"`
+	// Expires is when the image is deprecated
+	Expires *time.Time `json:"expires,omitempty"`
 }
 
 // ErrorResponse represents an error response.
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-	Code    int    `json:"code"`
+	Error     string            `json:"error"`
+	Message   string            `json:"message"`
+	Code      int               `json:"code"`
+	ErrorCode ErrorCode         `json:"error_code,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// PoolCapacity represents usage and limits of a single image cache pool.
+type PoolCapacity struct {
+	Host           string `json:"host,omitempty"`
+	Name           string `json:"name"`
+	Path           string `json:"path"`
+	Default        bool   `json:"default"`
+	UsedBytes      uint64 `json:"used_bytes"`
+	MaxBytes       uint64 `json:"max_bytes,omitempty"`
+	AvailableBytes uint64 `json:"available_bytes"`
+}
+
+// CapacityResponse represents the response to a capacity query.
+type CapacityResponse struct {
+	Pools []PoolCapacity `json:"pools"`
+}
+
+// CachedImage represents an image held in an image cache pool.
+type CachedImage struct {
+	Host      string `json:"host,omitempty"`
+	Pool      string `json:"pool"`
+	Path      string `json:"path"`
+	SizeBytes uint64 `json:"size_bytes"`
+	Checksum  string `json:"checksum"`
+}
+
+// CacheListResponse represents the response to a cache contents query.
+type CacheListResponse struct {
+	Images []CachedImage `json:"images"`
+}
+
+// Volume represents an LVM volume in the provisioner's volume group.
+type Volume struct {
+	Host       string `json:"host,omitempty"`
+	Name       string `json:"name"`
+	DevicePath string `json:"device_path"`
+	SizeBytes  int64  `json:"size_bytes"`
+	Attributes string `json:"attributes"`
+	// Origin is the volume a snapshot was taken of
+	Origin string `json:"origin,omitempty"`
+	// Pool is the thin pool of a thin volume
+	Pool string `json:"pool,omitempty"`
+	// DataPercent is the space used by thin pools, thin volumes and snapshots
+	DataPercent *float64 `json:"data_percent,omitempty"`
+}
+
+// VolumeListResponse represents the response to a volume listing.
+type VolumeListResponse struct {
+	Volumes []Volume `json:"volumes"`
+}
+
+// PendingCleanup is a volume of a failed job whose rollback failed, waiting to be
+// deleted in the background.
+type PendingCleanup struct {
+	Host          string    `json:"host,omitempty"`
+	VolumeName    string    `json:"volume_name"`
+	JobID         string    `json:"job_id"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error"`
+	CreatedAt     time.Time `json:"created_at"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+}
+
+// CleanupListResponse represents the response to a listing of pending cleanups.
+type CleanupListResponse struct {
+	Cleanups []PendingCleanup `json:"cleanups"`
+}
+
+// VolumeDeletionRequest represents the query parameters of a volume deletion.
+// Either Force or a Token from a deletion preview of the volume is required.
+type VolumeDeletionRequest struct {
+	Force bool   `form:"force"`
+	Token string `form:"token"`
+	// AllowAttached deletes the volume even if a stopped libvirt domain uses it
+	AllowAttached bool `form:"allow_attached"`
+}
+
+// DomainDisk is a disk of a libvirt domain, backed by the block device or file at Path.
+type DomainDisk struct {
+	Domain  string `json:"domain"`
+	Running bool   `json:"running"`
+	Path    string `json:"path"`
+}
+
+// AttachedDomain is a libvirt domain with a disk backed by a volume.
+type AttachedDomain struct {
+	Name    string `json:"name"`
+	Running bool   `json:"running"`
+}
+
+// VolumeDeletionPreview shows what deleting a volume would remove, with the
+// token confirming the deletion.
+type VolumeDeletionPreview struct {
+	Name        string `json:"name"`
+	VolumeGroup string `json:"volume_group"`
+	DevicePath  string `json:"device_path"`
+	SizeBytes   int64  `json:"size_bytes"`
+	// Open reports whether the volume's device is open, e.g. by a running VM
+	Open bool `json:"open"`
+	// Domains are the libvirt domains using the volume
+	Domains []AttachedDomain `json:"domains,omitempty"`
+	// JobID and ImageURL identify the job that created the volume, if it was the provisioner
+	JobID     string     `json:"job_id,omitempty"`
+	ImageURL  string     `json:"image_url,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Token     string     `json:"token"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+// ImageVolumesRequest represents the query parameters of an image's volume listing.
+type ImageVolumesRequest struct {
+	IncludeDeleted bool `form:"include_deleted"`
+}
+
+// ProvisionedVolume represents a volume the provisioner created, and the image it was built from.
+// Adopted volumes were created outside the provisioner, and have no job.
+type ProvisionedVolume struct {
+	Host          string     `json:"host,omitempty"`
+	Name          string     `json:"name"`
+	VolumeGroup   string     `json:"volume_group"`
+	SizeGB        int        `json:"size_gb"`
+	ImageURL      string     `json:"image_url"`
+	ImageChecksum string     `json:"image_checksum"`
+	JobID         string     `json:"job_id"`
+	Adopted       bool       `json:"adopted,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Kinds of reconciliation findings
+const (
+	// FindingSizeMismatch is a volume whose size differs from the size NetBox records
+	FindingSizeMismatch = "size_mismatch"
+	// FindingOrphanVolume is a volume that is not a disk of any libvirt domain
+	FindingOrphanVolume = "orphan_volume"
+	// FindingUnrecordedVolume is a volume missing from the provisioner's volume records
+	FindingUnrecordedVolume = "unrecorded_volume"
+	// FindingMissingVolume is a volume that a libvirt domain or the volume records refer
+	// to, but that does not exist
+	FindingMissingVolume = "missing_volume"
+	// FindingNetBoxLookupFailed is a volume whose NetBox virtual machine or disk could not be looked up
+	FindingNetBoxLookupFailed = "netbox_lookup_failed"
+)
+
+// ReconciledVolume is a volume of the volume group as LVM, libvirt, the volume records
+// and NetBox see it.
+type ReconciledVolume struct {
+	Host      string `json:"host,omitempty"`
+	Name      string `json:"name"`
+	SizeBytes int64  `json:"size_bytes"`
+	// Domains are the libvirt domains with the volume as a disk
+	Domains []string `json:"domains,omitempty"`
+	// Recorded is set if the volume is in the provisioner's volume records
+	Recorded bool   `json:"recorded"`
+	JobID    string `json:"job_id,omitempty"`
+	// NetBox is the virtual machine the volume was provisioned for, and NetBoxSizeMB
+	// the size NetBox records for its disk NetBoxDisk, or for all its disks if that is empty
+	NetBox       *NetBoxObject `json:"netbox,omitempty"`
+	NetBoxDisk   string        `json:"netbox_disk,omitempty"`
+	NetBoxSizeMB int           `json:"netbox_size_mb,omitempty"`
+}
+
+// ReconciliationFinding is a discrepancy between LVM, libvirt domains, the volume
+// records and NetBox.
+type ReconciliationFinding struct {
+	Host       string `json:"host,omitempty"`
+	Kind       string `json:"kind"`
+	VolumeName string `json:"volume_name"`
+	Domain     string `json:"domain,omitempty"`
+	Message    string `json:"message"`
+}
+
+// ReconciliationReport represents the response to a reconciliation.
+type ReconciliationReport struct {
+	Volumes  []ReconciledVolume      `json:"volumes"`
+	Findings []ReconciliationFinding `json:"findings"`
+}
+
+// VolumeAdoptionRequest represents a request to record a volume created outside the
+// provisioner, so that it can be managed like the volumes the provisioner created.
+// The image it was built from is optional.
+type VolumeAdoptionRequest struct {
+	ImageURL      string `binding:"omitempty,url"                json:"image_url,omitempty"`
+	ImageChecksum string `binding:"omitempty,len=64,hexadecimal" json:"image_checksum,omitempty"`
+}
+
+// ImageVolumesResponse represents the volumes built from an image.
+type ImageVolumesResponse struct {
+	Checksum string              `json:"checksum"`
+	Volumes  []ProvisionedVolume `json:"volumes"`
+}
+
+// ResultDocument records the provenance of a provisioned volume alongside the volume,
+// so it can be identified without the job database.
+type ResultDocument struct {
+	Name          string    `json:"name"`
+	VolumeGroup   string    `json:"volume_group,omitempty"`
+	DevicePath    string    `json:"device_path"`
+	VolumeFormat  string    `json:"volume_format,omitempty"`
+	SizeBytes     int64     `json:"size_bytes,omitempty"`
+	ImageURL      string    `json:"image_url,omitempty"`
+	ImageChecksum string    `json:"image_checksum,omitempty"`
+	Architecture  string    `json:"architecture,omitempty"`
+	JobID         string    `json:"job_id"`
+	ProvisionedAt time.Time `json:"provisioned_at"`
+}
+
+// JobManifest records a completed job in MinIO, so that reporting pipelines can
+// collect what each hypervisor provisioned without calling its API.
+type JobManifest struct {
+	Host      string          `json:"host"`
+	Job       *StatusResponse `json:"job"`
+	WrittenAt time.Time       `json:"written_at"`
+}
+
+// MaintenanceRequest represents a request to enter or leave maintenance mode.
+type MaintenanceRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// MaintenanceStatus reports whether the provisioner accepts new jobs.
+type MaintenanceStatus struct {
+	Maintenance bool `json:"maintenance"`
+	ActiveJobs  int  `json:"active_jobs"`
+	// WindowOpen reports whether provisioning windows currently allow jobs to run
+	WindowOpen bool       `json:"window_open"`
+	Windows    string     `json:"windows,omitempty"`
+	NextWindow *time.Time `json:"next_window,omitempty"`
+}
+
+// RuntimeSettings are the settings an administrator can change while the provisioner
+// runs, e.g. during an incident.
+type RuntimeSettings struct {
+	// DownloadConcurrency and DiskConcurrency limit the jobs downloading images and
+	// writing volumes at the same time
+	DownloadConcurrency int `json:"download_concurrency"`
+	DiskConcurrency     int `json:"disk_concurrency"`
+	// DownloadBytesPerSec limits the combined rate of downloads from MinIO; zero is unlimited
+	DownloadBytesPerSec int64 `json:"download_bytes_per_sec"`
+	// QueuePaused holds new and pending jobs in the pending state instead of starting them
+	QueuePaused bool `json:"queue_paused"`
+	// Overridden lists the settings changed at runtime, which take precedence over the
+	// configuration until reset
+	Overridden []string   `json:"overridden,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// SettingsUpdate changes runtime settings. Settings it omits are left as they are.
+type SettingsUpdate struct {
+	DownloadConcurrency *int   `binding:"omitempty,min=1,max=64" json:"download_concurrency,omitempty"`
+	DiskConcurrency     *int   `binding:"omitempty,min=1,max=64" json:"disk_concurrency,omitempty"`
+	DownloadBytesPerSec *int64 `binding:"omitempty,min=0"        json:"download_bytes_per_sec,omitempty"`
+	QueuePaused         *bool  `json:"queue_paused,omitempty"`
+	// Reset discards the settings changed at runtime before applying the others,
+	// returning to the configuration
+	Reset bool `json:"reset,omitempty"`
+}
+
+// SelfTestCheck is the result of one startup check of the environment.
+type SelfTestCheck struct {
+	Name string `json:"name"`
+	// Critical checks must pass for the provisioner to accept jobs
+	Critical   bool   `json:"critical"`
+	Passed     bool   `json:"passed"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// SelfTestReport is the environment report of the startup self-test.
+type SelfTestReport struct {
+	// Ready is false if a critical check failed
+	Ready     bool            `json:"ready"`
+	StartedAt time.Time       `json:"started_at"`
+	Checks    []SelfTestCheck `json:"checks"`
+}
+
+// VersionResponse describes the running provisioner binary and, if a minimum version
+// manifest was checked at startup, whether it is outdated.
+type VersionResponse struct {
+	Version   string `json:"version"`
+	BuildTime string `json:"build_time"`
+	GitCommit string `json:"git_commit"`
+	GoVersion string `json:"go_version"`
+	// MinimumVersion is the minimum version in the manifest, empty if none was read
+	MinimumVersion string `json:"minimum_version,omitempty"`
+	// Outdated is set if Version is older than MinimumVersion
+	Outdated bool `json:"outdated"`
+	// Message is the manifest's explanation of why older versions must be replaced
+	Message string `json:"message,omitempty"`
 }
 
 // HealthResponse represents a health check response.
@@ -70,4 +702,6 @@ type HealthResponse struct {
 	Timestamp time.Time `json:"timestamp"`
 	Version   string    `json:"version"`
 	Uptime    string    `json:"uptime"`
+	// Checks maps each dependency that failed its check to the reason
+	Checks map[string]string `json:"checks,omitempty"`
 }